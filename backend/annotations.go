@@ -0,0 +1,356 @@
+package backend
+
+import (
+	"fmt"
+	FE "pop/frontend"
+	"pop/frontend/types/ast"
+	"pop/resolver"
+)
+
+// checkName is the native that checks a value against a type annotation
+// when Options.CheckTypes is set. Identifiers cannot start with `$`, so no
+// program can shadow it.
+const checkName = "$check"
+
+// Optimizer returns what programs are rewritten with before they run:
+// Options.Optimizer, after the rewriting that checks annotations if
+// Options.CheckTypes is set. It is nil if programs run as written.
+func (it *Interpreter) Optimizer() Optimizer {
+	if !it.Options.CheckTypes {
+		return it.Options.Optimizer
+	}
+	return typeChecks{next: it.Options.Optimizer}
+}
+
+// typeChecks makes programs check their annotations as they run, then
+// optimizes them with next if it is set.
+type typeChecks struct {
+	next Optimizer
+}
+
+func (t typeChecks) Optimize(program ast.Program) ast.Program {
+	program = annotate(program)
+	if t.next != nil {
+		program = t.next.Optimize(program)
+	}
+	return program
+}
+
+// String tells compiled programs with checks apart from those without in
+// the bytecode cache.
+func (t typeChecks) String() string {
+	if t.next == nil {
+		return "check-types"
+	}
+	return fmt.Sprintf("check-types,%v", t.next)
+}
+
+// annotate returns a copy of program in which the arguments and popped
+// values of annotated functions, and the values given to annotated
+// variables, go through the check native.
+func annotate(program ast.Program) ast.Program {
+	a := &annotator{aliases: map[string]*ast.TypeExpr{}, assigned: map[ast.Position]*resolver.Declaration{}}
+	var symbols resolver.Symbols
+	resolver.Resolve(program, resolver.Options{Symbols: &symbols})
+	for _, ref := range symbols.References {
+		if ref.Assignment && ref.Declaration != nil {
+			a.assigned[ref.Pos] = ref.Declaration
+		}
+	}
+	var aliases func(node ast.ASTNode) ast.ASTNode
+	aliases = func(node ast.ASTNode) ast.ASTNode {
+		if alias, ok := node.(ast.TypeAliasNode); ok {
+			if _, exists := a.aliases[alias.Name]; !exists {
+				a.aliases[alias.Name] = alias.Type
+			}
+		}
+		return ast.MapChildren(node, aliases)
+	}
+	aliases(program)
+
+	return a.node(program).(ast.Program)
+}
+
+type annotator struct {
+	// aliases are the types named by type aliases
+	aliases map[string]*ast.TypeExpr
+	// assigned are the declarations of the variables assigned to, by the
+	// position of the assignment's target
+	assigned map[ast.Position]*resolver.Declaration
+	// fn is the function whose body is being rewritten, nil outside of
+	// functions
+	fn *ast.FunctionDeclarationNode
+}
+
+func (a *annotator) node(node ast.ASTNode) ast.ASTNode {
+	switch n := node.(type) {
+	case ast.VariableDeclarationNode:
+		if n.Type != nil {
+			value := n.Value
+			if value == nil {
+				value = ast.NullLiteralExprNode{Pos: n.NamePos}
+			}
+			n.Value = a.check(a.node(value), n.Type, fmt.Sprintf("variable '%s'", n.Identifier))
+			return n
+		}
+	case ast.FunctionDeclarationNode:
+		return a.function(n)
+	case ast.ReturnStatementNode:
+		if a.fn != nil && a.fn.ReturnType != nil {
+			value := n.Value
+			if value == nil {
+				value = ast.NullLiteralExprNode{Pos: n.Pos}
+			}
+			n.Value = a.check(a.node(value), a.fn.ReturnType, a.popped())
+			return n
+		}
+	case ast.AssignmentExprNode:
+		if target, ok := n.Assignee.(ast.IdentifierExprNode); ok {
+			if t, what := a.declared(a.assigned[target.Pos]); t != nil {
+				n.Value = a.check(a.node(n.Value), t, what)
+				return n
+			}
+		}
+	}
+	return ast.MapChildren(node, a.node)
+}
+
+// function rewrites fn to check its arguments when it is called and the
+// values it pops.
+func (a *annotator) function(fn ast.FunctionDeclarationNode) ast.ASTNode {
+	outer := a.fn
+	a.fn = &fn
+	defer func() { a.fn = outer }()
+
+	body := make([]ast.ASTNode, 0, len(fn.Body)+len(fn.Params))
+	for i, t := range fn.ParamTypes {
+		if t != nil {
+			param := ast.IdentifierExprNode{Symbol: fn.Params[i], Pos: fn.ParamPos[i]}
+			check := a.check(param, t, fmt.Sprintf("argument '%s' of %s", fn.Params[i], fn.Name)).(ast.CallExprNode)
+			// The caller passed the argument, so the error is its own
+			check.Args = append(check.Args, ast.BooleanLiteralExprNode{Value: true, Pos: param.Pos})
+			body = append(body, check)
+		}
+	}
+	for _, stmt := range fn.Body {
+		body = append(body, a.node(stmt))
+	}
+
+	switch {
+	case len(fn.Body) == 0 && len(body) > 0:
+		// A function without statements still returns null
+		body = append(body, ast.NullLiteralExprNode{Pos: fn.Pos})
+	case len(fn.Body) > 0 && fn.ReturnType != nil && expression(fn.Body[len(fn.Body)-1]):
+		// So does the value of its last statement
+		last := len(body) - 1
+		body[last] = a.check(body[last], fn.ReturnType, a.popped())
+	}
+	fn.Body = body
+	return fn
+}
+
+// popped describes the values the function being rewritten pops.
+func (a *annotator) popped() string {
+	return fmt.Sprintf("value popped by %s", a.fn.Name)
+}
+
+// declared returns the annotation of decl, and what it is for, or nil if
+// it has none.
+func (a *annotator) declared(decl *resolver.Declaration) (*ast.TypeExpr, string) {
+	if decl == nil {
+		return nil, ""
+	}
+	switch n := decl.Node.(type) {
+	case ast.VariableDeclarationNode:
+		if decl.Kind == resolver.Variable {
+			return n.Type, fmt.Sprintf("variable '%s'", n.Identifier)
+		}
+	case ast.FunctionDeclarationNode:
+		if decl.Kind != resolver.Parameter {
+			return nil, ""
+		}
+		for i, pos := range n.ParamPos {
+			if pos == decl.Pos && i < len(n.ParamTypes) {
+				return n.ParamTypes[i], fmt.Sprintf("argument '%s' of %s", n.Params[i], n.Name)
+			}
+		}
+	}
+	return nil, ""
+}
+
+// check returns a call of the check native that returns value if it is of
+// type t, with the type aliases in t written out.
+func (a *annotator) check(value ast.ASTNode, t *ast.TypeExpr, what string) ast.ASTNode {
+	pos := ast.PositionOf(value)
+	return ast.CallExprNode{
+		Caller: ast.IdentifierExprNode{Symbol: checkName, Pos: pos},
+		Args: []ast.ASTNode{
+			value,
+			ast.StringLiteralExprNode{Value: a.expand(t, map[string]bool{}).String(), Pos: pos},
+			ast.StringLiteralExprNode{Value: what, Pos: pos},
+		},
+		Pos: pos,
+	}
+}
+
+// expand returns t with the aliases it names replaced by their types. An
+// alias that refers to itself is any from where it does.
+func (a *annotator) expand(t *ast.TypeExpr, expanding map[string]bool) *ast.TypeExpr {
+	out := *t
+	switch t.Kind {
+	case ast.NamedType:
+		alias, ok := a.aliases[t.Name]
+		if !ok {
+			return &out
+		}
+		if expanding[t.Name] {
+			return &ast.TypeExpr{Kind: ast.NamedType, Name: "any", Pos: t.Pos}
+		}
+		expanding[t.Name] = true
+		defer delete(expanding, t.Name)
+		return a.expand(alias, expanding)
+	case ast.ObjectType:
+		out.Fields = make([]ast.TypeField, len(t.Fields))
+		for i, field := range t.Fields {
+			field.Type = a.expand(field.Type, expanding)
+			out.Fields[i] = field
+		}
+	}
+	if t.Elem != nil {
+		out.Elem = a.expand(t.Elem, expanding)
+	}
+	if t.Types != nil {
+		out.Types = make([]*ast.TypeExpr, len(t.Types))
+		for i, member := range t.Types {
+			out.Types[i] = a.expand(member, expanding)
+		}
+	}
+	return &out
+}
+
+// expression reports whether the statement stmt is an expression, whose
+// value a function returns if stmt is its last.
+func expression(stmt ast.ASTNode) bool {
+	switch stmt.(type) {
+	case ast.VariableDeclarationNode, ast.FunctionDeclarationNode, ast.IfStatementNode,
+		ast.WhileStatementNode, ast.ForStatementNode, ast.ReturnStatementNode,
+		ast.BlockStatementNode, ast.TryStatementNode, ast.ThrowStatementNode, ast.TypeAliasNode,
+		ast.ImportDeclarationNode:
+		return false
+	}
+	return true
+}
+
+// builtinCheck is the check native: $check(value, type, what) returns value
+// if it is of the type written in the string type, and otherwise raises a
+// TypeError that tells what value is. $check(value, type, what, true)
+// checks an argument as the function starts, and the traceback of its
+// error ends at the call instead.
+func (it *Interpreter) builtinCheck(args []RuntimeVal, env *Environment) RuntimeVal {
+	if len(args) != 3 && len(args) != 4 {
+		runtimeError("%s expects 3 or 4 arguments, got %d", checkName, len(args))
+	}
+	source, _ := args[1].(StringVal)
+	what, _ := args[2].(StringVal)
+
+	t, ok := it.types[source.Value]
+	if !ok {
+		var err error
+		if t, err = FE.ParseType(source.Value); err != nil {
+			runtimeError("%s: bad type %q: %v", checkName, source.Value, err)
+		}
+		it.types[source.Value] = t
+	}
+
+	if !HasType(args[0], t) {
+		panic(&RuntimeError{
+			Name:    "TypeError",
+			Message: fmt.Sprintf("%s must be %s, got %s", what.Value, t, TypeName(args[0])),
+			atCall:  len(args) == 4 && IsTruthy(args[3]),
+		})
+	}
+	return args[0]
+}
+
+// HasType reports whether value is of type t. Names that are not those of
+// built-in types are taken for any, and functions are not checked further.
+func HasType(value RuntimeVal, t *ast.TypeExpr) bool {
+	switch t.Kind {
+	case ast.NamedType:
+		switch t.Name {
+		case "number":
+			return GetValType(value) == NumberType
+		case "string":
+			return GetValType(value) == StringType
+		case "boolean":
+			return GetValType(value) == BooleanType
+		case "null":
+			return GetValType(value) == NullType
+		}
+		return true
+	case ast.NullableType:
+		return GetValType(value) == NullType || HasType(value, t.Elem)
+	case ast.UnionType:
+		for _, member := range t.Types {
+			if HasType(value, member) {
+				return true
+			}
+		}
+		return false
+	case ast.ArrayType:
+		arr, ok := value.(*ArrayVal)
+		if !ok {
+			return false
+		}
+		for _, elem := range arr.Elements {
+			if !HasType(elem, t.Elem) {
+				return false
+			}
+		}
+		return true
+	case ast.ObjectType:
+		obj, ok := value.(*ObjectVal)
+		if !ok {
+			return false
+		}
+		for _, field := range t.Fields {
+			prop, exists := obj.Properties[field.Key]
+			if field.Optional && (!exists || GetValType(prop) == NullType) {
+				continue
+			}
+			if !exists || !HasType(prop, field.Type) {
+				return false
+			}
+		}
+		return true
+	case ast.FunctionType:
+		kind := GetValType(value)
+		return kind == FunctionType || kind == NativeFunctionType
+	}
+	return false
+}
+
+// TypeName names the type of value as annotations do, or as Map or Set.
+func TypeName(value RuntimeVal) string {
+	switch GetValType(value) {
+	case NullType:
+		return "null"
+	case NumberType:
+		return "number"
+	case StringType:
+		return "string"
+	case BooleanType:
+		return "boolean"
+	case ArrayType:
+		return "array"
+	case ObjectType:
+		return "object"
+	case FunctionType, NativeFunctionType:
+		return "function"
+	case MapType:
+		return "Map"
+	case SetType:
+		return "Set"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,136 @@
+package backend
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AssertionError is the name of the errors the assertion built-ins raise
+// when an assertion does not hold.
+const AssertionError = "AssertionError"
+
+// assertions are the built-ins test blocks check their results with.
+func (it *Interpreter) assertions() map[string]FunctionCall {
+	return map[string]FunctionCall{
+		"assert":       it.builtinAssert,
+		"assertEq":     it.builtinAssertEq,
+		"assertThrows": it.builtinAssertThrows,
+	}
+}
+
+// assert(condition, message?) raises an AssertionError unless condition
+// holds, as an `if` condition would.
+func (it *Interpreter) builtinAssert(args []RuntimeVal, env *Environment) RuntimeVal {
+	if len(args) < 1 || len(args) > 2 {
+		runtimeError("assert expects a condition and an optional message, got %d argument(s)", len(args))
+	}
+	if !it.Condition(args[0], "Assertion") {
+		it.assertionFailed(assertMessage("assert", args, 1, "Assertion failed"), nil)
+	}
+	return Null
+}
+
+// assertEq(actual, expected, message?) raises an AssertionError unless
+// actual == expected, which compares arrays, objects, maps and sets by
+// content. The error object holds both values as `actual` and `expected`.
+func (it *Interpreter) builtinAssertEq(args []RuntimeVal, env *Environment) RuntimeVal {
+	if len(args) < 2 || len(args) > 3 {
+		runtimeError("assertEq expects actual and expected values and an optional message, got %d argument(s)", len(args))
+	}
+	actual, expected := args[0], args[1]
+	if !Equals(actual, expected) {
+		// Values too long for a line are left to the error's properties
+		message := "Expected the values to be equal"
+		want, got := Inspect(expected, DefaultInspectOptions), Inspect(actual, DefaultInspectOptions)
+		if !strings.Contains(want+got, "\n") {
+			message = fmt.Sprintf("Expected %s, got %s", want, got)
+		}
+		it.assertionFailed(assertMessage("assertEq", args, 2, message), map[string]RuntimeVal{
+			"actual":   actual,
+			"expected": expected,
+		})
+	}
+	return Null
+}
+
+// assertThrows(fn, name?) calls fn and returns the error it raises, as
+// `catch` would get it, and raises an AssertionError if it raises none or,
+// given a name, one of another name.
+func (it *Interpreter) builtinAssertThrows(args []RuntimeVal, env *Environment) RuntimeVal {
+	if len(args) < 1 || len(args) > 2 {
+		runtimeError("assertThrows expects a function and an optional error name, got %d argument(s)", len(args))
+	}
+	switch args[0].(type) {
+	case *FunctionVal, *NativeFunctionVal:
+	default:
+		runtimeError("assertThrows expects a function, got: %s", Inspect(args[0], DefaultInspectOptions))
+	}
+	want := ""
+	if len(args) == 2 {
+		name, ok := args[1].(StringVal)
+		if !ok {
+			runtimeError("assertThrows expects the name of an error, got: %s", Inspect(args[1], DefaultInspectOptions))
+		}
+		want = name.Value
+	}
+
+	caught := it.catch(func() { it.callFunction(args[0], nil, env) })
+	switch {
+	case caught == nil && want == "":
+		it.assertionFailed("Expected the function to throw", nil)
+	case caught == nil:
+		it.assertionFailed(fmt.Sprintf("Expected the function to throw a %s", want), nil)
+	case want != "" && caught.Name != want && !(caught.Name == "" && want == "Error"):
+		name := caught.Name
+		if name == "" {
+			name = "Error"
+		}
+		it.assertionFailed(fmt.Sprintf("Expected the function to throw a %s, got %s: %s", want, name, caught.Message), nil)
+	}
+	return caught.CaughtValue()
+}
+
+// catch runs f and returns the error it raises that a `catch` could
+// handle, nil if there is none.
+func (it *Interpreter) catch(f func()) (caught *RuntimeError) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		runtimeErr, ok := r.(*RuntimeError)
+		if !ok || runtimeErr.Fatal {
+			panic(r)
+		}
+		caught = runtimeErr
+	}()
+	f()
+	return nil
+}
+
+// assertMessage returns the message argument of an assertion at index i,
+// or fallback if it has none.
+func assertMessage(name string, args []RuntimeVal, i int, fallback string) string {
+	if len(args) <= i {
+		return fallback
+	}
+	message, ok := args[i].(StringVal)
+	if !ok {
+		runtimeError("%s expects its message to be a string, got: %s", name, Inspect(args[i], DefaultInspectOptions))
+	}
+	return message.Value
+}
+
+// assertionFailed raises an AssertionError with message, thrown as an
+// object with the given properties besides its name and message.
+func (it *Interpreter) assertionFailed(message string, properties map[string]RuntimeVal) {
+	obj := &ObjectVal{Properties: map[string]RuntimeVal{
+		"name":    StringVal{Value: AssertionError},
+		"message": StringVal{Value: message},
+	}}
+	for key, val := range properties {
+		obj.Properties[key] = val
+	}
+	it.allocObject(len(obj.Properties))
+	ThrowValue(obj)
+}
@@ -0,0 +1,215 @@
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MakeGlobalEnvironment returns an empty global environment whose parent
+// holds the built-in functions, bound to a default interpreter.
+func MakeGlobalEnvironment() *Environment {
+	return NewInterpreter(DefaultOptions()).Globals
+}
+
+// makeGlobals returns an empty top-level environment. The built-ins live in
+// its parent, so a program can declare its own `sort` or `env`.
+func (it *Interpreter) makeGlobals() *Environment {
+	env := MakeEnvironment()
+	env.Parent = it.builtins
+	return env
+}
+
+// makeBuiltins declares the built-ins as constants. They are bound to the
+// interpreter so print writes to Options.Stdout and new values count against
+// its Limits.
+func (it *Interpreter) makeBuiltins() *Environment {
+	env := MakeEnvironment()
+
+	builtins := map[string]FunctionCall{
+		"print": it.builtinPrint,
+		"sort":  it.builtinSort,
+		"Map":   it.builtinMap,
+		"Set":   it.builtinSet,
+	}
+	for name, call := range it.assertions() {
+		builtins[name] = call
+	}
+	if it.Options.CheckTypes {
+		builtins[checkName] = it.builtinCheck
+	}
+	for name, call := range builtins {
+		env.DeclareVar(name, true, &NativeFunctionVal{Name: name, Call: call, internal: name == checkName})
+	}
+	for name, obj := range it.makeStdlib() {
+		env.DeclareVar(name, true, obj)
+	}
+
+	return env
+}
+
+// print(...values) writes its arguments to Stdout separated by spaces.
+// Strings are written without quotes, everything else as Inspect shows it.
+func (it *Interpreter) builtinPrint(args []RuntimeVal, env *Environment) RuntimeVal {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		if s, ok := arg.(StringVal); ok {
+			parts[i] = s.Value
+		} else {
+			parts[i] = Inspect(arg, DefaultInspectOptions)
+		}
+	}
+	fmt.Fprintln(it.Options.Stdout, strings.Join(parts, " "))
+	return Null
+}
+
+// sort(arr) returns a new array ordered by Compare. The sort is stable, and
+// arrays with mixed element types are grouped by type.
+func (it *Interpreter) builtinSort(args []RuntimeVal, env *Environment) RuntimeVal {
+	if len(args) != 1 {
+		runtimeError("sort expects 1 argument, got %d", len(args))
+	}
+	arr, ok := args[0].(*ArrayVal)
+	if !ok {
+		runtimeError("sort expects an array, got: %+v", args[0])
+	}
+
+	it.allocArray(len(arr.Elements))
+	sorted := make([]RuntimeVal, len(arr.Elements))
+	copy(sorted, arr.Elements)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return Compare(sorted[i], sorted[j]) < 0
+	})
+
+	return &ArrayVal{Elements: sorted}
+}
+
+// Map() returns an empty map. Map(arr) fills it from an array of [key, value] pairs.
+func (it *Interpreter) builtinMap(args []RuntimeVal, env *Environment) RuntimeVal {
+	m := &MapVal{Entries: NewValueMap()}
+	if len(args) == 0 {
+		return m
+	}
+
+	pairs, ok := args[0].(*ArrayVal)
+	if !ok {
+		runtimeError("Map expects an array of [key, value] pairs, got: %+v", args[0])
+	}
+	for _, elem := range pairs.Elements {
+		pair, ok := elem.(*ArrayVal)
+		if !ok || len(pair.Elements) != 2 {
+			runtimeError("Map expects an array of [key, value] pairs, got: %+v", elem)
+		}
+		m.Entries.Set(pair.Elements[0], pair.Elements[1])
+	}
+	it.allocEntries("Map", m.Entries.Len(), m.Entries.Len())
+	return m
+}
+
+// Set() returns an empty set. Set(arr) fills it with the elements of arr.
+func (it *Interpreter) builtinSet(args []RuntimeVal, env *Environment) RuntimeVal {
+	s := &SetVal{Entries: NewValueMap()}
+	if len(args) == 0 {
+		return s
+	}
+
+	elements, ok := args[0].(*ArrayVal)
+	if !ok {
+		runtimeError("Set expects an array, got: %+v", args[0])
+	}
+	for _, elem := range elements.Elements {
+		s.Entries.Set(elem, Null)
+	}
+	it.allocEntries("Set", s.Entries.Len(), s.Entries.Len())
+	return s
+}
+
+// mapMember resolves `m.<name>` on a map to its size or a method bound to m.
+func (it *Interpreter) mapMember(m *MapVal, name string) RuntimeVal {
+	switch name {
+	case "size":
+		return NumberVal{Value: float64(m.Entries.Len())}
+	case "get":
+		return method(name, 1, func(args []RuntimeVal) RuntimeVal {
+			val, _ := m.Entries.Get(args[0])
+			return val
+		})
+	case "set":
+		return method(name, 2, func(args []RuntimeVal) RuntimeVal {
+			if !m.Entries.Has(args[0]) {
+				it.allocEntries("Map", m.Entries.Len()+1, 1)
+			}
+			m.Entries.Set(args[0], args[1])
+			return m
+		})
+	case "has":
+		return method(name, 1, func(args []RuntimeVal) RuntimeVal {
+			return BoolValue{Value: m.Entries.Has(args[0])}
+		})
+	case "delete":
+		return method(name, 1, func(args []RuntimeVal) RuntimeVal {
+			return BoolValue{Value: m.Entries.Delete(args[0])}
+		})
+	case "keys":
+		return method(name, 0, func(args []RuntimeVal) RuntimeVal {
+			it.allocArray(m.Entries.Len())
+			keys := make([]RuntimeVal, 0, m.Entries.Len())
+			for _, entry := range m.Entries.Entries() {
+				keys = append(keys, entry.Key)
+			}
+			return &ArrayVal{Elements: keys}
+		})
+	}
+
+	runtimeError("Map has no property '%s'", name)
+	return Null
+}
+
+// setMember resolves `s.<name>` on a set to its size or a method bound to s.
+func (it *Interpreter) setMember(s *SetVal, name string) RuntimeVal {
+	switch name {
+	case "size":
+		return NumberVal{Value: float64(s.Entries.Len())}
+	case "add":
+		return method(name, 1, func(args []RuntimeVal) RuntimeVal {
+			if !s.Entries.Has(args[0]) {
+				it.allocEntries("Set", s.Entries.Len()+1, 1)
+			}
+			s.Entries.Set(args[0], Null)
+			return s
+		})
+	case "has":
+		return method(name, 1, func(args []RuntimeVal) RuntimeVal {
+			return BoolValue{Value: s.Entries.Has(args[0])}
+		})
+	case "delete":
+		return method(name, 1, func(args []RuntimeVal) RuntimeVal {
+			return BoolValue{Value: s.Entries.Delete(args[0])}
+		})
+	case "values":
+		return method(name, 0, func(args []RuntimeVal) RuntimeVal {
+			it.allocArray(s.Entries.Len())
+			values := make([]RuntimeVal, 0, s.Entries.Len())
+			for _, entry := range s.Entries.Entries() {
+				values = append(values, entry.Key)
+			}
+			return &ArrayVal{Elements: values}
+		})
+	}
+
+	runtimeError("Set has no property '%s'", name)
+	return Null
+}
+
+// method wraps a bound method body in a native function that checks its arity.
+func method(name string, arity int, body func(args []RuntimeVal) RuntimeVal) *NativeFunctionVal {
+	return &NativeFunctionVal{
+		Name: name,
+		Call: func(args []RuntimeVal, env *Environment) RuntimeVal {
+			if len(args) != arity {
+				runtimeError("%s expects %d argument(s), got %d", name, arity, len(args))
+			}
+			return body(args)
+		},
+	}
+}
@@ -0,0 +1,102 @@
+package backend
+
+import "sort"
+
+// MapEntry is a single key/value pair stored in a ValueMap.
+type MapEntry struct {
+	Key   RuntimeVal
+	Value RuntimeVal
+}
+
+// ValueMap is an insertion-ordered hash map keyed by runtime values. Keys are
+// bucketed by Hash and matched with SameValueZero, so two structurally equal
+// arrays or objects address the same entry, and so do two NaNs.
+type ValueMap struct {
+	buckets map[uint64][]*MapEntry
+	order   []*MapEntry
+}
+
+func NewValueMap() *ValueMap {
+	return &ValueMap{buckets: make(map[uint64][]*MapEntry)}
+}
+
+func (m *ValueMap) find(key RuntimeVal) (*MapEntry, uint64) {
+	hash := Hash(key)
+	for _, entry := range m.buckets[hash] {
+		if SameValueZero(entry.Key, key) {
+			return entry, hash
+		}
+	}
+	return nil, hash
+}
+
+func (m *ValueMap) Get(key RuntimeVal) (RuntimeVal, bool) {
+	if entry, _ := m.find(key); entry != nil {
+		return entry.Value, true
+	}
+	return Null, false
+}
+
+func (m *ValueMap) Has(key RuntimeVal) bool {
+	entry, _ := m.find(key)
+	return entry != nil
+}
+
+func (m *ValueMap) Set(key, value RuntimeVal) {
+	entry, hash := m.find(key)
+	if entry != nil {
+		entry.Value = value
+		return
+	}
+	entry = &MapEntry{Key: key, Value: value}
+	m.buckets[hash] = append(m.buckets[hash], entry)
+	m.order = append(m.order, entry)
+}
+
+// Delete removes key from the map and reports whether it was present.
+func (m *ValueMap) Delete(key RuntimeVal) bool {
+	entry, hash := m.find(key)
+	if entry == nil {
+		return false
+	}
+
+	bucket := m.buckets[hash]
+	for i, candidate := range bucket {
+		if candidate == entry {
+			m.buckets[hash] = append(bucket[:i], bucket[i+1:]...)
+			break
+		}
+	}
+	if len(m.buckets[hash]) == 0 {
+		delete(m.buckets, hash)
+	}
+
+	for i, candidate := range m.order {
+		if candidate == entry {
+			m.order = append(m.order[:i], m.order[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+func (m *ValueMap) Len() int {
+	return len(m.order)
+}
+
+// Entries returns the entries in insertion order.
+func (m *ValueMap) Entries() []*MapEntry {
+	return m.order
+}
+
+// SortedKeys returns the keys ordered by Compare.
+func (m *ValueMap) SortedKeys() []RuntimeVal {
+	keys := make([]RuntimeVal, len(m.order))
+	for i, entry := range m.order {
+		keys[i] = entry.Key
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return Compare(keys[i], keys[j]) < 0
+	})
+	return keys
+}
@@ -0,0 +1,119 @@
+package backend
+
+import (
+	"pop/frontend/types/ast"
+	"pop/resolver"
+)
+
+// Engine runs programs for an Interpreter in place of the tree walker, such
+// as the bytecode VM in package vm. Set it in Options.Engine.
+//
+// Like the tree walker, an engine raises runtime errors by panicking with a
+// *RuntimeError. It runs in the interpreter's globals and goes through the
+// hooks below, so limits, tracebacks and error messages are the same
+// whichever engine runs a program.
+type Engine interface {
+	// Run runs a parsed program from file and returns the value of its last
+	// statement. The error is for programs the engine cannot run at all.
+	Run(it *Interpreter, file string, program ast.Program) (RuntimeVal, error)
+}
+
+// SourceRunner is implemented by engines that run source text without the
+// interpreter parsing it first, for example from a cache of compiled
+// programs. RunString and RunFile use it unless the AST is to be dumped.
+type SourceRunner interface {
+	// RunSource parses, optimizes with Interpreter.Optimize, and runs
+	// source from file. Syntax errors are returned rather than raised.
+	RunSource(it *Interpreter, file, source string) (RuntimeVal, error)
+}
+
+// CallDepthCeiling is implemented by engines whose calls do not nest Go
+// stack like the tree walker's. Limits.MaxCallDepth is clamped to
+// MaxCallDepth for programs they run instead of to MaxTreeWalkerCallDepth.
+type CallDepthCeiling interface {
+	MaxCallDepth() int
+}
+
+// CompiledFunction is the code of a FunctionVal an engine created.
+type CompiledFunction interface {
+	// Call runs the function with the caller's frame and call depth
+	// already entered, see Invoke.
+	Call(args []RuntimeVal) RuntimeVal
+}
+
+// Resolve runs the resolver over program with the interpreter's globals as
+// the variables that already exist. The error is a *resolver.Error.
+func (it *Interpreter) Resolve(program ast.Program) (ast.Program, error) {
+	return resolver.Resolve(program, resolver.Options{
+		Globals: func(name string) bool {
+			_, ok := it.Globals.LookupVar(name)
+			return ok
+		},
+	})
+}
+
+// Optimize optimizes program with Optimizer, if set, after resolving it,
+// so a program that uses a variable wrongly fails even if the passes
+// remove the code that does. The passes change scopes, so the program
+// returned has to be resolved again to run.
+func (it *Interpreter) Optimize(program ast.Program) (ast.Program, error) {
+	optimizer := it.Optimizer()
+	if optimizer == nil {
+		return program, nil
+	}
+	if _, err := it.Resolve(program); err != nil {
+		return program, err
+	}
+	return optimizer.Optimize(program), nil
+}
+
+// Step counts one unit of work against Limits.MaxSteps and notices when the
+// run's context is cancelled.
+func (it *Interpreter) Step() {
+	it.step()
+}
+
+// AllocArray charges a new array of n elements against the limits.
+func (it *Interpreter) AllocArray(n int) {
+	it.allocArray(n)
+}
+
+// AllocObject charges a new object of n properties against the limits.
+func (it *Interpreter) AllocObject(n int) {
+	it.allocObject(n)
+}
+
+// AllocString charges a new string of n bytes against the limits.
+func (it *Interpreter) AllocString(n int) {
+	it.allocString(n)
+}
+
+// Invoke calls any callable value with evaluated arguments: a native, a
+// tree-walked function or a compiled one. Anything else raises the error a
+// Popcorn call of it would. Invoke pushes the callee's frame and, for
+// Popcorn functions, counts the call depth.
+func (it *Interpreter) Invoke(fn RuntimeVal, args []RuntimeVal) RuntimeVal {
+	return it.callFunction(fn, args, it.Globals)
+}
+
+// FrameCount is the number of frames on the call stack.
+func (it *Interpreter) FrameCount() int {
+	return len(it.frames)
+}
+
+// FrameAt returns the i-th frame of the call stack, oldest first, so an
+// engine can record where its frames are before a traceback is taken.
+func (it *Interpreter) FrameAt(i int) *Frame {
+	return &it.frames[i]
+}
+
+// FunctionFrame is the frame a call to fn starts with.
+func (it *Interpreter) FunctionFrame(fn RuntimeVal, args []RuntimeVal) Frame {
+	return it.callFrame(fn, args)
+}
+
+// TraceError attaches the current call stack to err unless it already has
+// one. Call it before popping the frames the error unwinds.
+func (it *Interpreter) TraceError(err *RuntimeError) {
+	it.traceError(err)
+}
@@ -1,13 +1,19 @@
 package backend
 
-import (
-	"log"
-)
+import "pop/frontend/types/ast"
 
+// Environment is a scope of variables. Globals, and the scopes of programs
+// that were not resolved, keep their variables by name in Variables. The
+// scopes of resolved code keep them in Slots, laid out by Scope, and are
+// read through the Address the resolver gave each reference.
 type Environment struct {
 	Parent    *Environment
 	Variables map[string]RuntimeVal
 	Constants map[string]struct{}
+
+	// Slots holds the variables Scope lays out, nil until declared
+	Slots []RuntimeVal
+	Scope *ast.Scope
 }
 
 func (e *Environment) resolveEnv(varName string) *Environment {
@@ -16,12 +22,23 @@ func (e *Environment) resolveEnv(varName string) *Environment {
 	}
 
 	if e.Parent == nil {
-		log.Fatalf("Cannot resolve variable '%s' !", varName)
+		runtimeError("Cannot resolve variable '%s' !", varName)
 	}
 
 	return e.Parent.resolveEnv(varName)
 }
 
+// LookupVar is GetVar without the runtime error: ok is false when varName
+// is not declared in this scope or any parent.
+func (e *Environment) LookupVar(varName string) (val RuntimeVal, ok bool) {
+	for env := e; env != nil; env = env.Parent {
+		if val, ok := env.Variables[varName]; ok {
+			return val, true
+		}
+	}
+	return Null, false
+}
+
 func (e *Environment) GetVar(varName string) RuntimeVal {
 	env := e.resolveEnv(varName)
 
@@ -36,11 +53,11 @@ func (e *Environment) AssignVar(varName string, value RuntimeVal) RuntimeVal {
 	env := e.resolveEnv(varName)
 
 	if _, ok := env.Variables[varName]; !ok {
-		log.Fatalf("No variable with the '%s' identifier found.", varName)
+		runtimeError("No variable with the '%s' identifier found.", varName)
 	}
 
 	if _, ok := env.Constants[varName]; ok {
-		log.Fatalf("Cannot reassign constant variable '%s'", varName)
+		runtimeError("Cannot reassign constant variable '%s'", varName)
 	}
 
 	env.Variables[varName] = value
@@ -49,8 +66,12 @@ func (e *Environment) AssignVar(varName string, value RuntimeVal) RuntimeVal {
 }
 
 func (e *Environment) DeclareVar(varName string, isConstant bool, value RuntimeVal) RuntimeVal {
+	if e.Variables == nil {
+		e.Variables = map[string]RuntimeVal{}
+		e.Constants = map[string]struct{}{}
+	}
 	if _, ok := e.Variables[varName]; ok {
-		log.Fatalf("Cannot declare variable '%s' as its already present in the current scope.", varName)
+		runtimeError("Cannot declare variable '%s' as its already present in the current scope.", varName)
 	}
 
 	var val RuntimeVal
@@ -62,7 +83,7 @@ func (e *Environment) DeclareVar(varName string, isConstant bool, value RuntimeV
 
 	if isConstant {
 		if val == Null {
-			log.Fatalf("Cannot declare a constant variable '%s' without a value.", varName)
+			runtimeError("Cannot declare a constant variable '%s' without a value.", varName)
 		}
 
 		e.Constants[varName] = struct{}{}
@@ -81,3 +102,76 @@ func MakeEnvironment() *Environment {
 
 	return env
 }
+
+// newScope starts a scope inside parent, with the slots of scope if the
+// code running in it was resolved.
+func newScope(parent *Environment, scope *ast.Scope) *Environment {
+	if scope == nil {
+		env := MakeEnvironment()
+		env.Parent = parent
+		return env
+	}
+	return &Environment{Parent: parent, Slots: make([]RuntimeVal, len(scope.Names)), Scope: scope}
+}
+
+// at returns the scope addr.Depth scopes out from e.
+func (e *Environment) at(addr *ast.Address) *Environment {
+	env := e
+	for i := 0; i < addr.Depth; i++ {
+		env = env.Parent
+	}
+	return env
+}
+
+// getSlot reads the variable name at addr.
+func (e *Environment) getSlot(addr *ast.Address, name string) RuntimeVal {
+	val := e.at(addr).Slots[addr.Slot]
+	if val == nil {
+		runtimeError("Cannot resolve variable '%s' !", name)
+	}
+	return val
+}
+
+// assignSlot is AssignVar for the variable name at addr.
+func (e *Environment) assignSlot(addr *ast.Address, name string, value RuntimeVal) RuntimeVal {
+	env := e.at(addr)
+	if env.Slots[addr.Slot] == nil {
+		runtimeError("Cannot resolve variable '%s' !", name)
+	}
+	if env.Scope.Constants[addr.Slot] {
+		runtimeError("Cannot reassign constant variable '%s'", name)
+	}
+	env.Slots[addr.Slot] = value
+	return value
+}
+
+// declareSlot is DeclareVar for the variable name at addr, which is always
+// in e itself.
+func (e *Environment) declareSlot(addr *ast.Address, name string, isConstant bool, value RuntimeVal) RuntimeVal {
+	if e.Slots[addr.Slot] != nil {
+		runtimeError("Cannot declare variable '%s' as its already present in the current scope.", name)
+	}
+	if value == nil {
+		value = Null
+	}
+	if isConstant && value == Null {
+		runtimeError("Cannot declare a constant variable '%s' without a value.", name)
+	}
+	e.Slots[addr.Slot] = value
+	return value
+}
+
+// paramSlot returns the slot of the i-th parameter, name, in the scope of
+// a call. Parameters come first, but a repeated one has only the slot of
+// its first use.
+func paramSlot(scope *ast.Scope, i int, name string) int {
+	if i < len(scope.Names) && scope.Names[i] == name {
+		return i
+	}
+	for i, n := range scope.Names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
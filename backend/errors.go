@@ -0,0 +1,89 @@
+package backend
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// RuntimeError is raised while evaluating a program. The Interpreter methods
+// recover it and return it as an error, so a failing script never takes the
+// host process down with it.
+type RuntimeError struct {
+	// Name classifies the error for scripts that catch it, such as
+	// "StackOverflowError". Empty means a plain "Error".
+	Name    string
+	Message string
+	// Err is the Go error that caused this one, if it was raised by Throw
+	Err error
+	// Value is what a Popcorn `throw` statement threw, nil otherwise
+	Value RuntimeVal
+	// Fatal errors end the run: `try`/`catch` cannot intercept them. Step
+	// and memory budgets and cancellation are fatal so a script cannot
+	// catch its way past them.
+	Fatal bool
+	// Trace is the call stack when the error was raised, oldest frame
+	// first. It is nil for errors raised outside of a run.
+	Trace []Frame
+	// atCall errors are raised as a call starts but are the caller's
+	// fault, like an argument of the wrong type, so Trace leaves out the
+	// frame of the function called
+	atCall bool
+}
+
+func (e *RuntimeError) Error() string {
+	return e.Message
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+// Throw aborts evaluation with err. Native functions use it to report
+// failures; errors.Is and errors.As still see err through the RuntimeError
+// the host gets back.
+func Throw(err error) {
+	panic(&RuntimeError{Message: err.Error(), Err: err})
+}
+
+// CaughtValue is what a `catch` block binds the error to: the thrown value,
+// or an object with the error's name and message.
+func (e *RuntimeError) CaughtValue() RuntimeVal {
+	if e.Value != nil {
+		return e.Value
+	}
+
+	name := e.Name
+	if name == "" {
+		name = "Error"
+	}
+	return &ObjectVal{Properties: map[string]RuntimeVal{
+		"name":    StringVal{Value: name},
+		"message": StringVal{Value: e.Message},
+	}}
+}
+
+// runtimeError aborts evaluation with a RuntimeError.
+func runtimeError(format string, args ...any) {
+	panic(&RuntimeError{Message: fmt.Sprintf(format, args...)})
+}
+
+// namedError aborts evaluation with a RuntimeError of the given name.
+func namedError(name string, fatal bool, format string, args ...any) {
+	panic(&RuntimeError{Name: name, Message: fmt.Sprintf(format, args...), Fatal: fatal})
+}
+
+// recoverRuntimeError stores a RuntimeError panic into err, and a Go
+// runtime panic such as a nil dereference as a fatal RuntimeError, so a bug
+// in a native fails the run instead of the host. It re-panics anything else.
+func recoverRuntimeError(err *error) {
+	if r := recover(); r != nil {
+		switch r := r.(type) {
+		case *RuntimeError:
+			*err = r
+		case runtime.Error:
+			*err = &RuntimeError{Message: r.Error(), Err: r, Fatal: true}
+		default:
+			panic(r)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package backend
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// InspectOptions controls how Inspect renders a value.
+type InspectOptions struct {
+	// Indent is repeated once per nesting level in multi-line output
+	Indent string
+	// MaxDepth is how many levels of containers are expanded, deeper ones
+	// print as [Array], [Object], ... A negative value means no limit.
+	MaxDepth int
+	// MaxItems is how many elements of a container are printed before
+	// the rest are summarised. A negative value means no limit.
+	MaxItems int
+	// Width is the line width a container may take before it is broken
+	// over several lines
+	Width int
+	// Color wraps literals in ANSI color codes
+	Color bool
+}
+
+// DefaultInspectOptions is what String() uses for every runtime value.
+var DefaultInspectOptions = InspectOptions{
+	Indent:   "  ",
+	MaxDepth: 6,
+	MaxItems: 100,
+	Width:    72,
+}
+
+// Inspect renders a runtime value using Popcorn literal syntax, e.g.
+// `[1, 2, "x"]`, `{ name: "Al" }` or `<fn add(a, b)>`. Cyclic references
+// print as [Circular].
+func Inspect(val RuntimeVal, opts InspectOptions) string {
+	p := printer{opts: opts, inProgress: map[RuntimeVal]bool{}}
+	return p.print(val, 0)
+}
+
+func (v NullValue) String() string          { return Inspect(v, DefaultInspectOptions) }
+func (v BoolValue) String() string          { return Inspect(v, DefaultInspectOptions) }
+func (v NumberVal) String() string          { return Inspect(v, DefaultInspectOptions) }
+func (v StringVal) String() string          { return Inspect(v, DefaultInspectOptions) }
+func (v ReturnVal) String() string          { return Inspect(v, DefaultInspectOptions) }
+func (v *ArrayVal) String() string          { return Inspect(v, DefaultInspectOptions) }
+func (v *ObjectVal) String() string         { return Inspect(v, DefaultInspectOptions) }
+func (v *MapVal) String() string            { return Inspect(v, DefaultInspectOptions) }
+func (v *SetVal) String() string            { return Inspect(v, DefaultInspectOptions) }
+func (v *FunctionVal) String() string       { return Inspect(v, DefaultInspectOptions) }
+func (v *NativeFunctionVal) String() string { return Inspect(v, DefaultInspectOptions) }
+
+type printer struct {
+	opts       InspectOptions
+	inProgress map[RuntimeVal]bool
+}
+
+func (p *printer) print(val RuntimeVal, depth int) string {
+	switch v := val.(type) {
+	case nil, NullValue:
+		return p.paint("null", colorKeyword)
+	case BoolValue:
+		return p.paint(strconv.FormatBool(v.Value), colorKeyword)
+	case NumberVal:
+		return p.paint(FormatNumber(v.Value), colorNumber)
+	case StringVal:
+		return p.paint(strconv.Quote(v.Value), colorString)
+	case ReturnVal:
+		return p.print(v.Value, depth)
+	case *FunctionVal:
+		return p.paint(fmt.Sprintf("<fn %s(%s)>", v.Name, strings.Join(v.Params, ", ")), colorOperator)
+	case *NativeFunctionVal:
+		return p.paint(fmt.Sprintf("<native fn %s>", v.Name), colorOperator)
+	}
+
+	if p.inProgress[val] {
+		return p.paint("[Circular]", colorOperator)
+	}
+	if p.opts.MaxDepth >= 0 && depth > p.opts.MaxDepth {
+		return p.paint("["+containerName(val)+"]", colorOperator)
+	}
+	p.inProgress[val] = true
+	defer delete(p.inProgress, val)
+
+	switch v := val.(type) {
+	case *ArrayVal:
+		items := p.printAll(len(v.Elements), func(i int) string {
+			return p.print(v.Elements[i], depth+1)
+		})
+		return p.wrap("[", items, "]", false)
+	case *ObjectVal:
+		keys := sortedKeys(v.Properties)
+		items := p.printAll(len(keys), func(i int) string {
+			return formatKey(keys[i]) + ": " + p.print(v.Properties[keys[i]], depth+1)
+		})
+		return p.wrap("{", items, "}", true)
+	case *MapVal:
+		entries := v.Entries.Entries()
+		items := p.printAll(len(entries), func(i int) string {
+			return p.print(entries[i].Key, depth+1) + " => " + p.print(entries[i].Value, depth+1)
+		})
+		return p.wrap("Map {", items, "}", true)
+	case *SetVal:
+		entries := v.Entries.Entries()
+		items := p.printAll(len(entries), func(i int) string {
+			return p.print(entries[i].Key, depth+1)
+		})
+		return p.wrap("Set {", items, "}", true)
+	}
+
+	return fmt.Sprintf("%+v", val)
+}
+
+// printAll renders up to MaxItems elements and summarises the rest.
+func (p *printer) printAll(count int, item func(i int) string) []string {
+	limit := count
+	if p.opts.MaxItems >= 0 && count > p.opts.MaxItems {
+		limit = p.opts.MaxItems
+	}
+
+	items := make([]string, 0, limit+1)
+	for i := 0; i < limit; i++ {
+		items = append(items, item(i))
+	}
+	if limit < count {
+		items = append(items, fmt.Sprintf("... %d more items", count-limit))
+	}
+	return items
+}
+
+// wrap joins items on a single line when they fit within Width, otherwise
+// puts each item on its own indented line. Braces get inner padding so that
+// objects read as `{ a: 1 }` while arrays read as `[1]`.
+func (p *printer) wrap(open string, items []string, close string, padded bool) string {
+	if len(items) == 0 {
+		return open + close
+	}
+
+	single := strings.Join(items, ", ")
+	if padded {
+		single = " " + single + " "
+	}
+	if !strings.Contains(single, "\n") && visibleLen(open+single+close) <= p.opts.Width {
+		return open + single + close
+	}
+
+	var sb strings.Builder
+	sb.WriteString(open)
+	for i, item := range items {
+		sb.WriteString("\n")
+		sb.WriteString(p.opts.Indent)
+		sb.WriteString(strings.ReplaceAll(item, "\n", "\n"+p.opts.Indent))
+		if i < len(items)-1 {
+			sb.WriteString(",")
+		}
+	}
+	sb.WriteString("\n")
+	sb.WriteString(close)
+	return sb.String()
+}
+
+func (p *printer) paint(text, color string) string {
+	if !p.opts.Color {
+		return text
+	}
+	return color + text + colorReset
+}
+
+// FormatNumber renders a number the way it would be written in source:
+// integers without a decimal point and no exponent for everyday magnitudes.
+func FormatNumber(n float64) string {
+	switch {
+	case math.IsNaN(n):
+		return "NaN"
+	case math.IsInf(n, 1):
+		return "Infinity"
+	case math.IsInf(n, -1):
+		return "-Infinity"
+	case math.Abs(n) < 1e21:
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	default:
+		return strconv.FormatFloat(n, 'g', -1, 64)
+	}
+}
+
+// formatKey quotes object keys that are not plain identifiers.
+func formatKey(key string) string {
+	for i, ch := range key {
+		isIdent := ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (i > 0 && ch >= '0' && ch <= '9')
+		if !isIdent {
+			return strconv.Quote(key)
+		}
+	}
+	if key == "" {
+		return `""`
+	}
+	return key
+}
+
+func containerName(val RuntimeVal) string {
+	switch val.(type) {
+	case *ArrayVal:
+		return "Array"
+	case *ObjectVal:
+		return "Object"
+	case *MapVal:
+		return "Map"
+	case *SetVal:
+		return "Set"
+	}
+	return "Value"
+}
+
+// visibleLen is the printed width of s, ignoring ANSI escape sequences.
+func visibleLen(s string) int {
+	length := 0
+	inEscape := false
+	for _, ch := range s {
+		switch {
+		case inEscape:
+			if ch == 'm' {
+				inEscape = false
+			}
+		case ch == '\033':
+			inEscape = true
+		default:
+			length++
+		}
+	}
+	return length
+}
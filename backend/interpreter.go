@@ -2,57 +2,95 @@ package backend
 
 import (
 	"fmt"
-	"log"
 	"pop/frontend/types/ast"
 )
 
-func evalAssignment(node ast.AssignmentExprNode, env *Environment) RuntimeVal {
+func (it *Interpreter) evalAssignment(node ast.AssignmentExprNode, env *Environment) RuntimeVal {
 	// Only allow assignment to identifiers for now
 	ident, ok := node.Assignee.(ast.IdentifierExprNode)
 	if !ok {
-		log.Fatalf("Invalid LHS in assignment: %+v", node.Assignee)
+		runtimeError("Invalid LHS in assignment: %+v", node.Assignee)
+	}
+	val := it.evaluate(node.Value, env)
+	if ident.Addr != nil {
+		return env.assignSlot(ident.Addr, ident.Symbol, val)
 	}
-	val := Evaluate(node.Value, env)
 	return env.AssignVar(ident.Symbol, val)
 }
 
-func evalObjectLiteral(node ast.ObjectLiteralExprNode, env *Environment) RuntimeVal {
-	obj := ObjectVal{Properties: make(map[string]RuntimeVal)}
+func (it *Interpreter) evalObjectLiteral(node ast.ObjectLiteralExprNode, env *Environment) RuntimeVal {
+	it.allocObject(len(node.Properties))
+	obj := &ObjectVal{Properties: make(map[string]RuntimeVal)}
 	for _, prop := range node.Properties {
 		var val RuntimeVal
-		if prop.Value == nil {
+		if prop.Value == nil && prop.Addr != nil {
+			val = env.getSlot(prop.Addr, prop.Key)
+		} else if prop.Value == nil {
 			val = env.GetVar(prop.Key)
 		} else {
-			val = Evaluate(prop.Value, env)
+			val = it.evaluate(prop.Value, env)
 		}
 		obj.Properties[prop.Key] = val
 	}
 	return obj
 }
 
-func evalCallExpression(node ast.CallExprNode, env *Environment) RuntimeVal {
-	callee := Evaluate(node.Caller, env)
+func (it *Interpreter) evalCallExpression(node ast.CallExprNode, env *Environment) RuntimeVal {
+	callee := it.evaluate(node.Caller, env)
 	args := make([]RuntimeVal, len(node.Args))
 	for i, arg := range node.Args {
-		args[i] = Evaluate(arg, env)
+		args[i] = it.evaluate(arg, env)
+	}
+
+	// The caller's frame points at the call, not at its last argument
+	it.at(node.Pos)
+	return it.callFunction(callee, args, env)
+}
+
+// callFunction invokes a user-defined or native function with already
+// evaluated arguments. It is shared by call expressions and by natives that
+// call back into Popcorn code.
+func (it *Interpreter) callFunction(callee RuntimeVal, args []RuntimeVal, env *Environment) RuntimeVal {
+	if traced(callee) {
+		it.PushFrame(it.callFrame(callee, args))
+		defer func() {
+			if r := recover(); r != nil {
+				it.traceError(r)
+				it.PopFrame()
+				panic(r)
+			}
+			it.PopFrame()
+		}()
 	}
 
 	switch fn := callee.(type) {
-	case NativeFunctionVal:
-		return fn.Call(args, env)
-	case FunctionVal:
-		scope := MakeEnvironment()
-		scope.Parent = fn.DeclarationEnv
+	case *NativeFunctionVal:
+		result := fn.Call(args, env)
+		it.checkValue(result)
+		return result
+	case *FunctionVal:
+		it.EnterCall(fn.Name)
+		defer it.ExitCall()
+
+		if fn.Compiled != nil {
+			return fn.Compiled.Call(args)
+		}
+
+		scope := newScope(fn.DeclarationEnv, fn.Scope)
 		for i, param := range fn.Params {
+			var arg RuntimeVal = Null
 			if i < len(args) {
-				scope.DeclareVar(param, false, args[i])
+				arg = args[i]
+			}
+			if fn.Scope != nil {
+				scope.declareSlot(&ast.Address{Slot: paramSlot(fn.Scope, i, param)}, param, false, arg)
 			} else {
-				scope.DeclareVar(param, false, Null)
+				scope.DeclareVar(param, false, arg)
 			}
 		}
 		var result RuntimeVal = Null
 		for _, stmt := range fn.Body {
-			result = Evaluate(stmt, scope)
+			result = it.evaluate(stmt, scope)
 			// Check if a return statement was executed
 			if retVal, isReturn := result.(ReturnVal); isReturn {
 				return retVal.Value
@@ -60,104 +98,145 @@ func evalCallExpression(node ast.CallExprNode, env *Environment) RuntimeVal {
 		}
 		return result
 	default:
-		log.Fatalf("Cannot call value that is not a function: %+v", callee)
+		runtimeError("Cannot call value that is not a function: %+v", callee)
 	}
 	return Null
 }
 
-func evalVarDeclaration(node ast.VariableDeclarationNode, env *Environment) RuntimeVal {
+// traced reports whether a call to callee has a frame in tracebacks. Calls
+// of Popcorn functions and natives do, except for internal natives.
+func traced(callee RuntimeVal) bool {
+	switch fn := callee.(type) {
+	case *NativeFunctionVal:
+		return !fn.internal
+	case *FunctionVal:
+		return true
+	}
+	return false
+}
+
+// callFrame describes a call to fn for tracebacks.
+func (it *Interpreter) callFrame(fn RuntimeVal, args []RuntimeVal) Frame {
+	frame := Frame{Name: frameName(fn), Args: args}
+	switch fn := fn.(type) {
+	case *NativeFunctionVal:
+		frame.Native = true
+	case *FunctionVal:
+		frame.File = fn.File
+		frame.Params = fn.Params
+		frame.Line, frame.Column = fn.Pos.Line, fn.Pos.Column
+	}
+	return frame
+}
+
+func (it *Interpreter) evalVarDeclaration(node ast.VariableDeclarationNode, env *Environment) RuntimeVal {
 	var val RuntimeVal
 
 	if node.Value != nil {
-		val = Evaluate(node.Value, env)
+		val = it.evaluate(node.Value, env)
 	} else {
 		val = Null
 	}
 
+	if node.Addr != nil {
+		return env.declareSlot(node.Addr, node.Identifier, node.Constant, val)
+	}
 	env.DeclareVar(node.Identifier, node.Constant, val)
 	return val
 }
 
-func evalFnDeclaration(node ast.FunctionDeclarationNode, env *Environment) RuntimeVal {
-	fn := FunctionVal{
+func (it *Interpreter) evalFnDeclaration(node ast.FunctionDeclarationNode, env *Environment) RuntimeVal {
+	fn := &FunctionVal{
 		Name:           node.Name,
 		Params:         node.Params,
 		DeclarationEnv: env,
 		Body:           node.Body,
+		Scope:          node.Scope,
+		File:           it.file(),
+		Pos:            node.Pos,
+	}
+	if node.Addr != nil {
+		env.declareSlot(node.Addr, node.Name, true, fn)
+		return fn
 	}
 	env.DeclareVar(node.Name, true, fn)
 	return fn
 }
 
-func evalProgram(node ast.Program, env *Environment) RuntimeVal {
+func (it *Interpreter) evalProgram(node ast.Program, env *Environment) RuntimeVal {
 	var final RuntimeVal = Null
 
 	for _, stmt := range node.Body {
-		final = Evaluate(stmt, env)
+		final = it.evaluate(stmt, env)
 	}
 
 	return final
 }
 
-func evalNumber(node ast.NumericLiteralExprNode, env *Environment) RuntimeVal {
+func (it *Interpreter) evalNumber(node ast.NumericLiteralExprNode, env *Environment) RuntimeVal {
 	return NumberVal{Value: node.Value}
 }
 
-func evalString(node ast.StringLiteralExprNode, env *Environment) RuntimeVal {
+func (it *Interpreter) evalString(node ast.StringLiteralExprNode, env *Environment) RuntimeVal {
+	it.allocString(len(node.Value))
 	return StringVal{
 		Value: node.Value,
 	}
 }
 
-func evalBool(node ast.BooleanLiteralExprNode, env *Environment) RuntimeVal {
+func (it *Interpreter) evalBool(node ast.BooleanLiteralExprNode, env *Environment) RuntimeVal {
 	return BoolValue{Value: node.Value}
 }
 
-func evalLogicalExpr(node ast.LogicalExprNode, env *Environment) RuntimeVal {
-	left := Evaluate(node.Left, env)
-	leftBool, isLeftBool := left.(BoolValue)
+// evalLogicalExpr short-circuits and yields the operand that decided the
+// result, so `name || "default"` evaluates to either name or "default"
+// rather than a boolean. With Options.StrictBooleans both operands must be
+// booleans, which makes the result one too.
+func (it *Interpreter) evalLogicalExpr(node ast.LogicalExprNode, env *Environment) RuntimeVal {
+	left := it.evaluate(node.Left, env)
 
-	if !isLeftBool {
-		log.Fatalf("Logical operators require boolean operands, got: %v", left)
+	if node.Operator == "&&" && !it.LogicalOperand(left) {
+		return left
 	}
-
-	// Short-circuit evaluation
-	if node.Operator == "&&" {
-		if !leftBool.Value {
-			return BoolValue{Value: false}
-		}
-	} else if node.Operator == "||" {
-		if leftBool.Value {
-			return BoolValue{Value: true}
-		}
+	if node.Operator == "||" && it.LogicalOperand(left) {
+		return left
 	}
 
-	right := Evaluate(node.Right, env)
-	rightBool, isRightBool := right.(BoolValue)
+	right := it.evaluate(node.Right, env)
+	it.LogicalOperand(right)
+	return right
+}
 
-	if !isRightBool {
-		log.Fatalf("Logical operators require boolean operands, got: %v", right)
+// LogicalOperand tests an operand of `&&` or `||`. With
+// Options.StrictBooleans it must be a boolean, otherwise it is truthy-tested.
+func (it *Interpreter) LogicalOperand(operand RuntimeVal) bool {
+	if !it.Options.StrictBooleans {
+		return IsTruthy(operand)
 	}
 
-	if node.Operator == "&&" {
-		return BoolValue{Value: rightBool.Value}
-	} else {
-		return BoolValue{Value: rightBool.Value}
+	operandBool, isBool := operand.(BoolValue)
+	if !isBool {
+		runtimeError("Logical operators require boolean operands, got: %v", operand)
 	}
+	return operandBool.Value
 }
 
-func evalBinaryOp(node ast.BinaryExprNode, env *Environment) RuntimeVal {
-	left := Evaluate(node.Left, env)
-	right := Evaluate(node.Right, env)
+func (it *Interpreter) evalBinaryOp(node ast.BinaryExprNode, env *Environment) RuntimeVal {
+	left := it.evaluate(node.Left, env)
+	right := it.evaluate(node.Right, env)
+	return BinaryOp(node.Operator, left, right)
+}
 
-	switch node.Operator {
+// BinaryOp applies a binary operator to evaluated operands.
+func BinaryOp(operator ast.BinaryOperatorKind, left, right RuntimeVal) RuntimeVal {
+	switch operator {
 	case "+", "-", "*", "/", "%":
 		leftNum, leftIsNum := left.(NumberVal)
 		rightNum, rightIsNum := right.(NumberVal)
 		if !leftIsNum || !rightIsNum {
-			log.Fatalf("Cannot perform arithmetic operation on non-number values: %v, %v", left, right)
+			runtimeError("Cannot perform arithmetic operation on non-number values: %v, %v", left, right)
 		}
-		switch node.Operator {
+		switch operator {
 		case "+":
 			return NumberVal{Value: leftNum.Value + rightNum.Value}
 		case "-":
@@ -167,66 +246,26 @@ func evalBinaryOp(node ast.BinaryExprNode, env *Environment) RuntimeVal {
 		case "/":
 			return NumberVal{Value: leftNum.Value / rightNum.Value}
 		case "%":
-			return NumberVal{Value: float64(int(leftNum.Value) % int(rightNum.Value))}
-		}
-	case "==", "!=":
-		// Allow equality/inequality for numbers, strings, booleans, and null
-		switch l := left.(type) {
-		case NumberVal:
-			if r, ok := right.(NumberVal); ok {
-				if node.Operator == "==" {
-					return BoolValue{Value: l.Value == r.Value}
-				} else {
-					return BoolValue{Value: l.Value != r.Value}
-				}
-			}
-		case StringVal:
-			if r, ok := right.(StringVal); ok {
-				if node.Operator == "==" {
-					return BoolValue{Value: l.Value == r.Value}
-				} else {
-					return BoolValue{Value: l.Value != r.Value}
-				}
+			if int(rightNum.Value) == 0 {
+				runtimeError("Cannot take the remainder of a division by zero")
 			}
-		case BoolValue:
-			if r, ok := right.(BoolValue); ok {
-				if node.Operator == "==" {
-					return BoolValue{Value: l.Value == r.Value}
-				} else {
-					return BoolValue{Value: l.Value != r.Value}
-				}
-			}
-			// Null equality: compare with Null singleton value
-		}
-		// Null equality: if left is Null
-		if left == Null {
-			if right == Null {
-				if node.Operator == "==" {
-					return BoolValue{Value: true}
-				} else {
-					return BoolValue{Value: false}
-				}
-			} else {
-				if node.Operator == "==" {
-					return BoolValue{Value: false}
-				} else {
-					return BoolValue{Value: true}
-				}
-			}
-		}
-		// If types don't match, not equal
-		if node.Operator == "==" {
-			return BoolValue{Value: false}
-		} else {
-			return BoolValue{Value: true}
+			return NumberVal{Value: float64(int(leftNum.Value) % int(rightNum.Value))}
 		}
+	case "==":
+		// Structural equality, so [1, 2] == [1, 2] and { a: 1 } == { a: 1 }
+		return BoolValue{Value: Equals(left, right)}
+	case "!=":
+		return BoolValue{Value: !Equals(left, right)}
+	case "is":
+		// Reference identity
+		return BoolValue{Value: Identical(left, right)}
 	case "<", ">", "<=", ">=":
 		leftNum, leftIsNum := left.(NumberVal)
 		rightNum, rightIsNum := right.(NumberVal)
 		if !leftIsNum || !rightIsNum {
-			log.Fatalf("Cannot perform comparison operation on non-number values: %v, %v", left, right)
+			runtimeError("Cannot perform comparison operation on non-number values: %v, %v", left, right)
 		}
-		switch node.Operator {
+		switch operator {
 		case "<":
 			return BoolValue{Value: leftNum.Value < rightNum.Value}
 		case ">":
@@ -237,140 +276,161 @@ func evalBinaryOp(node ast.BinaryExprNode, env *Environment) RuntimeVal {
 			return BoolValue{Value: leftNum.Value >= rightNum.Value}
 		}
 	default:
-		log.Fatalf("Unknown binary operator: %s", node.Operator)
+		runtimeError("Unknown binary operator: %s", operator)
 	}
 	return Null
 }
 
-func evalUnaryOp(node ast.UnaryExprNode, env *Environment) RuntimeVal {
-	right := Evaluate(node.Operand, env)
+func (it *Interpreter) evalUnaryOp(node ast.UnaryExprNode, env *Environment) RuntimeVal {
+	return it.UnaryOp(node.Operator, it.evaluate(node.Operand, env))
+}
 
-	switch node.Operator {
+// UnaryOp applies a unary operator to an evaluated operand.
+func (it *Interpreter) UnaryOp(operator ast.UnaryOperatorKind, right RuntimeVal) RuntimeVal {
+	switch operator {
 	case "!":
+		if !it.Options.StrictBooleans {
+			return BoolValue{Value: !IsTruthy(right)}
+		}
 		rightBool, isRightBool := right.(BoolValue)
 		if !isRightBool {
-			log.Fatalf("Cannot negate a non-bool value! %v", right)
+			runtimeError("Cannot negate a non-bool value! %v", right)
 		}
 		return BoolValue{Value: !rightBool.Value}
 	case "-":
 		rightNum, isRightNum := right.(NumberVal)
 		if !isRightNum {
-			log.Fatalf("Cannot negate a non-number value! %v", right)
+			runtimeError("Cannot negate a non-number value! %v", right)
 		}
 		return NumberVal{Value: -rightNum.Value}
 	default:
-		log.Fatalf("Unknown unary operator: %v", node.Operator)
+		runtimeError("Unknown unary operator: %v", operator)
 		return Null // unreachable, but keeps compiler happy
 	}
 }
 
-func evalVarLookup(node ast.IdentifierExprNode, env *Environment) RuntimeVal {
+func (it *Interpreter) evalVarLookup(node ast.IdentifierExprNode, env *Environment) RuntimeVal {
+	if node.Addr != nil {
+		return env.getSlot(node.Addr, node.Symbol)
+	}
 	return env.GetVar(node.Symbol)
 }
 
-func evalReturnStatement(node ast.ReturnStatementNode, env *Environment) RuntimeVal {
+func (it *Interpreter) evalReturnStatement(node ast.ReturnStatementNode, env *Environment) RuntimeVal {
 	var value RuntimeVal = Null
 	if node.Value != nil {
-		value = Evaluate(node.Value, env)
+		value = it.evaluate(node.Value, env)
 	}
 	return ReturnVal{Value: value}
 }
 
-func evalArray(node ast.ArrayLiteralExprNode, env *Environment) RuntimeVal {
+func (it *Interpreter) evalArray(node ast.ArrayLiteralExprNode, env *Environment) RuntimeVal {
 	// Pre-allocate slice with exact capacity needed
+	it.allocArray(len(node.Elements))
 	elements := make([]RuntimeVal, len(node.Elements))
 
 	// Evaluate each element
 	for i, elem := range node.Elements {
-		elements[i] = Evaluate(elem, env)
+		elements[i] = it.evaluate(elem, env)
 	}
 
-	return ArrayVal{Elements: elements}
+	return &ArrayVal{Elements: elements}
 }
 
-func evalMember(node ast.MemberExprNode, env *Environment) RuntimeVal {
-	object := Evaluate(node.Object, env)
+func (it *Interpreter) evalMember(node ast.MemberExprNode, env *Environment) RuntimeVal {
+	object := it.evaluate(node.Object, env)
 
 	// Computed access: obj[expr] or array[index]
 	if node.Computed {
-		property := Evaluate(node.Property, env)
+		return it.GetIndex(object, it.evaluate(node.Property, env))
+	}
 
-		// Array access
-		if arr, isArray := object.(ArrayVal); isArray {
-			index, isNum := property.(NumberVal)
-			if !isNum {
-				log.Fatalf("Array index must be a number, got: %+v", property)
-			}
-			idx := int(index.Value)
-			if idx < 0 || idx >= len(arr.Elements) {
-				log.Fatalf("Array index out of bounds: %d (length: %d)", idx, len(arr.Elements))
-			}
-			return arr.Elements[idx]
-		}
+	// Dot access: obj.property
+	// Property should be an identifier
+	ident, ok := node.Property.(ast.IdentifierExprNode)
+	if !ok {
+		runtimeError("Property in dot notation must be identifier, got: %+v", node.Property)
+	}
+	return it.GetProperty(object, ident.Symbol)
+}
 
-		// Object computed access: obj[key]
-		if obj, isObj := object.(ObjectVal); isObj {
-			// Convert property to string key
-			var key string
-			if num, isNum := property.(NumberVal); isNum {
-				key = fmt.Sprintf("%v", num.Value)
-			} else {
-				log.Fatalf("Object key must be string or number, got: %+v", property)
-			}
-			if val, exists := obj.Properties[key]; exists {
-				return val
-			}
-			return Null
+// GetIndex evaluates object[property] with both already evaluated.
+func (it *Interpreter) GetIndex(object, property RuntimeVal) RuntimeVal {
+	// Array access
+	if arr, isArray := object.(*ArrayVal); isArray {
+		index, isNum := property.(NumberVal)
+		if !isNum {
+			runtimeError("Array index must be a number, got: %+v", property)
 		}
-
-		log.Fatalf("Cannot use computed access on non-object/array: %+v", object)
+		idx := int(index.Value)
+		if idx < 0 || idx >= len(arr.Elements) {
+			runtimeError("Array index out of bounds: %d (length: %d)", idx, len(arr.Elements))
+		}
+		return arr.Elements[idx]
 	}
 
-	// Dot access: obj.property
-	if obj, isObj := object.(ObjectVal); isObj {
-		// Property should be an identifier
-		ident, ok := node.Property.(ast.IdentifierExprNode)
-		if !ok {
-			log.Fatalf("Property in dot notation must be identifier, got: %+v", node.Property)
+	// Object computed access: obj[key]
+	if obj, isObj := object.(*ObjectVal); isObj {
+		// Convert property to string key
+		var key string
+		if num, isNum := property.(NumberVal); isNum {
+			key = fmt.Sprintf("%v", num.Value)
+		} else {
+			runtimeError("Object key must be string or number, got: %+v", property)
 		}
-		if val, exists := obj.Properties[ident.Symbol]; exists {
+		if val, exists := obj.Properties[key]; exists {
 			return val
 		}
 		return Null
 	}
 
-	log.Fatalf("Cannot access property on non-object: %+v", object)
+	runtimeError("Cannot use computed access on non-object/array: %+v", object)
 	return Null
 }
 
-func evalForLoop(node ast.ForStatementNode, env *Environment) RuntimeVal {
+// GetProperty evaluates object.name with object already evaluated.
+func (it *Interpreter) GetProperty(object RuntimeVal, name string) RuntimeVal {
+	switch obj := object.(type) {
+	case *ObjectVal:
+		if val, exists := obj.Properties[name]; exists {
+			return val
+		}
+		return Null
+	case *MapVal:
+		return it.mapMember(obj, name)
+	case *SetVal:
+		return it.setMember(obj, name)
+	}
+
+	runtimeError("Cannot access property on non-object: %+v", object)
+	return Null
+}
+
+func (it *Interpreter) evalForLoop(node ast.ForStatementNode, env *Environment) RuntimeVal {
 	// New scope for the for loop body
-	loopEnv := MakeEnvironment()
-	loopEnv.Parent = env
+	loopEnv := newScope(env, node.Scope)
 
 	// Evaluate the init to load it into env
 	if node.Init != nil {
-		Evaluate(node.Init, loopEnv)
+		it.evaluate(node.Init, loopEnv)
 	}
 
 	for {
 		// Re-evaluate the condition
-		conditionVal := Evaluate(node.Condition, loopEnv)
-		condition, isBoolCondition := conditionVal.(BoolValue)
-		if !isBoolCondition {
-			log.Fatalf("For loop condition does not evaluate to a boolean value: %v", condition)
-		}
+		conditionVal := it.evaluate(node.Condition, loopEnv)
 
 		// Condition is false
-		if !condition.Value {
+		if !it.Condition(conditionVal, "For loop") {
 			break
 		}
 
 		// Evaluate the body
-		Evaluate(node.Body, loopEnv)
+		if result := it.evaluate(node.Body, loopEnv); isReturn(result) {
+			return result
+		}
 
 		if node.Update != nil {
-			Evaluate(node.Update, loopEnv)
+			it.evaluate(node.Update, loopEnv)
 		}
 	}
 
@@ -378,26 +438,23 @@ func evalForLoop(node ast.ForStatementNode, env *Environment) RuntimeVal {
 	return Null
 }
 
-func evalWhileLoop(node ast.WhileStatementNode, env *Environment) RuntimeVal {
+func (it *Interpreter) evalWhileLoop(node ast.WhileStatementNode, env *Environment) RuntimeVal {
 	// New scope for the for loop body
-	loopEnv := MakeEnvironment()
-	loopEnv.Parent = env
+	loopEnv := newScope(env, node.Scope)
 
 	for {
 		// Re-evaluate the condition
-		conditionVal := Evaluate(node.Condition, loopEnv)
-		condition, isBoolCondition := conditionVal.(BoolValue)
-		if !isBoolCondition {
-			log.Fatalf("For loop condition does not evaluate to a boolean value: %v", condition)
-		}
+		conditionVal := it.evaluate(node.Condition, loopEnv)
 
 		// Condition is false
-		if !condition.Value {
+		if !it.Condition(conditionVal, "While loop") {
 			break
 		}
 
 		// Evaluate the body
-		Evaluate(node.Body, loopEnv)
+		if result := it.evaluate(node.Body, loopEnv); isReturn(result) {
+			return result
+		}
 	}
 
 	// While loops are statements so they don't resolve to a value
@@ -405,90 +462,198 @@ func evalWhileLoop(node ast.WhileStatementNode, env *Environment) RuntimeVal {
 }
 
 
-func evalIfStatement(node ast.IfStatementNode, env *Environment) RuntimeVal {
+func (it *Interpreter) evalIfStatement(node ast.IfStatementNode, env *Environment) RuntimeVal {
 	// New scope for the for loop body
-	ifBlockEnv := MakeEnvironment()
-	ifBlockEnv.Parent = env
+	ifBlockEnv := newScope(env, node.Scope)
 
-	condition := Evaluate(node.Condition, ifBlockEnv)
+	condition := it.evaluate(node.Condition, ifBlockEnv)
 
-	conditionVal, isConditionBool := condition.(BoolValue)
-
-	if !isConditionBool {
-		log.Fatalf("If statement condition must evaluate to a boolean: %v", conditionVal)
-	}
-
-	if !conditionVal.Value {
+	if !it.Condition(condition, "If statement") {
+		// `else if` chains are nested IfStatementNodes, plain `else` is a
+		// block with a scope of its own
+		if _, ok := node.Alternate.(ast.BlockStatementNode); ok {
+			return it.evaluate(node.Alternate, newScope(env, node.AlternateScope))
+		}
+		if node.Alternate != nil {
+			return it.evaluate(node.Alternate, env)
+		}
 		return Null
 	}
 
-	// consequent := Evaluate(node.Consequent, ifBlockEnv)
-
 	// We will only support block statements as consequent
 	consequentVal, isConsequentBlock := node.Consequent.(ast.BlockStatementNode)
 
 	if !isConsequentBlock {
-		log.Fatalf("If statement must have a block statement as the body %v: ", consequentVal)
+		runtimeError("If statement must have a block statement as the body %v: ", consequentVal)
 	}
 
-	Evaluate(consequentVal, ifBlockEnv)
+	// A `pop` inside the block has to reach the enclosing function
+	if result := it.evaluate(consequentVal, ifBlockEnv); isReturn(result) {
+		return result
+	}
 
-	// While loops are statements so they don't resolve to a value
+	// If statements are statements so they don't resolve to a value
 	return Null
 }
 
-func evalBlockStatement(node ast.BlockStatementNode, env *Environment) RuntimeVal {
+func (it *Interpreter) evalBlockStatement(node ast.BlockStatementNode, env *Environment) RuntimeVal {
 	for _, stmt := range node.Body {
-		Evaluate(stmt, env)
+		if result := it.evaluate(stmt, env); isReturn(result) {
+			return result
+		}
 	}
 
 	return Null
 }
 
+func (it *Interpreter) evalTryStatement(node ast.TryStatementNode, env *Environment) (result RuntimeVal) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		runtimeErr, ok := r.(*RuntimeError)
+		if !ok || runtimeErr.Fatal {
+			panic(r)
+		}
+
+		// The handler gets its own scope holding the caught error
+		catchEnv := newScope(env, node.HandlerScope)
+		if node.Param != "" && node.HandlerScope != nil {
+			catchEnv.declareSlot(&ast.Address{Slot: 0}, node.Param, false, runtimeErr.CaughtValue())
+		} else if node.Param != "" {
+			catchEnv.DeclareVar(node.Param, false, runtimeErr.CaughtValue())
+		}
+
+		result = Null
+		if handled := it.evaluate(node.Handler, catchEnv); isReturn(handled) {
+			result = handled
+		}
+	}()
+
+	tryEnv := newScope(env, node.Scope)
+
+	// A `pop` inside the block has to reach the enclosing function
+	if val := it.evaluate(node.Body, tryEnv); isReturn(val) {
+		return val
+	}
+	return Null
+}
+
+func (it *Interpreter) evalThrowStatement(node ast.ThrowStatementNode, env *Environment) RuntimeVal {
+	ThrowValue(it.evaluate(node.Value, env))
+	return Null
+}
+
+// ThrowValue aborts evaluation the way a Popcorn `throw val` does. An
+// object's `name` property names the error.
+func ThrowValue(val RuntimeVal) {
+	runtimeErr := &RuntimeError{Message: thrownMessage(val), Value: val}
+	if obj, ok := val.(*ObjectVal); ok {
+		if name, ok := obj.Properties["name"].(StringVal); ok {
+			runtimeErr.Name = name.Value
+		}
+	}
+	panic(runtimeErr)
+}
+
+// thrownMessage is the error message reported when a thrown value is not
+// caught: strings as they are, error-like objects by their message.
+func thrownMessage(val RuntimeVal) string {
+	switch v := val.(type) {
+	case StringVal:
+		return v.Value
+	case *ObjectVal:
+		if message, ok := v.Properties["message"].(StringVal); ok {
+			return message.Value
+		}
+	}
+	return Inspect(val, DefaultInspectOptions)
+}
+
+// Condition decides whether an `if`/`while`/`for` condition holds. With
+// Options.StrictBooleans the condition must be a boolean, otherwise it is truthy-tested.
+func (it *Interpreter) Condition(condition RuntimeVal, statement string) bool {
+	if !it.Options.StrictBooleans {
+		return IsTruthy(condition)
+	}
+
+	conditionVal, isConditionBool := condition.(BoolValue)
+	if !isConditionBool {
+		runtimeError("%s condition must evaluate to a boolean: %v", statement, condition)
+	}
+	return conditionVal.Value
+}
+
+func isReturn(result RuntimeVal) bool {
+	_, ok := result.(ReturnVal)
+	return ok
+}
+
+// Evaluate runs a node in env with a default interpreter. Runtime errors
+// panic with a *RuntimeError; use an Interpreter to get them back as errors.
 func Evaluate(astNode ast.ASTNode, env *Environment) RuntimeVal {
+	return NewInterpreter(DefaultOptions()).evaluate(astNode, env)
+}
+
+func (it *Interpreter) evaluate(astNode ast.ASTNode, env *Environment) RuntimeVal {
+	it.step()
+	it.at(ast.PositionOf(astNode))
+
 	switch node := astNode.(type) {
 	case ast.AssignmentExprNode:
-		return evalAssignment(node, env)
+		return it.evalAssignment(node, env)
 	case ast.ObjectLiteralExprNode:
-		return evalObjectLiteral(node, env)
+		return it.evalObjectLiteral(node, env)
 	case ast.CallExprNode:
-		return evalCallExpression(node, env)
+		return it.evalCallExpression(node, env)
 	case ast.Program:
-		return evalProgram(node, env)
+		return it.evalProgram(node, env)
 	case ast.VariableDeclarationNode:
-		return evalVarDeclaration(node, env)
+		return it.evalVarDeclaration(node, env)
 	case ast.FunctionDeclarationNode:
-		return evalFnDeclaration(node, env)
+		return it.evalFnDeclaration(node, env)
 	case ast.ReturnStatementNode:
-		return evalReturnStatement(node, env)
+		return it.evalReturnStatement(node, env)
 	case ast.NumericLiteralExprNode:
-		return evalNumber(node, env)
+		return it.evalNumber(node, env)
 	case ast.BinaryExprNode:
-		return evalBinaryOp(node, env)
+		return it.evalBinaryOp(node, env)
 	case ast.IdentifierExprNode:
-		return evalVarLookup(node, env)
+		return it.evalVarLookup(node, env)
 	case ast.ArrayLiteralExprNode:
-		return evalArray(node, env)
+		return it.evalArray(node, env)
 	case ast.MemberExprNode:
-		return evalMember(node, env)
+		return it.evalMember(node, env)
 	case ast.StringLiteralExprNode:
-		return evalString(node, env)
+		return it.evalString(node, env)
 	case ast.BooleanLiteralExprNode:
-		return evalBool(node, env)
+		return it.evalBool(node, env)
+	case ast.NullLiteralExprNode:
+		return Null
 	case ast.LogicalExprNode:
-		return evalLogicalExpr(node, env)
+		return it.evalLogicalExpr(node, env)
 	case ast.UnaryExprNode:
-		return evalUnaryOp(node, env)
+		return it.evalUnaryOp(node, env)
 	case ast.ForStatementNode:
-		return evalForLoop(node, env)
+		return it.evalForLoop(node, env)
 	case ast.WhileStatementNode:
-		return evalWhileLoop(node, env)
+		return it.evalWhileLoop(node, env)
 	case ast.BlockStatementNode:
-		return evalBlockStatement(node, env)
+		return it.evalBlockStatement(node, env)
 	case ast.IfStatementNode:
-		return evalIfStatement(node, env)
+		return it.evalIfStatement(node, env)
+	case ast.TryStatementNode:
+		return it.evalTryStatement(node, env)
+	case ast.ThrowStatementNode:
+		return it.evalThrowStatement(node, env)
+	case ast.TypeAliasNode:
+		// Types are only checked ahead of running
+		return Null
+	case ast.ImportDeclarationNode:
+		return it.evalImport(node, env)
 	default:
-		log.Fatalf("Node of type '%s' is not setup for evaluation.", ast.GetNodeKindAsString(node))
+		runtimeError("Node of type '%s' is not setup for evaluation.", ast.GetNodeKindAsString(node))
 	}
 
 	return Null
@@ -0,0 +1,152 @@
+package backend
+
+import (
+	"io"
+	"math"
+)
+
+// Approximate sizes charged against Limits.MaxMemory. They are in the right
+// ballpark for the Go representation of each value, not exact.
+const (
+	containerBytes = 32 // array, object, map and set headers
+	valueBytes     = 16 // one array element
+	propertyBytes  = 48 // one object property with its key and map slot
+	entryBytes     = 64 // one map or set entry with its hash bucket slot
+)
+
+// cancelCheckInterval is how many steps pass between context checks, so
+// cancellation costs next to nothing on the hot path.
+const cancelCheckInterval = 1024
+
+// step counts one evaluated node against MaxSteps and periodically checks
+// whether the run's context has been cancelled.
+func (it *Interpreter) step() {
+	it.steps++
+	if it.Options.Limits.MaxSteps > 0 && it.steps > it.Options.Limits.MaxSteps {
+		namedError("StepLimitError", true, "Step limit of %d exceeded", it.Options.Limits.MaxSteps)
+	}
+
+	if it.steps%cancelCheckInterval == 0 && it.ctx != nil {
+		if err := it.ctx.Err(); err != nil {
+			panic(&RuntimeError{Name: "CancelledError", Message: "Execution cancelled: " + err.Error(), Err: err, Fatal: true})
+		}
+	}
+}
+
+// EnterCall counts a Popcorn function call against the call depth. Unless
+// it raises a StackOverflowError, the caller must call ExitCall when the
+// call returns or unwinds.
+func (it *Interpreter) EnterCall(name string) {
+	maxDepth := it.MaxCallDepth()
+	if it.depth >= maxDepth {
+		namedError("StackOverflowError", false, "Stack overflow: maximum call depth of %d exceeded in '%s'", maxDepth, name)
+	}
+	it.depth++
+}
+
+// MaxCallDepth returns the call depth EnterCall allows: Limits.MaxCallDepth,
+// or DefaultMaxCallDepth if that is zero, clamped to the ceiling of the
+// engine running the program.
+func (it *Interpreter) MaxCallDepth() int {
+	ceiling := MaxTreeWalkerCallDepth
+	if engine, ok := it.Options.Engine.(CallDepthCeiling); ok {
+		ceiling = engine.MaxCallDepth()
+	}
+
+	maxDepth := it.Options.Limits.MaxCallDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxCallDepth
+	}
+	return min(maxDepth, ceiling)
+}
+
+// ExitCall ends a call counted by EnterCall.
+func (it *Interpreter) ExitCall() {
+	it.depth--
+}
+
+// allocArray charges a new array of n elements.
+func (it *Interpreter) allocArray(n int) {
+	it.checkLength("Array length", n)
+	it.charge(containerBytes + n*valueBytes)
+}
+
+// allocObject charges a new object with n properties.
+func (it *Interpreter) allocObject(n int) {
+	it.charge(containerBytes + n*propertyBytes)
+}
+
+// allocEntries charges added new entries to a map or set that now holds
+// size entries.
+func (it *Interpreter) allocEntries(kind string, size, added int) {
+	it.checkLength(kind+" size", size)
+	it.charge(added * entryBytes)
+}
+
+// allocString charges a new string of n bytes.
+func (it *Interpreter) allocString(n int) {
+	it.checkStringLength(n)
+	it.charge(n)
+}
+
+// checkValue applies the length limits to a value that was created outside
+// the interpreter, such as the result of a native function.
+func (it *Interpreter) checkValue(val RuntimeVal) {
+	switch v := val.(type) {
+	case *ArrayVal:
+		it.checkLength("Array length", len(v.Elements))
+	case StringVal:
+		it.checkStringLength(len(v.Value))
+	}
+}
+
+func (it *Interpreter) checkLength(what string, n int) {
+	if max := it.Options.Limits.MaxArrayLength; max > 0 && n > max {
+		namedError("RangeError", false, "%s %d exceeds the limit of %d", what, n, max)
+	}
+}
+
+func (it *Interpreter) checkStringLength(n int) {
+	if max := it.Options.Limits.MaxStringLength; max > 0 && n > max {
+		namedError("RangeError", false, "String length %d exceeds the limit of %d", n, max)
+	}
+}
+
+func (it *Interpreter) charge(bytes int) {
+	it.allocated += bytes
+	if max := it.Options.Limits.MaxMemory; max > 0 && it.allocated > max {
+		namedError("MemoryLimitError", true, "Memory limit of %d bytes exceeded", max)
+	}
+}
+
+// readString reads r into a string for a native, such as the contents of a
+// file, charging it against the limits. size is how long r says it is, or
+// -1 if it does not know. Reading stops past what the limits allow, so an
+// input that is too large fails before it is held in memory.
+func (it *Interpreter) readString(r io.Reader, size int64) (string, error) {
+	if budget, limited := it.stringBudget(); limited {
+		if size > int64(budget) {
+			it.allocString(int(min(size, math.MaxInt)))
+		}
+		r = io.LimitReader(r, int64(budget)+1)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	it.allocString(len(data))
+	return string(data), nil
+}
+
+// stringBudget is the length of the longest string the limits let a run
+// create now. It reports false if they allow any length.
+func (it *Interpreter) stringBudget() (int, bool) {
+	budget, limited := math.MaxInt, false
+	if limit := it.Options.Limits.MaxStringLength; limit > 0 {
+		budget, limited = limit, true
+	}
+	if limit := it.Options.Limits.MaxMemory; limit > 0 {
+		budget, limited = min(budget, max(limit-it.allocated, 0)), true
+	}
+	return budget, limited
+}
@@ -0,0 +1,187 @@
+package backend
+
+import (
+	"os"
+	"path/filepath"
+	FE "pop/frontend"
+	"pop/frontend/types/ast"
+	"pop/packages"
+	"slices"
+	"strings"
+)
+
+// Import returns the exports of the module specifier names, as seen from
+// the module whose top-level code is running, as a new object. A module
+// runs the first time it is imported, in an environment of its own with
+// the built-ins and the globals set with SetGlobal, and later imports get
+// the values it exported then. Importing a module whose top-level code is
+// still running, directly or through other modules, is an ImportError.
+func (it *Interpreter) Import(specifier string) *ObjectVal {
+	from := ""
+	if len(it.importing) > 0 {
+		from = it.importing[len(it.importing)-1]
+	}
+	path, err := it.Options.Resolver.Resolve(from, specifier)
+	if err != nil {
+		namedError("ImportError", false, "Cannot resolve module '%s': %v", specifier, err)
+	}
+	if i := slices.Index(it.importing, path); i >= 0 {
+		cycle := append(slices.Clone(it.importing[i:]), path)
+		namedError("ImportError", false, "Import cycle: %s", strings.Join(cycle, " -> "))
+	}
+
+	exports, ok := it.modules[path]
+	if !ok {
+		if _, onDisk := it.Options.Resolver.(FileResolver); onDisk {
+			it.requireModule(path)
+		}
+		source, err := it.Options.Resolver.Load(path)
+		if err != nil {
+			namedError("ImportError", false, "Cannot load module '%s': %v", specifier, err)
+		}
+		exports = it.runModule(path, string(source))
+		it.modules[path] = exports
+	}
+
+	it.allocObject(len(exports))
+	obj := &ObjectVal{Properties: make(map[string]RuntimeVal, len(exports))}
+	for name, val := range exports {
+		obj.Properties[name] = val
+	}
+	return obj
+}
+
+// requireModule raises a PermissionError unless the module file at path is
+// inside the project of the file being run or may be read, so a sandboxed
+// script cannot import its way to files it could not fs.read.
+func (it *Interpreter) requireModule(path string) {
+	root := it.root
+	if root == "" {
+		root = "."
+	}
+	if !pathWithin(root, path) {
+		it.Require(CapRead, path)
+	}
+}
+
+// projectRoot returns the nearest directory from dir up that has a package
+// manifest, or dir itself if none does.
+func projectRoot(dir string) string {
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, packages.ManifestFile)); err == nil {
+			return d
+		}
+		if filepath.Dir(d) == d {
+			return dir
+		}
+	}
+}
+
+// ImportName returns the export name of the module specifier, which
+// Import returned as exports.
+func (it *Interpreter) ImportName(exports *ObjectVal, specifier, name string) RuntimeVal {
+	val, ok := exports.Properties[name]
+	if !ok {
+		namedError("ImportError", false, "Module '%s' has no export '%s'", specifier, name)
+	}
+	return val
+}
+
+// DeclareImport declares name in e as a constant bound to an export,
+// which unlike other constants may be null.
+func (e *Environment) DeclareImport(name string, value RuntimeVal) {
+	e.DeclareVar(name, false, value)
+	e.Constants[name] = struct{}{}
+}
+
+// runModule runs the top-level code of the module at path, with source,
+// and returns what it exports.
+func (it *Interpreter) runModule(path, source string) map[string]RuntimeVal {
+	program, err := FE.Parse(source)
+	if err != nil {
+		namedError("ImportError", false, "%s: %v", path, err)
+	}
+	names := exportedNames(program)
+
+	env := it.moduleGlobals()
+	globals := it.Globals
+	it.Globals = env
+	defer func() { it.Globals = globals }()
+	if program, err = it.Optimize(program); err != nil {
+		namedError("ImportError", false, "%s: %v", path, err)
+	}
+	if program, err = it.Resolve(program); err != nil {
+		namedError("ImportError", false, "%s: %v", path, err)
+	}
+
+	it.SetSource(path, source)
+	it.importing = append(it.importing, path)
+	it.PushFrame(Frame{Name: "<module>", File: path})
+	defer func() {
+		r := recover()
+		if r != nil {
+			it.traceError(r)
+		}
+		it.PopFrame()
+		it.importing = it.importing[:len(it.importing)-1]
+		if r != nil {
+			panic(r)
+		}
+	}()
+
+	if it.Options.Engine != nil {
+		if _, err := it.Options.Engine.Run(it, path, program); err != nil {
+			namedError("ImportError", false, "%s: %v", path, err)
+		}
+	} else {
+		it.evaluate(program, env)
+	}
+
+	exports := make(map[string]RuntimeVal, len(names))
+	for _, name := range names {
+		exports[name] = env.Variables[name]
+	}
+	return exports
+}
+
+// moduleGlobals returns the top-level environment of a module.
+func (it *Interpreter) moduleGlobals() *Environment {
+	env := it.makeGlobals()
+	for name, val := range it.hostGlobals {
+		env.DeclareVar(name, false, val)
+	}
+	return env
+}
+
+// exportedNames lists the variables and functions program exports.
+func exportedNames(program ast.Program) []string {
+	var names []string
+	for _, stmt := range program.Body {
+		switch n := stmt.(type) {
+		case ast.VariableDeclarationNode:
+			if n.Exported {
+				names = append(names, n.Identifier)
+			}
+		case ast.FunctionDeclarationNode:
+			if n.Exported {
+				names = append(names, n.Name)
+			}
+		}
+	}
+	return names
+}
+
+// evalImport binds the exports an import names in env, which is the
+// top-level environment of the module importing them.
+func (it *Interpreter) evalImport(node ast.ImportDeclarationNode, env *Environment) RuntimeVal {
+	it.at(node.Pos)
+	exports := it.Import(node.Specifier)
+	if node.Namespace != "" {
+		env.DeclareImport(node.Namespace, exports)
+		return Null
+	}
+	for _, name := range node.Names {
+		env.DeclareImport(name.Local, it.ImportName(exports, node.Specifier, name.Name))
+	}
+	return Null
+}
@@ -0,0 +1,216 @@
+package backend
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"pop/frontend/types/ast"
+	"pop/packages"
+	"strings"
+)
+
+// Options configures an Interpreter. The zero value is usable: missing
+// streams default to the process's standard streams and a missing resolver
+// reads modules from disk.
+type Options struct {
+	// Stdin is read by the REPL
+	Stdin io.Reader
+	// Stdout receives program output and printed results
+	Stdout io.Writer
+	// Stderr receives error reports
+	Stderr io.Writer
+
+	// StrictBooleans turns off truthiness: conditions, `!`, `&&` and `||`
+	// then only accept booleans and anything else is a runtime error
+	StrictBooleans bool
+
+	// DumpAST is a path the parsed AST is written to as JSON before it is
+	// evaluated. Empty disables the dump.
+	DumpAST string
+
+	// Resolver locates and loads source files
+	Resolver ModuleResolver
+
+	// Limits caps the resources a single run may use
+	Limits Limits
+
+	// Permissions grants access to the filesystem, environment, clock,
+	// randomness, subprocesses and network. The zero value denies all of it.
+	Permissions Permissions
+
+	// Engine runs programs instead of the tree walker when set
+	Engine Engine
+
+	// Optimizer rewrites programs after they are parsed, see package
+	// optimizer. Nil runs them as written.
+	Optimizer Optimizer
+
+	// CheckTypes enforces type annotations as programs run: arguments and
+	// popped values of annotated functions, and values given to annotated
+	// variables, raise a TypeError if they are not of their type
+	CheckTypes bool
+}
+
+// DefaultMaxCallDepth is the call depth used when Limits.MaxCallDepth is
+// zero. Every Popcorn call nests several Go frames, so recursion always has
+// to stop somewhere short of the Go stack limit.
+const DefaultMaxCallDepth = 10_000
+
+// MaxTreeWalkerCallDepth is the highest call depth the tree walker allows,
+// whatever Limits.MaxCallDepth says. A Popcorn call nests a few kilobytes
+// of Go stack, and Go kills the process rather than panicking once the
+// stack reaches its 1 GB limit, which happens between 200,000 and 400,000
+// calls. Engines can set a ceiling of their own, see CallDepthCeiling.
+const MaxTreeWalkerCallDepth = 100_000
+
+// Limits caps the work a single RunString/RunFile/Eval/Call may do. A zero
+// field means no limit, except for MaxCallDepth.
+//
+// Exceeding MaxCallDepth, MaxArrayLength or MaxStringLength raises an error
+// scripts can catch. Exceeding MaxSteps or MaxMemory ends the run.
+type Limits struct {
+	// MaxSteps is the number of AST nodes that may be evaluated
+	MaxSteps int
+	// MaxCallDepth is how deeply Popcorn functions may recurse before a
+	// StackOverflowError. Zero uses DefaultMaxCallDepth, and larger values
+	// than the engine supports are clamped, see Interpreter.MaxCallDepth.
+	MaxCallDepth int
+	// MaxArrayLength caps the length of any array, map or set
+	MaxArrayLength int
+	// MaxStringLength caps the length in bytes of any string
+	MaxStringLength int
+	// MaxMemory caps the approximate number of bytes the run allocates for
+	// arrays, objects, maps, sets and strings. Memory is counted when it is
+	// allocated and never given back, so this bounds the total allocated by
+	// a run rather than what is live at any one time.
+	MaxMemory int
+}
+
+// DefaultOptions returns the options used by the CLI and REPL.
+func DefaultOptions() Options {
+	return Options{
+		Stdin:    os.Stdin,
+		Stdout:   os.Stdout,
+		Stderr:   os.Stderr,
+		Resolver: FileResolver{},
+	}
+}
+
+// ModuleResolver turns file specifiers into source code. Embedders can
+// implement it to serve scripts from memory instead of the filesystem.
+type ModuleResolver interface {
+	// Resolve returns the canonical path of specifier as seen from the
+	// module at path from. from is empty for the entry file.
+	Resolve(from, specifier string) (string, error)
+	// Load returns the source of a path returned by Resolve.
+	Load(path string) ([]byte, error)
+}
+
+// FileResolver resolves specifiers relative to the importing file and reads
+// them from disk. Bare specifiers like "mathx" name packages installed in
+// the nearest pop_modules directory, see package packages. Imports of files
+// outside the project of the file being run, the nearest directory up from
+// it with a manifest or else its own directory, need Permissions.Read.
+type FileResolver struct{}
+
+func (FileResolver) Resolve(from, specifier string) (string, error) {
+	if from != "" && packages.IsBare(specifier) {
+		dir, err := filepath.Abs(filepath.Dir(from))
+		if err != nil {
+			return "", err
+		}
+		root := filepath.VolumeName(dir) + string(filepath.Separator)
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			return "", err
+		}
+		found, ok, err := findPackage(os.DirFS(root), filepath.ToSlash(rel), specifier)
+		if ok || err != nil {
+			return filepath.Join(root, filepath.FromSlash(found)), err
+		}
+	}
+	if from != "" && !filepath.IsAbs(specifier) {
+		specifier = filepath.Join(filepath.Dir(from), specifier)
+	}
+	return filepath.Abs(specifier)
+}
+
+func (FileResolver) Load(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+// FSResolver resolves specifiers like FileResolver does, within FS, and
+// reads them from it. Paths are slash-separated and those starting with a
+// slash are relative to the root of FS. It serves scripts from an
+// embed.FS, for example.
+type FSResolver struct {
+	FS fs.FS
+}
+
+func (r FSResolver) Resolve(from, specifier string) (string, error) {
+	if from != "" && packages.IsBare(specifier) {
+		found, ok, err := findPackage(r.FS, path.Dir(from), specifier)
+		if ok || err != nil {
+			return found, err
+		}
+	}
+	return resolveSlashed(from, specifier)
+}
+
+func (r FSResolver) Load(name string) ([]byte, error) {
+	return fs.ReadFile(r.FS, name)
+}
+
+// MapResolver serves the modules in it, by path, like FSResolver. It has
+// no packages: bare specifiers are relative paths.
+type MapResolver map[string]string
+
+func (m MapResolver) Resolve(from, specifier string) (string, error) {
+	return resolveSlashed(from, specifier)
+}
+
+func (m MapResolver) Load(name string) ([]byte, error) {
+	source, ok := m[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return []byte(source), nil
+}
+
+// findPackage finds the package module a bare specifier names for a module
+// in dir, in fsys. A specifier without an extension that names no
+// installed package is an error rather than a relative path, since it
+// could only be a missing package.
+func findPackage(fsys fs.FS, dir, specifier string) (string, bool, error) {
+	found, ok, err := packages.Find(fsys, dir, specifier)
+	if err == nil && !ok && path.Ext(specifier) == "" {
+		err = fmt.Errorf("package %q is not installed, run popcorn install", specifier)
+	}
+	return found, ok, err
+}
+
+// resolveSlashed resolves specifier against the directory of from, or
+// against the root if it starts with a slash.
+func resolveSlashed(from, specifier string) (string, error) {
+	name := specifier
+	if !strings.HasPrefix(specifier, "/") {
+		name = path.Join(path.Dir(from), specifier)
+	}
+	name = strings.TrimPrefix(path.Clean(name), "/")
+	if !fs.ValidPath(name) || name == "." {
+		return "", fmt.Errorf("invalid module path %q", specifier)
+	}
+	return name, nil
+}
+
+// Optimizer rewrites a parsed program into one that gives the same results
+// with less work.
+//
+// Compiled programs are cached per optimizer, told apart by how fmt prints
+// them, so an Optimizer should print the transformations it makes.
+type Optimizer interface {
+	Optimize(program ast.Program) ast.Program
+}
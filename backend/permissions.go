@@ -0,0 +1,201 @@
+package backend
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Capability names something a script can only touch with a grant.
+type Capability string
+
+const (
+	CapRead   Capability = "read"
+	CapWrite  Capability = "write"
+	CapEnv    Capability = "env"
+	CapClock  Capability = "clock"
+	CapRandom Capability = "random"
+	CapRun    Capability = "run"
+	CapNet    Capability = "net"
+)
+
+// Permissions decides which host resources the built-in fs, env, clock,
+// random, process and net objects may use. The zero value denies everything,
+// so scripts are sandboxed unless the host opts in.
+type Permissions struct {
+	// Read and Write list files and directories; a directory grants
+	// everything below it
+	Read  Grant
+	Write Grant
+	// Env lists environment variable names
+	Env Grant
+	// Run lists programs, by name or path, that may be started
+	Run Grant
+	// Net lists hosts, optionally with a port ("example.com:443")
+	Net Grant
+
+	Clock  bool
+	Random bool
+}
+
+// AllowAll returns permissions that grant every capability.
+func AllowAll() Permissions {
+	all := Grant{All: true}
+	return Permissions{Read: all, Write: all, Env: all, Run: all, Net: all, Clock: true, Random: true}
+}
+
+// Grant allows a capability for the listed targets, or for all of them.
+//
+// Grant implements flag.Value as a boolean flag, so `--allow-read` grants
+// everything and `--allow-read=./data,./config` grants those paths.
+type Grant struct {
+	All   bool
+	Allow []string
+}
+
+func (g *Grant) String() string {
+	if g == nil {
+		return ""
+	}
+	if g.All {
+		return "true"
+	}
+	return strings.Join(g.Allow, ",")
+}
+
+func (g *Grant) Set(value string) error {
+	switch value {
+	case "true":
+		*g = Grant{All: true}
+		return nil
+	case "false":
+		*g = Grant{}
+		return nil
+	}
+
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			g.Allow = append(g.Allow, item)
+		}
+	}
+	return nil
+}
+
+func (g *Grant) IsBoolFlag() bool {
+	return true
+}
+
+// Allows reports whether the capability may be used on target: a path for
+// read and write, a variable name for env, a program for run and a host or
+// host:port for net. Clock and random take no target.
+func (p Permissions) Allows(capability Capability, target string) bool {
+	switch capability {
+	case CapRead:
+		return p.Read.allows(target, pathWithin)
+	case CapWrite:
+		return p.Write.allows(target, pathWithin)
+	case CapEnv:
+		return p.Env.allows(target, func(granted, name string) bool { return granted == name })
+	case CapRun:
+		return p.Run.allows(target, sameProgram)
+	case CapNet:
+		return p.Net.allows(target, hostMatches)
+	case CapClock:
+		return p.Clock
+	case CapRandom:
+		return p.Random
+	}
+	return false
+}
+
+func (g Grant) allows(target string, match func(granted, target string) bool) bool {
+	if g.All {
+		return true
+	}
+	for _, granted := range g.Allow {
+		if match(granted, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Require raises a catchable PermissionError unless the interpreter's
+// permissions allow the capability on target. Natives added by embedders
+// can use it to guard their own host access.
+func (it *Interpreter) Require(capability Capability, target string) {
+	if it.Options.Permissions.Allows(capability, target) {
+		return
+	}
+
+	if target == "" {
+		namedError("PermissionError", false, "Permission denied: %s access (run with --allow-%s)", capability, capability)
+	}
+	namedError("PermissionError", false, "Permission denied: %s access to '%s' (run with --allow-%s=%s)", capability, target, capability, target)
+}
+
+// pathWithin reports whether path is the granted path or inside it. Both are
+// made absolute and symlinks are resolved, so `../` and links cannot step
+// outside a grant.
+func pathWithin(granted, path string) bool {
+	grantedPath, err := realPath(granted)
+	if err != nil {
+		return false
+	}
+	targetPath, err := realPath(path)
+	if err != nil {
+		return false
+	}
+
+	rel, err := filepath.Rel(grantedPath, targetPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// realPath makes path absolute and resolves symlinks in the longest part of
+// it that exists, so files that are about to be created can be checked too.
+func realPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	missing := ""
+	for dir := abs; ; dir = filepath.Dir(dir) {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err == nil {
+			return filepath.Join(resolved, missing), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) || filepath.Dir(dir) == dir {
+			return abs, nil
+		}
+		missing = filepath.Join(filepath.Base(dir), missing)
+	}
+}
+
+// sameProgram matches a program by the name or path it was granted under,
+// or by both resolving to the same executable.
+func sameProgram(granted, program string) bool {
+	if granted == program {
+		return true
+	}
+
+	grantedPath, err := exec.LookPath(granted)
+	if err != nil {
+		return false
+	}
+	programPath, err := exec.LookPath(program)
+	return err == nil && grantedPath == programPath
+}
+
+// hostMatches allows any port of a granted host, or only the granted port.
+func hostMatches(granted, target string) bool {
+	if granted == target {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(target)
+	return err == nil && granted == host
+}
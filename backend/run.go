@@ -2,30 +2,282 @@ package backend
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	FE "pop/frontend"
+	"pop/frontend/types/ast"
 	T "pop/frontend/types/tokens"
 	"strings"
 )
 
-func RunFile(filePath string) error {
+// Interpreter evaluates Popcorn programs. Globals persist across calls, so
+// an Interpreter can run several snippets that build on each other, like
+// the REPL does.
+type Interpreter struct {
+	Options Options
+	Globals *Environment
+
+	// ctx, steps, depth, allocated and frames are reset for every
+	// top-level run
+	ctx       context.Context
+	steps     int
+	depth     int
+	allocated int
+	frames    []Frame
+
+	// sources holds the lines of every file run so far, for tracebacks
+	sources map[string][]string
+	// types are the annotations checked with Options.CheckTypes, parsed
+	types map[string]*ast.TypeExpr
+
+	// modules are the exports of the modules imported so far, by path,
+	// and importing the paths of the modules whose top-level code is
+	// running, the innermost last
+	modules   map[string]map[string]RuntimeVal
+	importing []string
+	// root is the project of the file being run, which files read through
+	// FileResolver may import from without a read grant. It is the working
+	// directory when empty.
+	root string
+	// hostGlobals are the globals set with SetGlobal, which modules see
+	hostGlobals map[string]RuntimeVal
+	// builtins is the parent of Globals and of every module's globals
+	builtins *Environment
+}
+
+// NewInterpreter creates an interpreter with a fresh global environment.
+func NewInterpreter(opts Options) *Interpreter {
+	defaults := DefaultOptions()
+	if opts.Stdin == nil {
+		opts.Stdin = defaults.Stdin
+	}
+	if opts.Stdout == nil {
+		opts.Stdout = defaults.Stdout
+	}
+	if opts.Stderr == nil {
+		opts.Stderr = defaults.Stderr
+	}
+	if opts.Resolver == nil {
+		opts.Resolver = defaults.Resolver
+	}
+
+	it := &Interpreter{
+		Options:     opts,
+		sources:     map[string][]string{},
+		types:       map[string]*ast.TypeExpr{},
+		modules:     map[string]map[string]RuntimeVal{},
+		hostGlobals: map[string]RuntimeVal{},
+	}
+	it.builtins = it.makeBuiltins()
+	it.Globals = it.makeGlobals()
+	return it
+}
+
+// RunString parses and evaluates source in the interpreter's globals and
+// returns the value of the last statement.
+func (it *Interpreter) RunString(source string) (RuntimeVal, error) {
+	return it.RunStringContext(context.Background(), source)
+}
+
+// RunStringContext is RunString that stops with an error wrapping
+// ctx.Err() once ctx is cancelled or its deadline passes.
+func (it *Interpreter) RunStringContext(ctx context.Context, source string) (RuntimeVal, error) {
+	return it.runSource(ctx, "<input>", source)
+}
+
+// runSource runs source as if it was read from file, which is what its
+// traceback frames are labelled with.
+func (it *Interpreter) runSource(ctx context.Context, file, source string) (RuntimeVal, error) {
+	if runner, ok := it.Options.Engine.(SourceRunner); ok && it.Options.DumpAST == "" {
+		it.SetSource(file, source)
+		return it.Execute(ctx, file, func() (RuntimeVal, error) {
+			return runner.RunSource(it, file, source)
+		})
+	}
+
+	program, err := FE.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	if it.Options.DumpAST != "" {
+		if err := it.dumpAST(program); err != nil {
+			return nil, err
+		}
+	}
+
+	if program, err = it.Optimize(program); err != nil {
+		return nil, err
+	}
+
+	it.SetSource(file, source)
+	return it.run(ctx, file, program)
+}
+
+// RunFile loads a file through the configured resolver and runs it.
+func (it *Interpreter) RunFile(filePath string) (RuntimeVal, error) {
+	return it.RunFileContext(context.Background(), filePath)
+}
+
+// RunFileContext is RunFile with cancellation, see RunStringContext.
+func (it *Interpreter) RunFileContext(ctx context.Context, filePath string) (RuntimeVal, error) {
+	path, err := it.Options.Resolver.Resolve("", filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve file: %w", err)
+	}
+
 	// Read the file contents
-	content, err := os.ReadFile(filePath)
+	content, err := it.Options.Resolver.Load(path)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
 
-	// Tokenize and parse
-	tokens := FE.Tokenize(string(content))
-	ast := FE.ProduceAST(tokens)
+	// Its imports are resolved from it
+	importing, root := it.importing, it.root
+	it.importing, it.root = []string{path}, projectRoot(filepath.Dir(path))
+	defer func() { it.importing, it.root = importing, root }()
+	return it.runSource(ctx, filePath, string(content))
+}
+
+// Eval evaluates an already parsed node in the interpreter's globals.
+func (it *Interpreter) Eval(node ast.ASTNode) (RuntimeVal, error) {
+	return it.EvalContext(context.Background(), node)
+}
 
-	// Create environment and evaluate
-	env := MakeEnvironment()
-	result := Evaluate(ast, env)
+// EvalContext is Eval with cancellation, see RunStringContext.
+func (it *Interpreter) EvalContext(ctx context.Context, node ast.ASTNode) (RuntimeVal, error) {
+	return it.run(ctx, "<input>", node)
+}
+
+// run resolves node, which fails for variables that are undeclared or used
+// before their declaration, and runs it.
+func (it *Interpreter) run(ctx context.Context, file string, node ast.ASTNode) (RuntimeVal, error) {
+	program, isProgram := node.(ast.Program)
+	if !isProgram {
+		program = ast.Program{Body: []ast.ASTNode{node}}
+	}
+	program, err := it.Resolve(program)
+	if err != nil {
+		return nil, err
+	}
+
+	return it.Execute(ctx, file, func() (RuntimeVal, error) {
+		if it.Options.Engine != nil {
+			return it.Options.Engine.Run(it, file, program)
+		}
+		if !isProgram {
+			return it.evaluate(program.Body[0], it.Globals), nil
+		}
+		return it.evaluate(program, it.Globals), nil
+	})
+}
+
+// Execute runs top-level code from file: it resets the run's context and
+// limits, and returns runtime errors with their traceback. It is for
+// engines running code the interpreter did not load itself, such as
+// precompiled bytecode.
+func (it *Interpreter) Execute(ctx context.Context, file string, run func() (RuntimeVal, error)) (result RuntimeVal, err error) {
+	defer recoverRuntimeError(&err)
+	it.reset(ctx, file)
+	defer func() {
+		if r := recover(); r != nil {
+			it.traceError(r)
+			panic(r)
+		}
+	}()
+
+	return run()
+}
+
+// SetSource records the text of file, which tracebacks quote.
+func (it *Interpreter) SetSource(file, source string) {
+	it.sources[file] = strings.Split(source, "\n")
+}
+
+// Call invokes the global function fnName with already converted arguments.
+func (it *Interpreter) Call(fnName string, args ...RuntimeVal) (RuntimeVal, error) {
+	return it.CallContext(context.Background(), fnName, args...)
+}
+
+// CallContext is Call with cancellation, see RunStringContext.
+func (it *Interpreter) CallContext(ctx context.Context, fnName string, args ...RuntimeVal) (result RuntimeVal, err error) {
+	defer recoverRuntimeError(&err)
+	it.reset(ctx, "")
+
+	fn := it.Globals.GetVar(fnName)
+	return it.callFunction(fn, args, it.Globals), nil
+}
+
+// CallValue invokes a function value with the interpreter's globals as the
+// calling scope. Unlike Call it does not reset the run's context and limit
+// counters, so natives can use it to call back into Popcorn code mid-run.
+func (it *Interpreter) CallValue(fn RuntimeVal, args ...RuntimeVal) (result RuntimeVal, err error) {
+	defer recoverRuntimeError(&err)
+
+	return it.callFunction(fn, args, it.Globals), nil
+}
+
+// SetGlobal declares name in the global scope, or reassigns it if it is
+// already a global variable. Modules imported from then on see it too.
+func (it *Interpreter) SetGlobal(name string, val RuntimeVal) (err error) {
+	defer recoverRuntimeError(&err)
+
+	if _, exists := it.Globals.Variables[name]; exists {
+		it.Globals.AssignVar(name, val)
+	} else {
+		it.Globals.DeclareVar(name, false, val)
+	}
+	it.hostGlobals[name] = val
+	return nil
+}
+
+// Context returns the context of the current run. Natives that block, for
+// example on I/O, should give up when it is done.
+func (it *Interpreter) Context() context.Context {
+	if it.ctx == nil {
+		return context.Background()
+	}
+	return it.ctx
+}
+
+// reset starts a run of top-level code from file, or of a call from the
+// host if file is empty.
+func (it *Interpreter) reset(ctx context.Context, file string) {
+	it.ctx = ctx
+	it.steps = 0
+	it.depth = 0
+	it.allocated = 0
+	it.frames = it.frames[:0]
+	if file != "" {
+		it.frames = append(it.frames, Frame{Name: "<module>", File: file})
+	}
+}
+
+func (it *Interpreter) dumpAST(program ast.Program) error {
+	file, err := os.Create(it.Options.DumpAST)
+	if err != nil {
+		return fmt.Errorf("failed to dump AST: %w", err)
+	}
+	defer file.Close()
+
+	return FE.WriteASTJSON(program, file)
+}
+
+// RunFile runs a file with the default options and prints its final value.
+func RunFile(filePath string) error {
+	it := NewInterpreter(DefaultOptions())
+
+	result, err := it.RunFile(filePath)
+	if err != nil {
+		return err
+	}
 
 	// Print the final result
-	fmt.Printf("%+v\n", result)
+	fmt.Fprintln(it.Options.Stdout, Inspect(result, DefaultInspectOptions))
 
 	return nil
 }
@@ -46,7 +298,10 @@ func highlightSyntax(line string) string {
 		return line
 	}
 
-	tokensList := FE.Tokenize(line)
+	tokensList, err := FE.Lex(line)
+	if err != nil {
+		return line
+	}
 	var highlighted strings.Builder
 	lastEnd := 0
 
@@ -87,32 +342,54 @@ func highlightSyntax(line string) string {
 	return highlighted.String()
 }
 
-func printHeader() {
-    fmt.Println("\033[1;35m╔══════════════════════════════════════════════════════════╗\033[0m")
-    fmt.Println("\033[1;35m║\033[0m          🍿 \033[1;36mPopcorn Language REPL\033[0m 🍿           \033[1;35m║\033[0m")
-    fmt.Println("\033[1;35m╠══════════════════════════════════════════════════════════╣\033[0m")
-    fmt.Println("\033[1;35m║\033[0m  \033[0;33mType 'exit' to quit\033[0m                           \033[1;35m║\033[0m")
-    fmt.Println("\033[1;35m║\033[0m  \033[0;33mType 'clear' to clear screen\033[0m                  \033[1;35m║\033[0m")
-    fmt.Println("\033[1;35m║\033[0m  \033[0;33mType 'verbose' for multi-line input (finish with ':send')\033[0m \033[1;35m║\033[0m")
-    fmt.Println("\033[1;35m╚══════════════════════════════════════════════════════════╝\033[0m")
-    fmt.Println()
+func printHeader(w io.Writer) {
+	fmt.Fprintln(w, "\033[1;35m╔══════════════════════════════════════════════════════════╗\033[0m")
+	fmt.Fprintln(w, "\033[1;35m║\033[0m          🍿 \033[1;36mPopcorn Language REPL\033[0m 🍿           \033[1;35m║\033[0m")
+	fmt.Fprintln(w, "\033[1;35m╠══════════════════════════════════════════════════════════╣\033[0m")
+	fmt.Fprintln(w, "\033[1;35m║\033[0m  \033[0;33mType 'exit' to quit\033[0m                           \033[1;35m║\033[0m")
+	fmt.Fprintln(w, "\033[1;35m║\033[0m  \033[0;33mType 'clear' to clear screen\033[0m                  \033[1;35m║\033[0m")
+	fmt.Fprintln(w, "\033[1;35m║\033[0m  \033[0;33mType 'verbose' for multi-line input (finish with ':send')\033[0m \033[1;35m║\033[0m")
+	fmt.Fprintln(w, "\033[1;35m╚══════════════════════════════════════════════════════════╝\033[0m")
+	fmt.Fprintln(w)
 }
 
-func Repl() RuntimeVal {
-	scanner := bufio.NewScanner(os.Stdin)
+// printResult shows a REPL result after a green arrow, or the error in red.
+// Multi-line values are indented to line up with the first line.
+func (it *Interpreter) printResult(res RuntimeVal, err error) {
+	if err != nil {
+		msg := err.Error()
+		var runtimeErr *RuntimeError
+		if errors.As(err, &runtimeErr) {
+			msg = runtimeErr.Traceback()
+		}
+		msg = strings.ReplaceAll(msg, "\n", "\n     ")
+		fmt.Fprintf(it.Options.Stderr, "   \033[1;31m✗ %s\033[0m\n\n", msg)
+		return
+	}
+
+	opts := DefaultInspectOptions
+	opts.Color = true
+	out := strings.ReplaceAll(Inspect(res, opts), "\n", "\n     ")
+	fmt.Fprintf(it.Options.Stdout, "   \033[1;32m←\033[0m %s\n\n", out)
+}
 
-	printHeader()
+// Repl runs an interactive session on the interpreter's Stdin and Stdout.
+// Errors are reported and the session carries on with its state intact.
+func (it *Interpreter) Repl() {
+	scanner := bufio.NewScanner(it.Options.Stdin)
+	out := it.Options.Stdout
+
+	printHeader(out)
 
-	env := MakeEnvironment()
 	verboseMode := false
 	var verboseBuffer strings.Builder
 
 	for {
 		if !verboseMode {
 			// Cyan prompt
-			fmt.Print("🍿 \033[1;36m>>\033[0m ")
+			fmt.Fprint(out, "🍿 \033[1;36m>>\033[0m ")
 		} else {
-			fmt.Print("🍿 \033[1;33m(v)\033[0m ")
+			fmt.Fprint(out, "🍿 \033[1;33m(v)\033[0m ")
 		}
 
 		if !scanner.Scan() {
@@ -122,18 +399,18 @@ func Repl() RuntimeVal {
 		line := scanner.Text()
 
 		if !verboseMode && line == "exit" {
-			fmt.Println("\033[1;31m👋 Exiting REPL... Enjoy your popcorn!\033[0m")
+			fmt.Fprintln(out, "\033[1;31m👋 Exiting REPL... Enjoy your popcorn!\033[0m")
 			break
 		}
 
 		if !verboseMode && line == "clear" {
-			fmt.Print("\033[2J\033[H")
-			printHeader()
+			fmt.Fprint(out, "\033[2J\033[H")
+			printHeader(out)
 			continue
 		}
 
 		if !verboseMode && line == "verbose" {
-			fmt.Println("\033[1;33m[Verbose mode: Enter multiple lines. Type ':send' on a new line to execute.]\033[0m")
+			fmt.Fprintln(out, "\033[1;33m[Verbose mode: Enter multiple lines. Type ':send' on a new line to execute.]\033[0m")
 			verboseMode = true
 			verboseBuffer.Reset()
 			continue
@@ -145,12 +422,9 @@ func Repl() RuntimeVal {
 				code := verboseBuffer.String()
 				if strings.TrimSpace(code) != "" {
 					highlighted := highlightSyntax(code)
-					fmt.Printf("   \033[2m→\033[0m %s\n", highlighted)
+					fmt.Fprintf(out, "   \033[2m→\033[0m %s\n", highlighted)
 
-					tokensSlice := FE.Tokenize(code)
-					ast := FE.ProduceAST(tokensSlice)
-					res := Evaluate(ast, env)
-					fmt.Printf("   \033[1;32m←\033[0m \033[1;32m%+v\033[0m\n\n", res)
+					it.printResult(it.RunString(code))
 				}
 				verboseMode = false
 				continue
@@ -170,16 +444,15 @@ func Repl() RuntimeVal {
 
 		// Show syntax highlighted version
 		highlighted := highlightSyntax(line)
-		fmt.Printf("   \033[2m→\033[0m %s\n", highlighted)
-
-		tokensSlice := FE.Tokenize(line)
-		ast := FE.ProduceAST(tokensSlice)
-
-		res := Evaluate(ast, env)
+		fmt.Fprintf(out, "   \033[2m→\033[0m %s\n", highlighted)
 
 		// Green output with arrow
-		fmt.Printf("   \033[1;32m←\033[0m \033[1;32m%+v\033[0m\n\n", res)
+		it.printResult(it.RunString(line))
 	}
+}
 
+// Repl starts an interactive session with the default options.
+func Repl() RuntimeVal {
+	NewInterpreter(DefaultOptions()).Repl()
 	return Null
 }
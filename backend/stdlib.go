@@ -0,0 +1,250 @@
+package backend
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// makeStdlib returns the built-in objects that reach outside the script.
+// Every native checks Options.Permissions first, so with the default zero
+// Permissions they all throw a PermissionError.
+func (it *Interpreter) makeStdlib() map[string]RuntimeVal {
+	return map[string]RuntimeVal{
+		"fs": namespace(
+			method("fs.read", 1, it.fsRead),
+			method("fs.write", 2, it.fsWrite),
+			method("fs.exists", 1, it.fsExists),
+			method("fs.list", 1, it.fsList),
+		),
+		"env": namespace(
+			method("env.get", 1, it.envGet),
+		),
+		"clock": namespace(
+			method("clock.now", 0, it.clockNow),
+		),
+		"random": namespace(
+			method("random.float", 0, it.randomFloat),
+			method("random.int", 1, it.randomInt),
+		),
+		"process": namespace(
+			method("process.run", 2, it.processRun),
+		),
+		"net": namespace(
+			method("net.fetch", 1, it.netFetch),
+		),
+	}
+}
+
+// namespace groups natives into an object, keyed by the last part of their
+// qualified name.
+func namespace(natives ...*NativeFunctionVal) *ObjectVal {
+	obj := &ObjectVal{Properties: make(map[string]RuntimeVal, len(natives))}
+	for _, native := range natives {
+		name := native.Name[strings.LastIndexByte(native.Name, '.')+1:]
+		obj.Properties[name] = native
+	}
+	return obj
+}
+
+// fs.read(path) returns the contents of a file as a string.
+func (it *Interpreter) fsRead(args []RuntimeVal) RuntimeVal {
+	path := stringArg("fs.read", args, 0)
+	it.Require(CapRead, path)
+
+	file, err := os.Open(path)
+	if err != nil {
+		Throw(fmt.Errorf("fs.read: %w", err))
+	}
+	defer file.Close()
+	size := int64(-1)
+	if info, err := file.Stat(); err == nil && info.Mode().IsRegular() {
+		size = info.Size()
+	}
+
+	text, err := it.readString(file, size)
+	if err != nil {
+		Throw(fmt.Errorf("fs.read: %w", err))
+	}
+	return StringVal{Value: text}
+}
+
+// fs.write(path, text) creates or replaces a file.
+func (it *Interpreter) fsWrite(args []RuntimeVal) RuntimeVal {
+	path := stringArg("fs.write", args, 0)
+	text := stringArg("fs.write", args, 1)
+	it.Require(CapWrite, path)
+
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		Throw(fmt.Errorf("fs.write: %w", err))
+	}
+	return Null
+}
+
+// fs.exists(path) reports whether a file or directory exists.
+func (it *Interpreter) fsExists(args []RuntimeVal) RuntimeVal {
+	path := stringArg("fs.exists", args, 0)
+	it.Require(CapRead, path)
+
+	_, err := os.Stat(path)
+	return BoolValue{Value: err == nil}
+}
+
+// fs.list(dir) returns the sorted names of the entries in a directory.
+func (it *Interpreter) fsList(args []RuntimeVal) RuntimeVal {
+	dir := stringArg("fs.list", args, 0)
+	it.Require(CapRead, dir)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		Throw(fmt.Errorf("fs.list: %w", err))
+	}
+
+	it.allocArray(len(entries))
+	names := make([]RuntimeVal, len(entries))
+	for i, entry := range entries {
+		names[i] = StringVal{Value: entry.Name()}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return names[i].(StringVal).Value < names[j].(StringVal).Value
+	})
+	return &ArrayVal{Elements: names}
+}
+
+// env.get(name) returns an environment variable, or null if it is unset.
+func (it *Interpreter) envGet(args []RuntimeVal) RuntimeVal {
+	name := stringArg("env.get", args, 0)
+	it.Require(CapEnv, name)
+
+	val, ok := os.LookupEnv(name)
+	if !ok {
+		return Null
+	}
+	return StringVal{Value: val}
+}
+
+// clock.now() returns the current time in milliseconds since the Unix epoch.
+func (it *Interpreter) clockNow(args []RuntimeVal) RuntimeVal {
+	it.Require(CapClock, "")
+	return NumberVal{Value: float64(time.Now().UnixMilli())}
+}
+
+// random.float() returns a number in [0, 1).
+func (it *Interpreter) randomFloat(args []RuntimeVal) RuntimeVal {
+	it.Require(CapRandom, "")
+	return NumberVal{Value: rand.Float64()}
+}
+
+// random.int(n) returns a whole number in [0, n).
+func (it *Interpreter) randomInt(args []RuntimeVal) RuntimeVal {
+	it.Require(CapRandom, "")
+
+	n, ok := args[0].(NumberVal)
+	if !ok || n.Value < 1 || n.Value != float64(int64(n.Value)) {
+		runtimeError("random.int expects a positive whole number, got: %s", Inspect(args[0], DefaultInspectOptions))
+	}
+	return NumberVal{Value: float64(rand.Int64N(int64(n.Value)))}
+}
+
+// process.run(program, args) runs a program to completion and returns
+// { code, stdout, stderr }. It is killed if the run's context is cancelled.
+func (it *Interpreter) processRun(args []RuntimeVal) RuntimeVal {
+	program := stringArg("process.run", args, 0)
+	argList, ok := args[1].(*ArrayVal)
+	if !ok {
+		runtimeError("process.run expects an array of arguments, got: %s", Inspect(args[1], DefaultInspectOptions))
+	}
+	it.Require(CapRun, program)
+
+	cmdArgs := make([]string, len(argList.Elements))
+	for i := range argList.Elements {
+		cmdArgs[i] = stringArg("process.run", argList.Elements, i)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(it.Context(), program, cmdArgs...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	code := 0
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			Throw(fmt.Errorf("process.run: %w", err))
+		}
+		code = exitErr.ExitCode()
+	}
+
+	it.allocObject(3)
+	it.allocString(stdout.Len() + stderr.Len())
+	return &ObjectVal{Properties: map[string]RuntimeVal{
+		"code":   NumberVal{Value: float64(code)},
+		"stdout": StringVal{Value: stdout.String()},
+		"stderr": StringVal{Value: stderr.String()},
+	}}
+}
+
+// net.fetch(url) makes a GET request and returns { status, body }.
+func (it *Interpreter) netFetch(args []RuntimeVal) RuntimeVal {
+	rawURL := stringArg("net.fetch", args, 0)
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		runtimeError("net.fetch expects an http or https URL, got: %q", rawURL)
+	}
+	it.Require(CapNet, u.Host)
+
+	req, err := http.NewRequestWithContext(it.Context(), http.MethodGet, u.String(), nil)
+	if err != nil {
+		Throw(fmt.Errorf("net.fetch: %w", err))
+	}
+	// Redirects must not lead somewhere the script has no grant for
+	deniedHost := ""
+	client := &http.Client{CheckRedirect: func(next *http.Request, via []*http.Request) error {
+		if !it.Options.Permissions.Allows(CapNet, next.URL.Host) {
+			deniedHost = next.URL.Host
+			return http.ErrUseLastResponse
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		Throw(fmt.Errorf("net.fetch: %w", err))
+	}
+	defer resp.Body.Close()
+	if deniedHost != "" {
+		it.Require(CapNet, deniedHost)
+	}
+
+	body, err := it.readString(resp.Body, resp.ContentLength)
+	if err != nil {
+		Throw(fmt.Errorf("net.fetch: %w", err))
+	}
+
+	it.allocObject(2)
+	return &ObjectVal{Properties: map[string]RuntimeVal{
+		"status": NumberVal{Value: float64(resp.StatusCode)},
+		"body":   StringVal{Value: body},
+	}}
+}
+
+// stringArg returns args[i] as a Go string or raises a runtime error naming
+// the native that expected it.
+func stringArg(fnName string, args []RuntimeVal, i int) string {
+	s, ok := args[i].(StringVal)
+	if !ok {
+		runtimeError("%s expects a string as argument %d, got: %s", fnName, i+1, Inspect(args[i], DefaultInspectOptions))
+	}
+	return s.Value
+}
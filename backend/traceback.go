@@ -0,0 +1,215 @@
+package backend
+
+import (
+	"fmt"
+	"pop/frontend/types/ast"
+	"strings"
+)
+
+// Frame is one entry of a Popcorn call stack: the module being run, a
+// Popcorn function or a native.
+type Frame struct {
+	// Name is the function's name, "<module>" for top-level code,
+	// "<anonymous>" for unnamed functions or "<native fs.read>" for natives
+	Name string
+	// File is where the function was declared, e.g. "main.pop" or "<input>"
+	File string
+	// Line and Column locate the expression the frame was evaluating when
+	// the error was raised, both 1-based. They are 0 for natives.
+	Line, Column int
+	// Source is the text of that line, if the source is known
+	Source string
+	// Params and Args are what the function was called with. Natives have
+	// no parameter names, only arguments.
+	Params []string
+	Args   []RuntimeVal
+	Native bool
+}
+
+const (
+	// tracebackRepeats is how often a frame that repeats, as in unbounded
+	// recursion, is printed before the rest are summarised
+	tracebackRepeats = 3
+	// tracebackMaxFrames caps a printed traceback; the oldest and the most
+	// recent frames are kept
+	tracebackMaxFrames = 60
+	// tracebackArgWidth is how much of each argument's rendering is printed
+	tracebackArgWidth = 40
+)
+
+// PushFrame adds a frame to the call stack tracebacks are made of.
+func (it *Interpreter) PushFrame(frame Frame) {
+	it.frames = append(it.frames, frame)
+}
+
+// file is the file the current frame's code comes from.
+func (it *Interpreter) file() string {
+	if len(it.frames) == 0 {
+		return ""
+	}
+	return it.frames[len(it.frames)-1].File
+}
+
+// PopFrame removes the most recent frame.
+func (it *Interpreter) PopFrame() {
+	it.frames = it.frames[:len(it.frames)-1]
+}
+
+// at records that the current frame is evaluating the node at pos.
+func (it *Interpreter) at(pos ast.Position) {
+	if pos.IsValid() && len(it.frames) > 0 {
+		top := &it.frames[len(it.frames)-1]
+		top.Line, top.Column = pos.Line, pos.Column
+	}
+}
+
+// traceError attaches the current call stack to a RuntimeError panic that
+// does not have one yet. Call it deferred, before the frame is popped.
+func (it *Interpreter) traceError(r any) {
+	if runtimeErr, ok := r.(*RuntimeError); ok && runtimeErr.Trace == nil {
+		trace := it.snapshotFrames()
+		if runtimeErr.atCall && len(trace) > 1 {
+			trace = trace[:len(trace)-1]
+		}
+		runtimeErr.Trace = trace
+	}
+}
+
+// snapshotFrames copies the call stack, oldest frame first, filling in the
+// source line of each frame.
+func (it *Interpreter) snapshotFrames() []Frame {
+	trace := make([]Frame, len(it.frames))
+	copy(trace, it.frames)
+	for i := range trace {
+		trace[i].Source = it.sourceLine(trace[i].File, trace[i].Line)
+	}
+	return trace
+}
+
+func (it *Interpreter) sourceLine(file string, line int) string {
+	lines := it.sources[file]
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return strings.TrimSpace(lines[line-1])
+}
+
+// frameName is how a function shows up in a traceback.
+func frameName(fn RuntimeVal) string {
+	switch fn := fn.(type) {
+	case *NativeFunctionVal:
+		return "<native " + fn.Name + ">"
+	case *FunctionVal:
+		if fn.Name == "" || fn.Name == "anonymous" {
+			return "<anonymous>"
+		}
+		return fn.Name
+	}
+	return "<unknown>"
+}
+
+// Traceback renders the error the way the popcorn command prints it: the
+// call stack, most recent call last, followed by the error itself.
+//
+//	Traceback (most recent call last):
+//	  File "main.pop", line 7, in <module>
+//	    divide(1, 0)
+//	  File "main.pop", line 3, in divide(a = 1, b = 0)
+//	    throw "cannot divide by zero"
+//	Error: cannot divide by zero
+//
+// Frames that repeat, as in runaway recursion, are collapsed. Without a
+// trace, for example for errors raised outside of a run, it is just the
+// last line.
+func (e *RuntimeError) Traceback() string {
+	var b strings.Builder
+	if len(e.Trace) > 0 {
+		b.WriteString("Traceback (most recent call last):\n")
+		writeFrames(&b, e.Trace)
+	}
+
+	name := e.Name
+	if name == "" {
+		name = "Error"
+	}
+	fmt.Fprintf(&b, "%s: %s", name, e.Message)
+	return b.String()
+}
+
+func writeFrames(b *strings.Builder, trace []Frame) {
+	lines := collapseFrames(trace)
+
+	if len(lines) > tracebackMaxFrames {
+		half := tracebackMaxFrames / 2
+		omitted := len(lines) - 2*half
+		lines = append(append(lines[:half:half], fmt.Sprintf("  [... %d more lines ...]\n", omitted)), lines[len(lines)-half:]...)
+	}
+
+	for _, line := range lines {
+		b.WriteString(line)
+	}
+}
+
+// collapseFrames formats each frame, printing a run of frames at the same
+// place at most tracebackRepeats times.
+func collapseFrames(trace []Frame) []string {
+	var lines []string
+	for i := 0; i < len(trace); {
+		j := i + 1
+		for j < len(trace) && sameCallSite(trace[i], trace[j]) {
+			j++
+		}
+
+		shown := min(j-i, tracebackRepeats)
+		for k := i; k < i+shown; k++ {
+			lines = append(lines, formatFrame(trace[k]))
+		}
+		if rest := j - i - shown; rest > 0 {
+			lines = append(lines, fmt.Sprintf("  [Previous frame repeated %d more times]\n", rest))
+		}
+		i = j
+	}
+	return lines
+}
+
+func sameCallSite(a, b Frame) bool {
+	return a.Name == b.Name && a.File == b.File && a.Line == b.Line && a.Column == b.Column
+}
+
+func formatFrame(f Frame) string {
+	if f.Native {
+		return fmt.Sprintf("  in %s(%s)\n", f.Name, formatArgs(f))
+	}
+
+	call := f.Name
+	if f.Name != "<module>" {
+		call += "(" + formatArgs(f) + ")"
+	}
+	out := fmt.Sprintf("  File %q, line %d, in %s\n", f.File, f.Line, call)
+	if f.Source != "" {
+		out += "    " + f.Source + "\n"
+	}
+	return out
+}
+
+// formatArgs renders `a = 1, b = "x"` for Popcorn functions and the bare
+// values for natives, shortening long values.
+func formatArgs(f Frame) string {
+	opts := DefaultInspectOptions
+	opts.MaxDepth = 1
+	opts.MaxItems = 5
+	opts.Width = 1 << 20 // keep every argument on one line
+
+	parts := make([]string, 0, len(f.Args))
+	for i, arg := range f.Args {
+		text := Inspect(arg, opts)
+		if runes := []rune(text); len(runes) > tracebackArgWidth {
+			text = string(runes[:tracebackArgWidth-3]) + "..."
+		}
+		if !f.Native && i < len(f.Params) {
+			text = f.Params[i] + " = " + text
+		}
+		parts = append(parts, text)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -1,6 +1,12 @@
 package backend
 
 import (
+	"hash/fnv"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+
 	"pop/frontend/types/ast"
 )
 
@@ -16,6 +22,8 @@ const (
 	FunctionType
 	ReturnType
 	ArrayType
+	MapType
+	SetType
 )
 
 type RuntimeVal any
@@ -30,6 +38,8 @@ func GetValType(val RuntimeVal) ValueType {
 		return BooleanType
 	case NumberVal, *NumberVal:
 		return NumberType
+	case StringVal, *StringVal:
+		return StringType
 	case ObjectVal, *ObjectVal:
 		return ObjectType
 	case NativeFunctionVal, *NativeFunctionVal:
@@ -40,6 +50,10 @@ func GetValType(val RuntimeVal) ValueType {
 		return ReturnType
 	case ArrayVal, *ArrayVal:
 		return ArrayType
+	case MapVal, *MapVal:
+		return MapType
+	case SetVal, *SetVal:
+		return SetType
 	default:
 		return -1
 	}
@@ -57,6 +71,8 @@ type NumberVal struct {
 	Value float64
 }
 
+// ObjectVal is a reference value: the interpreter always hands out *ObjectVal
+// so that two variables can share (and be identical to) the same object.
 type ObjectVal struct {
 	Properties map[string]RuntimeVal
 }
@@ -64,7 +80,11 @@ type ObjectVal struct {
 type FunctionCall func(args []RuntimeVal, env *Environment) RuntimeVal
 
 type NativeFunctionVal struct {
+	Name string
 	Call FunctionCall
+	// internal natives are part of how the interpreter runs programs, such
+	// as the check native, and get no frame in tracebacks
+	internal bool
 }
 
 type FunctionVal struct {
@@ -72,16 +92,463 @@ type FunctionVal struct {
 	Params         []string
 	DeclarationEnv *Environment
 	Body           []ast.ASTNode
+	// Scope lays out the slots of a call if the function was resolved
+	Scope *ast.Scope
+	// File and Pos locate the declaration, for tracebacks
+	File string
+	Pos  ast.Position
+	// Compiled is set, instead of DeclarationEnv and Body, for functions
+	// an Engine compiled. Calls from natives and the host go through it.
+	Compiled CompiledFunction
 }
 
 type ReturnVal struct {
 	Value RuntimeVal
 }
 
+// ArrayVal is a reference value, see ObjectVal.
 type ArrayVal struct {
 	Elements []RuntimeVal
 }
 
 type StringVal struct {
 	Value string
-}
\ No newline at end of file
+}
+
+// MapVal is a hash map keyed by any runtime value, see ValueMap.
+type MapVal struct {
+	Entries *ValueMap
+}
+
+// SetVal is a hash set of runtime values. Only the keys of Entries are used.
+type SetVal struct {
+	Entries *ValueMap
+}
+
+// * ======== VALUE PROTOCOL ======== * \\
+//
+// Every runtime value supports four operations, and everything that needs to
+// compare values (`==`, `is`, `sort`, Map/Set keys, test assertions) must go
+// through them rather than inspecting values directly:
+//
+//   - Equals:    structural deep equality (`==`)
+//   - Identical: reference identity (`is`)
+//   - Compare:   a total ordering over all values, including mixed types
+//   - Hash:      a hash consistent with Equals and SameValueZero
+//
+// Arrays, objects, maps and sets are compared by content, functions by
+// identity. All four operations terminate on cyclic structures.
+
+// valuePair is used to remember which pairs of containers are currently being
+// compared so that cycles are not followed forever.
+type valuePair struct {
+	left, right RuntimeVal
+}
+
+// Equals reports whether a and b are structurally equal. Primitives are equal
+// when they have the same type and value, containers when all of their
+// elements are equal, and functions only when they are Identical.
+func Equals(a, b RuntimeVal) bool {
+	return deepEquals(a, b, map[valuePair]bool{}, false)
+}
+
+// SameValueZero is Equals except that NaN equals NaN, anywhere in a and b.
+// Map and Set keys are matched with it, so a NaN key can be found again.
+func SameValueZero(a, b RuntimeVal) bool {
+	return deepEquals(a, b, map[valuePair]bool{}, true)
+}
+
+func deepEquals(a, b RuntimeVal, seen map[valuePair]bool, nanEqual bool) bool {
+	if isContainer(a) && isContainer(b) {
+		if Identical(a, b) {
+			return true
+		}
+		pair := valuePair{a, b}
+		// A pair we are already comparing further up the stack is assumed
+		// equal; if it is not, the comparison in progress will say so.
+		if seen[pair] {
+			return true
+		}
+		seen[pair] = true
+	}
+
+	switch l := a.(type) {
+	case NullValue:
+		_, ok := b.(NullValue)
+		return ok
+	case BoolValue:
+		r, ok := b.(BoolValue)
+		return ok && l.Value == r.Value
+	case NumberVal:
+		r, ok := b.(NumberVal)
+		if ok && nanEqual && math.IsNaN(l.Value) {
+			return math.IsNaN(r.Value)
+		}
+		return ok && l.Value == r.Value
+	case StringVal:
+		r, ok := b.(StringVal)
+		return ok && l.Value == r.Value
+	case *ArrayVal:
+		r, ok := b.(*ArrayVal)
+		if !ok || len(l.Elements) != len(r.Elements) {
+			return false
+		}
+		for i := range l.Elements {
+			if !deepEquals(l.Elements[i], r.Elements[i], seen, nanEqual) {
+				return false
+			}
+		}
+		return true
+	case *ObjectVal:
+		r, ok := b.(*ObjectVal)
+		if !ok || len(l.Properties) != len(r.Properties) {
+			return false
+		}
+		for key, lv := range l.Properties {
+			rv, exists := r.Properties[key]
+			if !exists || !deepEquals(lv, rv, seen, nanEqual) {
+				return false
+			}
+		}
+		return true
+	case *MapVal:
+		r, ok := b.(*MapVal)
+		if !ok || l.Entries.Len() != r.Entries.Len() {
+			return false
+		}
+		for _, entry := range l.Entries.Entries() {
+			rv, exists := r.Entries.Get(entry.Key)
+			if !exists || !deepEquals(entry.Value, rv, seen, nanEqual) {
+				return false
+			}
+		}
+		return true
+	case *SetVal:
+		r, ok := b.(*SetVal)
+		if !ok || l.Entries.Len() != r.Entries.Len() {
+			return false
+		}
+		for _, entry := range l.Entries.Entries() {
+			if !r.Entries.Has(entry.Key) {
+				return false
+			}
+		}
+		return true
+	default:
+		return isReference(a) && Identical(a, b)
+	}
+}
+
+// Identical reports whether a and b are the same value. Containers and
+// functions are identical only when they are the same reference; primitives
+// are identical when they are equal.
+func Identical(a, b RuntimeVal) bool {
+	if !isReference(a) || !isReference(b) {
+		if isReference(a) || isReference(b) {
+			return false
+		}
+		return deepEquals(a, b, nil, false)
+	}
+	return reflect.TypeOf(a) == reflect.TypeOf(b) && reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+}
+
+// Compare returns -1, 0 or 1 depending on whether a sorts before, together
+// with, or after b. Values of different types are ordered by type:
+// null < booleans < numbers < strings < arrays < objects < maps < sets < functions.
+// NaN sorts before every other number.
+func Compare(a, b RuntimeVal) int {
+	return compareValues(a, b, map[valuePair]bool{})
+}
+
+func compareValues(a, b RuntimeVal, seen map[valuePair]bool) int {
+	if ra, rb := typeRank(a), typeRank(b); ra != rb {
+		return compareInts(ra, rb)
+	}
+
+	if isContainer(a) {
+		pair := valuePair{a, b}
+		if Identical(a, b) || seen[pair] {
+			return 0
+		}
+		seen[pair] = true
+	}
+
+	switch l := a.(type) {
+	case BoolValue:
+		r := b.(BoolValue)
+		if l.Value == r.Value {
+			return 0
+		}
+		if !l.Value {
+			return -1
+		}
+		return 1
+	case NumberVal:
+		return compareNumbers(l.Value, b.(NumberVal).Value)
+	case StringVal:
+		return strings.Compare(l.Value, b.(StringVal).Value)
+	case *ArrayVal:
+		return compareSequences(l.Elements, b.(*ArrayVal).Elements, seen)
+	case *ObjectVal:
+		r := b.(*ObjectVal)
+		lKeys, rKeys := sortedKeys(l.Properties), sortedKeys(r.Properties)
+		for i := 0; i < len(lKeys) && i < len(rKeys); i++ {
+			if c := strings.Compare(lKeys[i], rKeys[i]); c != 0 {
+				return c
+			}
+			if c := compareValues(l.Properties[lKeys[i]], r.Properties[rKeys[i]], seen); c != 0 {
+				return c
+			}
+		}
+		return compareInts(len(lKeys), len(rKeys))
+	case *MapVal:
+		return compareSequences(sortedMapItems(l.Entries), sortedMapItems(b.(*MapVal).Entries), seen)
+	case *SetVal:
+		return compareSequences(l.Entries.SortedKeys(), b.(*SetVal).Entries.SortedKeys(), seen)
+	case *FunctionVal, *NativeFunctionVal:
+		if c := strings.Compare(functionName(a), functionName(b)); c != 0 {
+			return c
+		}
+		// Distinct functions with the same name have no natural order, so
+		// fall back to their addresses to keep the ordering total.
+		return compareInts(int(reflect.ValueOf(a).Pointer()), int(reflect.ValueOf(b).Pointer()))
+	default:
+		return 0
+	}
+}
+
+// hashDepth is how many levels of nested containers Hash looks into.
+// Containers below that only add their type and size, so a cyclic value
+// hashes the same however Equals pairs up its cycles, and hashing one
+// stops.
+const hashDepth = 2
+
+// Hash returns a hash of v such that Equals(a, b), or SameValueZero(a, b),
+// implies Hash(a) == Hash(b).
+// Primitive and container hashes are stable across runs; function hashes are
+// derived from their identity and only stable for the lifetime of the value.
+func Hash(v RuntimeVal) uint64 {
+	return hashValue(v, 0)
+}
+
+func hashValue(v RuntimeVal, depth int) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte{byte(typeRank(v))})
+
+	if isContainer(v) && depth >= hashDepth {
+		writeUint64(h, uint64(containerSize(v)))
+		return h.Sum64()
+	}
+	depth++
+
+	switch val := v.(type) {
+	case BoolValue:
+		if val.Value {
+			h.Write([]byte{1})
+		}
+	case NumberVal:
+		n := val.Value
+		if n == 0 {
+			n = 0 // -0 == 0, so they must hash alike
+		}
+		if math.IsNaN(n) {
+			n = math.NaN()
+		}
+		writeUint64(h, math.Float64bits(n))
+	case StringVal:
+		h.Write([]byte(val.Value))
+	case *ArrayVal:
+		for _, elem := range val.Elements {
+			writeUint64(h, hashValue(elem, depth))
+		}
+	case *ObjectVal:
+		// Property order is not significant, so combine entries commutatively
+		var sum uint64
+		for key, prop := range val.Properties {
+			sum += hashString(key)*31 + hashValue(prop, depth)
+		}
+		writeUint64(h, sum)
+	case *MapVal:
+		var sum uint64
+		for _, entry := range val.Entries.Entries() {
+			sum += hashValue(entry.Key, depth)*31 + hashValue(entry.Value, depth)
+		}
+		writeUint64(h, sum)
+	case *SetVal:
+		var sum uint64
+		for _, entry := range val.Entries.Entries() {
+			sum += hashValue(entry.Key, depth)
+		}
+		writeUint64(h, sum)
+	case *FunctionVal, *NativeFunctionVal:
+		writeUint64(h, uint64(reflect.ValueOf(val).Pointer()))
+	}
+
+	return h.Sum64()
+}
+
+// * ======== TRUTHINESS ======== * \\
+
+// IsTruthy reports whether v counts as true in a condition. null, false, 0,
+// "" and empty arrays, objects, maps and sets are falsy; everything else,
+// including functions, is truthy.
+func IsTruthy(v RuntimeVal) bool {
+	switch val := v.(type) {
+	case nil, NullValue:
+		return false
+	case BoolValue:
+		return val.Value
+	case NumberVal:
+		return val.Value != 0
+	case StringVal:
+		return val.Value != ""
+	case *ArrayVal:
+		return len(val.Elements) > 0
+	case *ObjectVal:
+		return len(val.Properties) > 0
+	case *MapVal:
+		return val.Entries.Len() > 0
+	case *SetVal:
+		return val.Entries.Len() > 0
+	}
+	return true
+}
+
+// * ======== PROTOCOL HELPERS ======== * \\
+
+func isReference(v RuntimeVal) bool {
+	switch v.(type) {
+	case *ArrayVal, *ObjectVal, *MapVal, *SetVal, *FunctionVal, *NativeFunctionVal:
+		return true
+	}
+	return false
+}
+
+func isContainer(v RuntimeVal) bool {
+	switch v.(type) {
+	case *ArrayVal, *ObjectVal, *MapVal, *SetVal:
+		return true
+	}
+	return false
+}
+
+// containerSize is the number of elements, properties or entries of a
+// container.
+func containerSize(v RuntimeVal) int {
+	switch val := v.(type) {
+	case *ArrayVal:
+		return len(val.Elements)
+	case *ObjectVal:
+		return len(val.Properties)
+	case *MapVal:
+		return val.Entries.Len()
+	case *SetVal:
+		return val.Entries.Len()
+	}
+	return 0
+}
+
+func typeRank(v RuntimeVal) int {
+	switch v.(type) {
+	case NullValue:
+		return 0
+	case BoolValue:
+		return 1
+	case NumberVal:
+		return 2
+	case StringVal:
+		return 3
+	case *ArrayVal:
+		return 4
+	case *ObjectVal:
+		return 5
+	case *MapVal:
+		return 6
+	case *SetVal:
+		return 7
+	case *FunctionVal, *NativeFunctionVal:
+		return 8
+	default:
+		return 9
+	}
+}
+
+func functionName(v RuntimeVal) string {
+	switch fn := v.(type) {
+	case *FunctionVal:
+		return fn.Name
+	case *NativeFunctionVal:
+		return fn.Name
+	}
+	return ""
+}
+
+func compareInts(a, b int) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+func compareNumbers(a, b float64) int {
+	aNaN, bNaN := math.IsNaN(a), math.IsNaN(b)
+	switch {
+	case aNaN && bNaN:
+		return 0
+	case aNaN:
+		return -1
+	case bNaN:
+		return 1
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareSequences(l, r []RuntimeVal, seen map[valuePair]bool) int {
+	for i := 0; i < len(l) && i < len(r); i++ {
+		if c := compareValues(l[i], r[i], seen); c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(l), len(r))
+}
+
+func sortedKeys(props map[string]RuntimeVal) []string {
+	keys := make([]string, 0, len(props))
+	for key := range props {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedMapItems flattens a map into [k1, v1, k2, v2, ...] ordered by key.
+func sortedMapItems(m *ValueMap) []RuntimeVal {
+	keys := m.SortedKeys()
+	items := make([]RuntimeVal, 0, len(keys)*2)
+	for _, key := range keys {
+		val, _ := m.Get(key)
+		items = append(items, key, val)
+	}
+	return items
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+func writeUint64(h interface{ Write([]byte) (int, error) }, n uint64) {
+	var buf [8]byte
+	for i := range buf {
+		buf[i] = byte(n >> (8 * i))
+	}
+	h.Write(buf[:])
+}
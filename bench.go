@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	BE "pop/backend"
+	"pop/bench"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// benchmark times scripts, the benchmark corpus by default, and compares
+// the timings with a baseline.
+func benchmark(opts BE.Options, args []string) int {
+	defaults := bench.DefaultOptions()
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	warmup := flags.Int("warmup", defaults.Warmup, "untimed runs of each script before timing it")
+	iterations := flags.Int("n", defaults.Iterations, "timed runs of each script")
+	baseline := flags.String("baseline", "", "compare with the baseline stored in this file, and fail on regressions")
+	save := flags.String("save", "", "store the results as a baseline in this file")
+	threshold := flags.Float64("threshold", 10, "how many percent slower than the baseline a script may get")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: popcorn [flags] bench [-n runs] [-warmup runs] [-baseline file] [-save file] [file.pop...]\n\nTimes each file, or the built-in corpus if none are given. The engine and\noptimization flags of popcorn apply, and what scripts print is discarded.\n\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	// Accept the flags after the files too
+	flags.Parse(args)
+	var files []string
+	for flags.NArg() > 0 {
+		files = append(files, flags.Arg(0))
+		flags.Parse(flags.Args()[1:])
+	}
+	if *iterations < 1 {
+		fmt.Fprintf(os.Stderr, "Invalid -n: %d, want at least 1 run\n", *iterations)
+		flags.Usage()
+		return 2
+	}
+	if *warmup < 0 {
+		fmt.Fprintf(os.Stderr, "Invalid -warmup: %d, want 0 or more runs\n", *warmup)
+		flags.Usage()
+		return 2
+	}
+
+	scripts := bench.Corpus()
+	if len(files) > 0 {
+		scripts = nil
+		for _, file := range files {
+			source, err := os.ReadFile(file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", file, err)
+				return 1
+			}
+			scripts = append(scripts, bench.Script{Name: strings.TrimSuffix(filepath.Base(file), ".pop"), Source: string(source)})
+		}
+	}
+
+	opts.Stdout = io.Discard
+	var results []bench.Result
+	for _, script := range scripts {
+		result, err := bench.Measure(script.Name, bench.Options{Warmup: *warmup, Iterations: *iterations}, func() error {
+			_, err := BE.NewInterpreter(opts).RunString(script.Source)
+			return err
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error running %s: %v\n", script.Name, err)
+			return 1
+		}
+		results = append(results, result)
+	}
+
+	var comparisons []bench.Comparison
+	if *baseline != "" {
+		base, err := bench.ReadBaseline(*baseline)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading baseline: %v\n", err)
+			return 1
+		}
+		comparisons = bench.Compare(base, results, *threshold/100)
+	}
+	regressions := printResults(os.Stdout, results, comparisons)
+
+	if *save != "" {
+		if err := bench.WriteBaseline(*save, results); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing baseline: %v\n", err)
+			return 1
+		}
+	}
+	if regressions > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d scripts are more than %g%% slower than the baseline\n", regressions, len(results), *threshold)
+		return 1
+	}
+	return 0
+}
+
+// printResults writes a table of the timings, with the baseline if there
+// are comparisons, and returns the number of regressions.
+func printResults(w io.Writer, results []bench.Result, comparisons []bench.Comparison) int {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	header := "script\truns\tmedian\tmean\tmin\tmax\tstddev\t"
+	if comparisons != nil {
+		header += "baseline\tchange\t\t"
+	}
+	fmt.Fprintln(tw, header)
+
+	regressions := 0
+	for i, r := range results {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t±%s\t", r.Name, r.Iterations, round(r.Median), round(r.Mean), round(r.Min), round(r.Max), round(r.StdDev))
+		if comparisons != nil {
+			c := comparisons[i]
+			switch {
+			case c.Baseline == 0:
+				fmt.Fprint(tw, "-\t-\t\t")
+			case c.Regression:
+				regressions++
+				fmt.Fprintf(tw, "%s\t%+.1f%%\tREGRESSION\t", round(c.Baseline), c.Change*100)
+			default:
+				fmt.Fprintf(tw, "%s\t%+.1f%%\t\t", round(c.Baseline), c.Change*100)
+			}
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+	return regressions
+}
+
+// round shortens a duration to three significant digits, e.g. 1.23ms.
+func round(d time.Duration) time.Duration {
+	for unit := time.Duration(1); unit < time.Second; unit *= 10 {
+		if d < unit*1000 {
+			return d.Round(unit)
+		}
+	}
+	return d.Round(time.Millisecond)
+}
@@ -0,0 +1,183 @@
+// Package bench times Popcorn scripts and compares the timings with a
+// stored baseline, so that performance regressions are noticed. It backs
+// `popcorn bench`, and its corpus of realistic programs is what the Go
+// benchmarks in test/bench run.
+package bench
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed corpus/*.pop
+var corpus embed.FS
+
+// Script is a program of the corpus.
+type Script struct {
+	// Name is the file name without the .pop extension
+	Name   string
+	Source string
+}
+
+// Corpus returns the benchmark programs ordered by name: recursive calls
+// (fib), nested loops (loops), strings, arrays and objects.
+func Corpus() []Script {
+	entries, _ := corpus.ReadDir("corpus")
+	scripts := make([]Script, 0, len(entries))
+	for _, entry := range entries {
+		source, _ := corpus.ReadFile(path.Join("corpus", entry.Name()))
+		scripts = append(scripts, Script{Name: strings.TrimSuffix(entry.Name(), ".pop"), Source: string(source)})
+	}
+	return scripts
+}
+
+// Options says how often Measure runs a script.
+type Options struct {
+	// Warmup runs are not timed. They fill caches, such as the VM's
+	// compile cache, so the timed runs measure the steady state.
+	Warmup int
+	// Iterations is the number of timed runs
+	Iterations int
+}
+
+// DefaultOptions are the options of `popcorn bench`.
+func DefaultOptions() Options {
+	return Options{Warmup: 3, Iterations: 10}
+}
+
+// Result holds the timings of a script.
+type Result struct {
+	Name       string        `json:"name"`
+	Iterations int           `json:"iterations"`
+	Median     time.Duration `json:"median_ns"`
+	Mean       time.Duration `json:"mean_ns"`
+	Min        time.Duration `json:"min_ns"`
+	Max        time.Duration `json:"max_ns"`
+	StdDev     time.Duration `json:"stddev_ns"`
+}
+
+// Measure runs run opts.Warmup times and then times opts.Iterations runs,
+// which must be at least one. It stops at the first error.
+func Measure(name string, opts Options, run func() error) (Result, error) {
+	if opts.Iterations < 1 {
+		return Result{}, fmt.Errorf("invalid iterations %d, want at least 1", opts.Iterations)
+	}
+	if opts.Warmup < 0 {
+		return Result{}, fmt.Errorf("invalid warmup %d, want 0 or more", opts.Warmup)
+	}
+	for i := 0; i < opts.Warmup; i++ {
+		if err := run(); err != nil {
+			return Result{}, err
+		}
+	}
+
+	times := make([]time.Duration, opts.Iterations)
+	for i := range times {
+		start := time.Now()
+		if err := run(); err != nil {
+			return Result{}, err
+		}
+		times[i] = time.Since(start)
+	}
+	return summarize(name, times), nil
+}
+
+func summarize(name string, times []time.Duration) Result {
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+	var total time.Duration
+	for _, t := range times {
+		total += t
+	}
+	mean := total / time.Duration(len(times))
+
+	var variance float64
+	for _, t := range times {
+		d := float64(t - mean)
+		variance += d * d
+	}
+	variance /= float64(len(times))
+
+	median := times[len(times)/2]
+	if len(times)%2 == 0 {
+		median = (times[len(times)/2-1] + times[len(times)/2]) / 2
+	}
+
+	return Result{
+		Name:       name,
+		Iterations: len(times),
+		Median:     median,
+		Mean:       mean,
+		Min:        times[0],
+		Max:        times[len(times)-1],
+		StdDev:     time.Duration(math.Sqrt(variance)),
+	}
+}
+
+// baseline is the file format of a stored baseline.
+type baseline struct {
+	Results []Result `json:"results"`
+}
+
+// WriteBaseline stores results as a baseline at path, as JSON.
+func WriteBaseline(path string, results []Result) error {
+	data, err := json.MarshalIndent(baseline{Results: results}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// ReadBaseline loads a baseline that WriteBaseline stored.
+func ReadBaseline(path string) ([]Result, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var b baseline
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("invalid baseline %s: %w", path, err)
+	}
+	return b.Results, nil
+}
+
+// Comparison is the timing of a script against its baseline. Medians are
+// compared, since they are less thrown by a slow outlier than means.
+type Comparison struct {
+	Name string
+	// Baseline is zero for scripts the baseline does not have
+	Baseline time.Duration
+	Current  time.Duration
+	// Change is the relative difference, 0.25 for 25% slower
+	Change float64
+	// Regression is set when Change exceeds the threshold
+	Regression bool
+}
+
+// Compare compares each result with the baseline result of the same name.
+// A script is a regression if it got slower by more than threshold, e.g.
+// 0.1 for 10%.
+func Compare(base, current []Result, threshold float64) []Comparison {
+	medians := make(map[string]time.Duration, len(base))
+	for _, result := range base {
+		medians[result.Name] = result.Median
+	}
+
+	comparisons := make([]Comparison, len(current))
+	for i, result := range current {
+		c := Comparison{Name: result.Name, Baseline: medians[result.Name], Current: result.Median}
+		if c.Baseline > 0 {
+			c.Change = float64(c.Current-c.Baseline) / float64(c.Baseline)
+			c.Regression = c.Change > threshold
+		}
+		comparisons[i] = c
+	}
+	return comparisons
+}
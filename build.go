@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	BE "pop/backend"
+	"pop/compiler"
+	"pop/vm"
+	"strings"
+)
+
+// build compiles a source file to a .popc file.
+func build(opts BE.Options, args []string) int {
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	out := flags.String("o", "", "write the bytecode to this path (default: the source path with a .popc extension)")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: popcorn build [-o file.popc] file.pop\n\nCompiles a file to bytecode that `popcorn file.popc` runs without parsing it again.\n\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	// Accept the flags after the file too, as in `popcorn build file.pop -o file.popc`
+	flags.Parse(args)
+	var files []string
+	for flags.NArg() > 0 {
+		files = append(files, flags.Arg(0))
+		flags.Parse(flags.Args()[1:])
+	}
+	if len(files) != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	path := files[0]
+	if *out == "" {
+		*out = strings.TrimSuffix(path, ".pop") + ".popc"
+	}
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error compiling %s: %v\n", path, err)
+		return 1
+	}
+	proto, err := compileSource(path, string(source), opts.Optimizer)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error compiling %s: %v\n", path, err)
+		return 1
+	}
+	data, err := (&compiler.Program{Proto: proto, Source: string(source)}).MarshalBinary()
+	if err == nil {
+		err = os.WriteFile(*out, data, 0o644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", *out, err)
+		return 1
+	}
+	return 0
+}
+
+// runBytecode runs a .popc file.
+func runBytecode(ctx context.Context, it *BE.Interpreter, path string) (BE.RuntimeVal, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	var program compiler.Program
+	if err := program.UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", path, err)
+	}
+	return vm.RunProgram(ctx, it, &program)
+}
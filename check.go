@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	BE "pop/backend"
+	"pop/typecheck"
+)
+
+// checkFiles reports the type errors in source files without running them.
+func checkFiles(_ BE.Options, args []string) int {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: popcorn check [path...]\n\nChecks the types of the .pop files given, and those in the directories\ngiven, or the current directory. Fails if there are type errors.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	files, err := sourceFiles(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	status := 0
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", file, err)
+			status = 1
+			continue
+		}
+		problems, err := typecheck.CheckSource(string(data))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			status = 1
+			continue
+		}
+		for _, problem := range problems {
+			fmt.Printf("%s:%s\n", file, problem)
+			status = 1
+		}
+	}
+	return status
+}
@@ -0,0 +1,132 @@
+package compiler
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	BE "pop/backend"
+	FE "pop/frontend"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// Cache keeps compiled programs on disk so that running an unchanged
+// script skips lexing, parsing and compiling it. Entries are keyed by the
+// file name, the source, the optimizations, the bytecode Version and the
+// build of the compiler, so editing a script, changing the optimization
+// level or upgrading or rebuilding the compiler simply misses the old
+// entries, whether or not Version was bumped.
+//
+// The cache is best effort: entries that cannot be read or written are
+// compiled again, never reported.
+type Cache struct {
+	// Dir holds one .popc file per entry
+	Dir string
+}
+
+// DefaultCacheDir is where the CLI caches compiled programs, or "" if
+// the user has no cache directory.
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "popcorn", "bytecode")
+}
+
+// Key is the name of the entry for source compiled from file and
+// optimized by optimizer, which may be nil.
+func (c *Cache) Key(file, source string, optimizer BE.Optimizer) string {
+	passes := ""
+	if optimizer != nil {
+		passes = fmt.Sprint(optimizer)
+	}
+
+	h := sha256.New()
+	h.Write(binary.BigEndian.AppendUint16(nil, Version))
+	for _, s := range []string{buildID(), file, passes} {
+		h.Write(binary.AppendUvarint(nil, uint64(len(s))))
+		h.Write([]byte(s))
+	}
+	h.Write([]byte(source))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// buildID identifies the running build: its module version and VCS
+// revision when the build recorded them, and the size and modification
+// time of the executable, which change whenever it is rebuilt.
+var buildID = sync.OnceValue(func() string {
+	var id strings.Builder
+	if info, ok := debug.ReadBuildInfo(); ok {
+		id.WriteString(info.Main.Version)
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" || setting.Key == "vcs.modified" {
+				id.WriteString(" " + setting.Value)
+			}
+		}
+	}
+	if exe, err := os.Executable(); err == nil {
+		if info, err := os.Stat(exe); err == nil {
+			fmt.Fprintf(&id, " %d %d", info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return id.String()
+})
+
+// Compile returns the program compiled from source, from the cache if it
+// has it and otherwise by parsing, optimizing and compiling it and storing
+// the result.
+func (c *Cache) Compile(file, source string, optimizer BE.Optimizer) (*Program, error) {
+	path := filepath.Join(c.Dir, c.Key(file, source, optimizer)+".popc")
+	if data, err := os.ReadFile(path); err == nil {
+		var program Program
+		if program.UnmarshalBinary(data) == nil && program.Source == source {
+			return &program, nil
+		}
+	}
+
+	parsed, err := FE.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	if optimizer != nil {
+		parsed = optimizer.Optimize(parsed)
+	}
+	proto, err := Compile(parsed, Options{File: file})
+	if err != nil {
+		return nil, err
+	}
+	program := &Program{Proto: proto, Source: source}
+	c.store(path, program)
+	return program, nil
+}
+
+// store writes an entry through a temporary file, so a concurrent reader
+// never sees half of it.
+func (c *Cache) store(path string, program *Program) {
+	data, err := program.MarshalBinary()
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(c.Dir, "*.tmp")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+}
@@ -0,0 +1,154 @@
+package compiler
+
+import (
+	BE "pop/backend"
+	"pop/frontend/types/ast"
+	"sort"
+)
+
+// Chunk is a block of bytecode with the constants it refers to.
+type Chunk struct {
+	Code []byte
+	// Constants holds numbers and strings as runtime values, and the
+	// *Proto of every function declared in the chunk
+	Constants []BE.RuntimeVal
+	// Lines maps code offsets back to the source, see PositionAt
+	Lines []LineInfo
+}
+
+// LineInfo says that the code from Offset up to the next entry was compiled
+// from the node at Pos.
+type LineInfo struct {
+	Offset int
+	Pos    ast.Position
+}
+
+// PositionAt returns the source position of the instruction at offset, or
+// the zero Position if it is unknown.
+func (c *Chunk) PositionAt(offset int) ast.Position {
+	i := sort.Search(len(c.Lines), func(i int) bool { return c.Lines[i].Offset > offset })
+	if i == 0 {
+		return ast.Position{}
+	}
+	return c.Lines[i-1].Pos
+}
+
+// Instruction is a decoded instruction.
+type Instruction struct {
+	Offset   int
+	Op       Opcode
+	Operands []int
+}
+
+// Width is the encoded size of the instruction in bytes.
+func (in Instruction) Width() int {
+	width := 1
+	if def, err := Lookup(in.Op); err == nil {
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+	}
+	return width
+}
+
+// Instructions decodes the chunk's code.
+func (c *Chunk) Instructions() []Instruction {
+	var out []Instruction
+	for offset := 0; offset < len(c.Code); {
+		op := Opcode(c.Code[offset])
+		def, err := Lookup(op)
+		if err != nil {
+			out = append(out, Instruction{Offset: offset, Op: op})
+			offset++
+			continue
+		}
+
+		operands, read := ReadOperands(def, c.Code[offset+1:])
+		out = append(out, Instruction{Offset: offset, Op: op, Operands: operands})
+		offset += 1 + read
+	}
+	return out
+}
+
+// Proto is a compiled function, or the top-level code of a program. The VM
+// makes closures out of it.
+type Proto struct {
+	// Name is the function's name, "<module>" for top-level code
+	Name   string
+	Params []string
+	Chunk
+	// Locals describes the frame's slots: the parameters first, then the
+	// variables of every scope in the function. Each declaration has a
+	// slot of its own, so a frame needs len(Locals) slots.
+	Locals []Local
+	// Upvalues lists the variables the function captures from the
+	// functions around it
+	Upvalues []Upvalue
+	// File and Pos locate the declaration, for tracebacks
+	File string
+	Pos  ast.Position
+}
+
+// Local is a variable slot of a frame.
+type Local struct {
+	Name  string
+	Const bool
+}
+
+// Upvalue is a variable captured from the enclosing function: its slot
+// Index there if IsLocal, otherwise the enclosing function's own upvalue
+// Index.
+type Upvalue struct {
+	Name    string
+	Index   int
+	IsLocal bool
+	Const   bool
+}
+
+// GlobalUse is a read or assignment of a global variable the code cannot
+// be sure exists.
+type GlobalUse struct {
+	Name string
+	Pos  ast.Position
+	// Declaration is where the program declares the global, the zero
+	// Position if it does not
+	Declaration ast.Position
+}
+
+// GlobalUses lists the uses of globals by proto and its functions that the
+// program does not declare, or that top-level code makes before the
+// declaration, in the order of the code. Whether they are errors depends
+// on the globals of the interpreter running it.
+func GlobalUses(proto *Proto) []GlobalUse {
+	declarations := map[string]ast.Position{}
+	for _, p := range protos(proto) {
+		for _, in := range p.Instructions() {
+			if in.Op == OpDefineGlobal || in.Op == OpDefineConstGlobal || in.Op == OpDefineImport {
+				name := p.Constants[in.Operands[0]].(BE.StringVal).Value
+				if _, ok := declarations[name]; !ok {
+					declarations[name] = p.PositionAt(in.Offset)
+				}
+			}
+		}
+	}
+
+	var uses []GlobalUse
+	for _, p := range protos(proto) {
+		// Functions run once the code around them has declared its globals
+		declared := map[string]bool{}
+		for _, in := range p.Instructions() {
+			switch in.Op {
+			case OpDefineGlobal, OpDefineConstGlobal, OpDefineImport:
+				declared[p.Constants[in.Operands[0]].(BE.StringVal).Value] = true
+			case OpGetGlobal, OpSetGlobal:
+				name := p.Constants[in.Operands[0]].(BE.StringVal).Value
+				pos, ok := declarations[name]
+				if ok && (p != proto || declared[name]) {
+					continue
+				}
+				uses = append(uses, GlobalUse{Name: name, Pos: p.PositionAt(in.Offset), Declaration: pos})
+			}
+		}
+	}
+	return uses
+}
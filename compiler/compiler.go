@@ -0,0 +1,744 @@
+package compiler
+
+import (
+	"fmt"
+	BE "pop/backend"
+	"pop/frontend/types/ast"
+)
+
+// maxOperand is the largest value a two byte operand can hold. It bounds the
+// constants, local slots and jump distances of a single function.
+const maxOperand = 1<<16 - 1
+
+// Options configures Compile.
+type Options struct {
+	// File is what tracebacks call the compiled source, e.g. "main.pop"
+	File string
+}
+
+// CompileError is returned when a program does not fit the bytecode
+// format, for example a function with more than 65535 constants.
+type CompileError struct {
+	Message string
+}
+
+func (e *CompileError) Error() string {
+	return e.Message
+}
+
+// compileError aborts compilation. It is recovered by Compile.
+func compileError(format string, args ...any) {
+	panic(&CompileError{Message: fmt.Sprintf(format, args...)})
+}
+
+// recoverCompileError stores a CompileError panic into err and re-panics
+// anything else.
+func recoverCompileError(err *error) {
+	if r := recover(); r != nil {
+		compileErr, ok := r.(*CompileError)
+		if !ok {
+			panic(r)
+		}
+		*err = compileErr
+	}
+}
+
+// Compile lowers a parsed program into the proto of its top-level code.
+//
+// The bytecode follows the tree walker's scoping: top-level declarations
+// are globals, while functions and the bodies of if, while, for, try and
+// catch get scopes of local slots. A variable refers to the innermost
+// declaration that comes before it in the source, or, from inside a nested
+// function, to the innermost declaration in the scopes around it. Anything
+// else is looked up as a global when it runs. Errors the tree walker
+// raises while running, such as redeclaring a variable, are raised by the
+// VM at the same point.
+//
+// A `pop` in top-level code ends the top-level statement it is in, which
+// takes its value, and the program goes on with the next statement.
+func Compile(program ast.Program, opts Options) (proto *Proto, err error) {
+	defer recoverCompileError(&err)
+
+	c := newCompiler(&Proto{Name: "<module>", File: opts.File}, nil)
+	c.compile(program)
+	c.emit(OpReturn)
+	return c.proto, nil
+}
+
+// compiler emits the code of one function. Nested functions get their own
+// compiler, linked to the one around them to resolve captured variables.
+type compiler struct {
+	proto     *Proto
+	enclosing *compiler
+	// scopes are the open scopes, innermost last. Top-level code starts
+	// with none: its variables are globals.
+	scopes    []*scope
+	constants map[BE.RuntimeVal]int
+	// pos is the position of the node being compiled, recorded in the
+	// line table for every instruction emitted
+	pos ast.Position
+
+	// exits are the jumps of top-level `pop`s to the end of the top-level
+	// statement being compiled, and tries the number of try blocks they
+	// leave
+	exits []int
+	tries int
+}
+
+func newCompiler(proto *Proto, enclosing *compiler) *compiler {
+	return &compiler{proto: proto, enclosing: enclosing, constants: map[BE.RuntimeVal]int{}}
+}
+
+// scope maps every name declared in a scope to its slot. The names are
+// collected before the scope is compiled, so that nested functions can
+// refer to variables declared after them.
+type scope struct {
+	first    int
+	bindings map[string]*binding
+}
+
+type binding struct {
+	slot int
+	// declared is set once the declaration has been compiled. Code in
+	// the same function only sees declared variables.
+	declared bool
+}
+
+// declaration is a variable a statement declares into the scope it runs in.
+type declaration struct {
+	name     string
+	constant bool
+}
+
+// declarations lists the variables stmts declare into their scope,
+// including from blocks, which do not open a scope of their own.
+func declarations(stmts []ast.ASTNode) []declaration {
+	var decls []declaration
+
+	var visit func(node ast.ASTNode)
+	visit = func(node ast.ASTNode) {
+		switch n := node.(type) {
+		case ast.VariableDeclarationNode:
+			decls = append(decls, declaration{n.Identifier, n.Constant})
+		case ast.FunctionDeclarationNode:
+			decls = append(decls, declaration{n.Name, true})
+		case ast.BlockStatementNode:
+			for _, stmt := range n.Body {
+				visit(stmt)
+			}
+		}
+	}
+	for _, stmt := range stmts {
+		visit(stmt)
+	}
+	return decls
+}
+
+// blockBody returns the statements of a block, or node itself if it is a
+// single statement.
+func blockBody(node ast.ASTNode) []ast.ASTNode {
+	if block, ok := node.(ast.BlockStatementNode); ok {
+		return block.Body
+	}
+	if node == nil {
+		return nil
+	}
+	return []ast.ASTNode{node}
+}
+
+// beginScope opens a scope with a slot for each declaration. Declaring a
+// name twice gives both declarations the same slot, so the second one
+// fails when it runs.
+func (c *compiler) beginScope(decls []declaration) *scope {
+	s := &scope{first: len(c.proto.Locals), bindings: map[string]*binding{}}
+	for _, decl := range decls {
+		if _, exists := s.bindings[decl.name]; exists {
+			continue
+		}
+		if len(c.proto.Locals) > maxOperand {
+			compileError("Too many local variables in function '%s'", c.proto.Name)
+		}
+		s.bindings[decl.name] = &binding{slot: len(c.proto.Locals)}
+		c.proto.Locals = append(c.proto.Locals, Local{Name: decl.name, Const: decl.constant})
+	}
+	c.scopes = append(c.scopes, s)
+	return s
+}
+
+// endScope closes the innermost scope and returns the range of slots it
+// and the scopes inside it used.
+func (c *compiler) endScope() (first, count int) {
+	s := c.scopes[len(c.scopes)-1]
+	c.scopes = c.scopes[:len(c.scopes)-1]
+
+	first, count = s.first, len(c.proto.Locals)-s.first
+	c.emit(OpCloseScope, first, count)
+	return first, count
+}
+
+// local finds a variable of this function that is declared by now.
+func (c *compiler) local(name string) (int, bool) {
+	for i := len(c.scopes) - 1; i >= 0; i-- {
+		if b, ok := c.scopes[i].bindings[name]; ok && b.declared {
+			return b.slot, true
+		}
+	}
+	return 0, false
+}
+
+// capturable finds a variable of this function for a nested function,
+// which may run after variables declared later in the scope exist.
+func (c *compiler) capturable(name string) (int, bool) {
+	for i := len(c.scopes) - 1; i >= 0; i-- {
+		if b, ok := c.scopes[i].bindings[name]; ok {
+			return b.slot, true
+		}
+	}
+	return 0, false
+}
+
+// upvalue resolves name in the functions around this one, capturing it
+// through each of them.
+func (c *compiler) upvalue(name string) (int, bool) {
+	if c.enclosing == nil {
+		return 0, false
+	}
+	if slot, ok := c.enclosing.capturable(name); ok {
+		return c.addUpvalue(Upvalue{Name: name, Index: slot, IsLocal: true, Const: c.enclosing.proto.Locals[slot].Const}), true
+	}
+	if index, ok := c.enclosing.upvalue(name); ok {
+		return c.addUpvalue(Upvalue{Name: name, Index: index, Const: c.enclosing.proto.Upvalues[index].Const}), true
+	}
+	return 0, false
+}
+
+func (c *compiler) addUpvalue(up Upvalue) int {
+	for i, existing := range c.proto.Upvalues {
+		if existing.Index == up.Index && existing.IsLocal == up.IsLocal {
+			return i
+		}
+	}
+	if len(c.proto.Upvalues) > maxOperand {
+		compileError("Too many captured variables in function '%s'", c.proto.Name)
+	}
+	c.proto.Upvalues = append(c.proto.Upvalues, up)
+	return len(c.proto.Upvalues) - 1
+}
+
+// getVar and setVar emit the access to a variable wherever it lives.
+func (c *compiler) getVar(name string) {
+	if slot, ok := c.local(name); ok {
+		c.emit(OpGetLocal, slot)
+	} else if index, ok := c.upvalue(name); ok {
+		c.emit(OpGetUpvalue, index)
+	} else {
+		c.emit(OpGetGlobal, c.constant(BE.StringVal{Value: name}))
+	}
+}
+
+func (c *compiler) setVar(name string) {
+	if slot, ok := c.local(name); ok {
+		c.emit(OpSetLocal, slot)
+	} else if index, ok := c.upvalue(name); ok {
+		c.emit(OpSetUpvalue, index)
+	} else {
+		c.emit(OpSetGlobal, c.constant(BE.StringVal{Value: name}))
+	}
+}
+
+// define declares name in the innermost scope with the value on top.
+func (c *compiler) define(name string, constant bool) {
+	if len(c.scopes) == 0 {
+		op := OpDefineGlobal
+		if constant {
+			op = OpDefineConstGlobal
+		}
+		c.emit(op, c.constant(BE.StringVal{Value: name}))
+		return
+	}
+
+	b, ok := c.scopes[len(c.scopes)-1].bindings[name]
+	if !ok {
+		compileError("Declaration of '%s' was not collected for its scope", name)
+	}
+	b.declared = true
+
+	op := OpDefineLocal
+	if constant {
+		op = OpDefineConstLocal
+	}
+	c.emit(op, b.slot)
+}
+
+// * ======== EMITTING ======== * \\
+
+// emit appends an instruction and returns its offset.
+func (c *compiler) emit(op Opcode, operands ...int) int {
+	for _, operand := range operands {
+		if operand < 0 || operand > maxOperand {
+			compileError("Operand %d of %s is out of range in function '%s'", operand, op, c.proto.Name)
+		}
+	}
+
+	offset := len(c.proto.Code)
+	if lines := c.proto.Lines; c.pos.IsValid() && (len(lines) == 0 || lines[len(lines)-1].Pos != c.pos) {
+		c.proto.Lines = append(lines, LineInfo{Offset: offset, Pos: c.pos})
+	}
+	c.proto.Code = append(c.proto.Code, Make(op, operands...)...)
+	return offset
+}
+
+// emitJump emits a forward jump to be patched later and returns the offset
+// of its distance operand.
+func (c *compiler) emitJump(op Opcode, operands ...int) int {
+	c.emit(op, append(operands, maxOperand)...)
+	return len(c.proto.Code) - 2
+}
+
+// patchJump points the jump whose operand is at offset to the next
+// instruction.
+func (c *compiler) patchJump(offset int) {
+	distance := len(c.proto.Code) - (offset + 2)
+	if distance > maxOperand {
+		compileError("Too much code to jump over in function '%s'", c.proto.Name)
+	}
+	c.proto.Code[offset] = byte(distance >> 8)
+	c.proto.Code[offset+1] = byte(distance)
+}
+
+// emitLoop jumps back to start.
+func (c *compiler) emitLoop(start int) {
+	distance := len(c.proto.Code) + 3 - start
+	if distance > maxOperand {
+		compileError("Loop body is too large in function '%s'", c.proto.Name)
+	}
+	c.emit(OpLoop, distance)
+}
+
+// constant adds val to the constant pool, reusing an equal number or
+// string, and returns its index.
+func (c *compiler) constant(val BE.RuntimeVal) int {
+	if index, ok := c.constants[val]; ok {
+		return index
+	}
+	if len(c.proto.Constants) > maxOperand {
+		compileError("Too many constants in function '%s'", c.proto.Name)
+	}
+	c.proto.Constants = append(c.proto.Constants, val)
+	c.constants[val] = len(c.proto.Constants) - 1
+	return len(c.proto.Constants) - 1
+}
+
+// raise emits code that fails with a runtime error when it is reached.
+func (c *compiler) raise(format string, args ...any) {
+	c.emit(OpRaise, c.constant(BE.StringVal{Value: fmt.Sprintf(format, args...)}))
+}
+
+// * ======== NODES ======== * \\
+
+// compile emits the code of a node, which leaves exactly one value on the
+// stack: statements leave what the tree walker's Evaluate returns for them.
+func (c *compiler) compile(astNode ast.ASTNode) {
+	outer := c.pos
+	if pos := ast.PositionOf(astNode); pos.IsValid() {
+		c.pos = pos
+	}
+	defer func() { c.pos = outer }()
+
+	switch node := astNode.(type) {
+	case ast.Program:
+		c.program(node.Body)
+	case ast.VariableDeclarationNode:
+		c.compileVarDeclaration(node)
+	case ast.FunctionDeclarationNode:
+		c.compileFnDeclaration(node)
+	case ast.ReturnStatementNode:
+		c.compileReturn(node)
+	case ast.IfStatementNode:
+		c.compileIf(node)
+	case ast.WhileStatementNode:
+		c.compileWhile(node)
+	case ast.ForStatementNode:
+		c.compileFor(node)
+	case ast.BlockStatementNode:
+		c.discardAll(node.Body)
+		c.emit(OpNull)
+	case ast.TryStatementNode:
+		c.compileTry(node)
+	case ast.ThrowStatementNode:
+		c.compile(node.Value)
+		c.emit(OpThrow)
+	case ast.TypeAliasNode:
+		c.emit(OpNull)
+	case ast.ImportDeclarationNode:
+		c.compileImport(node)
+	case ast.AssignmentExprNode:
+		c.compileAssignment(node)
+	case ast.BinaryExprNode:
+		c.compileBinary(node)
+	case ast.LogicalExprNode:
+		c.compileLogical(node)
+	case ast.UnaryExprNode:
+		c.compileUnary(node)
+	case ast.CallExprNode:
+		c.compileCall(node)
+	case ast.MemberExprNode:
+		c.compileMember(node)
+	case ast.IdentifierExprNode:
+		c.getVar(node.Symbol)
+	case ast.ObjectLiteralExprNode:
+		c.compileObject(node)
+	case ast.ArrayLiteralExprNode:
+		for _, elem := range node.Elements {
+			c.compile(elem)
+		}
+		c.emit(OpArray, len(node.Elements))
+	case ast.NumericLiteralExprNode:
+		c.emit(OpConstant, c.constant(BE.NumberVal{Value: node.Value}))
+	case ast.StringLiteralExprNode:
+		c.emit(OpConstant, c.constant(BE.StringVal{Value: node.Value}))
+	case ast.BooleanLiteralExprNode:
+		if node.Value {
+			c.emit(OpTrue)
+		} else {
+			c.emit(OpFalse)
+		}
+	case ast.NullLiteralExprNode:
+		c.emit(OpNull)
+	default:
+		c.raise("Node of type '%s' is not setup for evaluation.", ast.GetNodeKindAsString(node))
+	}
+}
+
+// statements leaves the value of the last statement, or null if there are
+// none.
+func (c *compiler) statements(stmts []ast.ASTNode) {
+	if len(stmts) == 0 {
+		c.emit(OpNull)
+		return
+	}
+	for i, stmt := range stmts {
+		c.compile(stmt)
+		if i < len(stmts)-1 {
+			c.emit(OpPop)
+		}
+	}
+}
+
+// program compiles top-level statements like statements does. A `pop`
+// only ends the statement it is in, which the tree walker evaluates to the
+// popped value.
+func (c *compiler) program(stmts []ast.ASTNode) {
+	if len(stmts) == 0 {
+		c.emit(OpNull)
+		return
+	}
+	for i, stmt := range stmts {
+		c.compile(stmt)
+		for _, exit := range c.exits {
+			c.patchJump(exit)
+		}
+		c.exits = nil
+		if i < len(stmts)-1 {
+			c.emit(OpPop)
+		}
+	}
+}
+
+// discardAll compiles statements whose values are not used.
+func (c *compiler) discardAll(stmts []ast.ASTNode) {
+	for _, stmt := range stmts {
+		if block, ok := stmt.(ast.BlockStatementNode); ok {
+			c.discardAll(block.Body)
+			continue
+		}
+		c.compile(stmt)
+		c.emit(OpPop)
+	}
+}
+
+func (c *compiler) compileVarDeclaration(node ast.VariableDeclarationNode) {
+	if node.Value != nil {
+		c.compile(node.Value)
+	} else {
+		c.emit(OpNull)
+	}
+	c.define(node.Identifier, node.Constant)
+}
+
+// compileImport binds the exports an import names as constant globals.
+// The parser only allows imports in top-level code.
+func (c *compiler) compileImport(node ast.ImportDeclarationNode) {
+	if c.enclosing != nil || len(c.scopes) > 0 {
+		c.raise("Imports are only allowed at the top level of a module")
+		return
+	}
+	specifier := c.constant(BE.StringVal{Value: node.Specifier})
+	c.emit(OpImport, specifier)
+	if node.Namespace != "" {
+		c.emit(OpDefineImport, c.constant(BE.StringVal{Value: node.Namespace}))
+	} else {
+		for _, name := range node.Names {
+			c.emit(OpImportName, specifier, c.constant(BE.StringVal{Value: name.Name}))
+			c.emit(OpDefineImport, c.constant(BE.StringVal{Value: name.Local}))
+		}
+		c.emit(OpPop)
+	}
+	c.emit(OpNull)
+}
+
+func (c *compiler) compileFnDeclaration(node ast.FunctionDeclarationNode) {
+	fc := newCompiler(&Proto{Name: node.Name, Params: node.Params, File: c.proto.File, Pos: node.Pos}, c)
+	fc.pos = node.Pos
+
+	decls := make([]declaration, 0, len(node.Params))
+	for _, param := range node.Params {
+		decls = append(decls, declaration{name: param})
+	}
+	fnScope := fc.beginScope(append(decls, declarations(node.Body)...))
+
+	// Parameters are declared one after another when the function is
+	// called, so a repeated one fails then
+	seen := map[string]bool{}
+	for _, param := range node.Params {
+		if seen[param] {
+			fc.raise("Cannot declare variable '%s' as its already present in the current scope.", param)
+			break
+		}
+		seen[param] = true
+		fnScope.bindings[param].declared = true
+	}
+
+	// A function returns the value of its last statement unless it pops
+	fc.statements(node.Body)
+	fc.emit(OpReturn)
+
+	c.emit(OpClosure, c.constant(fc.proto))
+	c.define(node.Name, true)
+}
+
+func (c *compiler) compileReturn(node ast.ReturnStatementNode) {
+	if node.Value != nil {
+		c.compile(node.Value)
+	} else {
+		c.emit(OpNull)
+	}
+	if c.enclosing != nil {
+		c.emit(OpReturn)
+		return
+	}
+
+	// Top-level code leaves the statement's try blocks and scopes
+	for i := 0; i < c.tries; i++ {
+		c.emit(OpEndTry)
+	}
+	if len(c.scopes) > 0 {
+		first := c.scopes[0].first
+		c.emit(OpCloseScope, first, len(c.proto.Locals)-first)
+	}
+	c.exits = append(c.exits, c.emitJump(OpJump))
+}
+
+func (c *compiler) compileIf(node ast.IfStatementNode) {
+	c.compile(node.Condition)
+	elseJump := c.emitJump(OpJumpIfFalse, int(CondIf))
+
+	consequent, ok := node.Consequent.(ast.BlockStatementNode)
+	if !ok {
+		c.raise("If statement must have a block statement as the body %v: ", consequent)
+	}
+	c.beginScope(declarations(consequent.Body))
+	c.discardAll(consequent.Body)
+	c.endScope()
+	endJump := c.emitJump(OpJump)
+
+	// An `else` block gets a scope of its own, `else if` opens its own
+	c.patchJump(elseJump)
+	if alternate, ok := node.Alternate.(ast.BlockStatementNode); ok {
+		c.beginScope(declarations(alternate.Body))
+		c.discardAll(alternate.Body)
+		c.endScope()
+	} else if node.Alternate != nil {
+		c.discardAll([]ast.ASTNode{node.Alternate})
+	}
+	c.patchJump(endJump)
+	c.emit(OpNull)
+}
+
+func (c *compiler) compileWhile(node ast.WhileStatementNode) {
+	// The loop's scope lives across iterations, as the tree walker's does
+	body := blockBody(node.Body)
+	c.beginScope(declarations(body))
+
+	start := len(c.proto.Code)
+	c.compile(node.Condition)
+	exitJump := c.emitJump(OpJumpIfFalse, int(CondWhile))
+	c.discardAll(body)
+	c.emitLoop(start)
+
+	c.patchJump(exitJump)
+	c.endScope()
+	c.emit(OpNull)
+}
+
+func (c *compiler) compileFor(node ast.ForStatementNode) {
+	body := blockBody(node.Body)
+	var init []ast.ASTNode
+	if node.Init != nil {
+		init = []ast.ASTNode{node.Init}
+	}
+	c.beginScope(append(declarations(init), declarations(body)...))
+	c.discardAll(init)
+
+	start := len(c.proto.Code)
+	c.compile(node.Condition)
+	exitJump := c.emitJump(OpJumpIfFalse, int(CondFor))
+	c.discardAll(body)
+	if node.Update != nil {
+		c.discardAll([]ast.ASTNode{node.Update})
+	}
+	c.emitLoop(start)
+
+	c.patchJump(exitJump)
+	c.endScope()
+	c.emit(OpNull)
+}
+
+func (c *compiler) compileTry(node ast.TryStatementNode) {
+	handlerJump := c.emitJump(OpTry)
+
+	body := blockBody(node.Body)
+	c.beginScope(declarations(body))
+	c.tries++
+	c.discardAll(body)
+	c.tries--
+	first, count := c.endScope()
+	c.emit(OpEndTry)
+	endJump := c.emitJump(OpJump)
+
+	// The error may have left the try block half way through its scope
+	c.patchJump(handlerJump)
+	c.emit(OpCloseScope, first, count)
+
+	handler := blockBody(node.Handler)
+	var decls []declaration
+	if node.Param != "" {
+		decls = append(decls, declaration{name: node.Param})
+	}
+	c.beginScope(append(decls, declarations(handler)...))
+	if node.Param != "" {
+		c.define(node.Param, false)
+	}
+	c.emit(OpPop)
+	c.discardAll(handler)
+	c.endScope()
+
+	c.patchJump(endJump)
+	c.emit(OpNull)
+}
+
+func (c *compiler) compileAssignment(node ast.AssignmentExprNode) {
+	// Only allow assignment to identifiers for now
+	ident, ok := node.Assignee.(ast.IdentifierExprNode)
+	if !ok {
+		c.raise("Invalid LHS in assignment: %+v", node.Assignee)
+		return
+	}
+	c.compile(node.Value)
+	c.setVar(ident.Symbol)
+}
+
+var binaryOps = map[ast.BinaryOperatorKind]Opcode{
+	"+":  OpAdd,
+	"-":  OpSubtract,
+	"*":  OpMultiply,
+	"/":  OpDivide,
+	"%":  OpModulo,
+	"==": OpEqual,
+	"!=": OpNotEqual,
+	"is": OpIs,
+	"<":  OpLess,
+	">":  OpGreater,
+	"<=": OpLessEqual,
+	">=": OpGreaterEqual,
+}
+
+func (c *compiler) compileBinary(node ast.BinaryExprNode) {
+	c.compile(node.Left)
+	c.compile(node.Right)
+
+	op, ok := binaryOps[node.Operator]
+	if !ok {
+		c.raise("Unknown binary operator: %s", node.Operator)
+		return
+	}
+	c.emit(op)
+}
+
+func (c *compiler) compileLogical(node ast.LogicalExprNode) {
+	c.compile(node.Left)
+
+	op := OpOr
+	if node.Operator == "&&" {
+		op = OpAnd
+	}
+	shortCircuit := c.emitJump(op)
+	c.compile(node.Right)
+	c.emit(OpCheckBool)
+	c.patchJump(shortCircuit)
+}
+
+func (c *compiler) compileUnary(node ast.UnaryExprNode) {
+	c.compile(node.Operand)
+
+	switch node.Operator {
+	case "!":
+		c.emit(OpNot)
+	case "-":
+		c.emit(OpNegate)
+	default:
+		c.raise("Unknown unary operator: %v", node.Operator)
+	}
+}
+
+func (c *compiler) compileCall(node ast.CallExprNode) {
+	c.compile(node.Caller)
+	if len(node.Args) > 255 {
+		compileError("Too many arguments in a call: %d (the limit is 255)", len(node.Args))
+	}
+	for _, arg := range node.Args {
+		c.compile(arg)
+	}
+	c.emit(OpCall, len(node.Args))
+}
+
+func (c *compiler) compileMember(node ast.MemberExprNode) {
+	c.compile(node.Object)
+
+	// Computed access: obj[expr] or array[index]
+	if node.Computed {
+		c.compile(node.Property)
+		c.emit(OpGetIndex)
+		return
+	}
+
+	ident, ok := node.Property.(ast.IdentifierExprNode)
+	if !ok {
+		c.raise("Property in dot notation must be identifier, got: %+v", node.Property)
+		return
+	}
+	c.emit(OpGetProperty, c.constant(BE.StringVal{Value: ident.Symbol}))
+}
+
+func (c *compiler) compileObject(node ast.ObjectLiteralExprNode) {
+	for _, prop := range node.Properties {
+		c.emit(OpConstant, c.constant(BE.StringVal{Value: prop.Key}))
+		if prop.Value == nil {
+			// Shorthand `{ x }` reads the variable x
+			c.getVar(prop.Key)
+		} else {
+			c.compile(prop.Value)
+		}
+	}
+	c.emit(OpObject, len(node.Properties))
+}
@@ -0,0 +1,147 @@
+package compiler
+
+import (
+	"fmt"
+	BE "pop/backend"
+	"strings"
+)
+
+// Disassemble renders a proto and every function nested in it, one
+// instruction per line:
+//
+//	0007  L12  JUMP_IF_FALSE  -> 0019 (If statement)
+//
+// Each line has the instruction's offset, the source line it was compiled
+// from, the opcode and its operands, with constants, variable names and
+// jump targets resolved.
+func Disassemble(proto *Proto) string {
+	var b strings.Builder
+	for i, p := range protos(proto) {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		disassembleProto(&b, p)
+	}
+	return b.String()
+}
+
+// protos lists proto and the functions nested in it, depth first.
+func protos(proto *Proto) []*Proto {
+	all := []*Proto{proto}
+	for _, constant := range proto.Constants {
+		if child, ok := constant.(*Proto); ok {
+			all = append(all, protos(child)...)
+		}
+	}
+	return all
+}
+
+func disassembleProto(b *strings.Builder, proto *Proto) {
+	if proto.Name == "<module>" {
+		fmt.Fprintf(b, "== <module> %s ==\n", proto.File)
+	} else {
+		fmt.Fprintf(b, "== fn %s(%s) %s:%s ==\n", proto.Name, strings.Join(proto.Params, ", "), proto.File, proto.Pos)
+	}
+
+	if len(proto.Locals) > 0 {
+		names := make([]string, len(proto.Locals))
+		for i, local := range proto.Locals {
+			names[i] = local.Name
+		}
+		fmt.Fprintf(b, "locals: %s\n", strings.Join(names, ", "))
+	}
+	if len(proto.Upvalues) > 0 {
+		captures := make([]string, len(proto.Upvalues))
+		for i, up := range proto.Upvalues {
+			from := "upvalue"
+			if up.IsLocal {
+				from = "local"
+			}
+			captures[i] = fmt.Sprintf("%s (%s %d)", up.Name, from, up.Index)
+		}
+		fmt.Fprintf(b, "upvalues: %s\n", strings.Join(captures, ", "))
+	}
+
+	instructions := proto.Instructions()
+	lineWidth, opWidth := 0, 0
+	for _, in := range instructions {
+		lineWidth = max(lineWidth, len(lineLabel(proto, in)))
+		opWidth = max(opWidth, len(in.Op.String()))
+	}
+	for _, in := range instructions {
+		line := fmt.Sprintf("%04d  %-*s  %-*s  %s", in.Offset, lineWidth, lineLabel(proto, in), opWidth, in.Op, FormatOperands(proto, in))
+		b.WriteString(strings.TrimRight(line, " "))
+		b.WriteString("\n")
+	}
+}
+
+func lineLabel(proto *Proto, in Instruction) string {
+	if pos := proto.PositionAt(in.Offset); pos.IsValid() {
+		return fmt.Sprintf("L%d", pos.Line)
+	}
+	return "L?"
+}
+
+// FormatOperands renders the operands of an instruction of proto the way
+// Disassemble does.
+func FormatOperands(proto *Proto, in Instruction) string {
+	name := func(k int) string {
+		if k < len(proto.Constants) {
+			if str, ok := proto.Constants[k].(BE.StringVal); ok {
+				return str.Value
+			}
+		}
+		return "?"
+	}
+	target := func(distance int) string {
+		if in.Op == OpLoop {
+			return fmt.Sprintf("-> %04d", in.Offset+in.Width()-distance)
+		}
+		return fmt.Sprintf("-> %04d", in.Offset+in.Width()+distance)
+	}
+
+	switch in.Op {
+	case OpConstant, OpRaise:
+		k := in.Operands[0]
+		if k >= len(proto.Constants) {
+			return fmt.Sprintf("#%d ?", k)
+		}
+		return fmt.Sprintf("#%d %s", k, BE.Inspect(proto.Constants[k], BE.DefaultInspectOptions))
+	case OpClosure:
+		k := in.Operands[0]
+		if k < len(proto.Constants) {
+			if child, ok := proto.Constants[k].(*Proto); ok {
+				return fmt.Sprintf("#%d <fn %s(%s)>", k, child.Name, strings.Join(child.Params, ", "))
+			}
+		}
+		return fmt.Sprintf("#%d ?", k)
+	case OpDefineGlobal, OpDefineConstGlobal, OpGetGlobal, OpSetGlobal, OpGetProperty, OpDefineImport:
+		return fmt.Sprintf("#%d %s", in.Operands[0], name(in.Operands[0]))
+	case OpImport:
+		return fmt.Sprintf("#%d %q", in.Operands[0], name(in.Operands[0]))
+	case OpImportName:
+		return fmt.Sprintf("#%d %q #%d %s", in.Operands[0], name(in.Operands[0]), in.Operands[1], name(in.Operands[1]))
+	case OpDefineLocal, OpDefineConstLocal, OpGetLocal, OpSetLocal:
+		slot := in.Operands[0]
+		if slot < len(proto.Locals) {
+			return fmt.Sprintf("%d %s", slot, proto.Locals[slot].Name)
+		}
+		return fmt.Sprintf("%d ?", slot)
+	case OpGetUpvalue, OpSetUpvalue:
+		index := in.Operands[0]
+		if index < len(proto.Upvalues) {
+			return fmt.Sprintf("%d %s", index, proto.Upvalues[index].Name)
+		}
+		return fmt.Sprintf("%d ?", index)
+	case OpJump, OpLoop, OpAnd, OpOr, OpTry:
+		return target(in.Operands[0])
+	case OpJumpIfFalse:
+		return fmt.Sprintf("%s (%s)", target(in.Operands[1]), ConditionKind(in.Operands[0]))
+	}
+
+	operands := make([]string, len(in.Operands))
+	for i, operand := range in.Operands {
+		operands[i] = fmt.Sprint(operand)
+	}
+	return strings.Join(operands, " ")
+}
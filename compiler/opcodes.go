@@ -0,0 +1,262 @@
+package compiler
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Opcode is one bytecode instruction. Its operands follow it in the code,
+// big-endian, with the widths listed in its Definition.
+type Opcode byte
+
+const (
+	// CONSTANT k pushes Constants[k]
+	OpConstant Opcode = iota
+	OpNull
+	OpTrue
+	OpFalse
+	// POP drops the value on top of the stack
+	OpPop
+
+	// DEFINE_GLOBAL k declares the global named Constants[k] with the
+	// value on top, which stays on the stack as the declaration's value
+	OpDefineGlobal
+	OpDefineConstGlobal
+	// GET_GLOBAL k pushes the global named Constants[k]
+	OpGetGlobal
+	// SET_GLOBAL k assigns the value on top to the global named
+	// Constants[k], leaving it on the stack
+	OpSetGlobal
+
+	// DEFINE_LOCAL s declares the local in slot s with the value on top.
+	// Declaring a slot that is already defined fails, like redeclaring a
+	// variable in the same environment does.
+	OpDefineLocal
+	OpDefineConstLocal
+	OpGetLocal
+	OpSetLocal
+	// GET_UPVALUE u and SET_UPVALUE u access a variable captured by the
+	// closure being run
+	OpGetUpvalue
+	OpSetUpvalue
+	// CLOSE_SCOPE s n ends a scope whose locals are slots s to s+n-1:
+	// closures keep the variables they captured, and the slots go back to
+	// undefined so the scope starts afresh the next time it is entered
+	OpCloseScope
+
+	OpAdd
+	OpSubtract
+	OpMultiply
+	OpDivide
+	OpModulo
+	OpEqual
+	OpNotEqual
+	OpIs
+	OpLess
+	OpGreater
+	OpLessEqual
+	OpGreaterEqual
+	OpNegate
+	OpNot
+
+	// JUMP d continues d bytes after the end of the instruction
+	OpJump
+	// JUMP_IF_FALSE c d pops a condition of the kind c and jumps if it
+	// does not hold
+	OpJumpIfFalse
+	// LOOP d continues d bytes before the end of the instruction
+	OpLoop
+	// AND d and OR d short-circuit: they jump, keeping the left operand as
+	// the result, when it decides the expression and pop it otherwise
+	OpAnd
+	OpOr
+	// CHECK_BOOL fails, with strict booleans, unless the right operand of
+	// a logical operator on top of the stack is a boolean
+	OpCheckBool
+
+	// ARRAY n builds an array from the top n values
+	OpArray
+	// OBJECT n builds an object from n key and value pairs
+	OpObject
+	// GET_PROPERTY k reads the property named Constants[k]
+	OpGetProperty
+	// GET_INDEX reads object[index]
+	OpGetIndex
+
+	// CALL n calls the function below the top n arguments
+	OpCall
+	// CLOSURE k creates a closure over the proto Constants[k]
+	OpClosure
+	OpReturn
+
+	// TRY d installs a handler d bytes after the end of the instruction.
+	// When an error is caught there, the value the catch block binds is
+	// pushed onto the stack.
+	OpTry
+	// END_TRY removes the innermost handler
+	OpEndTry
+	OpThrow
+	// RAISE k fails with the runtime error message Constants[k]. It stands
+	// in for code the tree walker would reject while running it.
+	OpRaise
+
+	// IMPORT k pushes the exports of the module named by Constants[k]
+	OpImport
+	// IMPORT_NAME k n pushes the export Constants[n] of the exports on top,
+	// from the module named by Constants[k], leaving the exports in place
+	OpImportName
+	// DEFINE_IMPORT k pops the value on top into the constant global
+	// Constants[k], which may be null
+	OpDefineImport
+)
+
+// Definition describes an opcode for decoding and disassembly.
+type Definition struct {
+	Name string
+	// OperandWidths is the size in bytes of each operand
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"CONSTANT", []int{2}},
+	OpNull:     {"NULL", nil},
+	OpTrue:     {"TRUE", nil},
+	OpFalse:    {"FALSE", nil},
+	OpPop:      {"POP", nil},
+
+	OpDefineGlobal:      {"DEFINE_GLOBAL", []int{2}},
+	OpDefineConstGlobal: {"DEFINE_CONST_GLOBAL", []int{2}},
+	OpGetGlobal:         {"GET_GLOBAL", []int{2}},
+	OpSetGlobal:         {"SET_GLOBAL", []int{2}},
+
+	OpDefineLocal:      {"DEFINE_LOCAL", []int{2}},
+	OpDefineConstLocal: {"DEFINE_CONST_LOCAL", []int{2}},
+	OpGetLocal:         {"GET_LOCAL", []int{2}},
+	OpSetLocal:         {"SET_LOCAL", []int{2}},
+	OpGetUpvalue:       {"GET_UPVALUE", []int{2}},
+	OpSetUpvalue:       {"SET_UPVALUE", []int{2}},
+	OpCloseScope:       {"CLOSE_SCOPE", []int{2, 2}},
+
+	OpAdd:          {"ADD", nil},
+	OpSubtract:     {"SUBTRACT", nil},
+	OpMultiply:     {"MULTIPLY", nil},
+	OpDivide:       {"DIVIDE", nil},
+	OpModulo:       {"MODULO", nil},
+	OpEqual:        {"EQUAL", nil},
+	OpNotEqual:     {"NOT_EQUAL", nil},
+	OpIs:           {"IS", nil},
+	OpLess:         {"LESS", nil},
+	OpGreater:      {"GREATER", nil},
+	OpLessEqual:    {"LESS_EQUAL", nil},
+	OpGreaterEqual: {"GREATER_EQUAL", nil},
+	OpNegate:       {"NEGATE", nil},
+	OpNot:          {"NOT", nil},
+
+	OpJump:        {"JUMP", []int{2}},
+	OpJumpIfFalse: {"JUMP_IF_FALSE", []int{1, 2}},
+	OpLoop:        {"LOOP", []int{2}},
+	OpAnd:         {"AND", []int{2}},
+	OpOr:          {"OR", []int{2}},
+	OpCheckBool:   {"CHECK_BOOL", nil},
+
+	OpArray:       {"ARRAY", []int{2}},
+	OpObject:      {"OBJECT", []int{2}},
+	OpGetProperty: {"GET_PROPERTY", []int{2}},
+	OpGetIndex:    {"GET_INDEX", nil},
+
+	OpCall:    {"CALL", []int{1}},
+	OpClosure: {"CLOSURE", []int{2}},
+	OpReturn:  {"RETURN", nil},
+
+	OpTry:    {"TRY", []int{2}},
+	OpEndTry: {"END_TRY", nil},
+	OpThrow:  {"THROW", nil},
+	OpRaise:  {"RAISE", []int{2}},
+
+	OpImport:       {"IMPORT", []int{2}},
+	OpImportName:   {"IMPORT_NAME", []int{2, 2}},
+	OpDefineImport: {"DEFINE_IMPORT", []int{2}},
+}
+
+// Lookup returns the definition of op.
+func Lookup(op Opcode) (*Definition, error) {
+	def, ok := definitions[op]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d is not defined", op)
+	}
+	return def, nil
+}
+
+func (op Opcode) String() string {
+	if def, ok := definitions[op]; ok {
+		return def.Name
+	}
+	return fmt.Sprintf("OPCODE_%d", byte(op))
+}
+
+// Make encodes an instruction.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return nil
+	}
+
+	length := 1
+	for _, width := range def.OperandWidths {
+		length += width
+	}
+
+	instruction := make([]byte, length)
+	instruction[0] = byte(op)
+	offset := 1
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 1:
+			instruction[offset] = byte(operands[i])
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(operands[i]))
+		}
+		offset += width
+	}
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction defined by def from
+// code, which starts right after the opcode. It returns them with the
+// number of bytes they took.
+func ReadOperands(def *Definition, code []byte) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 1:
+			operands[i] = int(code[offset])
+		case 2:
+			operands[i] = int(binary.BigEndian.Uint16(code[offset:]))
+		}
+		offset += width
+	}
+	return operands, offset
+}
+
+// ConditionKind names the statement a JUMP_IF_FALSE tests the condition
+// of, for the error raised when strict booleans reject it.
+type ConditionKind byte
+
+const (
+	CondIf ConditionKind = iota
+	CondWhile
+	CondFor
+)
+
+func (k ConditionKind) String() string {
+	switch k {
+	case CondIf:
+		return "If statement"
+	case CondWhile:
+		return "While loop"
+	case CondFor:
+		return "For loop"
+	}
+	return fmt.Sprintf("ConditionKind(%d)", byte(k))
+}
@@ -0,0 +1,417 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	BE "pop/backend"
+	"pop/frontend/types/ast"
+)
+
+// Version is the version of the bytecode the compiler emits. It changes
+// whenever the instruction set or the .popc encoding does, or the code
+// programs compile to, which invalidates compiled files. TestVersion fails
+// when the instruction set or encoding changes without it; the compile
+// cache also keys on the build, so it never needs a bump.
+const Version = 3
+
+// Magic starts every .popc file.
+const Magic = "POPC"
+
+// headerSize is the size of the .popc header: the magic, the version, a
+// reserved flags field, the payload length and its CRC-32.
+const headerSize = len(Magic) + 2 + 2 + 4 + 4
+
+var (
+	// ErrNotBytecode is returned for data that is not a .popc file.
+	ErrNotBytecode = errors.New("not a compiled Popcorn file")
+	// ErrVersion is returned for .popc files of another bytecode version.
+	ErrVersion = errors.New("unsupported bytecode version")
+	// ErrChecksum is returned for .popc files that are truncated or
+	// corrupted.
+	ErrChecksum = errors.New("bytecode checksum mismatch")
+)
+
+// Program is a compiled program as stored in a .popc file.
+type Program struct {
+	// Proto is the program's top-level code
+	Proto *Proto
+	// Source is the text the program was compiled from. It is debug info:
+	// tracebacks quote it.
+	Source string
+}
+
+// IsBytecode reports whether data starts like a .popc file.
+func IsBytecode(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Magic))
+}
+
+// MarshalBinary encodes the program in the .popc format:
+//
+//	"POPC" | version u16 | flags u16 | payload length u32 | CRC-32 u32 | payload
+//
+// The payload holds the source followed by the top-level proto. A proto is
+// its name, file, position and parameters, its code, its constant pool
+// (numbers, strings and nested protos), then its debug info: the line
+// table, local names and upvalues. Integers in the payload are unsigned
+// varints and strings are prefixed with their length.
+func (p *Program) MarshalBinary() ([]byte, error) {
+	var e encoder
+	e.string(p.Source)
+	if err := e.proto(p.Proto); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, headerSize, headerSize+e.buf.Len())
+	copy(out, Magic)
+	binary.BigEndian.PutUint16(out[4:], Version)
+	binary.BigEndian.PutUint32(out[8:], uint32(e.buf.Len()))
+	binary.BigEndian.PutUint32(out[12:], crc32.ChecksumIEEE(e.buf.Bytes()))
+	return append(out, e.buf.Bytes()...), nil
+}
+
+// UnmarshalBinary decodes a .popc file and checks that its code is well
+// formed, see Verify.
+func (p *Program) UnmarshalBinary(data []byte) error {
+	if !IsBytecode(data) || len(data) < headerSize {
+		return ErrNotBytecode
+	}
+	if version := binary.BigEndian.Uint16(data[4:]); version != Version {
+		return fmt.Errorf("%w %d, this build runs version %d", ErrVersion, version, Version)
+	}
+	payload := data[headerSize:]
+	if int(binary.BigEndian.Uint32(data[8:])) != len(payload) || binary.BigEndian.Uint32(data[12:]) != crc32.ChecksumIEEE(payload) {
+		return ErrChecksum
+	}
+
+	d := decoder{data: payload}
+	source := d.string()
+	proto := d.proto()
+	if d.err != nil {
+		return d.err
+	}
+	if d.pos != len(d.data) {
+		return fmt.Errorf("malformed bytecode: %d trailing bytes", len(d.data)-d.pos)
+	}
+	if err := Verify(proto); err != nil {
+		return err
+	}
+
+	p.Proto, p.Source = proto, source
+	return nil
+}
+
+// Constant pool entry tags
+const (
+	tagNumber byte = 'n'
+	tagString byte = 's'
+	tagProto  byte = 'f'
+)
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) uint(n int) {
+	e.buf.Write(binary.AppendUvarint(nil, uint64(n)))
+}
+
+func (e *encoder) string(s string) {
+	e.uint(len(s))
+	e.buf.WriteString(s)
+}
+
+func (e *encoder) bool(b bool) {
+	if b {
+		e.buf.WriteByte(1)
+	} else {
+		e.buf.WriteByte(0)
+	}
+}
+
+func (e *encoder) position(pos ast.Position) {
+	e.uint(pos.Line)
+	e.uint(pos.Column)
+}
+
+func (e *encoder) proto(p *Proto) error {
+	e.string(p.Name)
+	e.string(p.File)
+	e.position(p.Pos)
+	e.uint(len(p.Params))
+	for _, param := range p.Params {
+		e.string(param)
+	}
+
+	e.uint(len(p.Code))
+	e.buf.Write(p.Code)
+
+	e.uint(len(p.Constants))
+	for _, constant := range p.Constants {
+		switch c := constant.(type) {
+		case BE.NumberVal:
+			e.buf.WriteByte(tagNumber)
+			e.buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(c.Value)))
+		case BE.StringVal:
+			e.buf.WriteByte(tagString)
+			e.string(c.Value)
+		case *Proto:
+			e.buf.WriteByte(tagProto)
+			if err := e.proto(c); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("cannot encode constant %v of %s", constant, p.Name)
+		}
+	}
+
+	e.uint(len(p.Lines))
+	for _, line := range p.Lines {
+		e.uint(line.Offset)
+		e.position(line.Pos)
+	}
+	e.uint(len(p.Locals))
+	for _, local := range p.Locals {
+		e.string(local.Name)
+		e.bool(local.Const)
+	}
+	e.uint(len(p.Upvalues))
+	for _, up := range p.Upvalues {
+		e.string(up.Name)
+		e.uint(up.Index)
+		e.bool(up.IsLocal)
+		e.bool(up.Const)
+	}
+	return nil
+}
+
+// decoder reads a payload. The first error sticks and later reads return
+// zero values.
+type decoder struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (d *decoder) fail(format string, args ...any) {
+	if d.err == nil {
+		d.err = fmt.Errorf("malformed bytecode: "+format, args...)
+	}
+}
+
+func (d *decoder) uint() int {
+	if d.err != nil {
+		return 0
+	}
+	n, read := binary.Uvarint(d.data[d.pos:])
+	if read <= 0 || n > math.MaxInt32 {
+		d.fail("bad integer at %d", d.pos)
+		return 0
+	}
+	d.pos += read
+	return int(n)
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > len(d.data)-d.pos {
+		d.fail("unexpected end of data at %d", d.pos)
+		return nil
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b
+}
+
+// count reads the length of a list whose entries take at least one byte
+// each, so a corrupt length cannot make the decoder allocate a huge slice.
+func (d *decoder) count() int {
+	n := d.uint()
+	if n > len(d.data)-d.pos {
+		d.fail("list of %d entries at %d is longer than the data", n, d.pos)
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes(d.uint()))
+}
+
+func (d *decoder) bool() bool {
+	b := d.bytes(1)
+	return len(b) == 1 && b[0] != 0
+}
+
+func (d *decoder) position() ast.Position {
+	return ast.Position{Line: d.uint(), Column: d.uint()}
+}
+
+func (d *decoder) proto() *Proto {
+	p := &Proto{Name: d.string(), File: d.string(), Pos: d.position()}
+	p.Params = make([]string, d.count())
+	for i := range p.Params {
+		p.Params[i] = d.string()
+	}
+
+	p.Code = append([]byte(nil), d.bytes(d.uint())...)
+
+	p.Constants = make([]BE.RuntimeVal, d.count())
+	for i := range p.Constants {
+		tag := d.bytes(1)
+		if d.err != nil {
+			return p
+		}
+		switch tag[0] {
+		case tagNumber:
+			if b := d.bytes(8); b != nil {
+				p.Constants[i] = BE.NumberVal{Value: math.Float64frombits(binary.BigEndian.Uint64(b))}
+			}
+		case tagString:
+			p.Constants[i] = BE.StringVal{Value: d.string()}
+		case tagProto:
+			p.Constants[i] = d.proto()
+		default:
+			d.fail("unknown constant tag %q", tag[0])
+			return p
+		}
+	}
+
+	p.Lines = make([]LineInfo, d.count())
+	for i := range p.Lines {
+		p.Lines[i] = LineInfo{Offset: d.uint(), Pos: d.position()}
+	}
+	p.Locals = make([]Local, d.count())
+	for i := range p.Locals {
+		p.Locals[i] = Local{Name: d.string(), Const: d.bool()}
+	}
+	p.Upvalues = make([]Upvalue, d.count())
+	for i := range p.Upvalues {
+		p.Upvalues[i] = Upvalue{Name: d.string(), Index: d.uint(), IsLocal: d.bool(), Const: d.bool()}
+	}
+	return p
+}
+
+// Verify checks that the code of proto and of the functions nested in it
+// only uses defined opcodes, and operands that refer to constants, slots,
+// upvalues and jump targets that exist. Bytecode that was not produced by
+// Compile, such as a .popc file, has to pass it before the VM runs it.
+// It does not check that the code keeps the stack balanced, which Compile
+// guarantees, so only run .popc files from builds you trust.
+func Verify(proto *Proto) error {
+	for _, p := range protos(proto) {
+		if err := verifyProto(p); err != nil {
+			return fmt.Errorf("invalid bytecode in %s: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+func verifyProto(p *Proto) error {
+	starts := map[int]bool{}
+	var jumps []Instruction
+	last := Opcode(0)
+	for offset := 0; offset < len(p.Code); {
+		op := Opcode(p.Code[offset])
+		def, err := Lookup(op)
+		if err != nil {
+			return fmt.Errorf("%04d: %w", offset, err)
+		}
+		width := 1
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if offset+width > len(p.Code) {
+			return fmt.Errorf("%04d: %s is cut short", offset, op)
+		}
+		operands, _ := ReadOperands(def, p.Code[offset+1:])
+		in := Instruction{Offset: offset, Op: op, Operands: operands}
+		starts[offset] = true
+		if err := verifyOperands(p, in); err != nil {
+			return fmt.Errorf("%04d: %s %w", offset, op, err)
+		}
+		switch op {
+		case OpJump, OpJumpIfFalse, OpLoop, OpAnd, OpOr, OpTry:
+			jumps = append(jumps, in)
+		}
+		last = op
+		offset += width
+	}
+
+	if last != OpReturn {
+		return errors.New("code does not end with RETURN")
+	}
+	for _, in := range jumps {
+		distance := in.Operands[len(in.Operands)-1]
+		target := in.Offset + in.Width() + distance
+		if in.Op == OpLoop {
+			target = in.Offset + in.Width() - distance
+		}
+		if !starts[target] {
+			return fmt.Errorf("%04d: %s jumps to %04d, which is not an instruction", in.Offset, in.Op, target)
+		}
+	}
+	return nil
+}
+
+func verifyOperands(p *Proto, in Instruction) error {
+	constant := func(k int) (BE.RuntimeVal, error) {
+		if k >= len(p.Constants) {
+			return nil, fmt.Errorf("refers to constant %d of %d", k, len(p.Constants))
+		}
+		return p.Constants[k], nil
+	}
+
+	switch in.Op {
+	case OpConstant:
+		_, err := constant(in.Operands[0])
+		return err
+	case OpDefineGlobal, OpDefineConstGlobal, OpGetGlobal, OpSetGlobal, OpGetProperty, OpRaise,
+		OpImport, OpImportName, OpDefineImport:
+		for _, k := range in.Operands {
+			c, err := constant(k)
+			if err != nil {
+				return err
+			}
+			if _, ok := c.(BE.StringVal); !ok {
+				return fmt.Errorf("needs a string constant, got %v", c)
+			}
+		}
+	case OpClosure:
+		c, err := constant(in.Operands[0])
+		if err != nil {
+			return err
+		}
+		child, ok := c.(*Proto)
+		if !ok {
+			return fmt.Errorf("needs a function constant, got %v", c)
+		}
+		for _, up := range child.Upvalues {
+			if up.IsLocal && up.Index >= len(p.Locals) || !up.IsLocal && up.Index >= len(p.Upvalues) {
+				return fmt.Errorf("captures %s from a slot that does not exist", up.Name)
+			}
+		}
+	case OpDefineLocal, OpDefineConstLocal, OpGetLocal, OpSetLocal:
+		if in.Operands[0] >= len(p.Locals) {
+			return fmt.Errorf("refers to slot %d of %d", in.Operands[0], len(p.Locals))
+		}
+	case OpGetUpvalue, OpSetUpvalue:
+		if in.Operands[0] >= len(p.Upvalues) {
+			return fmt.Errorf("refers to upvalue %d of %d", in.Operands[0], len(p.Upvalues))
+		}
+	case OpCloseScope:
+		if in.Operands[0]+in.Operands[1] > len(p.Locals) {
+			return fmt.Errorf("closes slots past the %d of the frame", len(p.Locals))
+		}
+	case OpJumpIfFalse:
+		if in.Operands[0] > int(CondFor) {
+			return fmt.Errorf("has unknown condition kind %d", in.Operands[0])
+		}
+	}
+	return nil
+}
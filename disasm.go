@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	BE "pop/backend"
+	"pop/compiler"
+	FE "pop/frontend"
+	"pop/resolver"
+)
+
+// disasm prints the bytecode the compiler generates for each file.
+func disasm(opts BE.Options, args []string) int {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: popcorn disasm file.pop...\n\nPrints the bytecode compiled from each file, or stored in each .popc file.\n")
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	for i, path := range flags.Args() {
+		proto, err := compileFile(path, opts.Optimizer)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error compiling %s: %v\n", path, err)
+			return 1
+		}
+		if i > 0 {
+			fmt.Fprintln(opts.Stdout)
+		}
+		fmt.Fprint(opts.Stdout, compiler.Disassemble(proto))
+	}
+	return 0
+}
+
+// compileFile parses, optimizes and compiles a source file, or loads a
+// .popc file.
+func compileFile(path string, optimizer BE.Optimizer) (*compiler.Proto, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if compiler.IsBytecode(data) {
+		var program compiler.Program
+		if err := program.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+		return program.Proto, nil
+	}
+	return compileSource(path, string(data), optimizer)
+}
+
+// compileSource parses, resolves, optimizes and compiles source read from
+// path. It resolves the source as written, since the passes can remove the
+// code that uses a variable wrongly.
+func compileSource(path, source string, optimizer BE.Optimizer) (*compiler.Proto, error) {
+	program, err := FE.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	// The code runs with the built-ins as its only globals
+	builtins := BE.MakeGlobalEnvironment()
+	_, err = resolver.Resolve(program, resolver.Options{Globals: func(name string) bool {
+		_, ok := builtins.LookupVar(name)
+		return ok
+	}})
+	if err != nil {
+		return nil, err
+	}
+	if optimizer != nil {
+		program = optimizer.Optimize(program)
+	}
+	return compiler.Compile(program, compiler.Options{File: path})
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	BE "pop/backend"
+	"pop/format"
+	"pop/packages"
+	"strings"
+)
+
+// formatFiles formats source files in place, or reports those that are not
+// formatted.
+func formatFiles(_ BE.Options, args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	check := flags.Bool("check", false, "list the files that are not formatted instead of formatting them, and fail if there are any")
+	diff := flags.Bool("diff", false, "print the changes formatting would make instead of making them, and fail if there are any")
+	width := flags.Int("width", format.DefaultWidth, "the line width lists are wrapped to fit in")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: popcorn fmt [-check] [-diff] [-width columns] [path...]\n\nFormats the .pop files given, and those in the directories given, in place.\nWith no path, formats the current directory; with -, formats the standard\ninput to the standard output.\n\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	// Accept the flags after the paths too
+	flags.Parse(args)
+	var paths []string
+	for flags.NArg() > 0 {
+		paths = append(paths, flags.Arg(0))
+		flags.Parse(flags.Args()[1:])
+	}
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	opts := format.Options{Width: *width}
+
+	if len(paths) == 1 && paths[0] == "-" {
+		source, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading standard input: %v\n", err)
+			return 1
+		}
+		return formatFile("<stdin>", string(source), opts, *check, *diff, func(formatted string) error {
+			_, err := io.WriteString(os.Stdout, formatted)
+			return err
+		})
+	}
+
+	files, err := sourceFiles(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	status := 0
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", file, err)
+			status = 1
+			continue
+		}
+		code := formatFile(file, string(source), opts, *check, *diff, func(formatted string) error {
+			if formatted == string(source) {
+				return nil
+			}
+			return os.WriteFile(file, []byte(formatted), 0o644)
+		})
+		status = max(status, code)
+	}
+	return status
+}
+
+// formatFile formats the source of the file name and writes it with write,
+// or with check or diff reports whether it is formatted. It returns the exit
+// status.
+func formatFile(name, source string, opts format.Options, check, diff bool, write func(formatted string) error) int {
+	formatted, err := format.Source(source, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return 1
+	}
+	if !check && !diff {
+		if err := write(formatted); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", name, err)
+			return 1
+		}
+		return 0
+	}
+
+	if formatted == source {
+		return 0
+	}
+	if check {
+		fmt.Println(name)
+	}
+	if diff {
+		fmt.Print(format.Diff(name, source, formatted))
+	}
+	return 1
+}
+
+// sourceFiles returns the files of paths, with the .pop files under those
+// that are directories in their place.
+func sourceFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			// Skip hidden directories, like .git, but not the current one, and
+			// installed packages
+			if entry.IsDir() && file != path && (strings.HasPrefix(entry.Name(), ".") || entry.Name() == packages.ModulesDir) {
+				return filepath.SkipDir
+			}
+			if !entry.IsDir() && strings.HasSuffix(file, ".pop") {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,148 @@
+package format
+
+import (
+	"fmt"
+	"strings"
+)
+
+// context is the number of unchanged lines shown around each change.
+const context = 3
+
+// Diff returns the changes from a to b as a unified diff of the file name,
+// or "" if they are the same.
+func Diff(name, a, b string) string {
+	return DiffNamed(name, name, a, b)
+}
+
+// DiffNamed is Diff for texts with names of their own, such as the
+// expected and actual values of a test.
+func DiffNamed(aName, bName, a, b string) string {
+	if a == b {
+		return ""
+	}
+	old, new := splitLines(a), splitLines(b)
+	edits := diffLines(old, new)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+	for start := 0; start < len(edits); {
+		// A hunk runs from context lines before a change to context lines
+		// after the last change less than twice that far from the one before
+		for start < len(edits) && edits[start].op == ' ' {
+			start++
+		}
+		if start == len(edits) {
+			break
+		}
+		from := max(start-context, 0)
+		end := start
+		for i := start; i < len(edits) && i-end <= 2*context; i++ {
+			if edits[i].op != ' ' {
+				end = i + 1
+			}
+		}
+		to := min(end+context, len(edits))
+
+		oldStart, newStart := edits[from].old, edits[from].new
+		oldCount, newCount := 0, 0
+		for _, e := range edits[from:to] {
+			if e.op != '+' {
+				oldCount++
+			}
+			if e.op != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+		for _, e := range edits[from:to] {
+			out.WriteByte(e.op)
+			out.WriteString(e.line)
+			out.WriteByte('\n')
+			if e.missingNewline {
+				out.WriteString("\\ No newline at end of file\n")
+			}
+		}
+		start = to
+	}
+	return out.String()
+}
+
+// edit is a line kept (' '), removed ('-') or added ('+'), with the
+// 0-based index of the line in the old and the new text it is at.
+type edit struct {
+	op             byte
+	line           string
+	old, new       int
+	missingNewline bool
+}
+
+// diffLines finds the edits from a to b keeping their longest common
+// subsequence of lines.
+func diffLines(a, b []sourceLine) []edit {
+	// lcs[i][j] is the length of that of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var edits []edit
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i].text, i, j, a[i].last})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{'-', a[i].text, i, j, a[i].last})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j].text, i, j, b[j].last})
+			j++
+		}
+	}
+	return edits
+}
+
+// sourceLine is a line of text, and whether it is the last and has no
+// newline after it.
+type sourceLine struct {
+	text string
+	last bool
+}
+
+func splitLines(s string) []sourceLine {
+	if s == "" {
+		return nil
+	}
+	texts := strings.SplitAfter(s, "\n")
+	if texts[len(texts)-1] == "" {
+		texts = texts[:len(texts)-1]
+	}
+	lines := make([]sourceLine, len(texts))
+	for i, text := range texts {
+		lines[i] = sourceLine{text: strings.TrimSuffix(text, "\n"), last: !strings.HasSuffix(text, "\n")}
+	}
+	return lines
+}
+
+// hunkRange returns the 1-based start and the count of lines of a hunk,
+// from the 0-based start. An empty range starts at the line before.
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprint(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
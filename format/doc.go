@@ -0,0 +1,219 @@
+package format
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// doc is a layout the renderer fits into the line width: text, line
+// breaks, and groups whose breaks are either all taken or all left out,
+// depending on whether the group fits on the rest of the line.
+type doc interface{}
+
+// text is printed as it is. It never holds a newline.
+type text string
+
+// line is a break in a group. Unless the group breaks, a plain line is a
+// space and a soft one is nothing; a hard line always breaks, and so does
+// every group around it.
+type line struct {
+	soft, hard bool
+}
+
+var (
+	space    = line{}
+	softline = line{soft: true}
+	hardline = line{hard: true}
+)
+
+type concat []doc
+
+// nest indents the lines that break in body by one level.
+type nest struct {
+	body doc
+}
+
+type group struct {
+	body doc
+	// broken is set if body cannot be flat, as it holds a hard line
+	broken bool
+}
+
+// ifBreak is broken in a group that breaks and flat in one that does not.
+type ifBreak struct {
+	broken, flat doc
+}
+
+// breakParent breaks the groups around it, e.g. after a line comment.
+type breakParent struct{}
+
+func cat(docs ...doc) concat {
+	return concat(docs)
+}
+
+func grouped(docs ...doc) group {
+	body := cat(docs...)
+	return group{body: body, broken: hasHardLine(body)}
+}
+
+// broken returns a group that always breaks.
+func broken(docs ...doc) group {
+	return group{body: cat(docs...), broken: true}
+}
+
+func hasHardLine(d doc) bool {
+	switch d := d.(type) {
+	case line:
+		return d.hard
+	case breakParent:
+		return true
+	case concat:
+		for _, part := range d {
+			if hasHardLine(part) {
+				return true
+			}
+		}
+	case nest:
+		return hasHardLine(d.body)
+	case group:
+		return d.broken
+	case ifBreak:
+		return hasHardLine(d.broken) || hasHardLine(d.flat)
+	}
+	return false
+}
+
+// frame is a doc to render, at an indentation level, in a group that is
+// flat or breaks.
+type frame struct {
+	indent int
+	flat   bool
+	doc    doc
+}
+
+// render lays d out to fit in width columns where it can, indenting each
+// level by indent.
+func render(d doc, width int, indent string) string {
+	var out strings.Builder
+	column := 0
+	// Indentation is written with the first text of a line, so that empty
+	// lines get none
+	pending := -1
+
+	stack := []frame{{doc: d}}
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		switch d := f.doc.(type) {
+		case nil, breakParent:
+		case text:
+			if d == "" {
+				continue
+			}
+			if pending >= 0 {
+				out.WriteString(strings.Repeat(indent, pending))
+				column = pending * utf8.RuneCountInString(indent)
+				pending = -1
+			}
+			out.WriteString(string(d))
+			column += utf8.RuneCountInString(string(d))
+		case concat:
+			for i := len(d) - 1; i >= 0; i-- {
+				stack = append(stack, frame{f.indent, f.flat, d[i]})
+			}
+		case nest:
+			stack = append(stack, frame{f.indent + 1, f.flat, d.body})
+		case group:
+			flat := f.flat || !d.broken && fits(frame{f.indent, true, d.body}, stack, width-column)
+			stack = append(stack, frame{f.indent, flat, d.body})
+		case ifBreak:
+			if f.flat {
+				stack = append(stack, frame{f.indent, f.flat, d.flat})
+			} else {
+				stack = append(stack, frame{f.indent, f.flat, d.broken})
+			}
+		case line:
+			switch {
+			case f.flat && !d.hard && !d.soft:
+				out.WriteString(" ")
+				column++
+			case f.flat && !d.hard:
+			default:
+				out.WriteString("\n")
+				column = 0
+				pending = f.indent
+			}
+		}
+	}
+	return out.String()
+}
+
+// fits reports whether next, laid out flat, and what follows it in rest up
+// to the next line break fit in width columns.
+func fits(next frame, rest []frame, width int) bool {
+	stack := []frame{next}
+	for width >= 0 {
+		if len(stack) == 0 {
+			if len(rest) == 0 {
+				return true
+			}
+			stack = append(stack, rest[len(rest)-1])
+			rest = rest[:len(rest)-1]
+			continue
+		}
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		switch d := f.doc.(type) {
+		case text:
+			width -= utf8.RuneCountInString(string(d))
+		case concat:
+			for i := len(d) - 1; i >= 0; i-- {
+				stack = append(stack, frame{f.indent, f.flat, d[i]})
+			}
+		case nest:
+			stack = append(stack, frame{f.indent, f.flat, d.body})
+		case group:
+			stack = append(stack, frame{f.indent, f.flat && !d.broken, d.body})
+		case ifBreak:
+			if f.flat {
+				stack = append(stack, frame{f.indent, f.flat, d.flat})
+			} else {
+				stack = append(stack, frame{f.indent, f.flat, d.broken})
+			}
+		case line:
+			if !f.flat || d.hard {
+				return true
+			}
+			if !d.soft {
+				width--
+			}
+		}
+	}
+	return false
+}
+
+// empty reports whether d prints nothing.
+func empty(d doc) bool {
+	switch d := d.(type) {
+	case nil, breakParent:
+		return true
+	case text:
+		return d == ""
+	case concat:
+		for _, part := range d {
+			if !empty(part) {
+				return false
+			}
+		}
+		return true
+	case nest:
+		return empty(d.body)
+	case group:
+		return empty(d.body)
+	case ifBreak:
+		return empty(d.broken) && empty(d.flat)
+	}
+	return false
+}
@@ -0,0 +1,594 @@
+// Package format prints Popcorn source code in one canonical layout, the
+// way gofmt does for Go:
+//
+//	formatted, err := format.Source(source, format.Options{})
+//
+// Statements go one per line, indented two spaces per block, with braces on
+// the line of the statement they belong to and `else` and `catch` after the
+// closing brace. Operators are surrounded by spaces, and parentheses are
+// kept only where they change the meaning. Arrays, objects, calls and
+// parameter lists stay on one line if they fit in the line width, and are
+// otherwise split one item per line, each followed by a comma. Objects
+// written across lines stay that way.
+//
+// Comments are kept where they are, from the tokens of the lexer, which
+// the parser never sees. At most one blank line between statements is kept.
+package format
+
+import (
+	"fmt"
+	FE "pop/frontend"
+	"pop/frontend/types/ast"
+	"pop/frontend/types/tokens"
+	"sort"
+	"strings"
+)
+
+// DefaultWidth is the line width when Options.Width is not set.
+const DefaultWidth = 80
+
+// indent is one level of indentation.
+const indent = "  "
+
+type Options struct {
+	// Width is the number of columns lists are split to fit in
+	Width int
+}
+
+// Source returns source formatted. It fails with a *frontend.SyntaxError
+// if source does not parse.
+func Source(source string, opts Options) (string, error) {
+	program, err := FE.Parse(source)
+	if err != nil {
+		return "", err
+	}
+	width := opts.Width
+	if width <= 0 {
+		width = DefaultWidth
+	}
+
+	p := newPrinter(source)
+	formatted := render(p.program(program), width, indent)
+
+	// A formatter that changes what a program means, or drops a comment,
+	// is worse than none
+	again, err := FE.Parse(formatted)
+	if err != nil {
+		return "", fmt.Errorf("formatting produced code that does not parse: %w", err)
+	}
+	if !sameNode(program, again) {
+		return "", fmt.Errorf("formatting changed the program")
+	}
+	if !equalStrings(comments(source), comments(formatted)) {
+		return "", fmt.Errorf("formatting lost a comment")
+	}
+	return formatted, nil
+}
+
+// printer lays out a program as a doc. The AST locates each node by its
+// first token, so the printer looks at the tokens to find closing braces
+// and comments.
+type printer struct {
+	lines  []string
+	tokens []tokens.Token
+	// comments are the comments of the source, and next the index of the
+	// first one not printed yet
+	comments []tokens.Token
+	next     int
+}
+
+func newPrinter(source string) *printer {
+	p := &printer{lines: strings.Split(source, "\n")}
+	all, _ := FE.LexTrivia(source)
+	for _, tk := range all {
+		if tk.TokenType == tokens.Comment {
+			p.comments = append(p.comments, tk)
+		} else {
+			p.tokens = append(p.tokens, tk)
+		}
+	}
+	return p
+}
+
+func (p *printer) program(program ast.Program) doc {
+	body := concat{}
+	for i, stmt := range program.Body {
+		start := startOf(stmt)
+		if i > 0 {
+			body = append(body, p.trailing(start), hardline)
+		}
+		body = append(body, p.leading(start, i == 0)...)
+		body = append(body, p.statement(stmt))
+	}
+
+	end := ast.Position{Line: len(p.lines) + 1}
+	body = append(body, p.trailing(end))
+	if p.next < len(p.comments) {
+		if len(program.Body) > 0 {
+			body = append(body, hardline)
+		}
+		body = append(body, p.ownLine(end, len(program.Body) == 0)...)
+	} else if len(program.Body) > 0 {
+		body = append(body, hardline)
+	}
+	return body
+}
+
+// block prints the statements of the block opened by the brace at open.
+func (p *printer) block(stmts []ast.ASTNode, open ast.Position) doc {
+	closing := p.closing(open)
+	body := concat{}
+	for i, stmt := range stmts {
+		start := startOf(stmt)
+		body = append(body, p.trailing(start), hardline)
+		body = append(body, p.leading(start, i == 0)...)
+		body = append(body, p.statement(stmt))
+	}
+	body = append(body, p.trailing(closing))
+	for _, comment := range p.ownLine(closing, len(stmts) == 0) {
+		// Comments before the closing brace end the block
+		if comment != hardline {
+			body = append(body, hardline, comment)
+		}
+	}
+	if empty(body) {
+		return text("{}")
+	}
+	return cat(text("{"), nest{body}, hardline, text("}"))
+}
+
+func (p *printer) statement(node ast.ASTNode) doc {
+	switch n := node.(type) {
+	case ast.VariableDeclarationNode:
+		keyword := "let "
+		if n.Constant {
+			keyword = "const "
+		}
+		if n.Exported {
+			keyword = "export " + keyword
+		}
+		name := keyword + n.Identifier + annotation(n.Type)
+		if n.Value == nil {
+			return text(name)
+		}
+		return cat(text(name+" = "), p.expr(n.Value, precAssignment))
+	case ast.FunctionDeclarationNode:
+		if n.TestName != "" {
+			return cat(text("test "+p.literal(n.NamePos)+" "), p.block(n.Body, p.after(n.NamePos, tokens.OpenBrace)))
+		}
+		open := p.after(n.Pos, tokens.OpenParen)
+		params := p.list(open, "(", ")", false, n.ParamPos, func(i int) doc {
+			if i < len(n.ParamTypes) {
+				return text(n.Params[i] + annotation(n.ParamTypes[i]))
+			}
+			return text(n.Params[i])
+		})
+		body := p.body(p.closing(open))
+		keyword := "fn "
+		if n.Exported {
+			keyword = "export fn "
+		}
+		return cat(text(keyword+n.Name), params, text(annotation(n.ReturnType)+" "), p.block(n.Body, body))
+	case ast.TypeAliasNode:
+		return text("type " + n.Name + " = " + n.Type.String())
+	case ast.ImportDeclarationNode:
+		from := text(" from " + p.literal(n.SpecifierPos))
+		if n.Default {
+			return cat(text("import "+n.Namespace), from)
+		}
+		if n.Namespace != "" {
+			return cat(text("import * as "+n.Namespace), from)
+		}
+		starts := make([]ast.Position, len(n.Names))
+		for i, name := range n.Names {
+			starts[i] = name.Pos
+		}
+		open := p.after(n.Pos, tokens.OpenBrace)
+		names := p.list(open, "{", "}", p.brokenAfter(open), starts, func(i int) doc {
+			if name := n.Names[i]; name.Local != name.Name {
+				return text(name.Name + " as " + name.Local)
+			}
+			return text(n.Names[i].Name)
+		})
+		return cat(text("import "), names, from)
+	case ast.ReturnStatementNode:
+		if n.Value == nil {
+			return text("pop")
+		}
+		return cat(text("pop "), p.expr(n.Value, precAssignment))
+	case ast.ThrowStatementNode:
+		return cat(text("throw "), p.expr(n.Value, precAssignment))
+	case ast.IfStatementNode:
+		d := cat(text("if "), p.expr(n.Condition, precAssignment), text(" "), p.blockNode(n.Consequent))
+		switch alternate := n.Alternate.(type) {
+		case nil:
+		case ast.IfStatementNode:
+			d = append(d, text(" else "), p.statement(alternate))
+		default:
+			d = append(d, text(" else "), p.blockNode(alternate))
+		}
+		return d
+	case ast.WhileStatementNode:
+		return cat(text("while "), p.expr(n.Condition, precAssignment), text(" "), p.blockNode(n.Body))
+	case ast.ForStatementNode:
+		return cat(text("for ("), p.statement(n.Init), text("; "), p.expr(n.Condition, precAssignment), text("; "),
+			p.expr(n.Update, precAssignment), text(") "), p.blockNode(n.Body))
+	case ast.TryStatementNode:
+		catch := " catch "
+		if n.Param != "" {
+			catch += n.Param + " "
+		}
+		return cat(text("try "), p.blockNode(n.Body), text(catch), p.blockNode(n.Handler))
+	}
+	return p.expr(node, precAssignment)
+}
+
+func (p *printer) blockNode(node ast.ASTNode) doc {
+	block := node.(ast.BlockStatementNode)
+	return p.block(block.Body, block.Pos)
+}
+
+// The precedence of each level of expression, from the loosest binding.
+// Objects sit between comparisons and sums in the grammar, but can only
+// start an expression when that ends with them.
+const (
+	precAssignment = iota + 1
+	precLogical
+	precComparison
+	precAdditive
+	precMultiplicative
+	precUnary
+	precCall
+	precMember
+)
+
+func precedence(node ast.ASTNode) int {
+	switch n := node.(type) {
+	case ast.AssignmentExprNode:
+		return precAssignment
+	case ast.LogicalExprNode:
+		return precLogical
+	case ast.BinaryExprNode:
+		switch n.Operator {
+		case "+", "-":
+			return precAdditive
+		case "*", "/", "%":
+			return precMultiplicative
+		}
+		return precComparison
+	case ast.UnaryExprNode:
+		return precUnary
+	case ast.CallExprNode:
+		return precCall
+	}
+	return precMember
+}
+
+// expr prints node, in parentheses if it binds looser than min.
+func (p *printer) expr(node ast.ASTNode, min int) doc {
+	d := p.bare(node)
+	if precedence(node) < min {
+		return cat(text("("), d, text(")"))
+	}
+	return d
+}
+
+// operand prints the left operand of an arithmetic operator, or the object
+// or function a member or call is of, in parentheses if it binds looser
+// than min or starts with an object, which would be taken for an object
+// expression on its own.
+func (p *printer) operand(node ast.ASTNode, min int) doc {
+	if _, ok := leftmost(node).(ast.ObjectLiteralExprNode); ok {
+		return cat(text("("), p.bare(node), text(")"))
+	}
+	return p.expr(node, min)
+}
+
+func leftmost(node ast.ASTNode) ast.ASTNode {
+	switch n := node.(type) {
+	case ast.BinaryExprNode:
+		return leftmost(n.Left)
+	case ast.LogicalExprNode:
+		return leftmost(n.Left)
+	case ast.AssignmentExprNode:
+		return leftmost(n.Assignee)
+	case ast.CallExprNode:
+		return leftmost(n.Caller)
+	case ast.MemberExprNode:
+		return leftmost(n.Object)
+	case ast.IndexExprNode:
+		return leftmost(n.Object)
+	}
+	return node
+}
+
+func (p *printer) bare(node ast.ASTNode) doc {
+	switch n := node.(type) {
+	case ast.AssignmentExprNode:
+		return cat(p.expr(n.Assignee, precLogical), text(" = "), p.expr(n.Value, precAssignment))
+	case ast.LogicalExprNode:
+		return cat(p.expr(n.Left, precLogical), text(" "+string(n.Operator)+" "), p.expr(n.Right, precLogical+1))
+	case ast.BinaryExprNode:
+		prec := precedence(n)
+		left := p.expr(n.Left, prec)
+		if prec > precComparison {
+			left = p.operand(n.Left, prec)
+		}
+		return cat(left, text(" "+string(n.Operator)+" "), p.expr(n.Right, prec+1))
+	case ast.UnaryExprNode:
+		return cat(text(string(n.Operator)), p.expr(n.Operand, precUnary))
+	case ast.CallExprNode:
+		caller := p.operand(n.Caller, precCall)
+		return cat(caller, p.list(n.Pos, "(", ")", false, starts(n.Args), func(i int) doc {
+			return p.expr(n.Args[i], precAssignment)
+		}))
+	case ast.MemberExprNode:
+		object := p.operand(n.Object, precMember)
+		if n.Computed {
+			return cat(object, text("["), p.expr(n.Property, precAssignment), text("]"))
+		}
+		return cat(object, text("."), p.bare(n.Property))
+	case ast.IndexExprNode:
+		return cat(p.operand(n.Object, precMember), text("["), p.expr(n.Index, precAssignment), text("]"))
+	case ast.IdentifierExprNode:
+		return text(n.Symbol)
+	case ast.NumericLiteralExprNode, ast.StringLiteralExprNode:
+		// As written, with the digits and escapes of the source
+		return text(p.literal(ast.PositionOf(n)))
+	case ast.BooleanLiteralExprNode:
+		return text(fmt.Sprint(n.Value))
+	case ast.NullLiteralExprNode:
+		return text("null")
+	case ast.ArrayLiteralExprNode:
+		return p.list(n.Pos, "[", "]", false, starts(n.Elements), func(i int) doc {
+			return p.expr(n.Elements[i], precAssignment)
+		})
+	case ast.ObjectLiteralExprNode:
+		keys := make([]ast.Position, len(n.Properties))
+		for i, property := range n.Properties {
+			keys[i] = property.Pos
+		}
+		return p.list(n.Pos, "{", "}", p.brokenAfter(n.Pos), keys, func(i int) doc {
+			property := n.Properties[i]
+			if property.Value == nil {
+				return text(property.Key)
+			}
+			return cat(text(property.Key+": "), p.expr(property.Value, precAssignment))
+		})
+	}
+	panic(fmt.Sprintf("cannot format %T", node))
+}
+
+// list prints the items starting at starts between the brackets open and
+// close, the opening one at pos. Items are printed by item as the comments
+// before them are. Objects have spaces inside their braces, and keepBroken
+// keeps an object on several lines.
+func (p *printer) list(pos ast.Position, open, close string, keepBroken bool, starts []ast.Position, item func(i int) doc) doc {
+	closing := p.closing(pos)
+	edge := softline
+	if open == "{" {
+		edge = space
+	}
+
+	body := concat{}
+	for i := range starts {
+		if i > 0 {
+			body = append(body, text(","), p.trailing(starts[i]), space)
+		} else {
+			body = append(body, p.trailing(starts[i]), edge)
+		}
+		body = append(body, p.ownLine(starts[i], true)...)
+		body = append(body, item(i))
+	}
+	if len(starts) > 0 {
+		body = append(body, ifBreak{broken: text(",")})
+	}
+	body = append(body, p.trailing(closing))
+	for _, comment := range p.ownLine(closing, true) {
+		if comment != hardline {
+			body = append(body, hardline, comment)
+		}
+	}
+
+	if empty(body) {
+		return text(open + close)
+	}
+	if len(starts) == 0 {
+		edge = softline
+	}
+	if keepBroken && len(starts) > 0 {
+		return broken(text(open), nest{body}, edge, text(close))
+	}
+	return grouped(text(open), nest{body}, edge, text(close))
+}
+
+// trailing prints the comments before pos that follow code on their line,
+// after what was printed last.
+func (p *printer) trailing(pos ast.Position) doc {
+	d := concat{}
+	for p.next < len(p.comments) {
+		comment := p.comments[p.next]
+		if !before(tokenPos(comment), pos) || !p.followsCode(comment) {
+			break
+		}
+		d = append(d, text(" "+comment.Value), breakParent{})
+		p.next++
+	}
+	return d
+}
+
+// ownLine prints the comments before pos that have not been printed yet on
+// lines of their own, keeping blank lines between them unless first.
+func (p *printer) ownLine(pos ast.Position, first bool) concat {
+	d := concat{}
+	for p.next < len(p.comments) {
+		comment := p.comments[p.next]
+		if !before(tokenPos(comment), pos) {
+			break
+		}
+		if !first && p.blankBefore(comment.Line) {
+			d = append(d, hardline)
+		}
+		d = append(d, text(comment.Value), hardline)
+		p.next++
+		first = false
+	}
+	return d
+}
+
+// leading prints the comments on lines of their own before the statement
+// at pos, and keeps the blank line above it unless first.
+func (p *printer) leading(pos ast.Position, first bool) concat {
+	d := p.ownLine(pos, first)
+	if (!first || len(d) > 0) && p.blankBefore(pos.Line) {
+		d = append(d, hardline)
+	}
+	return d
+}
+
+// followsCode reports whether there is code before comment on its line.
+func (p *printer) followsCode(comment tokens.Token) bool {
+	runes := []rune(p.lines[comment.Line-1])
+	return strings.TrimSpace(string(runes[:comment.Column-1])) != ""
+}
+
+// blankBefore reports whether the line before line, 1-based, is blank.
+func (p *printer) blankBefore(line int) bool {
+	return line >= 2 && line-2 < len(p.lines) && strings.TrimSpace(p.lines[line-2]) == ""
+}
+
+// brokenAfter reports whether the bracket at pos ends its line.
+func (p *printer) brokenAfter(pos ast.Position) bool {
+	i := p.tokenAt(pos)
+	return i+1 < len(p.tokens) && p.tokens[i+1].TokenType == tokens.NewLine
+}
+
+// literal returns the source of the number or string at pos.
+func (p *printer) literal(pos ast.Position) string {
+	i := p.tokenAt(pos)
+	if p.tokens[i].TokenType != tokens.Quotes {
+		return p.tokens[i].Value
+	}
+	// Strings are lexed as their quotes around their content
+	end := p.tokens[i+1]
+	if end.TokenType != tokens.Quotes {
+		end = p.tokens[i+2]
+	}
+	runes := []rune(p.lines[pos.Line-1])
+	return string(runes[pos.Column-1 : end.Column])
+}
+
+// closing returns the position of the bracket closing the one at pos.
+func (p *printer) closing(pos ast.Position) ast.Position {
+	depth := 0
+	for i := p.tokenAt(pos); i < len(p.tokens); i++ {
+		switch p.tokens[i].TokenType {
+		case tokens.OpenParen, tokens.OpenBracket, tokens.OpenBrace:
+			depth++
+		case tokens.CloseParen, tokens.CloseBracket, tokens.CloseBrace:
+			if depth--; depth == 0 {
+				return tokenPos(p.tokens[i])
+			}
+		}
+	}
+	return tokenPos(p.tokens[len(p.tokens)-1])
+}
+
+// body returns the position of the brace opening the body of a function
+// whose parameters close at pos, after its return type if it has one. An
+// object type opens with a brace too, but after a colon or bar.
+func (p *printer) body(pos ast.Position) ast.Position {
+	depth := 0
+	for i := p.tokenAt(pos) + 1; i < len(p.tokens); i++ {
+		switch p.tokens[i].TokenType {
+		case tokens.OpenParen, tokens.OpenBracket:
+			depth++
+		case tokens.CloseParen, tokens.CloseBracket, tokens.CloseBrace:
+			depth--
+		case tokens.OpenBrace:
+			if prev := p.tokens[i-1].TokenType; depth == 0 && prev != tokens.Colon && prev != tokens.Pipe {
+				return tokenPos(p.tokens[i])
+			}
+			depth++
+		}
+	}
+	return tokenPos(p.tokens[len(p.tokens)-1])
+}
+
+// annotation returns the annotation of type t as it follows a name, or
+// nothing if t is nil.
+func annotation(t *ast.TypeExpr) string {
+	if t == nil {
+		return ""
+	}
+	return ": " + t.String()
+}
+
+// after returns the position of the first token of type tokenType at or
+// after pos.
+func (p *printer) after(pos ast.Position, tokenType tokens.TokenType) ast.Position {
+	for i := p.tokenAt(pos); i < len(p.tokens); i++ {
+		if p.tokens[i].TokenType == tokenType {
+			return tokenPos(p.tokens[i])
+		}
+	}
+	return tokenPos(p.tokens[len(p.tokens)-1])
+}
+
+// tokenAt returns the index of the first token at or after pos.
+func (p *printer) tokenAt(pos ast.Position) int {
+	return sort.Search(len(p.tokens), func(i int) bool {
+		return !before(tokenPos(p.tokens[i]), pos)
+	})
+}
+
+// startOf returns the position of the first token of node, which for
+// operators and calls is not where the node is located.
+func startOf(node ast.ASTNode) ast.Position {
+	switch n := node.(type) {
+	case ast.BinaryExprNode, ast.LogicalExprNode, ast.AssignmentExprNode, ast.CallExprNode, ast.MemberExprNode, ast.IndexExprNode:
+		return startOf(leftmost(n))
+	}
+	return ast.PositionOf(node)
+}
+
+func tokenPos(tk tokens.Token) ast.Position {
+	return ast.Position{Line: tk.Line, Column: tk.Column}
+}
+
+func before(p, q ast.Position) bool {
+	return p.Line < q.Line || p.Line == q.Line && p.Column < q.Column
+}
+
+// comments returns the text of the comments of source.
+func comments(source string) []string {
+	all, _ := FE.LexTrivia(source)
+	var found []string
+	for _, tk := range all {
+		if tk.TokenType == tokens.Comment {
+			found = append(found, tk.Value)
+		}
+	}
+	return found
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// starts returns where each of nodes starts.
+func starts(nodes []ast.ASTNode) []ast.Position {
+	positions := make([]ast.Position, len(nodes))
+	for i, node := range nodes {
+		positions[i] = startOf(node)
+	}
+	return positions
+}
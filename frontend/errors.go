@@ -0,0 +1,61 @@
+package frontend
+
+import (
+	"fmt"
+	"pop/frontend/types/ast"
+	"pop/frontend/types/tokens"
+	"unicode/utf8"
+)
+
+// SyntaxError is raised by the lexer and parser when the source cannot be
+// turned into an AST.
+type SyntaxError struct {
+	Message string
+	// Pos and End delimit the offending text: End is the position just
+	// after it. Both are zero if the position is unknown.
+	Pos ast.Position
+	End ast.Position
+}
+
+func (e *SyntaxError) Error() string {
+	return e.Message
+}
+
+// syntaxError aborts lexing/parsing at pos. It is recovered by Lex and
+// Parse, and turned into a fatal log by the deprecated Tokenize and
+// ProduceAST.
+func syntaxError(pos, end ast.Position, format string, args ...any) {
+	panic(&SyntaxError{Message: fmt.Sprintf(format, args...), Pos: pos, End: end})
+}
+
+// tokenError aborts parsing at tk.
+func tokenError(tk tokens.Token, format string, args ...any) {
+	pos := ast.Position{Line: tk.Line, Column: tk.Column}
+	end := pos
+	switch tk.TokenType {
+	case tokens.EOF:
+	case tokens.NewLine:
+		end.Column++
+	default:
+		end.Column += utf8.RuneCountInString(tk.Value)
+	}
+	syntaxError(pos, end, format, args...)
+}
+
+// nodeError aborts parsing at node, which the parser already produced.
+func nodeError(node ast.ASTNode, format string, args ...any) {
+	pos := ast.PositionOf(node)
+	syntaxError(pos, pos, format, args...)
+}
+
+// recoverSyntaxError stores a SyntaxError panic into err and re-panics
+// anything else.
+func recoverSyntaxError(err *error) {
+	if r := recover(); r != nil {
+		syntaxErr, ok := r.(*SyntaxError)
+		if !ok {
+			panic(r)
+		}
+		*err = syntaxErr
+	}
+}
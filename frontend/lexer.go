@@ -1,12 +1,88 @@
 package frontend
 
 import (
+	"fmt"
 	"log"
 	"pop/frontend/types/tokens"
 	utils "pop/lib"
+	"sort"
+	"strings"
 )
 
+// keywords are the reserved words of the language.
+var keywords = map[string]tokens.TokenType{
+	"let":    tokens.Let,
+	"const":  tokens.Const,
+	"fn":     tokens.Fn,
+	"pop":    tokens.Pop,
+	"true":   tokens.True,
+	"false":  tokens.False,
+	"null":   tokens.Null,
+	"while":  tokens.While,
+	"for":    tokens.For,
+	"if":     tokens.If,
+	"else":   tokens.Else,
+	"is":     tokens.Is,
+	"try":    tokens.Try,
+	"catch":  tokens.Catch,
+	"throw":  tokens.Throw,
+	"import": tokens.Import,
+	"export": tokens.Export,
+}
+
+// Keywords returns the reserved words of the language, sorted.
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}
+
+// Tokenize splits source code into tokens, exiting the process on invalid input.
+//
+// Deprecated: Use Lex, which returns the error instead.
 func Tokenize(sourceCode string) []tokens.Token {
+	tokensList, err := Lex(sourceCode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return tokensList
+}
+
+// Lex splits source code into tokens, returning a *SyntaxError on invalid input.
+func Lex(sourceCode string) (tokensList []tokens.Token, err error) {
+	defer recoverSyntaxError(&err)
+	return tokenize(sourceCode, func(err *SyntaxError) { panic(err) }), nil
+}
+
+// LexAll splits source code into tokens without stopping at invalid input:
+// unknown characters are skipped and unterminated strings end with their
+// line. It returns the tokens along with every error, in source order.
+func LexAll(sourceCode string) ([]tokens.Token, []*SyntaxError) {
+	var errs []*SyntaxError
+	tokensList := tokenize(sourceCode, func(err *SyntaxError) { errs = append(errs, err) })
+	return tokensList, errs
+}
+
+// LexTrivia is LexAll, but keeps each comment as a Comment token holding
+// its text from the `//` to the end of the line, for tools that rewrite
+// source code. The parser does not accept Comment tokens.
+func LexTrivia(sourceCode string) ([]tokens.Token, []*SyntaxError) {
+	var errs []*SyntaxError
+	tokensList := lex(sourceCode, true, func(err *SyntaxError) { errs = append(errs, err) })
+	return tokensList, errs
+}
+
+// tokenize lexes sourceCode, passing each error to report. Lexing goes on
+// after an error if report returns.
+func tokenize(sourceCode string, report func(*SyntaxError)) []tokens.Token {
+	return lex(sourceCode, false, report)
+}
+
+// lex is tokenize, keeping comments if comments is set.
+func lex(sourceCode string, comments bool, report func(*SyntaxError)) []tokens.Token {
 	chars := []rune(sourceCode)
 	tokensList := make([]tokens.Token, 0, len(chars))
 
@@ -28,26 +104,13 @@ func Tokenize(sourceCode string) []tokens.Token {
 		':':  tokens.Colon,
 		',':  tokens.Comma,
 		'.':  tokens.Dot,
-		'"':  tokens.Quotes,
 		'<':  tokens.Less,
 		'>':  tokens.Greater,
+		'|':  tokens.Pipe,
+		'?':  tokens.Question,
 		'\n': tokens.NewLine,
 	}
 
-	keywords := map[string]tokens.TokenType{
-		"let":   tokens.Let,
-		"const": tokens.Const,
-		"fn":    tokens.Fn,
-		"pop":   tokens.Pop,
-		"true":  tokens.True,
-		"false": tokens.False,
-		"null":  tokens.Null,
-		"while": tokens.While,
-		"for":   tokens.For,
-		"if":    tokens.If,
-		"else":  tokens.Else,
-	}
-
 	comparers := map[string]tokens.TokenType{
 		"==": tokens.Equal,
 		"!=": tokens.NotEqual,
@@ -60,15 +123,42 @@ func Tokenize(sourceCode string) []tokens.Token {
 		"||": tokens.Or,
 	}
 
+	positions := newLineIndex(chars)
+	fail := func(start, end int, format string, args ...any) {
+		err := &SyntaxError{Message: fmt.Sprintf(format, args...)}
+		err.Pos.Line, err.Pos.Column = positions.at(start)
+		err.End.Line, err.End.Column = positions.at(end)
+		report(err)
+	}
+
+	// Every token is stamped with the position of the character it started
+	// at, one loop iteration after it was emitted
+	stampFrom, stampAt := 0, 0
+	stamp := func() {
+		for j := stampFrom; j < len(tokensList); j++ {
+			if tokensList[j].Line == 0 {
+				tokensList[j].Line, tokensList[j].Column = positions.at(stampAt)
+			}
+		}
+	}
+
 	i := 0
 	for i < len(chars) {
+		stamp()
+		stampFrom, stampAt = len(tokensList), i
+
 		c := chars[i]
 
 		if i+1 < len(chars) && utils.IsComment(string(c)+string(chars[i+1])) {
 			// Skip the entire comment
+			start := i
 			for i < len(chars) && chars[i] != '\n' {
 				i++
 			}
+			if comments {
+				text := strings.TrimRight(string(chars[start:i]), " \t\r")
+				tokensList = append(tokensList, tokens.Token{Value: text, TokenType: tokens.Comment})
+			}
 			// Skip the newline as well
 			// i++
 			continue
@@ -89,6 +179,8 @@ func Tokenize(sourceCode string) []tokens.Token {
 				i += 2
 				continue
 			}
+		} else if c == '"' {
+			i = lexString(chars, i, positions, &tokensList, fail)
 		} else if tokenType, ok := singleCharTokens[c]; ok {
 			tokensList = append(tokensList, tokens.Token{Value: string(c), TokenType: tokenType})
 			i++
@@ -114,12 +206,84 @@ func Tokenize(sourceCode string) []tokens.Token {
 		} else if utils.IsSkippable(c) {
 			i++
 		} else {
-			log.Fatalf("Token of type '%s' is not yet processable", string(c))
-			log.Fatalf("Failed at: %s", string(chars[i:i+30]))
+			fail(i, i+1, "Token of type '%s' is not yet processable", string(c))
+			i++
 		}
 	}
 
-	tokensList = append(tokensList, tokens.Token{Value: "EndOfFile", TokenType: tokens.EOF})
+	stamp()
+	eof := tokens.Token{Value: "EndOfFile", TokenType: tokens.EOF}
+	eof.Line, eof.Column = positions.at(len(chars))
+	tokensList = append(tokensList, eof)
 
 	return tokensList
 }
+
+// lineIndex maps rune offsets to 1-based line and column numbers.
+type lineIndex []int
+
+func newLineIndex(chars []rune) lineIndex {
+	starts := lineIndex{0}
+	for i, c := range chars {
+		if c == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
+
+func (l lineIndex) at(offset int) (line, column int) {
+	line = sort.Search(len(l), func(i int) bool { return l[i] > offset })
+	return line, offset - l[line-1] + 1
+}
+
+// lexString reads the string literal whose opening quote is at start and
+// returns the index after its closing quote. The contents, with escapes
+// applied, become one token between the two Quotes tokens, so spaces and
+// punctuation survive. An empty string is just the two quotes. An
+// unterminated string is closed at the end of its line.
+func lexString(chars []rune, start int, positions lineIndex, tokensList *[]tokens.Token, fail func(start, end int, format string, args ...any)) int {
+	escapes := map[rune]rune{'"': '"', '\\': '\\', 'n': '\n', 't': '\t', 'r': '\r'}
+
+	var content []rune
+	i := start + 1
+	for ; i < len(chars) && chars[i] != '"'; i++ {
+		if chars[i] == '\n' {
+			break
+		}
+		if chars[i] == '\\' && i+1 < len(chars) {
+			escaped, ok := escapes[chars[i+1]]
+			if !ok {
+				fail(i, i+2, "Unknown escape sequence '\\%c' in string literal", chars[i+1])
+				escaped = chars[i+1]
+			}
+			content = append(content, escaped)
+			i++
+			continue
+		}
+		content = append(content, chars[i])
+	}
+
+	terminated := i < len(chars) && chars[i] == '"'
+	if !terminated {
+		// The position says where, the text could be anything the file holds
+		fail(start, i, "Unterminated string literal")
+	}
+
+	token := func(value string, tokenType tokens.TokenType, offset int) tokens.Token {
+		tk := tokens.Token{Value: value, TokenType: tokenType}
+		tk.Line, tk.Column = positions.at(offset)
+		return tk
+	}
+
+	*tokensList = append(*tokensList, token("\"", tokens.Quotes, start))
+	if len(content) > 0 {
+		*tokensList = append(*tokensList, token(string(content), tokens.Identifier, start+1))
+	}
+	*tokensList = append(*tokensList, token("\"", tokens.Quotes, i))
+
+	if !terminated {
+		return i
+	}
+	return i + 1
+}
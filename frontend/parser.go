@@ -1,11 +1,11 @@
 package frontend
 
 import (
-	"fmt"
+	"io"
 	"log"
-	"os"
 	"pop/frontend/types/ast"
 	"pop/frontend/types/tokens"
+	"sort"
 	"strconv"
 )
 
@@ -13,6 +13,15 @@ type Parser struct {
 	Tokens          []tokens.Token
 	Pos             int
 	inForLoopHeader bool
+	// nested counts the blocks and function bodies around the statement
+	// being parsed, outside of which imports and exports may appear
+	nested int
+	// recovering makes statements that fail to parse be skipped, with
+	// their errors collected in errors, instead of ending the parse
+	recovering bool
+	errors     []*SyntaxError
+	// tests are the names of the test blocks parsed so far
+	tests map[string]bool
 }
 
 // * ========= UTILS ========= * \\
@@ -38,17 +47,122 @@ func (p *Parser) at() tokens.Token {
 func (p *Parser) expect(tokenType tokens.TokenType, err string) tokens.Token {
 	prev := p.eat()
 	if prev.TokenType != tokenType {
-		log.Fatalf("Parser error: %s\nExpected: '%v', but got: '%v'.", err, tokenType.String(), prev.TokenType.String())
+		tokenError(prev, "Parser error: %s\nExpected: '%v', but got: '%v'.", err, tokenType.String(), prev.TokenType.String())
 	}
 	return prev
 }
 
+// pos is the position of the current token.
+func (p *Parser) pos() ast.Position {
+	tk := p.at()
+	return ast.Position{Line: tk.Line, Column: tk.Column}
+}
+
 func (p *Parser) skipNewlines() {
 	for p.at().TokenType == tokens.NewLine {
 		p.eat()
 	}
 }
 
+// * ======== RECOVERY ======== * \\
+
+// parseBodyStatement parses a statement of a program, function or block.
+// When recovering, a statement that fails to parse is skipped and stood in
+// for by placeholder.
+func (p *Parser) parseBodyStatement() (node ast.ASTNode) {
+	if !p.recovering {
+		return p.parseStatement()
+	}
+
+	start := p.Pos
+	defer func() {
+		if r := recover(); r != nil {
+			err, ok := r.(*SyntaxError)
+			if !ok {
+				panic(r)
+			}
+			p.errors = append(p.errors, err)
+			p.inForLoopHeader = false
+			p.synchronize(start)
+			node = p.placeholder(start)
+		}
+	}()
+	return p.parseStatement()
+}
+
+// synchronize skips the rest of the statement that started at token start:
+// up to and including the next newline outside braces, or up to the brace
+// closing the block the statement is in.
+func (p *Parser) synchronize(start int) {
+	defer func() {
+		// Skip at least one token, so parsing moves on
+		if p.Pos == start && p.notEOF() {
+			p.eat()
+		}
+	}()
+
+	// The statement may have failed after eating the closing brace
+	depth := 0
+	for i := start; i < p.Pos && i < len(p.Tokens); i++ {
+		switch p.Tokens[i].TokenType {
+		case tokens.OpenBrace:
+			depth++
+		case tokens.CloseBrace:
+			if depth == 0 {
+				p.Pos = i
+				return
+			}
+			depth--
+		}
+	}
+
+	for p.notEOF() {
+		switch p.at().TokenType {
+		case tokens.OpenBrace:
+			depth++
+		case tokens.CloseBrace:
+			if depth == 0 {
+				return
+			}
+			depth--
+		case tokens.NewLine:
+			if depth == 0 {
+				p.eat()
+				return
+			}
+		}
+		p.eat()
+	}
+}
+
+// placeholder stands in for the statement at token start that failed to
+// parse. A declaration, exported or not, keeps its name, without a value
+// or body, so the uses of the name still find it; anything else is dropped
+// (nil).
+func (p *Parser) placeholder(start int) ast.ASTNode {
+	if start >= len(p.Tokens) {
+		return nil
+	}
+	pos := ast.Position{Line: p.Tokens[start].Line, Column: p.Tokens[start].Column}
+	exported := p.Tokens[start].TokenType == tokens.Export
+	if exported {
+		start++
+	}
+	if start+1 >= len(p.Tokens) || p.Tokens[start+1].TokenType != tokens.Identifier {
+		return nil
+	}
+	keyword, name := p.Tokens[start], p.Tokens[start+1]
+	namePos := ast.Position{Line: name.Line, Column: name.Column}
+
+	switch keyword.TokenType {
+	case tokens.Let, tokens.Const:
+		return ast.VariableDeclarationNode{Identifier: name.Value, Constant: keyword.TokenType == tokens.Const, Exported: exported, Pos: pos, NamePos: namePos}
+	case tokens.Fn:
+		return ast.FunctionDeclarationNode{Name: name.Value, Params: []string{}, Body: []ast.ASTNode{}, Exported: exported, Pos: pos, NamePos: namePos, ParamPos: []ast.Position{}}
+	}
+	return nil
+}
+
 // * ======== STATEMENTS ======== * \\
 
 func (p *Parser) parseStatement() ast.ASTNode {
@@ -65,13 +179,27 @@ func (p *Parser) parseStatement() ast.ASTNode {
 		return p.parseWhileStatement()
 	case tokens.For:
 		return p.parseForStatement()
+	case tokens.Try:
+		return p.parseTryStatement()
+	case tokens.Throw:
+		return p.parseThrowStatement()
+	case tokens.Import:
+		return p.parseImport()
+	case tokens.Export:
+		return p.parseExport()
 	default:
+		if p.atTypeAlias() {
+			return p.parseTypeAlias()
+		}
+		if p.atTest() {
+			return p.parseTest()
+		}
 		node := p.parseExpr()
 
 		if p.at().TokenType == tokens.NewLine {
 			p.eat()
 		} else if p.at().TokenType != tokens.EOF {
-			log.Fatalf("Expected newline or EOF after statement, got: %v", p.at())
+			tokenError(p.at(), "Expected newline or EOF after statement, got: %v", p.at())
 		}
 
 		return node
@@ -79,43 +207,48 @@ func (p *Parser) parseStatement() ast.ASTNode {
 }
 
 func (p *Parser) parseFnReturn() ast.ASTNode {
+	start := p.pos()
 	p.eat() // Eat the `pop` keyword
 
 	// Pop statements need to complete with a semicolon or an expression
 
-	// Is the next token an expression
-	isNextExpr := p.at().TokenType == tokens.Identifier ||
-		p.at().TokenType == tokens.Number ||
-		p.at().TokenType == tokens.OpenParen
-
-	// Is the next token an expression?
-	if isNextExpr {
-		val := p.parseExpr()
-		// Optionally: check for newline, block end, or EOF here
-		return ast.ReturnStatementNode{Value: val}
-	} else if p.at().TokenType == tokens.CloseBrace ||
+	// A bare `pop` ends at the newline, block end or EOF
+	if p.at().TokenType == tokens.CloseBrace ||
+		p.at().TokenType == tokens.NewLine ||
 		p.at().TokenType == tokens.EOF {
 		// No value, just pop (return)
-		return ast.ReturnStatementNode{Value: nil}
-	} else {
-		log.Fatalf("Expected an expression or end of statement after 'pop', got: %v", p.at())
-		return nil
+		return ast.ReturnStatementNode{Value: nil, Pos: start}
 	}
+
+	// Anything else has to be the expression being returned
+	val := p.parseExpr()
+	return ast.ReturnStatementNode{Value: val, Pos: start}
 }
 
 func (p *Parser) parseVarDeclaration() ast.ASTNode {
+	start := p.pos()
 	isConstant := p.eat().TokenType == tokens.Const
 
-	identifier := p.expect(tokens.Identifier, "Expected identifier name following 'let' | 'const' keywords").Value
+	identifierTk := p.expect(tokens.Identifier, "Expected identifier name following 'let' | 'const' keywords")
+	identifier := identifierTk.Value
+
+	var annotation *ast.TypeExpr
+	if p.at().TokenType == tokens.Colon {
+		p.eat()
+		annotation = p.parseType()
+	}
 
 	if p.at().TokenType == tokens.NewLine {
 		p.eat()
 		if isConstant {
-			log.Fatalf("Must assign value to constant expression. No value provided.")
+			tokenError(identifierTk, "Must assign value to constant expression. No value provided.")
 		}
 		return ast.VariableDeclarationNode{
 			Identifier: identifier,
 			Constant:   isConstant,
+			Type:       annotation,
+			Pos:        start,
+			NamePos:    ast.Position{Line: identifierTk.Line, Column: identifierTk.Column},
 		}
 	}
 
@@ -125,6 +258,9 @@ func (p *Parser) parseVarDeclaration() ast.ASTNode {
 		Constant:   isConstant,
 		Identifier: identifier,
 		Value:      p.parseExpr(),
+		Type:       annotation,
+		Pos:        start,
+		NamePos:    ast.Position{Line: identifierTk.Line, Column: identifierTk.Column},
 	}
 
 	if !p.inForLoopHeader {
@@ -135,31 +271,48 @@ func (p *Parser) parseVarDeclaration() ast.ASTNode {
 }
 
 func (p *Parser) parseFnDeclaration() ast.ASTNode {
+	start := p.pos()
 	p.eat() // Eat the 'fn' keyword
 
-	name := p.expect(tokens.Identifier, "Expected a function name following the 'fn' keyword.").Value
+	nameTk := p.expect(tokens.Identifier, "Expected a function name following the 'fn' keyword.")
 
-	args := p.parseArgs()
-	params := []string{}
+	params, paramPos, paramTypes := p.parseParams()
 
-	for _, arg := range args {
-		identifier, ok := arg.(ast.IdentifierExprNode)
-		if !ok {
-			log.Fatalf("Inside function declaration expected parameters to be of type 'Identifier'. Got: %v", arg)
-		}
-		params = append(params, identifier.Symbol)
+	var returnType *ast.TypeExpr
+	if p.at().TokenType == tokens.Colon {
+		p.eat()
+		returnType = p.parseType()
 	}
 
 	p.expect(tokens.OpenBrace, "Expected fn body following a declaration")
 
+	return ast.FunctionDeclarationNode{
+		Name:       nameTk.Value,
+		Params:     params,
+		Body:       p.parseFnBody(),
+		Pos:        start,
+		NamePos:    ast.Position{Line: nameTk.Line, Column: nameTk.Column},
+		ParamPos:   paramPos,
+		ParamTypes: paramTypes,
+		ReturnType: returnType,
+	}
+}
+
+// parseFnBody parses the statements of a function body up to and
+// including its closing brace, the opening one already eaten.
+func (p *Parser) parseFnBody() []ast.ASTNode {
 	body := []ast.ASTNode{}
 
+	p.nested++
+	defer func() { p.nested-- }()
 	for p.notEOF() {
 		p.skipNewlines()
-		if p.at().TokenType == tokens.CloseBrace {
+		if p.at().TokenType == tokens.CloseBrace || !p.notEOF() {
 			break
 		}
-		body = append(body, p.parseStatement())
+		if stmt := p.parseBodyStatement(); stmt != nil {
+			body = append(body, stmt)
+		}
 	}
 
 	p.expect(tokens.CloseBrace, "Closing bracket expected inside function declaration")
@@ -168,15 +321,222 @@ func (p *Parser) parseFnDeclaration() ast.ASTNode {
 	if p.at().TokenType == tokens.NewLine {
 		p.eat()
 	}
+	return body
+}
+
+// atTest reports whether a test block starts here: `test` followed by a
+// string. Anywhere else `test` is an identifier like any other.
+func (p *Parser) atTest() bool {
+	return p.at().TokenType == tokens.Identifier && p.at().Value == "test" &&
+		p.Pos+1 < len(p.Tokens) && p.Tokens[p.Pos+1].TokenType == tokens.Quotes
+}
+
+// parseTest parses a test block, `test "name" { ... }`, into the function
+// without parameters it declares.
+func (p *Parser) parseTest() ast.ASTNode {
+	start := p.pos()
+	testTk := p.eat() // Eat `test`
+	if p.nested > 0 {
+		tokenError(testTk, "Tests are only allowed at the top level of a module")
+	}
 
+	namePos := p.pos()
+	p.eat() // Eat the opening quote
+	name := ""
+	if p.at().TokenType != tokens.Quotes {
+		name = p.eat().Value
+	}
+	p.expect(tokens.Quotes, "String literals should end with a closing quote.")
+	if name == "" {
+		tokenError(p.Tokens[p.Pos-1], "Expected the name of the test, got an empty string")
+	}
+	if p.tests[name] {
+		tokenError(p.Tokens[p.Pos-1], "Test %q is already declared", name)
+	}
+	if p.tests == nil {
+		p.tests = map[string]bool{}
+	}
+	p.tests[name] = true
+
+	p.expect(tokens.OpenBrace, "Expected the test body following its name")
 	return ast.FunctionDeclarationNode{
-		Name:   name,
-		Params: params,
-		Body:   body,
+		Name:     ast.TestFunctionName(name),
+		TestName: name,
+		Params:   []string{},
+		Body:     p.parseFnBody(),
+		Pos:      start,
+		NamePos:  namePos,
+		ParamPos: []ast.Position{},
+	}
+}
+
+// parseParams parses the parameters of a function declaration, each a
+// name with an optional annotation. The annotations are nil if there are
+// none.
+func (p *Parser) parseParams() ([]string, []ast.Position, []*ast.TypeExpr) {
+	p.expect(tokens.OpenParen, "Expected open parenthesis")
+	params := []string{}
+	paramPos := []ast.Position{}
+	var paramTypes []*ast.TypeExpr
+	annotated := false
+
+	for p.skipNewlines(); p.at().TokenType != tokens.CloseParen; p.skipNewlines() {
+		if len(params) > 0 {
+			p.expect(tokens.Comma, "Expected comma or closing parenthesis following parameter")
+			p.skipNewlines()
+			if p.at().TokenType == tokens.CloseParen {
+				break
+			}
+		}
+		paramTk := p.eat()
+		if paramTk.TokenType != tokens.Identifier {
+			tokenError(paramTk, "Inside function declaration expected parameters to be of type 'Identifier'. Got: %v", paramTk.Value)
+		}
+		var annotation *ast.TypeExpr
+		if p.at().TokenType == tokens.Colon {
+			p.eat()
+			annotation = p.parseType()
+			annotated = true
+		}
+		params = append(params, paramTk.Value)
+		paramPos = append(paramPos, ast.Position{Line: paramTk.Line, Column: paramTk.Column})
+		paramTypes = append(paramTypes, annotation)
+	}
+
+	p.expect(tokens.CloseParen, "Missing closing parenthesis")
+	if !annotated {
+		paramTypes = nil
+	}
+	return params, paramPos, paramTypes
+}
+
+// atTypeAlias reports whether a type alias starts at the current token.
+// `type` is only a keyword there, so it can still name variables.
+func (p *Parser) atTypeAlias() bool {
+	return p.at().TokenType == tokens.Identifier && p.at().Value == "type" &&
+		p.Pos+2 < len(p.Tokens) &&
+		p.Tokens[p.Pos+1].TokenType == tokens.Identifier &&
+		p.Tokens[p.Pos+2].TokenType == tokens.Equals
+}
+
+func (p *Parser) parseTypeAlias() ast.ASTNode {
+	start := p.pos()
+	p.eat() // Eat `type`
+	nameTk := p.eat()
+	p.eat() // Eat `=`
+
+	alias := ast.TypeAliasNode{
+		Name:    nameTk.Value,
+		Type:    p.parseType(),
+		Pos:     start,
+		NamePos: ast.Position{Line: nameTk.Line, Column: nameTk.Column},
+	}
+
+	if p.at().TokenType != tokens.EOF {
+		p.expect(tokens.NewLine, "Type alias must end with a new line")
+	}
+	return alias
+}
+
+// parseImport parses `import { a, b as c } from "path"`,
+// `import * as m from "path"` or its short form `import m from "path"`.
+// `as` and `from` are only keywords here.
+func (p *Parser) parseImport() ast.ASTNode {
+	importTk := p.eat() // Eat `import`
+	if p.nested > 0 {
+		tokenError(importTk, "Imports are only allowed at the top level of a module")
+	}
+	node := ast.ImportDeclarationNode{Pos: ast.Position{Line: importTk.Line, Column: importTk.Column}}
+
+	switch tk := p.at(); {
+	case tk.TokenType == tokens.BinaryOperator && tk.Value == "*":
+		p.eat()
+		p.expectWord("as", "Expected 'as' following '*' in import")
+		node.NamespacePos = p.pos()
+		node.Namespace = p.expect(tokens.Identifier, "Expected a name for the module following 'as'").Value
+	case tk.TokenType == tokens.Identifier:
+		node.NamespacePos = p.pos()
+		node.Namespace = p.eat().Value
+		node.Default = true
+	case tk.TokenType == tokens.OpenBrace:
+		p.eat()
+		node.Names = []ast.ImportName{}
+		for p.skipNewlines(); p.at().TokenType != tokens.CloseBrace; p.skipNewlines() {
+			if len(node.Names) > 0 {
+				p.expect(tokens.Comma, "Expected comma or closing brace following imported name")
+				p.skipNewlines()
+				if p.at().TokenType == tokens.CloseBrace {
+					break
+				}
+			}
+			namePos := p.pos()
+			name := p.expect(tokens.Identifier, "Expected the name of an export in import").Value
+			imported := ast.ImportName{Name: name, Local: name, Pos: namePos, LocalPos: namePos}
+			if p.at().TokenType == tokens.Identifier && p.at().Value == "as" {
+				p.eat()
+				imported.LocalPos = p.pos()
+				imported.Local = p.expect(tokens.Identifier, "Expected a name following 'as' in import").Value
+			}
+			node.Names = append(node.Names, imported)
+		}
+		p.eat() // Eat `}`
+	default:
+		tokenError(tk, "Expected '{', '*' or a name following 'import', got: '%v'", tk.Value)
+	}
+
+	p.expectWord("from", "Expected 'from' following the imported names")
+	node.SpecifierPos = p.pos()
+	p.expect(tokens.Quotes, "Expected the module to import from as a string")
+	if p.at().TokenType != tokens.Quotes {
+		node.Specifier = p.eat().Value
+	}
+	p.expect(tokens.Quotes, "String literals should end with a closing quote.")
+	if node.Specifier == "" {
+		tokenError(p.Tokens[p.Pos-1], "Expected the module to import from, got an empty string")
+	}
+
+	if p.at().TokenType != tokens.EOF {
+		p.expect(tokens.NewLine, "Import must end with a new line")
+	}
+	return node
+}
+
+// parseExport parses `export` followed by a let, const or fn declaration,
+// which then starts at `export`.
+func (p *Parser) parseExport() ast.ASTNode {
+	exportTk := p.eat() // Eat `export`
+	if p.nested > 0 {
+		tokenError(exportTk, "Exports are only allowed at the top level of a module")
+	}
+	start := ast.Position{Line: exportTk.Line, Column: exportTk.Column}
+
+	switch p.at().TokenType {
+	case tokens.Let, tokens.Const:
+		decl := p.parseVarDeclaration().(ast.VariableDeclarationNode)
+		decl.Exported = true
+		decl.Pos = start
+		return decl
+	case tokens.Fn:
+		decl := p.parseFnDeclaration().(ast.FunctionDeclarationNode)
+		decl.Exported = true
+		decl.Pos = start
+		return decl
+	}
+	tokenError(p.at(), "Expected 'let', 'const' or 'fn' following 'export', got: '%v'", p.at().Value)
+	return nil
+}
+
+// expectWord eats the identifier word, which is a keyword only where it is
+// expected, such as `from` in an import.
+func (p *Parser) expectWord(word, err string) {
+	tk := p.eat()
+	if tk.TokenType != tokens.Identifier || tk.Value != word {
+		tokenError(tk, "Parser error: %s\nExpected: '%s', but got: '%v'.", err, word, tk.Value)
 	}
 }
 
 func (p *Parser) parseIfStatement() ast.ASTNode {
+	start := p.pos()
 	p.eat() // eat 'if'
 	condition := p.parseExpr()
 	consequent := p.parseBlockStatement()
@@ -188,7 +548,6 @@ func (p *Parser) parseIfStatement() ast.ASTNode {
 		if p.at().TokenType == tokens.If {
 			alternate = p.parseIfStatement()
 		} else {
-			p.expect(tokens.OpenBrace, "Expected { after 'else' condition keyword")
 			alternate = p.parseBlockStatement()
 		}
 	}
@@ -197,21 +556,25 @@ func (p *Parser) parseIfStatement() ast.ASTNode {
 		Condition:  condition,
 		Consequent: consequent,
 		Alternate:  alternate,
+		Pos:        start,
 	}
 }
 
 func (p *Parser) parseWhileStatement() ast.ASTNode {
+	start := p.pos()
 	p.eat() // eat 'while' keyword
 	condition := p.parseExpr()
 	body := p.parseBlockStatement()
 	return ast.WhileStatementNode{
 		Condition: condition,
 		Body:      body,
+		Pos:       start,
 	}
 }
 
 // Should throw error if a constant variable is set as the counter
 func (p *Parser) parseForStatement() ast.ASTNode {
+	start := p.pos()
 	p.eat() // eat 'for' keyword
 	p.expect(tokens.OpenParen, "Expected '(' after for")
 
@@ -221,7 +584,7 @@ func (p *Parser) parseForStatement() ast.ASTNode {
 
 	// Check if init is a const declaration
 	if varDecl, ok := init.(ast.VariableDeclarationNode); ok && varDecl.Constant {
-		log.Fatalf("Cannot use a constant variable as the for-loop counter.")
+		nodeError(varDecl, "Cannot use a constant variable as the for-loop counter.")
 	}
 
 	p.expect(tokens.Semicolon, "Expected ';' after for loop initializer")
@@ -236,27 +599,71 @@ func (p *Parser) parseForStatement() ast.ASTNode {
 		Condition: condition,
 		Update:    update,
 		Body:      body,
+		Pos:       start,
+	}
+}
+
+func (p *Parser) parseTryStatement() ast.ASTNode {
+	start := p.pos()
+	p.eat() // eat 'try' keyword
+	body := p.parseBlockStatement()
+	p.skipNewlines()
+
+	p.expect(tokens.Catch, "Expected 'catch' block following 'try' block")
+
+	// The error binding is optional: `catch err { }` or `catch { }`
+	param := ""
+	var paramPos ast.Position
+	if p.at().TokenType == tokens.Identifier {
+		paramPos = p.pos()
+		param = p.eat().Value
+	}
+	handler := p.parseBlockStatement()
+
+	return ast.TryStatementNode{
+		Body:     body,
+		Param:    param,
+		Handler:  handler,
+		Pos:      start,
+		ParamPos: paramPos,
 	}
 }
 
+func (p *Parser) parseThrowStatement() ast.ASTNode {
+	start := p.pos()
+	p.eat() // eat 'throw' keyword
+
+	if p.at().TokenType == tokens.NewLine || p.at().TokenType == tokens.CloseBrace || p.at().TokenType == tokens.EOF {
+		tokenError(p.at(), "Expected an expression following 'throw'")
+	}
+
+	return ast.ThrowStatementNode{Value: p.parseExpr(), Pos: start}
+}
+
 // Should open a new block scope
 func (p *Parser) parseBlockStatement() ast.ASTNode {
+	start := p.pos()
 	p.expect(tokens.OpenBrace, "Expected block statement to start with {")
 	body := []ast.ASTNode{}
 
-	for p.notEOF() && p.at().TokenType != tokens.CloseBrace {
-		if p.at().TokenType == tokens.NewLine {
-			p.eat() // eat any newlines inside the block statement
+	p.nested++
+	defer func() { p.nested-- }()
+	for p.notEOF() {
+		p.skipNewlines() // eat any newlines inside the block statement
+		if p.at().TokenType == tokens.CloseBrace || !p.notEOF() {
+			break
 		}
 
-		body = append(body, p.parseStatement())
+		if stmt := p.parseBodyStatement(); stmt != nil {
+			body = append(body, stmt)
+		}
 	}
 	p.expect(tokens.CloseBrace, "Expected block statement to end with }")
 
 	if p.at().TokenType == tokens.NewLine {
 		p.eat() // eat any newlines after the block statement
 	}
-	return ast.BlockStatementNode{Body: body}
+	return ast.BlockStatementNode{Body: body, Pos: start}
 }
 
 // * ======= EXPRESSIONS ======= * \\
@@ -269,11 +676,13 @@ func (p *Parser) parseAssignmentExpr() ast.ASTNode {
 	left := p.parseLogicalExpr()
 
 	if p.at().TokenType == tokens.Equals {
+		start := p.pos()
 		p.eat() // Advance past equals
 		value := p.parseAssignmentExpr()
 		return ast.AssignmentExprNode{
 			Value:    value,
 			Assignee: left,
+			Pos:      start,
 		}
 	}
 
@@ -286,6 +695,7 @@ func (p *Parser) parseLogicalExpr() ast.ASTNode {
 	for {
 		tk := p.at().TokenType
 		if tk == tokens.And || tk == tokens.Or {
+			start := p.pos()
 			operator := p.eat().Value
 			right := p.parseComparisonExpr()
 
@@ -293,6 +703,7 @@ func (p *Parser) parseLogicalExpr() ast.ASTNode {
 				Left:     left,
 				Right:    right,
 				Operator: ast.BinaryOperatorKind(operator),
+				Pos:      start,
 			}
 		} else {
 			break
@@ -307,13 +718,15 @@ func (p *Parser) parseComparisonExpr() ast.ASTNode {
 
 	for {
 		op := p.at().Value
-		if op == "==" || op == "!=" || op == "<" || op == ">" || op == "<=" || op == ">=" {
+		if op == "==" || op == "!=" || op == "<" || op == ">" || op == "<=" || op == ">=" || op == "is" {
+			start := p.pos()
 			operator := p.eat().Value
 			right := p.parseObjectExpr()
 			left = ast.BinaryExprNode{
 				Left:     left,
 				Right:    right,
 				Operator: ast.BinaryOperatorKind(operator),
+				Pos:      start,
 			}
 		} else {
 			break
@@ -328,47 +741,36 @@ func (p *Parser) parseObjectExpr() ast.ASTNode {
 		return p.parseAdditiveExpr()
 	}
 
+	start := p.pos()
 	p.eat() // advance past the open brace
 
 	properties := []ast.PropertyNode{}
 
-	// eat the new lines before object member assignments
-	for p.notEOF() && p.at().TokenType != tokens.CloseBrace {
-		if p.at().TokenType == tokens.NewLine {
-			p.eat()
+	for {
+		// eat the new lines before object member assignments
+		p.skipNewlines()
+		if !p.notEOF() || p.at().TokenType == tokens.CloseBrace {
+			break
 		}
 
+		keyPos := p.pos()
 		key := p.expect(tokens.Identifier, "Object literal key expected!").Value
 
-		// Shorthand property: { key }
-		if p.at().TokenType == tokens.Comma {
-			p.eat()
-			properties = append(properties, ast.PropertyNode{
-				Key:   key,
-				Value: nil,
-			})
-			continue
-		} else if p.at().TokenType == tokens.CloseBrace {
-			properties = append(properties, ast.PropertyNode{
-				Key:   key,
-				Value: nil,
-			})
-			continue
-		}
-
-		// Full property: { key: value }
-		p.expect(tokens.Colon, "Missing colon following identifier in ObjectExpression")
-		value := p.parseExpr()
+		// Shorthand property: { key }, or full property: { key: value }
+		var value ast.ASTNode
+		if p.at().TokenType != tokens.Comma && p.at().TokenType != tokens.CloseBrace && p.at().TokenType != tokens.NewLine {
+			p.expect(tokens.Colon, "Missing colon following identifier in ObjectExpression")
+			value = p.parseExpr()
+		}
 
 		properties = append(properties, ast.PropertyNode{
 			Key:   key,
 			Value: value,
+			Pos:   keyPos,
 		})
 
 		// eat the new lines after object member assignments
-		if p.at().TokenType == tokens.NewLine {
-			p.eat()
-		}
+		p.skipNewlines()
 
 		if p.at().TokenType != tokens.CloseBrace {
 			p.expect(tokens.Comma, "Expected comma or closing bracket following property")
@@ -379,6 +781,7 @@ func (p *Parser) parseObjectExpr() ast.ASTNode {
 
 	return ast.ObjectLiteralExprNode{
 		Properties: properties,
+		Pos:        start,
 	}
 }
 
@@ -386,12 +789,14 @@ func (p *Parser) parseAdditiveExpr() ast.ASTNode {
 	left := p.parseMultiplicativeExpr()
 
 	for p.at().Value == "+" || p.at().Value == "-" {
+		start := p.pos()
 		operator := p.eat().Value
 		right := p.parseMultiplicativeExpr()
 		left = ast.BinaryExprNode{
 			Left:     left,
 			Right:    right,
 			Operator: ast.BinaryOperatorKind(operator),
+			Pos:      start,
 		}
 	}
 
@@ -402,12 +807,14 @@ func (p *Parser) parseMultiplicativeExpr() ast.ASTNode {
 	left := p.parseUnaryExpr()
 
 	for p.at().Value == "/" || p.at().Value == "*" || p.at().Value == "%" {
+		start := p.pos()
 		operator := p.eat().Value
 		right := p.parseUnaryExpr()
 		left = ast.BinaryExprNode{
 			Left:     left,
 			Right:    right,
 			Operator: ast.BinaryOperatorKind(operator),
+			Pos:      start,
 		}
 	}
 
@@ -419,6 +826,7 @@ func (p *Parser) parseUnaryExpr() ast.ASTNode {
 	// Check for unary minus or logical not
 	if (tk.TokenType == tokens.BinaryOperator && (tk.Value == "-" || tk.Value == "+")) ||
 		(tk.TokenType == tokens.UnaryOperator && tk.Value == "!") {
+		start := p.pos()
 		operator := p.eat().Value
 		operand := p.parseUnaryExpr()
 		if operator == "+" {
@@ -428,6 +836,7 @@ func (p *Parser) parseUnaryExpr() ast.ASTNode {
 		return ast.UnaryExprNode{
 			Operator: ast.UnaryOperatorKind(operator),
 			Operand:  operand,
+			Pos:      start,
 		}
 	}
 	return p.parseCallMemberExpr()
@@ -448,6 +857,7 @@ func (p *Parser) parseCallMemberExpr() ast.ASTNode {
 func (p *Parser) parseCallExpr(caller ast.ASTNode) ast.ASTNode {
 	callExpr := ast.CallExprNode{
 		Caller: caller,
+		Pos:    p.pos(),
 		Args:   p.parseArgs(),
 	}
 
@@ -458,8 +868,12 @@ func (p *Parser) parseCallExpr(caller ast.ASTNode) ast.ASTNode {
 	return callExpr
 }
 
+// parseArgs parses the arguments of a call or the parameters of a function,
+// which may be split over lines after the parenthesis and the commas, with
+// a comma after the last one.
 func (p *Parser) parseArgs() []ast.ASTNode {
 	p.expect(tokens.OpenParen, "Expected open parenthesis")
+	p.skipNewlines()
 
 	var args []ast.ASTNode
 	if p.at().TokenType == tokens.CloseParen {
@@ -468,6 +882,7 @@ func (p *Parser) parseArgs() []ast.ASTNode {
 		args = p.parseArgumentsList()
 	}
 
+	p.skipNewlines()
 	p.expect(tokens.CloseParen, "Missing closing parenthesis")
 	return args
 }
@@ -475,8 +890,12 @@ func (p *Parser) parseArgs() []ast.ASTNode {
 func (p *Parser) parseArgumentsList() []ast.ASTNode {
 	args := []ast.ASTNode{p.parseAssignmentExpr()}
 
-	for p.at().TokenType == tokens.Comma {
+	for p.skipNewlines(); p.at().TokenType == tokens.Comma; p.skipNewlines() {
 		p.eat()
+		p.skipNewlines()
+		if p.at().TokenType == tokens.CloseParen {
+			break
+		}
 		args = append(args, p.parseAssignmentExpr())
 	}
 
@@ -487,6 +906,7 @@ func (p *Parser) parseMemberExpr() ast.ASTNode {
 	object := p.parsePrimaryExpr()
 
 	for p.at().TokenType == tokens.Dot || p.at().TokenType == tokens.OpenBracket {
+		start := p.pos()
 		operator := p.eat()
 		var property ast.ASTNode
 		var computed bool
@@ -496,7 +916,7 @@ func (p *Parser) parseMemberExpr() ast.ASTNode {
 			property = p.parsePrimaryExpr()
 
 			if ast.GetNodeKind(property) != ast.IdentifierExpr {
-				log.Fatalf("Cannot use dot operator without right hand side being an identifier")
+				nodeError(property, "Cannot use dot operator without right hand side being an identifier")
 			}
 		} else {
 			computed = true
@@ -508,6 +928,7 @@ func (p *Parser) parseMemberExpr() ast.ASTNode {
 			Object:   object,
 			Property: property,
 			Computed: computed,
+			Pos:      start,
 		}
 	}
 
@@ -518,19 +939,23 @@ func (p *Parser) parseMemberExpr() ast.ASTNode {
 
 func (p *Parser) parsePrimaryExpr() ast.ASTNode {
 	tk := p.at().TokenType
+	start := p.pos()
 
 	switch tk {
 	case tokens.Identifier:
 		return ast.IdentifierExprNode{
 			Symbol: p.eat().Value,
+			Pos:    start,
 		}
 	case tokens.Number:
-		value, err := strconv.ParseFloat(p.eat().Value, 64)
+		tk := p.eat()
+		value, err := strconv.ParseFloat(tk.Value, 64)
 		if err != nil {
-			log.Fatalf("Failed to parse number: %v", err)
+			tokenError(tk, "Failed to parse number: %v", err)
 		}
 		return ast.NumericLiteralExprNode{
 			Value: value,
+			Pos:   start,
 		}
 	case tokens.OpenParen:
 		p.eat() // Eat the opening paren
@@ -565,14 +990,18 @@ func (p *Parser) parsePrimaryExpr() ast.ASTNode {
 		// Pre-allocate with exact capacity
 		elements := make([]ast.ASTNode, 0, elementCount)
 
+		// Elements may be split over lines after the bracket and the commas
+		p.skipNewlines()
 		if p.at().TokenType != tokens.CloseBracket {
 			for {
 				elements = append(elements, p.parseExpr())
+				p.skipNewlines()
 				if p.at().TokenType == tokens.CloseBracket {
 					break
 				}
 				// Require a comma between elements
 				p.expect(tokens.Comma, "Array elements should be separated with commas.")
+				p.skipNewlines()
 				// Check for trailing comma (optional)
 				if p.at().TokenType == tokens.CloseBracket {
 					break
@@ -584,35 +1013,45 @@ func (p *Parser) parsePrimaryExpr() ast.ASTNode {
 		return ast.ArrayLiteralExprNode{
 			Elements: elements,
 			Size:     int64(len(elements)),
+			Pos:      start,
 		}
 	case tokens.OpenBrace:
 		return p.parseObjectExpr()
 	case tokens.Quotes:
 		p.eat() // Eat the opening quote
 
-		val := p.eat().Value
+		// An empty string is just two quotes in a row
+		val := ""
+		if p.at().TokenType != tokens.Quotes {
+			val = p.eat().Value
+		}
 
 		p.expect(tokens.Quotes, "String literals should end with a closing quote.")
 		return ast.StringLiteralExprNode{
 			Value: val,
+			Pos:   start,
 		}
 	case tokens.True, tokens.False:
 		val := p.eat().Value
 
-		fmt.Println(val)
-
 		if val == "true" {
 			return ast.BooleanLiteralExprNode{
 				Value: true,
+				Pos:   start,
 			}
 		}
 
 		return ast.BooleanLiteralExprNode{
 			Value: false,
+			Pos:   start,
 		}
 
+	case tokens.Null:
+		p.eat()
+		return ast.NullLiteralExprNode{Pos: start}
+
 	default:
-		log.Fatalf("Unexpected token found during parsing: %v", p.at())
+		tokenError(p.at(), "Unexpected token found during parsing: %v", p.at())
 		return nil
 	}
 }
@@ -712,38 +1151,206 @@ func WrapASTWithKind(node ast.ASTNode) ast.JSONNode {
 	}
 }
 
+// * ======= TYPES ======= * \\
+
+// parseType parses a type annotation:
+//
+//	type    = postfix {"|" postfix}
+//	postfix = primary {"[]" | "?"}
+//	primary = name | "null" | "fn" "(" [type {"," type}] ")" [":" postfix]
+//	        | "{" [field {"," field}] "}" | "(" type ")"
+//	field   = name ["?"] ":" type
+func (p *Parser) parseType() *ast.TypeExpr {
+	first := p.parsePostfixType()
+	if p.at().TokenType != tokens.Pipe {
+		return first
+	}
+
+	union := &ast.TypeExpr{Kind: ast.UnionType, Types: []*ast.TypeExpr{first}, Pos: first.Pos}
+	for p.at().TokenType == tokens.Pipe {
+		p.eat()
+		p.skipNewlines()
+		union.Types = append(union.Types, p.parsePostfixType())
+	}
+	return union
+}
+
+func (p *Parser) parsePostfixType() *ast.TypeExpr {
+	t := p.parsePrimaryType()
+	for {
+		switch {
+		case p.at().TokenType == tokens.OpenBracket && p.Pos+1 < len(p.Tokens) && p.Tokens[p.Pos+1].TokenType == tokens.CloseBracket:
+			p.eat()
+			p.eat()
+			t = &ast.TypeExpr{Kind: ast.ArrayType, Elem: t, Pos: t.Pos}
+		case p.at().TokenType == tokens.Question:
+			p.eat()
+			t = &ast.TypeExpr{Kind: ast.NullableType, Elem: t, Pos: t.Pos}
+		default:
+			return t
+		}
+	}
+}
+
+func (p *Parser) parsePrimaryType() *ast.TypeExpr {
+	start := p.pos()
+	tk := p.eat()
+
+	switch tk.TokenType {
+	case tokens.Identifier:
+		return &ast.TypeExpr{Kind: ast.NamedType, Name: tk.Value, Pos: start}
+	case tokens.Null:
+		return &ast.TypeExpr{Kind: ast.NamedType, Name: "null", Pos: start}
+	case tokens.OpenParen:
+		p.skipNewlines()
+		t := p.parseType()
+		p.skipNewlines()
+		p.expect(tokens.CloseParen, "Missing closing parenthesis in type")
+		return t
+	case tokens.Fn:
+		fnType := &ast.TypeExpr{Kind: ast.FunctionType, Types: []*ast.TypeExpr{}, Pos: start}
+		p.expect(tokens.OpenParen, "Expected open parenthesis following 'fn' in type")
+		for p.skipNewlines(); p.at().TokenType != tokens.CloseParen; p.skipNewlines() {
+			if len(fnType.Types) > 0 {
+				p.expect(tokens.Comma, "Expected comma or closing parenthesis following parameter type")
+				p.skipNewlines()
+				if p.at().TokenType == tokens.CloseParen {
+					break
+				}
+			}
+			fnType.Types = append(fnType.Types, p.parseType())
+		}
+		p.eat() // Eat `)`
+		if p.at().TokenType == tokens.Colon {
+			p.eat()
+			fnType.Elem = p.parsePostfixType()
+		}
+		return fnType
+	case tokens.OpenBrace:
+		object := &ast.TypeExpr{Kind: ast.ObjectType, Fields: []ast.TypeField{}, Pos: start}
+		for p.skipNewlines(); p.at().TokenType != tokens.CloseBrace; p.skipNewlines() {
+			if len(object.Fields) > 0 {
+				p.expect(tokens.Comma, "Expected comma or closing brace following field type")
+				p.skipNewlines()
+				if p.at().TokenType == tokens.CloseBrace {
+					break
+				}
+			}
+			keyPos := p.pos()
+			field := ast.TypeField{Key: p.expect(tokens.Identifier, "Object type key expected").Value, Pos: keyPos}
+			if p.at().TokenType == tokens.Question {
+				p.eat()
+				field.Optional = true
+			}
+			p.expect(tokens.Colon, "Missing colon following key in object type")
+			field.Type = p.parseType()
+			object.Fields = append(object.Fields, field)
+		}
+		p.eat() // Eat `}`
+		return object
+	}
+
+	tokenError(tk, "Expected a type, got: '%v'", tk.Value)
+	return nil
+}
+
 // * ======= PUBLIC API ======= * \\
 
+// ProduceAST parses tokens into a program, exiting the process on a syntax
+// error. verbose is ignored: it used to write the AST to current_ast.json,
+// which WriteASTJSON and the interpreter's DumpAST option now do on request.
+//
+// Deprecated: Use ParseTokens, or Parse for source code, which return the
+// error instead.
 func ProduceAST(tokens []tokens.Token, verbose ...bool) ast.Program {
+	program, err := ParseTokens(tokens)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return program
+}
+
+// ParseTokens parses tokens into a program, returning a *SyntaxError
+// instead of exiting.
+func ParseTokens(tokens []tokens.Token) (program ast.Program, err error) {
+	defer recoverSyntaxError(&err)
+
 	parser := Parser{
 		Tokens: tokens,
 		Pos:    0,
 	}
+	return parser.parseProgram(), nil
+}
 
+func (p *Parser) parseProgram() ast.Program {
 	program := ast.Program{
 		Body: []ast.ASTNode{},
 	}
 
-	for parser.notEOF() {
-		parser.skipNewlines()
+	for p.notEOF() {
+		p.skipNewlines()
+		if !p.notEOF() {
+			break
+		}
 
-		program.Body = append(program.Body, parser.parseStatement())
+		if stmt := p.parseBodyStatement(); stmt != nil {
+			program.Body = append(program.Body, stmt)
+		}
 	}
 
-	isVerbose := true
-	if len(verbose) > 0 {
-		isVerbose = verbose[0]
+	return program
+}
+
+// Parse lexes and parses source code, returning a *SyntaxError instead of
+// exiting.
+func Parse(source string) (ast.Program, error) {
+	tokensList, err := Lex(source)
+	if err != nil {
+		return ast.Program{}, err
 	}
+	return ParseTokens(tokensList)
+}
 
-	if isVerbose {
-		wrappedAST := WrapASTWithKind(program)
-		jsonBytes, err := wrappedAST.MarshalJSON()
-		if err != nil {
-			log.Fatalf("Failed to marshal AST to JSON: %v", err)
-		}
+// ParseType parses source as a type annotation, such as `number[] | null`.
+func ParseType(source string) (t *ast.TypeExpr, err error) {
+	defer recoverSyntaxError(&err)
 
-		os.WriteFile("current_ast.json", jsonBytes, 0777)
+	tokensList, err := Lex(source)
+	if err != nil {
+		return nil, err
 	}
+	parser := Parser{Tokens: tokensList}
+	t = parser.parseType()
+	if parser.notEOF() {
+		tokenError(parser.at(), "Unexpected '%v' after type", parser.at().Value)
+	}
+	return t, nil
+}
 
-	return program
+// ParseAll lexes and parses source without stopping at the first syntax
+// error, for tools such as the language server that work on code as it is
+// being written. Statements that fail to parse are left out of the program,
+// except that declarations keep their name, and every error is returned,
+// ordered by position. The program should only be run if there are none.
+func ParseAll(source string) (ast.Program, []*SyntaxError) {
+	tokensList, errs := LexAll(source)
+	parser := Parser{Tokens: tokensList, recovering: true}
+	program := parser.parseProgram()
+
+	errs = append(errs, parser.errors...)
+	sort.SliceStable(errs, func(i, j int) bool {
+		a, b := errs[i].Pos, errs[j].Pos
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return program, errs
+}
+
+// WriteASTJSON writes the program as JSON, tagging every node with its kind.
+func WriteASTJSON(program ast.Program, w io.Writer) error {
+	jsonBytes, err := WrapASTWithKind(program).MarshalJSON()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(jsonBytes)
+	return err
 }
@@ -3,6 +3,7 @@ package ast
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 )
 
 type NodeKind int
@@ -34,6 +35,18 @@ const (
 	/* For blocks of statements enclosed in braces */
 	BlockStatement
 
+	/* For `try { } catch err { }` statements */
+	TryStatement
+
+	/* For `throw` statements */
+	ThrowStatement
+
+	/* For `type Name = ...` aliases */
+	TypeAlias
+
+	/* For `import { a } from "path"` and `import * as m from "path"` */
+	ImportDeclaration
+
 	// * ==================== Expressions ==================== *
 
 	/* For assignment expressions (e.g., a = b) */
@@ -101,6 +114,7 @@ const (
 	GreaterThan        BinaryOperatorKind = ">"
 	LessThanOrEqual    BinaryOperatorKind = "<="
 	GreaterThanOrEqual BinaryOperatorKind = ">="
+	Is                 BinaryOperatorKind = "is"
 	And                BinaryOperatorKind = "&&"
 	Or                 BinaryOperatorKind = "||"
 )
@@ -115,6 +129,104 @@ const (
 // ASTNode can be any AST node type
 type ASTNode any
 
+// Position is a 1-based line and column in the source. Every node except
+// Program carries the Position of the token it starts at (for binary,
+// logical and assignment expressions, of their operator) in its Pos field.
+// The zero Position means the node was not produced by the parser.
+type Position struct {
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// IsValid reports whether the position points into the source.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// Address locates a variable in a local scope, as the resolver found it:
+// Depth scopes out from the scope the code runs in, at Slot of that scope.
+// Nodes without an Address look their variable up by name, which is how
+// globals are found.
+type Address struct {
+	Depth int
+	Slot  int
+}
+
+// Scope lays out the slots of a local scope: a function's parameters and
+// variables, or the variables of an if, while, for, try or catch block.
+type Scope struct {
+	// Names holds the name of each slot
+	Names []string
+	// Constants tells which slots hold constants
+	Constants []bool
+}
+
+// PositionOf returns the position of any node, or the zero Position for
+// nodes without one.
+func PositionOf(node ASTNode) Position {
+	switch n := node.(type) {
+	case VariableDeclarationNode:
+		return n.Pos
+	case FunctionDeclarationNode:
+		return n.Pos
+	case AssignmentExprNode:
+		return n.Pos
+	case BinaryExprNode:
+		return n.Pos
+	case MemberExprNode:
+		return n.Pos
+	case CallExprNode:
+		return n.Pos
+	case IdentifierExprNode:
+		return n.Pos
+	case NumericLiteralExprNode:
+		return n.Pos
+	case StringLiteralExprNode:
+		return n.Pos
+	case BooleanLiteralExprNode:
+		return n.Pos
+	case NullLiteralExprNode:
+		return n.Pos
+	case ArrayLiteralExprNode:
+		return n.Pos
+	case PropertyNode:
+		return n.Pos
+	case ObjectLiteralExprNode:
+		return n.Pos
+	case UnaryExprNode:
+		return n.Pos
+	case LogicalExprNode:
+		return n.Pos
+	case ConditionalExprNode:
+		return n.Pos
+	case IndexExprNode:
+		return n.Pos
+	case IfStatementNode:
+		return n.Pos
+	case WhileStatementNode:
+		return n.Pos
+	case ForStatementNode:
+		return n.Pos
+	case ReturnStatementNode:
+		return n.Pos
+	case BlockStatementNode:
+		return n.Pos
+	case TryStatementNode:
+		return n.Pos
+	case ThrowStatementNode:
+		return n.Pos
+	case TypeAliasNode:
+		return n.Pos
+	case ImportDeclarationNode:
+		return n.Pos
+	}
+	return Position{}
+}
+
 // GetNodeKind returns the NodeKind for any ASTNode using type switch
 func GetNodeKind(node ASTNode) NodeKind {
 	switch node.(type) {
@@ -166,6 +278,14 @@ func GetNodeKind(node ASTNode) NodeKind {
 		return ReturnStatement
 	case BlockStatementNode, *BlockStatementNode:
 		return BlockStatement
+	case TryStatementNode, *TryStatementNode:
+		return TryStatement
+	case ThrowStatementNode, *ThrowStatementNode:
+		return ThrowStatement
+	case TypeAliasNode, *TypeAliasNode:
+		return TypeAlias
+	case ImportDeclarationNode, *ImportDeclarationNode:
+		return ImportDeclaration
 	default:
 		return -1
 	}
@@ -222,6 +342,14 @@ func GetNodeKindAsString(node ASTNode) string {
 		return "ReturnStatement"
 	case BlockStatementNode, *BlockStatementNode:
 		return "BlockStatement"
+	case TryStatementNode, *TryStatementNode:
+		return "TryStatement"
+	case ThrowStatementNode, *ThrowStatementNode:
+		return "ThrowStatement"
+	case TypeAliasNode, *TypeAliasNode:
+		return "TypeAlias"
+	case ImportDeclarationNode, *ImportDeclarationNode:
+		return "ImportDeclaration"
 	default:
 		return "ERR_UNKNOWN"
 	}
@@ -327,6 +455,14 @@ func (n *JSONNode) UnmarshalJSON(data []byte) error {
 		node = &ReturnStatementNode{}
 	case "BlockStatement":
 		node = &BlockStatementNode{}
+	case "TryStatement":
+		node = &TryStatementNode{}
+	case "ThrowStatement":
+		node = &ThrowStatementNode{}
+	case "TypeAlias":
+		node = &TypeAliasNode{}
+	case "ImportDeclaration":
+		node = &ImportDeclarationNode{}
 	default:
 		return fmt.Errorf("unknown node kind: %s", kindStr)
 	}
@@ -355,6 +491,15 @@ type VariableDeclarationNode struct {
 	Identifier string
 	// Value is the initial value assigned to the variable
 	Value ASTNode
+	// Type is the annotation of the variable, nil if it has none
+	Type *TypeExpr `json:",omitempty"`
+	// Exported is true for `export let` and `export const`
+	Exported bool `json:",omitempty"`
+	Pos      Position
+	// NamePos is the position of Identifier
+	NamePos Position
+	// Addr is the slot of a local variable, nil for globals
+	Addr *Address `json:",omitempty"`
 }
 
 // FunctionDeclarationNode represents a function declaration statement in the AST.
@@ -366,6 +511,31 @@ type FunctionDeclarationNode struct {
 	Name string
 	// Body contains the statements within the function
 	Body []ASTNode
+	Pos  Position
+	// NamePos is the position of Name, ParamPos that of each parameter
+	NamePos  Position
+	ParamPos []Position
+	// ParamTypes are the annotations of the parameters, nil where one has
+	// none, and ReturnType that of the value popped. Both are nil for a
+	// function without annotations.
+	ParamTypes []*TypeExpr `json:",omitempty"`
+	ReturnType *TypeExpr   `json:",omitempty"`
+	// Exported is true for `export fn`
+	Exported bool `json:",omitempty"`
+	// TestName is the name of a test block, `test "name" { ... }`, which
+	// declares a function named TestFunctionName(TestName), and NamePos is
+	// the opening quote of the name. It is empty for other functions.
+	TestName string `json:",omitempty"`
+	// Addr is the slot of a local function, nil for globals
+	Addr *Address `json:",omitempty"`
+	// Scope lays out the parameters and variables of a call
+	Scope *Scope `json:",omitempty"`
+}
+
+// TestFunctionName is the name of the function a test block declares. No
+// identifier can be written like it, so it never clashes with another.
+func TestFunctionName(name string) string {
+	return "test " + strconv.Quote(name)
 }
 
 // AssignmentExprNode represents an assignment expression in the AST.
@@ -375,6 +545,7 @@ type AssignmentExprNode struct {
 	Assignee ASTNode
 	// Value is the expression being assigned
 	Value ASTNode
+	Pos   Position
 }
 
 // BinaryExprNode represents a binary operation expression in the AST.
@@ -386,6 +557,7 @@ type BinaryExprNode struct {
 	Right ASTNode
 	// Operator specifies the binary operation (e.g., +, -, ==)
 	Operator BinaryOperatorKind
+	Pos      Position
 }
 
 // MemberExprNode represents a member access expression in the AST.
@@ -397,6 +569,7 @@ type MemberExprNode struct {
 	Property ASTNode
 	// Computed is true if bracket notation is used, false for dot notation
 	Computed bool
+	Pos      Position
 }
 
 // CallExprNode represents a function call expression in the AST.
@@ -406,34 +579,43 @@ type CallExprNode struct {
 	Caller ASTNode
 	// Args contains the arguments passed to the function
 	Args []ASTNode
+	Pos  Position
 }
 
 // IdentifierExprNode represents an identifier (variable or function name) in the AST.
 type IdentifierExprNode struct {
 	// Symbol is the identifier's name
 	Symbol string
+	Pos    Position
+	// Addr is where a local variable lives, nil for globals
+	Addr *Address `json:",omitempty"`
 }
 
 // NumericLiteralExprNode represents a numeric literal value in the AST.
 type NumericLiteralExprNode struct {
 	// Value is the numeric value
 	Value float64
+	Pos   Position
 }
 
 // StringLiteralExprNode represents a string literal value in the AST.
 type StringLiteralExprNode struct {
 	// Value is the string content
 	Value string
+	Pos   Position
 }
 
 // BooleanLiteralExprNode represents a boolean literal value in the AST.
 type BooleanLiteralExprNode struct {
 	// Value is the boolean value (true or false)
 	Value bool
+	Pos   Position
 }
 
 // NullLiteralExprNode represents a null literal value in the AST.
-type NullLiteralExprNode struct{}
+type NullLiteralExprNode struct {
+	Pos Position
+}
 
 // ArrayLiteralExprNode represents an array literal expression in the AST.
 // It contains a list of expressions enclosed in brackets (e.g., [1, 2, 3]).
@@ -441,6 +623,7 @@ type ArrayLiteralExprNode struct {
 	// Elements contains all expressions in the array
 	Elements []ASTNode
 	Size     int64
+	Pos      Position
 }
 
 // PropertyNode represents a key-value pair property inside an object literal in the AST.
@@ -450,6 +633,10 @@ type PropertyNode struct {
 	Key string
 	// Value is the expression assigned to the property (e.g., 42 in {foo: 42})
 	Value ASTNode
+	Pos   Position
+	// Addr is where the variable of a shorthand property ({foo}) lives,
+	// nil for globals
+	Addr *Address `json:",omitempty"`
 }
 
 // ObjectLiteralExprNode represents an object literal expression in the AST.
@@ -457,6 +644,7 @@ type PropertyNode struct {
 type ObjectLiteralExprNode struct {
 	// Properties contains all key-value pairs in the object
 	Properties []PropertyNode
+	Pos        Position
 }
 
 // UnaryExprNode represents a unary operation expression in the AST.
@@ -466,6 +654,7 @@ type UnaryExprNode struct {
 	Operator UnaryOperatorKind
 	// Operand is the expression being operated on
 	Operand ASTNode
+	Pos     Position
 }
 
 // LogicalExprNode represents a logical operation expression in the AST.
@@ -477,6 +666,7 @@ type LogicalExprNode struct {
 	Right ASTNode
 	// Operator specifies the logical operation ("&&" or "||")
 	Operator BinaryOperatorKind
+	Pos      Position
 }
 
 // ConditionalExprNode represents a ternary conditional expression in the AST.
@@ -488,6 +678,7 @@ type ConditionalExprNode struct {
 	Consequent ASTNode
 	// Alternate is the expression evaluated if condition is false
 	Alternate ASTNode
+	Pos       Position
 }
 
 // IndexExprNode represents an index access expression in the AST.
@@ -497,6 +688,7 @@ type IndexExprNode struct {
 	Object ASTNode
 	// Index is the index expression
 	Index ASTNode
+	Pos   Position
 }
 
 // IfStatementNode represents an if statement in the AST.
@@ -508,6 +700,12 @@ type IfStatementNode struct {
 	Consequent ASTNode
 	// Alternate is the optional else statement/block
 	Alternate ASTNode
+	Pos       Position
+	// Scope lays out the variables of the condition and consequent
+	Scope *Scope `json:",omitempty"`
+	// AlternateScope lays out the variables of an `else` block, nil for
+	// `else if`, which opens its own
+	AlternateScope *Scope `json:",omitempty"`
 }
 
 // WhileStatementNode represents a while loop in the AST.
@@ -516,6 +714,9 @@ type WhileStatementNode struct {
 	Condition ASTNode
 	// Body is the statement/block executed while condition is true
 	Body ASTNode
+	Pos  Position
+	// Scope lays out the variables of the loop
+	Scope *Scope `json:",omitempty"`
 }
 
 // ForStatementNode represents a for loop in the AST.
@@ -528,16 +729,89 @@ type ForStatementNode struct {
 	Update ASTNode
 	// Body is the statement/block executed in each iteration
 	Body ASTNode
+	Pos  Position
+	// Scope lays out the variables of the loop
+	Scope *Scope `json:",omitempty"`
 }
 
 // ReturnStatementNode represents a return statement in the AST.
 type ReturnStatementNode struct {
 	// Value is the optional expression being returned
 	Value ASTNode
+	Pos   Position
 }
 
 // BlockStatementNode represents a block of statements enclosed in braces in the AST.
 type BlockStatementNode struct {
 	// Body contains all statements within the block
 	Body []ASTNode
+	Pos  Position
+}
+
+// TryStatementNode represents a try/catch statement in the AST.
+type TryStatementNode struct {
+	// Body is the block whose errors are caught
+	Body ASTNode
+	// Param is the name the caught error is bound to, empty for a bare `catch`
+	Param string
+	// Handler is the block run when Body fails
+	Handler ASTNode
+	Pos     Position
+	// ParamPos is the position of Param
+	ParamPos Position
+	// Scope lays out the variables of Body, HandlerScope the caught error
+	// and the variables of Handler
+	Scope        *Scope `json:",omitempty"`
+	HandlerScope *Scope `json:",omitempty"`
+}
+
+// ThrowStatementNode represents a throw statement in the AST.
+type ThrowStatementNode struct {
+	// Value is the expression being thrown
+	Value ASTNode
+	Pos   Position
+}
+
+// TypeAliasNode names a type: `type Point = { x: number, y: number }`.
+// It does nothing when run.
+type TypeAliasNode struct {
+	Name string
+	Type *TypeExpr
+	Pos  Position
+	// NamePos is the position of Name
+	NamePos Position
+}
+
+// ImportDeclarationNode binds exports of another module as constants:
+// `import { a, b as c } from "./util.pop"` binds Names, and
+// `import * as m from "./util.pop"` binds Namespace to an object of all of
+// them. Imports only appear at the top level.
+type ImportDeclarationNode struct {
+	// Specifier is the module as written, resolved by the ModuleResolver
+	// from the importing module
+	Specifier string
+	// Names are the exports imported by name, nil for a namespace import
+	Names []ImportName `json:",omitempty"`
+	// Namespace is the variable of a namespace import, empty otherwise
+	Namespace string `json:",omitempty"`
+	// Default marks a namespace import written `import m from "path"`,
+	// short for `import * as m from "path"`
+	Default bool `json:",omitempty"`
+	Pos     Position
+	// SpecifierPos is the position of the opening quote of Specifier, and
+	// NamespacePos that of Namespace
+	SpecifierPos Position
+	NamespacePos Position `json:",omitempty"`
+}
+
+// ImportName is an export imported by name, as Local if it is renamed with
+// `as`.
+type ImportName struct {
+	Name string
+	// Local is the name of the variable the export is bound to
+	Local string
+	// Pos is the position of Name, LocalPos that of Local, which is the
+	// same unless the export is renamed
+	Pos      Position
+	LocalPos Position
 }
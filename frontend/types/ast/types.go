@@ -0,0 +1,123 @@
+package ast
+
+import "strings"
+
+// TypeKind tells what a TypeExpr describes.
+type TypeKind int
+
+const (
+	// NamedType is number, string, boolean, null, any or the name of a
+	// type alias
+	NamedType TypeKind = iota
+	// ArrayType is `Elem[]`
+	ArrayType
+	// ObjectType is `{ key: T, other?: T }`
+	ObjectType
+	// UnionType is `A | B`
+	UnionType
+	// NullableType is `Elem?`, short for `Elem | null`
+	NullableType
+	// FunctionType is `fn(A, B): R`
+	FunctionType
+)
+
+// TypeExpr is a type annotation as written. It is not a node of its own:
+// declarations carry it, and only the type checker and the runtime checks
+// of annotations read it.
+type TypeExpr struct {
+	Kind TypeKind
+	// Name is that of a NamedType
+	Name string `json:",omitempty"`
+	// Elem is the element of an ArrayType or NullableType, and the return
+	// type of a FunctionType, nil if it has none
+	Elem *TypeExpr `json:",omitempty"`
+	// Types are the members of a UnionType, and the parameters of a
+	// FunctionType
+	Types []*TypeExpr `json:",omitempty"`
+	// Fields are the properties of an ObjectType
+	Fields []TypeField `json:",omitempty"`
+	Pos    Position
+}
+
+// TypeField is a property of an object type.
+type TypeField struct {
+	Key string
+	// Optional fields may be missing or null
+	Optional bool `json:",omitempty"`
+	Type     *TypeExpr
+	Pos      Position
+}
+
+// String returns the type as it is written in source.
+func (t *TypeExpr) String() string {
+	var b strings.Builder
+	t.write(&b, false)
+	return b.String()
+}
+
+// write writes the type to b, with a union in parentheses if it is the
+// element of an array or nullable type.
+func (t *TypeExpr) write(b *strings.Builder, inner bool) {
+	switch t.Kind {
+	case NamedType:
+		b.WriteString(t.Name)
+	case ArrayType:
+		t.Elem.write(b, true)
+		b.WriteString("[]")
+	case NullableType:
+		t.Elem.write(b, true)
+		b.WriteString("?")
+	case ObjectType:
+		if len(t.Fields) == 0 {
+			b.WriteString("{}")
+			return
+		}
+		b.WriteString("{ ")
+		for i, field := range t.Fields {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(field.Key)
+			if field.Optional {
+				b.WriteString("?")
+			}
+			b.WriteString(": ")
+			field.Type.write(b, false)
+		}
+		b.WriteString(" }")
+	case UnionType:
+		if inner {
+			b.WriteString("(")
+		}
+		for i, member := range t.Types {
+			if i > 0 {
+				b.WriteString(" | ")
+			}
+			member.write(b, true)
+		}
+		if inner {
+			b.WriteString(")")
+		}
+	case FunctionType:
+		// A function type is in parentheses where its return type would
+		// take what follows it
+		if inner {
+			b.WriteString("(")
+		}
+		b.WriteString("fn(")
+		for i, param := range t.Types {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			param.write(b, false)
+		}
+		b.WriteString(")")
+		if t.Elem != nil {
+			b.WriteString(": ")
+			t.Elem.write(b, true)
+		}
+		if inner {
+			b.WriteString(")")
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package ast
+
+// MapChildren returns a copy of node with f applied to each node directly
+// inside it, for passes that rewrite the tree. The names of dot accesses
+// are not nodes of their own and are left alone.
+func MapChildren(node ASTNode, f func(ASTNode) ASTNode) ASTNode {
+	child := func(n ASTNode) ASTNode {
+		if n == nil {
+			return nil
+		}
+		return f(n)
+	}
+	list := func(nodes []ASTNode) []ASTNode {
+		if nodes == nil {
+			return nil
+		}
+		out := make([]ASTNode, len(nodes))
+		for i, n := range nodes {
+			out[i] = f(n)
+		}
+		return out
+	}
+
+	switch n := node.(type) {
+	case Program:
+		n.Body = list(n.Body)
+		return n
+	case VariableDeclarationNode:
+		n.Value = child(n.Value)
+		return n
+	case FunctionDeclarationNode:
+		n.Body = list(n.Body)
+		return n
+	case AssignmentExprNode:
+		n.Assignee = child(n.Assignee)
+		n.Value = child(n.Value)
+		return n
+	case BinaryExprNode:
+		n.Left = child(n.Left)
+		n.Right = child(n.Right)
+		return n
+	case LogicalExprNode:
+		n.Left = child(n.Left)
+		n.Right = child(n.Right)
+		return n
+	case UnaryExprNode:
+		n.Operand = child(n.Operand)
+		return n
+	case MemberExprNode:
+		n.Object = child(n.Object)
+		if n.Computed {
+			n.Property = child(n.Property)
+		}
+		return n
+	case CallExprNode:
+		n.Caller = child(n.Caller)
+		n.Args = list(n.Args)
+		return n
+	case ArrayLiteralExprNode:
+		n.Elements = list(n.Elements)
+		return n
+	case ObjectLiteralExprNode:
+		properties := make([]PropertyNode, len(n.Properties))
+		for i, property := range n.Properties {
+			property.Value = child(property.Value)
+			properties[i] = property
+		}
+		n.Properties = properties
+		return n
+	case ConditionalExprNode:
+		n.Condition = child(n.Condition)
+		n.Consequent = child(n.Consequent)
+		n.Alternate = child(n.Alternate)
+		return n
+	case IndexExprNode:
+		n.Object = child(n.Object)
+		n.Index = child(n.Index)
+		return n
+	case IfStatementNode:
+		n.Condition = child(n.Condition)
+		n.Consequent = child(n.Consequent)
+		n.Alternate = child(n.Alternate)
+		return n
+	case WhileStatementNode:
+		n.Condition = child(n.Condition)
+		n.Body = child(n.Body)
+		return n
+	case ForStatementNode:
+		n.Init = child(n.Init)
+		n.Condition = child(n.Condition)
+		n.Update = child(n.Update)
+		n.Body = child(n.Body)
+		return n
+	case ReturnStatementNode:
+		n.Value = child(n.Value)
+		return n
+	case BlockStatementNode:
+		n.Body = list(n.Body)
+		return n
+	case TryStatementNode:
+		n.Body = child(n.Body)
+		n.Handler = child(n.Handler)
+		return n
+	case ThrowStatementNode:
+		n.Value = child(n.Value)
+		return n
+	}
+	return node
+}
@@ -41,6 +41,7 @@ const (
     Greater      // >
     LessEqual    // <=
     GreaterEqual // >=
+    Is           // is
 
     // Logical operators
     And // &&
@@ -58,6 +59,22 @@ const (
 		While
 		For
 
+		// Error handling
+		Try
+		Catch
+		Throw
+
+		// Modules
+		Import
+		Export
+
+    // Type annotations
+    Pipe     // |
+    Question // ?
+
+    // Comments, which only LexTrivia keeps
+    Comment
+
     // End of File
     EOF
 )
@@ -65,6 +82,9 @@ const (
 type Token struct {
 	Value     string
 	TokenType TokenType
+	// Line and Column locate the token's first character, both 1-based
+	Line   int
+	Column int
 }
 
 func (t TokenType) String() string {
@@ -121,6 +141,8 @@ func (t TokenType) String() string {
 		return "LessEqual"
 	case GreaterEqual:
 		return "GreaterEqual"
+	case Is:
+		return "Is"
 	case And:
 		return "And"
 	case Or:
@@ -133,6 +155,22 @@ func (t TokenType) String() string {
 		return "True"
 	case False:
 		return "False"
+	case Try:
+		return "Try"
+	case Catch:
+		return "Catch"
+	case Throw:
+		return "Throw"
+	case Import:
+		return "Import"
+	case Export:
+		return "Export"
+	case Pipe:
+		return "Pipe"
+	case Question:
+		return "Question"
+	case Comment:
+		return "Comment"
 	case EOF:
 		return "EOF"
 	default:
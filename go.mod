@@ -4,11 +4,13 @@ go 1.23.2
 
 toolchain go1.24.9
 
-require github.com/sourcegraph/jsonrpc2 v0.2.1
+require (
+	github.com/sourcegraph/jsonrpc2 v0.2.1
+	github.com/stretchr/testify v1.11.1
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/stretchr/testify v1.11.1 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
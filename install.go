@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	BE "pop/backend"
+	"pop/packages"
+)
+
+// install installs the dependencies of a package into its pop_modules.
+func install(_ BE.Options, args []string) int {
+	flags := flag.NewFlagSet("install", flag.ExitOnError)
+	registry := flags.String("registry", os.Getenv("POPCORN_REGISTRY"), "the `directory` of package tarballs to install versions from (default $POPCORN_REGISTRY)")
+	frozen := flags.Bool("frozen", false, "fail instead of changing "+packages.LockFile)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: popcorn install [-registry dir] [-frozen] [dir]\n\nInstalls the dependencies in the %s of the package in dir, the current\ndirectory by default, and theirs into its %s directory, and records\nthem in %s.\n\nFlags:\n", packages.ManifestFile, packages.ModulesDir, packages.LockFile)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	dir := "."
+	switch flags.NArg() {
+	case 0:
+	case 1:
+		dir = flags.Arg(0)
+	default:
+		flags.Usage()
+		return 2
+	}
+
+	lock, err := packages.Install(dir, packages.Options{Registry: *registry, Frozen: *frozen, Log: os.Stdout})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	noun := "packages"
+	if len(lock.Packages) == 1 {
+		noun = "package"
+	}
+	fmt.Printf("%d %s installed\n", len(lock.Packages), noun)
+	return 0
+}
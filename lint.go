@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	BE "pop/backend"
+	"pop/lint"
+	"text/tabwriter"
+)
+
+// lintFiles reports the problems the linter finds in source files, and
+// fixes those it can.
+func lintFiles(_ BE.Options, args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	configPath := flags.String("config", "", "read the severities of rules from this file (default: "+lint.DefaultConfigFile+" if there is one)")
+	fix := flags.Bool("fix", false, "make the fixes that cannot change what programs do, and report what is left")
+	list := flags.Bool("rules", false, "list the rules and their severities")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: popcorn lint [-config file] [-fix] [-rules] [path...]\n\nChecks the .pop files given, and those in the directories given, or the\ncurrent directory. Fails if there are warnings or errors. A comment\n`// lint:ignore rule` silences a rule on its line, or alone on a line, on\nthe next.\n\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	// Accept the flags after the paths too
+	flags.Parse(args)
+	var paths []string
+	for flags.NArg() > 0 {
+		paths = append(paths, flags.Arg(0))
+		flags.Parse(flags.Args()[1:])
+	}
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	config, err := loadLintConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading lint config: %v\n", err)
+		return 1
+	}
+	if *list {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, rule := range lint.Rules() {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", rule.Name, config.Severity(rule), rule.Doc)
+		}
+		w.Flush()
+		return 0
+	}
+
+	files, err := sourceFiles(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	status := 0
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", file, err)
+			status = 1
+			continue
+		}
+		source := string(data)
+		diagnostics, err := lint.Lint(source, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			status = 1
+			continue
+		}
+
+		if *fix {
+			// Fixes that overlap are made by the next round
+			for round := 0; round < 10; round++ {
+				fixed := lint.ApplyFixes(source, diagnostics)
+				if fixed == source {
+					break
+				}
+				source = fixed
+				if diagnostics, err = lint.Lint(source, config); err != nil {
+					fmt.Fprintf(os.Stderr, "%s: fixing broke the file: %v\n", file, err)
+					return 1
+				}
+			}
+			if source != string(data) {
+				if err := os.WriteFile(file, []byte(source), 0o644); err != nil {
+					fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", file, err)
+					return 1
+				}
+			}
+		}
+
+		for _, d := range diagnostics {
+			fmt.Printf("%s:%s\n", file, d)
+			if d.Severity >= lint.Warning {
+				status = 1
+			}
+		}
+	}
+	return status
+}
+
+// loadLintConfig reads the config at path, or the default one if path is
+// empty and there is one.
+func loadLintConfig(path string) (lint.Config, error) {
+	if path != "" {
+		return lint.LoadConfig(path)
+	}
+	config, err := lint.LoadConfig(lint.DefaultConfigFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return lint.Config{}, nil
+	}
+	return config, err
+}
@@ -0,0 +1,292 @@
+// Package lint checks programs for code that runs but is likely a mistake:
+// variables nothing uses, conditions that are always the same, code that
+// never runs, and the like.
+//
+//	diagnostics, err := lint.Lint(source, lint.Config{})
+//
+// Each check is a Rule, with a name and a severity that a Config can change
+// or turn off. The rules of this package are listed by Rules, and others
+// can be added with Register. A comment
+//
+//	// lint:ignore unused-variable, shadowing
+//
+// silences the rules it lists on its own line, or, alone on a line, on the
+// line after it. Some diagnostics come with a Fix, which ApplyFixes makes
+// when it cannot change what the program does.
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	FE "pop/frontend"
+	"pop/frontend/types/ast"
+	"pop/frontend/types/tokens"
+	"pop/resolver"
+	"sort"
+	"strings"
+)
+
+// Severity tells how much a diagnostic matters.
+type Severity int
+
+const (
+	// Off turns a rule off
+	Off Severity = iota
+	Info
+	Warning
+	Error
+)
+
+var severities = []string{"off", "info", "warning", "error"}
+
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severities) {
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+	return severities[s]
+}
+
+// ParseSeverity reads the name of a severity: off, info, warning or error.
+func ParseSeverity(name string) (Severity, error) {
+	for i, s := range severities {
+		if s == name {
+			return Severity(i), nil
+		}
+	}
+	return Off, fmt.Errorf("unknown severity %q, want off, info, warning or error", name)
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Severity) UnmarshalText(text []byte) error {
+	severity, err := ParseSeverity(string(text))
+	*s = severity
+	return err
+}
+
+// Rule is a check of a program.
+type Rule struct {
+	// Name is how configs and lint:ignore comments refer to the rule, such
+	// as unused-variable
+	Name string
+	// Doc tells in a sentence what the rule reports
+	Doc string
+	// Severity is that of the rule unless a Config sets another
+	Severity Severity
+	// Check reports the problems it finds in the program of the pass
+	Check func(p *Pass)
+}
+
+// rules are the registered rules by name, and order their names in the
+// order they were registered.
+var (
+	rules = map[string]*Rule{}
+	order []string
+)
+
+// Register adds a rule to those Lint runs. It panics if a rule of the same
+// name is registered.
+func Register(rule *Rule) {
+	if _, exists := rules[rule.Name]; exists {
+		panic(fmt.Sprintf("lint: rule %s is registered twice", rule.Name))
+	}
+	rules[rule.Name] = rule
+	order = append(order, rule.Name)
+}
+
+// Rules returns the registered rules, in the order they were registered.
+func Rules() []*Rule {
+	list := make([]*Rule, len(order))
+	for i, name := range order {
+		list[i] = rules[name]
+	}
+	return list
+}
+
+// DefaultConfigFile is the name of the config file popcorn lint reads from
+// the current directory.
+const DefaultConfigFile = ".popcornlint.json"
+
+// Config sets the severity of rules. It is read from JSON such as
+//
+//	{"rules": {"shadowing": "off", "empty-block": "error"}}
+type Config struct {
+	// Rules are the severities by rule name. Rules not listed keep their
+	// own.
+	Rules map[string]Severity `json:"rules"`
+}
+
+// LoadConfig reads the config file at path. It fails on rules that are not
+// registered.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	for name := range config.Rules {
+		if _, ok := rules[name]; !ok {
+			return Config{}, fmt.Errorf("%s: unknown rule %q", path, name)
+		}
+	}
+	return config, nil
+}
+
+// Severity returns the severity of rule under the config.
+func (c Config) Severity(rule *Rule) Severity {
+	if severity, ok := c.Rules[rule.Name]; ok {
+		return severity
+	}
+	return rule.Severity
+}
+
+// Diagnostic is a problem a rule found.
+type Diagnostic struct {
+	Rule     string
+	Severity Severity
+	// Pos and End delimit the code in question, End excluded
+	Pos, End ast.Position
+	Message  string
+	// Fix is nil if there is no safe fix
+	Fix *Fix
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s (%s)", d.Pos.Line, d.Pos.Column, d.Severity, d.Message, d.Rule)
+}
+
+// Fix is a change that solves the problem of a diagnostic.
+type Fix struct {
+	// Message tells what the fix does, such as "Remove 'x'"
+	Message string
+	Edits   []Edit
+}
+
+// Edit replaces the source from Pos to End, End excluded, with NewText.
+type Edit struct {
+	Pos, End ast.Position
+	NewText  string
+}
+
+// Lint runs the rules that are not off under config on source, and returns
+// what they find ordered by position. It fails with a
+// *frontend.SyntaxError if source does not parse.
+func Lint(source string, config Config) ([]Diagnostic, error) {
+	program, err := FE.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	pass := newPass(source, program)
+
+	for _, rule := range Rules() {
+		severity := config.Severity(rule)
+		if severity == Off {
+			continue
+		}
+		pass.rule, pass.severity = rule, severity
+		rule.Check(pass)
+	}
+
+	ignored := pass.ignored()
+	diagnostics := []Diagnostic{}
+	for _, d := range pass.diagnostics {
+		if !ignored[d.Pos.Line][d.Rule] {
+			diagnostics = append(diagnostics, d)
+		}
+	}
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		return before(diagnostics[i].Pos, diagnostics[j].Pos)
+	})
+	return diagnostics, nil
+}
+
+// Pass is a run of a rule over a program.
+type Pass struct {
+	Program ast.Program
+	// Symbols are the scopes, declarations and variable references of the
+	// program
+	Symbols *resolver.Symbols
+	// Tokens are those of the source, without its comments
+	Tokens   []tokens.Token
+	Comments []tokens.Token
+
+	lines       []string
+	rule        *Rule
+	severity    Severity
+	diagnostics []Diagnostic
+}
+
+func newPass(source string, program ast.Program) *Pass {
+	p := &Pass{Program: program, Symbols: &resolver.Symbols{}, lines: strings.Split(source, "\n")}
+	// Without globals to check against, resolving does not fail
+	resolver.Resolve(program, resolver.Options{Symbols: p.Symbols})
+
+	all, _ := FE.LexTrivia(source)
+	for _, tk := range all {
+		if tk.TokenType == tokens.Comment {
+			p.Comments = append(p.Comments, tk)
+		} else {
+			p.Tokens = append(p.Tokens, tk)
+		}
+	}
+	return p
+}
+
+// Report records a problem with the code from pos to end for the rule
+// being run. fix may be nil.
+func (p *Pass) Report(pos, end ast.Position, message string, fix *Fix) {
+	p.diagnostics = append(p.diagnostics, Diagnostic{
+		Rule:     p.rule.Name,
+		Severity: p.severity,
+		Pos:      pos,
+		End:      end,
+		Message:  message,
+		Fix:      fix,
+	})
+}
+
+// ignoreDirective starts the comments that silence rules.
+const ignoreDirective = "// lint:ignore "
+
+// ignored returns the rules lint:ignore comments silence by line.
+func (p *Pass) ignored() map[int]map[string]bool {
+	ignored := map[int]map[string]bool{}
+	for _, comment := range p.Comments {
+		if !strings.HasPrefix(comment.Value, ignoreDirective) {
+			continue
+		}
+		// A comment alone on its line is about the next one
+		line := comment.Line
+		if !p.followsCode(comment) {
+			line++
+		}
+		if ignored[line] == nil {
+			ignored[line] = map[string]bool{}
+		}
+		// Rules are listed up to the first word that is not followed by a
+		// comma, and the rest of the comment tells why
+		for _, field := range strings.Fields(strings.TrimPrefix(comment.Value, ignoreDirective)) {
+			for _, name := range strings.Split(field, ",") {
+				if name != "" {
+					ignored[line][name] = true
+				}
+			}
+			if !strings.HasSuffix(field, ",") {
+				break
+			}
+		}
+	}
+	return ignored
+}
+
+// followsCode reports whether there is code before comment on its line.
+func (p *Pass) followsCode(comment tokens.Token) bool {
+	runes := []rune(p.lines[comment.Line-1])
+	return strings.TrimSpace(string(runes[:comment.Column-1])) != ""
+}
@@ -0,0 +1,466 @@
+package lint
+
+import (
+	"fmt"
+	"pop/frontend/types/ast"
+	"pop/resolver"
+)
+
+func init() {
+	for _, rule := range []*Rule{
+		{"unused-variable", "Variables, functions and imports that are declared but never used", Warning, unusedVariables},
+		{"unused-parameter", "Parameters of functions and catch clauses that are never used", Warning, unusedParameters},
+		{"shadowing", "Declarations that hide a variable of the same name in a scope around them", Info, shadowing},
+		{"unreachable", "Statements after a pop or throw, which never run", Warning, unreachable},
+		{"constant-condition", "Conditions of if and while that are always the same, apart from `while true`", Warning, constantConditions},
+		{"self-assign", "Assignments of a variable or property to itself", Warning, selfAssignments},
+		{"null-comparison", "Comparisons with null other than == and !=: ordering always throws, and `is` is ==", Warning, nullComparisons},
+		{"empty-block", "Empty blocks of if, else, while, for, try and catch", Warning, emptyBlocks},
+		{"missing-return", "Functions that pop a value on some paths but not on others", Warning, missingReturns},
+	} {
+		Register(rule)
+	}
+}
+
+// walk calls visit on node and every node inside it.
+func walk(node ast.ASTNode, visit func(node ast.ASTNode)) {
+	var each func(node ast.ASTNode) ast.ASTNode
+	each = func(node ast.ASTNode) ast.ASTNode {
+		visit(node)
+		return ast.MapChildren(node, each)
+	}
+	each(node)
+}
+
+// bodies calls visit with the top-level statements of program, for which
+// top is set, and with those of each block and function body.
+func bodies(program ast.Program, visit func(stmts []ast.ASTNode, top bool)) {
+	visit(program.Body, true)
+	walk(program, func(node ast.ASTNode) {
+		switch n := node.(type) {
+		case ast.BlockStatementNode:
+			visit(n.Body, false)
+		case ast.FunctionDeclarationNode:
+			visit(n.Body, false)
+		}
+	})
+}
+
+// reads counts the references that read each declaration.
+func reads(symbols *resolver.Symbols) map[*resolver.Declaration]int {
+	counts := map[*resolver.Declaration]int{}
+	for _, ref := range symbols.References {
+		if ref.Declaration != nil && !ref.Assignment {
+			counts[ref.Declaration]++
+		}
+	}
+	return counts
+}
+
+// assigned reports which declarations are assigned to.
+func assigned(symbols *resolver.Symbols) map[*resolver.Declaration]bool {
+	found := map[*resolver.Declaration]bool{}
+	for _, ref := range symbols.References {
+		if ref.Declaration != nil && ref.Assignment {
+			found[ref.Declaration] = true
+		}
+	}
+	return found
+}
+
+// removable returns the statements of bodies that can go without changing
+// what the program does, but for their own effect, by the position they
+// start at: those on lines of their own that are not the last of their
+// body, whose value a function or program may return.
+func (p *Pass) removable() map[ast.Position]*Edit {
+	found := map[ast.Position]*Edit{}
+	bodies(p.Program, func(stmts []ast.ASTNode, _ bool) {
+		for _, stmt := range stmts[:max(len(stmts)-1, 0)] {
+			if edit := p.RemoveLines(Start(stmt), p.End(stmt)); edit != nil {
+				found[Start(stmt)] = edit
+			}
+		}
+	})
+	return found
+}
+
+// pure reports whether evaluating node cannot do anything or fail.
+func pure(node ast.ASTNode) bool {
+	switch n := node.(type) {
+	case nil, ast.NumericLiteralExprNode, ast.StringLiteralExprNode, ast.BooleanLiteralExprNode, ast.NullLiteralExprNode,
+		ast.IdentifierExprNode, ast.FunctionDeclarationNode:
+		return true
+	case ast.ArrayLiteralExprNode:
+		for _, element := range n.Elements {
+			if !pure(element) {
+				return false
+			}
+		}
+		return true
+	case ast.ObjectLiteralExprNode:
+		for _, property := range n.Properties {
+			if !pure(property.Value) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func unusedVariables(p *Pass) {
+	counts, assignments, removable := reads(p.Symbols), assigned(p.Symbols), p.removable()
+	for _, decl := range p.Symbols.Declarations {
+		// Uses of a name declared twice in a scope refer to the first
+		// declaration, and the second fails when it runs
+		if counts[decl] > 0 || declared(decl.Scope, decl.Name) != decl {
+			continue
+		}
+		var value ast.ASTNode
+		what := "Variable"
+		switch n := decl.Node.(type) {
+		case ast.VariableDeclarationNode:
+			if n.Exported {
+				continue
+			}
+			value = n.Value
+		case ast.FunctionDeclarationNode:
+			// Test blocks are called by the test runner
+			if decl.Kind != resolver.Function || n.Exported || n.TestName != "" {
+				continue
+			}
+			what, value = "Function", n
+		case ast.ImportDeclarationNode:
+			// Importing runs the module, so the import cannot simply go
+			p.Report(decl.Pos, Span(decl.Pos, decl.Name), fmt.Sprintf("Import '%s' is never used", decl.Name), nil)
+			continue
+		default:
+			continue
+		}
+
+		message := fmt.Sprintf("%s '%s' is never used", what, decl.Name)
+		if assignments[decl] {
+			message = fmt.Sprintf("%s '%s' is assigned to but never used", what, decl.Name)
+		}
+		// The declaration can go if nothing assigns to the variable and its
+		// value has no effects
+		var fix *Fix
+		if edit := removable[ast.PositionOf(decl.Node)]; edit != nil && !assignments[decl] && pure(value) {
+			fix = &Fix{Message: fmt.Sprintf("Remove '%s'", decl.Name), Edits: []Edit{*edit}}
+		}
+		p.Report(decl.Pos, Span(decl.Pos, decl.Name), message, fix)
+	}
+}
+
+func unusedParameters(p *Pass) {
+	counts := reads(p.Symbols)
+	for _, decl := range p.Symbols.Declarations {
+		if counts[decl] > 0 {
+			continue
+		}
+		switch decl.Kind {
+		case resolver.Parameter:
+			p.Report(decl.Pos, Span(decl.Pos, decl.Name), fmt.Sprintf("Parameter '%s' is never used", decl.Name), nil)
+		case resolver.CatchParameter:
+			// `catch err {` becomes `catch {`
+			catch := p.tokenBefore(decl.Pos)
+			fix := &Fix{
+				Message: fmt.Sprintf("Remove '%s'", decl.Name),
+				Edits:   []Edit{{Pos: tokenEnd(catch), End: Span(decl.Pos, decl.Name)}},
+			}
+			p.Report(decl.Pos, Span(decl.Pos, decl.Name), fmt.Sprintf("Caught error '%s' is never used", decl.Name), fix)
+		}
+	}
+}
+
+func shadowing(p *Pass) {
+	for _, decl := range p.Symbols.Declarations {
+		for scope := decl.Scope.Parent; scope != nil; scope = scope.Parent {
+			if outer := declared(scope, decl.Name); outer != nil {
+				p.Report(decl.Pos, Span(decl.Pos, decl.Name),
+					fmt.Sprintf("'%s' shadows the variable declared on line %d", decl.Name, outer.Pos.Line), nil)
+				break
+			}
+		}
+	}
+}
+
+func declared(scope *resolver.SymbolScope, name string) *resolver.Declaration {
+	for _, decl := range scope.Declarations {
+		if decl.Name == name {
+			return decl
+		}
+	}
+	return nil
+}
+
+func unreachable(p *Pass) {
+	bodies(p.Program, func(stmts []ast.ASTNode, top bool) {
+		// A top-level pop only ends the statement it is in
+		if top {
+			return
+		}
+		for i, stmt := range stmts[:max(len(stmts)-1, 0)] {
+			switch stmt.(type) {
+			case ast.ReturnStatementNode, ast.ThrowStatementNode:
+			default:
+				continue
+			}
+			dead := stmts[i+1:]
+			pos, end := Start(dead[0]), p.End(dead[len(dead)-1])
+
+			// Declarations may be referred to before them, and then
+			// cannot go
+			var fix *Fix
+			if !declaresAny(dead) {
+				if edit := p.RemoveLines(pos, end); edit != nil {
+					fix = &Fix{Message: "Remove the unreachable code", Edits: []Edit{*edit}}
+				}
+			}
+			p.Report(pos, end, "Unreachable code", fix)
+			return
+		}
+	})
+}
+
+func declaresAny(stmts []ast.ASTNode) bool {
+	found := false
+	for _, stmt := range stmts {
+		walk(stmt, func(node ast.ASTNode) {
+			switch node.(type) {
+			case ast.VariableDeclarationNode, ast.FunctionDeclarationNode:
+				found = true
+			}
+		})
+	}
+	return found
+}
+
+func constantConditions(p *Pass) {
+	walk(p.Program, func(node ast.ASTNode) {
+		var condition, body ast.ASTNode
+		switch n := node.(type) {
+		case ast.IfStatementNode:
+			condition, body = n.Condition, n.Consequent
+		case ast.WhileStatementNode:
+			// An endless loop is written `while true`
+			if b, ok := n.Condition.(ast.BooleanLiteralExprNode); ok && b.Value {
+				return
+			}
+			condition, body = n.Condition, n.Body
+		default:
+			return
+		}
+		if constant(condition) {
+			end := tokenEnd(p.tokenBefore(ast.PositionOf(body)))
+			p.Report(Start(condition), end, "Condition is always the same", nil)
+		}
+	})
+}
+
+// constant reports whether node is made of literals only.
+func constant(node ast.ASTNode) bool {
+	switch n := node.(type) {
+	case ast.NumericLiteralExprNode, ast.StringLiteralExprNode, ast.BooleanLiteralExprNode, ast.NullLiteralExprNode:
+		return true
+	case ast.ArrayLiteralExprNode, ast.ObjectLiteralExprNode:
+		// Whether they are empty is known, whatever is in them
+		return true
+	case ast.UnaryExprNode:
+		return constant(n.Operand)
+	case ast.BinaryExprNode:
+		return constant(n.Left) && constant(n.Right)
+	case ast.LogicalExprNode:
+		return constant(n.Left) && constant(n.Right)
+	}
+	return false
+}
+
+func selfAssignments(p *Pass) {
+	removable := p.removable()
+	walk(p.Program, func(node ast.ASTNode) {
+		n, ok := node.(ast.AssignmentExprNode)
+		if !ok || !sameTarget(n.Assignee, n.Value) {
+			return
+		}
+		pos := Start(n)
+		end := p.End(n)
+
+		// Reading a property may fail, and assigning a constant does
+		var fix *Fix
+		if ident, ok := n.Assignee.(ast.IdentifierExprNode); ok && !constantVariable(p.Symbols, ident) {
+			if edit := removable[pos]; edit != nil {
+				fix = &Fix{Message: "Remove the assignment", Edits: []Edit{*edit}}
+			}
+		}
+		p.Report(pos, end, "Assigns a value to itself", fix)
+	})
+}
+
+// sameTarget reports whether a and b are the same variable, or the same
+// property by the same key.
+func sameTarget(a, b ast.ASTNode) bool {
+	switch a := a.(type) {
+	case ast.IdentifierExprNode:
+		b, ok := b.(ast.IdentifierExprNode)
+		return ok && a.Symbol == b.Symbol
+	case ast.MemberExprNode:
+		b, ok := b.(ast.MemberExprNode)
+		return ok && a.Computed == b.Computed && sameTarget(a.Object, b.Object) && sameKey(a.Property, b.Property)
+	case ast.IndexExprNode:
+		b, ok := b.(ast.IndexExprNode)
+		return ok && sameTarget(a.Object, b.Object) && sameKey(a.Index, b.Index)
+	}
+	return false
+}
+
+func sameKey(a, b ast.ASTNode) bool {
+	switch a := a.(type) {
+	case ast.NumericLiteralExprNode:
+		b, ok := b.(ast.NumericLiteralExprNode)
+		return ok && a.Value == b.Value
+	case ast.StringLiteralExprNode:
+		b, ok := b.(ast.StringLiteralExprNode)
+		return ok && a.Value == b.Value
+	}
+	return sameTarget(a, b)
+}
+
+func constantVariable(symbols *resolver.Symbols, ident ast.IdentifierExprNode) bool {
+	for _, ref := range symbols.References {
+		if ref.Pos == ident.Pos && ref.Name == ident.Symbol {
+			return ref.Declaration == nil || ref.Declaration.Constant()
+		}
+	}
+	return true
+}
+
+func nullComparisons(p *Pass) {
+	walk(p.Program, func(node ast.ASTNode) {
+		n, ok := node.(ast.BinaryExprNode)
+		if !ok || !isNull(n.Left) && !isNull(n.Right) {
+			return
+		}
+		end := Span(n.Pos, string(n.Operator))
+		switch n.Operator {
+		case "is":
+			p.Report(n.Pos, end, "Use == to compare with null", &Fix{
+				Message: "Replace is with ==",
+				Edits:   []Edit{{Pos: n.Pos, End: end, NewText: "=="}},
+			})
+		case "<", ">", "<=", ">=":
+			p.Report(n.Pos, end, fmt.Sprintf("Comparing with null by %s always throws; use == or !=", n.Operator), nil)
+		}
+	})
+}
+
+func isNull(node ast.ASTNode) bool {
+	_, ok := node.(ast.NullLiteralExprNode)
+	return ok
+}
+
+func emptyBlocks(p *Pass) {
+	check := func(block ast.ASTNode, what string, fix func(open, close ast.Position) *Fix) {
+		b, ok := block.(ast.BlockStatementNode)
+		if !ok || len(b.Body) > 0 {
+			return
+		}
+		// A comment in the block tells why it is empty
+		end := p.Closing(b.Pos)
+		for _, comment := range p.Comments {
+			if before(b.Pos, tokenPos(comment)) && before(tokenPos(comment), end) {
+				return
+			}
+		}
+		var f *Fix
+		if fix != nil {
+			f = fix(b.Pos, end)
+		}
+		p.Report(b.Pos, end, fmt.Sprintf("Empty %s block", what), f)
+	}
+
+	walk(p.Program, func(node ast.ASTNode) {
+		switch n := node.(type) {
+		case ast.IfStatementNode:
+			check(n.Consequent, "if", nil)
+			// An empty else can go, from the end of the block before it
+			consequentEnd := p.Closing(ast.PositionOf(n.Consequent))
+			check(n.Alternate, "else", func(_, close ast.Position) *Fix {
+				return &Fix{Message: "Remove the else", Edits: []Edit{{Pos: consequentEnd, End: close}}}
+			})
+		case ast.WhileStatementNode:
+			check(n.Body, "while", nil)
+		case ast.ForStatementNode:
+			check(n.Body, "for", nil)
+		case ast.TryStatementNode:
+			check(n.Body, "try", nil)
+			check(n.Handler, "catch", nil)
+		}
+	})
+}
+
+func missingReturns(p *Pass) {
+	walk(p.Program, func(node ast.ASTNode) {
+		fn, ok := node.(ast.FunctionDeclarationNode)
+		if !ok {
+			return
+		}
+		values, bare := returns(fn.Body)
+		if values && (bare || !terminates(fn.Body)) {
+			p.Report(fn.NamePos, Span(fn.NamePos, fn.Name),
+				fmt.Sprintf("Function '%s' pops a value on some paths but not on others", fn.Name), nil)
+		}
+	})
+}
+
+// returns reports whether the pops of a function body, outside the
+// functions in it, pop values, and whether some pop none.
+func returns(stmts []ast.ASTNode) (values, bare bool) {
+	var visit func(node ast.ASTNode) ast.ASTNode
+	visit = func(node ast.ASTNode) ast.ASTNode {
+		switch n := node.(type) {
+		case ast.FunctionDeclarationNode:
+			return node
+		case ast.ReturnStatementNode:
+			if n.Value != nil {
+				values = true
+			} else {
+				bare = true
+			}
+		}
+		return ast.MapChildren(node, visit)
+	}
+	for _, stmt := range stmts {
+		visit(stmt)
+	}
+	return values, bare
+}
+
+// terminates reports whether stmts always end in a pop or throw, or never
+// end.
+func terminates(stmts []ast.ASTNode) bool {
+	for _, stmt := range stmts {
+		if terminal(stmt) {
+			return true
+		}
+	}
+	return false
+}
+
+func terminal(stmt ast.ASTNode) bool {
+	switch n := stmt.(type) {
+	case ast.ReturnStatementNode, ast.ThrowStatementNode:
+		return true
+	case ast.BlockStatementNode:
+		return terminates(n.Body)
+	case ast.IfStatementNode:
+		return n.Alternate != nil && terminal(n.Consequent) && terminal(n.Alternate)
+	case ast.WhileStatementNode:
+		// There is no break, so only a pop or throw leave `while true`
+		b, ok := n.Condition.(ast.BooleanLiteralExprNode)
+		return ok && b.Value
+	case ast.TryStatementNode:
+		return terminal(n.Body) && terminal(n.Handler)
+	}
+	return false
+}
@@ -0,0 +1,201 @@
+package lint
+
+import (
+	"pop/frontend/types/ast"
+	"pop/frontend/types/tokens"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Start returns the position of the first token of node. Nodes are located
+// at their operator, parenthesis or dot if they have one.
+func Start(node ast.ASTNode) ast.Position {
+	switch n := node.(type) {
+	case ast.BinaryExprNode:
+		return Start(n.Left)
+	case ast.LogicalExprNode:
+		return Start(n.Left)
+	case ast.AssignmentExprNode:
+		return Start(n.Assignee)
+	case ast.CallExprNode:
+		return Start(n.Caller)
+	case ast.MemberExprNode:
+		return Start(n.Object)
+	case ast.IndexExprNode:
+		return Start(n.Object)
+	case ast.ConditionalExprNode:
+		return Start(n.Condition)
+	}
+	return ast.PositionOf(node)
+}
+
+// End returns the position just after the statement stmt, which ends at
+// the first newline outside brackets that is not before an `else` or
+// `catch`.
+func (p *Pass) End(stmt ast.ASTNode) ast.Position {
+	toks := p.Tokens
+	i := p.tokenAt(Start(stmt))
+	depth := 0
+	last := i
+	for ; i < len(toks); i++ {
+		switch toks[i].TokenType {
+		case tokens.OpenBrace, tokens.OpenBracket, tokens.OpenParen:
+			depth++
+		case tokens.CloseBrace, tokens.CloseBracket, tokens.CloseParen:
+			if depth == 0 {
+				return tokenEnd(toks[last])
+			}
+			depth--
+		case tokens.NewLine, tokens.Semicolon, tokens.EOF:
+			if depth > 0 && toks[i].TokenType != tokens.EOF {
+				continue
+			}
+			next := i + 1
+			for next < len(toks) && toks[next].TokenType == tokens.NewLine {
+				next++
+			}
+			if next < len(toks) && (toks[next].TokenType == tokens.Else || toks[next].TokenType == tokens.Catch) {
+				i = next - 1
+				continue
+			}
+			return tokenEnd(toks[last])
+		}
+		last = i
+	}
+	return tokenEnd(toks[last])
+}
+
+// Closing returns the position just after the bracket closing the one at
+// pos.
+func (p *Pass) Closing(pos ast.Position) ast.Position {
+	depth := 0
+	for i := p.tokenAt(pos); i < len(p.Tokens); i++ {
+		switch p.Tokens[i].TokenType {
+		case tokens.OpenBrace, tokens.OpenBracket, tokens.OpenParen:
+			depth++
+		case tokens.CloseBrace, tokens.CloseBracket, tokens.CloseParen:
+			if depth--; depth == 0 {
+				return tokenEnd(p.Tokens[i])
+			}
+		}
+	}
+	return tokenEnd(p.Tokens[len(p.Tokens)-1])
+}
+
+// Span returns the end of the text at pos.
+func Span(pos ast.Position, text string) ast.Position {
+	pos.Column += utf8.RuneCountInString(text)
+	return pos
+}
+
+// RemoveLines returns the edit that removes the lines from that of pos to
+// that of end, or nil if they hold other code or comments.
+func (p *Pass) RemoveLines(pos, end ast.Position) *Edit {
+	from, to := ast.Position{Line: pos.Line, Column: 1}, ast.Position{Line: end.Line + 1, Column: 1}
+	for _, tk := range p.Tokens {
+		tkPos := tokenPos(tk)
+		if tk.TokenType == tokens.NewLine || tk.TokenType == tokens.EOF || !before(tkPos, to) || before(tkPos, from) {
+			continue
+		}
+		if before(tkPos, pos) || !before(tkPos, end) {
+			return nil
+		}
+	}
+	for _, comment := range p.Comments {
+		if comment.Line >= from.Line && comment.Line < to.Line {
+			return nil
+		}
+	}
+	return &Edit{Pos: from, End: to}
+}
+
+// tokenAt returns the index of the first token at or after pos.
+func (p *Pass) tokenAt(pos ast.Position) int {
+	return sort.Search(len(p.Tokens), func(i int) bool {
+		return !before(tokenPos(p.Tokens[i]), pos)
+	})
+}
+
+// tokenBefore returns the last token before pos.
+func (p *Pass) tokenBefore(pos ast.Position) tokens.Token {
+	return p.Tokens[max(p.tokenAt(pos)-1, 0)]
+}
+
+func tokenPos(tk tokens.Token) ast.Position {
+	return ast.Position{Line: tk.Line, Column: tk.Column}
+}
+
+func tokenEnd(tk tokens.Token) ast.Position {
+	if tk.TokenType == tokens.NewLine || tk.TokenType == tokens.EOF {
+		return tokenPos(tk)
+	}
+	return Span(tokenPos(tk), tk.Value)
+}
+
+func before(p, q ast.Position) bool {
+	return p.Line < q.Line || p.Line == q.Line && p.Column < q.Column
+}
+
+// ApplyFixes makes the fixes of diagnostics in source. A fix whose edits
+// overlap those of one made before it is left out, to be made by running
+// the linter again.
+func ApplyFixes(source string, diagnostics []Diagnostic) string {
+	var edits []Edit
+	for _, d := range diagnostics {
+		if d.Fix == nil || overlaps(edits, d.Fix.Edits) {
+			continue
+		}
+		edits = append(edits, d.Fix.Edits...)
+	}
+	sort.SliceStable(edits, func(i, j int) bool {
+		return before(edits[i].Pos, edits[j].Pos)
+	})
+
+	starts := lineStarts(source)
+	var out strings.Builder
+	done := 0
+	for _, edit := range edits {
+		from, to := offset(source, starts, edit.Pos), offset(source, starts, edit.End)
+		out.WriteString(source[done:from])
+		out.WriteString(edit.NewText)
+		done = to
+	}
+	out.WriteString(source[done:])
+	return out.String()
+}
+
+func overlaps(edits, more []Edit) bool {
+	for _, a := range edits {
+		for _, b := range more {
+			if before(a.Pos, b.End) && before(b.Pos, a.End) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lineStarts returns the byte offset of each line of source.
+func lineStarts(source string) []int {
+	starts := []int{0}
+	for i := 0; i < len(source); i++ {
+		if source[i] == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
+
+// offset returns the byte offset of pos in source, clamped to it.
+func offset(source string, starts []int, pos ast.Position) int {
+	if pos.Line > len(starts) {
+		return len(source)
+	}
+	i := starts[pos.Line-1]
+	for column := 1; column < pos.Column && i < len(source) && source[i] != '\n'; column++ {
+		_, size := utf8.DecodeRuneInString(source[i:])
+		i += size
+	}
+	return i
+}
@@ -4,23 +4,26 @@ import (
 	"context"
 	"log"
 	"os"
+	"pop/lsp/server"
 
 	"github.com/sourcegraph/jsonrpc2"
 )
 
+// stdio joins standard input and output into the connection to the client.
+type stdio struct{}
+
+func (stdio) Read(p []byte) (int, error)  { return os.Stdin.Read(p) }
+func (stdio) Write(p []byte) (int, error) { return os.Stdout.Write(p) }
+func (stdio) Close() error {
+	if err := os.Stdin.Close(); err != nil {
+		return err
+	}
+	return os.Stdout.Close()
+}
+
 func main() {
-	handler := jsonrpc2.HandlerWithError(func(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (result interface{}, err error) {
-		switch req.Method {
-		case "initialize":
-			// Respond with minimal capabilities
-			return map[string]interface{}{"capabilities": map[string]interface{}{}}, nil
-		case "shutdown":
-			return nil, nil
-			// Add more LSP methods here
-		}
-		return nil, nil
-	})
-	stream := jsonrpc2.NewBufferedStream(os.Stdin, jsonrpc2.VSCodeObjectCodec{})
+	handler := jsonrpc2.HandlerWithError(server.New().Handle)
+	stream := jsonrpc2.NewBufferedStream(stdio{}, jsonrpc2.VSCodeObjectCodec{})
 	conn := jsonrpc2.NewConn(context.Background(), stream, handler)
 	<-conn.DisconnectNotify()
 	log.Println("Popcorn LSP server exited")
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"errors"
+	BE "pop/backend"
+	FE "pop/frontend"
+	"pop/frontend/types/ast"
+	"pop/frontend/types/tokens"
+	"pop/resolver"
+	"sort"
+	"unicode/utf8"
+)
+
+// builtins are the globals every program starts with, the parent scope of
+// its own globals.
+var builtins = BE.MakeGlobalEnvironment().Parent
+
+func isBuiltin(name string) bool {
+	_, ok := builtins.LookupVar(name)
+	return ok
+}
+
+// isNative reports whether name is a builtin function, rather than a
+// namespace of the standard library.
+func isNative(name string) bool {
+	val, _ := builtins.LookupVar(name)
+	_, ok := val.(*BE.NativeFunctionVal)
+	return ok
+}
+
+// analysis is what the server knows about one version of a document. The
+// program holds the statements that parse.
+type analysis struct {
+	program      ast.Program
+	tokens       []tokens.Token
+	syntaxErrors []*FE.SyntaxError
+	symbols      *resolver.Symbols
+	// resolveErr lists the undeclared variables and those used before
+	// their declaration, nil if there are none
+	resolveErr *resolver.Error
+	// occurrences are the names of variables in the source, in order
+	occurrences []occurrence
+}
+
+// occurrence is a name in the source that declares or uses a variable.
+type occurrence struct {
+	name string
+	pos  ast.Position
+	// decl is the declaration of the variable, nil for natives and
+	// undeclared variables
+	decl *resolver.Declaration
+	// declaration is set for the name of the declaration itself
+	declaration bool
+	// write is set for declarations and assignments
+	write bool
+	// shorthand is set for a shorthand property, {name}
+	shorthand bool
+}
+
+func analyze(text string) *analysis {
+	a := &analysis{symbols: &resolver.Symbols{}}
+	a.program, a.syntaxErrors = FE.ParseAll(text)
+	a.tokens, _ = FE.LexAll(text)
+
+	_, err := resolver.Resolve(a.program, resolver.Options{Globals: isBuiltin, Symbols: a.symbols})
+	errors.As(err, &a.resolveErr)
+
+	for _, decl := range a.symbols.Declarations {
+		a.occurrences = append(a.occurrences, occurrence{name: decl.Name, pos: decl.Pos, decl: decl, declaration: true, write: true})
+	}
+	for _, ref := range a.symbols.References {
+		a.occurrences = append(a.occurrences, occurrence{name: ref.Name, pos: ref.Pos, decl: ref.Declaration, write: ref.Assignment, shorthand: ref.Shorthand})
+	}
+	sort.SliceStable(a.occurrences, func(i, j int) bool {
+		return before(a.occurrences[i].pos, a.occurrences[j].pos)
+	})
+	return a
+}
+
+// at returns the occurrence of a name that pos is on, including just after
+// its last character.
+func (a *analysis) at(pos ast.Position) (occurrence, bool) {
+	for _, o := range a.occurrences {
+		if o.pos.Line == pos.Line && o.pos.Column <= pos.Column && pos.Column <= o.pos.Column+utf8.RuneCountInString(o.name) {
+			return o, true
+		}
+	}
+	return occurrence{}, false
+}
+
+// same returns the occurrences of the variable o is one of. Natives and
+// undeclared variables, which have no declaration, go by name.
+func (a *analysis) same(o occurrence) []occurrence {
+	var found []occurrence
+	for _, other := range a.occurrences {
+		if other.decl == o.decl && (o.decl != nil || other.name == o.name) {
+			found = append(found, other)
+		}
+	}
+	return found
+}
+
+// visible returns the variables that can be used at pos, innermost first,
+// leaving out those shadowed by another of the same name. Variables are
+// visible from their declaration on, but inside a function also those of
+// the enclosing scopes declared after it, which exist by the time it is
+// called.
+func (a *analysis) visible(pos ast.Position) []*resolver.Declaration {
+	// Scopes come before those inside them, so the last that holds pos is
+	// the innermost
+	var scope *resolver.SymbolScope
+	for _, s := range a.symbols.Scopes {
+		if a.holds(s, pos) {
+			scope = s
+		}
+	}
+
+	var found []*resolver.Declaration
+	seen := map[string]bool{}
+	inFunction := false
+	for ; scope != nil; scope = scope.Parent {
+		for _, decl := range scope.Declarations {
+			if seen[decl.Name] || !inFunction && !before(decl.Pos, pos) {
+				continue
+			}
+			seen[decl.Name] = true
+			found = append(found, decl)
+		}
+		if _, ok := scope.Node.(ast.FunctionDeclarationNode); ok {
+			inFunction = true
+		}
+	}
+	return found
+}
+
+// holds reports whether pos is in the text of scope s, from the keyword or
+// brace opening it to the brace closing it.
+func (a *analysis) holds(s *resolver.SymbolScope, pos ast.Position) bool {
+	from := ast.PositionOf(s.Node)
+	var block ast.ASTNode
+	switch n := s.Node.(type) {
+	case ast.Program:
+		return true
+	case ast.IfStatementNode:
+		block = n.Consequent
+	case ast.WhileStatementNode:
+		block = n.Body
+	case ast.ForStatementNode:
+		block = n.Body
+	default:
+		// Functions and the blocks of a try
+		block = n
+	}
+	return !before(pos, from) && before(pos, blockEnd(a.tokens, ast.PositionOf(block)))
+}
+
+// lookup returns the declaration of the variable name at pos, nil for
+// natives and undeclared variables. Names in statements being typed, which
+// do not parse yet, are looked up among the visible variables.
+func (a *analysis) lookup(name string, pos ast.Position) *resolver.Declaration {
+	if o, ok := a.at(pos); ok && o.name == name {
+		return o.decl
+	}
+	for _, decl := range a.visible(pos) {
+		if decl.Name == name {
+			return decl
+		}
+	}
+	return nil
+}
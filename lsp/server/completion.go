@@ -0,0 +1,155 @@
+package server
+
+import (
+	BE "pop/backend"
+	FE "pop/frontend"
+	"pop/frontend/types/ast"
+	"pop/frontend/types/tokens"
+	"pop/resolver"
+	"sort"
+)
+
+// completion returns what can be typed at pos. After a dot it offers the
+// properties of the object before it, when they are known: those of an
+// object literal a variable is declared with, or of a namespace of the
+// standard library. Elsewhere it offers the variables visible at pos, the
+// builtins and the keywords.
+func completion(doc *Document, pos Position) CompletionList {
+	a := doc.analyze()
+	at := doc.sourcePosition(pos)
+	list := CompletionList{Items: []CompletionItem{}}
+
+	if path, ok := memberPath(a.tokens, at); ok {
+		list.Items = properties(a, path)
+		return list
+	}
+
+	seen := map[string]bool{}
+	for _, decl := range a.visible(at) {
+		seen[decl.Name] = true
+		list.Items = append(list.Items, CompletionItem{Label: decl.Name, Kind: declarationKind(decl), Detail: describe(decl)})
+	}
+	names := make([]string, 0, len(builtins.Variables))
+	for name := range builtins.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !seen[name] {
+			list.Items = append(list.Items, builtinItem(name, builtins.Variables[name]))
+		}
+	}
+	for _, keyword := range FE.Keywords() {
+		list.Items = append(list.Items, CompletionItem{Label: keyword, Kind: CompletionKeyword})
+	}
+	return list
+}
+
+// memberPath returns the names before the dot that pos follows, with the
+// name of a property being typed left out: [a b] for `a.b.` and `a.b.c`.
+// ok is false if pos does not follow a dot.
+func memberPath(toks []tokens.Token, pos ast.Position) (path []tokens.Token, ok bool) {
+	i := tokenAt(toks, pos) - 1
+	if i >= 0 && toks[i].TokenType == tokens.Identifier && !before(tokenEnd(toks[i]), pos) {
+		i--
+	}
+	if i < 0 || toks[i].TokenType != tokens.Dot {
+		return nil, false
+	}
+	for i--; i >= 0 && toks[i].TokenType == tokens.Identifier; i -= 2 {
+		path = append([]tokens.Token{toks[i]}, path...)
+		if i == 0 || toks[i-1].TokenType != tokens.Dot {
+			break
+		}
+	}
+	return path, true
+}
+
+// properties returns the properties of the object that path names, none
+// if that is not known.
+func properties(a *analysis, path []tokens.Token) []CompletionItem {
+	items := []CompletionItem{}
+	if len(path) == 0 {
+		return items
+	}
+
+	root := path[0]
+	if decl := a.lookup(root.Value, tokenPos(root)); decl != nil {
+		var value ast.ASTNode
+		if n, ok := decl.Node.(ast.VariableDeclarationNode); ok {
+			value = n.Value
+		}
+		for _, name := range path[1:] {
+			value = property(value, name.Value)
+		}
+		if object, ok := value.(ast.ObjectLiteralExprNode); ok {
+			for _, prop := range object.Properties {
+				kind := CompletionProperty
+				if _, ok := prop.Value.(ast.FunctionDeclarationNode); ok {
+					kind = CompletionFunction
+				}
+				items = append(items, CompletionItem{Label: prop.Key, Kind: kind})
+			}
+		}
+		return items
+	}
+
+	val, ok := builtins.LookupVar(root.Value)
+	for _, name := range path[1:] {
+		if !ok {
+			break
+		}
+		var object *BE.ObjectVal
+		if object, ok = val.(*BE.ObjectVal); ok {
+			val, ok = object.Properties[name.Value]
+		}
+	}
+	if object, isObject := val.(*BE.ObjectVal); ok && isObject {
+		names := make([]string, 0, len(object.Properties))
+		for name := range object.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			items = append(items, builtinItem(name, object.Properties[name]))
+		}
+	}
+	return items
+}
+
+// property returns the value of the property name of an object literal,
+// nil if value is not one or has no such property.
+func property(value ast.ASTNode, name string) ast.ASTNode {
+	object, ok := value.(ast.ObjectLiteralExprNode)
+	if !ok {
+		return nil
+	}
+	for _, prop := range object.Properties {
+		if prop.Key == name {
+			return prop.Value
+		}
+	}
+	return nil
+}
+
+func declarationKind(decl *resolver.Declaration) CompletionItemKind {
+	switch decl.Kind {
+	case resolver.Function:
+		return CompletionFunction
+	case resolver.Constant:
+		return CompletionConstant
+	case resolver.Import:
+		if decl.Node.(ast.ImportDeclarationNode).Namespace != "" {
+			return CompletionModule
+		}
+		return CompletionVariable
+	}
+	return CompletionVariable
+}
+
+func builtinItem(name string, val BE.RuntimeVal) CompletionItem {
+	if _, ok := val.(*BE.NativeFunctionVal); ok {
+		return CompletionItem{Label: name, Kind: CompletionFunction, Detail: "(builtin) fn " + name}
+	}
+	return CompletionItem{Label: name, Kind: CompletionModule, Detail: "(builtin) " + name}
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"pop/frontend/types/ast"
+	"pop/frontend/types/tokens"
+	"pop/resolver"
+	"pop/typecheck"
+	"sort"
+	"unicode/utf8"
+)
+
+// source names the server in the diagnostics it publishes.
+const source = "popcorn"
+
+// Diagnose checks text for syntax errors and, in the statements that
+// parse, for variables that are undeclared or used before their
+// declaration, assignments to constants, and code after a `pop` or `throw`
+// that never runs. Type errors are reported once the whole text parses.
+// Diagnostics are ordered by position.
+func Diagnose(text string) []Diagnostic {
+	return diagnose(newDocument("", 0, text))
+}
+
+func diagnose(doc *Document) []Diagnostic {
+	a := doc.analyze()
+
+	diagnostics := []Diagnostic{}
+	report := func(r Range, severity DiagnosticSeverity, code, message string) {
+		diagnostics = append(diagnostics, Diagnostic{Range: r, Severity: severity, Code: code, Source: source, Message: message})
+	}
+
+	for _, err := range a.syntaxErrors {
+		report(Range{Start: doc.position(err.Pos), End: doc.position(err.End)}, SeverityError, "syntax", err.Message)
+	}
+
+	undeclared := map[string]bool{}
+	if a.resolveErr != nil {
+		for _, problem := range a.resolveErr.Problems {
+			if problem.Kind == resolver.Undeclared {
+				undeclared[problem.Name] = true
+			} else {
+				report(doc.span(problem.Pos, problem.Name), SeverityError, "use-before-declaration", problem.String())
+			}
+		}
+	}
+
+	for _, ref := range a.symbols.References {
+		switch {
+		case ref.Declaration == nil && undeclared[ref.Name]:
+			// The resolver only reports the first use of each name
+			report(doc.span(ref.Pos, ref.Name), SeverityError, "undeclared", fmt.Sprintf("Undeclared variable '%s'", ref.Name))
+		case ref.Assignment && ref.Declaration != nil && ref.Declaration.Constant():
+			report(doc.span(ref.Pos, ref.Name), SeverityWarning, "const-assign",
+				fmt.Sprintf("Cannot reassign constant variable '%s', declared on line %d", ref.Name, ref.Declaration.Pos.Line))
+		}
+	}
+
+	for _, stmts := range unreachable(a.program) {
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    Range{Start: doc.position(start(stmts[0])), End: doc.position(statementEnd(a.tokens, stmts[len(stmts)-1]))},
+			Severity: SeverityWarning,
+			Code:     "unreachable",
+			Source:   source,
+			Message:  "Unreachable code",
+			Tags:     []DiagnosticTag{TagUnnecessary},
+		})
+	}
+
+	// A statement that does not parse leaves a declaration without its
+	// value, whose type would be wrong
+	if len(a.syntaxErrors) == 0 {
+		for _, problem := range typecheck.Check(a.program) {
+			// The range is the token the problem is at, or the whole of
+			// a string literal it starts
+			end := problem.Pos
+			if i := tokenAt(a.tokens, problem.Pos); i < len(a.tokens) {
+				if a.tokens[i].TokenType == tokens.Quotes {
+					for i+1 < len(a.tokens) && a.tokens[i+1].TokenType != tokens.Quotes {
+						i++
+					}
+					i = min(i+1, len(a.tokens)-1)
+				}
+				end = tokenEnd(a.tokens[i])
+			}
+			report(Range{Start: doc.position(problem.Pos), End: doc.position(end)}, SeverityError, "type", problem.Message)
+		}
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i].Range.Start, diagnostics[j].Range.Start
+		return a.Line < b.Line || a.Line == b.Line && a.Character < b.Character
+	})
+	return diagnostics
+}
+
+// unreachable returns the statements after a `pop` or `throw` in each block
+// and function body of program. Top-level code is left alone, since a
+// top-level `pop` only ends the statement it is in.
+func unreachable(program ast.Program) [][]ast.ASTNode {
+	var found [][]ast.ASTNode
+	check := func(stmts []ast.ASTNode) {
+		for i, stmt := range stmts[:max(len(stmts)-1, 0)] {
+			switch stmt.(type) {
+			case ast.ReturnStatementNode, ast.ThrowStatementNode:
+				found = append(found, stmts[i+1:])
+				return
+			}
+		}
+	}
+
+	var visit func(node ast.ASTNode) ast.ASTNode
+	visit = func(node ast.ASTNode) ast.ASTNode {
+		switch n := node.(type) {
+		case ast.BlockStatementNode:
+			check(n.Body)
+		case ast.FunctionDeclarationNode:
+			check(n.Body)
+		}
+		return ast.MapChildren(node, visit)
+	}
+	visit(program)
+	return found
+}
+
+// start returns the position of the first token of node. Nodes are located
+// at their operator, parenthesis or dot if they have one, which for the
+// position of a whole statement is not what is wanted.
+func start(node ast.ASTNode) ast.Position {
+	switch n := node.(type) {
+	case ast.BinaryExprNode:
+		return start(n.Left)
+	case ast.LogicalExprNode:
+		return start(n.Left)
+	case ast.AssignmentExprNode:
+		return start(n.Assignee)
+	case ast.CallExprNode:
+		return start(n.Caller)
+	case ast.MemberExprNode:
+		return start(n.Object)
+	case ast.IndexExprNode:
+		return start(n.Object)
+	case ast.ConditionalExprNode:
+		return start(n.Condition)
+	}
+	return ast.PositionOf(node)
+}
+
+// statementEnd returns the position just after statement stmt, found by
+// scanning toks from its start to the newline ending it. Newlines inside
+// braces, brackets or parentheses do not end a statement, nor do those
+// before an `else` or `catch`.
+func statementEnd(toks []tokens.Token, stmt ast.ASTNode) ast.Position {
+	from := start(stmt)
+	i := tokenAt(toks, from)
+
+	end := from
+	depth := 0
+	for ; i < len(toks); i++ {
+		switch toks[i].TokenType {
+		case tokens.EOF:
+			return end
+		case tokens.OpenBrace, tokens.OpenBracket, tokens.OpenParen:
+			depth++
+		case tokens.CloseBrace, tokens.CloseBracket, tokens.CloseParen:
+			if depth == 0 {
+				return end
+			}
+			depth--
+		case tokens.NewLine:
+			if depth > 0 {
+				continue
+			}
+			next := i + 1
+			for next < len(toks) && toks[next].TokenType == tokens.NewLine {
+				next++
+			}
+			if next == len(toks) || toks[next].TokenType != tokens.Else && toks[next].TokenType != tokens.Catch {
+				return end
+			}
+			continue
+		}
+		end = tokenEnd(toks[i])
+	}
+	return end
+}
+
+// tokenEnd returns the position just after tk.
+func tokenEnd(tk tokens.Token) ast.Position {
+	return ast.Position{Line: tk.Line, Column: tk.Column + utf8.RuneCountInString(tk.Value)}
+}
+
+// blockEnd returns the position just after the `}` that closes the first
+// `{` at or after from, or the end of the document if it is not closed.
+func blockEnd(toks []tokens.Token, from ast.Position) ast.Position {
+	depth := 0
+	for i := tokenAt(toks, from); i < len(toks); i++ {
+		switch toks[i].TokenType {
+		case tokens.OpenBrace:
+			depth++
+		case tokens.CloseBrace:
+			if depth--; depth == 0 {
+				return tokenEnd(toks[i])
+			}
+		}
+	}
+	return ast.Position{Line: math.MaxInt}
+}
+
+// tokenAt returns the index of the first token of toks at or after pos.
+func tokenAt(toks []tokens.Token, pos ast.Position) int {
+	return sort.Search(len(toks), func(i int) bool {
+		return !before(tokenPos(toks[i]), pos)
+	})
+}
+
+func tokenPos(tk tokens.Token) ast.Position {
+	return ast.Position{Line: tk.Line, Column: tk.Column}
+}
+
+// before reports whether p comes before q.
+func before(p, q ast.Position) bool {
+	return p.Line < q.Line || p.Line == q.Line && p.Column < q.Column
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"pop/frontend/types/ast"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Document is the text of an open file, as the client last sent it.
+type Document struct {
+	URI     string
+	Version int
+	Text    string
+	// lines holds the byte offset at which each line starts
+	lines []int
+	// analysis is computed when first needed after each change
+	analysis *analysis
+}
+
+func newDocument(uri string, version int, text string) *Document {
+	d := &Document{URI: uri, Version: version}
+	d.setText(text)
+	return d
+}
+
+func (d *Document) setText(text string) {
+	d.Text = text
+	d.analysis = nil
+	d.lines = append(d.lines[:0], 0)
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			d.lines = append(d.lines, i+1)
+		}
+	}
+}
+
+// analyze returns the analysis of the current text.
+func (d *Document) analyze() *analysis {
+	if d.analysis == nil {
+		d.analysis = analyze(d.Text)
+	}
+	return d.analysis
+}
+
+// apply makes a change the client sent.
+func (d *Document) apply(change TextDocumentContentChangeEvent) {
+	if change.Range == nil {
+		d.setText(change.Text)
+		return
+	}
+	start, end := d.offset(change.Range.Start), d.offset(change.Range.End)
+	if end < start {
+		start, end = end, start
+	}
+	d.setText(d.Text[:start] + change.Text + d.Text[end:])
+}
+
+// line returns the text of line i, zero-based, without its newline.
+func (d *Document) line(i int) string {
+	if i < 0 || i >= len(d.lines) {
+		return ""
+	}
+	end := len(d.Text)
+	if i+1 < len(d.lines) {
+		end = d.lines[i+1] - 1
+	}
+	return d.Text[d.lines[i]:end]
+}
+
+// offset returns the byte offset of p, clamped to the text.
+func (d *Document) offset(p Position) int {
+	if p.Line < 0 {
+		return 0
+	}
+	if p.Line >= len(d.lines) {
+		return len(d.Text)
+	}
+	line := d.line(p.Line)
+	units := 0
+	for i, r := range line {
+		if units >= p.Character {
+			return d.lines[p.Line] + i
+		}
+		units += utf16.RuneLen(r)
+	}
+	return d.lines[p.Line] + len(line)
+}
+
+// position converts a position of the lexer, whose columns count runes
+// from 1, into a protocol position.
+func (d *Document) position(pos ast.Position) Position {
+	if !pos.IsValid() {
+		return Position{}
+	}
+	runes := []rune(d.line(pos.Line - 1))
+	units := 0
+	for i := 0; i < pos.Column-1; i++ {
+		if i < len(runes) {
+			units += utf16.RuneLen(runes[i])
+		} else {
+			// Past the end of the line, e.g. at its newline
+			units++
+		}
+	}
+	return Position{Line: pos.Line - 1, Character: units}
+}
+
+// sourcePosition converts a protocol position into a position of the
+// lexer.
+func (d *Document) sourcePosition(p Position) ast.Position {
+	units := 0
+	column := 1
+	for _, r := range d.line(p.Line) {
+		if units >= p.Character {
+			break
+		}
+		units += utf16.RuneLen(r)
+		column++
+	}
+	return ast.Position{Line: p.Line + 1, Column: column}
+}
+
+// span is the range of the name at pos.
+func (d *Document) span(pos ast.Position, name string) Range {
+	end := pos
+	end.Column += utf8.RuneCountInString(name)
+	return Range{Start: d.position(pos), End: d.position(end)}
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"pop/frontend/types/tokens"
+	"sort"
+)
+
+// foldingRanges returns a range for each block, object and array that
+// spans lines, from the line of its opening brace or bracket to the line
+// before the closing one, which stays in sight when folded.
+func foldingRanges(doc *Document) []FoldingRange {
+	a := doc.analyze()
+	ranges := []FoldingRange{}
+
+	var open []tokens.Token
+	for _, tk := range a.tokens {
+		switch tk.TokenType {
+		case tokens.OpenBrace, tokens.OpenBracket:
+			open = append(open, tk)
+		case tokens.CloseBrace, tokens.CloseBracket:
+			if len(open) == 0 {
+				continue
+			}
+			start := open[len(open)-1]
+			open = open[:len(open)-1]
+			if tk.Line-1 > start.Line {
+				ranges = append(ranges, FoldingRange{StartLine: start.Line - 1, EndLine: tk.Line - 2})
+			}
+		}
+	}
+
+	// Closing tokens come in order, opening ones do not
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].StartLine < ranges[j].StartLine
+	})
+	return ranges
+}
@@ -0,0 +1,23 @@
+package server
+
+import (
+	"pop/format"
+	"pop/frontend/types/ast"
+	"unicode/utf8"
+)
+
+// formatting returns the edit that formats doc, replacing all of it, or
+// none if it is formatted. The options of the client are not used: there
+// is one format, as with popcorn fmt.
+func formatting(doc *Document) ([]TextEdit, error) {
+	formatted, err := format.Source(doc.Text, format.Options{})
+	if err != nil {
+		return nil, err
+	}
+	if formatted == doc.Text {
+		return []TextEdit{}, nil
+	}
+	last := len(doc.lines)
+	end := ast.Position{Line: last, Column: utf8.RuneCountInString(doc.line(last-1)) + 1}
+	return []TextEdit{{Range: Range{End: doc.position(end)}, NewText: formatted}}, nil
+}
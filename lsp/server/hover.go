@@ -0,0 +1,121 @@
+package server
+
+import (
+	"fmt"
+	"pop/frontend/types/ast"
+	"pop/resolver"
+	"strings"
+)
+
+// hover describes the variable at pos: how it is declared, as a signature
+// for functions, and the doc comment above its declaration.
+func hover(doc *Document, pos Position) *Hover {
+	a := doc.analyze()
+	o, ok := a.at(doc.sourcePosition(pos))
+	if !ok {
+		return nil
+	}
+
+	var signature, comment string
+	switch {
+	case o.decl != nil:
+		signature = describe(o.decl)
+		switch o.decl.Kind {
+		case resolver.Variable, resolver.Constant, resolver.Function:
+			comment = docComment(doc, ast.PositionOf(o.decl.Node).Line)
+		}
+	case isBuiltin(o.name):
+		signature = "(builtin) " + describeBuiltin(o.name)
+	default:
+		return nil
+	}
+
+	value := "```popcorn\n" + signature + "\n```"
+	if comment != "" {
+		value += "\n\n" + comment
+	}
+	r := doc.span(o.pos, o.name)
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: value}, Range: &r}
+}
+
+// describe returns the declaration of decl as it reads in the source, e.g.
+// `fn add(a, b)` or `const PI: number`.
+func describe(decl *resolver.Declaration) string {
+	annotation := ""
+	if n, ok := decl.Node.(ast.VariableDeclarationNode); ok && n.Type != nil {
+		annotation = ": " + n.Type.String()
+	}
+	switch decl.Kind {
+	case resolver.Constant:
+		return "const " + decl.Name + annotation
+	case resolver.Function:
+		return signatureOf(decl.Node.(ast.FunctionDeclarationNode))
+	case resolver.Parameter:
+		return "(parameter) " + decl.Name
+	case resolver.CatchParameter:
+		return "(catch) " + decl.Name
+	case resolver.Import:
+		n := decl.Node.(ast.ImportDeclarationNode)
+		if n.Default {
+			return fmt.Sprintf("import %s from %q", n.Namespace, n.Specifier)
+		}
+		if n.Namespace != "" {
+			return fmt.Sprintf("import * as %s from %q", n.Namespace, n.Specifier)
+		}
+		for _, name := range n.Names {
+			if name.Local == decl.Name && name.Name != name.Local {
+				return fmt.Sprintf("import { %s as %s } from %q", name.Name, name.Local, n.Specifier)
+			}
+		}
+		return fmt.Sprintf("import { %s } from %q", decl.Name, n.Specifier)
+	}
+	return "let " + decl.Name + annotation
+}
+
+func signatureOf(fn ast.FunctionDeclarationNode) string {
+	if fn.TestName != "" {
+		return fn.Name
+	}
+	signature := fmt.Sprintf("fn %s(%s)", fn.Name, strings.Join(paramsOf(fn), ", "))
+	if fn.ReturnType != nil {
+		signature += ": " + fn.ReturnType.String()
+	}
+	return signature
+}
+
+// paramsOf returns the parameters of fn with their type annotations, e.g.
+// `a: number`.
+func paramsOf(fn ast.FunctionDeclarationNode) []string {
+	params := make([]string, len(fn.Params))
+	for i, param := range fn.Params {
+		params[i] = param
+		if i < len(fn.ParamTypes) && fn.ParamTypes[i] != nil {
+			params[i] += ": " + fn.ParamTypes[i].String()
+		}
+	}
+	return params
+}
+
+// describeBuiltin returns `fn name` for native functions and the name
+// alone for the namespaces of the standard library.
+func describeBuiltin(name string) string {
+	if isNative(name) {
+		return "fn " + name
+	}
+	return name
+}
+
+// docComment returns the text of the `//` comments on the lines just above
+// line, 1-based, one comment line per line.
+func docComment(doc *Document, line int) string {
+	var lines []string
+	for i := line - 2; i >= 0; i-- {
+		text := strings.TrimSpace(doc.line(i))
+		if !strings.HasPrefix(text, "//") {
+			break
+		}
+		text = strings.TrimPrefix(text, "//")
+		lines = append([]string{strings.TrimPrefix(text, " ")}, lines...)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,49 @@
+package server
+
+// definition returns the location of the declaration of the variable at
+// pos, or nil for natives, undeclared variables and positions not on a
+// variable.
+func definition(doc *Document, pos Position) *Location {
+	o, ok := doc.analyze().at(doc.sourcePosition(pos))
+	if !ok || o.decl == nil {
+		return nil
+	}
+	return &Location{URI: doc.URI, Range: doc.span(o.decl.Pos, o.name)}
+}
+
+// references returns the locations of the uses of the variable at pos,
+// and of its declaration if includeDeclaration is set.
+func references(doc *Document, pos Position, includeDeclaration bool) []Location {
+	a := doc.analyze()
+	locations := []Location{}
+	o, ok := a.at(doc.sourcePosition(pos))
+	if !ok {
+		return locations
+	}
+	for _, other := range a.same(o) {
+		if other.declaration && !includeDeclaration {
+			continue
+		}
+		locations = append(locations, Location{URI: doc.URI, Range: doc.span(other.pos, other.name)})
+	}
+	return locations
+}
+
+// highlights returns the declaration and uses of the variable at pos, the
+// declaration and assignments as writes.
+func highlights(doc *Document, pos Position) []DocumentHighlight {
+	a := doc.analyze()
+	found := []DocumentHighlight{}
+	o, ok := a.at(doc.sourcePosition(pos))
+	if !ok {
+		return found
+	}
+	for _, other := range a.same(o) {
+		kind := HighlightRead
+		if other.write {
+			kind = HighlightWrite
+		}
+		found = append(found, DocumentHighlight{Range: doc.span(other.pos, other.name), Kind: kind})
+	}
+	return found
+}
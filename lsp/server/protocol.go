@@ -0,0 +1,312 @@
+package server
+
+// The subset of the Language Server Protocol the server speaks. Field names
+// follow the specification, see
+// https://microsoft.github.io/language-server-protocol/specifications/lsp/3.17/specification/
+
+// Position is a zero-based line and character offset. Characters are
+// counted in UTF-16 code units, as the protocol requires by default.
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// Location is a range in a document.
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+// Range is the text from Start up to, but not including, End.
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+type InitializeResult struct {
+	Capabilities ServerCapabilities `json:"capabilities"`
+	ServerInfo   ServerInfo         `json:"serverInfo"`
+}
+
+type ServerInfo struct {
+	Name string `json:"name"`
+}
+
+type ServerCapabilities struct {
+	TextDocumentSync           TextDocumentSyncOptions `json:"textDocumentSync"`
+	DefinitionProvider         bool                    `json:"definitionProvider"`
+	ReferencesProvider         bool                    `json:"referencesProvider"`
+	DocumentHighlightProvider  bool                    `json:"documentHighlightProvider"`
+	HoverProvider              bool                    `json:"hoverProvider"`
+	SignatureHelpProvider      SignatureHelpOptions    `json:"signatureHelpProvider"`
+	CompletionProvider         CompletionOptions       `json:"completionProvider"`
+	RenameProvider             RenameOptions           `json:"renameProvider"`
+	DocumentSymbolProvider     bool                    `json:"documentSymbolProvider"`
+	FoldingRangeProvider       bool                    `json:"foldingRangeProvider"`
+	SemanticTokensProvider     SemanticTokensOptions   `json:"semanticTokensProvider"`
+	DocumentFormattingProvider bool                    `json:"documentFormattingProvider"`
+}
+
+type RenameOptions struct {
+	// PrepareProvider is set if the server answers textDocument/prepareRename
+	PrepareProvider bool `json:"prepareProvider"`
+}
+
+type SemanticTokensOptions struct {
+	Legend SemanticTokensLegend `json:"legend"`
+	// Full is set if the server answers textDocument/semanticTokens/full
+	Full bool `json:"full"`
+}
+
+// SemanticTokensLegend names the token types and modifiers, which tokens
+// refer to by index and by bit.
+type SemanticTokensLegend struct {
+	TokenTypes     []string `json:"tokenTypes"`
+	TokenModifiers []string `json:"tokenModifiers"`
+}
+
+// SignatureHelpOptions lists the characters that ask for signature help as
+// they are typed.
+type SignatureHelpOptions struct {
+	TriggerCharacters []string `json:"triggerCharacters"`
+}
+
+// CompletionOptions lists the characters that ask for completion as they
+// are typed, besides those of names.
+type CompletionOptions struct {
+	TriggerCharacters []string `json:"triggerCharacters"`
+}
+
+// TextDocumentSyncKind says how a client sends document changes.
+type TextDocumentSyncKind int
+
+const (
+	// SyncFull sends the whole text on every change
+	SyncFull TextDocumentSyncKind = 1
+	// SyncIncremental sends the ranges that changed
+	SyncIncremental TextDocumentSyncKind = 2
+)
+
+type TextDocumentSyncOptions struct {
+	OpenClose bool                 `json:"openClose"`
+	Change    TextDocumentSyncKind `json:"change"`
+}
+
+type TextDocumentItem struct {
+	URI        string `json:"uri"`
+	LanguageID string `json:"languageId"`
+	Version    int    `json:"version"`
+	Text       string `json:"text"`
+}
+
+type TextDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type VersionedTextDocumentIdentifier struct {
+	URI     string `json:"uri"`
+	Version int    `json:"version"`
+}
+
+// TextDocumentContentChangeEvent replaces Range with Text, or the whole
+// document if Range is nil.
+type TextDocumentContentChangeEvent struct {
+	Range *Range `json:"range,omitempty"`
+	Text  string `json:"text"`
+}
+
+type DidOpenTextDocumentParams struct {
+	TextDocument TextDocumentItem `json:"textDocument"`
+}
+
+type DidChangeTextDocumentParams struct {
+	TextDocument   VersionedTextDocumentIdentifier  `json:"textDocument"`
+	ContentChanges []TextDocumentContentChangeEvent `json:"contentChanges"`
+}
+
+type DidCloseTextDocumentParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type DiagnosticSeverity int
+
+const (
+	SeverityError       DiagnosticSeverity = 1
+	SeverityWarning     DiagnosticSeverity = 2
+	SeverityInformation DiagnosticSeverity = 3
+	SeverityHint        DiagnosticSeverity = 4
+)
+
+// DiagnosticTag changes how a client shows a diagnostic.
+type DiagnosticTag int
+
+const (
+	// TagUnnecessary is shown faded out, e.g. for unreachable code
+	TagUnnecessary DiagnosticTag = 1
+)
+
+type Diagnostic struct {
+	Range    Range              `json:"range"`
+	Severity DiagnosticSeverity `json:"severity"`
+	// Code names the kind of problem, e.g. "undeclared"
+	Code    string          `json:"code,omitempty"`
+	Source  string          `json:"source"`
+	Message string          `json:"message"`
+	Tags    []DiagnosticTag `json:"tags,omitempty"`
+}
+
+type PublishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Version     *int         `json:"version,omitempty"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// TextDocumentPositionParams are the params of requests about the text at a
+// position, such as textDocument/definition.
+type TextDocumentPositionParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+}
+
+type ReferenceContext struct {
+	IncludeDeclaration bool `json:"includeDeclaration"`
+}
+
+type ReferenceParams struct {
+	TextDocumentPositionParams
+	Context ReferenceContext `json:"context"`
+}
+
+// DocumentHighlightKind tells reads of a variable from writes.
+type DocumentHighlightKind int
+
+const (
+	HighlightText  DocumentHighlightKind = 1
+	HighlightRead  DocumentHighlightKind = 2
+	HighlightWrite DocumentHighlightKind = 3
+)
+
+type DocumentHighlight struct {
+	Range Range                 `json:"range"`
+	Kind  DocumentHighlightKind `json:"kind"`
+}
+
+// MarkupContent is text to show, in Kind "plaintext" or "markdown".
+type MarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type Hover struct {
+	Contents MarkupContent `json:"contents"`
+	Range    *Range        `json:"range,omitempty"`
+}
+
+type SignatureHelp struct {
+	Signatures      []SignatureInformation `json:"signatures"`
+	ActiveSignature int                    `json:"activeSignature"`
+	ActiveParameter int                    `json:"activeParameter"`
+}
+
+type SignatureInformation struct {
+	Label         string                 `json:"label"`
+	Documentation string                 `json:"documentation,omitempty"`
+	Parameters    []ParameterInformation `json:"parameters"`
+}
+
+type ParameterInformation struct {
+	Label string `json:"label"`
+}
+
+// CompletionItemKind picks the icon a client shows for a completion.
+type CompletionItemKind int
+
+const (
+	CompletionFunction CompletionItemKind = 3
+	CompletionVariable CompletionItemKind = 6
+	CompletionModule   CompletionItemKind = 9
+	CompletionProperty CompletionItemKind = 10
+	CompletionKeyword  CompletionItemKind = 14
+	CompletionConstant CompletionItemKind = 21
+)
+
+type CompletionItem struct {
+	Label  string             `json:"label"`
+	Kind   CompletionItemKind `json:"kind"`
+	Detail string             `json:"detail,omitempty"`
+}
+
+type CompletionList struct {
+	IsIncomplete bool             `json:"isIncomplete"`
+	Items        []CompletionItem `json:"items"`
+}
+
+// DocumentParams are the params of requests about a whole document, such as
+// textDocument/documentSymbol.
+type DocumentParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type DocumentFormattingParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Options      FormattingOptions      `json:"options"`
+}
+
+// FormattingOptions are the preferences of the client for formatting.
+type FormattingOptions struct {
+	TabSize      int  `json:"tabSize"`
+	InsertSpaces bool `json:"insertSpaces"`
+}
+
+type RenameParams struct {
+	TextDocumentPositionParams
+	NewName string `json:"newName"`
+}
+
+type PrepareRenameResult struct {
+	Range       Range  `json:"range"`
+	Placeholder string `json:"placeholder"`
+}
+
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+// WorkspaceEdit holds the edits to make to each document, by URI.
+type WorkspaceEdit struct {
+	Changes map[string][]TextEdit `json:"changes"`
+}
+
+type SymbolKind int
+
+const (
+	SymbolFunction SymbolKind = 12
+	SymbolVariable SymbolKind = 13
+	SymbolConstant SymbolKind = 14
+)
+
+// DocumentSymbol is an entry of the outline of a document. Range covers
+// all of it, SelectionRange its name.
+type DocumentSymbol struct {
+	Name           string           `json:"name"`
+	Detail         string           `json:"detail,omitempty"`
+	Kind           SymbolKind       `json:"kind"`
+	Range          Range            `json:"range"`
+	SelectionRange Range            `json:"selectionRange"`
+	Children       []DocumentSymbol `json:"children"`
+}
+
+// FoldingRange is a range of whole lines, both zero-based and inclusive.
+type FoldingRange struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine"`
+}
+
+// SemanticTokens holds five numbers per token: its line, relative to the
+// previous token, its character, relative to the previous token if on the
+// same line, its length, and the index of its type and bits of its
+// modifiers in the legend.
+type SemanticTokens struct {
+	Data []uint32 `json:"data"`
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"fmt"
+	FE "pop/frontend"
+	"pop/frontend/types/tokens"
+	"pop/resolver"
+)
+
+// CodeRequestFailed is the error code of a request that is valid but
+// cannot be carried out, such as a rename that would change what a name
+// refers to.
+const CodeRequestFailed = -32803
+
+// prepareRename returns the range of the name at pos if it can be renamed.
+// Natives and undeclared variables cannot, and positions not on a name
+// answer nil.
+func prepareRename(doc *Document, pos Position) (*PrepareRenameResult, error) {
+	o, ok := doc.analyze().at(doc.sourcePosition(pos))
+	if !ok {
+		return nil, nil
+	}
+	if o.decl == nil {
+		if isBuiltin(o.name) {
+			return nil, fmt.Errorf("cannot rename builtin '%s'", o.name)
+		}
+		return nil, fmt.Errorf("cannot rename undeclared variable '%s'", o.name)
+	}
+	return &PrepareRenameResult{Range: doc.span(o.pos, o.name), Placeholder: o.name}, nil
+}
+
+// rename returns the edits that rename the variable at pos, its
+// declaration and every use, to newName. It fails if newName is not a name,
+// or if the renamed variable and another of the same name would hide one
+// another where either is used.
+func rename(doc *Document, pos Position, newName string) (*WorkspaceEdit, error) {
+	if _, err := prepareRename(doc, pos); err != nil {
+		return nil, err
+	}
+	a := doc.analyze()
+	o, ok := a.at(doc.sourcePosition(pos))
+	if !ok {
+		return nil, fmt.Errorf("no variable to rename here")
+	}
+	if !isName(newName) {
+		return nil, fmt.Errorf("'%s' is not a valid name", newName)
+	}
+	if newName == o.name {
+		return &WorkspaceEdit{Changes: map[string][]TextEdit{doc.URI: {}}}, nil
+	}
+	if err := a.checkRename(o.decl, newName); err != nil {
+		return nil, err
+	}
+
+	edits := []TextEdit{}
+	for _, other := range a.same(o) {
+		text := newName
+		if other.shorthand {
+			// The key of {name} stays as it is
+			text = other.name + ": " + newName
+		}
+		edits = append(edits, TextEdit{Range: doc.span(other.pos, other.name), NewText: text})
+	}
+	return &WorkspaceEdit{Changes: map[string][]TextEdit{doc.URI: edits}}, nil
+}
+
+// isName reports whether name lexes as a single identifier, which keywords
+// do not.
+func isName(name string) bool {
+	toks, err := FE.Lex(name)
+	return err == nil && len(toks) == 2 && toks[0].TokenType == tokens.Identifier && toks[0].Value == name
+}
+
+// checkRename fails if renaming decl to name would change what any name
+// refers to: if name is declared in the same scope, if a variable called
+// name would hide decl where it is used, or if decl would hide a variable
+// called name where that is used.
+func (a *analysis) checkRename(decl *resolver.Declaration, name string) error {
+	for _, other := range decl.Scope.Declarations {
+		if other.Name == name {
+			return fmt.Errorf("'%s' is already declared in this scope, on line %d", name, other.Pos.Line)
+		}
+	}
+
+	for _, o := range a.occurrences {
+		if o.declaration {
+			continue
+		}
+		switch {
+		case o.decl == decl:
+			// A use of decl must not see another variable called name
+			// first
+			if hidden := a.innermost(o, name, decl); hidden != nil {
+				return fmt.Errorf("'%s' would be hidden on line %d by the variable of that name declared on line %d", decl.Name, o.pos.Line, hidden.Pos.Line)
+			}
+		case o.name == name:
+			// A use of name must not see decl first
+			if a.sees(o, decl) {
+				return fmt.Errorf("renaming '%s' would hide the '%s' used on line %d", decl.Name, name, o.pos.Line)
+			}
+		}
+	}
+	return nil
+}
+
+// innermost returns the variable called name that the use o would see
+// before decl, nil if there is none.
+func (a *analysis) innermost(o occurrence, name string, decl *resolver.Declaration) *resolver.Declaration {
+	for _, visible := range a.visible(o.pos) {
+		switch {
+		case visible == decl:
+			return nil
+		case visible.Name == name:
+			return visible
+		}
+	}
+	return nil
+}
+
+// sees reports whether decl is visible at the use o, in a scope inside
+// that of the variable o uses.
+func (a *analysis) sees(o occurrence, decl *resolver.Declaration) bool {
+	for _, visible := range a.visible(o.pos) {
+		switch visible {
+		case decl:
+			return true
+		case o.decl:
+			return false
+		}
+	}
+	return false
+}
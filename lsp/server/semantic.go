@@ -0,0 +1,137 @@
+package server
+
+import (
+	"pop/frontend/types/ast"
+	"pop/frontend/types/tokens"
+	"pop/resolver"
+	"unicode/utf8"
+)
+
+// The semantic token types and modifiers the server uses, in the order of
+// the legend it sends in its capabilities.
+const (
+	semanticKeyword = iota
+	semanticVariable
+	semanticParameter
+	semanticFunction
+	semanticProperty
+	semanticString
+	semanticNumber
+	semanticOperator
+	semanticNamespace
+)
+
+const (
+	modifierDeclaration = 1 << iota
+	modifierReadonly
+	modifierDefaultLibrary
+)
+
+var semanticLegend = SemanticTokensLegend{
+	TokenTypes:     []string{"keyword", "variable", "parameter", "function", "property", "string", "number", "operator", "namespace"},
+	TokenModifiers: []string{"declaration", "readonly", "defaultLibrary"},
+}
+
+// semanticTokens classifies the tokens of doc as the lexer splits them,
+// telling names apart by what they refer to: constants from variables,
+// functions and parameters, builtins, and properties.
+func semanticTokens(doc *Document) SemanticTokens {
+	a := doc.analyze()
+	occurrences := map[ast.Position]occurrence{}
+	for _, o := range a.occurrences {
+		occurrences[o.pos] = o
+	}
+
+	data := []uint32{}
+	var last Position
+	emit := func(from, to ast.Position, kind, modifiers int) {
+		start, end := doc.position(from), doc.position(to)
+		if end.Line != start.Line || end.Character <= start.Character {
+			return
+		}
+		delta := start.Character
+		if start.Line == last.Line {
+			delta -= last.Character
+		}
+		data = append(data, uint32(start.Line-last.Line), uint32(delta), uint32(end.Character-start.Character), uint32(kind), uint32(modifiers))
+		last = start
+	}
+
+	toks := a.tokens
+	for i := 0; i < len(toks); i++ {
+		tk := toks[i]
+		pos := tokenPos(tk)
+		switch tk.TokenType {
+		case tokens.Quotes:
+			// A string is its quotes and the content between them
+			j := i + 1
+			if j < len(toks) && toks[j].TokenType != tokens.Quotes {
+				j++
+			}
+			if j >= len(toks) {
+				continue
+			}
+			end := tokenPos(toks[j])
+			end.Column = min(end.Column+1, utf8.RuneCountInString(doc.line(end.Line-1))+1)
+			emit(pos, end, semanticString, 0)
+			i = j
+		case tokens.Number:
+			emit(pos, tokenEnd(tk), semanticNumber, 0)
+		case tokens.Identifier:
+			// test is only a keyword before the name of a test block
+			if tk.Value == "test" && i+1 < len(toks) && toks[i+1].TokenType == tokens.Quotes {
+				emit(pos, tokenEnd(tk), semanticKeyword, 0)
+				continue
+			}
+			kind, modifiers := classify(toks, i, occurrences)
+			emit(pos, tokenEnd(tk), kind, modifiers)
+		case tokens.Let, tokens.Const, tokens.Fn, tokens.Pop, tokens.If, tokens.Else, tokens.While, tokens.For,
+			tokens.Try, tokens.Catch, tokens.Throw, tokens.Is, tokens.True, tokens.False, tokens.Null, tokens.Import, tokens.Export:
+			emit(pos, tokenEnd(tk), semanticKeyword, 0)
+		case tokens.Equals, tokens.BinaryOperator, tokens.UnaryOperator, tokens.Equal, tokens.NotEqual,
+			tokens.Less, tokens.Greater, tokens.LessEqual, tokens.GreaterEqual, tokens.And, tokens.Or, tokens.Not:
+			emit(pos, tokenEnd(tk), semanticOperator, 0)
+		}
+	}
+	return SemanticTokens{Data: data}
+}
+
+// classify returns the semantic token type and modifiers of the name
+// toks[i].
+func classify(toks []tokens.Token, i int, occurrences map[ast.Position]occurrence) (kind, modifiers int) {
+	tk := toks[i]
+	if o, ok := occurrences[tokenPos(tk)]; ok && o.name == tk.Value {
+		if o.declaration {
+			modifiers |= modifierDeclaration
+		}
+		switch {
+		case o.decl != nil:
+			switch o.decl.Kind {
+			case resolver.Function:
+				return semanticFunction, modifiers
+			case resolver.Parameter, resolver.CatchParameter:
+				return semanticParameter, modifiers
+			case resolver.Constant:
+				return semanticVariable, modifiers | modifierReadonly
+			case resolver.Import:
+				if o.decl.Node.(ast.ImportDeclarationNode).Namespace != "" {
+					return semanticNamespace, modifiers | modifierReadonly
+				}
+				return semanticVariable, modifiers | modifierReadonly
+			}
+			return semanticVariable, modifiers
+		case isBuiltin(o.name):
+			if isNative(o.name) {
+				return semanticFunction, modifiers | modifierDefaultLibrary
+			}
+			return semanticNamespace, modifiers | modifierDefaultLibrary
+		}
+		return semanticVariable, modifiers
+	}
+
+	// The names after a dot and the keys of object literals are properties
+	if i > 0 && toks[i-1].TokenType == tokens.Dot || i+1 < len(toks) && toks[i+1].TokenType == tokens.Colon {
+		return semanticProperty, 0
+	}
+	return semanticVariable, 0
+}
@@ -0,0 +1,241 @@
+// Package server is the Popcorn language server. It keeps the documents a
+// client has open in memory, in sync with the client's edits, and
+// publishes diagnostics for each document whenever it changes: syntax
+// errors, which the parser recovers from to find them all, and problems it
+// can tell without running the code, see Diagnose.
+//
+// The resolver tells which declaration each name refers to, with the
+// scoping rules of the interpreter, which the server uses to go to the
+// definition of a variable and to find and highlight its uses, and the
+// scopes it records to tell which variables can be used where, for
+// completion, and to rename a variable without changing what any name
+// refers to. Hovering a variable shows its declaration and doc comment.
+// Semantic tokens classify the tokens of the lexer, names by what they
+// refer to. Formatting a document formats it as popcorn fmt does.
+//
+// The server speaks JSON-RPC through github.com/sourcegraph/jsonrpc2; the
+// lsp command connects it to standard input and output.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// Server answers the requests of one client.
+type Server struct {
+	mu sync.Mutex
+	// documents are the open documents by URI
+	documents map[string]*Document
+}
+
+func New() *Server {
+	return &Server{documents: map[string]*Document{}}
+}
+
+// Handle answers a request or notification from the client, to be passed
+// to jsonrpc2.HandlerWithError. Requests for methods the server does not
+// know fail with CodeMethodNotFound; unknown notifications are ignored.
+func (s *Server) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error) {
+	switch req.Method {
+	case "initialize":
+		return InitializeResult{
+			Capabilities: ServerCapabilities{
+				TextDocumentSync:           TextDocumentSyncOptions{OpenClose: true, Change: SyncIncremental},
+				DefinitionProvider:         true,
+				ReferencesProvider:         true,
+				DocumentHighlightProvider:  true,
+				HoverProvider:              true,
+				SignatureHelpProvider:      SignatureHelpOptions{TriggerCharacters: []string{"(", ","}},
+				CompletionProvider:         CompletionOptions{TriggerCharacters: []string{"."}},
+				RenameProvider:             RenameOptions{PrepareProvider: true},
+				DocumentSymbolProvider:     true,
+				FoldingRangeProvider:       true,
+				SemanticTokensProvider:     SemanticTokensOptions{Legend: semanticLegend, Full: true},
+				DocumentFormattingProvider: true,
+			},
+			ServerInfo: ServerInfo{Name: "popcorn"},
+		}, nil
+	case "shutdown":
+		return nil, nil
+	case "exit":
+		return nil, conn.Close()
+
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := decode(req, &params); err != nil {
+			return nil, err
+		}
+		item := params.TextDocument
+		doc := newDocument(item.URI, item.Version, item.Text)
+		s.mu.Lock()
+		s.documents[item.URI] = doc
+		s.mu.Unlock()
+		return nil, s.publish(ctx, conn, doc)
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := decode(req, &params); err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		doc, ok := s.documents[params.TextDocument.URI]
+		if ok {
+			for _, change := range params.ContentChanges {
+				doc.apply(change)
+			}
+			doc.Version = params.TextDocument.Version
+		}
+		s.mu.Unlock()
+		if !ok {
+			return nil, fmt.Errorf("change to a document that is not open: %s", params.TextDocument.URI)
+		}
+		return nil, s.publish(ctx, conn, doc)
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := decode(req, &params); err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		delete(s.documents, params.TextDocument.URI)
+		s.mu.Unlock()
+		// Clear the diagnostics of the closed document
+		return nil, conn.Notify(ctx, "textDocument/publishDiagnostics", PublishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []Diagnostic{},
+		})
+
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		return s.withDocument(req, &params, &params.TextDocument, func(doc *Document) (any, error) {
+			// A nil *Location would not marshal to null
+			if loc := definition(doc, params.Position); loc != nil {
+				return loc, nil
+			}
+			return nil, nil
+		})
+	case "textDocument/references":
+		var params ReferenceParams
+		return s.withDocument(req, &params, &params.TextDocument, func(doc *Document) (any, error) {
+			return references(doc, params.Position, params.Context.IncludeDeclaration), nil
+		})
+	case "textDocument/documentHighlight":
+		var params TextDocumentPositionParams
+		return s.withDocument(req, &params, &params.TextDocument, func(doc *Document) (any, error) {
+			return highlights(doc, params.Position), nil
+		})
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		return s.withDocument(req, &params, &params.TextDocument, func(doc *Document) (any, error) {
+			if h := hover(doc, params.Position); h != nil {
+				return h, nil
+			}
+			return nil, nil
+		})
+	case "textDocument/signatureHelp":
+		var params TextDocumentPositionParams
+		return s.withDocument(req, &params, &params.TextDocument, func(doc *Document) (any, error) {
+			if help := signatureHelp(doc, params.Position); help != nil {
+				return help, nil
+			}
+			return nil, nil
+		})
+	case "textDocument/completion":
+		var params TextDocumentPositionParams
+		return s.withDocument(req, &params, &params.TextDocument, func(doc *Document) (any, error) {
+			return completion(doc, params.Position), nil
+		})
+	case "textDocument/prepareRename":
+		var params TextDocumentPositionParams
+		return s.withDocument(req, &params, &params.TextDocument, func(doc *Document) (any, error) {
+			result, err := prepareRename(doc, params.Position)
+			if err != nil {
+				return nil, &jsonrpc2.Error{Code: CodeRequestFailed, Message: err.Error()}
+			}
+			if result == nil {
+				return nil, nil
+			}
+			return result, nil
+		})
+	case "textDocument/rename":
+		var params RenameParams
+		return s.withDocument(req, &params, &params.TextDocument, func(doc *Document) (any, error) {
+			edit, err := rename(doc, params.Position, params.NewName)
+			if err != nil {
+				return nil, &jsonrpc2.Error{Code: CodeRequestFailed, Message: err.Error()}
+			}
+			return edit, nil
+		})
+	case "textDocument/documentSymbol":
+		var params DocumentParams
+		return s.withDocument(req, &params, &params.TextDocument, func(doc *Document) (any, error) {
+			return documentSymbols(doc), nil
+		})
+	case "textDocument/foldingRange":
+		var params DocumentParams
+		return s.withDocument(req, &params, &params.TextDocument, func(doc *Document) (any, error) {
+			return foldingRanges(doc), nil
+		})
+	case "textDocument/semanticTokens/full":
+		var params DocumentParams
+		return s.withDocument(req, &params, &params.TextDocument, func(doc *Document) (any, error) {
+			return semanticTokens(doc), nil
+		})
+	case "textDocument/formatting":
+		var params DocumentFormattingParams
+		return s.withDocument(req, &params, &params.TextDocument, func(doc *Document) (any, error) {
+			edits, err := formatting(doc)
+			if err != nil {
+				return nil, &jsonrpc2.Error{Code: CodeRequestFailed, Message: err.Error()}
+			}
+			return edits, nil
+		})
+	}
+
+	if req.Notif {
+		return nil, nil
+	}
+	return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeMethodNotFound, Message: fmt.Sprintf("method not supported: %s", req.Method)}
+}
+
+// publish sends the diagnostics of doc to the client.
+func (s *Server) publish(ctx context.Context, conn *jsonrpc2.Conn, doc *Document) error {
+	s.mu.Lock()
+	version, diagnostics := doc.Version, diagnose(doc)
+	s.mu.Unlock()
+
+	return conn.Notify(ctx, "textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         doc.URI,
+		Version:     &version,
+		Diagnostics: diagnostics,
+	})
+}
+
+// withDocument decodes the params of req into params, which name the
+// document id, and answers with what f returns for that document.
+func (s *Server) withDocument(req *jsonrpc2.Request, params any, id *TextDocumentIdentifier, f func(doc *Document) (any, error)) (any, error) {
+	if err := decode(req, params); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc, ok := s.documents[id.URI]
+	if !ok {
+		return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: fmt.Sprintf("document is not open: %s", id.URI)}
+	}
+	return f(doc)
+}
+
+// decode reads the params of req into v.
+func decode(req *jsonrpc2.Request, v any) error {
+	if req.Params == nil {
+		return &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: "missing params"}
+	}
+	if err := json.Unmarshal(*req.Params, v); err != nil {
+		return &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"pop/frontend/types/ast"
+	"pop/frontend/types/tokens"
+	"pop/resolver"
+)
+
+// signatureHelp returns the signature of the function whose call arguments
+// pos is in, with the argument pos is on as the active parameter. It is nil
+// outside a call, and for calls of anything but a declared function.
+func signatureHelp(doc *Document, pos Position) *SignatureHelp {
+	a := doc.analyze()
+	at := doc.sourcePosition(pos)
+
+	// Go back from pos to the parenthesis the call opens, counting the
+	// commas between its arguments
+	commas := 0
+	depth := 0
+	i := tokenAt(a.tokens, at) - 1
+	for ; i >= 0; i-- {
+		switch a.tokens[i].TokenType {
+		case tokens.CloseParen, tokens.CloseBracket, tokens.CloseBrace:
+			depth++
+			continue
+		case tokens.OpenBracket, tokens.OpenBrace:
+			if depth == 0 {
+				return nil
+			}
+			depth--
+			continue
+		case tokens.OpenParen:
+			if depth > 0 {
+				depth--
+				continue
+			}
+		case tokens.Comma:
+			if depth == 0 {
+				commas++
+			}
+			continue
+		default:
+			continue
+		}
+		break
+	}
+	// A call has its callee just before the parenthesis, where a function
+	// declaration has its name after `fn`. Methods are not declared.
+	if i < 1 || a.tokens[i-1].TokenType != tokens.Identifier {
+		return nil
+	}
+	if i >= 2 && (a.tokens[i-2].TokenType == tokens.Fn || a.tokens[i-2].TokenType == tokens.Dot) {
+		return nil
+	}
+
+	callee := a.tokens[i-1]
+	decl := a.lookup(callee.Value, tokenPos(callee))
+	if decl == nil || decl.Kind != resolver.Function {
+		return nil
+	}
+	fn := decl.Node.(ast.FunctionDeclarationNode)
+
+	params := make([]ParameterInformation, len(fn.Params))
+	for j, param := range paramsOf(fn) {
+		params[j] = ParameterInformation{Label: param}
+	}
+	return &SignatureHelp{
+		Signatures:      []SignatureInformation{{Label: signatureOf(fn), Documentation: docComment(doc, fn.Pos.Line), Parameters: params}},
+		ActiveSignature: 0,
+		ActiveParameter: commas,
+	}
+}
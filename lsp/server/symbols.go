@@ -0,0 +1,62 @@
+package server
+
+import (
+	"pop/frontend/types/ast"
+	"strings"
+)
+
+// documentSymbols returns the outline of doc: its top-level variables and
+// functions, with the functions declared inside each function as its
+// children.
+func documentSymbols(doc *Document) []DocumentSymbol {
+	a := doc.analyze()
+	symbols := []DocumentSymbol{}
+	for _, stmt := range a.program.Body {
+		switch n := stmt.(type) {
+		case ast.VariableDeclarationNode:
+			kind := SymbolVariable
+			if n.Constant {
+				kind = SymbolConstant
+			}
+			symbols = append(symbols, DocumentSymbol{
+				Name:           n.Identifier,
+				Kind:           kind,
+				Range:          Range{Start: doc.position(n.Pos), End: doc.position(statementEnd(a.tokens, n))},
+				SelectionRange: doc.span(n.NamePos, n.Identifier),
+				Children:       []DocumentSymbol{},
+			})
+		case ast.FunctionDeclarationNode:
+			symbols = append(symbols, functionSymbol(doc, a, n))
+		}
+	}
+	return symbols
+}
+
+func functionSymbol(doc *Document, a *analysis, fn ast.FunctionDeclarationNode) DocumentSymbol {
+	symbol := DocumentSymbol{
+		Name:           fn.Name,
+		Detail:         "(" + strings.Join(paramsOf(fn), ", ") + ")",
+		Kind:           SymbolFunction,
+		Range:          Range{Start: doc.position(fn.Pos), End: doc.position(statementEnd(a.tokens, fn))},
+		SelectionRange: doc.span(fn.NamePos, fn.Name),
+		Children:       []DocumentSymbol{},
+	}
+	if fn.TestName != "" {
+		symbol.Detail = ""
+	}
+
+	// Functions inside blocks and loops count, but not those of a nested
+	// function, which are its own children
+	var visit func(node ast.ASTNode) ast.ASTNode
+	visit = func(node ast.ASTNode) ast.ASTNode {
+		if n, ok := node.(ast.FunctionDeclarationNode); ok {
+			symbol.Children = append(symbol.Children, functionSymbol(doc, a, n))
+			return node
+		}
+		return ast.MapChildren(node, visit)
+	}
+	for _, stmt := range fn.Body {
+		visit(stmt)
+	}
+	return symbol
+}
@@ -1,22 +1,132 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	BE "pop/backend"
+	"pop/compiler"
+	"pop/optimizer"
+	"pop/packages"
+	"pop/vm"
+	"strings"
 )
 
+// commands are the subcommands, run as `popcorn <command> [args]`.
+var commands = map[string]func(opts BE.Options, args []string) int{
+	"bench":   benchmark,
+	"build":   build,
+	"check":   checkFiles,
+	"disasm":  disasm,
+	"fmt":     formatFiles,
+	"install": install,
+	"lint":    lintFiles,
+	"test":    runTests,
+}
+
 func main() {
+	opts := BE.DefaultOptions()
+
+	flag.BoolVar(&opts.StrictBooleans, "strict-booleans", false, "require booleans in conditions and logical operators")
+	flag.BoolVar(&opts.CheckTypes, "check-types", false, "raise a TypeError when a value does not match its type annotation")
+	flag.StringVar(&opts.DumpAST, "dump-ast", "", "write the parsed AST as JSON to this path")
+	flag.IntVar(&opts.Limits.MaxSteps, "max-steps", 0, "abort after evaluating this many AST nodes (0 = no limit)")
+	flag.IntVar(&opts.Limits.MaxCallDepth, "max-call-depth", 0, fmt.Sprintf("raise a stack overflow when functions recurse deeper than this (0 = %d, at most %d, or %d with the vm)", BE.DefaultMaxCallDepth, BE.MaxTreeWalkerCallDepth, vm.MaxCallDepth))
+	flag.IntVar(&opts.Limits.MaxArrayLength, "max-array-length", 0, "largest array, map or set a script may build (0 = no limit)")
+	flag.IntVar(&opts.Limits.MaxStringLength, "max-string-length", 0, "longest string in bytes a script may build (0 = no limit)")
+	flag.IntVar(&opts.Limits.MaxMemory, "max-memory", 0, "abort after allocating roughly this many bytes (0 = no limit)")
+	engine := flag.String("engine", "tree", "run programs with the bytecode `vm` or the tree walker (tree)")
+	flag.Func("O", "optimization `level` 0-2, or a list of passes: inline,fold,branches,unreachable (default 0)", func(level string) error {
+		passes, err := optimizer.Parse(level)
+		if err != nil {
+			return err
+		}
+		opts.Optimizer = passes
+		return nil
+	})
+	noCache := flag.Bool("no-cache", false, "do not cache the bytecode the vm engine compiles")
+	timeout := flag.Duration("timeout", 0, "abort a file run after this long, e.g. 5s (0 = no limit)")
+
+	// Scripts are sandboxed: each capability has to be granted explicitly
+	flag.Var(&opts.Permissions.Read, "allow-read", "allow reading files, or only those under `paths` (comma separated)")
+	flag.Var(&opts.Permissions.Write, "allow-write", "allow writing files, or only those under `paths` (comma separated)")
+	flag.Var(&opts.Permissions.Env, "allow-env", "allow reading environment variables, or only the listed `names`")
+	flag.Var(&opts.Permissions.Run, "allow-run", "allow starting subprocesses, or only the listed `programs`")
+	flag.Var(&opts.Permissions.Net, "allow-net", "allow network requests, or only to the listed `hosts`")
+	flag.BoolVar(&opts.Permissions.Clock, "allow-clock", false, "allow reading the clock")
+	flag.BoolVar(&opts.Permissions.Random, "allow-random", false, "allow random numbers")
+	allowAll := flag.Bool("allow-all", false, "grant every permission")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: popcorn [flags] [file.pop | file.popc | dir]\n       popcorn [flags] <command> [args]\n\nWith no file, popcorn starts the REPL.\n\nCommands:\n  bench     time scripts and compare them with a baseline\n  build     compile a file to bytecode (.popc)\n  check     report type errors in source files\n  disasm    print the bytecode compiled from a file\n  fmt       format source files\n  install   install the dependencies of a package\n  lint      report likely mistakes in source files\n  test      run the tests in *_test.pop files\n\nFlags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *allowAll {
+		opts.Permissions = BE.AllowAll()
+	}
+
+	switch *engine {
+	case "vm":
+		vmEngine := vm.Engine{}
+		// Cache files, not every line typed into the REPL
+		if dir := compiler.DefaultCacheDir(); dir != "" && !*noCache && flag.NArg() > 0 {
+			vmEngine.Cache = &compiler.Cache{Dir: dir}
+		}
+		opts.Engine = vmEngine
+	case "tree":
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown engine %q, want vm or tree\n", *engine)
+		os.Exit(2)
+	}
+
+	if command, ok := commands[flag.Arg(0)]; ok {
+		os.Exit(command(opts, flag.Args()[1:]))
+	}
+
+	it := BE.NewInterpreter(opts)
+
 	// If a file argument is provided, run the file
-	if len(os.Args) > 1 {
-		filePath := os.Args[1]
-		err := BE.RunFile(filePath)
+	if flag.NArg() > 0 {
+		ctx := context.Background()
+		if *timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, *timeout)
+			defer cancel()
+		}
+
+		filePath := flag.Arg(0)
+		// A package runs its entry
+		if info, err := os.Stat(filePath); err == nil && info.IsDir() {
+			manifest, err := packages.ReadManifest(filePath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error running package: %v\n", err)
+				os.Exit(1)
+			}
+			filePath = manifest.EntryPath(filePath)
+		}
+		var result BE.RuntimeVal
+		var err error
+		if strings.HasSuffix(filePath, ".popc") {
+			// Compiled files always run on the VM
+			result, err = runBytecode(ctx, it, filePath)
+		} else {
+			result, err = it.RunFileContext(ctx, filePath)
+		}
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error running file: %v\n", err)
+			var runtimeErr *BE.RuntimeError
+			if errors.As(err, &runtimeErr) {
+				fmt.Fprintln(os.Stderr, runtimeErr.Traceback())
+			} else {
+				fmt.Fprintf(os.Stderr, "Error running file: %v\n", err)
+			}
 			os.Exit(1)
 		}
+		fmt.Fprintln(opts.Stdout, BE.Inspect(result, BE.DefaultInspectOptions))
 	} else {
 		// Otherwise, start the REPL
-		BE.Repl()
+		it.Repl()
 	}
 }
@@ -0,0 +1,70 @@
+package optimizer
+
+import (
+	BE "pop/backend"
+	"pop/frontend/types/ast"
+)
+
+// fold evaluates the operators in node whose operands are literals.
+// Operators that would raise an error, such as `1 + "a"`, are left for
+// the program to raise when it runs.
+func fold(node ast.ASTNode) ast.ASTNode {
+	node = ast.MapChildren(node, fold)
+
+	switch n := node.(type) {
+	case ast.BinaryExprNode:
+		left, leftOk := value(n.Left)
+		right, rightOk := value(n.Right)
+		if !leftOk || !rightOk {
+			break
+		}
+		if result, ok := evaluate(func() BE.RuntimeVal { return BE.BinaryOp(n.Operator, left, right) }); ok {
+			if lit, ok := literal(result, n.Pos); ok {
+				return lit
+			}
+		}
+	case ast.UnaryExprNode:
+		// Only operands both modes of StrictBooleans agree on
+		operand, _ := value(n.Operand)
+		switch v := operand.(type) {
+		case BE.NumberVal:
+			if n.Operator == ast.Negation {
+				return ast.NumericLiteralExprNode{Value: -v.Value, Pos: n.Pos}
+			}
+		case BE.BoolValue:
+			if n.Operator == ast.Not {
+				return ast.BooleanLiteralExprNode{Value: !v.Value, Pos: n.Pos}
+			}
+		}
+	case ast.LogicalExprNode:
+		left, ok := boolean(n.Left)
+		if !ok {
+			break
+		}
+		if n.Operator == ast.And && !left || n.Operator == ast.Or && left {
+			return n.Left
+		}
+		// The right operand is only checked once it is evaluated, so it has
+		// to be a boolean already
+		if _, ok := boolean(n.Right); ok {
+			return n.Right
+		}
+	}
+	return node
+}
+
+// boolean returns the value of a boolean literal.
+func boolean(node ast.ASTNode) (bool, bool) {
+	lit, ok := node.(ast.BooleanLiteralExprNode)
+	return lit.Value, ok
+}
+
+// evaluate runs op, reporting false if it raised an error.
+func evaluate(op func() BE.RuntimeVal) (result BE.RuntimeVal, ok bool) {
+	defer func() {
+		if recover() != nil {
+			result, ok = nil, false
+		}
+	}()
+	return op(), true
+}
@@ -0,0 +1,103 @@
+package optimizer
+
+import "pop/frontend/types/ast"
+
+// inlineConsts replaces reads of constants bound to literals, or to
+// operators that fold to one, with the literals.
+//
+// Variables are looked up when code runs, so a read is only replaced if it
+// comes after the declaration in the same statement list, where the
+// declaration has always run, and if nothing else in the program declares
+// the name, so the read cannot see another binding.
+func inlineConsts(program ast.Program) ast.Program {
+	in := inliner{declared: map[string]int{}}
+	in.count(program)
+	return in.node(program, nil).(ast.Program)
+}
+
+type inliner struct {
+	// declared counts the declarations of each name, parameters included
+	declared map[string]int
+}
+
+func (in *inliner) count(node ast.ASTNode) {
+	switch n := node.(type) {
+	case ast.VariableDeclarationNode:
+		in.declared[n.Identifier]++
+	case ast.FunctionDeclarationNode:
+		in.declared[n.Name]++
+		for _, param := range n.Params {
+			in.declared[param]++
+		}
+	case ast.TryStatementNode:
+		if n.Param != "" {
+			in.declared[n.Param]++
+		}
+	case ast.ImportDeclarationNode:
+		if n.Namespace != "" {
+			in.declared[n.Namespace]++
+		}
+		for _, name := range n.Names {
+			in.declared[name.Local]++
+		}
+	}
+	ast.MapChildren(node, func(child ast.ASTNode) ast.ASTNode {
+		in.count(child)
+		return child
+	})
+}
+
+// node inlines the constants in consts into node.
+func (in *inliner) node(node ast.ASTNode, consts map[string]ast.ASTNode) ast.ASTNode {
+	switch n := node.(type) {
+	case ast.IdentifierExprNode:
+		if lit, ok := consts[n.Symbol]; ok {
+			val, _ := value(lit)
+			lit, _ = literal(val, n.Pos)
+			return lit
+		}
+		return n
+	case ast.AssignmentExprNode:
+		// Assigning to the constant has to keep failing the same way
+		if _, ok := n.Assignee.(ast.IdentifierExprNode); !ok {
+			n.Assignee = in.node(n.Assignee, consts)
+		}
+		n.Value = in.node(n.Value, consts)
+		return n
+	case ast.Program:
+		n.Body = in.statements(n.Body, consts)
+		return n
+	case ast.BlockStatementNode:
+		n.Body = in.statements(n.Body, consts)
+		return n
+	case ast.FunctionDeclarationNode:
+		n.Body = in.statements(n.Body, consts)
+		return n
+	}
+	return ast.MapChildren(node, func(child ast.ASTNode) ast.ASTNode {
+		return in.node(child, consts)
+	})
+}
+
+// statements inlines consts into stmts, and each constant stmts declare
+// into the statements after it.
+func (in *inliner) statements(stmts []ast.ASTNode, consts map[string]ast.ASTNode) []ast.ASTNode {
+	out := make([]ast.ASTNode, len(stmts))
+	for i, stmt := range stmts {
+		out[i] = in.node(stmt, consts)
+
+		decl, ok := out[i].(ast.VariableDeclarationNode)
+		if !ok || !decl.Constant || in.declared[decl.Identifier] != 1 {
+			continue
+		}
+		if lit := fold(decl.Value); isLiteral(lit) {
+			inner := make(map[string]ast.ASTNode, len(consts)+1)
+			for name, lit := range consts {
+				inner[name] = lit
+			}
+			inner[decl.Identifier] = lit
+			consts = inner
+		}
+	}
+	return out
+}
@@ -0,0 +1,43 @@
+package optimizer
+
+import (
+	BE "pop/backend"
+	"pop/frontend/types/ast"
+)
+
+// value returns the value of a literal node. Array and object literals
+// are not values here, since every evaluation makes a new one.
+func value(node ast.ASTNode) (BE.RuntimeVal, bool) {
+	switch n := node.(type) {
+	case ast.NumericLiteralExprNode:
+		return BE.NumberVal{Value: n.Value}, true
+	case ast.StringLiteralExprNode:
+		return BE.StringVal{Value: n.Value}, true
+	case ast.BooleanLiteralExprNode:
+		return BE.BoolValue{Value: n.Value}, true
+	case ast.NullLiteralExprNode:
+		return BE.Null, true
+	}
+	return nil, false
+}
+
+// isLiteral reports whether node is a literal value.
+func isLiteral(node ast.ASTNode) bool {
+	_, ok := value(node)
+	return ok
+}
+
+// literal returns the node that evaluates to val, placed at pos.
+func literal(val BE.RuntimeVal, pos ast.Position) (ast.ASTNode, bool) {
+	switch v := val.(type) {
+	case BE.NumberVal:
+		return ast.NumericLiteralExprNode{Value: v.Value, Pos: pos}, true
+	case BE.StringVal:
+		return ast.StringLiteralExprNode{Value: v.Value, Pos: pos}, true
+	case BE.BoolValue:
+		return ast.BooleanLiteralExprNode{Value: v.Value, Pos: pos}, true
+	case BE.NullValue:
+		return ast.NullLiteralExprNode{Pos: pos}, true
+	}
+	return nil, false
+}
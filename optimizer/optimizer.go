@@ -0,0 +1,114 @@
+// Package optimizer rewrites parsed programs into equivalent ones that do
+// less work, for either engine. Set an Options as backend.Options.Optimizer:
+//
+//	opts := backend.DefaultOptions()
+//	opts.Optimizer = optimizer.Level(2)
+//
+// Every pass keeps what a program prints, returns and raises, including
+// under Options.StrictBooleans, so no pass folds anything whose result
+// depends on it. Only the number of steps a program takes changes.
+package optimizer
+
+import (
+	"fmt"
+	"pop/frontend/types/ast"
+	"strconv"
+	"strings"
+)
+
+// MaxLevel is the highest optimization level, which runs every pass.
+const MaxLevel = 2
+
+// Options selects the passes Optimize runs. They run in the order of the
+// fields, so that each pass sees what the ones before it simplified.
+type Options struct {
+	// InlineConsts replaces reads of a `const` bound to a literal with the
+	// literal, where the read can only see that binding
+	InlineConsts bool
+	// Fold evaluates operators whose operands are literals, such as
+	// `60 * 60` or `!false`
+	Fold bool
+	// DeadBranches drops the branch an `if` with a constant condition never
+	// takes, and `while false` loops
+	DeadBranches bool
+	// Unreachable drops the statements after a `pop` or `throw` in a block
+	// or function body
+	Unreachable bool
+}
+
+// passes names the passes for Parse and String, in the order they run.
+var passes = []struct {
+	name    string
+	enabled func(o *Options) *bool
+	run     func(program ast.Program) ast.Program
+}{
+	{"inline", func(o *Options) *bool { return &o.InlineConsts }, inlineConsts},
+	{"fold", func(o *Options) *bool { return &o.Fold }, func(p ast.Program) ast.Program { return fold(p).(ast.Program) }},
+	{"branches", func(o *Options) *bool { return &o.DeadBranches }, func(p ast.Program) ast.Program { return prune(p).(ast.Program) }},
+	{"unreachable", func(o *Options) *bool { return &o.Unreachable }, func(p ast.Program) ast.Program { return unreachable(p).(ast.Program) }},
+}
+
+// Level returns the passes of an optimization level: 0 runs none, 1 folds
+// constants and drops unreachable code, and 2 also inlines constants and
+// drops dead branches.
+func Level(n int) Options {
+	return Options{
+		Fold:         n >= 1,
+		Unreachable:  n >= 1,
+		InlineConsts: n >= 2,
+		DeadBranches: n >= 2,
+	}
+}
+
+// Parse reads the value of the CLI's -O flag: a level, or a comma
+// separated list of passes such as "fold,unreachable". The passes are
+// inline, fold, branches and unreachable.
+func Parse(s string) (Options, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 0 || n > MaxLevel {
+			return Options{}, fmt.Errorf("optimization level %d is not between 0 and %d", n, MaxLevel)
+		}
+		return Level(n), nil
+	}
+
+	var opts Options
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, pass := range passes {
+			if pass.name == name {
+				*pass.enabled(&opts) = true
+				found = true
+			}
+		}
+		if !found {
+			return Options{}, fmt.Errorf("unknown optimization %q, want a level or some of inline, fold, branches, unreachable", name)
+		}
+	}
+	return opts, nil
+}
+
+// String lists the enabled passes, e.g. "fold,unreachable", or "none".
+func (o Options) String() string {
+	var names []string
+	for _, pass := range passes {
+		if *pass.enabled(&o) {
+			names = append(names, pass.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+// Optimize runs the enabled passes over program. The program passed in is
+// not modified.
+func (o Options) Optimize(program ast.Program) ast.Program {
+	for _, pass := range passes {
+		if *pass.enabled(&o) {
+			program = pass.run(program)
+		}
+	}
+	return program
+}
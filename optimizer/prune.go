@@ -0,0 +1,107 @@
+package optimizer
+
+import "pop/frontend/types/ast"
+
+// prune drops the branches in node that constant conditions rule out.
+func prune(node ast.ASTNode) ast.ASTNode {
+	node = ast.MapChildren(node, prune)
+
+	switch n := node.(type) {
+	case ast.IfStatementNode:
+		condition, ok := boolean(n.Condition)
+		if !ok {
+			break
+		}
+		if !condition {
+			switch alternate := n.Alternate.(type) {
+			case nil:
+				return ast.NullLiteralExprNode{Pos: n.Pos}
+			case ast.BlockStatementNode:
+				// An `else` block has a scope of its own, which a bare
+				// block does not, so one that declares something becomes
+				// the consequent of an if that always runs it
+				if declares(alternate.Body) {
+					return ast.IfStatementNode{Condition: ast.BooleanLiteralExprNode{Value: true, Pos: n.Pos}, Consequent: alternate, Pos: n.Pos}
+				}
+			}
+			return n.Alternate
+		}
+
+		// The consequent has a scope of its own too
+		n.Alternate, n.AlternateScope = nil, nil
+		if block, ok := n.Consequent.(ast.BlockStatementNode); ok && !declares(block.Body) {
+			return block
+		}
+		return n
+	case ast.WhileStatementNode:
+		if condition, ok := boolean(n.Condition); ok && !condition {
+			return ast.NullLiteralExprNode{Pos: n.Pos}
+		}
+	case ast.Program:
+		n.Body = dropLiterals(n.Body)
+		return n
+	case ast.BlockStatementNode:
+		n.Body = dropLiterals(n.Body)
+		return n
+	case ast.FunctionDeclarationNode:
+		n.Body = dropLiterals(n.Body)
+		return n
+	}
+	return node
+}
+
+// dropLiterals removes the literals that pruned statements left behind,
+// except the last statement, whose value a program or function may return.
+func dropLiterals(stmts []ast.ASTNode) []ast.ASTNode {
+	out := stmts[:0:0]
+	for i, stmt := range stmts {
+		if i == len(stmts)-1 || !isLiteral(stmt) {
+			out = append(out, stmt)
+		}
+	}
+	return out
+}
+
+// declares reports whether stmts declare anything into the scope they run
+// in, including from blocks, which have no scope of their own.
+func declares(stmts []ast.ASTNode) bool {
+	for _, stmt := range stmts {
+		switch n := stmt.(type) {
+		case ast.VariableDeclarationNode, ast.FunctionDeclarationNode:
+			return true
+		case ast.BlockStatementNode:
+			if declares(n.Body) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unreachable drops the statements after a `pop` or `throw` in the blocks
+// and function bodies in node. Top-level code is left alone, since a
+// top-level `pop` only ends the statement it is in.
+func unreachable(node ast.ASTNode) ast.ASTNode {
+	node = ast.MapChildren(node, unreachable)
+
+	switch n := node.(type) {
+	case ast.BlockStatementNode:
+		n.Body = reachable(n.Body)
+		return n
+	case ast.FunctionDeclarationNode:
+		n.Body = reachable(n.Body)
+		return n
+	}
+	return node
+}
+
+// reachable returns stmts up to the first one that always leaves them.
+func reachable(stmts []ast.ASTNode) []ast.ASTNode {
+	for i, stmt := range stmts {
+		switch stmt.(type) {
+		case ast.ReturnStatementNode, ast.ThrowStatementNode:
+			return stmts[:i+1]
+		}
+	}
+	return stmts
+}
@@ -0,0 +1,69 @@
+package packages
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// IsBare reports whether the import specifier names a package, like
+// "mathx" or "mathx/stats.pop", rather than a path relative to the module
+// importing it or to the root.
+func IsBare(specifier string) bool {
+	switch {
+	case specifier == "", specifier == ".", specifier == "..":
+		return false
+	case strings.HasPrefix(specifier, "./"), strings.HasPrefix(specifier, "../"), strings.HasPrefix(specifier, "/"):
+		return false
+	}
+	return true
+}
+
+// Find finds the module the bare specifier names for a module in dir, a
+// slash-separated path in fsys: the first element of the specifier is a
+// package installed in the pop_modules of dir, or of the nearest
+// directory above it that has it, and the rest a module in the package. Without
+// the rest it is the package's entry.
+//
+// Find reports false if no package of that name is installed.
+func Find(fsys fs.FS, dir, specifier string) (string, bool, error) {
+	name, module, _ := strings.Cut(specifier, "/")
+	if module != "" && !fs.ValidPath(module) {
+		return "", false, fmt.Errorf("invalid module path %q", specifier)
+	}
+	for d := path.Clean(dir); ; d = path.Dir(d) {
+		root := path.Join(d, ModulesDir, name)
+		if info, err := fs.Stat(fsys, root); err == nil && info.IsDir() {
+			if module != "" {
+				return path.Join(root, module), true, nil
+			}
+			entry, err := findEntry(fsys, root)
+			return entry, err == nil, err
+		}
+		if d == "." || d == "/" {
+			return "", false, nil
+		}
+	}
+}
+
+// findEntry returns the path of the entry of the package in dir.
+func findEntry(fsys fs.FS, dir string) (string, error) {
+	data, err := fs.ReadFile(fsys, path.Join(dir, ManifestFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return path.Join(dir, DefaultEntry), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return "", err
+	}
+	if m.Entry == "" {
+		return path.Join(dir, DefaultEntry), nil
+	}
+	return path.Join(dir, m.Entry), nil
+}
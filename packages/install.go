@@ -0,0 +1,265 @@
+package packages
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Options configures Install.
+type Options struct {
+	// Registry is the directory of package tarballs that dependencies on
+	// versions are installed from. Without one only `file:` dependencies
+	// can be installed.
+	Registry string
+	// Frozen fails the install if it would change the lockfile, as it
+	// does when a dependency was added or its contents changed
+	Frozen bool
+	// Log, if set, gets a line for every package installed
+	Log io.Writer
+}
+
+// ErrLockOutdated is returned by a frozen install that would change the
+// lockfile.
+var ErrLockOutdated = errors.New(LockFile + " is out of date")
+
+// Install installs the dependencies of the package in dir, and theirs,
+// into its pop_modules directory, and records them in its lockfile.
+//
+// Every package is installed once, at the top of pop_modules, so two
+// packages cannot depend on different versions of a third. Versions are
+// the newest the registry has within the range asked for, unless the
+// lockfile has one in the range already. A package from the registry
+// whose contents no longer match the hash the lockfile has for its
+// version is an error; local packages are taken as they are now.
+//
+// The packages are installed next to pop_modules first, which replaces
+// it once all of them are, so a failed install leaves it as it was.
+func Install(dir string, opts Options) (*Lockfile, error) {
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	old, err := ReadLock(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	staging, err := os.MkdirTemp(dir, "."+ModulesDir+"-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	in := &installer{
+		root:      dir,
+		staging:   staging,
+		opts:      opts,
+		old:       old,
+		lock:      &Lockfile{LockfileVersion: lockfileVersion, Packages: map[string]*LockedPackage{}},
+		installed: map[string]installed{},
+	}
+	queue := in.dependencies(manifest, dir, "")
+	for len(queue) > 0 {
+		dep := queue[0]
+		queue = queue[1:]
+		more, err := in.install(dep)
+		if err != nil {
+			return nil, err
+		}
+		queue = append(queue, more...)
+	}
+
+	if opts.Frozen && !reflect.DeepEqual(in.lock, old) {
+		return nil, fmt.Errorf("%w, run popcorn install without -frozen", ErrLockOutdated)
+	}
+
+	modules := filepath.Join(dir, ModulesDir)
+	if err := os.RemoveAll(modules); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(staging, modules); err != nil {
+		return nil, err
+	}
+	if err := WriteLock(dir, in.lock); err != nil {
+		return nil, err
+	}
+	return in.lock, nil
+}
+
+type installer struct {
+	// root is the directory of the project, and staging the directory the
+	// packages are installed into
+	root, staging string
+	opts          Options
+	// old is the lockfile before the install, and lock the one it writes
+	old, lock *Lockfile
+	installed map[string]installed
+}
+
+// dependency is a package a package depends on.
+type dependency struct {
+	name   string
+	source Source
+	// dir is the directory of the package depending on it, which the
+	// path of a local source is relative to
+	dir string
+	// by names the package depending on it, empty for the project
+	by string
+}
+
+// installed is where a package was installed from.
+type installed struct {
+	version Version
+	// path is the absolute path of a local package
+	path string
+}
+
+// dependencies lists the dependencies of manifest, of the package in dir
+// named by, sorted by name.
+func (in *installer) dependencies(manifest *Manifest, dir, by string) []dependency {
+	var deps []dependency
+	for _, name := range slices.Sorted(maps.Keys(manifest.Dependencies)) {
+		// Manifests are validated when they are read
+		source, _ := ParseSource(manifest.Dependencies[name])
+		deps = append(deps, dependency{name: name, source: source, dir: dir, by: by})
+	}
+	return deps
+}
+
+// install installs dep unless it is installed already, and returns its
+// dependencies.
+func (in *installer) install(dep dependency) ([]dependency, error) {
+	if have, ok := in.installed[dep.name]; ok {
+		return nil, in.compatible(dep, have)
+	}
+
+	target := filepath.Join(in.staging, dep.name)
+	locked := &LockedPackage{}
+	// from is the directory the local dependencies of the package are
+	// relative to
+	var from string
+	var have installed
+	if dep.source.Local() {
+		path := filepath.Join(dep.dir, filepath.FromSlash(dep.source.Path))
+		if _, isTarball := tarballName(path); isTarball {
+			if err := extract(path, target); err != nil {
+				return nil, err
+			}
+			from = filepath.Dir(path)
+		} else {
+			if info, err := os.Stat(path); err != nil || !info.IsDir() {
+				return nil, fmt.Errorf("%s: %s is not a directory or .tar.gz file", in.describe(dep), dep.source.Path)
+			}
+			if err := copyDir(path, target); err != nil {
+				return nil, err
+			}
+			from = path
+		}
+		rel, err := filepath.Rel(in.root, path)
+		if err != nil {
+			rel = path
+		}
+		locked.Resolved = "file:" + filepath.ToSlash(rel)
+		have.path = path
+	} else {
+		var tarball string
+		var err error
+		if have.version, tarball, err = in.pick(dep); err != nil {
+			return nil, err
+		}
+		if err := extract(tarball, target); err != nil {
+			return nil, err
+		}
+		locked.Resolved = "registry:" + filepath.Base(tarball)
+		from = filepath.Dir(tarball)
+	}
+
+	manifest, err := ReadManifest(target)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", in.describe(dep), err)
+	}
+	if manifest.Name != dep.name {
+		return nil, fmt.Errorf("%s: the package is named %s", in.describe(dep), manifest.Name)
+	}
+	version, _ := ParseVersion(manifest.Version)
+	if !dep.source.Local() && version != have.version {
+		return nil, fmt.Errorf("%s: the manifest of %s says version %s", in.describe(dep), locked.Resolved, version)
+	}
+	have.version = version
+	in.installed[dep.name] = have
+	locked.Version = manifest.Version
+	locked.Dependencies = manifest.Dependencies
+
+	if locked.Integrity, err = Hash(target); err != nil {
+		return nil, err
+	}
+	if previous := in.old.Packages[dep.name]; !dep.source.Local() && previous != nil &&
+		previous.Resolved == locked.Resolved && previous.Integrity != locked.Integrity {
+		return nil, fmt.Errorf("%s: the contents of %s do not match %s (%s, got %s)",
+			in.describe(dep), locked.Resolved, LockFile, previous.Integrity, locked.Integrity)
+	}
+	in.lock.Packages[dep.name] = locked
+
+	if in.opts.Log != nil {
+		fmt.Fprintf(in.opts.Log, "+ %s@%s (%s)\n", dep.name, locked.Version, locked.Resolved)
+	}
+	return in.dependencies(manifest, from, dep.name), nil
+}
+
+// pick returns the version of dep to install and its tarball in the
+// registry: the version in the lockfile if dep allows it, or else the
+// newest it allows.
+func (in *installer) pick(dep dependency) (Version, string, error) {
+	if in.opts.Registry == "" {
+		return Version{}, "", fmt.Errorf("%s: no registry to install version %s from", in.describe(dep), dep.source.Range)
+	}
+	registry := Registry{Dir: in.opts.Registry}
+	if previous := in.old.Packages[dep.name]; previous != nil && strings.HasPrefix(previous.Resolved, "registry:") {
+		if v, err := ParseVersion(previous.Version); err == nil && dep.source.Range.Allows(v) {
+			_, tarballs, err := registry.Versions(dep.name)
+			if err != nil {
+				return Version{}, "", err
+			}
+			if tarball, ok := tarballs[v]; ok {
+				return v, tarball, nil
+			}
+		}
+	}
+	v, tarball, err := registry.Latest(dep.name, dep.source.Range)
+	if err != nil {
+		return Version{}, "", fmt.Errorf("%s: %w", in.describe(dep), err)
+	}
+	return v, tarball, nil
+}
+
+// compatible reports an error if dep cannot use the package installed
+// for another package as have.
+func (in *installer) compatible(dep dependency, have installed) error {
+	if dep.source.Local() {
+		path := filepath.Join(dep.dir, filepath.FromSlash(dep.source.Path))
+		if have.path != path {
+			return fmt.Errorf("%s: %s is installed from another source already", in.describe(dep), dep.name)
+		}
+		return nil
+	}
+	if have.path != "" || !dep.source.Range.Allows(have.version) {
+		return fmt.Errorf("%s: %s %s is installed already, but %s is wanted",
+			in.describe(dep), dep.name, have.version, dep.source.Range)
+	}
+	return nil
+}
+
+// describe names dep and what depends on it, for errors.
+func (in *installer) describe(dep dependency) string {
+	if dep.by == "" {
+		return dep.name
+	}
+	return fmt.Sprintf("%s (needed by %s)", dep.name, dep.by)
+}
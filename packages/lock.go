@@ -0,0 +1,118 @@
+package packages
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Lockfile records the packages an install put into pop_modules, so the
+// next install picks the same versions and notices when their contents
+// change. It is read from and written to popcorn.lock.
+type Lockfile struct {
+	LockfileVersion int `json:"lockfileVersion"`
+	// Packages are the installed packages by name, dependencies of
+	// dependencies included
+	Packages map[string]*LockedPackage `json:"packages"`
+}
+
+// LockedPackage is an installed package.
+type LockedPackage struct {
+	Version string `json:"version"`
+	// Resolved is where it was installed from: `file:` and its path,
+	// relative to the project, or `registry:` and the tarball's name
+	Resolved string `json:"resolved"`
+	// Integrity is the Hash of its files
+	Integrity string `json:"integrity"`
+	// Dependencies are those of its manifest
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+}
+
+// lockfileVersion is the version of the lockfile format written.
+const lockfileVersion = 1
+
+// ReadLock reads the lockfile in dir. A missing lockfile is an empty one.
+func ReadLock(dir string) (*Lockfile, error) {
+	lock := &Lockfile{LockfileVersion: lockfileVersion, Packages: map[string]*LockedPackage{}}
+	data, err := os.ReadFile(filepath.Join(dir, LockFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return lock, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", LockFile, err)
+	}
+	if lock.LockfileVersion != lockfileVersion {
+		return nil, fmt.Errorf("unsupported %s version %d", LockFile, lock.LockfileVersion)
+	}
+	if lock.Packages == nil {
+		lock.Packages = map[string]*LockedPackage{}
+	}
+	return lock, nil
+}
+
+// WriteLock writes lock to dir as indented JSON, with the packages sorted
+// by name.
+func WriteLock(dir string, lock *Lockfile) error {
+	return writeJSON(filepath.Join(dir, LockFile), lock)
+}
+
+// Hash returns the content hash of the package in dir: the SHA-256 of the
+// paths and contents of its files, in the order of their paths, written
+// `sha256-` and hex digits. Hidden files and pop_modules are left out.
+func Hash(dir string) (string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && skipped(entry) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.Type().IsRegular() {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+
+	h := sha256.New()
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(file)))
+		if err != nil {
+			return "", err
+		}
+		// Lengths keep the boundaries between paths and contents apart
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(len(file))))
+		h.Write([]byte(file))
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(len(data))))
+		h.Write(data)
+	}
+	return "sha256-" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// skipped reports whether a file or directory of a package is left out
+// of what is installed and hashed.
+func skipped(entry fs.DirEntry) bool {
+	return strings.HasPrefix(entry.Name(), ".") || entry.IsDir() && entry.Name() == ModulesDir
+}
@@ -0,0 +1,125 @@
+// Package packages manages the dependencies of Popcorn projects: the
+// popcorn.json manifest, the popcorn.lock lockfile, installing packages
+// into pop_modules, and finding the module a bare specifier such as
+// "mathx" names.
+package packages
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+const (
+	// ManifestFile is the name of the manifest in the root of a package
+	ManifestFile = "popcorn.json"
+	// LockFile is the name of the lockfile next to the manifest
+	LockFile = "popcorn.lock"
+	// ModulesDir is the directory packages are installed into
+	ModulesDir = "pop_modules"
+	// DefaultEntry is the module a package without an entry exports
+	DefaultEntry = "main.pop"
+)
+
+// Manifest describes a package, as read from its popcorn.json:
+//
+//	{
+//	  "name": "app",
+//	  "version": "1.0.0",
+//	  "entry": "main.pop",
+//	  "dependencies": {
+//	    "mathx": "^1.2.0",
+//	    "strs": "file:../strs"
+//	  }
+//	}
+type Manifest struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Entry is the module importing the package by name runs, relative to
+	// the package, DefaultEntry if empty
+	Entry string `json:"entry,omitempty"`
+	// Dependencies map package names to where they come from: a version
+	// range for the registry, or a local directory or tarball as
+	// `file:path`, relative to the package
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+}
+
+// ErrNoManifest is returned by ReadManifest for a directory without one.
+var ErrNoManifest = errors.New("no " + ManifestFile + " found")
+
+// names are those packages may have: lowercase letters, digits, dots,
+// dashes and underscores, not starting with a dot or an underscore.
+var names = regexp.MustCompile(`^[a-z0-9-][a-z0-9._-]*$`)
+
+// ReadManifest reads and checks the manifest of the package in dir.
+func ReadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w in %s", ErrNoManifest, dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParseManifest(data)
+}
+
+// ParseManifest parses and checks a manifest.
+func ParseManifest(data []byte) (*Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ManifestFile, err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ManifestFile, err)
+	}
+	return &m, nil
+}
+
+// Validate reports the first problem with m: a missing or invalid name or
+// version, an entry outside the package, or a dependency on an invalid
+// name or with an invalid source.
+func (m *Manifest) Validate() error {
+	if !names.MatchString(m.Name) {
+		return fmt.Errorf("invalid package name %q", m.Name)
+	}
+	if _, err := ParseVersion(m.Version); err != nil {
+		return err
+	}
+	if m.Entry != "" && !filepath.IsLocal(m.Entry) {
+		return fmt.Errorf("entry %q is not a path inside the package", m.Entry)
+	}
+	for name, source := range m.Dependencies {
+		if !names.MatchString(name) {
+			return fmt.Errorf("invalid dependency name %q", name)
+		}
+		if _, err := ParseSource(source); err != nil {
+			return fmt.Errorf("dependency %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// EntryPath returns the path of the entry of the package in dir.
+func (m *Manifest) EntryPath(dir string) string {
+	entry := m.Entry
+	if entry == "" {
+		entry = DefaultEntry
+	}
+	return filepath.Join(dir, filepath.FromSlash(entry))
+}
+
+// WriteManifest writes m to dir as indented JSON.
+func WriteManifest(dir string, m *Manifest) error {
+	return writeJSON(filepath.Join(dir, ManifestFile), m)
+}
+
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
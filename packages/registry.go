@@ -0,0 +1,201 @@
+package packages
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Registry is a directory of package tarballs, named after the package and
+// its version like mathx-1.2.0.tar.gz or mathx-1.2.0.tgz. It stands in for
+// a package server: sharing one means sharing the directory.
+type Registry struct {
+	Dir string
+}
+
+// Versions lists the versions of the package name in the registry, oldest
+// first, and the tarball of each.
+func (r Registry) Versions(name string) ([]Version, map[Version]string, error) {
+	entries, err := os.ReadDir(r.Dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading registry: %w", err)
+	}
+	var versions []Version
+	tarballs := map[Version]string{}
+	for _, entry := range entries {
+		base, ok := tarballName(entry.Name())
+		if !ok || entry.IsDir() {
+			continue
+		}
+		// Names may contain dashes, so the version is after the last one
+		i := strings.LastIndex(base, "-")
+		if i < 0 || base[:i] != name {
+			continue
+		}
+		v, err := ParseVersion(base[i+1:])
+		if err != nil {
+			continue
+		}
+		if _, seen := tarballs[v]; !seen {
+			versions = append(versions, v)
+		}
+		tarballs[v] = filepath.Join(r.Dir, entry.Name())
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Compare(versions[j]) < 0 })
+	return versions, tarballs, nil
+}
+
+// Latest returns the newest version of the package name that within
+// allows, and its tarball.
+func (r Registry) Latest(name string, within Range) (Version, string, error) {
+	versions, tarballs, err := r.Versions(name)
+	if err != nil {
+		return Version{}, "", err
+	}
+	for i := len(versions) - 1; i >= 0; i-- {
+		if within.Allows(versions[i]) {
+			return versions[i], tarballs[versions[i]], nil
+		}
+	}
+	if len(versions) == 0 {
+		return Version{}, "", fmt.Errorf("package %s is not in the registry %s", name, r.Dir)
+	}
+	return Version{}, "", fmt.Errorf("no version of %s in the registry matches %s", name, within)
+}
+
+// tarballName returns name without its .tar.gz or .tgz extension, and
+// whether it had one.
+func tarballName(name string) (string, bool) {
+	for _, ext := range []string{".tar.gz", ".tgz"} {
+		if base, ok := strings.CutSuffix(name, ext); ok {
+			return base, true
+		}
+	}
+	return "", false
+}
+
+// extract unpacks the gzipped tarball at file into the directory dir. If
+// every entry is inside one top-level directory, like package/ in npm
+// tarballs, its contents are unpacked instead. Only regular files and
+// directories are unpacked, and none outside dir.
+func extract(file, dir string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	defer gz.Close()
+
+	type entry struct {
+		name string
+		dir  bool
+		data []byte
+	}
+	var entries []entry
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		name := strings.TrimSuffix(path.Clean(strings.TrimPrefix(header.Name, "./")), "/")
+		if name == "." {
+			continue
+		}
+		if !fs.ValidPath(name) {
+			return fmt.Errorf("%s: entry %q is outside the package", file, header.Name)
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			entries = append(entries, entry{name: name, dir: true})
+		case tar.TypeReg:
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return fmt.Errorf("%s: %w", file, err)
+			}
+			entries = append(entries, entry{name: name, data: data})
+		default:
+			return fmt.Errorf("%s: entry %q is not a file or directory", file, header.Name)
+		}
+	}
+
+	// Strip the top-level directory everything is in, if there is one
+	prefix := ""
+	for i, e := range entries {
+		top, _, _ := strings.Cut(e.name, "/")
+		if i == 0 {
+			prefix = top
+		}
+		if top != prefix || !e.dir && e.name == top {
+			prefix = ""
+			break
+		}
+	}
+
+	for _, e := range entries {
+		name := e.name
+		if prefix != "" {
+			if name = strings.TrimPrefix(strings.TrimPrefix(name, prefix), "/"); name == "" {
+				continue
+			}
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if e.dir {
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, e.data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyDir copies the package in src into dst, leaving out what Hash does.
+// Links to files are copied as the files they link to.
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if file != src && skipped(entry) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, 0o644)
+	})
+}
@@ -0,0 +1,124 @@
+package packages
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a version number, written major.minor.patch.
+type Version struct {
+	Major, Minor, Patch int
+}
+
+// ParseVersion parses a version written major.minor.patch.
+func ParseVersion(s string) (Version, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return Version{}, fmt.Errorf("invalid version %q, want major.minor.patch", s)
+	}
+	var numbers [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || part != strconv.Itoa(n) {
+			return Version{}, fmt.Errorf("invalid version %q, want major.minor.patch", s)
+		}
+		numbers[i] = n
+	}
+	return Version{numbers[0], numbers[1], numbers[2]}, nil
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Compare returns -1, 0 or 1 as v is older than, the same as or newer
+// than w.
+func (v Version) Compare(w Version) int {
+	for _, d := range [3]int{v.Major - w.Major, v.Minor - w.Minor, v.Patch - w.Patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+	return 0
+}
+
+// Range is the versions a dependency accepts:
+//
+//	1.2.3   exactly 1.2.3
+//	^1.2.3  1.2.3 or newer with the same major version
+//	~1.2.3  1.2.3 or newer with the same major and minor versions
+//	*       any version
+type Range struct {
+	// Op is "", "^", "~" or "*"
+	Op   string
+	Base Version
+}
+
+// ParseRange parses a version range.
+func ParseRange(s string) (Range, error) {
+	if s == "*" {
+		return Range{Op: "*"}, nil
+	}
+	op := ""
+	if strings.HasPrefix(s, "^") || strings.HasPrefix(s, "~") {
+		op, s = s[:1], s[1:]
+	}
+	base, err := ParseVersion(s)
+	if err != nil {
+		return Range{}, err
+	}
+	return Range{Op: op, Base: base}, nil
+}
+
+// Allows reports whether v is in r.
+func (r Range) Allows(v Version) bool {
+	switch r.Op {
+	case "*":
+		return true
+	case "^":
+		return v.Major == r.Base.Major && v.Compare(r.Base) >= 0
+	case "~":
+		return v.Major == r.Base.Major && v.Minor == r.Base.Minor && v.Compare(r.Base) >= 0
+	}
+	return v == r.Base
+}
+
+func (r Range) String() string {
+	if r.Op == "*" {
+		return "*"
+	}
+	return r.Op + r.Base.String()
+}
+
+// Source is where a dependency comes from: a local directory or tarball,
+// or the versions of the registry in Range.
+type Source struct {
+	// Path is the directory or .tar.gz file of a `file:` source, relative
+	// to the package depending on it
+	Path  string
+	Range Range
+}
+
+// ParseSource parses the source of a dependency in a manifest.
+func ParseSource(s string) (Source, error) {
+	if path, ok := strings.CutPrefix(s, "file:"); ok {
+		if path == "" {
+			return Source{}, fmt.Errorf("empty path in %q", s)
+		}
+		return Source{Path: path}, nil
+	}
+	r, err := ParseRange(s)
+	if err != nil {
+		return Source{}, fmt.Errorf("%w, or file:path", err)
+	}
+	return Source{Range: r}, nil
+}
+
+// Local reports whether s is a local directory or tarball.
+func (s Source) Local() bool {
+	return s.Path != ""
+}
@@ -0,0 +1,697 @@
+package popcorn
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	BE "pop/backend"
+	"reflect"
+	"unicode"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// * ======== GO -> POPCORN ======== * \\
+
+// ToValue converts a Go value to a runtime value, see the package
+// documentation for the rules.
+func (r *Runtime) ToValue(v any) (BE.RuntimeVal, error) {
+	return r.toValue("anonymous", v)
+}
+
+// toValue converts v, using name for the native function if v is a func.
+func (r *Runtime) toValue(name string, v any) (BE.RuntimeVal, error) {
+	c := converter{runtime: r, seen: map[pointer]BE.RuntimeVal{}}
+	return c.convert(name, reflect.ValueOf(v))
+}
+
+// converter remembers which pointers it has converted so that cyclic Go
+// structures become cyclic Popcorn objects instead of recursing forever.
+type converter struct {
+	runtime *Runtime
+	seen    map[pointer]BE.RuntimeVal
+}
+
+// pointer identifies what a Go pointer points to. The type tells a struct
+// apart from its first field, which is at the same address.
+type pointer struct {
+	addr uintptr
+	typ  reflect.Type
+}
+
+func (c *converter) convert(name string, rv reflect.Value) (BE.RuntimeVal, error) {
+	if !rv.IsValid() {
+		return BE.Null, nil
+	}
+	if rv.CanInterface() && isRuntimeVal(rv.Interface()) {
+		return rv.Interface(), nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Interface:
+		if rv.IsNil() {
+			return BE.Null, nil
+		}
+		return c.convert(name, rv.Elem())
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return BE.Null, nil
+		}
+		key := pointer{addr: rv.Pointer(), typ: rv.Type()}
+		if val, ok := c.seen[key]; ok {
+			return val, nil
+		}
+		if rv.Elem().Kind() == reflect.Struct {
+			obj := &BE.ObjectVal{Properties: map[string]BE.RuntimeVal{}}
+			c.seen[key] = obj
+			return obj, c.fillStruct(obj, rv.Elem())
+		}
+		return c.convert(name, rv.Elem())
+	case reflect.Bool:
+		return BE.BoolValue{Value: rv.Bool()}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return BE.NumberVal{Value: float64(rv.Int())}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return BE.NumberVal{Value: float64(rv.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return BE.NumberVal{Value: rv.Float()}, nil
+	case reflect.String:
+		return BE.StringVal{Value: rv.String()}, nil
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return BE.Null, nil
+		}
+		elements := make([]BE.RuntimeVal, rv.Len())
+		for i := range elements {
+			elem, err := c.convert(name, rv.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = elem
+		}
+		return &BE.ArrayVal{Elements: elements}, nil
+	case reflect.Map:
+		if rv.IsNil() {
+			return BE.Null, nil
+		}
+		return c.convertMap(name, rv)
+	case reflect.Struct:
+		obj := &BE.ObjectVal{Properties: map[string]BE.RuntimeVal{}}
+		return obj, c.fillStruct(obj, rv)
+	case reflect.Func:
+		if rv.IsNil() {
+			return BE.Null, nil
+		}
+		return c.runtime.wrapFunc(name, rv), nil
+	}
+
+	return nil, fmt.Errorf("unsupported Go type %s", rv.Type())
+}
+
+func (c *converter) convertMap(name string, rv reflect.Value) (BE.RuntimeVal, error) {
+	if rv.Type().Key().Kind() == reflect.String {
+		obj := &BE.ObjectVal{Properties: make(map[string]BE.RuntimeVal, rv.Len())}
+		iter := rv.MapRange()
+		for iter.Next() {
+			val, err := c.convert(name, iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			obj.Properties[iter.Key().String()] = val
+		}
+		return obj, nil
+	}
+
+	m := &BE.MapVal{Entries: BE.NewValueMap()}
+	iter := rv.MapRange()
+	for iter.Next() {
+		key, err := c.convert(name, iter.Key())
+		if err != nil {
+			return nil, err
+		}
+		val, err := c.convert(name, iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		m.Entries.Set(key, val)
+	}
+	return m, nil
+}
+
+func (c *converter) fillStruct(obj *BE.ObjectVal, rv reflect.Value) error {
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+		prop, ok := propertyName(field)
+		if !ok {
+			continue
+		}
+		val, err := c.convert(prop, rv.Field(i))
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		obj.Properties[prop] = val
+	}
+	return nil
+}
+
+// propertyName is the object property a struct field maps to.
+func propertyName(field reflect.StructField) (string, bool) {
+	if !field.IsExported() {
+		return "", false
+	}
+
+	tag := field.Tag.Get("pop")
+	if tag == "-" {
+		return "", false
+	}
+	if tag != "" {
+		return tag, true
+	}
+
+	return lowerCamel(field.Name), true
+}
+
+// lowerCamel lowercases the leading initialism or letter of a Go name, so
+// ID becomes id, URLPath becomes urlPath and Total becomes total.
+func lowerCamel(name string) string {
+	runes := []rune(name)
+	for i := 0; i < len(runes) && unicode.IsUpper(runes[i]); i++ {
+		if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
+
+func isRuntimeVal(v any) bool {
+	switch v.(type) {
+	case BE.NullValue, BE.BoolValue, BE.NumberVal, BE.StringVal, *BE.ArrayVal, *BE.ObjectVal,
+		*BE.MapVal, *BE.SetVal, *BE.FunctionVal, *BE.NativeFunctionVal:
+		return true
+	}
+	return false
+}
+
+// wrapFunc exposes a Go func to Popcorn as a native function.
+func (r *Runtime) wrapFunc(name string, fn reflect.Value) *BE.NativeFunctionVal {
+	fnType := fn.Type()
+
+	return &BE.NativeFunctionVal{
+		Name: name,
+		Call: func(args []BE.RuntimeVal, env *BE.Environment) BE.RuntimeVal {
+			in, err := r.decodeArgs(fnType, args)
+			if err != nil {
+				BE.Throw(fmt.Errorf("%s: %w", name, err))
+			}
+
+			var failed error
+			outer := r.failed
+			r.failed = &failed
+			defer func() { r.failed = outer }()
+			out := fn.Call(in)
+			if failed != nil {
+				raise(failed)
+			}
+
+			result, err := r.convertResults(out, fnType)
+			if err != nil {
+				BE.Throw(err)
+			}
+			return result
+		},
+	}
+}
+
+func (r *Runtime) decodeArgs(fnType reflect.Type, args []BE.RuntimeVal) ([]reflect.Value, error) {
+	numIn := fnType.NumIn()
+	fixed := numIn
+	if fnType.IsVariadic() {
+		fixed--
+	}
+
+	if len(args) < fixed || (!fnType.IsVariadic() && len(args) > fixed) {
+		return nil, fmt.Errorf("expects %d argument(s), got %d", fixed, len(args))
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		paramType := fnType.In(min(i, numIn-1))
+		if i >= fixed {
+			paramType = fnType.In(numIn - 1).Elem()
+		}
+
+		val, err := r.decode(arg, paramType)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i+1, err)
+		}
+		in[i] = val
+	}
+	return in, nil
+}
+
+// convertResults turns a Go func's results into a single runtime value and
+// splits off a trailing error.
+func (r *Runtime) convertResults(out []reflect.Value, fnType reflect.Type) (BE.RuntimeVal, error) {
+	if n := fnType.NumOut(); n > 0 && fnType.Out(n-1) == errorType {
+		if errVal := out[n-1]; !errVal.IsNil() {
+			return nil, errVal.Interface().(error)
+		}
+		out = out[:n-1]
+	}
+
+	c := converter{runtime: r, seen: map[pointer]BE.RuntimeVal{}}
+	switch len(out) {
+	case 0:
+		return BE.Null, nil
+	case 1:
+		return c.convert("anonymous", out[0])
+	}
+
+	elements := make([]BE.RuntimeVal, len(out))
+	for i, val := range out {
+		elem, err := c.convert("anonymous", val)
+		if err != nil {
+			return nil, err
+		}
+		elements[i] = elem
+	}
+	return &BE.ArrayVal{Elements: elements}, nil
+}
+
+// * ======== POPCORN -> GO ======== * \\
+
+// FromValue converts a runtime value to its natural Go form, see the
+// package documentation for the rules.
+func (r *Runtime) FromValue(val BE.RuntimeVal) (any, error) {
+	return r.fromValue(val, map[BE.RuntimeVal]any{})
+}
+
+func (r *Runtime) fromValue(val BE.RuntimeVal, seen map[BE.RuntimeVal]any) (any, error) {
+	if converted, ok := seen[val]; ok {
+		return converted, nil
+	}
+
+	switch v := val.(type) {
+	case nil, BE.NullValue:
+		return nil, nil
+	case BE.ReturnVal:
+		return r.fromValue(v.Value, seen)
+	case BE.BoolValue:
+		return v.Value, nil
+	case BE.NumberVal:
+		return v.Value, nil
+	case BE.StringVal:
+		return v.Value, nil
+	case *BE.ArrayVal:
+		out := make([]any, len(v.Elements))
+		seen[v] = out
+		for i, elem := range v.Elements {
+			converted, err := r.fromValue(elem, seen)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = converted
+		}
+		return out, nil
+	case *BE.ObjectVal:
+		out := make(map[string]any, len(v.Properties))
+		seen[v] = out
+		for key, prop := range v.Properties {
+			converted, err := r.fromValue(prop, seen)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = converted
+		}
+		return out, nil
+	case *BE.MapVal:
+		out := make(map[any]any, v.Entries.Len())
+		seen[v] = out
+		for _, entry := range v.Entries.Entries() {
+			key, err := r.fromValue(entry.Key, seen)
+			if err != nil {
+				return nil, err
+			}
+			if key != nil && !reflect.TypeOf(key).Comparable() {
+				return nil, fmt.Errorf("Map key %s cannot be used as a Go map key", entry.Key)
+			}
+			converted, err := r.fromValue(entry.Value, seen)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = converted
+		}
+		return out, nil
+	case *BE.SetVal:
+		out := make([]any, 0, v.Entries.Len())
+		for _, entry := range v.Entries.Entries() {
+			converted, err := r.fromValue(entry.Key, seen)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, converted)
+		}
+		return out, nil
+	case *BE.FunctionVal, *BE.NativeFunctionVal:
+		return func(args ...any) (any, error) {
+			vals := make([]BE.RuntimeVal, len(args))
+			for i, arg := range args {
+				converted, err := r.ToValue(arg)
+				if err != nil {
+					return nil, fmt.Errorf("argument %d: %w", i+1, err)
+				}
+				vals[i] = converted
+			}
+
+			result, err := r.it.CallValue(v, vals...)
+			if err != nil {
+				return nil, err
+			}
+			return r.FromValue(result)
+		}, nil
+	}
+
+	return nil, fmt.Errorf("cannot convert %T to a Go value", val)
+}
+
+// Decode converts val into the Go value target points to.
+func (r *Runtime) Decode(val BE.RuntimeVal, target any) error {
+	ptr := reflect.ValueOf(target)
+	if ptr.Kind() != reflect.Pointer || ptr.IsNil() {
+		return fmt.Errorf("Decode target must be a non-nil pointer, got %T", target)
+	}
+
+	decoded, err := r.decode(val, ptr.Elem().Type())
+	if err != nil {
+		return err
+	}
+	ptr.Elem().Set(decoded)
+	return nil
+}
+
+func (r *Runtime) decode(val BE.RuntimeVal, t reflect.Type) (reflect.Value, error) {
+	d := decoder{runtime: r, seen: map[objectPointer]reflect.Value{}}
+	return d.decode(val, t)
+}
+
+// decoder remembers which objects it has decoded into pointers to structs
+// so that cyclic Popcorn objects become cyclic Go structures instead of
+// recursing forever.
+type decoder struct {
+	runtime *Runtime
+	seen    map[objectPointer]reflect.Value
+}
+
+// objectPointer is an object decoded into a pointer of type typ.
+type objectPointer struct {
+	obj *BE.ObjectVal
+	typ reflect.Type
+}
+
+func (d *decoder) decode(val BE.RuntimeVal, t reflect.Type) (reflect.Value, error) {
+	if ret, ok := val.(BE.ReturnVal); ok {
+		val = ret.Value
+	}
+
+	// Parameters typed as a concrete runtime value receive it untouched
+	if t.Kind() != reflect.Interface && val != nil && reflect.TypeOf(val).AssignableTo(t) {
+		return reflect.ValueOf(val), nil
+	}
+
+	mismatch := fmt.Errorf("cannot use %s as %s", BE.Inspect(val, BE.DefaultInspectOptions), t)
+	out := reflect.New(t).Elem()
+
+	switch t.Kind() {
+	case reflect.Interface:
+		natural, err := d.runtime.FromValue(val)
+		if err != nil {
+			return out, err
+		}
+		if natural == nil {
+			return out, nil
+		}
+		if !reflect.TypeOf(natural).AssignableTo(t) {
+			return out, mismatch
+		}
+		out.Set(reflect.ValueOf(natural))
+		return out, nil
+	case reflect.Pointer:
+		if _, isNull := val.(BE.NullValue); isNull {
+			return out, nil
+		}
+		if obj, ok := val.(*BE.ObjectVal); ok && t.Elem().Kind() == reflect.Struct {
+			key := objectPointer{obj: obj, typ: t}
+			if ptr, ok := d.seen[key]; ok {
+				return ptr, nil
+			}
+			ptr := reflect.New(t.Elem())
+			d.seen[key] = ptr
+			return ptr, d.decodeStruct(obj, ptr.Elem())
+		}
+		elem, err := d.decode(val, t.Elem())
+		if err != nil {
+			return out, err
+		}
+		ptr := reflect.New(t.Elem())
+		ptr.Elem().Set(elem)
+		return ptr, nil
+	case reflect.Bool:
+		b, ok := val.(BE.BoolValue)
+		if !ok {
+			return out, mismatch
+		}
+		out.SetBool(b.Value)
+		return out, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := val.(BE.NumberVal)
+		if !ok {
+			return out, mismatch
+		}
+		if n.Value != math.Trunc(n.Value) || math.Abs(n.Value) > math.MaxInt64 || out.OverflowInt(int64(n.Value)) {
+			return out, fmt.Errorf("%v does not fit in %s", BE.FormatNumber(n.Value), t)
+		}
+		out.SetInt(int64(n.Value))
+		return out, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, ok := val.(BE.NumberVal)
+		if !ok {
+			return out, mismatch
+		}
+		if n.Value != math.Trunc(n.Value) || n.Value < 0 || n.Value > math.MaxUint64 || out.OverflowUint(uint64(n.Value)) {
+			return out, fmt.Errorf("%v does not fit in %s", BE.FormatNumber(n.Value), t)
+		}
+		out.SetUint(uint64(n.Value))
+		return out, nil
+	case reflect.Float32, reflect.Float64:
+		n, ok := val.(BE.NumberVal)
+		if !ok {
+			return out, mismatch
+		}
+		out.SetFloat(n.Value)
+		return out, nil
+	case reflect.String:
+		s, ok := val.(BE.StringVal)
+		if !ok {
+			return out, mismatch
+		}
+		out.SetString(s.Value)
+		return out, nil
+	case reflect.Slice, reflect.Array:
+		return d.decodeSequence(val, t, out, mismatch)
+	case reflect.Map:
+		return d.decodeMap(val, t, out, mismatch)
+	case reflect.Struct:
+		obj, ok := val.(*BE.ObjectVal)
+		if !ok {
+			return out, mismatch
+		}
+		return out, d.decodeStruct(obj, out)
+	case reflect.Func:
+		switch val.(type) {
+		case *BE.FunctionVal, *BE.NativeFunctionVal:
+			return d.runtime.makeFunc(val, t), nil
+		case BE.NullValue:
+			return out, nil
+		}
+		return out, mismatch
+	}
+
+	return out, fmt.Errorf("unsupported Go type %s", t)
+}
+
+// decodeStruct fills the fields of the struct out from the properties of
+// obj they map to.
+func (d *decoder) decodeStruct(obj *BE.ObjectVal, out reflect.Value) error {
+	t := out.Type()
+	for i := 0; i < t.NumField(); i++ {
+		prop, ok := propertyName(t.Field(i))
+		if !ok {
+			continue
+		}
+		propVal, exists := obj.Properties[prop]
+		if !exists {
+			continue
+		}
+		field, err := d.decode(propVal, t.Field(i).Type)
+		if err != nil {
+			return fmt.Errorf("property %s: %w", prop, err)
+		}
+		out.Field(i).Set(field)
+	}
+	return nil
+}
+
+func (d *decoder) decodeSequence(val BE.RuntimeVal, t reflect.Type, out reflect.Value, mismatch error) (reflect.Value, error) {
+	var elements []BE.RuntimeVal
+	switch v := val.(type) {
+	case *BE.ArrayVal:
+		elements = v.Elements
+	case *BE.SetVal:
+		for _, entry := range v.Entries.Entries() {
+			elements = append(elements, entry.Key)
+		}
+	case BE.NullValue:
+		if t.Kind() == reflect.Slice {
+			return out, nil
+		}
+		return out, mismatch
+	default:
+		return out, mismatch
+	}
+
+	if t.Kind() == reflect.Array {
+		if len(elements) != t.Len() {
+			return out, fmt.Errorf("cannot use array of length %d as %s", len(elements), t)
+		}
+	} else {
+		out.Set(reflect.MakeSlice(t, len(elements), len(elements)))
+	}
+
+	for i, elem := range elements {
+		decoded, err := d.decode(elem, t.Elem())
+		if err != nil {
+			return out, fmt.Errorf("element %d: %w", i, err)
+		}
+		out.Index(i).Set(decoded)
+	}
+	return out, nil
+}
+
+func (d *decoder) decodeMap(val BE.RuntimeVal, t reflect.Type, out reflect.Value, mismatch error) (reflect.Value, error) {
+	switch v := val.(type) {
+	case BE.NullValue:
+		return out, nil
+	case *BE.ObjectVal:
+		if t.Key().Kind() != reflect.String {
+			return out, mismatch
+		}
+		out.Set(reflect.MakeMapWithSize(t, len(v.Properties)))
+		for key, prop := range v.Properties {
+			decoded, err := d.decode(prop, t.Elem())
+			if err != nil {
+				return out, fmt.Errorf("property %s: %w", key, err)
+			}
+			out.SetMapIndex(reflect.ValueOf(key).Convert(t.Key()), decoded)
+		}
+		return out, nil
+	case *BE.MapVal:
+		out.Set(reflect.MakeMapWithSize(t, v.Entries.Len()))
+		for _, entry := range v.Entries.Entries() {
+			key, err := d.decode(entry.Key, t.Key())
+			if err != nil {
+				return out, fmt.Errorf("key %s: %w", entry.Key, err)
+			}
+			decoded, err := d.decode(entry.Value, t.Elem())
+			if err != nil {
+				return out, fmt.Errorf("value for %s: %w", entry.Key, err)
+			}
+			out.SetMapIndex(key, decoded)
+		}
+		return out, nil
+	}
+	return out, mismatch
+}
+
+// makeFunc builds a Go func of type t that calls a Popcorn function.
+func (r *Runtime) makeFunc(fn BE.RuntimeVal, t reflect.Type) reflect.Value {
+	return reflect.MakeFunc(t, func(in []reflect.Value) []reflect.Value {
+		var args []BE.RuntimeVal
+		for i, arg := range in {
+			if t.IsVariadic() && i == len(in)-1 {
+				for j := 0; j < arg.Len(); j++ {
+					val, err := r.ToValue(arg.Index(j).Interface())
+					if err != nil {
+						return r.funcResults(t, nil, err)
+					}
+					args = append(args, val)
+				}
+				continue
+			}
+
+			val, err := r.ToValue(arg.Interface())
+			if err != nil {
+				return r.funcResults(t, nil, err)
+			}
+			args = append(args, val)
+		}
+
+		result, err := r.it.CallValue(fn, args...)
+		return r.funcResults(t, result, err)
+	})
+}
+
+// funcResults decodes a Popcorn result into the results of func type t.
+// A failure gives zero values and the error result, or without one, is
+// raised once the native that is running returns, see Runtime.failed.
+func (r *Runtime) funcResults(t reflect.Type, result BE.RuntimeVal, err error) []reflect.Value {
+	numOut := t.NumOut()
+	hasErr := numOut > 0 && t.Out(numOut-1) == errorType
+	numVals := numOut
+	if hasErr {
+		numVals--
+	}
+
+	out := make([]reflect.Value, numOut)
+	for i := range out {
+		out[i] = reflect.Zero(t.Out(i))
+	}
+
+	if err == nil {
+		switch numVals {
+		case 0:
+		case 1:
+			out[0], err = r.decode(result, t.Out(0))
+		default:
+			arr, ok := result.(*BE.ArrayVal)
+			if !ok || len(arr.Elements) != numVals {
+				err = fmt.Errorf("expected %d results, got %s", numVals, BE.Inspect(result, BE.DefaultInspectOptions))
+				break
+			}
+			for i := 0; i < numVals && err == nil; i++ {
+				out[i], err = r.decode(arr.Elements[i], t.Out(i))
+			}
+		}
+	}
+
+	if err != nil {
+		for i := 0; i < numVals; i++ {
+			out[i] = reflect.Zero(t.Out(i))
+		}
+		if hasErr {
+			out[numOut-1] = reflect.ValueOf(&err).Elem()
+		} else if r.failed != nil && *r.failed == nil {
+			*r.failed = err
+		}
+	}
+	return out
+}
+
+// raise fails the running native with err, as is if it is a Popcorn error.
+func raise(err error) {
+	var runtimeErr *BE.RuntimeError
+	if errors.As(err, &runtimeErr) {
+		panic(runtimeErr)
+	}
+	BE.Throw(err)
+}
@@ -0,0 +1,69 @@
+// Package popcorn embeds the Popcorn interpreter in Go programs.
+//
+// A Runtime wraps a backend.Interpreter and converts values between Go and
+// Popcorn with reflection, so business rules can be scripted in Popcorn
+// while the data and helpers they need live in Go:
+//
+//	rt := popcorn.New(backend.Options{})
+//	rt.Set("discount", func(total float64) float64 { return total * 0.9 })
+//	rt.Set("order", Order{ID: 7, Total: 120})
+//	price, err := rt.Run("discount(order.total)")
+//
+// # Go to Popcorn
+//
+// Set, Call arguments and Go function results are converted as follows:
+//
+//   - nil, nil pointers, nil slices and nil maps become null
+//   - bool becomes a boolean
+//   - every integer and float kind becomes a number
+//   - string becomes a string
+//   - slices and arrays become arrays
+//   - maps with string keys become objects, other maps become Maps
+//   - structs become objects of their exported fields; the property name is
+//     the `pop:"name"` tag if present, otherwise the field name with its
+//     leading letter or initialism lowercased (Total to total, ID to id,
+//     URLPath to urlPath); `pop:"-"` skips a field
+//   - pointers and interfaces are converted through to the value they hold;
+//     a pointer to a struct already converted gives the same object, so
+//     cyclic structures stay cyclic
+//   - funcs become native functions (see below)
+//   - values that already are backend runtime values are used as is
+//
+// Channels, complex numbers and unsafe pointers cannot be converted and
+// make Set return an error. Methods are not exposed; pass a method value
+// such as svc.Lookup as a func instead.
+//
+// # Popcorn to Go
+//
+// Get, Run and Call results are converted to their natural Go form: null
+// to nil, booleans to bool, numbers to float64, strings to string, arrays
+// and sets to []any, objects to map[string]any, Maps to map[any]any and
+// functions to func(args ...any) (any, error).
+//
+// Decode converts into a specific Go type instead, following the Go to
+// Popcorn rules in reverse. Numbers decoded into integer types must be
+// whole and in range, and objects decoded into structs fill the fields
+// their properties map to. An object decoded into a pointer to a struct
+// more than once gives the same pointer.
+//
+// # Functions
+//
+// When Popcorn calls a Go func, each argument is decoded into the matching
+// parameter type, so func(name string, qty int) rejects a call with a
+// non-integral qty. Variadic funcs accept any number of trailing arguments.
+// A func must be called with all of its non-variadic parameters.
+//
+// The results are converted back: no results give null, one result is
+// converted as above and several results become an array. If the last
+// result is an error and is non-nil, the call fails with a
+// *backend.RuntimeError that wraps it, so
+//
+//	_, err := rt.Call("checkout", cart)
+//	errors.Is(err, ErrOutOfStock)
+//
+// works across the Popcorn boundary. Popcorn functions decoded into a Go
+// func type are called through the interpreter; if the func type returns
+// an error the Popcorn failure is returned there. Otherwise the func
+// returns zero values, and if a Go func that Popcorn called made the call,
+// that call fails with the error once the Go func returns.
+package popcorn
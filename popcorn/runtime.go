@@ -0,0 +1,80 @@
+package popcorn
+
+import (
+	"fmt"
+	BE "pop/backend"
+)
+
+// Runtime is an interpreter with Go value conversion on top.
+type Runtime struct {
+	it *BE.Interpreter
+	// failed is where the native that is running keeps the first failure
+	// of a Popcorn function it called through a Go func without an error
+	// result, to raise it when it returns. It is nil outside of natives.
+	failed *error
+}
+
+// New creates a runtime with a fresh global scope.
+func New(opts BE.Options) *Runtime {
+	return &Runtime{it: BE.NewInterpreter(opts)}
+}
+
+// Interpreter returns the underlying interpreter.
+func (r *Runtime) Interpreter() *BE.Interpreter {
+	return r.it
+}
+
+// Set converts v and binds it to the global name.
+func (r *Runtime) Set(name string, v any) error {
+	val, err := r.toValue(name, v)
+	if err != nil {
+		return fmt.Errorf("cannot set '%s': %w", name, err)
+	}
+	return r.it.SetGlobal(name, val)
+}
+
+// Get returns the global name converted to Go.
+func (r *Runtime) Get(name string) (any, error) {
+	val, ok := r.it.Globals.LookupVar(name)
+	if !ok {
+		return nil, fmt.Errorf("no global named '%s'", name)
+	}
+	return r.FromValue(val)
+}
+
+// Run evaluates source and returns its final value converted to Go.
+func (r *Runtime) Run(source string) (any, error) {
+	val, err := r.it.RunString(source)
+	if err != nil {
+		return nil, err
+	}
+	return r.FromValue(val)
+}
+
+// RunFile evaluates a file and returns its final value converted to Go.
+func (r *Runtime) RunFile(path string) (any, error) {
+	val, err := r.it.RunFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return r.FromValue(val)
+}
+
+// Call converts args, calls the global function name and converts the
+// result back to Go.
+func (r *Runtime) Call(name string, args ...any) (any, error) {
+	vals := make([]BE.RuntimeVal, len(args))
+	for i, arg := range args {
+		val, err := r.ToValue(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i+1, err)
+		}
+		vals[i] = val
+	}
+
+	result, err := r.it.Call(name, vals...)
+	if err != nil {
+		return nil, err
+	}
+	return r.FromValue(result)
+}
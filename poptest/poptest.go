@@ -0,0 +1,221 @@
+// Package poptest runs the test blocks of Popcorn files,
+//
+//	test "adds numbers" {
+//	  assertEq(add(1, 2), 3)
+//	}
+//
+// and reports their results as text, TAP or JUnit XML. It backs
+// `popcorn test`.
+package poptest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	BE "pop/backend"
+	FE "pop/frontend"
+	"pop/frontend/types/ast"
+	"pop/packages"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Suffix ends the names of the files Discover finds.
+const Suffix = "_test.pop"
+
+// Options configures RunFile.
+type Options struct {
+	// Interpreter are the options of the interpreter each test runs in.
+	// Its Stdout and Stderr are replaced to capture what the test prints.
+	Interpreter BE.Options
+	// Run, if set, runs only the tests whose names it matches
+	Run *regexp.Regexp
+	// Timeout ends a test that runs for longer, including the top-level
+	// code of its file. Zero means no limit.
+	Timeout time.Duration
+}
+
+// Test is a test block of a file.
+type Test struct {
+	Name string
+	Pos  ast.Position
+}
+
+// Suite holds the results of the tests of a file.
+type Suite struct {
+	File string
+	// Err is why the file could not be loaded or parsed, in which case
+	// none of its tests ran
+	Err     error
+	Results []Result
+}
+
+// Result is how a test went.
+type Result struct {
+	Test
+	Duration time.Duration
+	// Output is what the test printed
+	Output string
+	// Failure is why the test failed, nil if it passed
+	Failure *Failure
+}
+
+// Failure is the error a test failed with.
+type Failure struct {
+	// Name is that of the error, AssertionError for an assertion that
+	// does not hold, and empty for a file that does not resolve
+	Name    string
+	Message string
+	// Line and Column are where in the test's file the error was raised,
+	// or the call that raised it was made, 0 if not known
+	Line, Column int
+	// Expected and Actual are the values a failed assertEq compared, as
+	// Inspect prints them, and empty for other failures
+	Expected, Actual string
+	// Traceback is that of the error, if it is a runtime error
+	Traceback string
+}
+
+// Passed reports whether the test passed.
+func (r Result) Passed() bool {
+	return r.Failure == nil
+}
+
+// Failed counts the tests of s that failed.
+func (s Suite) Failed() int {
+	failed := 0
+	for _, r := range s.Results {
+		if !r.Passed() {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Duration is how long the tests of s took together.
+func (s Suite) Duration() time.Duration {
+	var total time.Duration
+	for _, r := range s.Results {
+		total += r.Duration
+	}
+	return total
+}
+
+// Discover returns the test files in dir and the directories under it,
+// in lexical order, leaving out hidden directories and pop_modules.
+func Discover(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && file != dir && (strings.HasPrefix(entry.Name(), ".") || entry.Name() == packages.ModulesDir) {
+			return filepath.SkipDir
+		}
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), Suffix) {
+			files = append(files, file)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// Tests lists the test blocks of program in order.
+func Tests(program ast.Program) []Test {
+	var tests []Test
+	for _, node := range program.Body {
+		if fn, ok := node.(ast.FunctionDeclarationNode); ok && fn.TestName != "" {
+			tests = append(tests, Test{Name: fn.TestName, Pos: fn.Pos})
+		}
+	}
+	return tests
+}
+
+// RunFile runs the tests of file that opts.Run selects, each in an
+// interpreter of its own: the top-level code of the file runs again for
+// every test, and modules are imported afresh, so tests cannot see what
+// the others did.
+func RunFile(file string, opts Options) Suite {
+	suite := Suite{File: file}
+	resolver := opts.Interpreter.Resolver
+	if resolver == nil {
+		resolver = BE.FileResolver{}
+	}
+	path, err := resolver.Resolve("", file)
+	if err == nil {
+		var source []byte
+		if source, err = resolver.Load(path); err == nil {
+			var program ast.Program
+			if program, err = FE.Parse(string(source)); err == nil {
+				for _, test := range Tests(program) {
+					if opts.Run == nil || opts.Run.MatchString(test.Name) {
+						suite.Results = append(suite.Results, runTest(file, test, opts))
+					}
+				}
+			}
+		}
+	}
+	suite.Err = err
+	return suite
+}
+
+// runTest runs the file and then calls the function test declares.
+func runTest(file string, test Test, opts Options) Result {
+	var output bytes.Buffer
+	itOpts := opts.Interpreter
+	itOpts.Stdout, itOpts.Stderr = &output, &output
+	it := BE.NewInterpreter(itOpts)
+
+	ctx := context.Background()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	_, err := it.RunFileContext(ctx, file)
+	if err == nil {
+		_, err = it.CallContext(ctx, ast.TestFunctionName(test.Name))
+	}
+	result := Result{Test: test, Duration: time.Since(start), Output: output.String()}
+	if err != nil {
+		result.Failure = failure(file, err)
+	}
+	return result
+}
+
+// diffInspect shows values compared by assertEq one per line, unless they
+// are long, so that the lines that differ stand out.
+var diffInspect = BE.InspectOptions{Indent: "  ", MaxDepth: -1, MaxItems: -1, Width: 40}
+
+// failure describes the error err a test in file failed with.
+func failure(file string, err error) *Failure {
+	var runtimeErr *BE.RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		return &Failure{Message: err.Error()}
+	}
+
+	f := &Failure{Name: runtimeErr.Name, Message: runtimeErr.Message, Traceback: runtimeErr.Traceback()}
+	if f.Name == "" {
+		f.Name = "Error"
+	}
+	for i := len(runtimeErr.Trace) - 1; i >= 0; i-- {
+		if frame := runtimeErr.Trace[i]; frame.File == file && frame.Line > 0 {
+			f.Line, f.Column = frame.Line, frame.Column
+			break
+		}
+	}
+	if obj, ok := runtimeErr.Value.(*BE.ObjectVal); ok && f.Name == BE.AssertionError {
+		expected, hasExpected := obj.Properties["expected"]
+		actual, hasActual := obj.Properties["actual"]
+		if hasExpected && hasActual {
+			f.Expected = BE.Inspect(expected, diffInspect)
+			f.Actual = BE.Inspect(actual, diffInspect)
+		}
+	}
+	return f
+}
@@ -0,0 +1,243 @@
+package poptest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	BE "pop/backend"
+	"pop/format"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Diff shows the values a failed assertEq compared: one under the other
+// if both fit on a line, or else as a diff of the expected value to the
+// actual one. It is empty for other failures.
+func (f *Failure) Diff() string {
+	if f.Expected == "" && f.Actual == "" {
+		return ""
+	}
+	if !strings.Contains(f.Expected, "\n") && !strings.Contains(f.Actual, "\n") {
+		return fmt.Sprintf("expected: %s\n  actual: %s\n", f.Expected, f.Actual)
+	}
+	return format.DiffNamed("expected", "actual", f.Expected+"\n", f.Actual+"\n")
+}
+
+// Error is the name of the error, if it has one, and its message.
+func (f *Failure) Error() string {
+	if f.Name == "" {
+		return f.Message
+	}
+	return f.Name + ": " + f.Message
+}
+
+// location is where in file r failed, or else where its test is.
+func (r Result) location(file string) string {
+	if r.Failure != nil && r.Failure.Line > 0 {
+		return fmt.Sprintf("%s:%d:%d", file, r.Failure.Line, r.Failure.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", file, r.Pos.Line, r.Pos.Column)
+}
+
+// Counts returns the number of tests in suites, of those that failed, and
+// of the files that could not be loaded.
+func Counts(suites []Suite) (tests, failed, broken int) {
+	for _, s := range suites {
+		tests += len(s.Results)
+		failed += s.Failed()
+		if s.Err != nil {
+			broken++
+		}
+	}
+	return tests, failed, broken
+}
+
+// WriteText writes the tests of suites that failed, each with where it
+// failed, its error, what assertEq compared and what it printed, and then
+// a line for each file and one for them all. Verbose writes the tests that
+// passed as well.
+func WriteText(w io.Writer, suites []Suite, verbose bool) {
+	for _, s := range suites {
+		for _, r := range s.Results {
+			if r.Passed() {
+				if verbose {
+					fmt.Fprintf(w, "--- PASS: %s (%ss)\n", r.Name, seconds(r.Duration))
+				}
+				continue
+			}
+			fmt.Fprintf(w, "--- FAIL: %s (%ss)\n", r.Name, seconds(r.Duration))
+			fmt.Fprintf(w, "    %s: %s\n", r.location(s.File), r.Failure.Error())
+			writeIndented(w, "    ", r.Failure.Diff())
+			if r.Output != "" {
+				fmt.Fprintln(w, "    output:")
+				writeIndented(w, "      ", r.Output)
+			}
+		}
+
+		switch {
+		case s.Err != nil:
+			fmt.Fprintf(w, "FAIL  %s  %v\n", s.File, s.Err)
+		case len(s.Results) == 0:
+			fmt.Fprintf(w, "ok    %s  no tests to run\n", s.File)
+		case s.Failed() > 0:
+			fmt.Fprintf(w, "FAIL  %s  %d of %d failed (%ss)\n", s.File, s.Failed(), len(s.Results), seconds(s.Duration()))
+		default:
+			fmt.Fprintf(w, "ok    %s  %d passed (%ss)\n", s.File, len(s.Results), seconds(s.Duration()))
+		}
+	}
+
+	tests, failed, broken := Counts(suites)
+	switch {
+	case failed > 0 || broken > 0:
+		fmt.Fprintf(w, "FAIL: %d of %d tests failed", failed, tests)
+		if broken > 0 {
+			fmt.Fprintf(w, ", %d files could not be loaded", broken)
+		}
+		fmt.Fprintln(w)
+	default:
+		fmt.Fprintf(w, "PASS: %d tests passed\n", tests)
+	}
+}
+
+// WriteTAP writes the results of suites in the Test Anything Protocol,
+// version 13, with the details of failures in YAML blocks. A file that
+// could not be loaded is a failed test of its own.
+func WriteTAP(w io.Writer, suites []Suite) {
+	tests, _, broken := Counts(suites)
+	fmt.Fprintf(w, "TAP version 13\n1..%d\n", tests+broken)
+	n := 0
+	for _, s := range suites {
+		if s.Err != nil {
+			n++
+			fmt.Fprintf(w, "not ok %d - %s\n  ---\n  message: %s\n  ...\n", n, s.File, strconv.Quote(s.Err.Error()))
+		}
+		for _, r := range s.Results {
+			n++
+			if r.Passed() {
+				fmt.Fprintf(w, "ok %d - %s: %s\n", n, s.File, r.Name)
+				continue
+			}
+			fmt.Fprintf(w, "not ok %d - %s: %s\n  ---\n", n, s.File, r.Name)
+			fmt.Fprintf(w, "  message: %s\n  at: %s\n", strconv.Quote(r.Failure.Error()), strconv.Quote(r.location(s.File)))
+			if r.Failure.Expected != "" || r.Failure.Actual != "" {
+				writeBlock(w, "expected", r.Failure.Expected)
+				writeBlock(w, "actual", r.Failure.Actual)
+			}
+			if r.Output != "" {
+				writeBlock(w, "output", r.Output)
+			}
+			fmt.Fprintf(w, "  duration_ms: %.3f\n  ...\n", float64(r.Duration)/float64(time.Millisecond))
+		}
+	}
+}
+
+// The JUnit XML format, as CI servers read it.
+type (
+	junitSuites struct {
+		XMLName  xml.Name     `xml:"testsuites"`
+		Tests    int          `xml:"tests,attr"`
+		Failures int          `xml:"failures,attr"`
+		Errors   int          `xml:"errors,attr"`
+		Time     string       `xml:"time,attr"`
+		Suites   []junitSuite `xml:"testsuite"`
+	}
+	junitSuite struct {
+		Name     string      `xml:"name,attr"`
+		Tests    int         `xml:"tests,attr"`
+		Failures int         `xml:"failures,attr"`
+		Errors   int         `xml:"errors,attr"`
+		Time     string      `xml:"time,attr"`
+		Cases    []junitCase `xml:"testcase"`
+	}
+	junitCase struct {
+		Name      string        `xml:"name,attr"`
+		Classname string        `xml:"classname,attr"`
+		File      string        `xml:"file,attr"`
+		Line      int           `xml:"line,attr,omitempty"`
+		Time      string        `xml:"time,attr"`
+		Failure   *junitFailure `xml:"failure,omitempty"`
+		Error     *junitFailure `xml:"error,omitempty"`
+		SystemOut string        `xml:"system-out,omitempty"`
+	}
+	junitFailure struct {
+		Message string `xml:"message,attr"`
+		Type    string `xml:"type,attr,omitempty"`
+		Text    string `xml:",chardata"`
+	}
+)
+
+// WriteJUnit writes the results of suites as JUnit XML, a testsuite per
+// file. Failed assertions are failures and other errors errors, as is a
+// file that could not be loaded.
+func WriteJUnit(w io.Writer, suites []Suite) error {
+	report := junitSuites{}
+	var total time.Duration
+	for _, s := range suites {
+		suite := junitSuite{Name: s.File, Tests: len(s.Results), Time: seconds(s.Duration())}
+		if s.Err != nil {
+			suite.Tests++
+			suite.Errors++
+			suite.Cases = append(suite.Cases, junitCase{
+				Name: s.File, Classname: s.File, File: s.File, Time: seconds(0),
+				Error: &junitFailure{Message: s.Err.Error()},
+			})
+		}
+		for _, r := range s.Results {
+			c := junitCase{Name: r.Name, Classname: s.File, File: s.File, Line: r.Pos.Line, Time: seconds(r.Duration), SystemOut: r.Output}
+			if !r.Passed() {
+				details := &junitFailure{
+					Message: r.Failure.Error(),
+					Type:    r.Failure.Name,
+					Text:    r.location(s.File) + ": " + r.Failure.Error() + "\n" + r.Failure.Diff() + r.Failure.Traceback,
+				}
+				if r.Failure.Name == BE.AssertionError {
+					c.Failure = details
+					suite.Failures++
+				} else {
+					c.Error = details
+					suite.Errors++
+				}
+			}
+			suite.Cases = append(suite.Cases, c)
+		}
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Errors += suite.Errors
+		total += s.Duration()
+		report.Suites = append(report.Suites, suite)
+	}
+	report.Time = seconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// seconds formats d as seconds without a unit, like 0.012.
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// writeIndented writes text with each line indented by prefix.
+func writeIndented(w io.Writer, prefix, text string) {
+	if text == "" {
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		fmt.Fprintln(w, strings.TrimRight(prefix+line, " "))
+	}
+}
+
+// writeBlock writes text as a YAML literal block, the value of key.
+func writeBlock(w io.Writer, key, text string) {
+	fmt.Fprintf(w, "  %s: |\n", key)
+	writeIndented(w, "    ", text)
+}
@@ -0,0 +1,507 @@
+// Package resolver finds the variable every identifier refers to before a
+// program runs. It gives each local variable a slot in the scope declaring
+// it and each reference the Address of that slot, so the interpreter reads
+// locals by index rather than by name, and it reports variables that are
+// used before their declaration or not declared at all.
+//
+// Scopes are those the interpreter creates: top-level code declares
+// globals, and functions and the bodies of if, else, while, for, try and
+// catch get local scopes.
+package resolver
+
+import (
+	"fmt"
+	"pop/frontend/types/ast"
+	"sort"
+	"strings"
+)
+
+// Options configures Resolve.
+type Options struct {
+	// Globals reports whether a global exists before the program runs, such
+	// as a native or a variable of an earlier run. Nil skips the checks for
+	// undeclared variables and variables used before their declaration.
+	Globals func(name string) bool
+	// Symbols, if set, receives every declaration and variable reference
+	// in the program, for tools such as the language server.
+	Symbols *Symbols
+}
+
+// Symbols lists the scopes of a program, the variables declared in them
+// and the uses of each.
+type Symbols struct {
+	// Scopes start with that of the globals, and each comes before the
+	// scopes inside it
+	Scopes []*SymbolScope
+	// Declarations are listed scope by scope
+	Declarations []*Declaration
+	References   []*Reference
+}
+
+// SymbolScope is a scope and the variables declared in it.
+type SymbolScope struct {
+	// Node opens the scope: the Program for globals, or a
+	// FunctionDeclarationNode, IfStatementNode, WhileStatementNode or
+	// ForStatementNode, the `else` block of an IfStatementNode, or the body
+	// or handler of a TryStatementNode
+	Node   ast.ASTNode
+	Parent *SymbolScope
+	// Declarations are in the order of the source
+	Declarations []*Declaration
+}
+
+// DeclarationKind tells how a variable is declared.
+type DeclarationKind int
+
+const (
+	// Variable is declared by let
+	Variable DeclarationKind = iota
+	// Constant is declared by const
+	Constant
+	// Function is declared by fn
+	Function
+	// Parameter is a parameter of a function
+	Parameter
+	// CatchParameter is the error a catch binds
+	CatchParameter
+	// Import is bound by an import to an export of another module
+	Import
+)
+
+// Declaration is a variable as it is declared.
+type Declaration struct {
+	Name string
+	// Pos is the position of the name
+	Pos  ast.Position
+	Kind DeclarationKind
+	// Node is the declaring statement: a VariableDeclarationNode,
+	// FunctionDeclarationNode or ImportDeclarationNode, the
+	// FunctionDeclarationNode of a parameter, or the TryStatementNode of a
+	// caught error
+	Node  ast.ASTNode
+	Scope *SymbolScope
+}
+
+// Constant reports whether the variable cannot be assigned to, which
+// functions and imports cannot either.
+func (d *Declaration) Constant() bool {
+	return d.Kind == Constant || d.Kind == Function || d.Kind == Import
+}
+
+// Reference is a use of a variable.
+type Reference struct {
+	Name string
+	Pos  ast.Position
+	// Assignment is set for the target of an assignment
+	Assignment bool
+	// Shorthand is set for the variable of a shorthand property, {name},
+	// whose name is also the key
+	Shorthand bool
+	// Declaration is the declaration the reference resolves to. It is nil
+	// for natives, globals of earlier runs and undeclared variables.
+	Declaration *Declaration
+}
+
+// Kind tells what is wrong with a variable.
+type Kind int
+
+const (
+	// Undeclared is a variable that nothing declares
+	Undeclared Kind = iota
+	// UsedBeforeDeclaration is a variable used by code that runs before
+	// its declaration
+	UsedBeforeDeclaration
+)
+
+// Problem is a variable that cannot be resolved.
+type Problem struct {
+	Kind Kind
+	Name string
+	// Pos is where the variable is used
+	Pos ast.Position
+	// Declaration is where a variable used before its declaration is
+	// declared
+	Declaration ast.Position
+}
+
+func (p Problem) String() string {
+	if p.Kind == UsedBeforeDeclaration {
+		return fmt.Sprintf("Variable '%s' is used on line %d before its declaration on line %d", p.Name, p.Pos.Line, p.Declaration.Line)
+	}
+	return fmt.Sprintf("Undeclared variable '%s' on line %d", p.Name, p.Pos.Line)
+}
+
+// Error is returned for programs with variables that cannot be resolved.
+type Error struct {
+	// Problems are ordered by position
+	Problems []Problem
+}
+
+func (e *Error) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		lines[i] = problem.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Resolve returns a copy of program with the Address of every local
+// variable and the Scope of every local scope filled in. Globals keep a nil
+// Address. Problems are only reported with Options.Globals, and undeclared
+// variables only once each.
+func Resolve(program ast.Program, opts Options) (ast.Program, error) {
+	r := &resolver{opts: opts, globals: map[string]*binding{}, reported: map[string]bool{}}
+	r.symbolScope = r.scope(program)
+	for _, decl := range declarations(program.Body) {
+		d := r.declaration(decl)
+		if _, exists := r.globals[decl.name]; !exists {
+			r.globals[decl.name] = &binding{pos: decl.pos, decl: d}
+		}
+	}
+	program = r.node(program).(ast.Program)
+
+	if len(r.problems) > 0 {
+		sort.SliceStable(r.problems, func(i, j int) bool {
+			a, b := r.problems[i].Pos, r.problems[j].Pos
+			return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+		})
+		return program, &Error{Problems: r.problems}
+	}
+	return program, nil
+}
+
+type resolver struct {
+	opts Options
+	// scopes are the local scopes around the code being resolved,
+	// innermost last
+	scopes []*scope
+	// functions counts the functions around the code being resolved
+	functions int
+	// globals are the variables top-level code declares
+	globals  map[string]*binding
+	problems []Problem
+	reported map[string]bool
+	// symbolScope is the innermost scope of Options.Symbols
+	symbolScope *SymbolScope
+}
+
+type scope struct {
+	layout   *ast.Scope
+	symbols  *SymbolScope
+	bindings map[string]*binding
+	// function is the number of functions around the scope
+	function int
+}
+
+type binding struct {
+	slot int
+	pos  ast.Position
+	decl *Declaration
+	// declared is set once the declaration has been resolved. Until then
+	// only nested functions, which run later, see the variable.
+	declared bool
+}
+
+// declaration is a variable a statement declares into the scope it runs in.
+type declaration struct {
+	name string
+	kind DeclarationKind
+	node ast.ASTNode
+	// pos is the position of the declaring statement, namePos that of the
+	// name
+	pos     ast.Position
+	namePos ast.Position
+}
+
+// declarations lists the variables stmts declare into their scope,
+// including from blocks.
+func declarations(stmts []ast.ASTNode) []declaration {
+	var decls []declaration
+
+	var visit func(node ast.ASTNode)
+	visit = func(node ast.ASTNode) {
+		switch n := node.(type) {
+		case ast.VariableDeclarationNode:
+			kind := Variable
+			if n.Constant {
+				kind = Constant
+			}
+			decls = append(decls, declaration{n.Identifier, kind, n, n.Pos, nameAt(n.NamePos, n.Pos)})
+		case ast.FunctionDeclarationNode:
+			decls = append(decls, declaration{n.Name, Function, n, n.Pos, nameAt(n.NamePos, n.Pos)})
+		case ast.ImportDeclarationNode:
+			for _, name := range importedNames(n) {
+				decls = append(decls, declaration{name.Local, Import, n, n.Pos, nameAt(name.LocalPos, n.Pos)})
+			}
+		case ast.BlockStatementNode:
+			for _, stmt := range n.Body {
+				visit(stmt)
+			}
+		}
+	}
+	for _, stmt := range stmts {
+		visit(stmt)
+	}
+	return decls
+}
+
+// importedNames lists the variables an import binds, as ImportNames: that
+// of a namespace import is named after itself.
+func importedNames(n ast.ImportDeclarationNode) []ast.ImportName {
+	if n.Namespace != "" {
+		return []ast.ImportName{{Name: n.Namespace, Local: n.Namespace, Pos: n.NamespacePos, LocalPos: n.NamespacePos}}
+	}
+	return n.Names
+}
+
+// nameAt returns the position of a declared name, or that of its
+// declaration for nodes the parser did not produce.
+func nameAt(name, declaration ast.Position) ast.Position {
+	if name.IsValid() {
+		return name
+	}
+	return declaration
+}
+
+// blockBody returns the statements of a block, or node itself if it is a
+// single statement.
+func blockBody(node ast.ASTNode) []ast.ASTNode {
+	if block, ok := node.(ast.BlockStatementNode); ok {
+		return block.Body
+	}
+	if node == nil {
+		return nil
+	}
+	return []ast.ASTNode{node}
+}
+
+// open starts the local scope node opens, with a slot for each
+// declaration. A name declared twice gets one slot, so the second
+// declaration fails when it runs, as it would in a scope of names.
+func (r *resolver) open(node ast.ASTNode, decls []declaration) *scope {
+	s := &scope{layout: &ast.Scope{}, bindings: map[string]*binding{}, function: r.functions}
+	s.symbols = r.scope(node)
+	r.symbolScope = s.symbols
+	for _, decl := range decls {
+		d := r.declaration(decl)
+		if _, exists := s.bindings[decl.name]; exists {
+			continue
+		}
+		s.bindings[decl.name] = &binding{slot: len(s.layout.Names), pos: decl.pos, decl: d}
+		s.layout.Names = append(s.layout.Names, decl.name)
+		s.layout.Constants = append(s.layout.Constants, d.Constant())
+	}
+	r.scopes = append(r.scopes, s)
+	return s
+}
+
+// scope records the scope node opens, inside the current one, in
+// Options.Symbols.
+func (r *resolver) scope(node ast.ASTNode) *SymbolScope {
+	s := &SymbolScope{Node: node, Parent: r.symbolScope}
+	if r.opts.Symbols != nil {
+		r.opts.Symbols.Scopes = append(r.opts.Symbols.Scopes, s)
+	}
+	return s
+}
+
+// declaration records decl in the current scope of Options.Symbols.
+func (r *resolver) declaration(decl declaration) *Declaration {
+	d := &Declaration{Name: decl.name, Pos: decl.namePos, Kind: decl.kind, Node: decl.node, Scope: r.symbolScope}
+	if r.opts.Symbols != nil {
+		r.symbolScope.Declarations = append(r.symbolScope.Declarations, d)
+		r.opts.Symbols.Declarations = append(r.opts.Symbols.Declarations, d)
+	}
+	return d
+}
+
+// close ends the innermost scope and returns its layout.
+func (r *resolver) close() *ast.Scope {
+	s := r.scopes[len(r.scopes)-1]
+	r.scopes = r.scopes[:len(r.scopes)-1]
+	r.symbolScope = s.symbols.Parent
+	return s.layout
+}
+
+// declare marks name declared in the innermost scope and returns its
+// address, or nil for a global.
+func (r *resolver) declare(name string) *ast.Address {
+	if len(r.scopes) == 0 {
+		r.globals[name].declared = true
+		return nil
+	}
+	b := r.scopes[len(r.scopes)-1].bindings[name]
+	b.declared = true
+	return &ast.Address{Slot: b.slot}
+}
+
+// reference resolves a use of name at pos, recording it in
+// Options.Symbols. Like a lookup by name, it skips the variables the
+// function it is in has not declared yet.
+func (r *resolver) reference(name string, pos ast.Position, assignment bool) *ast.Address {
+	ref := &Reference{Name: name, Pos: pos, Assignment: assignment}
+	if r.opts.Symbols != nil {
+		r.opts.Symbols.References = append(r.opts.Symbols.References, ref)
+	}
+
+	var early *binding
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		s := r.scopes[i]
+		b, ok := s.bindings[name]
+		if !ok {
+			continue
+		}
+		if b.declared || s.function < r.functions {
+			ref.Declaration = b.decl
+			return &ast.Address{Depth: len(r.scopes) - 1 - i, Slot: b.slot}
+		}
+		if early == nil {
+			early = b
+		}
+	}
+
+	if g, ok := r.globals[name]; ok && (g.declared || r.functions > 0) {
+		ref.Declaration = g.decl
+		return nil
+	} else if ok && early == nil {
+		early = g
+	}
+	if r.opts.Globals == nil || r.opts.Globals(name) {
+		return nil
+	}
+	if early != nil {
+		r.problems = append(r.problems, Problem{Kind: UsedBeforeDeclaration, Name: name, Pos: pos, Declaration: early.pos})
+	} else if !r.reported[name] {
+		r.reported[name] = true
+		r.problems = append(r.problems, Problem{Kind: Undeclared, Name: name, Pos: pos})
+	}
+	return nil
+}
+
+func (r *resolver) node(node ast.ASTNode) ast.ASTNode {
+	switch n := node.(type) {
+	case ast.IdentifierExprNode:
+		n.Addr = r.reference(n.Symbol, n.Pos, false)
+		return n
+	case ast.AssignmentExprNode:
+		n.Value = r.node(n.Value)
+		if ident, ok := n.Assignee.(ast.IdentifierExprNode); ok {
+			ident.Addr = r.reference(ident.Symbol, ident.Pos, true)
+			n.Assignee = ident
+		} else {
+			n.Assignee = r.node(n.Assignee)
+		}
+		return n
+	case ast.ObjectLiteralExprNode:
+		properties := make([]ast.PropertyNode, len(n.Properties))
+		for i, property := range n.Properties {
+			if property.Value == nil {
+				property.Addr = r.reference(property.Key, property.Pos, false)
+				if r.opts.Symbols != nil {
+					refs := r.opts.Symbols.References
+					refs[len(refs)-1].Shorthand = true
+				}
+			} else {
+				property.Value = r.node(property.Value)
+			}
+			properties[i] = property
+		}
+		n.Properties = properties
+		return n
+	case ast.VariableDeclarationNode:
+		// The value is evaluated before the variable exists
+		if n.Value != nil {
+			n.Value = r.node(n.Value)
+		}
+		n.Addr = r.declare(n.Identifier)
+		return n
+	case ast.FunctionDeclarationNode:
+		n.Addr = r.declare(n.Name)
+		return r.function(n)
+	case ast.ImportDeclarationNode:
+		// Imports are only at the top level, so they declare globals
+		for _, name := range importedNames(n) {
+			r.declare(name.Local)
+		}
+		return n
+	case ast.IfStatementNode:
+		// The condition runs in the consequent's scope
+		r.open(n, declarations(blockBody(n.Consequent)))
+		n.Condition = r.node(n.Condition)
+		n.Consequent = r.node(n.Consequent)
+		n.Scope = r.close()
+		// `else if` opens its own scope, an `else` block gets one here
+		if block, ok := n.Alternate.(ast.BlockStatementNode); ok {
+			r.open(block, declarations(block.Body))
+			n.Alternate = r.node(block)
+			n.AlternateScope = r.close()
+		} else if n.Alternate != nil {
+			n.Alternate = r.node(n.Alternate)
+		}
+		return n
+	case ast.WhileStatementNode:
+		r.open(n, declarations(blockBody(n.Body)))
+		node := ast.MapChildren(n, r.node).(ast.WhileStatementNode)
+		node.Scope = r.close()
+		return node
+	case ast.ForStatementNode:
+		var init []ast.ASTNode
+		if n.Init != nil {
+			init = []ast.ASTNode{n.Init}
+		}
+		r.open(n, append(declarations(init), declarations(blockBody(n.Body))...))
+		// The update runs after the body
+		for _, part := range []*ast.ASTNode{&n.Init, &n.Condition, &n.Body, &n.Update} {
+			if *part != nil {
+				*part = r.node(*part)
+			}
+		}
+		n.Scope = r.close()
+		return n
+	case ast.TryStatementNode:
+		r.open(n.Body, declarations(blockBody(n.Body)))
+		n.Body = r.node(n.Body)
+		n.Scope = r.close()
+
+		var decls []declaration
+		if n.Param != "" {
+			decls = append(decls, declaration{name: n.Param, kind: CatchParameter, node: n, pos: n.Pos, namePos: nameAt(n.ParamPos, n.Pos)})
+		}
+		r.open(n.Handler, append(decls, declarations(blockBody(n.Handler))...))
+		if n.Param != "" {
+			r.declare(n.Param)
+		}
+		n.Handler = r.node(n.Handler)
+		n.HandlerScope = r.close()
+		return n
+	}
+	return ast.MapChildren(node, r.node)
+}
+
+// function resolves the body of a function in a scope of its own, which
+// starts with a slot for each parameter.
+func (r *resolver) function(n ast.FunctionDeclarationNode) ast.FunctionDeclarationNode {
+	r.functions++
+	defer func() { r.functions-- }()
+
+	decls := make([]declaration, 0, len(n.Params))
+	for i, param := range n.Params {
+		namePos := n.Pos
+		if i < len(n.ParamPos) {
+			namePos = nameAt(n.ParamPos[i], n.Pos)
+		}
+		decls = append(decls, declaration{name: param, kind: Parameter, node: n, pos: n.Pos, namePos: namePos})
+	}
+	s := r.open(n, append(decls, declarations(n.Body)...))
+	for _, param := range n.Params {
+		s.bindings[param].declared = true
+	}
+
+	body := make([]ast.ASTNode, len(n.Body))
+	for i, stmt := range n.Body {
+		body[i] = r.node(stmt)
+	}
+	n.Body = body
+	n.Scope = r.close()
+	return n
+}
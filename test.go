@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	BE "pop/backend"
+	"pop/poptest"
+	"regexp"
+	"strings"
+)
+
+// runTests runs the test blocks of test files and reports how they went.
+func runTests(opts BE.Options, args []string) int {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	run := flags.String("run", "", "run only the tests whose names match this `regexp`")
+	verbose := flags.Bool("v", false, "list the tests that pass too")
+	output := flags.String("format", "text", "report as `text`, tap or junit (XML)")
+	timeout := flags.Duration("timeout", 0, "fail a test that runs longer than this, e.g. 5s (0 = no limit)")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: popcorn [flags] test [-run regexp] [-v] [-format text|tap|junit] [-timeout d] [path...]\n\nRuns the test blocks of the files given, and of the %s files in the\ndirectories given, or the current directory. Every test runs in an\ninterpreter of its own. Fails if a test fails.\n\nFlags:\n", poptest.Suffix)
+		flags.PrintDefaults()
+	}
+	// Accept the flags after the paths too
+	flags.Parse(args)
+	var paths []string
+	for flags.NArg() > 0 {
+		paths = append(paths, flags.Arg(0))
+		flags.Parse(flags.Args()[1:])
+	}
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	testOpts := poptest.Options{Interpreter: opts, Timeout: *timeout}
+	if *run != "" {
+		re, err := regexp.Compile(*run)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -run: %v\n", err)
+			return 2
+		}
+		testOpts.Run = re
+	}
+
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		found, err := poptest.Discover(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		files = append(files, found...)
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "No %s files found in %s\n", poptest.Suffix, strings.Join(paths, ", "))
+		return 1
+	}
+
+	suites := make([]poptest.Suite, len(files))
+	for i, file := range files {
+		suites[i] = poptest.RunFile(file, testOpts)
+	}
+
+	switch *output {
+	case "text":
+		poptest.WriteText(os.Stdout, suites, *verbose)
+	case "tap":
+		poptest.WriteTAP(os.Stdout, suites)
+	case "junit":
+		if err := poptest.WriteJUnit(os.Stdout, suites); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown format %q, want text, tap or junit\n", *output)
+		return 2
+	}
+
+	if _, failed, broken := poptest.Counts(suites); failed > 0 || broken > 0 {
+		return 1
+	}
+	return 0
+}
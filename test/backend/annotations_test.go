@@ -0,0 +1,73 @@
+package backend_test
+
+import (
+	BE "pop/backend"
+	FE "pop/frontend"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckTypes(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		err    string
+	}{
+		{"Variable", "let n: number = \"1\"\n", "variable 'n' must be number, got string"},
+		{"Assignment", "let n: number = 1\nn = null", "variable 'n' must be number, got null"},
+		{"Nullable", "let n: number? = 1\nn = null\nn", ""},
+		{"Argument", "fn f(a: string) {\n  pop a\n}\nf(1)", "argument 'a' of f must be string, got number"},
+		{"MissingArgument", "fn f(a: string, b: number?) {\n  pop a\n}\nf(\"x\")", ""},
+		{"Pop", "fn f(): number {\n  pop \"x\"\n}\nf()", "value popped by f must be number, got string"},
+		{"LastStatement", "fn f(): number {\n  \"x\"\n}\nf()", "value popped by f must be number, got string"},
+		{"Alias", "type Point = { x: number, y: number }\nlet p: Point = { x: 1, y: \"2\" }\n", "variable 'p' must be { x: number, y: number }, got object"},
+		{"Array", "let xs: (number | string)[] = [1, \"a\", true]\n", "variable 'xs' must be (number | string)[], got array"},
+		{"Unannotated", "let n = 1\nn = \"x\"\nn", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it, _ := newTestInterpreter(BE.Options{CheckTypes: true})
+			_, err := it.RunString(tt.source)
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var runtimeErr *BE.RuntimeError
+			require.ErrorAs(t, err, &runtimeErr)
+			assert.Equal(t, "TypeError", runtimeErr.Name)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+
+	t.Run("Off", func(t *testing.T) {
+		it, _ := newTestInterpreter(BE.Options{})
+		result, err := it.RunString("let n: number = \"1\"\nn")
+		require.NoError(t, err)
+		assert.Equal(t, str("1"), result)
+	})
+}
+
+func TestHasType(t *testing.T) {
+	tests := []struct {
+		value BE.RuntimeVal
+		t     string
+		want  bool
+	}{
+		{num(1), "number", true},
+		{num(1), "string?", false},
+		{BE.Null, "string?", true},
+		{arr(num(1), str("a")), "(number | string)[]", true},
+		{arr(num(1), BE.Null), "number[]", false},
+		{obj(map[string]BE.RuntimeVal{"x": num(1), "z": num(2)}), "{ x: number }", true},
+		{obj(map[string]BE.RuntimeVal{}), "{ x?: number }", true},
+		{obj(map[string]BE.RuntimeVal{}), "{ x: number }", false},
+		{str("a"), "Anything", true},
+	}
+	for _, tt := range tests {
+		typ, err := FE.ParseType(tt.t)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, BE.HasType(tt.value, typ), "%s: %s", BE.TypeName(tt.value), tt.t)
+	}
+}
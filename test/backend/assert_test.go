@@ -0,0 +1,57 @@
+package backend_test
+
+import (
+	BE "pop/backend"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssert(t *testing.T) {
+	it, _ := newTestInterpreter(BE.Options{})
+	_, err := it.RunString("assert(1 < 2)\nassert(true, \"holds\")\n")
+	require.NoError(t, err)
+
+	failed := runError(t, "assert(1 > 2)\n")
+	assert.Equal(t, BE.AssertionError, failed.Name)
+	assert.Equal(t, "Assertion failed", failed.Message)
+	assert.Equal(t, "two is bigger", runError(t, "assert(false, \"two is bigger\")\n").Message)
+	assert.Contains(t, runError(t, "assert()\n").Message, "assert expects a condition")
+}
+
+func TestAssertEq(t *testing.T) {
+	it, _ := newTestInterpreter(BE.Options{})
+	// Arrays, objects, maps and sets compare by content
+	_, err := it.RunString("assertEq([1, { a: [2] }], [1, { a: [2] }])\nassertEq(Map([[1, 2]]), Map([[1, 2]]))\nassertEq(Set([1, 2]), Set([2, 1]))\n")
+	require.NoError(t, err)
+
+	failed := runError(t, "assertEq(1 + 1, 3)\n")
+	assert.Equal(t, BE.AssertionError, failed.Name)
+	assert.Equal(t, "Expected 3, got 2", failed.Message)
+	assert.Equal(t, "sums", runError(t, "assertEq(1, 2, \"sums\")\n").Message)
+
+	// catch gets the values compared
+	result, err := it.RunString("let e = null\ntry {\n  assertEq([1], [2])\n} catch err {\n  e = err\n}\n[e.name, e.actual, e.expected]\n")
+	require.NoError(t, err)
+	assert.Equal(t, `["AssertionError", [1], [2]]`, BE.Inspect(result, BE.DefaultInspectOptions))
+}
+
+func TestAssertThrows(t *testing.T) {
+	it, _ := newTestInterpreter(BE.Options{})
+	// It returns what catch would get
+	result, err := it.RunString("fn fails() {\n  throw \"boom\"\n}\nassertThrows(fails, \"Error\")\n")
+	require.NoError(t, err)
+	assert.Equal(t, "boom", result.(BE.StringVal).Value)
+
+	result, err = it.RunString("fn fails2() {\n  assert(false)\n}\nlet e2 = assertThrows(fails2, \"AssertionError\")\ne2.name\n")
+	require.NoError(t, err)
+	assert.Equal(t, BE.AssertionError, result.(BE.StringVal).Value)
+
+	failed := runError(t, "fn ok() {\n  pop 1\n}\nassertThrows(ok)\n")
+	assert.Equal(t, BE.AssertionError, failed.Name)
+	assert.Equal(t, "Expected the function to throw", failed.Message)
+	assert.Equal(t, "Expected the function to throw a TypeError, got Error: boom",
+		runError(t, "fn fails() {\n  throw \"boom\"\n}\nassertThrows(fails, \"TypeError\")\n").Message)
+	assert.Contains(t, runError(t, "assertThrows(1)\n").Message, "assertThrows expects a function")
+}
@@ -0,0 +1,44 @@
+package backend_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIfElse(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   float64
+	}{
+		{"Then", "let r = 0\nif 1 < 2 {\n  r = 1\n} else {\n  r = 2\n}\nr", 1},
+		{"Else", "let r = 0\nif 1 > 2 {\n  r = 1\n} else {\n  r = 2\n}\nr", 2},
+		{"ElseIf", "let r = 0\nif 1 > 2 {\n  r = 1\n} else if 2 > 1 {\n  r = 3\n} else {\n  r = 2\n}\nr", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, num(tt.want), evalSource(t, tt.source))
+		})
+	}
+}
+
+func TestPopLeavesBlocks(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   float64
+	}{
+		{"If", "fn f() {\n  if 1 < 2 {\n    pop 1\n  }\n  pop 2\n}\nf()", 1},
+		{"Else", "fn f() {\n  if 1 > 2 {\n    pop 1\n  } else {\n    pop 3\n  }\n  pop 2\n}\nf()", 3},
+		{"For", "fn f() {\n  for (let i = 0; i < 3; i = i + 1) {\n    if i == 1 {\n      pop i\n    }\n  }\n  pop 9\n}\nf()", 1},
+		{"While", "fn f() {\n  let i = 0\n  while i < 3 {\n    i = i + 1\n    pop i\n  }\n  pop 9\n}\nf()", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, num(tt.want), evalSource(t, tt.source))
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package backend_test
+
+import (
+	BE "pop/backend"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInspect(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"Number", "20", "20"},
+		{"String", "\"Al\"", "\"Al\""},
+		{"Null", "null", "null"},
+		{"Array", "[1, 2, \"x\"]", "[1, 2, \"x\"]"},
+		{"EmptyArray", "[]", "[]"},
+		{"Object", "{ name: \"Al\", age: 30 }", "{ age: 30, name: \"Al\" }"},
+		{"Function", "fn add(a, b) {\n  a + b\n}", "<fn add(a, b)>"},
+		{"NativeFunction", "sort", "<native fn sort>"},
+		{"Map", "let m = Map()\nm.set([1], \"one\")", "Map { [1] => \"one\" }"},
+		{"Set", "Set([1, 2, 1])", "Set { 1, 2 }"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := evalSource(t, tt.source)
+			assert.Equal(t, tt.want, BE.Inspect(result, BE.DefaultInspectOptions))
+			assert.Equal(t, tt.want, result.(interface{ String() string }).String())
+		})
+	}
+}
+
+func TestInspectLimits(t *testing.T) {
+	nested := arr(arr(arr(num(1))))
+	long := arr(num(1), num(2), num(3), num(4))
+
+	t.Run("MaxDepth", func(t *testing.T) {
+		opts := BE.DefaultInspectOptions
+		opts.MaxDepth = 1
+		assert.Equal(t, "[[[Array]]]", BE.Inspect(nested, opts))
+	})
+
+	t.Run("MaxItems", func(t *testing.T) {
+		opts := BE.DefaultInspectOptions
+		opts.MaxItems = 2
+		assert.Equal(t, "[1, 2, ... 2 more items]", BE.Inspect(long, opts))
+	})
+
+	t.Run("Width", func(t *testing.T) {
+		opts := BE.DefaultInspectOptions
+		opts.Width = 8
+		assert.Equal(t, "[\n  1,\n  2,\n  3,\n  4\n]", BE.Inspect(long, opts))
+	})
+
+	t.Run("Cycle", func(t *testing.T) {
+		o := obj(map[string]BE.RuntimeVal{"n": num(1)})
+		o.Properties["self"] = o
+		assert.Equal(t, "{ n: 1, self: [Circular] }", BE.Inspect(o, BE.DefaultInspectOptions))
+	})
+
+	t.Run("Color", func(t *testing.T) {
+		opts := BE.DefaultInspectOptions
+		opts.Color = true
+		assert.Equal(t, "[\033[1;33m1\033[0m]", BE.Inspect(arr(num(1)), opts))
+	})
+}
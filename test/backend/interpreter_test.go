@@ -0,0 +1,167 @@
+package backend_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	BE "pop/backend"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryResolver serves files from a map instead of the filesystem.
+type memoryResolver map[string]string
+
+func (m memoryResolver) Resolve(from, specifier string) (string, error) {
+	return specifier, nil
+}
+
+func (m memoryResolver) Load(path string) ([]byte, error) {
+	source, ok := m[path]
+	if !ok {
+		return nil, fmt.Errorf("no such module: %s", path)
+	}
+	return []byte(source), nil
+}
+
+func newTestInterpreter(opts BE.Options) (*BE.Interpreter, *bytes.Buffer) {
+	var stdout bytes.Buffer
+	opts.Stdout = &stdout
+	return BE.NewInterpreter(opts), &stdout
+}
+
+func TestInterpreter(t *testing.T) {
+	t.Run("GlobalsPersistAcrossRuns", func(t *testing.T) {
+		it, _ := newTestInterpreter(BE.Options{})
+
+		_, err := it.RunString("let x = 10\n")
+		require.NoError(t, err)
+
+		result, err := it.RunString("x * 2")
+		require.NoError(t, err)
+		assert.Equal(t, num(20), result)
+	})
+
+	t.Run("Call", func(t *testing.T) {
+		it, _ := newTestInterpreter(BE.Options{})
+
+		_, err := it.RunString("fn add(a, b) {\n  a + b\n}\n")
+		require.NoError(t, err)
+
+		result, err := it.Call("add", num(2), num(3))
+		require.NoError(t, err)
+		assert.Equal(t, num(5), result)
+
+		_, err = it.Call("missing")
+		assert.ErrorContains(t, err, "Cannot resolve variable 'missing'")
+	})
+
+	t.Run("BuiltinsCanBeShadowed", func(t *testing.T) {
+		names := []string{"print", "sort", "Map", "Set", "assert", "assertEq", "assertThrows", "fs", "env", "clock", "random", "process", "net"}
+		for _, name := range names {
+			it, _ := newTestInterpreter(BE.Options{})
+
+			result, err := it.RunString("let " + name + " = \"mine\"\n" + name)
+			require.NoError(t, err, name)
+			assert.Equal(t, str("mine"), result, name)
+
+			// A fresh interpreter still gets the built-in
+			builtin, err := BE.NewInterpreter(BE.Options{}).RunString(name)
+			require.NoError(t, err, name)
+			assert.NotEqual(t, str("mine"), builtin, name)
+		}
+
+		it, _ := newTestInterpreter(BE.Options{})
+		_, err := it.RunString("sort = 1")
+		assert.ErrorContains(t, err, "Cannot reassign constant variable 'sort'")
+	})
+
+	t.Run("PrintWritesToStdout", func(t *testing.T) {
+		it, stdout := newTestInterpreter(BE.Options{})
+
+		_, err := it.RunString("print(\"total\", [1, 2])")
+		require.NoError(t, err)
+		assert.Equal(t, "total [1, 2]\n", stdout.String())
+	})
+
+	t.Run("SyntaxErrorIsReturned", func(t *testing.T) {
+		it, _ := newTestInterpreter(BE.Options{})
+
+		_, err := it.RunString("let = 5\n")
+		assert.ErrorContains(t, err, "Expected identifier name")
+	})
+
+	t.Run("RuntimeErrorIsReturned", func(t *testing.T) {
+		it, _ := newTestInterpreter(BE.Options{})
+
+		_, err := it.RunString("const x = 1\nx = 2")
+		var runtimeErr *BE.RuntimeError
+		require.ErrorAs(t, err, &runtimeErr)
+		assert.Contains(t, runtimeErr.Message, "Cannot reassign constant variable 'x'")
+
+		// The interpreter stays usable after an error
+		result, err := it.RunString("x")
+		require.NoError(t, err)
+		assert.Equal(t, num(1), result)
+	})
+
+	t.Run("GoPanicIsReturned", func(t *testing.T) {
+		it, _ := newTestInterpreter(BE.Options{})
+		var missing map[string]int
+		require.NoError(t, it.SetGlobal("crash", &BE.NativeFunctionVal{
+			Name: "crash",
+			Call: func(args []BE.RuntimeVal, env *BE.Environment) BE.RuntimeVal {
+				missing["x"] = 1
+				return BE.Null
+			},
+		}))
+
+		// A bug in a native fails the run, and catch cannot hide it
+		_, err := it.RunString("try {\n  crash()\n} catch {\n}\n")
+		var runtimeErr *BE.RuntimeError
+		require.ErrorAs(t, err, &runtimeErr)
+		assert.True(t, runtimeErr.Fatal)
+		assert.Contains(t, runtimeErr.Message, "nil map")
+
+		_, err = it.RunString("5 % 0")
+		assert.ErrorContains(t, err, "Cannot take the remainder of a division by zero")
+	})
+
+	t.Run("RunFileUsesResolver", func(t *testing.T) {
+		it, _ := newTestInterpreter(BE.Options{
+			Resolver: memoryResolver{"main.pop": "let a = 40\na + 2"},
+		})
+
+		result, err := it.RunFile("main.pop")
+		require.NoError(t, err)
+		assert.Equal(t, num(42), result)
+
+		_, err = it.RunFile("other.pop")
+		assert.ErrorContains(t, err, "failed to read file")
+	})
+
+	t.Run("DumpAST", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "ast.json")
+		it, _ := newTestInterpreter(BE.Options{DumpAST: path})
+
+		_, err := it.RunString("let a = 1\n")
+		require.NoError(t, err)
+
+		dump, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Contains(t, string(dump), `"kind":"VariableDeclaration"`)
+	})
+
+	t.Run("Limits", func(t *testing.T) {
+		it, _ := newTestInterpreter(BE.Options{Limits: BE.Limits{MaxSteps: 1000}})
+		_, err := it.RunString("while true {\n}")
+		assert.ErrorContains(t, err, "Step limit of 1000 exceeded")
+
+		it, _ = newTestInterpreter(BE.Options{Limits: BE.Limits{MaxCallDepth: 50}})
+		_, err = it.RunString("fn f() {\n  f()\n}\nf()")
+		assert.ErrorContains(t, err, "Stack overflow: maximum call depth of 50 exceeded in 'f'")
+	})
+}
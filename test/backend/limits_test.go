@@ -0,0 +1,171 @@
+package backend_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	BE "pop/backend"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const recurseForever = "fn f() {\n  f()\n}\n"
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   BE.RuntimeVal
+	}{
+		{"ThrownValue", "let r = 0\ntry {\n  throw 42\n} catch err {\n  r = err\n}\nr", num(42)},
+		{"RuntimeError", "let r = 0\ntry {\n  missing\n} catch err {\n  r = err.name\n}\nr", str("Error")},
+		{"BareCatch", "let r = 0\ntry {\n  throw \"boom\"\n} catch {\n  r = 1\n}\nr", num(1)},
+		{"NoError", "let r = 0\ntry {\n  r = 1\n} catch {\n  r = 2\n}\nr", num(1)},
+		{"PopFromTry", "fn f() {\n  try {\n    pop 1\n  } catch {\n  }\n  pop 2\n}\nf()", num(1)},
+		{"PopFromCatch", "fn f() {\n  try {\n    throw 1\n  } catch {\n    pop 2\n  }\n  pop 3\n}\nf()", num(2)},
+		{"CatchScope", "let err = 1\ntry {\n  throw 2\n} catch err {\n}\nerr", num(1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, evalSource(t, tt.source))
+		})
+	}
+
+	t.Run("Uncaught", func(t *testing.T) {
+		it, _ := newTestInterpreter(BE.Options{})
+		_, err := it.RunString("throw { name: \"ValidationError\", message: \"bad\" }")
+
+		var runtimeErr *BE.RuntimeError
+		require.ErrorAs(t, err, &runtimeErr)
+		assert.Equal(t, "bad", runtimeErr.Message)
+		assert.Equal(t, "ValidationError", runtimeErr.Name)
+	})
+}
+
+func TestCallDepth(t *testing.T) {
+	t.Run("StackOverflowIsCatchable", func(t *testing.T) {
+		it, _ := newTestInterpreter(BE.Options{Limits: BE.Limits{MaxCallDepth: 100}})
+		result, err := it.RunString(recurseForever + "let r = null\ntry {\n  f()\n} catch err {\n  r = err.name\n}\nr")
+		require.NoError(t, err)
+		assert.Equal(t, str("StackOverflowError"), result)
+
+		// The depth unwinds with the stack, so calls work again afterwards
+		result, err = it.RunString("fn g(n) {\n  if n > 0 {\n    pop g(n - 1)\n  }\n  pop n\n}\ng(90)")
+		require.NoError(t, err)
+		assert.Equal(t, num(0), result)
+	})
+
+	t.Run("DepthIsClamped", func(t *testing.T) {
+		it, _ := newTestInterpreter(BE.Options{Limits: BE.Limits{MaxCallDepth: 1 << 40}})
+		assert.Equal(t, BE.MaxTreeWalkerCallDepth, it.MaxCallDepth())
+		if testing.Short() {
+			t.Skip("recursing to the ceiling takes a few hundred MB of stack")
+		}
+
+		// Without the clamp this is a fatal Go stack overflow
+		_, err := it.RunString(recurseForever + "f()")
+		assert.ErrorContains(t, err, fmt.Sprintf("maximum call depth of %d exceeded", BE.MaxTreeWalkerCallDepth))
+	})
+
+	t.Run("DefaultDepth", func(t *testing.T) {
+		it, _ := newTestInterpreter(BE.Options{})
+		_, err := it.RunString(recurseForever + "f()")
+		assert.ErrorContains(t, err, "maximum call depth of 10000 exceeded")
+	})
+}
+
+func TestAllocationLimits(t *testing.T) {
+	t.Run("ArrayLength", func(t *testing.T) {
+		it, _ := newTestInterpreter(BE.Options{Limits: BE.Limits{MaxArrayLength: 3}})
+		_, err := it.RunString("[1, 2, 3, 4]")
+		assert.ErrorContains(t, err, "Array length 4 exceeds the limit of 3")
+
+		result, err := it.RunString("let s = Set([1, 2, 3])\nlet r = null\ntry {\n  s.add(4)\n} catch err {\n  r = err.name\n}\nr")
+		require.NoError(t, err)
+		assert.Equal(t, str("RangeError"), result)
+	})
+
+	t.Run("StringLength", func(t *testing.T) {
+		it, _ := newTestInterpreter(BE.Options{Limits: BE.Limits{MaxStringLength: 4}})
+		_, err := it.RunString("\"popcorn\"")
+		assert.ErrorContains(t, err, "String length 7 exceeds the limit of 4")
+	})
+
+	t.Run("MemoryIsNotCatchable", func(t *testing.T) {
+		it, _ := newTestInterpreter(BE.Options{Limits: BE.Limits{MaxMemory: 10_000}})
+		_, err := it.RunString("let all = Map()\nlet i = 0\ntry {\n  while true {\n    all.set(i, [i, i, i])\n    i = i + 1\n  }\n} catch {\n}")
+
+		var runtimeErr *BE.RuntimeError
+		require.ErrorAs(t, err, &runtimeErr)
+		assert.Equal(t, "MemoryLimitError", runtimeErr.Name)
+		assert.True(t, runtimeErr.Fatal)
+	})
+
+	t.Run("StepsAreNotCatchable", func(t *testing.T) {
+		it, _ := newTestInterpreter(BE.Options{Limits: BE.Limits{MaxSteps: 500}})
+		_, err := it.RunString("try {\n  while true {\n  }\n} catch {\n}")
+		assert.ErrorContains(t, err, "Step limit of 500 exceeded")
+	})
+}
+
+func TestReadLimits(t *testing.T) {
+	t.Run("File", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "big.txt")
+		require.NoError(t, os.WriteFile(path, bytes.Repeat([]byte("x"), 1<<20), 0o644))
+		it, _ := newTestInterpreter(BE.Options{
+			Permissions: BE.Permissions{Read: BE.Grant{Allow: []string{path}}},
+			Limits:      BE.Limits{MaxStringLength: 4},
+		})
+		require.NoError(t, it.SetGlobal("target", str(path)))
+		_, err := it.RunString("fs.read(target)")
+		assert.ErrorContains(t, err, "String length 1048576 exceeds the limit of 4")
+	})
+
+	t.Run("Body", func(t *testing.T) {
+		// The body has no length and does not end, so only the limit stops it
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			chunk := []byte(strings.Repeat("x", 1024))
+			for {
+				if _, err := w.Write(chunk); err != nil {
+					return
+				}
+				w.(http.Flusher).Flush()
+			}
+		}))
+		defer server.Close()
+
+		it, _ := newTestInterpreter(BE.Options{
+			Permissions: BE.Permissions{Net: BE.Grant{Allow: []string{strings.TrimPrefix(server.URL, "http://")}}},
+			Limits:      BE.Limits{MaxMemory: 10_000},
+		})
+		require.NoError(t, it.SetGlobal("target", str(server.URL)))
+		_, err := it.RunString("net.fetch(target)")
+		assert.ErrorContains(t, err, "Memory limit of 10000 bytes exceeded")
+	})
+}
+
+func TestContextCancellation(t *testing.T) {
+	it, _ := newTestInterpreter(BE.Options{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := it.RunStringContext(ctx, "try {\n  while true {\n  }\n} catch {\n}")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "got %v", err)
+	assert.ErrorContains(t, err, "Execution cancelled")
+
+	// A later run gets a fresh context
+	result, err := it.RunString("1 + 1")
+	require.NoError(t, err)
+	assert.Equal(t, num(2), result)
+}
@@ -0,0 +1,225 @@
+package backend_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	BE "pop/backend"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var utilModule = `print("loading util")
+export let count = 1
+export fn double(x) {
+  x * 2
+}
+let hidden = 3
+`
+
+func runModules(t *testing.T, modules BE.MapResolver, source string) (BE.RuntimeVal, string, error) {
+	t.Helper()
+	it, stdout := newTestInterpreter(BE.Options{Resolver: modules})
+	result, err := it.RunString(source)
+	return result, stdout.String(), err
+}
+
+func importError(t *testing.T, err error) *BE.RuntimeError {
+	t.Helper()
+	var runtimeErr *BE.RuntimeError
+	require.True(t, errors.As(err, &runtimeErr), "got %v", err)
+	assert.Equal(t, "ImportError", runtimeErr.Name)
+	return runtimeErr
+}
+
+func TestImport(t *testing.T) {
+	t.Run("Names", func(t *testing.T) {
+		result, _, err := runModules(t, BE.MapResolver{"util.pop": utilModule},
+			"import { double, count as c } from \"./util.pop\"\ndouble(c + 1)")
+		require.NoError(t, err)
+		assert.Equal(t, num(4), result)
+	})
+
+	t.Run("Namespace", func(t *testing.T) {
+		result, _, err := runModules(t, BE.MapResolver{"util.pop": utilModule},
+			"import * as util from \"util.pop\"\n[util.double(util.count), util.hidden]")
+		require.NoError(t, err)
+		assert.Equal(t, "[2, null]", BE.Inspect(result, BE.DefaultInspectOptions))
+	})
+
+	t.Run("RunsOnce", func(t *testing.T) {
+		modules := BE.MapResolver{"util.pop": utilModule, "other.pop": "import { count } from \"./util.pop\"\nexport let again = count\n"}
+		it, stdout := newTestInterpreter(BE.Options{Resolver: modules})
+		_, err := it.RunString("import * as a from \"util.pop\"\nimport { again } from \"other.pop\"\n")
+		require.NoError(t, err)
+		_, err = it.RunString("import * as b from \"util.pop\"\n")
+		require.NoError(t, err)
+		assert.Equal(t, "loading util\n", stdout.String())
+	})
+
+	t.Run("OwnEnvironment", func(t *testing.T) {
+		modules := BE.MapResolver{
+			"a.pop": "let shared = \"a\"\nexport fn get() {\n  shared\n}\n",
+			"b.pop": "export fn peek() {\n  shared\n}\n",
+		}
+		result, _, err := runModules(t, modules, "let shared = \"main\"\nimport { get } from \"a.pop\"\n[get(), shared]")
+		require.NoError(t, err)
+		assert.Equal(t, `["a", "main"]`, BE.Inspect(result, BE.DefaultInspectOptions))
+
+		_, _, err = runModules(t, modules, "let shared = \"main\"\nimport { peek } from \"b.pop\"\npeek()")
+		assert.ErrorContains(t, err, "shared")
+	})
+
+	t.Run("HostGlobals", func(t *testing.T) {
+		it, _ := newTestInterpreter(BE.Options{Resolver: BE.MapResolver{"m.pop": "export let seen = answer\n"}})
+		require.NoError(t, it.SetGlobal("answer", num(42)))
+		result, err := it.RunString("import { seen } from \"m.pop\"\nseen")
+		require.NoError(t, err)
+		assert.Equal(t, num(42), result)
+	})
+
+	t.Run("ImportsAreConstant", func(t *testing.T) {
+		_, _, err := runModules(t, BE.MapResolver{"util.pop": utilModule}, "import { count } from \"util.pop\"\ncount = 2")
+		assert.ErrorContains(t, err, "count")
+	})
+
+	t.Run("MissingExport", func(t *testing.T) {
+		_, _, err := runModules(t, BE.MapResolver{"util.pop": utilModule}, "import { hidden } from \"util.pop\"\n")
+		runtimeErr := importError(t, err)
+		assert.Equal(t, "Module 'util.pop' has no export 'hidden'", runtimeErr.Message)
+	})
+
+	t.Run("MissingModule", func(t *testing.T) {
+		_, _, err := runModules(t, BE.MapResolver{}, "import * as m from \"nope.pop\"\n")
+		runtimeErr := importError(t, err)
+		assert.Contains(t, runtimeErr.Message, "Cannot load module 'nope.pop'")
+	})
+
+	t.Run("SyntaxError", func(t *testing.T) {
+		_, _, err := runModules(t, BE.MapResolver{"bad.pop": "let = 1\n"}, "import * as m from \"bad.pop\"\n")
+		runtimeErr := importError(t, err)
+		assert.Contains(t, runtimeErr.Message, "bad.pop: ")
+	})
+
+	t.Run("Cycle", func(t *testing.T) {
+		modules := BE.MapResolver{
+			"a.pop": "import { b } from \"./b.pop\"\nexport let a = 1\n",
+			"b.pop": "import { a } from \"./a.pop\"\nexport let b = 2\n",
+		}
+		_, _, err := runModules(t, modules, "import { a } from \"a.pop\"\n")
+		runtimeErr := importError(t, err)
+		assert.Equal(t, "Import cycle: a.pop -> b.pop -> a.pop", runtimeErr.Message)
+		assert.Equal(t, `Traceback (most recent call last):
+  File "<input>", line 1, in <module>
+    import { a } from "a.pop"
+  File "a.pop", line 1, in <module>
+    import { b } from "./b.pop"
+  File "b.pop", line 1, in <module>
+    import { a } from "./a.pop"
+ImportError: Import cycle: a.pop -> b.pop -> a.pop`, runtimeErr.Traceback())
+	})
+
+	t.Run("ErrorInModule", func(t *testing.T) {
+		modules := BE.MapResolver{"boom.pop": "export fn f() {\n  null()\n}\nf()\n"}
+		_, _, err := runModules(t, modules, "import { f } from \"boom.pop\"\n")
+		var runtimeErr *BE.RuntimeError
+		require.True(t, errors.As(err, &runtimeErr))
+		assert.Contains(t, runtimeErr.Traceback(), "File \"boom.pop\", line 4, in <module>")
+		assert.Contains(t, runtimeErr.Traceback(), "File \"boom.pop\", line 2, in f()")
+	})
+
+	t.Run("RelativeFiles", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "lib"), 0o755))
+		files := map[string]string{
+			"main.pop":     "import { twice } from \"./lib/a.pop\"\ntwice(21)",
+			"lib/a.pop":    "import { double } from \"./b.pop\"\nexport fn twice(x) {\n  double(x)\n}\n",
+			"lib/b.pop":    "export fn double(x) {\n  x * 2\n}\n",
+			"lib/loop.pop": "import * as main from \"../loop.pop\"\n",
+			"loop.pop":     "import * as lib from \"./lib/loop.pop\"\n",
+		}
+		for name, source := range files {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(source), 0o644))
+		}
+		it, _ := newTestInterpreter(BE.Options{})
+
+		result, err := it.RunFile(filepath.Join(dir, "main.pop"))
+		require.NoError(t, err)
+		assert.Equal(t, num(42), result)
+
+		// The entry file is part of the cycle
+		_, err = it.RunFile(filepath.Join(dir, "loop.pop"))
+		runtimeErr := importError(t, err)
+		assert.Contains(t, runtimeErr.Message, "loop.pop -> ")
+	})
+
+	t.Run("FilesOutsideTheProjectNeedRead", func(t *testing.T) {
+		root := t.TempDir()
+		project, outside := filepath.Join(root, "project"), filepath.Join(root, "outside")
+		require.NoError(t, os.MkdirAll(project, 0o755))
+		require.NoError(t, os.MkdirAll(outside, 0o755))
+		secret := filepath.Join(outside, "secret.txt")
+		require.NoError(t, os.WriteFile(secret, []byte("password=\"hunter2\n"), 0o644))
+		main := filepath.Join(project, "main.pop")
+		require.NoError(t, os.WriteFile(main, []byte("import * as s from \"../outside/secret.txt\"\n"), 0o644))
+
+		it, _ := newTestInterpreter(BE.Options{})
+		_, err := it.RunFile(main)
+		var runtimeErr *BE.RuntimeError
+		require.True(t, errors.As(err, &runtimeErr), "got %v", err)
+		assert.Equal(t, "PermissionError", runtimeErr.Name)
+		assert.NotContains(t, err.Error(), "hunter2")
+
+		// A manifest makes its directory the project
+		require.NoError(t, os.WriteFile(filepath.Join(root, "popcorn.json"), []byte("{}"), 0o644))
+		it, _ = newTestInterpreter(BE.Options{})
+		_, err = it.RunFile(main)
+		importError(t, err)
+		require.NoError(t, os.Remove(filepath.Join(root, "popcorn.json")))
+
+		// With the grant the file is read, and its syntax error does not
+		// repeat it either
+		it, _ = newTestInterpreter(BE.Options{Permissions: BE.Permissions{Read: BE.Grant{Allow: []string{outside}}}})
+		_, err = it.RunFile(main)
+		importError(t, err)
+		assert.NotContains(t, err.Error(), "hunter2")
+	})
+
+	t.Run("FSResolver", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"scripts/util.pop": {Data: []byte(utilModule)},
+			"scripts/main.pop": {Data: []byte("import { double } from \"util.pop\"\ndouble(5)")},
+		}
+		it, _ := newTestInterpreter(BE.Options{Resolver: BE.FSResolver{FS: fsys}})
+		result, err := it.RunFile("scripts/main.pop")
+		require.NoError(t, err)
+		assert.Equal(t, num(10), result)
+	})
+}
+
+func TestImportNotTopLevel(t *testing.T) {
+	_, _, err := runModules(t, BE.MapResolver{}, "if true {\n  import * as m from \"m.pop\"\n}\n")
+	assert.ErrorContains(t, err, "Imports are only allowed at the top level of a module")
+}
+
+func TestMapResolver(t *testing.T) {
+	m := BE.MapResolver{}
+	cases := []struct{ from, specifier, want string }{
+		{"", "main.pop", "main.pop"},
+		{"", "./lib/a.pop", "lib/a.pop"},
+		{"lib/a.pop", "./b.pop", "lib/b.pop"},
+		{"lib/a.pop", "../b.pop", "b.pop"},
+		{"lib/a.pop", "/c.pop", "c.pop"},
+	}
+	for _, c := range cases {
+		got, err := m.Resolve(c.from, c.specifier)
+		require.NoError(t, err)
+		assert.Equal(t, c.want, got, "%s from %s", c.specifier, c.from)
+	}
+
+	_, err := m.Resolve("a.pop", "../outside.pop")
+	assert.Error(t, err)
+}
@@ -0,0 +1,182 @@
+package backend_test
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	BE "pop/backend"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runSandboxed runs source with the given permissions, with target bound to
+// the global `target` so scripts do not need to spell out temp paths.
+func runSandboxed(t *testing.T, perms BE.Permissions, target string, source string) (BE.RuntimeVal, error) {
+	t.Helper()
+	it, _ := newTestInterpreter(BE.Options{Permissions: perms})
+	require.NoError(t, it.SetGlobal("target", str(target)))
+	return it.RunString(source)
+}
+
+func TestPermissionsDenyByDefault(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"Read", "fs.read(\"data.txt\")", "Permission denied: read access to 'data.txt' (run with --allow-read=data.txt)"},
+		{"Write", "fs.write(\"out.txt\", \"x\")", "Permission denied: write access to 'out.txt'"},
+		{"Env", "env.get(\"HOME\")", "Permission denied: env access to 'HOME'"},
+		{"Clock", "clock.now()", "Permission denied: clock access (run with --allow-clock)"},
+		{"Random", "random.float()", "Permission denied: random access (run with --allow-random)"},
+		{"Run", "process.run(\"echo\", [])", "Permission denied: run access to 'echo'"},
+		{"Net", "net.fetch(\"http://example.com/\")", "Permission denied: net access to 'example.com'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := runSandboxed(t, BE.Permissions{}, "", tt.source)
+
+			var runtimeErr *BE.RuntimeError
+			require.ErrorAs(t, err, &runtimeErr)
+			assert.Equal(t, "PermissionError", runtimeErr.Name)
+			assert.Contains(t, runtimeErr.Message, tt.want)
+		})
+	}
+
+	t.Run("Catchable", func(t *testing.T) {
+		result, err := runSandboxed(t, BE.Permissions{}, "", "let r = null\ntry {\n  clock.now()\n} catch err {\n  r = err.name\n}\nr")
+		require.NoError(t, err)
+		assert.Equal(t, str("PermissionError"), result)
+	})
+}
+
+func TestFilesystemGrants(t *testing.T) {
+	root := t.TempDir()
+	data := filepath.Join(root, "data")
+	require.NoError(t, os.Mkdir(data, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(data, "in.txt"), []byte("hello world"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "secret.txt"), []byte("secret"), 0o644))
+	require.NoError(t, os.Symlink(filepath.Join(root, "secret.txt"), filepath.Join(data, "link.txt")))
+
+	perms := BE.Permissions{
+		Read:  BE.Grant{Allow: []string{data}},
+		Write: BE.Grant{Allow: []string{filepath.Join(data, "out")}},
+	}
+
+	t.Run("ReadInsideGrant", func(t *testing.T) {
+		result, err := runSandboxed(t, perms, filepath.Join(data, "in.txt"), "fs.read(target)")
+		require.NoError(t, err)
+		assert.Equal(t, str("hello world"), result)
+	})
+
+	for name, path := range map[string]string{
+		"Sibling":       filepath.Join(root, "secret.txt"),
+		"DotDot":        filepath.Join(data, "..", "secret.txt"),
+		"SymlinkEscape": filepath.Join(data, "link.txt"),
+	} {
+		t.Run("Deny"+name, func(t *testing.T) {
+			_, err := runSandboxed(t, perms, path, "fs.read(target)")
+			assert.ErrorContains(t, err, "Permission denied: read access")
+		})
+	}
+
+	t.Run("List", func(t *testing.T) {
+		result, err := runSandboxed(t, perms, data, "fs.list(target)")
+		require.NoError(t, err)
+		assert.Equal(t, arr(str("in.txt"), str("link.txt")), result)
+	})
+
+	t.Run("WriteNewFile", func(t *testing.T) {
+		out := filepath.Join(data, "out", "result.txt")
+		require.NoError(t, os.Mkdir(filepath.Dir(out), 0o755))
+
+		_, err := runSandboxed(t, perms, out, "fs.write(target, \"done\\n\")")
+		require.NoError(t, err)
+		written, err := os.ReadFile(out)
+		require.NoError(t, err)
+		assert.Equal(t, "done\n", string(written))
+
+		_, err = runSandboxed(t, perms, filepath.Join(data, "other.txt"), "fs.write(target, \"x\")")
+		assert.ErrorContains(t, err, "Permission denied: write access")
+	})
+}
+
+func TestHostGrants(t *testing.T) {
+	t.Run("Env", func(t *testing.T) {
+		t.Setenv("POPCORN_TOKEN", "abc")
+		perms := BE.Permissions{Env: BE.Grant{Allow: []string{"POPCORN_TOKEN"}}}
+
+		result, err := runSandboxed(t, perms, "", "env.get(\"POPCORN_TOKEN\")")
+		require.NoError(t, err)
+		assert.Equal(t, str("abc"), result)
+
+		_, err = runSandboxed(t, perms, "", "env.get(\"HOME\")")
+		assert.ErrorContains(t, err, "Permission denied: env access to 'HOME'")
+	})
+
+	t.Run("ClockAndRandom", func(t *testing.T) {
+		perms := BE.Permissions{Clock: true, Random: true}
+		result, err := runSandboxed(t, perms, "", "clock.now() > 0 && random.int(3) < 3")
+		require.NoError(t, err)
+		assert.Equal(t, BE.BoolValue{Value: true}, result)
+	})
+
+	t.Run("Run", func(t *testing.T) {
+		perms := BE.Permissions{Run: BE.Grant{Allow: []string{"echo"}}}
+		result, err := runSandboxed(t, perms, "", "let out = process.run(\"echo\", [\"hi there\"])\nout.stdout")
+		require.NoError(t, err)
+		assert.Equal(t, str("hi there\n"), result)
+
+		_, err = runSandboxed(t, perms, "", "process.run(\"sh\", [])")
+		assert.ErrorContains(t, err, "Permission denied: run access to 'sh'")
+	})
+
+	t.Run("Net", func(t *testing.T) {
+		other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "other")
+		}))
+		defer other.Close()
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/away" {
+				http.Redirect(w, r, other.URL, http.StatusFound)
+				return
+			}
+			fmt.Fprint(w, "pong")
+		}))
+		defer server.Close()
+
+		host := strings.TrimPrefix(server.URL, "http://")
+		perms := BE.Permissions{Net: BE.Grant{Allow: []string{host}}}
+
+		result, err := runSandboxed(t, perms, server.URL+"/ping", "let res = net.fetch(target)\n[res.status, res.body]")
+		require.NoError(t, err)
+		assert.Equal(t, arr(num(200), str("pong")), result)
+
+		_, err = runSandboxed(t, perms, other.URL, "net.fetch(target)")
+		assert.ErrorContains(t, err, "Permission denied: net access")
+
+		_, err = runSandboxed(t, perms, server.URL+"/away", "net.fetch(target)")
+		assert.ErrorContains(t, err, "Permission denied: net access to '"+strings.TrimPrefix(other.URL, "http://")+"'")
+	})
+}
+
+func TestGrantFlag(t *testing.T) {
+	var perms BE.Permissions
+	flags := flag.NewFlagSet("popcorn", flag.ContinueOnError)
+	flags.Var(&perms.Read, "allow-read", "")
+	flags.Var(&perms.Env, "allow-env", "")
+
+	require.NoError(t, flags.Parse([]string{"--allow-read", "--allow-env=HOME,USER"}))
+	assert.Equal(t, BE.Grant{All: true}, perms.Read)
+	assert.Equal(t, BE.Grant{Allow: []string{"HOME", "USER"}}, perms.Env)
+	assert.True(t, perms.Allows(BE.CapRead, "/anything"))
+	assert.True(t, perms.Allows(BE.CapEnv, "USER"))
+	assert.False(t, perms.Allows(BE.CapEnv, "PATH"))
+}
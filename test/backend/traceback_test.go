@@ -0,0 +1,92 @@
+package backend_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	BE "pop/backend"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runError runs source and returns the RuntimeError it fails with.
+func runError(t *testing.T, source string) *BE.RuntimeError {
+	t.Helper()
+	it, _ := newTestInterpreter(BE.Options{})
+	_, err := it.RunString(source)
+
+	var runtimeErr *BE.RuntimeError
+	require.True(t, errors.As(err, &runtimeErr), "expected a RuntimeError, got %v", err)
+	return runtimeErr
+}
+
+func TestTraceback(t *testing.T) {
+	t.Run("Frames", func(t *testing.T) {
+		source := "fn divide(a, b) {\n  if b == 0 {\n    throw \"cannot divide by zero\"\n  }\n  pop a / b\n}\n\nfn run(xs) {\n  pop divide(xs[0], xs[1])\n}\n\nrun([1, 0])\n"
+		err := runError(t, source)
+
+		require.Len(t, err.Trace, 3)
+		assert.Equal(t, "<module>", err.Trace[0].Name)
+		assert.Equal(t, 12, err.Trace[0].Line)
+		assert.Equal(t, "run", err.Trace[1].Name)
+		assert.Equal(t, 9, err.Trace[1].Line)
+		assert.Equal(t, "divide", err.Trace[2].Name)
+		assert.Equal(t, []string{"a", "b"}, err.Trace[2].Params)
+		assert.Equal(t, []BE.RuntimeVal{num(1), num(0)}, err.Trace[2].Args)
+
+		assert.Equal(t, `Traceback (most recent call last):
+  File "<input>", line 12, in <module>
+    run([1, 0])
+  File "<input>", line 9, in run(xs = [1, 0])
+    pop divide(xs[0], xs[1])
+  File "<input>", line 3, in divide(a = 1, b = 0)
+    throw "cannot divide by zero"
+Error: cannot divide by zero`, err.Traceback())
+	})
+
+	t.Run("Native", func(t *testing.T) {
+		err := runError(t, "fn load() {\n  pop fs.read(\"secret.txt\")\n}\nload()\n")
+
+		require.Len(t, err.Trace, 3)
+		assert.Equal(t, "<native fs.read>", err.Trace[2].Name)
+		assert.True(t, err.Trace[2].Native)
+		assert.Contains(t, err.Traceback(), "  in <native fs.read>(\"secret.txt\")\nPermissionError: Permission denied")
+	})
+
+	t.Run("RecursionIsCollapsed", func(t *testing.T) {
+		err := runError(t, recurseForever+"f()\n")
+
+		assert.Len(t, err.Trace, BE.DefaultMaxCallDepth+2)
+		out := err.Traceback()
+		assert.Contains(t, out, "[Previous frame repeated 9997 more times]")
+		assert.Less(t, strings.Count(out, "\n"), 20)
+		assert.True(t, strings.HasSuffix(out, "StackOverflowError: Stack overflow: maximum call depth of 10000 exceeded in 'f'"))
+	})
+
+	t.Run("CaughtErrorsLeaveTheStack", func(t *testing.T) {
+		source := "fn fail() {\n  throw 1\n}\ntry {\n  fail()\n} catch {\n}\nfn g() {\n  throw 2\n}\ng()\n"
+		err := runError(t, source)
+
+		require.Len(t, err.Trace, 2)
+		assert.Equal(t, "g", err.Trace[1].Name)
+		assert.Equal(t, 9, err.Trace[1].Line)
+	})
+
+	t.Run("FileNames", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "main.pop")
+		require.NoError(t, os.WriteFile(path, []byte("let x = 1\nx()\n"), 0o644))
+
+		it, _ := newTestInterpreter(BE.Options{})
+		_, err := it.RunFile(path)
+
+		var runtimeErr *BE.RuntimeError
+		require.True(t, errors.As(err, &runtimeErr))
+		require.Len(t, runtimeErr.Trace, 1)
+		assert.Equal(t, path, runtimeErr.Trace[0].File)
+		assert.Equal(t, 2, runtimeErr.Trace[0].Line)
+		assert.Equal(t, "x()", runtimeErr.Trace[0].Source)
+	})
+}
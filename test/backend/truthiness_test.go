@@ -0,0 +1,74 @@
+package backend_test
+
+import (
+	BE "pop/backend"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsTruthy(t *testing.T) {
+	tests := []struct {
+		name string
+		val  BE.RuntimeVal
+		want bool
+	}{
+		{"Null", BE.Null, false},
+		{"False", BE.BoolValue{Value: false}, false},
+		{"True", BE.BoolValue{Value: true}, true},
+		{"Zero", num(0), false},
+		{"NonZero", num(-1), true},
+		{"EmptyString", str(""), false},
+		{"String", str("0"), true},
+		{"EmptyArray", arr(), false},
+		{"Array", arr(num(0)), true},
+		{"EmptyObject", obj(map[string]BE.RuntimeVal{}), false},
+		{"Object", obj(map[string]BE.RuntimeVal{"a": BE.Null}), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, BE.IsTruthy(tt.val))
+		})
+	}
+}
+
+func TestTruthyOperators(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   BE.RuntimeVal
+	}{
+		{"OrDefault", "let name = null\nname || \"default\"", str("default")},
+		{"OrKeepsLeft", "let name = \"Al\"\nname || \"default\"", str("Al")},
+		{"AndShortCircuits", "0 && missing", num(0)},
+		{"AndReturnsRight", "1 && \"yes\"", str("yes")},
+		{"Not", "!\"\"", BE.BoolValue{Value: true}},
+		{"IfTruthy", "let r = 0\nif [1] {\n  r = 1\n}\nr", num(1)},
+		{"IfElse", "let r = 0\nif \"\" {\n  r = 1\n} else {\n  r = 2\n}\nr", num(2)},
+		{"WhileTruthy", "let n = 3\nlet steps = 0\nwhile n {\n  n = n - 1\n  steps = steps + 1\n}\nsteps", num(3)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, evalSource(t, tt.source))
+		})
+	}
+}
+
+func TestStrictBooleans(t *testing.T) {
+	opts := BE.DefaultOptions()
+	opts.StrictBooleans = true
+	it := BE.NewInterpreter(opts)
+
+	result, err := it.RunString("true && false")
+	require.NoError(t, err)
+	assert.Equal(t, BE.BoolValue{Value: false}, result)
+
+	_, err = it.RunString("1 && true")
+	assert.ErrorContains(t, err, "Logical operators require boolean operands")
+
+	_, err = it.RunString("if \"x\" {\n}")
+	assert.ErrorContains(t, err, "If statement condition must evaluate to a boolean")
+}
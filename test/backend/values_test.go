@@ -0,0 +1,187 @@
+package backend_test
+
+import (
+	"math"
+	BE "pop/backend"
+	FE "pop/frontend"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func num(n float64) BE.RuntimeVal { return BE.NumberVal{Value: n} }
+func str(s string) BE.RuntimeVal  { return BE.StringVal{Value: s} }
+func arr(elements ...BE.RuntimeVal) *BE.ArrayVal {
+	return &BE.ArrayVal{Elements: elements}
+}
+func obj(props map[string]BE.RuntimeVal) *BE.ObjectVal {
+	return &BE.ObjectVal{Properties: props}
+}
+
+func evalSource(t *testing.T, source string) BE.RuntimeVal {
+	t.Helper()
+	program, err := FE.Parse(source)
+	require.NoError(t, err)
+	return BE.Evaluate(program, BE.MakeGlobalEnvironment())
+}
+
+func TestEquals(t *testing.T) {
+	t.Run("Primitives", func(t *testing.T) {
+		assert.True(t, BE.Equals(num(1), num(1)))
+		assert.False(t, BE.Equals(num(1), str("1")))
+		assert.True(t, BE.Equals(BE.Null, BE.Null))
+		assert.False(t, BE.Equals(BE.Null, BE.BoolValue{Value: false}))
+		assert.False(t, BE.Equals(num(math.NaN()), num(math.NaN())))
+	})
+
+	t.Run("Containers", func(t *testing.T) {
+		a := arr(num(1), obj(map[string]BE.RuntimeVal{"x": arr(str("y"))}))
+		b := arr(num(1), obj(map[string]BE.RuntimeVal{"x": arr(str("y"))}))
+		c := arr(num(1), obj(map[string]BE.RuntimeVal{"x": arr(str("z"))}))
+
+		assert.True(t, BE.Equals(a, b))
+		assert.False(t, BE.Equals(a, c))
+		assert.False(t, BE.Equals(arr(num(1)), arr(num(1), num(2))))
+	})
+
+	t.Run("Cycles", func(t *testing.T) {
+		a := obj(map[string]BE.RuntimeVal{"n": num(1)})
+		a.Properties["self"] = a
+		b := obj(map[string]BE.RuntimeVal{"n": num(1)})
+		b.Properties["self"] = b
+		c := obj(map[string]BE.RuntimeVal{"n": num(2)})
+		c.Properties["self"] = c
+
+		assert.True(t, BE.Equals(a, b))
+		assert.False(t, BE.Equals(a, c))
+		assert.Equal(t, 0, BE.Compare(a, b))
+		assert.Equal(t, BE.Hash(a), BE.Hash(b))
+
+		// Equal cycles of different lengths hash alike too
+		d := arr()
+		d.Elements = append(d.Elements, d)
+		e, f := arr(), arr()
+		e.Elements = append(e.Elements, f)
+		f.Elements = append(f.Elements, e)
+		assert.True(t, BE.Equals(d, e))
+		assert.Equal(t, BE.Hash(d), BE.Hash(e))
+
+		m := BE.NewValueMap()
+		m.Set(d, str("found"))
+		val, ok := m.Get(e)
+		require.True(t, ok)
+		assert.Equal(t, str("found"), val)
+	})
+}
+
+func TestIdentical(t *testing.T) {
+	a := arr(num(1))
+	b := arr(num(1))
+
+	assert.True(t, BE.Identical(a, a))
+	assert.False(t, BE.Identical(a, b))
+	assert.True(t, BE.Identical(str("x"), str("x")))
+	assert.False(t, BE.Identical(a, num(1)))
+}
+
+func TestCompare(t *testing.T) {
+	ordered := []BE.RuntimeVal{
+		BE.Null,
+		BE.BoolValue{Value: false},
+		BE.BoolValue{Value: true},
+		num(math.NaN()),
+		num(-1),
+		num(2),
+		str("a"),
+		str("b"),
+		arr(num(1)),
+		arr(num(1), num(0)),
+		obj(map[string]BE.RuntimeVal{"a": num(1)}),
+	}
+
+	for i := range ordered {
+		for j := range ordered {
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+			assert.Equal(t, want, BE.Compare(ordered[i], ordered[j]), "Compare(%d, %d)", i, j)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	a := obj(map[string]BE.RuntimeVal{"x": num(1), "y": arr(str("z"))})
+	b := obj(map[string]BE.RuntimeVal{"y": arr(str("z")), "x": num(1)})
+
+	assert.Equal(t, BE.Hash(a), BE.Hash(b))
+	assert.Equal(t, BE.Hash(num(0)), BE.Hash(num(math.Copysign(0, -1))))
+	assert.NotEqual(t, BE.Hash(num(1)), BE.Hash(str("1")))
+}
+
+func TestValueMap(t *testing.T) {
+	m := BE.NewValueMap()
+	m.Set(arr(num(1), num(2)), str("pair"))
+	m.Set(str("k"), num(1))
+	m.Set(str("k"), num(2))
+
+	val, ok := m.Get(arr(num(1), num(2)))
+	require.True(t, ok)
+	assert.Equal(t, str("pair"), val)
+	assert.Equal(t, 2, m.Len())
+
+	assert.True(t, m.Delete(str("k")))
+	assert.False(t, m.Has(str("k")))
+	assert.Equal(t, 1, m.Len())
+}
+
+func TestSameValueZero(t *testing.T) {
+	nan := num(math.NaN())
+	assert.True(t, BE.SameValueZero(nan, num(math.NaN())))
+	assert.True(t, BE.SameValueZero(arr(nan), arr(num(math.NaN()))))
+	assert.True(t, BE.SameValueZero(num(0), num(math.Copysign(0, -1))))
+	assert.False(t, BE.SameValueZero(nan, num(1)))
+	assert.Equal(t, BE.Hash(nan), BE.Hash(num(math.Float64frombits(0x7ff8000000000001))))
+
+	// NaN keys can be found again, and only once
+	m := BE.NewValueMap()
+	m.Set(nan, str("a"))
+	m.Set(num(math.NaN()), str("b"))
+	m.Set(arr(nan), str("c"))
+	val, ok := m.Get(num(math.NaN()))
+	require.True(t, ok)
+	assert.Equal(t, str("b"), val)
+	assert.True(t, m.Has(arr(num(math.NaN()))))
+	assert.Equal(t, 2, m.Len())
+
+	result := evalSource(t, "let nan = 0 / 0\nlet s = Set([nan, nan])\ns.add(nan)\n[s.size, s.has(nan), nan == nan]")
+	assert.Equal(t, arr(num(1), BE.BoolValue{Value: true}, BE.BoolValue{Value: false}), result)
+}
+
+func TestEqualityOperators(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   bool
+	}{
+		{"ArrayEquals", "[1, [2], { a: 3 }] == [1, [2], { a: 3 }]", true},
+		{"ArrayNotEquals", "[1, 2] != [1, 3]", true},
+		{"ObjectEquals", "{ a: 1, b: 2 } == { b: 2, a: 1 }", true},
+		{"IsSameReference", "let a = [1]\nlet b = a\na is b", true},
+		{"IsDifferentReference", "[1] is [1]", false},
+		{"NullEquals", "null == null", true},
+		{"MapStructuralKeys", "let m = Map()\nm.set([1, 2], 3)\nm.has([1, 2])", true},
+		{"SetDeduplicates", "let s = Set([[1], [1], 2])\ns.size == 2", true},
+		{"SortMixed", "sort([3, \"b\", null, 1]) == [null, 1, 3, \"b\"]", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := evalSource(t, tt.source)
+			assert.Equal(t, BE.BoolValue{Value: tt.want}, result)
+		})
+	}
+}
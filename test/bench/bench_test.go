@@ -0,0 +1,133 @@
+package bench_test
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	BE "pop/backend"
+	"pop/bench"
+	FE "pop/frontend"
+	"pop/vm"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCorpus(t *testing.T) {
+	scripts := bench.Corpus()
+	var names []string
+	for _, script := range scripts {
+		names = append(names, script.Name)
+	}
+	assert.Equal(t, []string{"arrays", "fib", "loops", "objects", "strings"}, names)
+
+	// Every script runs, to the same result on both engines
+	for _, script := range scripts {
+		var results []string
+		for _, engine := range []BE.Engine{nil, vm.Engine{}} {
+			result, err := BE.NewInterpreter(BE.Options{Stdout: io.Discard, Engine: engine}).RunString(script.Source)
+			require.NoError(t, err, "%s on %T", script.Name, engine)
+			results = append(results, BE.Inspect(result, BE.DefaultInspectOptions))
+		}
+		assert.Equal(t, results[0], results[1], script.Name)
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	runs := 0
+	result, err := bench.Measure("count", bench.Options{Warmup: 2, Iterations: 5}, func() error {
+		runs++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 7, runs)
+	assert.Equal(t, "count", result.Name)
+	assert.Equal(t, 5, result.Iterations)
+	assert.LessOrEqual(t, result.Min, result.Median)
+	assert.LessOrEqual(t, result.Median, result.Max)
+
+	fail := errors.New("fail")
+	_, err = bench.Measure("fail", bench.DefaultOptions(), func() error { return fail })
+	assert.ErrorIs(t, err, fail)
+
+	// Options that time nothing are refused rather than adjusted
+	runs = 0
+	_, err = bench.Measure("none", bench.Options{Iterations: 0}, func() error { runs++; return nil })
+	assert.ErrorContains(t, err, "invalid iterations 0")
+	_, err = bench.Measure("none", bench.Options{Warmup: -1, Iterations: 1}, func() error { runs++; return nil })
+	assert.ErrorContains(t, err, "invalid warmup -1")
+	assert.Zero(t, runs)
+}
+
+func TestBaseline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	results := []bench.Result{
+		{Name: "fib", Iterations: 10, Median: 10 * time.Millisecond, Mean: 11 * time.Millisecond},
+		{Name: "loops", Iterations: 10, Median: 20 * time.Millisecond},
+	}
+	require.NoError(t, bench.WriteBaseline(path, results))
+	stored, err := bench.ReadBaseline(path)
+	require.NoError(t, err)
+	assert.Equal(t, results, stored)
+
+	current := []bench.Result{
+		{Name: "fib", Median: 12 * time.Millisecond},
+		{Name: "loops", Median: 21 * time.Millisecond},
+		{Name: "new", Median: time.Millisecond},
+	}
+	assert.Equal(t, []bench.Comparison{
+		{Name: "fib", Baseline: 10 * time.Millisecond, Current: 12 * time.Millisecond, Change: 0.2, Regression: true},
+		{Name: "loops", Baseline: 20 * time.Millisecond, Current: 21 * time.Millisecond, Change: 0.05},
+		{Name: "new", Current: time.Millisecond},
+	}, bench.Compare(stored, current, 0.1))
+}
+
+func BenchmarkLex(b *testing.B) {
+	for _, script := range bench.Corpus() {
+		b.Run(script.Name, func(b *testing.B) {
+			b.SetBytes(int64(len(script.Source)))
+			for i := 0; i < b.N; i++ {
+				if _, err := FE.Lex(script.Source); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkParseTokens(b *testing.B) {
+	for _, script := range bench.Corpus() {
+		tokens, err := FE.Lex(script.Source)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(script.Name, func(b *testing.B) {
+			b.SetBytes(int64(len(script.Source)))
+			for i := 0; i < b.N; i++ {
+				if _, err := FE.ParseTokens(tokens); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkEvaluate runs the parsed corpus on the tree walker, each time
+// in a new interpreter, which resolves the program before running it.
+func BenchmarkEvaluate(b *testing.B) {
+	for _, script := range bench.Corpus() {
+		program, err := FE.Parse(script.Source)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(script.Name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := BE.NewInterpreter(BE.Options{Stdout: io.Discard}).Eval(program); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
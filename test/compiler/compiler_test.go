@@ -0,0 +1,412 @@
+package compiler_test
+
+import (
+	BE "pop/backend"
+	C "pop/compiler"
+	FE "pop/frontend"
+	"pop/frontend/types/ast"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func compile(t *testing.T, source string) *C.Proto {
+	t.Helper()
+	program, err := FE.Parse(source)
+	require.NoError(t, err)
+
+	proto, err := C.Compile(program, C.Options{File: "test.pop"})
+	require.NoError(t, err)
+	return proto
+}
+
+func ops(proto *C.Proto) []C.Opcode {
+	var out []C.Opcode
+	for _, in := range proto.Instructions() {
+		out = append(out, in.Op)
+	}
+	return out
+}
+
+// fn returns the proto of the function named name declared in proto.
+func fn(t *testing.T, proto *C.Proto, name string) *C.Proto {
+	t.Helper()
+	for _, k := range proto.Constants {
+		if sub, ok := k.(*C.Proto); ok && sub.Name == name {
+			return sub
+		}
+	}
+	t.Fatalf("no function %q in %s", name, proto.Name)
+	return nil
+}
+
+// find returns the first instruction with opcode op.
+func find(t *testing.T, proto *C.Proto, op C.Opcode) C.Instruction {
+	t.Helper()
+	for _, in := range proto.Instructions() {
+		if in.Op == op {
+			return in
+		}
+	}
+	t.Fatalf("no %s in %s", op, proto.Name)
+	return C.Instruction{}
+}
+
+// target is where a jump instruction continues.
+func target(in C.Instruction) int {
+	distance := in.Operands[len(in.Operands)-1]
+	if in.Op == C.OpLoop {
+		return in.Offset + in.Width() - distance
+	}
+	return in.Offset + in.Width() + distance
+}
+
+func constant(proto *C.Proto, in C.Instruction) BE.RuntimeVal {
+	return proto.Constants[in.Operands[0]]
+}
+
+func TestMakeAndReadOperands(t *testing.T) {
+	instruction := C.Make(C.OpJumpIfFalse, int(C.CondWhile), 513)
+	assert.Equal(t, []byte{byte(C.OpJumpIfFalse), 1, 2, 1}, instruction)
+
+	def, err := C.Lookup(C.OpJumpIfFalse)
+	require.NoError(t, err)
+	operands, read := C.ReadOperands(def, instruction[1:])
+	assert.Equal(t, []int{1, 513}, operands)
+	assert.Equal(t, 3, read)
+
+	assert.Equal(t, "JUMP_IF_FALSE", C.OpJumpIfFalse.String())
+	assert.Equal(t, "While loop", C.CondWhile.String())
+}
+
+func TestCompileLiterals(t *testing.T) {
+	proto := compile(t, "1\n\"hi\"\ntrue\nfalse\nnull\n1\n")
+
+	assert.Equal(t, []C.Opcode{
+		C.OpConstant, C.OpPop,
+		C.OpConstant, C.OpPop,
+		C.OpTrue, C.OpPop,
+		C.OpFalse, C.OpPop,
+		C.OpNull, C.OpPop,
+		C.OpConstant, C.OpReturn,
+	}, ops(proto))
+	// Equal constants share a slot in the pool
+	assert.Equal(t, []BE.RuntimeVal{BE.NumberVal{Value: 1}, BE.StringVal{Value: "hi"}}, proto.Constants)
+}
+
+func TestCompileArrayAndObject(t *testing.T) {
+	proto := compile(t, "let x = 1\n[1, 2, x]\n{ a: 1, x }\n")
+
+	assert.Equal(t, []C.Opcode{
+		C.OpConstant, C.OpDefineGlobal, C.OpPop,
+		C.OpConstant, C.OpConstant, C.OpGetGlobal, C.OpArray, C.OpPop,
+		C.OpConstant, C.OpConstant, C.OpConstant, C.OpGetGlobal, C.OpObject, C.OpReturn,
+	}, ops(proto))
+	assert.Equal(t, []int{3}, find(t, proto, C.OpArray).Operands)
+	assert.Equal(t, []int{2}, find(t, proto, C.OpObject).Operands)
+}
+
+func TestCompileGlobals(t *testing.T) {
+	proto := compile(t, "let a = 1\nconst b = 2\nlet c\na = b\n")
+
+	assert.Equal(t, []C.Opcode{
+		C.OpConstant, C.OpDefineGlobal, C.OpPop,
+		C.OpConstant, C.OpDefineConstGlobal, C.OpPop,
+		C.OpNull, C.OpDefineGlobal, C.OpPop,
+		C.OpGetGlobal, C.OpSetGlobal, C.OpReturn,
+	}, ops(proto))
+	assert.Equal(t, BE.StringVal{Value: "a"}, constant(proto, find(t, proto, C.OpSetGlobal)))
+}
+
+func TestCompileImports(t *testing.T) {
+	proto := compile(t, "import { a, b as c } from \"./m.pop\"\nimport * as m from \"./m.pop\"\n")
+
+	assert.Equal(t, []C.Opcode{
+		C.OpImport, C.OpImportName, C.OpDefineImport, C.OpImportName, C.OpDefineImport, C.OpPop, C.OpNull, C.OpPop,
+		C.OpImport, C.OpDefineImport, C.OpNull, C.OpReturn,
+	}, ops(proto))
+	in := find(t, proto, C.OpImportName)
+	assert.Equal(t, BE.StringVal{Value: "./m.pop"}, proto.Constants[in.Operands[0]])
+	assert.Equal(t, BE.StringVal{Value: "a"}, proto.Constants[in.Operands[1]])
+	assert.Equal(t, "#0 \"./m.pop\" #1 a", C.FormatOperands(proto, in))
+	assert.Empty(t, C.GlobalUses(compile(t, "import { a } from \"m\"\nfn f() {\n  a\n}\na\n")))
+}
+
+func TestCompileOperators(t *testing.T) {
+	tests := []struct {
+		source string
+		op     C.Opcode
+	}{
+		{"1 + 2", C.OpAdd},
+		{"1 - 2", C.OpSubtract},
+		{"1 * 2", C.OpMultiply},
+		{"1 / 2", C.OpDivide},
+		{"1 % 2", C.OpModulo},
+		{"1 == 2", C.OpEqual},
+		{"1 != 2", C.OpNotEqual},
+		{"1 is 2", C.OpIs},
+		{"1 < 2", C.OpLess},
+		{"1 > 2", C.OpGreater},
+		{"1 <= 2", C.OpLessEqual},
+		{"1 >= 2", C.OpGreaterEqual},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			proto := compile(t, tt.source)
+			assert.Equal(t, []C.Opcode{C.OpConstant, C.OpConstant, tt.op, C.OpReturn}, ops(proto))
+		})
+	}
+
+	t.Run("Unary", func(t *testing.T) {
+		assert.Equal(t, []C.Opcode{C.OpTrue, C.OpNot, C.OpReturn}, ops(compile(t, "!true")))
+		assert.Equal(t, []C.Opcode{C.OpConstant, C.OpNegate, C.OpReturn}, ops(compile(t, "-1")))
+	})
+}
+
+func TestCompileLogical(t *testing.T) {
+	for source, op := range map[string]C.Opcode{"true && false": C.OpAnd, "true || false": C.OpOr} {
+		proto := compile(t, source)
+
+		assert.Equal(t, []C.Opcode{C.OpTrue, op, C.OpFalse, C.OpCheckBool, C.OpReturn}, ops(proto))
+		// Short-circuiting skips the right operand and its check
+		assert.Equal(t, find(t, proto, C.OpReturn).Offset, target(find(t, proto, op)))
+	}
+}
+
+func TestCompileCallAndMember(t *testing.T) {
+	proto := compile(t, "let o = { a: [1] }\nprint(o.a[0], 2)\n")
+
+	assert.Equal(t, []C.Opcode{
+		C.OpConstant, C.OpConstant, C.OpArray, C.OpObject, C.OpDefineGlobal, C.OpPop,
+		C.OpGetGlobal, C.OpGetGlobal, C.OpGetProperty, C.OpConstant, C.OpGetIndex, C.OpConstant, C.OpCall, C.OpReturn,
+	}, ops(proto))
+	assert.Equal(t, []int{2}, find(t, proto, C.OpCall).Operands)
+	assert.Equal(t, BE.StringVal{Value: "a"}, constant(proto, find(t, proto, C.OpGetProperty)))
+}
+
+func TestCompileIf(t *testing.T) {
+	proto := compile(t, "if x {\n  let y = 1\n} else {\n  let z = 2\n}\n")
+
+	assert.Equal(t, []C.Opcode{
+		C.OpGetGlobal, C.OpJumpIfFalse,
+		C.OpConstant, C.OpDefineLocal, C.OpPop, C.OpCloseScope, C.OpJump,
+		// The else block has a scope of its own too
+		C.OpConstant, C.OpDefineLocal, C.OpPop, C.OpCloseScope,
+		C.OpNull, C.OpReturn,
+	}, ops(proto))
+
+	jumpIfFalse := find(t, proto, C.OpJumpIfFalse)
+	assert.Equal(t, int(C.CondIf), jumpIfFalse.Operands[0])
+	instructions := proto.Instructions()
+	assert.Equal(t, instructions[7].Offset, target(jumpIfFalse))
+	assert.Equal(t, instructions[11].Offset, target(find(t, proto, C.OpJump)))
+	assert.Equal(t, []C.Local{{Name: "y"}, {Name: "z"}}, proto.Locals)
+}
+
+func TestCompileWhile(t *testing.T) {
+	proto := compile(t, "while x {\n  let y = 1\n  y = 2\n}\n")
+
+	assert.Equal(t, []C.Opcode{
+		C.OpGetGlobal, C.OpJumpIfFalse,
+		C.OpConstant, C.OpDefineLocal, C.OpPop,
+		C.OpConstant, C.OpSetLocal, C.OpPop,
+		C.OpLoop, C.OpCloseScope, C.OpNull, C.OpReturn,
+	}, ops(proto))
+
+	jumpIfFalse := find(t, proto, C.OpJumpIfFalse)
+	assert.Equal(t, int(C.CondWhile), jumpIfFalse.Operands[0])
+	assert.Equal(t, find(t, proto, C.OpCloseScope).Offset, target(jumpIfFalse))
+	assert.Equal(t, 0, target(find(t, proto, C.OpLoop)))
+}
+
+func TestCompileFor(t *testing.T) {
+	proto := compile(t, "for (let i = 0; i < 3; i = i + 1) {\n  print(i)\n}\n")
+
+	assert.Equal(t, []C.Opcode{
+		C.OpConstant, C.OpDefineLocal, C.OpPop,
+		C.OpGetLocal, C.OpConstant, C.OpLess, C.OpJumpIfFalse,
+		C.OpGetGlobal, C.OpGetLocal, C.OpCall, C.OpPop,
+		C.OpGetLocal, C.OpConstant, C.OpAdd, C.OpSetLocal, C.OpPop,
+		C.OpLoop, C.OpCloseScope, C.OpNull, C.OpReturn,
+	}, ops(proto))
+
+	assert.Equal(t, int(C.CondFor), find(t, proto, C.OpJumpIfFalse).Operands[0])
+	// The loop goes back to the condition, not the initializer
+	assert.Equal(t, proto.Instructions()[3].Offset, target(find(t, proto, C.OpLoop)))
+}
+
+func TestCompileFunctions(t *testing.T) {
+	proto := compile(t, "fn add(a, b) {\n  let sum = a + b\n  sum\n}\nfn early() {\n  pop\n}\n")
+
+	assert.Equal(t, []C.Opcode{
+		C.OpClosure, C.OpDefineConstGlobal, C.OpPop,
+		C.OpClosure, C.OpDefineConstGlobal, C.OpReturn,
+	}, ops(proto))
+
+	add := fn(t, proto, "add")
+	assert.Equal(t, []string{"a", "b"}, add.Params)
+	assert.Equal(t, []C.Local{{Name: "a"}, {Name: "b"}, {Name: "sum"}}, add.Locals)
+	assert.Equal(t, "test.pop", add.File)
+	assert.Equal(t, ast.Position{Line: 1, Column: 1}, add.Pos)
+	// The value of the last statement is returned
+	assert.Equal(t, []C.Opcode{
+		C.OpGetLocal, C.OpGetLocal, C.OpAdd, C.OpDefineLocal, C.OpPop,
+		C.OpGetLocal, C.OpReturn,
+	}, ops(add))
+
+	assert.Equal(t, []C.Opcode{C.OpNull, C.OpReturn, C.OpReturn}, ops(fn(t, proto, "early")))
+}
+
+func TestCompileTopLevelPop(t *testing.T) {
+	// A top-level `pop` only ends its statement, leaving the try block and
+	// the loop's scope on the way
+	proto := compile(t, "while true {\n  try {\n    pop 1\n  } catch {\n  }\n}\n2\n")
+
+	code := proto.Instructions()
+	var exit []C.Instruction
+	for i, in := range code {
+		if in.Op == C.OpEndTry {
+			exit = code[i : i+3]
+			break
+		}
+	}
+	require.Len(t, exit, 3)
+	assert.Equal(t, C.OpCloseScope, exit[1].Op)
+	require.Equal(t, C.OpJump, exit[2].Op)
+
+	// It lands on the POP between the two statements
+	assert.Equal(t, C.OpPop, code[len(code)-3].Op)
+	assert.Equal(t, code[len(code)-3].Offset, target(exit[2]))
+}
+
+func TestCompileClosures(t *testing.T) {
+	source := `fn outer(x) {
+  fn middle() {
+    fn inner() {
+      pop x + later
+    }
+    pop inner
+  }
+  let later = 1
+  pop middle
+}
+`
+	outer := fn(t, compile(t, source), "outer")
+	middle := fn(t, outer, "middle")
+	inner := fn(t, middle, "inner")
+
+	// middle captures x and later from outer's slots, inner from middle's
+	// upvalues. later is declared after middle, which can still see it.
+	assert.Equal(t, []C.Upvalue{
+		{Name: "x", Index: 0, IsLocal: true},
+		{Name: "later", Index: 2, IsLocal: true},
+	}, middle.Upvalues)
+	assert.Equal(t, []C.Upvalue{
+		{Name: "x", Index: 0},
+		{Name: "later", Index: 1},
+	}, inner.Upvalues)
+	assert.Equal(t, []C.Opcode{C.OpGetUpvalue, C.OpGetUpvalue, C.OpAdd, C.OpReturn, C.OpReturn}, ops(inner))
+
+	t.Run("ConstantsStayConstant", func(t *testing.T) {
+		proto := compile(t, "fn f() {\n  const k = 1\n  fn g() {\n    k = 2\n  }\n}\n")
+		g := fn(t, fn(t, proto, "f"), "g")
+		assert.Equal(t, []C.Upvalue{{Name: "k", Index: 0, IsLocal: true, Const: true}}, g.Upvalues)
+		assert.Equal(t, []C.Opcode{C.OpConstant, C.OpSetUpvalue, C.OpReturn}, ops(g))
+	})
+
+	t.Run("UseBeforeDeclaration", func(t *testing.T) {
+		// Within a function, a variable only exists from its declaration on
+		f := fn(t, compile(t, "fn f() {\n  x\n  let x = 1\n  x\n}\n"), "f")
+		assert.Equal(t, []C.Opcode{
+			C.OpGetGlobal, C.OpPop,
+			C.OpConstant, C.OpDefineLocal, C.OpPop,
+			C.OpGetLocal, C.OpReturn,
+		}, ops(f))
+	})
+}
+
+func TestCompileTryAndThrow(t *testing.T) {
+	proto := compile(t, "try {\n  let a = 1\n  throw a\n} catch err {\n  err\n}\n")
+
+	assert.Equal(t, []C.Opcode{
+		C.OpTry,
+		C.OpConstant, C.OpDefineLocal, C.OpPop,
+		C.OpGetLocal, C.OpThrow, C.OpPop,
+		C.OpCloseScope, C.OpEndTry, C.OpJump,
+		// The handler starts with the caught value on the stack
+		C.OpCloseScope, C.OpDefineLocal, C.OpPop,
+		C.OpGetLocal, C.OpPop, C.OpCloseScope,
+		C.OpNull, C.OpReturn,
+	}, ops(proto))
+
+	instructions := proto.Instructions()
+	assert.Equal(t, instructions[10].Offset, target(instructions[0]))
+	assert.Equal(t, instructions[16].Offset, target(instructions[9]))
+	assert.Equal(t, []C.Local{{Name: "a"}, {Name: "err"}}, proto.Locals)
+
+	t.Run("WithoutBinding", func(t *testing.T) {
+		proto := compile(t, "try {\n} catch {\n}\n")
+		assert.Equal(t, []C.Opcode{
+			C.OpTry, C.OpCloseScope, C.OpEndTry, C.OpJump,
+			C.OpCloseScope, C.OpPop, C.OpCloseScope,
+			C.OpNull, C.OpReturn,
+		}, ops(proto))
+	})
+}
+
+func TestCompileRuntimeErrors(t *testing.T) {
+	// Code the tree walker rejects while running compiles to a RAISE with
+	// the same message
+	tests := []struct {
+		name    string
+		source  string
+		message string
+	}{
+		{"InvalidAssignee", "let o = {}\no.a = 1\n", "Invalid LHS in assignment: "},
+		{"RepeatedParam", "fn f(a, a) {\n}\n", "Cannot declare variable 'a' as its already present in the current scope."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proto := compile(t, tt.source)
+			for _, k := range proto.Constants {
+				if sub, ok := k.(*C.Proto); ok {
+					proto = sub
+				}
+			}
+
+			message, ok := constant(proto, find(t, proto, C.OpRaise)).(BE.StringVal)
+			require.True(t, ok)
+			assert.True(t, strings.HasPrefix(message.Value, tt.message), "got %q", message.Value)
+		})
+	}
+
+	t.Run("Redeclaration", func(t *testing.T) {
+		// Both declarations share a slot, so the second one fails at run time
+		f := fn(t, compile(t, "fn f() {\n  let x = 1\n  let x = 2\n}\n"), "f")
+		assert.Len(t, f.Locals, 1)
+	})
+}
+
+func TestCompileLineTable(t *testing.T) {
+	proto := compile(t, "let a = 1\n\nlet b = a + 2\n")
+
+	add := find(t, proto, C.OpAdd)
+	assert.Equal(t, ast.Position{Line: 3, Column: 11}, proto.PositionAt(add.Offset))
+	assert.Equal(t, ast.Position{Line: 1, Column: 9}, proto.PositionAt(0))
+	assert.Equal(t, ast.Position{}, (&C.Chunk{}).PositionAt(0))
+}
+
+func TestCompileLimits(t *testing.T) {
+	args := strings.Repeat("1, ", 255) + "1"
+	program, err := FE.Parse("f(" + args + ")\n")
+	require.NoError(t, err)
+
+	_, err = C.Compile(program, C.Options{})
+	var compileErr *C.CompileError
+	require.ErrorAs(t, err, &compileErr)
+	assert.Contains(t, compileErr.Message, "Too many arguments")
+}
@@ -0,0 +1,60 @@
+package compiler_test
+
+import (
+	C "pop/compiler"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisassemble(t *testing.T) {
+	proto := compile(t, "let n = 0\nwhile n < 3 {\n  n = n + 1\n}\nfn add(a, b) {\n  a + b\n}\n")
+
+	assert.Equal(t, `== <module> test.pop ==
+0000  L1  CONSTANT             #0 0
+0003  L1  DEFINE_GLOBAL        #1 n
+0006  L1  POP
+0007  L2  GET_GLOBAL           #1 n
+0010  L2  CONSTANT             #2 3
+0013  L2  LESS
+0014  L2  JUMP_IF_FALSE        -> 0032 (While loop)
+0018  L3  GET_GLOBAL           #1 n
+0021  L3  CONSTANT             #3 1
+0024  L3  ADD
+0025  L3  SET_GLOBAL           #1 n
+0028  L2  POP
+0029  L2  LOOP                 -> 0007
+0032  L2  CLOSE_SCOPE          0 0
+0037  L2  NULL
+0038  L2  POP
+0039  L5  CLOSURE              #4 <fn add(a, b)>
+0042  L5  DEFINE_CONST_GLOBAL  #5 add
+0045  L5  RETURN
+
+== fn add(a, b) test.pop:5:1 ==
+locals: a, b
+0000  L6  GET_LOCAL  0 a
+0003  L6  GET_LOCAL  1 b
+0006  L6  ADD
+0007  L5  RETURN
+`, C.Disassemble(proto))
+}
+
+func TestDisassembleClosures(t *testing.T) {
+	proto := compile(t, "fn outer() {\n  let x = 1\n  fn inner() {\n    x = 2\n  }\n}\n")
+	out := C.Disassemble(proto)
+
+	assert.Contains(t, out, "== fn inner() test.pop:3:3 ==\nupvalues: x (local 0)\n")
+	assert.Contains(t, out, "SET_UPVALUE  0 x")
+	assert.Equal(t, 3, strings.Count(out, "== "), "every nested function is listed")
+}
+
+func TestFormatOperands(t *testing.T) {
+	proto := compile(t, "try {\n  throw \"no\"\n} catch {\n}\nlet o = { a: 1 }\n")
+
+	assert.Equal(t, `#0 "no"`, C.FormatOperands(proto, find(t, proto, C.OpConstant)))
+	assert.Equal(t, "-> 0017", C.FormatOperands(proto, find(t, proto, C.OpTry)))
+	assert.Equal(t, "1", C.FormatOperands(proto, find(t, proto, C.OpObject)))
+	assert.Equal(t, "", C.FormatOperands(proto, find(t, proto, C.OpThrow)))
+}
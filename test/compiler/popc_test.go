@@ -0,0 +1,153 @@
+package compiler_test
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	C "pop/compiler"
+	"pop/optimizer"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const popcSource = "let greeting = \"hi\"\nfn outer(n) {\n  let x = n / 2\n  fn inner() {\n    x = x + 1\n  }\n  inner()\n  x\n}\nouter(2)\n"
+
+func marshal(t *testing.T, source string) []byte {
+	t.Helper()
+	data, err := (&C.Program{Proto: compile(t, source), Source: source}).MarshalBinary()
+	require.NoError(t, err)
+	return data
+}
+
+func TestPopcRoundTrip(t *testing.T) {
+	proto := compile(t, popcSource)
+	data, err := (&C.Program{Proto: proto, Source: popcSource}).MarshalBinary()
+	require.NoError(t, err)
+	assert.True(t, C.IsBytecode(data))
+	assert.False(t, C.IsBytecode([]byte(popcSource)))
+
+	var program C.Program
+	require.NoError(t, program.UnmarshalBinary(data))
+	assert.Equal(t, popcSource, program.Source)
+	assert.Equal(t, C.Disassemble(proto), C.Disassemble(program.Proto), "code, constants and debug info survive")
+
+	again, err := program.MarshalBinary()
+	require.NoError(t, err)
+	assert.Equal(t, data, again, "the encoding is deterministic")
+}
+
+func TestPopcRejectsBadFiles(t *testing.T) {
+	var program C.Program
+
+	assert.ErrorIs(t, program.UnmarshalBinary([]byte(popcSource)), C.ErrNotBytecode)
+	assert.ErrorIs(t, program.UnmarshalBinary([]byte("POPC")), C.ErrNotBytecode)
+
+	data := marshal(t, popcSource)
+	binary.BigEndian.PutUint16(data[4:], C.Version+1)
+	assert.ErrorIs(t, program.UnmarshalBinary(data), C.ErrVersion)
+
+	data = marshal(t, popcSource)
+	data[len(data)-3] ^= 0xff
+	assert.ErrorIs(t, program.UnmarshalBinary(data), C.ErrChecksum)
+
+	data = marshal(t, popcSource)
+	assert.ErrorIs(t, program.UnmarshalBinary(data[:len(data)-1]), C.ErrChecksum)
+}
+
+func TestVerify(t *testing.T) {
+	require.NoError(t, C.Verify(compile(t, popcSource)))
+
+	tests := []struct {
+		name    string
+		corrupt func(p *C.Proto)
+		err     string
+	}{
+		{"unknown opcode", func(p *C.Proto) { p.Code[0] = 0xff }, "is not defined"},
+		{"missing return", func(p *C.Proto) { p.Code = p.Code[:len(p.Code)-1] }, "does not end with RETURN"},
+		{"cut short", func(p *C.Proto) { p.Code = append(p.Code[:len(p.Code)-1], byte(C.OpConstant)) }, "cut short"},
+		{"constant out of range", func(p *C.Proto) { p.Constants = p.Constants[:0] }, "refers to constant"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proto := compile(t, "let a = 1\n")
+			test.corrupt(proto)
+			err := C.Verify(proto)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.err)
+		})
+	}
+}
+
+func TestCache(t *testing.T) {
+	cache := &C.Cache{Dir: t.TempDir()}
+
+	first, err := cache.Compile("test.pop", popcSource, nil)
+	require.NoError(t, err)
+	entries, err := os.ReadDir(cache.Dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, cache.Key("test.pop", popcSource, nil)+".popc", entries[0].Name())
+
+	second, err := cache.Compile("test.pop", popcSource, nil)
+	require.NoError(t, err)
+	assert.Equal(t, C.Disassemble(first.Proto), C.Disassemble(second.Proto))
+
+	assert.NotEqual(t, cache.Key("test.pop", popcSource, nil), cache.Key("test.pop", popcSource+"1\n", nil), "edits miss")
+	assert.NotEqual(t, cache.Key("test.pop", popcSource, nil), cache.Key("other.pop", popcSource, nil), "files are cached apart")
+	assert.NotEqual(t, cache.Key("test.pop", popcSource, nil), cache.Key("test.pop", popcSource, optimizer.Level(2)), "optimized programs are cached apart")
+	assert.NotEqual(t, cache.Key("test.pop", popcSource, optimizer.Level(1)), cache.Key("test.pop", popcSource, optimizer.Level(2)))
+}
+
+func TestCacheRecompilesBadEntries(t *testing.T) {
+	cache := &C.Cache{Dir: t.TempDir()}
+	path := filepath.Join(cache.Dir, cache.Key("test.pop", popcSource, nil)+".popc")
+
+	// An entry written by another compiler version is ignored and replaced
+	stale := marshal(t, popcSource)
+	binary.BigEndian.PutUint16(stale[4:], C.Version+1)
+	require.NoError(t, os.WriteFile(path, stale, 0o644))
+
+	program, err := cache.Compile("test.pop", popcSource, nil)
+	require.NoError(t, err)
+	assert.Equal(t, popcSource, program.Source)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var stored C.Program
+	assert.NoError(t, stored.UnmarshalBinary(data))
+}
+
+func TestCacheReportsSyntaxErrors(t *testing.T) {
+	cache := &C.Cache{Dir: t.TempDir()}
+	_, err := cache.Compile("test.pop", "let = 1", nil)
+	assert.Error(t, err)
+
+	entries, _ := os.ReadDir(cache.Dir)
+	assert.Empty(t, entries)
+}
+
+// bytecodeFingerprints records the instruction set and the encoding of
+// popcSource at each bytecode version. Changing either fails TestVersion
+// until Version is bumped and the new fingerprint added here.
+var bytecodeFingerprints = map[uint16]string{
+	3: "6e0f032cfd56dc193115c805f41d0d07703383cb35ae46a576e131db54aa357e",
+}
+
+func TestVersion(t *testing.T) {
+	h := sha256.New()
+	for op := 0; op < 256; op++ {
+		if def, err := C.Lookup(C.Opcode(op)); err == nil {
+			fmt.Fprintf(h, "%d %s %v\n", op, def.Name, def.OperandWidths)
+		}
+	}
+	h.Write(marshal(t, popcSource))
+	fingerprint := hex.EncodeToString(h.Sum(nil))
+
+	assert.Equal(t, bytecodeFingerprints[C.Version], fingerprint,
+		"the instruction set or .popc encoding changed: bump compiler.Version and add the fingerprint")
+}
@@ -0,0 +1,153 @@
+package format_test
+
+import (
+	"pop/format"
+	FE "pop/frontend"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func formatted(t *testing.T, source string) string {
+	t.Helper()
+	out, err := format.Source(source, format.Options{})
+	require.NoError(t, err)
+	return out
+}
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name, source, want string
+	}{
+		{"Spacing", "let  x=1+2*3\nprint( x,[1,2] ,{a:1,b} )", "let x = 1 + 2 * 3\nprint(x, [1, 2], { a: 1, b })\n"},
+		{"Empty", "\n\n", ""},
+		{"Indentation", "fn f(a){\nif a>1{\n\tpop a\n}else if a{\npop 1\n} else {\nwhile a {\na = a-1\n}\n}\n}\n",
+			"fn f(a) {\n  if a > 1 {\n    pop a\n  } else if a {\n    pop 1\n  } else {\n    while a {\n      a = a - 1\n    }\n  }\n}\n"},
+		{"Statements", "for(let i=0;i<3;i=i+1){\n}\ntry {\nthrow \"x\"\n} catch {\n}\nconst K=null\nlet u\n",
+			"for (let i = 0; i < 3; i = i + 1) {}\ntry {\n  throw \"x\"\n} catch {}\nconst K = null\nlet u\n"},
+		{"BlankLines", "let a = 1\n\n\n\nlet b = 2\nlet c = 3\n", "let a = 1\n\nlet b = 2\nlet c = 3\n"},
+		{"Literals", "let s = \"tab\\t \\\"q\\\"\"\nlet e = \"\"\nlet n = 007\nlet b = !true\n", "let s = \"tab\\t \\\"q\\\"\"\nlet e = \"\"\nlet n = 007\nlet b = !true\n"},
+		{"Parentheses", "let a = (1 + 2) * 3\nlet b = 1 + (2 * 3)\nlet c = a - (b - 1)\nlet d = (a - b) - 1\nlet e = -(a + 1)\nlet f = ({x: 1}).x\nlet g = (f(1)).x\nlet h = ((a))\n",
+			"let a = (1 + 2) * 3\nlet b = 1 + 2 * 3\nlet c = a - (b - 1)\nlet d = a - b - 1\nlet e = -(a + 1)\nlet f = ({ x: 1 }).x\nlet g = (f(1)).x\nlet h = a\n"},
+		{"MultilineObject", "let o = {\n  a: 1, b: 2 }\n", "let o = {\n  a: 1,\n  b: 2,\n}\n"},
+		{"Annotations", "type  Id=number|string\nlet a:Id?=1\nconst o :{x:number,y?:string[]}={x:1}\nfn f(p:number,q):fn(number):string?{\npop null\n}\n",
+			"type Id = number | string\nlet a: Id? = 1\nconst o: { x: number, y?: string[] } = { x: 1 }\nfn f(p: number, q): fn(number): string? {\n  pop null\n}\n"},
+		{"Modules", "import {a,b as  c} from \"./m.pop\"\nimport *  as ns from \"n.pop\"\nexport  let x=1\nexport fn f(){\npop x\n}\n",
+			"import { a, b as c } from \"./m.pop\"\nimport * as ns from \"n.pop\"\nexport let x = 1\nexport fn f() {\n  pop x\n}\n"},
+		{"DefaultImport", "import   mathx from \"mathx\"\n", "import mathx from \"mathx\"\n"},
+		{"Tests", "test   \"adds\\tnumbers\"{\nassertEq(1+2,3)\n}\n", "test \"adds\\tnumbers\" {\n  assertEq(1 + 2, 3)\n}\n"},
+		{"MultilineImport", "import {\n  a, // first\n  b\n} from \"m\"\n", "import {\n  a, // first\n  b,\n} from \"m\"\n"},
+		{"MultilineArray", "let a = [\n  1,\n  2,\n]\n", "let a = [1, 2]\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := formatted(t, test.source)
+			assert.Equal(t, test.want, out)
+			// Formatting is idempotent
+			assert.Equal(t, out, formatted(t, out))
+		})
+	}
+}
+
+func TestComments(t *testing.T) {
+	source := "" +
+		"// header\n" +
+		"\n" +
+		"let x = 1 // trailing\n" +
+		"let o = {\n" +
+		"  a: 1, // first\n" +
+		"  // own line\n" +
+		"  b,\n" +
+		"  c: [1,2] // last\n" +
+		"}\n" +
+		"\n" +
+		"\n" +
+		"fn f(a) {\n" +
+		"// inside\n" +
+		"  pop a // result\n" +
+		"  // before close\n" +
+		"}\n" +
+		"fn g() {\n" +
+		"  // nothing here\n" +
+		"}\n" +
+		"// end\n"
+	want := "" +
+		"// header\n" +
+		"\n" +
+		"let x = 1 // trailing\n" +
+		"let o = {\n" +
+		"  a: 1, // first\n" +
+		"  // own line\n" +
+		"  b,\n" +
+		"  c: [1, 2], // last\n" +
+		"}\n" +
+		"\n" +
+		"fn f(a) {\n" +
+		"  // inside\n" +
+		"  pop a // result\n" +
+		"  // before close\n" +
+		"}\n" +
+		"fn g() {\n" +
+		"  // nothing here\n" +
+		"}\n" +
+		"// end\n"
+	out := formatted(t, source)
+	assert.Equal(t, want, out)
+	assert.Equal(t, out, formatted(t, out))
+
+	// A comment in a list breaks it
+	assert.Equal(t, "print(\n  1, // one\n  2,\n)\n", formatted(t, "print(1, // one\n2)\n"))
+	assert.Equal(t, "// only a comment\n", formatted(t, "// only a comment"))
+}
+
+func TestWrapping(t *testing.T) {
+	source := "let words = [\"popcorn\", \"kernel\", \"butter\", \"salt\", \"caramel\", \"movie\", \"bowl\"]\n"
+	assert.Equal(t, source, formatted(t, source))
+
+	narrow, err := format.Source(source, format.Options{Width: 40})
+	require.NoError(t, err)
+	assert.Equal(t, "let words = [\n  \"popcorn\",\n  \"kernel\",\n  \"butter\",\n  \"salt\",\n  \"caramel\",\n  \"movie\",\n  \"bowl\",\n]\n", narrow)
+
+	// Only the lists that do not fit are split, from the outside in
+	nested := "let m = [[1, 2, 3], [4, 5, 6], [7, 8, 9]]\n"
+	out, err := format.Source(nested, format.Options{Width: 30})
+	require.NoError(t, err)
+	assert.Equal(t, "let m = [\n  [1, 2, 3],\n  [4, 5, 6],\n  [7, 8, 9],\n]\n", out)
+
+	// Calls and parameters wrap the same way
+	out, err = format.Source("fn combine(first, second, third) {\n  pop combine(first, second, third)\n}\n", format.Options{Width: 30})
+	require.NoError(t, err)
+	assert.Equal(t, "fn combine(\n  first,\n  second,\n  third,\n) {\n  pop combine(\n    first,\n    second,\n    third,\n  )\n}\n", out)
+}
+
+func TestSyntaxError(t *testing.T) {
+	_, err := format.Source("let = 1\n", format.Options{})
+	var syntaxErr *FE.SyntaxError
+	assert.ErrorAs(t, err, &syntaxErr)
+}
+
+func TestDiff(t *testing.T) {
+	assert.Equal(t, "", format.Diff("a.pop", "let a = 1\n", "let a = 1\n"))
+
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	b := "1\nTWO\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n"
+	assert.Equal(t, ""+
+		"--- a.pop\n"+
+		"+++ a.pop\n"+
+		"@@ -1,5 +1,5 @@\n"+
+		" 1\n"+
+		"-2\n"+
+		"+TWO\n"+
+		" 3\n"+
+		" 4\n"+
+		" 5\n"+
+		"@@ -10,3 +10,4 @@\n"+
+		" 10\n"+
+		" 11\n"+
+		" 12\n"+
+		"+13\n", format.Diff("a.pop", a, b))
+
+	// A missing newline at the end is a change of its own
+	assert.Equal(t, "--- a.pop\n+++ a.pop\n@@ -1 +1 @@\n-x\n\\ No newline at end of file\n+x\n", format.Diff("a.pop", "x", "x\n"))
+}
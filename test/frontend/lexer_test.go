@@ -4,6 +4,8 @@ import (
 	"os"
 	FE "pop/frontend"
 	"pop/frontend/types/tokens"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -15,7 +17,10 @@ func TestLexer(t *testing.T) {
 		t.Fatalf("Failed to read file %v", err)
 	}
 
-	tokensOut := FE.Tokenize(string(content))
+	tokensOut, err := FE.Lex(string(content))
+	if err != nil {
+		t.Fatalf("Lex failed: %v", err)
+	}
 
 	expected := []tokens.Token{
 		// "// Literals" comment
@@ -189,3 +194,145 @@ func TestLexer(t *testing.T) {
 		}
 	}
 }
+
+func TestLexStringLiterals(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		content string
+	}{
+		{"Spaces", `"hello world"`, "hello world"},
+		{"Path", `"./data/in.txt"`, "./data/in.txt"},
+		{"Keywords", `"let if pop"`, "let if pop"},
+		{"Escapes", `"say \"hi\"\n"`, "say \"hi\"\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokensOut, err := FE.Lex(tt.source)
+			if err != nil {
+				t.Fatalf("Lex failed: %v", err)
+			}
+			if len(tokensOut) != 4 || tokensOut[1].Value != tt.content {
+				t.Errorf("got %v, want the string content %q between two quotes", tokensOut, tt.content)
+			}
+		})
+	}
+
+	if _, err := FE.Lex("\"open secret\nlet x = 1"); err == nil {
+		t.Errorf("expected an error for an unterminated string")
+	} else if strings.Contains(err.Error(), "secret") {
+		t.Errorf("error %q repeats the source", err)
+	}
+}
+
+func TestLexPositions(t *testing.T) {
+	tokensOut, err := FE.Lex("let x = \"a b\"\n  foo(1)\n")
+	if err != nil {
+		t.Fatalf("Lex failed: %v", err)
+	}
+
+	want := map[string][2]int{"let": {1, 1}, "a b": {1, 10}, "foo": {2, 3}, "1": {2, 7}}
+	for _, tk := range tokensOut {
+		if pos, ok := want[tk.Value]; ok && (tk.Line != pos[0] || tk.Column != pos[1]) {
+			t.Errorf("token %q at %d:%d, want %d:%d", tk.Value, tk.Line, tk.Column, pos[0], pos[1])
+		}
+	}
+}
+
+func TestLexAll(t *testing.T) {
+	tokensOut, errs := FE.LexAll("let a = 1 $ 2\nlet s = \"bad \\q\"\nlet t = \"open\nlet u = 3\n")
+
+	want := []struct {
+		message  string
+		from, to [2]int
+	}{
+		{"Token of type '$' is not yet processable", [2]int{1, 11}, [2]int{1, 12}},
+		{"Unknown escape sequence '\\q'", [2]int{2, 14}, [2]int{2, 16}},
+		{"Unterminated string literal", [2]int{3, 9}, [2]int{3, 14}},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("got %d errors %v, want %d", len(errs), errs, len(want))
+	}
+	for i, w := range want {
+		err := errs[i]
+		if !strings.Contains(err.Message, w.message) {
+			t.Errorf("error %d is %q, want it to contain %q", i, err.Message, w.message)
+		}
+		if got := [2][2]int{{err.Pos.Line, err.Pos.Column}, {err.End.Line, err.End.Column}}; got != [2][2]int{w.from, w.to} {
+			t.Errorf("error %d spans %v, want %v-%v", i, got, w.from, w.to)
+		}
+	}
+
+	// Lexing went on after each error: the last line is intact
+	var last []string
+	for _, tk := range tokensOut {
+		if tk.Line == 4 {
+			last = append(last, tk.Value)
+		}
+	}
+	if strings.Join(last, " ") != "let u = 3 \n" {
+		t.Errorf("got the last line as %q", last)
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	keywords := FE.Keywords()
+	if !sort.StringsAreSorted(keywords) {
+		t.Errorf("keywords are not sorted: %v", keywords)
+	}
+	// Every keyword lexes to a token of its own, not to an identifier
+	for _, word := range keywords {
+		tokensOut, err := FE.Lex(word)
+		if err != nil {
+			t.Fatalf("Lex failed: %v", err)
+		}
+		tk := tokensOut[0]
+		if tk.TokenType == tokens.Identifier || tk.Value != word {
+			t.Errorf("%q lexes to %v", word, tk)
+		}
+	}
+	if len(keywords) != 17 {
+		t.Errorf("got %d keywords, want 17", len(keywords))
+	}
+}
+
+func TestLexTrivia(t *testing.T) {
+	source := "// header\nlet a = 1 // one  \nlet s = \"// not a comment\"\n"
+	tokensOut, errs := FE.LexTrivia(source)
+	if len(errs) != 0 {
+		t.Fatalf("got errors %v", errs)
+	}
+
+	var comments []tokens.Token
+	for _, tk := range tokensOut {
+		if tk.TokenType == tokens.Comment {
+			comments = append(comments, tk)
+		}
+	}
+	if len(comments) != 2 {
+		t.Fatalf("got comments %v, want 2", comments)
+	}
+	// Comments keep their slashes, not the spaces after them
+	if comments[0].Value != "// header" || comments[0].Line != 1 || comments[0].Column != 1 {
+		t.Errorf("got the first comment as %v", comments[0])
+	}
+	if comments[1].Value != "// one" || comments[1].Line != 2 || comments[1].Column != 11 {
+		t.Errorf("got the second comment as %v", comments[1])
+	}
+
+	// Apart from them, the tokens are those of Lex
+	var rest []tokens.Token
+	for _, tk := range tokensOut {
+		if tk.TokenType != tokens.Comment {
+			rest = append(rest, tk)
+		}
+	}
+	want, err := FE.Lex(source)
+	if err != nil {
+		t.Fatalf("Lex failed: %v", err)
+	}
+	if len(rest) != len(want) {
+		t.Errorf("got %d other tokens, want %d", len(rest), len(want))
+	}
+}
@@ -36,8 +36,8 @@ func TestParser(t *testing.T) {
 		t.Fatalf("Failed to read file %v", err)
 	}
 
-	tokensOut := FE.Tokenize(string(content))
-	astOut := FE.ProduceAST(tokensOut)
+	astOut, err := FE.Parse(string(content))
+	require.NoError(t, err)
 
 	t.Run("Have enough statements in the mock file", func(t *testing.T) {
 		require.Equal(t, EXPECTED_STATEMENTS_COUNT, len(astOut.Body))
@@ -323,3 +323,269 @@ func TestParser(t *testing.T) {
 		}
 	})
 }
+
+func TestParseTryStatement(t *testing.T) {
+	program, err := FE.Parse("try {\n  throw 1\n} catch err {\n  err\n}\n")
+	require.NoError(t, err)
+	require.Len(t, program.Body, 1)
+
+	tryStmt, ok := program.Body[0].(ast.TryStatementNode)
+	require.True(t, ok, "Expected TryStatementNode, got %T", program.Body[0])
+	assert.Equal(t, "err", tryStmt.Param)
+	assert.Equal(t, ast.Position{Line: 3, Column: 9}, tryStmt.ParamPos)
+
+	body, ok := tryStmt.Body.(ast.BlockStatementNode)
+	require.True(t, ok, "Expected BlockStatementNode, got %T", tryStmt.Body)
+	throwStmt, ok := body.Body[0].(ast.ThrowStatementNode)
+	require.True(t, ok, "Expected ThrowStatementNode, got %T", body.Body[0])
+	thrown, ok := throwStmt.Value.(ast.NumericLiteralExprNode)
+	require.True(t, ok, "Expected NumericLiteralExprNode, got %T", throwStmt.Value)
+	assert.Equal(t, 1.0, thrown.Value)
+
+	_, err = FE.Parse("try {\n}\n")
+	assert.ErrorContains(t, err, "Expected 'catch' block following 'try' block")
+
+	_, err = FE.Parse("throw\n")
+	assert.ErrorContains(t, err, "Expected an expression following 'throw'")
+}
+
+func TestParsePositions(t *testing.T) {
+	program, err := FE.Parse("let x = 1\nfn f(a) {\n  pop a + x\n}\nf(2)\n")
+	require.NoError(t, err)
+	require.Len(t, program.Body, 3)
+
+	decl := program.Body[0].(ast.VariableDeclarationNode)
+	assert.Equal(t, ast.Position{Line: 1, Column: 1}, decl.Pos)
+	assert.Equal(t, ast.Position{Line: 1, Column: 9}, ast.PositionOf(decl.Value))
+
+	assert.Equal(t, ast.Position{Line: 1, Column: 5}, decl.NamePos)
+
+	fn := program.Body[1].(ast.FunctionDeclarationNode)
+	assert.Equal(t, ast.Position{Line: 2, Column: 1}, fn.Pos)
+	assert.Equal(t, ast.Position{Line: 2, Column: 4}, fn.NamePos)
+	assert.Equal(t, []ast.Position{{Line: 2, Column: 6}}, fn.ParamPos)
+
+	ret := fn.Body[0].(ast.ReturnStatementNode)
+	assert.Equal(t, ast.Position{Line: 3, Column: 3}, ret.Pos)
+	// Binary expressions are located at their operator
+	assert.Equal(t, ast.Position{Line: 3, Column: 9}, ast.PositionOf(ret.Value))
+}
+
+func TestParseTrailingNewlines(t *testing.T) {
+	program, err := FE.Parse("let x = 1\n\n\n")
+	require.NoError(t, err)
+	assert.Len(t, program.Body, 1)
+}
+
+func TestParseAll(t *testing.T) {
+	source := "let x = (1 +\nprint(x)\nfn f(a) {\n  let y =\n  pop a\n}\nf(1))\n"
+	program, errs := FE.ParseAll(source)
+
+	require.Len(t, errs, 3)
+	assert.Contains(t, errs[0].Message, "Unexpected token")
+	assert.Equal(t, ast.Position{Line: 1, Column: 13}, errs[0].Pos)
+	assert.Equal(t, ast.Position{Line: 4, Column: 10}, errs[1].Pos)
+	// The error covers the token that caused it
+	assert.Equal(t, ast.Position{Line: 7, Column: 5}, errs[2].Pos)
+	assert.Equal(t, ast.Position{Line: 7, Column: 6}, errs[2].End)
+
+	// Declarations that fail to parse keep their name, the rest is parsed
+	// as usual
+	require.Len(t, program.Body, 3)
+	x := assertVariableDeclaration(t, program.Body[0], "x", false)
+	assert.Nil(t, x.Value)
+	assert.IsType(t, ast.CallExprNode{}, program.Body[1])
+	fn := program.Body[2].(ast.FunctionDeclarationNode)
+	require.Len(t, fn.Body, 2)
+	assertVariableDeclaration(t, fn.Body[0], "y", false)
+	assert.IsType(t, ast.ReturnStatementNode{}, fn.Body[1])
+
+	// An unclosed function is kept without its body
+	program, errs = FE.ParseAll("fn g(a) {\n  pop a\n")
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Message, "Closing bracket expected")
+	require.Len(t, program.Body, 1)
+	assert.Equal(t, "g", program.Body[0].(ast.FunctionDeclarationNode).Name)
+
+	// Without errors, ParseAll and Parse agree
+	want, err := FE.Parse("let a = 1\nfn f() {\n  pop a\n}\n")
+	require.NoError(t, err)
+	program, errs = FE.ParseAll("let a = 1\nfn f() {\n  pop a\n}\n")
+	assert.Empty(t, errs)
+	assert.Equal(t, want, program)
+
+	// Parse still stops at the first error, with its position
+	_, err = FE.Parse(source)
+	var syntaxErr *FE.SyntaxError
+	require.ErrorAs(t, err, &syntaxErr)
+	assert.Equal(t, ast.Position{Line: 1, Column: 13}, syntaxErr.Pos)
+}
+
+func TestParseMultilineLists(t *testing.T) {
+	program, err := FE.Parse("let a = [\n  1,\n  2,\n]\nlet o = {\n  x: 1,\n  y,\n}\nprint(\n  a,\n  o,\n)\nfn f(\n  p,\n  q,\n) {\n  pop p\n}\n")
+	require.NoError(t, err)
+	require.Len(t, program.Body, 4)
+
+	a := program.Body[0].(ast.VariableDeclarationNode).Value.(ast.ArrayLiteralExprNode)
+	assert.Len(t, a.Elements, 2)
+	o := program.Body[1].(ast.VariableDeclarationNode).Value.(ast.ObjectLiteralExprNode)
+	require.Len(t, o.Properties, 2)
+	assert.Equal(t, "y", o.Properties[1].Key)
+	assert.Nil(t, o.Properties[1].Value)
+	assert.Len(t, program.Body[2].(ast.CallExprNode).Args, 2)
+	assert.Equal(t, []string{"p", "q"}, program.Body[3].(ast.FunctionDeclarationNode).Params)
+
+	// A trailing comma needs an item before it
+	_, err = FE.Parse("print(,)\n")
+	assert.Error(t, err)
+	_, err = FE.Parse("let a = [,]\n")
+	assert.Error(t, err)
+}
+
+func TestParseAnnotations(t *testing.T) {
+	program, err := FE.Parse("type Id = number | string\nlet a: Id? = 1\nconst b: { x: number, y?: string[] } = { x: 1 }\nfn f(p: number, q): fn(number): string? {\n  pop null\n}\nlet type = 1\n")
+	require.NoError(t, err)
+	require.Len(t, program.Body, 5)
+
+	alias := program.Body[0].(ast.TypeAliasNode)
+	assert.Equal(t, "Id", alias.Name)
+	assert.Equal(t, ast.UnionType, alias.Type.Kind)
+	assert.Equal(t, "number | string", alias.Type.String())
+
+	a := program.Body[1].(ast.VariableDeclarationNode)
+	assert.Equal(t, "Id?", a.Type.String())
+	b := program.Body[2].(ast.VariableDeclarationNode)
+	assert.Equal(t, "{ x: number, y?: string[] }", b.Type.String())
+
+	fn := program.Body[3].(ast.FunctionDeclarationNode)
+	require.Len(t, fn.ParamTypes, 2)
+	assert.Equal(t, "number", fn.ParamTypes[0].String())
+	assert.Nil(t, fn.ParamTypes[1])
+	assert.Equal(t, "fn(number): string?", fn.ReturnType.String())
+
+	// type is only a keyword in front of an alias
+	assert.Equal(t, "type", program.Body[4].(ast.VariableDeclarationNode).Identifier)
+
+	program, err = FE.Parse("fn g(a) {\n}\n")
+	require.NoError(t, err)
+	assert.Nil(t, program.Body[0].(ast.FunctionDeclarationNode).ParamTypes)
+}
+
+func TestParseType(t *testing.T) {
+	for source, want := range map[string]string{
+		"number":                 "number",
+		"(number | string)[]":    "(number | string)[]",
+		"number | string[]":      "number | string[]",
+		"(fn(): number)?":        "(fn(): number)?",
+		"{ a: { b?: boolean } }": "{ a: { b?: boolean } }",
+		"{}":                     "{}",
+	} {
+		typ, err := FE.ParseType(source)
+		require.NoError(t, err, source)
+		assert.Equal(t, want, typ.String())
+	}
+
+	for _, source := range []string{"", "number |", "{ a }", "number number"} {
+		_, err := FE.ParseType(source)
+		assert.Error(t, err, source)
+	}
+}
+
+func TestParseImports(t *testing.T) {
+	program, err := FE.Parse("import { a, b as c } from \"./util.pop\"\nimport * as m from \"lib/m.pop\"\nimport {\n  x,\n  y,\n} from \"x\"\nlet from = 1\nlet as = 2\n")
+	require.NoError(t, err)
+	require.Len(t, program.Body, 5)
+
+	named := program.Body[0].(ast.ImportDeclarationNode)
+	assert.Equal(t, "./util.pop", named.Specifier)
+	assert.Equal(t, []ast.ImportName{
+		{Name: "a", Local: "a", Pos: ast.Position{Line: 1, Column: 10}, LocalPos: ast.Position{Line: 1, Column: 10}},
+		{Name: "b", Local: "c", Pos: ast.Position{Line: 1, Column: 13}, LocalPos: ast.Position{Line: 1, Column: 18}},
+	}, named.Names)
+	assert.Equal(t, ast.Position{Line: 1, Column: 27}, named.SpecifierPos)
+
+	namespace := program.Body[1].(ast.ImportDeclarationNode)
+	assert.Equal(t, "m", namespace.Namespace)
+	assert.Equal(t, "lib/m.pop", namespace.Specifier)
+	assert.Nil(t, namespace.Names)
+
+	assert.Len(t, program.Body[2].(ast.ImportDeclarationNode).Names, 2)
+
+	// from and as are only keywords in imports
+	assert.Equal(t, "from", program.Body[3].(ast.VariableDeclarationNode).Identifier)
+	assert.Equal(t, "as", program.Body[4].(ast.VariableDeclarationNode).Identifier)
+}
+
+func TestParseDefaultImport(t *testing.T) {
+	program, err := FE.Parse("import mathx from \"mathx\"\n")
+	require.NoError(t, err)
+	require.Len(t, program.Body, 1)
+
+	node := program.Body[0].(ast.ImportDeclarationNode)
+	assert.Equal(t, "mathx", node.Namespace)
+	assert.True(t, node.Default)
+	assert.Equal(t, ast.Position{Line: 1, Column: 8}, node.NamespacePos)
+	assert.Equal(t, "mathx", node.Specifier)
+	assert.Nil(t, node.Names)
+}
+
+func TestParseTest(t *testing.T) {
+	program, err := FE.Parse("test \"adds numbers\" {\n  assertEq(1 + 2, 3)\n}\n")
+	require.NoError(t, err)
+	require.Len(t, program.Body, 1)
+
+	fn := program.Body[0].(ast.FunctionDeclarationNode)
+	assert.Equal(t, "adds numbers", fn.TestName)
+	assert.Equal(t, ast.TestFunctionName("adds numbers"), fn.Name)
+	assert.Empty(t, fn.Params)
+	assert.Len(t, fn.Body, 1)
+	assert.Equal(t, ast.Position{Line: 1, Column: 1}, fn.Pos)
+	assert.Equal(t, ast.Position{Line: 1, Column: 6}, fn.NamePos)
+
+	// test is only a keyword before a string
+	program, err = FE.Parse("let test = 1\nprint(test)\n")
+	require.NoError(t, err)
+	assert.Equal(t, "test", program.Body[0].(ast.VariableDeclarationNode).Identifier)
+}
+
+func TestParseTestErrors(t *testing.T) {
+	for source, message := range map[string]string{
+		"fn f() {\n  test \"a\" {\n  }\n}\n": "Tests are only allowed at the top level of a module",
+		"test \"\" {\n}\n":                   "Expected the name of the test, got an empty string",
+		"test \"a\" {\n}\ntest \"a\" {\n}\n": "Test \"a\" is already declared",
+		"test \"a\"\n":                       "Expected the test body following its name",
+	} {
+		_, err := FE.Parse(source)
+		assert.ErrorContains(t, err, message, source)
+	}
+}
+
+func TestParseExports(t *testing.T) {
+	program, err := FE.Parse("export let a = 1\nexport const b = 2\nexport fn f() {\n}\nlet c = 3\n")
+	require.NoError(t, err)
+	require.Len(t, program.Body, 4)
+
+	a := program.Body[0].(ast.VariableDeclarationNode)
+	assert.True(t, a.Exported)
+	assert.Equal(t, ast.Position{Line: 1, Column: 1}, a.Pos)
+	assert.Equal(t, ast.Position{Line: 1, Column: 12}, a.NamePos)
+	assert.True(t, program.Body[1].(ast.VariableDeclarationNode).Exported)
+	assert.True(t, program.Body[2].(ast.FunctionDeclarationNode).Exported)
+	assert.False(t, program.Body[3].(ast.VariableDeclarationNode).Exported)
+}
+
+func TestParseModuleErrors(t *testing.T) {
+	for source, message := range map[string]string{
+		"if true {\n  import * as m from \"m\"\n}\n": "Imports are only allowed at the top level of a module",
+		"fn f() {\n  export let a = 1\n}\n":          "Exports are only allowed at the top level of a module",
+		"export a = 1\n":                             "Expected 'let', 'const' or 'fn' following 'export'",
+		"import 1 from \"m\"\n":                      "Expected '{', '*' or a name following 'import'",
+		"import { a } \"m\"\n":                       "Expected: 'from'",
+		"import * from \"m\"\n":                      "Expected: 'as'",
+		"import { a } from \"\"\n":                   "got an empty string",
+		"import { a } from \"m\" let b = 1\n":        "Import must end with a new line",
+	} {
+		_, err := FE.Parse(source)
+		assert.ErrorContains(t, err, message, source)
+	}
+}
@@ -0,0 +1,52 @@
+package test_frontend
+
+import (
+	FE "pop/frontend"
+	"pop/frontend/types/ast"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBlankLinesInBlocks(t *testing.T) {
+	program, err := FE.Parse("while x {\n\n  x = x - 1\n\n\n}\nwhile y {\n\n}\n")
+	require.NoError(t, err)
+	require.Len(t, program.Body, 2)
+
+	body := program.Body[0].(ast.WhileStatementNode).Body.(ast.BlockStatementNode)
+	assert.Len(t, body.Body, 1)
+	assert.Empty(t, program.Body[1].(ast.WhileStatementNode).Body.(ast.BlockStatementNode).Body)
+}
+
+func TestParsePop(t *testing.T) {
+	program, err := FE.Parse("fn f() {\n  pop\n  1\n}\nfn g() {\n  pop [1]\n}\nfn h() {\n  pop}\n")
+	require.NoError(t, err)
+	require.Len(t, program.Body, 3)
+
+	// A bare pop ends at the newline, so the next line is a statement
+	f := program.Body[0].(ast.FunctionDeclarationNode)
+	require.Len(t, f.Body, 2)
+	assert.Nil(t, f.Body[0].(ast.ReturnStatementNode).Value)
+
+	// Any expression can be popped, not just those starting with a name,
+	// a number or a (
+	g := program.Body[1].(ast.FunctionDeclarationNode)
+	assert.IsType(t, ast.ArrayLiteralExprNode{}, g.Body[0].(ast.ReturnStatementNode).Value)
+
+	h := program.Body[2].(ast.FunctionDeclarationNode)
+	assert.Nil(t, h.Body[0].(ast.ReturnStatementNode).Value)
+}
+
+func TestParseEmptyString(t *testing.T) {
+	program, err := FE.Parse("let s = \"\"\n[\"\", \"a\"]\n")
+	require.NoError(t, err)
+	require.Len(t, program.Body, 2)
+
+	s := program.Body[0].(ast.VariableDeclarationNode).Value.(ast.StringLiteralExprNode)
+	assert.Equal(t, "", s.Value)
+	elements := program.Body[1].(ast.ArrayLiteralExprNode).Elements
+	require.Len(t, elements, 2)
+	assert.Equal(t, "", elements[0].(ast.StringLiteralExprNode).Value)
+	assert.Equal(t, "a", elements[1].(ast.StringLiteralExprNode).Value)
+}
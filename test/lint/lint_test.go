@@ -0,0 +1,244 @@
+package lint_test
+
+import (
+	"os"
+	"path/filepath"
+	"pop/frontend/types/ast"
+	"pop/lint"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// found lists the diagnostics of one rule in source as "line:column message".
+func found(t *testing.T, source, rule string) []string {
+	t.Helper()
+	diagnostics, err := lint.Lint(source, lint.Config{})
+	require.NoError(t, err)
+	list := []string{}
+	for _, d := range diagnostics {
+		if d.Rule == rule {
+			list = append(list, ast.Position{Line: d.Pos.Line, Column: d.Pos.Column}.String()+" "+d.Message)
+		}
+	}
+	return list
+}
+
+// fixed returns source with the fixes of one rule made.
+func fixed(t *testing.T, source, rule string) string {
+	t.Helper()
+	diagnostics, err := lint.Lint(source, lint.Config{})
+	require.NoError(t, err)
+	var mine []lint.Diagnostic
+	for _, d := range diagnostics {
+		if d.Rule == rule {
+			mine = append(mine, d)
+		}
+	}
+	return lint.ApplyFixes(source, mine)
+}
+
+func TestRules(t *testing.T) {
+	var names []string
+	for _, rule := range lint.Rules() {
+		names = append(names, rule.Name)
+		assert.NotEmpty(t, rule.Doc, rule.Name)
+		assert.NotEqual(t, lint.Off, rule.Severity, rule.Name)
+	}
+	assert.Equal(t, []string{"unused-variable", "unused-parameter", "shadowing", "unreachable", "constant-condition",
+		"self-assign", "null-comparison", "empty-block", "missing-return"}, names)
+}
+
+func TestUnused(t *testing.T) {
+	source := "" +
+		"let a = 1\n" +
+		"let b = [1, { c: 2 }]\n" +
+		"let d = print(1)\n" +
+		"let e = 1\n" +
+		"e = 2\n" +
+		"fn f(x, z) {\n" +
+		"  pop x\n" +
+		"}\n" +
+		"print(b)\n" +
+		"try {\n" +
+		"  f(1)\n" +
+		"} catch err {\n" +
+		"  print(1)\n" +
+		"}\n" +
+		"let last = 1\n"
+	assert.Equal(t, []string{
+		"1:5 Variable 'a' is never used",
+		"3:5 Variable 'd' is never used",
+		"4:5 Variable 'e' is assigned to but never used",
+		"15:5 Variable 'last' is never used",
+	}, found(t, source, "unused-variable"))
+	assert.Equal(t, []string{
+		"6:9 Parameter 'z' is never used",
+		"12:9 Caught error 'err' is never used",
+	}, found(t, source, "unused-parameter"))
+
+	// Only declarations of values without effects go, and not the last
+	// statement, whose value the program returns
+	assert.Equal(t, ""+
+		"let b = [1, { c: 2 }]\n"+
+		"let d = print(1)\n"+
+		"let e = 1\n"+
+		"e = 2\n"+
+		"fn f(x, z) {\n"+
+		"  pop x\n"+
+		"}\n"+
+		"print(b)\n"+
+		"try {\n"+
+		"  f(1)\n"+
+		"} catch err {\n"+
+		"  print(1)\n"+
+		"}\n"+
+		"let last = 1\n", fixed(t, source, "unused-variable"))
+	assert.Contains(t, fixed(t, source, "unused-parameter"), "} catch {\n")
+
+	// Unused functions go whole, unless a comment is in the way
+	assert.Equal(t, "print(1)\n", fixed(t, "fn f() {\n  pop 1\n}\nprint(1)\n", "unused-variable"))
+	assert.Equal(t, "fn f() { // why\n  pop 1\n}\nprint(1)\n", fixed(t, "fn f() { // why\n  pop 1\n}\nprint(1)\n", "unused-variable"))
+}
+
+func TestUnusedTests(t *testing.T) {
+	// The test runner calls test blocks
+	assert.Empty(t, found(t, "test \"a\" {\n  assert(true)\n}\n", "unused-variable"))
+}
+
+func TestUnusedModules(t *testing.T) {
+	source := "import { a, b } from \"m\"\nimport * as ns from \"n\"\nexport let c = a\nexport fn f() {\n}\n"
+	assert.Equal(t, []string{
+		"1:13 Import 'b' is never used",
+		"2:13 Import 'ns' is never used",
+	}, found(t, source, "unused-variable"))
+	// Importing runs the module, so unused imports stay
+	assert.Equal(t, source, fixed(t, source, "unused-variable"))
+}
+
+func TestShadowing(t *testing.T) {
+	source := "let x = 1\nfn f(x) {\n  if x {\n    let y = 1\n    fn x() {}\n    pop y\n  }\n  pop 0\n}\nlet y = 2\nprint(f, y)\n"
+	assert.Equal(t, []string{
+		"2:6 'x' shadows the variable declared on line 1",
+		"4:9 'y' shadows the variable declared on line 10",
+		"5:8 'x' shadows the variable declared on line 2",
+	}, found(t, source, "shadowing"))
+}
+
+func TestUnreachable(t *testing.T) {
+	source := "fn f(a) {\n  if a {\n    throw \"no\"\n    print(1)\n  }\n  pop a\n  print(2)\n  print(3)\n}\npop 1\nprint(f)\n"
+	assert.Equal(t, []string{"4:5 Unreachable code", "7:3 Unreachable code"}, found(t, source, "unreachable"))
+	assert.Equal(t, "fn f(a) {\n  if a {\n    throw \"no\"\n  }\n  pop a\n}\npop 1\nprint(f)\n", fixed(t, source, "unreachable"))
+
+	// Code that declares something is left for a person to remove
+	source = "fn f() {\n  pop g\n  fn g() {}\n}\nprint(f)\n"
+	assert.Equal(t, source, fixed(t, source, "unreachable"))
+}
+
+func TestConstantCondition(t *testing.T) {
+	source := "let a = 1\nif true {\n  print(1)\n}\nif 1 + 2 > 2 {\n  print(2)\n}\nif [] {\n  print(3)\n}\nif a {\n  print(4)\n}\nwhile !false {\n  a = 1\n}\nwhile true {\n  pop\n}\n"
+	assert.Equal(t, []string{
+		"2:4 Condition is always the same",
+		"5:4 Condition is always the same",
+		"8:4 Condition is always the same",
+		"14:7 Condition is always the same",
+	}, found(t, source, "constant-condition"))
+}
+
+func TestSelfAssign(t *testing.T) {
+	source := "let a = { b: 1 }\nconst c = 1\na = a\na.b = a.b\na[\"b\"] = a[\"b\"]\na.b = a.c\nc = c\nprint(a)\n"
+	assert.Equal(t, []string{
+		"3:1 Assigns a value to itself",
+		"4:1 Assigns a value to itself",
+		"5:1 Assigns a value to itself",
+		"7:1 Assigns a value to itself",
+	}, found(t, source, "self-assign"))
+	// Reading a property may fail, and assigning to a constant does
+	assert.Equal(t, "let a = { b: 1 }\nconst c = 1\na.b = a.b\na[\"b\"] = a[\"b\"]\na.b = a.c\nc = c\nprint(a)\n", fixed(t, source, "self-assign"))
+}
+
+func TestNullComparison(t *testing.T) {
+	source := "let a = 1\nprint(a < null, null >= a, a == null, a != null, a is null)\n"
+	assert.Equal(t, []string{
+		"2:9 Comparing with null by < always throws; use == or !=",
+		"2:22 Comparing with null by >= always throws; use == or !=",
+		"2:52 Use == to compare with null",
+	}, found(t, source, "null-comparison"))
+	assert.Equal(t, "let a = 1\nprint(a < null, null >= a, a == null, a != null, a == null)\n", fixed(t, source, "null-comparison"))
+}
+
+func TestEmptyBlock(t *testing.T) {
+	source := "let a = 1\nif a {\n} else {\n}\nwhile a {\n  // waiting\n}\ntry {\n  print(a)\n} catch {}\nfn f() {}\nprint(f)\n"
+	assert.Equal(t, []string{
+		"2:6 Empty if block",
+		"3:8 Empty else block",
+		"10:9 Empty catch block",
+	}, found(t, source, "empty-block"))
+	assert.Equal(t, "let a = 1\nif a {\n}\nwhile a {\n  // waiting\n}\ntry {\n  print(a)\n} catch {}\nfn f() {}\nprint(f)\n", fixed(t, source, "empty-block"))
+}
+
+func TestMissingReturn(t *testing.T) {
+	source := "" +
+		"fn a(x) {\n  if x {\n    pop 1\n  }\n}\n" +
+		"fn b(x) {\n  if x {\n    pop 1\n  }\n  pop\n}\n" +
+		"fn c(x) {\n  if x {\n    pop 1\n  } else {\n    throw \"no\"\n  }\n}\n" +
+		"fn d(x) {\n  while true {\n    pop x\n  }\n}\n" +
+		"fn e(x) {\n  fn inner() {\n    pop 1\n  }\n  print(x)\n}\n" +
+		"print(a, b, c, d, e)\n"
+	assert.Equal(t, []string{
+		"1:4 Function 'a' pops a value on some paths but not on others",
+		"6:4 Function 'b' pops a value on some paths but not on others",
+	}, found(t, source, "missing-return"))
+}
+
+func TestIgnore(t *testing.T) {
+	source := "" +
+		"let a = 1 // lint:ignore unused-variable\n" +
+		"// lint:ignore unused-variable, shadowing kept for the REPL\n" +
+		"let b = 1\n" +
+		"// lint:ignore shadowing\n" +
+		"let c = 1\n"
+	assert.Equal(t, []string{"5:5 Variable 'c' is never used"}, found(t, source, "unused-variable"))
+}
+
+func TestConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lint.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"rules": {"unused-variable": "error", "empty-block": "off"}}`), 0o644))
+	config, err := lint.LoadConfig(path)
+	require.NoError(t, err)
+
+	diagnostics, err := lint.Lint("let a = 1\nlet b = 2\nif b {}\nprint(2)\n", config)
+	require.NoError(t, err)
+	require.Len(t, diagnostics, 1)
+	assert.Equal(t, "unused-variable", diagnostics[0].Rule)
+	assert.Equal(t, lint.Error, diagnostics[0].Severity)
+	assert.Equal(t, "1:5: error: Variable 'a' is never used (unused-variable)", diagnostics[0].String())
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"rules": {"unused": "off"}}`), 0o644))
+	_, err = lint.LoadConfig(path)
+	assert.ErrorContains(t, err, `unknown rule "unused"`)
+	require.NoError(t, os.WriteFile(path, []byte(`{"rules": {"shadowing": "loud"}}`), 0o644))
+	_, err = lint.LoadConfig(path)
+	assert.ErrorContains(t, err, `unknown severity "loud"`)
+
+	_, err = lint.Lint("let = 1\n", lint.Config{})
+	assert.Error(t, err)
+}
+
+func TestRegister(t *testing.T) {
+	lint.Register(&lint.Rule{
+		Name:     "no-print",
+		Doc:      "Calls of print",
+		Severity: lint.Info,
+		Check: func(p *lint.Pass) {
+			for _, ref := range p.Symbols.References {
+				if ref.Name == "print" {
+					p.Report(ref.Pos, lint.Span(ref.Pos, ref.Name), "Call of print", nil)
+				}
+			}
+		},
+	})
+	assert.Equal(t, []string{"1:1 Call of print"}, found(t, "print(1)\n", "no-print"))
+	assert.Panics(t, func() { lint.Register(&lint.Rule{Name: "no-print"}) })
+}
@@ -0,0 +1,711 @@
+package lsp_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"pop/lsp/server"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// at is the range from line:start to line:end, all zero-based.
+func at(line, start, end int) server.Range {
+	return server.Range{Start: server.Position{Line: line, Character: start}, End: server.Position{Line: line, Character: end}}
+}
+
+func TestDiagnose(t *testing.T) {
+	type diagnostic struct {
+		Range    server.Range
+		Severity server.DiagnosticSeverity
+		Code     string
+	}
+	for _, test := range []struct {
+		name   string
+		source string
+		want   []diagnostic
+	}{
+		{"Clean", "let x = 1\nprint(x)\n", nil},
+		{"SyntaxErrors", "let x = (1 +\nprint(x)\nlet = 2\n", []diagnostic{
+			{at(0, 12, 13), server.SeverityError, "syntax"},
+			{at(2, 4, 5), server.SeverityError, "syntax"},
+		}},
+		{"EveryUndeclaredUse", "print(totl)\ntotl\n", []diagnostic{
+			{at(0, 6, 10), server.SeverityError, "undeclared"},
+			{at(1, 0, 4), server.SeverityError, "undeclared"},
+		}},
+		{"UseBeforeDeclaration", "print(rate)\nlet rate = 2\n", []diagnostic{
+			{at(0, 6, 10), server.SeverityError, "use-before-declaration"},
+		}},
+		{"ConstReassignment", "const max = 1\nfn f(max) {\n  max = 2\n}\nmax = 3\n", []diagnostic{
+			{at(4, 0, 3), server.SeverityWarning, "const-assign"},
+		}},
+		{"UnreachableCode", "fn f(x) {\n  pop x\n  print(x)\n  if x {\n    x\n  } else {\n    x\n  }\n}\n", []diagnostic{
+			{server.Range{Start: server.Position{Line: 2, Character: 2}, End: server.Position{Line: 7, Character: 3}}, server.SeverityWarning, "unreachable"},
+		}},
+		{"UnreachableAfterThrow", "if true {\n  throw \"no\"\n  1 + 2\n}\n", []diagnostic{
+			{at(2, 2, 7), server.SeverityWarning, "unreachable"},
+		}},
+		{"TypeMismatch", "let n: number = \"a\"\nfn f(a: string) {\n}\nf(n)\n", []diagnostic{
+			{at(0, 16, 19), server.SeverityError, "type"},
+			{at(3, 2, 3), server.SeverityError, "type"},
+		}},
+		{"Unicode", "let s = \"héllo 🍿\"; print(s)\n", []diagnostic{
+			// Characters are counted in UTF-16 units: the emoji takes two
+			{at(0, 18, 19), server.SeverityError, "syntax"},
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var got []diagnostic
+			for _, d := range server.Diagnose(test.source) {
+				assert.Equal(t, "popcorn", d.Source)
+				assert.NotEmpty(t, d.Message)
+				got = append(got, diagnostic{d.Range, d.Severity, d.Code})
+			}
+			assert.Equal(t, test.want, got)
+		})
+	}
+
+	// Declarations survive syntax errors in their value, so their uses are
+	// not reported as undeclared
+	for _, d := range server.Diagnose("let total = (1 +\nprint(total)\n") {
+		assert.Equal(t, "syntax", d.Code)
+	}
+
+	assert.Equal(t, "Cannot reassign constant variable 'max', declared on line 1", server.Diagnose("const max = 1\nmax = 2\n")[0].Message)
+	assert.Equal(t, []server.DiagnosticTag{server.TagUnnecessary}, server.Diagnose("fn f() {\n  pop 1\n  2\n}\n")[0].Tags)
+}
+
+// client is the client end of a connection to a server.
+type client struct {
+	conn        *jsonrpc2.Conn
+	diagnostics chan server.PublishDiagnosticsParams
+}
+
+func connect(t *testing.T) *client {
+	t.Helper()
+	serverEnd, clientEnd := net.Pipe()
+	ctx := context.Background()
+
+	serverConn := jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(serverEnd, jsonrpc2.VSCodeObjectCodec{}), jsonrpc2.HandlerWithError(server.New().Handle))
+	c := &client{diagnostics: make(chan server.PublishDiagnosticsParams, 10)}
+	c.conn = jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(clientEnd, jsonrpc2.VSCodeObjectCodec{}), jsonrpc2.HandlerWithError(
+		func(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error) {
+			if req.Method == "textDocument/publishDiagnostics" {
+				var params server.PublishDiagnosticsParams
+				require.NoError(t, json.Unmarshal(*req.Params, &params))
+				c.diagnostics <- params
+			}
+			return nil, nil
+		}))
+	t.Cleanup(func() {
+		c.conn.Close()
+		serverConn.Close()
+	})
+	return c
+}
+
+func (c *client) call(t *testing.T, method string, params, result any) error {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return c.conn.Call(ctx, method, params, result)
+}
+
+func (c *client) notify(t *testing.T, method string, params any) {
+	t.Helper()
+	require.NoError(t, c.conn.Notify(context.Background(), method, params))
+}
+
+// published waits for the next diagnostics the server publishes.
+func (c *client) published(t *testing.T) server.PublishDiagnosticsParams {
+	t.Helper()
+	select {
+	case params := <-c.diagnostics:
+		return params
+	case <-time.After(5 * time.Second):
+		t.Fatal("no diagnostics published")
+		return server.PublishDiagnosticsParams{}
+	}
+}
+
+func TestDocumentSync(t *testing.T) {
+	c := connect(t)
+	const uri = "file:///tmp/main.pop"
+
+	var init server.InitializeResult
+	require.NoError(t, c.call(t, "initialize", map[string]any{}, &init))
+	assert.Equal(t, server.TextDocumentSyncOptions{OpenClose: true, Change: server.SyncIncremental}, init.Capabilities.TextDocumentSync)
+	c.notify(t, "initialized", map[string]any{})
+
+	c.notify(t, "textDocument/didOpen", server.DidOpenTextDocumentParams{
+		TextDocument: server.TextDocumentItem{URI: uri, LanguageID: "popcorn", Version: 1, Text: "let count = 1\nprint(cont)\n"},
+	})
+	params := c.published(t)
+	assert.Equal(t, uri, params.URI)
+	require.NotNil(t, params.Version)
+	assert.Equal(t, 1, *params.Version)
+	require.Len(t, params.Diagnostics, 1)
+	assert.Equal(t, at(1, 6, 10), params.Diagnostics[0].Range)
+	assert.Equal(t, "Undeclared variable 'cont'", params.Diagnostics[0].Message)
+
+	// An incremental change fixes the typo
+	fix := at(1, 6, 10)
+	c.notify(t, "textDocument/didChange", server.DidChangeTextDocumentParams{
+		TextDocument:   server.VersionedTextDocumentIdentifier{URI: uri, Version: 2},
+		ContentChanges: []server.TextDocumentContentChangeEvent{{Range: &fix, Text: "count"}},
+	})
+	params = c.published(t)
+	assert.Equal(t, 2, *params.Version)
+	assert.Empty(t, params.Diagnostics)
+
+	// A full change replaces the text
+	c.notify(t, "textDocument/didChange", server.DidChangeTextDocumentParams{
+		TextDocument:   server.VersionedTextDocumentIdentifier{URI: uri, Version: 3},
+		ContentChanges: []server.TextDocumentContentChangeEvent{{Text: "const count = 1\ncount = 2\n"}},
+	})
+	params = c.published(t)
+	require.Len(t, params.Diagnostics, 1)
+	assert.Equal(t, "const-assign", params.Diagnostics[0].Code)
+
+	// Closing the document clears its diagnostics
+	c.notify(t, "textDocument/didClose", map[string]any{"textDocument": map[string]any{"uri": uri}})
+	params = c.published(t)
+	assert.Equal(t, uri, params.URI)
+	assert.NotNil(t, params.Diagnostics)
+	assert.Empty(t, params.Diagnostics)
+
+	err := c.call(t, "textDocument/unknown", map[string]any{}, nil)
+	var rpcErr *jsonrpc2.Error
+	require.ErrorAs(t, err, &rpcErr)
+	assert.Equal(t, int64(jsonrpc2.CodeMethodNotFound), rpcErr.Code)
+
+	require.NoError(t, c.call(t, "shutdown", nil, nil))
+}
+
+// open opens a document with text and waits for its diagnostics.
+func (c *client) open(t *testing.T, uri, text string) {
+	t.Helper()
+	c.notify(t, "textDocument/didOpen", server.DidOpenTextDocumentParams{
+		TextDocument: server.TextDocumentItem{URI: uri, LanguageID: "popcorn", Version: 1, Text: text},
+	})
+	c.published(t)
+}
+
+func TestNavigation(t *testing.T) {
+	c := connect(t)
+	const uri = "file:///tmp/nav.pop"
+	c.open(t, uri, ""+
+		"let count = 0\n"+ // 0
+		"fn counter(step) {\n"+ // 1
+		"  let count = step\n"+ // 2
+		"  fn bump() {\n"+ // 3
+		"    count = count + step\n"+ // 4
+		"    pop count\n"+ // 5
+		"  }\n"+ // 6
+		"  if step > 1 {\n"+ // 7
+		"    let count = 1\n"+ // 8
+		"    print(count)\n"+ // 9
+		"  }\n"+ // 10
+		"  pop bump\n"+ // 11
+		"}\n"+ // 12
+		"print(count, counter(2)())\n") // 13
+
+	position := func(line, character int) server.TextDocumentPositionParams {
+		return server.TextDocumentPositionParams{
+			TextDocument: server.TextDocumentIdentifier{URI: uri},
+			Position:     server.Position{Line: line, Character: character},
+		}
+	}
+	definition := func(line, character int) *server.Location {
+		var loc *server.Location
+		require.NoError(t, c.call(t, "textDocument/definition", position(line, character), &loc))
+		return loc
+	}
+
+	t.Run("Definition", func(t *testing.T) {
+		// The closure sees the count of counter, not the global
+		assert.Equal(t, &server.Location{URI: uri, Range: at(2, 6, 11)}, definition(4, 14))
+		// Also from just after the name
+		assert.Equal(t, &server.Location{URI: uri, Range: at(2, 6, 11)}, definition(5, 13))
+		// The if block shadows it
+		assert.Equal(t, &server.Location{URI: uri, Range: at(8, 8, 13)}, definition(9, 12))
+		assert.Equal(t, &server.Location{URI: uri, Range: at(0, 4, 9)}, definition(13, 7))
+		assert.Equal(t, &server.Location{URI: uri, Range: at(1, 11, 15)}, definition(4, 22))
+		assert.Equal(t, &server.Location{URI: uri, Range: at(1, 3, 10)}, definition(13, 14))
+
+		// Natives and anything that is not a variable have no definition
+		assert.Nil(t, definition(13, 2))
+		assert.Nil(t, definition(7, 0))
+	})
+
+	t.Run("References", func(t *testing.T) {
+		params := server.ReferenceParams{TextDocumentPositionParams: position(2, 7)}
+		var locations []server.Location
+		require.NoError(t, c.call(t, "textDocument/references", params, &locations))
+		assert.Equal(t, []server.Location{
+			{URI: uri, Range: at(4, 4, 9)},
+			{URI: uri, Range: at(4, 12, 17)},
+			{URI: uri, Range: at(5, 8, 13)},
+		}, locations)
+
+		params.Context.IncludeDeclaration = true
+		require.NoError(t, c.call(t, "textDocument/references", params, &locations))
+		assert.Len(t, locations, 4)
+		assert.Equal(t, at(2, 6, 11), locations[0].Range)
+
+		// The global count is used once
+		params = server.ReferenceParams{TextDocumentPositionParams: position(0, 5)}
+		require.NoError(t, c.call(t, "textDocument/references", params, &locations))
+		assert.Equal(t, []server.Location{{URI: uri, Range: at(13, 6, 11)}}, locations)
+	})
+
+	t.Run("DocumentHighlight", func(t *testing.T) {
+		var found []server.DocumentHighlight
+		require.NoError(t, c.call(t, "textDocument/documentHighlight", position(5, 9), &found))
+		assert.Equal(t, []server.DocumentHighlight{
+			{Range: at(2, 6, 11), Kind: server.HighlightWrite},
+			{Range: at(4, 4, 9), Kind: server.HighlightWrite},
+			{Range: at(4, 12, 17), Kind: server.HighlightRead},
+			{Range: at(5, 8, 13), Kind: server.HighlightRead},
+		}, found)
+
+		// Natives are highlighted by name
+		require.NoError(t, c.call(t, "textDocument/documentHighlight", position(9, 5), &found))
+		assert.Equal(t, []server.DocumentHighlight{
+			{Range: at(9, 4, 9), Kind: server.HighlightRead},
+			{Range: at(13, 0, 5), Kind: server.HighlightRead},
+		}, found)
+	})
+
+	err := c.call(t, "textDocument/definition", server.TextDocumentPositionParams{TextDocument: server.TextDocumentIdentifier{URI: "file:///closed.pop"}}, nil)
+	assert.ErrorContains(t, err, "document is not open")
+}
+
+func TestHover(t *testing.T) {
+	c := connect(t)
+	const uri = "file:///tmp/hover.pop"
+	c.open(t, uri, ""+
+		"// The ratio of a circle's circumference\n"+ // 0
+		"// to its diameter.\n"+ // 1
+		"const PI = 3\n"+ // 2
+		"// add sums two numbers.\n"+ // 3
+		"fn add(a, b) {\n"+ // 4
+		"  pop a + b\n"+ // 5
+		"}\n"+ // 6
+		"let total = add(PI, 1)\n"+ // 7
+		"try {\n"+ // 8
+		"  throw total\n"+ // 9
+		"} catch err {\n"+ // 10
+		"  print(err)\n"+ // 11
+		"}\n") // 12
+
+	hover := func(line, character int) *server.Hover {
+		var h *server.Hover
+		params := server.TextDocumentPositionParams{
+			TextDocument: server.TextDocumentIdentifier{URI: uri},
+			Position:     server.Position{Line: line, Character: character},
+		}
+		require.NoError(t, c.call(t, "textDocument/hover", params, &h))
+		return h
+	}
+	code := func(signature string) string { return "```popcorn\n" + signature + "\n```" }
+
+	h := hover(7, 17)
+	require.NotNil(t, h)
+	assert.Equal(t, "markdown", h.Contents.Kind)
+	assert.Equal(t, code("const PI")+"\n\nThe ratio of a circle's circumference\nto its diameter.", h.Contents.Value)
+	r := at(7, 16, 18)
+	assert.Equal(t, &r, h.Range)
+
+	assert.Equal(t, code("fn add(a, b)")+"\n\nadd sums two numbers.", hover(7, 12).Contents.Value)
+	assert.Equal(t, code("fn add(a, b)")+"\n\nadd sums two numbers.", hover(4, 4).Contents.Value)
+	assert.Equal(t, code("let total"), hover(7, 5).Contents.Value)
+	assert.Equal(t, code("(parameter) a"), hover(5, 6).Contents.Value)
+	assert.Equal(t, code("(catch) err"), hover(11, 9).Contents.Value)
+	assert.Equal(t, code("(builtin) fn print"), hover(11, 3).Contents.Value)
+
+	c.open(t, "file:///tmp/typed.pop", "let n: number? = null\nfn f(a: number): string {\n  pop \"\"\n}\nf(n || 1)\n")
+	typed := func(line, character int) string {
+		var h *server.Hover
+		params := server.TextDocumentPositionParams{
+			TextDocument: server.TextDocumentIdentifier{URI: "file:///tmp/typed.pop"},
+			Position:     server.Position{Line: line, Character: character},
+		}
+		require.NoError(t, c.call(t, "textDocument/hover", params, &h))
+		return h.Contents.Value
+	}
+	assert.Equal(t, code("let n: number?"), typed(4, 2))
+	assert.Equal(t, code("fn f(a: number): string"), typed(4, 0))
+
+	c.open(t, "file:///tmp/imports.pop", "import { a, b as c } from \"./m.pop\"\nimport * as ns from \"./n.pop\"\nprint(a, c, ns)\n")
+	imported := func(line, character int) string {
+		var h *server.Hover
+		params := server.TextDocumentPositionParams{
+			TextDocument: server.TextDocumentIdentifier{URI: "file:///tmp/imports.pop"},
+			Position:     server.Position{Line: line, Character: character},
+		}
+		require.NoError(t, c.call(t, "textDocument/hover", params, &h))
+		return h.Contents.Value
+	}
+	assert.Equal(t, code(`import { a } from "./m.pop"`), imported(2, 6))
+	assert.Equal(t, code(`import { b as c } from "./m.pop"`), imported(2, 9))
+	assert.Equal(t, code(`import * as ns from "./n.pop"`), imported(2, 12))
+
+	// Keywords and literals are not variables
+	assert.Nil(t, hover(5, 3))
+	assert.Nil(t, hover(7, 21))
+}
+
+func TestSignatureHelp(t *testing.T) {
+	c := connect(t)
+	const uri = "file:///tmp/signature.pop"
+	c.open(t, uri, ""+
+		"// area of a rectangle\n"+ // 0
+		"fn area(width, height) {\n"+ // 1
+		"  pop width * height\n"+ // 2
+		"}\n"+ // 3
+		"print(area(print(1, 2), [3, 4]))\n"+ // 4
+		"area(1, \n") // 5
+
+	help := func(line, character int) *server.SignatureHelp {
+		var h *server.SignatureHelp
+		params := server.TextDocumentPositionParams{
+			TextDocument: server.TextDocumentIdentifier{URI: uri},
+			Position:     server.Position{Line: line, Character: character},
+		}
+		require.NoError(t, c.call(t, "textDocument/signatureHelp", params, &h))
+		return h
+	}
+
+	h := help(4, 11)
+	require.NotNil(t, h)
+	assert.Equal(t, []server.SignatureInformation{{
+		Label:         "fn area(width, height)",
+		Documentation: "area of a rectangle",
+		Parameters:    []server.ParameterInformation{{Label: "width"}, {Label: "height"}},
+	}}, h.Signatures)
+	assert.Equal(t, 0, h.ActiveParameter)
+
+	// Commas inside nested calls and arrays do not count
+	assert.Equal(t, 1, help(4, 24).ActiveParameter)
+	assert.Equal(t, 1, help(4, 30).ActiveParameter)
+	// Also in a call still being typed
+	assert.Equal(t, 1, help(5, 8).ActiveParameter)
+
+	// Natives have no signature, array elements are not arguments, and a
+	// declaration is not a call
+	assert.Nil(t, help(4, 19))
+	assert.Nil(t, help(4, 25))
+	assert.Nil(t, help(1, 8))
+	assert.Nil(t, help(2, 5))
+}
+
+func TestCompletion(t *testing.T) {
+	c := connect(t)
+	const uri = "file:///tmp/completion.pop"
+	c.open(t, uri, ""+
+		"let config = {name: \"pop\", limits: {depth: 3, width: 4}}\n"+ // 0
+		"fn area(width, height) {\n"+ // 1
+		"  let result = width * height\n"+ // 2
+		"  pop result\n"+ // 3
+		"}\n"+ // 4
+		"let later = 1\n"+ // 5
+		"config.\n"+ // 6
+		"config.limits.d\n"+ // 7
+		"clock.\n"+ // 8
+		"later.\n") // 9
+
+	complete := func(line, character int) map[string]server.CompletionItem {
+		var list server.CompletionList
+		params := server.TextDocumentPositionParams{
+			TextDocument: server.TextDocumentIdentifier{URI: uri},
+			Position:     server.Position{Line: line, Character: character},
+		}
+		require.NoError(t, c.call(t, "textDocument/completion", params, &list))
+		items := map[string]server.CompletionItem{}
+		for _, item := range list.Items {
+			items[item.Label] = item
+		}
+		return items
+	}
+	labels := func(items map[string]server.CompletionItem) []string {
+		var found []string
+		for label := range items {
+			found = append(found, label)
+		}
+		sort.Strings(found)
+		return found
+	}
+
+	t.Run("Scope", func(t *testing.T) {
+		items := complete(3, 2)
+		for _, name := range []string{"result", "width", "height", "area", "config", "later"} {
+			assert.Contains(t, items, name)
+		}
+		assert.Equal(t, server.CompletionItem{Label: "area", Kind: server.CompletionFunction, Detail: "fn area(width, height)"}, items["area"])
+		assert.Equal(t, server.CompletionVariable, items["width"].Kind)
+		assert.Equal(t, server.CompletionItem{Label: "print", Kind: server.CompletionFunction, Detail: "(builtin) fn print"}, items["print"])
+		assert.Equal(t, server.CompletionModule, items["fs"].Kind)
+		assert.Equal(t, server.CompletionItem{Label: "while", Kind: server.CompletionKeyword}, items["while"])
+
+		// Outside the function its variables are gone, and top-level
+		// variables are only visible after their declaration
+		items = complete(5, 0)
+		assert.Contains(t, items, "config")
+		assert.Contains(t, items, "area")
+		assert.NotContains(t, items, "result")
+		assert.NotContains(t, items, "width")
+		assert.NotContains(t, items, "later")
+	})
+
+	t.Run("Properties", func(t *testing.T) {
+		assert.Equal(t, []string{"limits", "name"}, labels(complete(6, 7)))
+		assert.Equal(t, []string{"depth", "width"}, labels(complete(7, 15)))
+		assert.Equal(t, []string{"now"}, labels(complete(8, 6)))
+		// Nothing is known of the properties of other values
+		assert.Empty(t, complete(9, 6))
+	})
+}
+
+func TestRename(t *testing.T) {
+	c := connect(t)
+	const uri = "file:///tmp/rename.pop"
+	c.open(t, uri, ""+
+		"let total = 0\n"+ // 0
+		"fn add(value) {\n"+ // 1
+		"  let result = {total, value}\n"+ // 2
+		"  total = total + value\n"+ // 3
+		"  pop result\n"+ // 4
+		"}\n"+ // 5
+		"let r = add(2)\n"+ // 6
+		"print(r.total)\n") // 7
+
+	position := func(line, character int) server.TextDocumentPositionParams {
+		return server.TextDocumentPositionParams{
+			TextDocument: server.TextDocumentIdentifier{URI: uri},
+			Position:     server.Position{Line: line, Character: character},
+		}
+	}
+	rename := func(line, character int, newName string) (*server.WorkspaceEdit, error) {
+		var edit *server.WorkspaceEdit
+		err := c.call(t, "textDocument/rename", server.RenameParams{TextDocumentPositionParams: position(line, character), NewName: newName}, &edit)
+		return edit, err
+	}
+
+	t.Run("PrepareRename", func(t *testing.T) {
+		var result *server.PrepareRenameResult
+		require.NoError(t, c.call(t, "textDocument/prepareRename", position(3, 3), &result))
+		assert.Equal(t, &server.PrepareRenameResult{Range: at(3, 2, 7), Placeholder: "total"}, result)
+
+		// Keywords and properties are not names
+		require.NoError(t, c.call(t, "textDocument/prepareRename", position(4, 3), &result))
+		assert.Nil(t, result)
+		require.NoError(t, c.call(t, "textDocument/prepareRename", position(7, 9), &result))
+		assert.Nil(t, result)
+
+		err := c.call(t, "textDocument/prepareRename", position(7, 2), &result)
+		assert.ErrorContains(t, err, "cannot rename builtin 'print'")
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		edit, err := rename(0, 5, "sum")
+		require.NoError(t, err)
+		// The shorthand property keeps its key, and the property of the
+		// result is not the variable
+		assert.Equal(t, map[string][]server.TextEdit{uri: {
+			{Range: at(0, 4, 9), NewText: "sum"},
+			{Range: at(2, 16, 21), NewText: "total: sum"},
+			{Range: at(3, 2, 7), NewText: "sum"},
+			{Range: at(3, 10, 15), NewText: "sum"},
+		}}, edit.Changes)
+
+		edit, err = rename(1, 8, "amount")
+		require.NoError(t, err)
+		assert.Len(t, edit.Changes[uri], 3)
+	})
+
+	t.Run("Conflicts", func(t *testing.T) {
+		for _, tt := range []struct {
+			name            string
+			line, character int
+			newName         string
+			err             string
+		}{
+			{"Keyword", 0, 5, "let", "'let' is not a valid name"},
+			{"NotAName", 0, 5, "a b", "'a b' is not a valid name"},
+			{"SameScope", 2, 7, "value", "'value' is already declared in this scope, on line 2"},
+			{"Hidden", 0, 5, "value", "'total' would be hidden on line 3 by the variable of that name declared on line 2"},
+			{"Hides", 1, 8, "total", "renaming 'value' would hide the 'total' used on line 3"},
+			{"HidesBuiltin", 1, 4, "print", "renaming 'add' would hide the 'print' used on line 8"},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := rename(tt.line, tt.character, tt.newName)
+				var rpcErr *jsonrpc2.Error
+				require.ErrorAs(t, err, &rpcErr)
+				assert.Equal(t, int64(server.CodeRequestFailed), rpcErr.Code)
+				assert.Equal(t, tt.err, rpcErr.Message)
+			})
+		}
+	})
+}
+
+func TestDocumentStructure(t *testing.T) {
+	c := connect(t)
+	const uri = "file:///tmp/structure.pop"
+	c.open(t, uri, ""+
+		"const LIMIT = 10\n"+ // 0
+		"fn outer(a) {\n"+ // 1
+		"  if a {\n"+ // 2
+		"    fn inner() {\n"+ // 3
+		"      pop 1\n"+ // 4
+		"    }\n"+ // 5
+		"  }\n"+ // 6
+		"  pop a\n"+ // 7
+		"}\n"+ // 8
+		"let data = [\n"+ // 9
+		"  1,\n"+ // 10
+		"  {x: 1,\n"+ // 11
+		"  y: 2}\n"+ // 12
+		"]\n") // 13
+	params := server.DocumentParams{TextDocument: server.TextDocumentIdentifier{URI: uri}}
+
+	t.Run("DocumentSymbol", func(t *testing.T) {
+		var symbols []server.DocumentSymbol
+		require.NoError(t, c.call(t, "textDocument/documentSymbol", params, &symbols))
+		span := func(fromLine, fromChar, toLine, toChar int) server.Range {
+			return server.Range{Start: server.Position{Line: fromLine, Character: fromChar}, End: server.Position{Line: toLine, Character: toChar}}
+		}
+		assert.Equal(t, []server.DocumentSymbol{
+			{Name: "LIMIT", Kind: server.SymbolConstant, Range: at(0, 0, 16), SelectionRange: at(0, 6, 11), Children: []server.DocumentSymbol{}},
+			{Name: "outer", Detail: "(a)", Kind: server.SymbolFunction, Range: span(1, 0, 8, 1), SelectionRange: at(1, 3, 8), Children: []server.DocumentSymbol{
+				{Name: "inner", Detail: "()", Kind: server.SymbolFunction, Range: span(3, 4, 5, 5), SelectionRange: at(3, 7, 12), Children: []server.DocumentSymbol{}},
+			}},
+			{Name: "data", Kind: server.SymbolVariable, Range: span(9, 0, 13, 1), SelectionRange: at(9, 4, 8), Children: []server.DocumentSymbol{}},
+		}, symbols)
+	})
+
+	t.Run("FoldingRange", func(t *testing.T) {
+		var ranges []server.FoldingRange
+		require.NoError(t, c.call(t, "textDocument/foldingRange", params, &ranges))
+		// The object spans two lines, which leaves nothing to fold
+		assert.Equal(t, []server.FoldingRange{
+			{StartLine: 1, EndLine: 7},
+			{StartLine: 2, EndLine: 5},
+			{StartLine: 3, EndLine: 4},
+			{StartLine: 9, EndLine: 12},
+		}, ranges)
+	})
+}
+
+func TestSemanticTokens(t *testing.T) {
+	c := connect(t)
+	const uri = "file:///tmp/semantic.pop"
+	c.open(t, uri, ""+
+		"const PI = 3\n"+ // 0
+		"fn f(x) {\n"+ // 1
+		"  pop print(PI, x, fs.read, \"😀\")\n"+ // 2
+		"}\n"+ // 3
+		"let o = {k: PI}\n"+ // 4
+		"test \"t\" {\n}\n") // 5
+
+	var result server.InitializeResult
+	require.NoError(t, c.call(t, "initialize", map[string]any{}, &result))
+	legend := result.Capabilities.SemanticTokensProvider.Legend
+	modifiers := func(names ...string) uint32 {
+		var bits uint32
+		for _, name := range names {
+			for i, modifier := range legend.TokenModifiers {
+				if modifier == name {
+					bits |= 1 << i
+				}
+			}
+		}
+		return bits
+	}
+
+	var tokens server.SemanticTokens
+	require.NoError(t, c.call(t, "textDocument/semanticTokens/full", server.DocumentParams{TextDocument: server.TextDocumentIdentifier{URI: uri}}, &tokens))
+	require.Zero(t, len(tokens.Data)%5)
+
+	// Undo the relative encoding
+	type token struct {
+		line, character, length uint32
+		kind                    string
+		modifiers               uint32
+	}
+	var got []token
+	var line, character uint32
+	for i := 0; i < len(tokens.Data); i += 5 {
+		d := tokens.Data[i : i+5]
+		if d[0] > 0 {
+			character = 0
+		}
+		line += d[0]
+		character += d[1]
+		got = append(got, token{line, character, d[2], legend.TokenTypes[d[3]], d[4]})
+	}
+
+	assert.Equal(t, []token{
+		{0, 0, 5, "keyword", 0},
+		{0, 6, 2, "variable", modifiers("declaration", "readonly")},
+		{0, 9, 1, "operator", 0},
+		{0, 11, 1, "number", 0},
+		{1, 0, 2, "keyword", 0},
+		{1, 3, 1, "function", modifiers("declaration")},
+		{1, 5, 1, "parameter", modifiers("declaration")},
+		{2, 2, 3, "keyword", 0},
+		{2, 6, 5, "function", modifiers("defaultLibrary")},
+		{2, 12, 2, "variable", modifiers("readonly")},
+		{2, 16, 1, "parameter", 0},
+		{2, 19, 2, "namespace", modifiers("defaultLibrary")},
+		{2, 22, 4, "property", 0},
+		// The emoji takes two UTF-16 code units
+		{2, 28, 4, "string", 0},
+		{4, 0, 3, "keyword", 0},
+		{4, 4, 1, "variable", modifiers("declaration")},
+		{4, 6, 1, "operator", 0},
+		{4, 9, 1, "property", 0},
+		{4, 12, 2, "variable", modifiers("readonly")},
+		// test is only a keyword before the name of a test block
+		{5, 0, 4, "keyword", 0},
+		{5, 5, 3, "string", 0},
+	}, got)
+}
+
+func TestFormatting(t *testing.T) {
+	c := connect(t)
+	const uri = "file:///tmp/formatting.pop"
+	c.open(t, uri, "let  a=[1,2] // numbers\nprint( a )")
+	params := server.DocumentFormattingParams{
+		TextDocument: server.TextDocumentIdentifier{URI: uri},
+		Options:      server.FormattingOptions{TabSize: 4, InsertSpaces: true},
+	}
+
+	// The whole document is replaced
+	var edits []server.TextEdit
+	require.NoError(t, c.call(t, "textDocument/formatting", params, &edits))
+	assert.Equal(t, []server.TextEdit{{
+		Range:   server.Range{End: server.Position{Line: 1, Character: 10}},
+		NewText: "let a = [1, 2] // numbers\nprint(a)\n",
+	}}, edits)
+
+	// A formatted document needs no edits
+	c.notify(t, "textDocument/didChange", server.DidChangeTextDocumentParams{
+		TextDocument:   server.VersionedTextDocumentIdentifier{URI: uri, Version: 2},
+		ContentChanges: []server.TextDocumentContentChangeEvent{{Text: edits[0].NewText}},
+	})
+	c.published(t)
+	require.NoError(t, c.call(t, "textDocument/formatting", params, &edits))
+	assert.Empty(t, edits)
+
+	c.open(t, "file:///tmp/broken.pop", "let = 1\n")
+	params.TextDocument.URI = "file:///tmp/broken.pop"
+	err := c.call(t, "textDocument/formatting", params, &edits)
+	assert.ErrorContains(t, err, "Expected identifier name")
+}
@@ -0,0 +1,231 @@
+package optimizer_test
+
+import (
+	"bytes"
+	"errors"
+	BE "pop/backend"
+	C "pop/compiler"
+	FE "pop/frontend"
+	"pop/optimizer"
+	"pop/vm"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// outcome is everything observable about a run.
+type outcome struct {
+	Result    string
+	Stdout    string
+	Error     string
+	Name      string
+	Traceback string
+}
+
+func run(opts BE.Options, source string) outcome {
+	var stdout bytes.Buffer
+	opts.Stdout = &stdout
+	result, err := BE.NewInterpreter(opts).RunString(source)
+
+	out := outcome{Stdout: stdout.String()}
+	if err != nil {
+		out.Error = err.Error()
+		var runtimeErr *BE.RuntimeError
+		if errors.As(err, &runtimeErr) {
+			out.Name = runtimeErr.Name
+			out.Traceback = runtimeErr.Traceback()
+		}
+		return out
+	}
+	out.Result = BE.Inspect(result, BE.DefaultInspectOptions)
+	return out
+}
+
+var programs = []struct {
+	name   string
+	source string
+}{
+	{"Arithmetic", "1 + 2 * 3 - 4 / 2"},
+	{"DivideByZero", "[1 / 0, -1 / 0]"},
+	{"Comparisons", "[1 < 2, \"a\" == \"a\", null != 0, true is true]"},
+	{"Negation", "[-(2 + 3), !true, !!false]"},
+	{"Truthiness", "[!0, !\"\", 0 && 1, null || \"default\"]"},
+	{"LogicalBooleans", "[true && false, false || true, false && print(\"right\"), true || print(\"right\")]"},
+	{"LogicalRightOperand", "true && 1"},
+	{"UndeclaredInDeadBranch", "if false {\n  undefinedThing()\n}\n1"},
+	{"UndeclaredInDeadLoop", "while false {\n  boom()\n}\n1"},
+	{"UndeclaredAfterPop", "fn f() {\n  pop 1\n  later()\n}\nf()"},
+	{"UsedBeforeDeclarationInDeadBranch", "if false {\n  print(x)\n}\nlet x = 1"},
+	{"ModuloByZero", "fn f() {\n  5 % 0\n}\nf()"},
+	{"FoldedError", "fn f() {\n  1 + \"a\"\n}\nf()"},
+	{"FoldedComparisonError", "\"a\" < 1"},
+	{"ConstantIf", "let r = 0\nif 1 < 2 {\n  r = 1\n} else {\n  r = 2\n}\nr"},
+	{"ConstantElse", "let r = 0\nif 2 < 1 {\n  r = 1\n} else {\n  let inner = 2\n  r = inner\n}\n[r, inner]"},
+	{"ConstantElseIf", "let r = 0\nif false {\n  r = 1\n} else if true {\n  r = 2\n}\nr"},
+	{"ConstantIfScope", "let x = 1\nif true {\n  let x = 2\n  print(x)\n}\nx"},
+	{"ConstantIfPop", "fn f() {\n  if true {\n    pop 1\n  }\n  pop 2\n}\nf()"},
+	{"ConstantIfValue", "fn f() {\n  if false {\n    1\n  }\n}\nf()"},
+	{"WhileFalse", "let n = 0\nwhile false {\n  n = n + 1\n}\nn"},
+	{"WhileFalseLast", "while 1 > 2 {\n}"},
+	{"AfterPop", "fn f() {\n  pop 1\n  print(\"unreachable\")\n}\nf()"},
+	{"AfterThrow", "fn f() {\n  throw \"no\"\n  print(\"unreachable\")\n}\nf()"},
+	{"AfterPopInBlock", "fn f(x) {\n  if x {\n    pop 1\n    print(\"unreachable\")\n  }\n  pop 2\n}\n[f(true), f(false)]"},
+	{"TopLevelPop", "pop 5\nprint(\"reached\")\n6"},
+	{"InlineConst", "const N = 2 * 5\nfn f(x) {\n  pop x * N\n}\nf(3)"},
+	{"InlineConstBranch", "const DEBUG = false\nlet log = []\nif DEBUG {\n  log = [1]\n}\nlog"},
+	{"InlineConstShadowed", "const N = 1\nfn f(N) {\n  pop N\n}\n[f(2), N]"},
+	{"InlineConstBeforeDeclaration", "fn f() {\n  pop K\n}\nlet r = null\ntry {\n  f()\n} catch e {\n  r = e.message\n}\nconst K = 3\n[r, f()]"},
+	{"InlineConstReassign", "const K = 1\nK = 2"},
+	{"InlineConstInBlock", "fn f() {\n  if true {\n    const K = 4\n    print(K)\n  }\n}\nf()"},
+	{"InlineConstObject", "const K = 1\nlet o = { K, k: K }\n[o.K, o.k]"},
+	{"InlineConstProperty", "const x = 1\nlet o = { x: 2 }\no.x"},
+	{"InlineConstString", "const greeting = \"hi\"\nprint(greeting)\ngreeting"},
+	{"Traceback", "const zero = 0\nfn divide(a, b) {\n  if b == zero {\n    throw \"cannot divide by zero\"\n  }\n  pop a / b\n}\ndivide(1, 0)"},
+	{"Loop", "let total = 0\nfor (let i = 0; i < 10; i = i + 1) {\n  total = total + i * (2 + 3)\n}\ntotal"},
+}
+
+// configs are the optimizations differential tests compare, each pass on
+// its own and every level.
+var configs = map[string]optimizer.Options{
+	"inline":      {InlineConsts: true},
+	"fold":        {Fold: true},
+	"branches":    {DeadBranches: true},
+	"unreachable": {Unreachable: true},
+	"O1":          optimizer.Level(1),
+	"O2":          optimizer.Level(2),
+}
+
+func TestDifferential(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		for _, p := range programs {
+			want := run(BE.Options{StrictBooleans: strict}, p.source)
+			for name, passes := range configs {
+				for _, engine := range []BE.Engine{nil, vm.Engine{}} {
+					got := run(BE.Options{StrictBooleans: strict, Optimizer: passes, Engine: engine}, p.source)
+					assert.Equal(t, want, got, "%s with %s (strict booleans: %v, engine: %T)", p.name, name, strict, engine)
+				}
+			}
+		}
+	}
+}
+
+// lines matches the source lines and positions of a disassembly.
+var lines = regexp.MustCompile(`L\d+ | \S+:\d+:\d+ ==`)
+
+// optimized disassembles source after optimizing it.
+func optimized(t *testing.T, passes BE.Optimizer, source string) string {
+	t.Helper()
+	program, err := FE.Parse(source)
+	require.NoError(t, err)
+	if passes != nil {
+		program = passes.Optimize(program)
+	}
+	proto, err := C.Compile(program, C.Options{File: "test.pop"})
+	require.NoError(t, err)
+	return lines.ReplaceAllString(C.Disassemble(proto), "")
+}
+
+// assertOptimizes checks that passes turn source into the code of want.
+func assertOptimizes(t *testing.T, passes optimizer.Options, source, want string) {
+	t.Helper()
+	assert.Equal(t, optimized(t, nil, want), optimized(t, passes, source))
+}
+
+func TestFold(t *testing.T) {
+	fold := optimizer.Options{Fold: true}
+	assertOptimizes(t, fold, "1 + 2 * 3", "7")
+	assertOptimizes(t, fold, "-(4 - 6)", "2")
+	assertOptimizes(t, fold, "[\"a\" == \"a\", !true, 1 < 2]", "[true, false, true]")
+	assertOptimizes(t, fold, "false && x", "false")
+	assertOptimizes(t, fold, "true || x", "true")
+	assertOptimizes(t, fold, "true && false", "false")
+	assertOptimizes(t, fold, "x + 2 * 3", "x + 6")
+
+	// What raises errors, or depends on StrictBooleans, runs as written
+	assertOptimizes(t, fold, "1 + \"a\"", "1 + \"a\"")
+	assertOptimizes(t, fold, "5 % 0", "5 % 0")
+	assertOptimizes(t, fold, "!0", "!0")
+	assertOptimizes(t, fold, "true && x", "true && x")
+	assertOptimizes(t, fold, "0 || true", "0 || true")
+}
+
+func TestDeadBranches(t *testing.T) {
+	branches := optimizer.Options{DeadBranches: true}
+	assertOptimizes(t, branches, "if true {\n  a()\n} else {\n  b()\n}\nc()", "a()\nnull\nc()")
+	assertOptimizes(t, branches, "if false {\n  a()\n} else {\n  b()\n}\nc()", "b()\nnull\nc()")
+	assertOptimizes(t, branches, "if false {\n  a()\n}\nc()", "c()")
+	assertOptimizes(t, branches, "while false {\n  a()\n}\nc()", "c()")
+	assertOptimizes(t, branches, "c()\nwhile false {\n  a()\n}", "c()\nnull")
+
+	// A block runs in the enclosing scope, so a consequent that declares
+	// something keeps its if
+	assertOptimizes(t, branches, "if true {\n  let a = 1\n} else {\n  b()\n}", "if true {\n  let a = 1\n}")
+	assertOptimizes(t, branches, "if 1 {\n  a()\n}", "if 1 {\n  a()\n}")
+	// So does an else block, which keeps its scope as the consequent of an
+	// if that always runs
+	assertOptimizes(t, branches, "if false {\n  a()\n} else {\n  let b = 1\n}", "if true {\n  let b = 1\n}")
+}
+
+func TestUnreachable(t *testing.T) {
+	unreachable := optimizer.Options{Unreachable: true}
+	assertOptimizes(t, unreachable, "fn f() {\n  pop 1\n  a()\n}", "fn f() {\n  pop 1\n}")
+	assertOptimizes(t, unreachable, "fn f() {\n  if x {\n    throw 1\n    a()\n  }\n  b()\n}", "fn f() {\n  if x {\n    throw 1\n  }\n  b()\n}")
+	assertOptimizes(t, unreachable, "pop 1\na()", "pop 1\na()")
+}
+
+func TestInlineConsts(t *testing.T) {
+	inline := optimizer.Options{InlineConsts: true}
+	assertOptimizes(t, inline, "const N = 3\nfn f() {\n  pop N\n}\nN", "const N = 3\nfn f() {\n  pop 3\n}\n3")
+	assertOptimizes(t, inline, "const N = 2 * 5\nN", "const N = 2 * 5\n10")
+
+	// Reads that might see another binding, or none yet, stay reads
+	assertOptimizes(t, inline, "fn f() {\n  pop N\n}\nconst N = 3\n", "fn f() {\n  pop N\n}\nconst N = 3\n")
+	assertOptimizes(t, inline, "const N = 3\nfn f(N) {\n  pop N\n}\nN", "const N = 3\nfn f(N) {\n  pop N\n}\nN")
+	assertOptimizes(t, inline, "let v = 3\nv", "let v = 3\nv")
+	assertOptimizes(t, inline, "const a = [1]\na", "const a = [1]\na")
+	assertOptimizes(t, inline, "const N = 3\nN = 4", "const N = 3\nN = 4")
+	assertOptimizes(t, inline, "const N = 3\no.N", "const N = 3\no.N")
+}
+
+func TestLevelsCombinePasses(t *testing.T) {
+	source := "const DEBUG = false\nfn f(x) {\n  if DEBUG {\n    print(x)\n  }\n  pop x * (60 * 60)\n  print(\"done\")\n}"
+	assertOptimizes(t, optimizer.Level(2), source, "const DEBUG = false\nfn f(x) {\n  pop x * 3600\n}")
+	assertOptimizes(t, optimizer.Level(0), source, source)
+}
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		flag string
+		want optimizer.Options
+	}{
+		{"0", optimizer.Options{}},
+		{"1", optimizer.Options{Fold: true, Unreachable: true}},
+		{"2", optimizer.Options{Fold: true, Unreachable: true, DeadBranches: true, InlineConsts: true}},
+		{"fold", optimizer.Options{Fold: true}},
+		{"inline, branches", optimizer.Options{InlineConsts: true, DeadBranches: true}},
+	} {
+		got, err := optimizer.Parse(test.flag)
+		require.NoError(t, err, test.flag)
+		assert.Equal(t, test.want, got, test.flag)
+	}
+
+	for _, bad := range []string{"3", "-1", "fast", "fold,"} {
+		_, err := optimizer.Parse(bad)
+		assert.Error(t, err, bad)
+	}
+
+	assert.Equal(t, "inline,fold,branches,unreachable", optimizer.Level(2).String())
+	assert.Equal(t, "none", optimizer.Level(0).String())
+}
+
+func TestOptimizeLeavesInputAlone(t *testing.T) {
+	program, err := FE.Parse("const N = 1\nfn f() {\n  pop N + 1\n  a()\n}")
+	require.NoError(t, err)
+	before, err := FE.Parse("const N = 1\nfn f() {\n  pop N + 1\n  a()\n}")
+	require.NoError(t, err)
+
+	optimizer.Level(optimizer.MaxLevel).Optimize(program)
+	assert.Equal(t, before, program)
+}
@@ -0,0 +1,314 @@
+package packages_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	BE "pop/backend"
+	"pop/packages"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFiles writes files, by slash-separated path, into dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+}
+
+// writeTarball writes files into a gzipped tarball at path, inside a
+// package/ directory like npm packs them.
+func writeTarball(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "package/", Typeflag: tar.TypeDir, Mode: 0o755}))
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "package/" + name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+}
+
+func manifest(t *testing.T, m packages.Manifest) string {
+	t.Helper()
+	data, err := json.Marshal(m)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func mathx(t *testing.T, version string, body string) map[string]string {
+	return map[string]string{
+		"popcorn.json": manifest(t, packages.Manifest{Name: "mathx", Version: version}),
+		"main.pop":     body,
+	}
+}
+
+// run runs the file at path with a FileResolver and returns what it printed.
+func run(t *testing.T, path string) (string, error) {
+	t.Helper()
+	var stdout bytes.Buffer
+	it := BE.NewInterpreter(BE.Options{Stdout: &stdout, Stderr: &stdout, Resolver: BE.FileResolver{}})
+	_, err := it.RunFile(path)
+	return stdout.String(), err
+}
+
+func TestManifest(t *testing.T) {
+	m, err := packages.ParseManifest([]byte(`{"name": "app", "version": "1.0.0", "dependencies": {"mathx": "^1.2.0", "strs": "file:../strs"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, "app", m.Name)
+	assert.Equal(t, filepath.Join("dir", "main.pop"), m.EntryPath("dir"))
+
+	for source, message := range map[string]string{
+		`{"version": "1.0.0"}`:                                                     `invalid package name ""`,
+		`{"name": "App", "version": "1.0.0"}`:                                      `invalid package name "App"`,
+		`{"name": "app", "version": "1"}`:                                          `invalid version "1"`,
+		`{"name": "app", "version": "1.0.0", "entry": "../x.pop"}`:                 `entry "../x.pop" is not a path inside the package`,
+		`{"name": "app", "version": "1.0.0", "dependencies": {"mathx": ">1.0.0"}}`: `dependency mathx: invalid version ">1.0.0"`,
+		`{"name": "app", "version": "1.0.0", "dependencies": {"mathx": "file:"}}`:  `dependency mathx: empty path`,
+		`{"name": "app", "version": 1}`:                                            `invalid popcorn.json`,
+	} {
+		_, err := packages.ParseManifest([]byte(source))
+		assert.ErrorContains(t, err, message, source)
+	}
+
+	_, err = packages.ReadManifest(t.TempDir())
+	assert.True(t, errors.Is(err, packages.ErrNoManifest))
+}
+
+func TestVersions(t *testing.T) {
+	v, err := packages.ParseVersion("1.2.3")
+	require.NoError(t, err)
+	assert.Equal(t, packages.Version{Major: 1, Minor: 2, Patch: 3}, v)
+	for _, invalid := range []string{"1.2", "1.2.3.4", "1.02.3", "-1.2.3", "a.b.c", ""} {
+		_, err := packages.ParseVersion(invalid)
+		assert.Error(t, err, invalid)
+	}
+
+	allows := func(r string, v string) bool {
+		parsed, err := packages.ParseRange(r)
+		require.NoError(t, err)
+		version, err := packages.ParseVersion(v)
+		require.NoError(t, err)
+		return parsed.Allows(version)
+	}
+	assert.True(t, allows("1.2.3", "1.2.3"))
+	assert.False(t, allows("1.2.3", "1.2.4"))
+	assert.True(t, allows("^1.2.3", "1.9.0"))
+	assert.False(t, allows("^1.2.3", "1.2.2"))
+	assert.False(t, allows("^1.2.3", "2.0.0"))
+	assert.True(t, allows("~1.2.3", "1.2.9"))
+	assert.False(t, allows("~1.2.3", "1.3.0"))
+	assert.True(t, allows("*", "0.0.1"))
+}
+
+func TestInstallLocal(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"app/popcorn.json": manifest(t, packages.Manifest{Name: "app", Version: "1.0.0", Dependencies: map[string]string{"strs": "file:../strs"}}),
+		"app/main.pop":     "import strs from \"strs\"\nimport { shout } from \"strs/shout.pop\"\nprint(strs.greeting, shout())\n",
+		"strs/popcorn.json": manifest(t, packages.Manifest{Name: "strs", Version: "0.1.0", Entry: "lib/strs.pop",
+			Dependencies: map[string]string{"mathx": "file:../mathx"}}),
+		"strs/lib/strs.pop":  "import { double } from \"mathx\"\nexport let greeting = double(21)\n",
+		"strs/shout.pop":     "export fn shout() {\n  pop \"hey\"\n}\n",
+		"strs/.git/HEAD":     "ref: main\n",
+		"mathx/popcorn.json": manifest(t, packages.Manifest{Name: "mathx", Version: "1.0.0"}),
+		"mathx/main.pop":     "export fn double(x) {\n  pop x * 2\n}\n",
+	})
+	app := filepath.Join(root, "app")
+
+	lock, err := packages.Install(app, packages.Options{})
+	require.NoError(t, err)
+	require.Len(t, lock.Packages, 2)
+	assert.Equal(t, "0.1.0", lock.Packages["strs"].Version)
+	assert.Equal(t, "file:../strs", lock.Packages["strs"].Resolved)
+	// Dependencies of a package are relative to it
+	assert.Equal(t, "file:../mathx", lock.Packages["mathx"].Resolved)
+	assert.Regexp(t, `^sha256-[0-9a-f]{64}$`, lock.Packages["mathx"].Integrity)
+	assert.NoDirExists(t, filepath.Join(app, "pop_modules", "strs", ".git"))
+
+	written, err := packages.ReadLock(app)
+	require.NoError(t, err)
+	assert.Equal(t, lock, written)
+
+	out, err := run(t, filepath.Join(app, "main.pop"))
+	require.NoError(t, err)
+	assert.Equal(t, "42 hey\n", out)
+
+	// Changes to local packages are picked up by the next install
+	writeFiles(t, root, map[string]string{"mathx/main.pop": "export fn double(x) {\n  pop x * 3\n}\n"})
+	relock, err := packages.Install(app, packages.Options{})
+	require.NoError(t, err)
+	assert.NotEqual(t, lock.Packages["mathx"].Integrity, relock.Packages["mathx"].Integrity)
+	out, err = run(t, filepath.Join(app, "main.pop"))
+	require.NoError(t, err)
+	assert.Equal(t, "63 hey\n", out)
+}
+
+func TestInstallRegistry(t *testing.T) {
+	registry := t.TempDir()
+	writeTarball(t, filepath.Join(registry, "mathx-1.0.0.tar.gz"), mathx(t, "1.0.0", "export let version = 100\n"))
+	writeTarball(t, filepath.Join(registry, "mathx-1.1.0.tgz"), mathx(t, "1.1.0", "export let version = 110\n"))
+	writeTarball(t, filepath.Join(registry, "mathx-2.0.0.tar.gz"), mathx(t, "2.0.0", "export let version = 200\n"))
+
+	app := t.TempDir()
+	writeFiles(t, app, map[string]string{
+		"popcorn.json": manifest(t, packages.Manifest{Name: "app", Version: "1.0.0", Dependencies: map[string]string{"mathx": "^1.0.0"}}),
+		"main.pop":     "import * as mathx from \"mathx\"\nprint(mathx.version)\n",
+	})
+
+	// Only file: dependencies can be installed without a registry
+	_, err := packages.Install(app, packages.Options{})
+	assert.ErrorContains(t, err, "mathx: no registry to install version ^1.0.0 from")
+
+	var log bytes.Buffer
+	lock, err := packages.Install(app, packages.Options{Registry: registry, Log: &log})
+	require.NoError(t, err)
+	assert.Equal(t, "1.1.0", lock.Packages["mathx"].Version)
+	assert.Equal(t, "registry:mathx-1.1.0.tgz", lock.Packages["mathx"].Resolved)
+	assert.Equal(t, "+ mathx@1.1.0 (registry:mathx-1.1.0.tgz)\n", log.String())
+	out, err := run(t, filepath.Join(app, "main.pop"))
+	require.NoError(t, err)
+	assert.Equal(t, "110\n", out)
+
+	t.Run("LockedVersion", func(t *testing.T) {
+		// The locked version is kept while the range allows it
+		writeTarball(t, filepath.Join(registry, "mathx-1.2.0.tar.gz"), mathx(t, "1.2.0", "export let version = 120\n"))
+		relock, err := packages.Install(app, packages.Options{Registry: registry, Frozen: true})
+		require.NoError(t, err)
+		assert.Equal(t, lock, relock)
+	})
+
+	t.Run("Frozen", func(t *testing.T) {
+		writeFiles(t, app, map[string]string{
+			"popcorn.json": manifest(t, packages.Manifest{Name: "app", Version: "1.0.0", Dependencies: map[string]string{"mathx": "^2.0.0"}}),
+		})
+		_, err := packages.Install(app, packages.Options{Registry: registry, Frozen: true})
+		assert.True(t, errors.Is(err, packages.ErrLockOutdated), "got %v", err)
+		// Nothing changed
+		out, err := run(t, filepath.Join(app, "main.pop"))
+		require.NoError(t, err)
+		assert.Equal(t, "110\n", out)
+
+		relock, err := packages.Install(app, packages.Options{Registry: registry})
+		require.NoError(t, err)
+		assert.Equal(t, "2.0.0", relock.Packages["mathx"].Version)
+	})
+
+	t.Run("Integrity", func(t *testing.T) {
+		writeTarball(t, filepath.Join(registry, "mathx-2.0.0.tar.gz"), mathx(t, "2.0.0", "export let version = -1\n"))
+		_, err := packages.Install(app, packages.Options{Registry: registry})
+		assert.ErrorContains(t, err, "mathx: the contents of registry:mathx-2.0.0.tar.gz do not match popcorn.lock")
+	})
+
+	t.Run("NoMatch", func(t *testing.T) {
+		writeFiles(t, app, map[string]string{
+			"popcorn.json": manifest(t, packages.Manifest{Name: "app", Version: "1.0.0", Dependencies: map[string]string{"mathx": "~3.0.0", "other": "*"}}),
+		})
+		_, err := packages.Install(app, packages.Options{Registry: registry})
+		assert.ErrorContains(t, err, "mathx: no version of mathx in the registry matches ~3.0.0")
+	})
+}
+
+func TestInstallConflict(t *testing.T) {
+	registry := t.TempDir()
+	writeTarball(t, filepath.Join(registry, "mathx-1.0.0.tar.gz"), mathx(t, "1.0.0", ""))
+	writeTarball(t, filepath.Join(registry, "mathx-2.0.0.tar.gz"), mathx(t, "2.0.0", ""))
+	writeTarball(t, filepath.Join(registry, "stats-1.0.0.tar.gz"), map[string]string{
+		"popcorn.json": manifest(t, packages.Manifest{Name: "stats", Version: "1.0.0", Dependencies: map[string]string{"mathx": "^2.0.0"}}),
+		"main.pop":     "",
+	})
+
+	app := t.TempDir()
+	writeFiles(t, app, map[string]string{
+		"popcorn.json": manifest(t, packages.Manifest{Name: "app", Version: "1.0.0", Dependencies: map[string]string{"mathx": "1.0.0", "stats": "^1.0.0"}}),
+	})
+	_, err := packages.Install(app, packages.Options{Registry: registry})
+	assert.ErrorContains(t, err, "mathx (needed by stats): mathx 1.0.0 is installed already, but ^2.0.0 is wanted")
+	assert.NoDirExists(t, filepath.Join(app, "pop_modules"))
+	assert.NoFileExists(t, filepath.Join(app, "popcorn.lock"))
+}
+
+func TestInstallWrongName(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"app/popcorn.json": manifest(t, packages.Manifest{Name: "app", Version: "1.0.0", Dependencies: map[string]string{"mathx": "file:../lib"}}),
+		"lib/popcorn.json": manifest(t, packages.Manifest{Name: "lib", Version: "1.0.0"}),
+		"lib/main.pop":     "",
+	})
+	_, err := packages.Install(filepath.Join(root, "app"), packages.Options{})
+	assert.ErrorContains(t, err, "mathx: the package is named lib")
+}
+
+func TestFind(t *testing.T) {
+	fsys := fstest.MapFS{
+		"pop_modules/mathx/popcorn.json":  {Data: []byte(`{"name": "mathx", "version": "1.0.0", "entry": "src/index.pop"}`)},
+		"pop_modules/mathx/src/index.pop": {Data: []byte("export let pi = 3\n")},
+		"pop_modules/mathx/stats.pop":     {Data: []byte("export let mean = 2\n")},
+		"pop_modules/plain/main.pop":      {Data: []byte("export let plain = true\n")},
+		"lib/pop_modules/mathx/main.pop":  {Data: []byte("export let pi = 4\n")},
+		"lib/deep/main.pop":               {Data: []byte("import mathx from \"mathx\"\nexport let pi = mathx.pi\n")},
+		"main.pop": {Data: []byte("import mathx from \"mathx\"\nimport { mean } from \"mathx/stats.pop\"\nimport { plain } from \"plain\"\n" +
+			"import { pi } from \"./lib/deep/main.pop\"\n[mathx.pi, mean, plain, pi]\n")},
+	}
+
+	found, ok, err := packages.Find(fsys, ".", "mathx")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "pop_modules/mathx/src/index.pop", found)
+
+	// The nearest pop_modules with the package wins
+	found, _, _ = packages.Find(fsys, "lib/deep", "mathx")
+	assert.Equal(t, "lib/pop_modules/mathx/main.pop", found)
+	found, _, _ = packages.Find(fsys, "lib/deep", "plain")
+	assert.Equal(t, "pop_modules/plain/main.pop", found)
+
+	_, ok, err = packages.Find(fsys, ".", "missing")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	_, _, err = packages.Find(fsys, ".", "mathx/../../main.pop")
+	assert.ErrorContains(t, err, "invalid module path")
+
+	assert.True(t, packages.IsBare("mathx"))
+	assert.True(t, packages.IsBare("util.pop"))
+	assert.False(t, packages.IsBare("./mathx"))
+	assert.False(t, packages.IsBare("../mathx"))
+	assert.False(t, packages.IsBare("/mathx"))
+
+	var stdout bytes.Buffer
+	it := BE.NewInterpreter(BE.Options{Stdout: &stdout, Resolver: BE.FSResolver{FS: fsys}})
+	result, err := it.RunFile("main.pop")
+	require.NoError(t, err)
+	assert.Equal(t, "[3, 2, true, 4]", BE.Inspect(result, BE.DefaultInspectOptions))
+}
+
+func TestImportMissingPackage(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.pop":  "import mathx from \"mathx\"\n",
+		"local.pop": "import { a } from \"util.pop\"\nprint(a)\n",
+		"util.pop":  "export let a = 1\n",
+	})
+	_, err := run(t, filepath.Join(dir, "main.pop"))
+	assert.ErrorContains(t, err, "Cannot resolve module 'mathx': package \"mathx\" is not installed, run popcorn install")
+
+	// Specifiers with an extension that are not packages are paths
+	out, err := run(t, filepath.Join(dir, "local.pop"))
+	require.NoError(t, err)
+	assert.Equal(t, "1\n", out)
+}
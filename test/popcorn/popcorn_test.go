@@ -0,0 +1,213 @@
+package popcorn_test
+
+import (
+	"errors"
+	"fmt"
+	BE "pop/backend"
+	"pop/popcorn"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type Item struct {
+	SKU      string `pop:"sku"`
+	Quantity int
+	Price    float64
+	internal bool
+}
+
+type Order struct {
+	ID    int
+	Items []Item
+	Notes map[string]string
+	Audit string `pop:"-"`
+}
+
+type Node struct {
+	Name string
+	Next *Node
+}
+
+var ErrOutOfStock = errors.New("out of stock")
+
+func TestSetAndGet(t *testing.T) {
+	rt := popcorn.New(BE.Options{})
+
+	order := Order{
+		ID:    7,
+		Items: []Item{{SKU: "A1", Quantity: 2, Price: 4}},
+		Notes: map[string]string{"gift": "yes"},
+		Audit: "secret",
+	}
+	require.NoError(t, rt.Set("order", order))
+
+	result, err := rt.Run("order.items[0].sku")
+	require.NoError(t, err)
+	assert.Equal(t, "A1", result)
+
+	result, err = rt.Run("order.notes.gift")
+	require.NoError(t, err)
+	assert.Equal(t, "yes", result)
+
+	result, err = rt.Run("order.audit")
+	require.NoError(t, err)
+	assert.Nil(t, result)
+
+	got, err := rt.Get("order")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"id":    float64(7),
+		"items": []any{map[string]any{"sku": "A1", "quantity": float64(2), "price": float64(4)}},
+		"notes": map[string]any{"gift": "yes"},
+	}, got)
+
+	require.NoError(t, rt.Set("lookup", map[int]string{1: "one"}))
+	result, err = rt.Run("lookup.get(1)")
+	require.NoError(t, err)
+	assert.Equal(t, "one", result)
+
+	_, err = rt.Get("missing")
+	assert.ErrorContains(t, err, "no global named 'missing'")
+
+	assert.ErrorContains(t, rt.Set("ch", make(chan int)), "unsupported Go type chan int")
+}
+
+func TestGoFunctions(t *testing.T) {
+	rt := popcorn.New(BE.Options{})
+
+	require.NoError(t, rt.Set("repeat", func(s string, n int) string {
+		out := ""
+		for i := 0; i < n; i++ {
+			out += s
+		}
+		return out
+	}))
+	require.NoError(t, rt.Set("sum", func(nums ...float64) float64 {
+		total := 0.0
+		for _, n := range nums {
+			total += n
+		}
+		return total
+	}))
+	require.NoError(t, rt.Set("divmod", func(a, b int) (int, int) { return a / b, a % b }))
+
+	result, err := rt.Run("repeat(\"ab\", 3)")
+	require.NoError(t, err)
+	assert.Equal(t, "ababab", result)
+
+	result, err = rt.Run("sum(1, 2, 3)")
+	require.NoError(t, err)
+	assert.Equal(t, float64(6), result)
+
+	result, err = rt.Run("divmod(7, 2)")
+	require.NoError(t, err)
+	assert.Equal(t, []any{float64(3), float64(1)}, result)
+
+	_, err = rt.Run("repeat(\"ab\", 1 / 2)")
+	assert.ErrorContains(t, err, "repeat: argument 2: 0.5 does not fit in int")
+
+	_, err = rt.Run("repeat(\"ab\")")
+	assert.ErrorContains(t, err, "repeat: expects 2 argument(s), got 1")
+}
+
+func TestGoErrorsPropagate(t *testing.T) {
+	rt := popcorn.New(BE.Options{})
+
+	require.NoError(t, rt.Set("reserve", func(sku string, qty int) error {
+		if qty > 3 {
+			return fmt.Errorf("reserve %s: %w", sku, ErrOutOfStock)
+		}
+		return nil
+	}))
+	_, err := rt.Run("fn checkout(qty) {\n  reserve(\"A1\", qty)\n  pop \"ok\"\n}\n")
+	require.NoError(t, err)
+
+	result, err := rt.Call("checkout", 2)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", result)
+
+	_, err = rt.Call("checkout", 5)
+	assert.ErrorIs(t, err, ErrOutOfStock)
+	var runtimeErr *BE.RuntimeError
+	assert.ErrorAs(t, err, &runtimeErr)
+}
+
+func TestDecode(t *testing.T) {
+	rt := popcorn.New(BE.Options{})
+
+	val, err := rt.Interpreter().RunString("{ id: 3, items: [{ sku: \"B2\", quantity: 1, price: 10 }] }")
+	require.NoError(t, err)
+
+	var order Order
+	require.NoError(t, rt.Decode(val, &order))
+	assert.Equal(t, Order{ID: 3, Items: []Item{{SKU: "B2", Quantity: 1, Price: 10}}}, order)
+
+	var count uint8
+	assert.ErrorContains(t, rt.Decode(BE.NumberVal{Value: 300}, &count), "300 does not fit in uint8")
+	assert.ErrorContains(t, rt.Decode(BE.StringVal{Value: "x"}, &count), "cannot use \"x\" as uint8")
+	assert.ErrorContains(t, rt.Decode(BE.Null, count), "non-nil pointer")
+}
+
+func TestPopcornCallbacks(t *testing.T) {
+	rt := popcorn.New(BE.Options{})
+
+	require.NoError(t, rt.Set("apply", func(f func(int) int, n int) int { return f(n) }))
+	result, err := rt.Run("fn double(x) {\n  pop x * 2\n}\napply(double, 21)")
+	require.NoError(t, err)
+	assert.Equal(t, float64(42), result)
+
+	val, err := rt.Get("double")
+	require.NoError(t, err)
+	double := val.(func(args ...any) (any, error))
+	out, err := double(4)
+	require.NoError(t, err)
+	assert.Equal(t, float64(8), out)
+
+	fnVal, ok := rt.Interpreter().Globals.LookupVar("double")
+	require.True(t, ok)
+	var typed func(int) (int, error)
+	require.NoError(t, rt.Decode(fnVal, &typed))
+	n, err := typed(5)
+	require.NoError(t, err)
+	assert.Equal(t, 10, n)
+}
+
+func TestPopcornCallbackFailures(t *testing.T) {
+	rt := popcorn.New(BE.Options{})
+
+	// A func without an error result fails the native that called it
+	require.NoError(t, rt.Set("apply", func(f func(int) int, n int) int { return f(n) + 1 }))
+	_, err := rt.Run("fn fails(x) {\n  throw \"boom\"\n}\ntry {\n  apply(fails, 1)\n} catch e {\n  e\n}")
+	require.NoError(t, err)
+	_, err = rt.Run("apply(fails, 1)")
+	var runtimeErr *BE.RuntimeError
+	require.ErrorAs(t, err, &runtimeErr)
+	assert.Equal(t, "boom", runtimeErr.Message)
+
+	// and returns zero values to Go code that calls it directly
+	fnVal, ok := rt.Interpreter().Globals.LookupVar("fails")
+	require.True(t, ok)
+	var typed func(int) int
+	require.NoError(t, rt.Decode(fnVal, &typed))
+	assert.NotPanics(t, func() {
+		assert.Equal(t, 0, typed(1))
+	})
+}
+
+func TestCycles(t *testing.T) {
+	rt := popcorn.New(BE.Options{})
+
+	node := &Node{Name: "a"}
+	node.Next = node
+	val, err := rt.ToValue(node)
+	require.NoError(t, err)
+	obj := val.(*BE.ObjectVal)
+	assert.Same(t, obj, obj.Properties["next"])
+
+	var decoded *Node
+	require.NoError(t, rt.Decode(obj, &decoded))
+	assert.Equal(t, "a", decoded.Name)
+	assert.Same(t, decoded, decoded.Next)
+}
@@ -0,0 +1,197 @@
+package poptest_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	BE "pop/backend"
+	"pop/poptest"
+	"pop/vm"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const mathTest = `let runs = 0
+
+fn add(a, b) {
+  pop a + b
+}
+
+test "adds" {
+  runs = runs + 1
+  assertEq(add(1, 2), 3)
+  assertEq(runs, 1)
+}
+
+test "is isolated" {
+  runs = runs + 1
+  assertEq(runs, 1)
+}
+
+test "fails" {
+  print("about to fail")
+  assertEq(add(2, 2), 5, "two and two")
+}
+
+test "deep" {
+  assertEq({ items: [1, 2, 3, 4, 5, 6, 7, 8, 9, 10], name: "x" }, { items: [1, 2, 3, 4, 5, 6, 7, 8, 9, 11], name: "x" })
+}
+
+test "throws" {
+  throw "boom"
+}
+`
+
+// write creates the files under a temporary directory and returns it.
+func write(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(source), 0o644))
+	}
+	return dir
+}
+
+// results maps the names of the tests of suite to their failures.
+func results(suite poptest.Suite) map[string]*poptest.Failure {
+	byName := map[string]*poptest.Failure{}
+	for _, r := range suite.Results {
+		byName[r.Name] = r.Failure
+	}
+	return byName
+}
+
+func TestDiscover(t *testing.T) {
+	dir := write(t, map[string]string{
+		"a_test.pop":                 "",
+		"a.pop":                      "",
+		"sub/b_test.pop":             "",
+		".hidden/c_test.pop":         "",
+		"pop_modules/dep/d_test.pop": "",
+	})
+	files, err := poptest.Discover(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "a_test.pop"), filepath.Join(dir, "sub", "b_test.pop")}, files)
+}
+
+func TestRunFile(t *testing.T) {
+	for name, engine := range map[string]BE.Engine{"tree": nil, "vm": vm.Engine{}} {
+		t.Run(name, func(t *testing.T) {
+			dir := write(t, map[string]string{"math_test.pop": mathTest})
+			file := filepath.Join(dir, "math_test.pop")
+			suite := poptest.RunFile(file, poptest.Options{Interpreter: BE.Options{Engine: engine}})
+			require.NoError(t, suite.Err)
+			require.Len(t, suite.Results, 5)
+			assert.Equal(t, 3, suite.Failed())
+
+			failures := results(suite)
+			// Each test runs the file afresh
+			assert.Nil(t, failures["adds"])
+			assert.Nil(t, failures["is isolated"])
+
+			fails := failures["fails"]
+			require.NotNil(t, fails)
+			assert.Equal(t, BE.AssertionError, fails.Name)
+			assert.Equal(t, "two and two", fails.Message)
+			assert.Equal(t, []int{20, 11}, []int{fails.Line, fails.Column})
+			assert.Equal(t, "5", fails.Expected)
+			assert.Equal(t, "4", fails.Actual)
+			assert.Equal(t, "expected: 5\n  actual: 4\n", fails.Diff())
+			assert.Equal(t, "about to fail\n", suite.Results[2].Output)
+
+			deep := failures["deep"]
+			require.NotNil(t, deep)
+			assert.Contains(t, deep.Diff(), "--- expected\n+++ actual\n")
+			assert.Contains(t, deep.Diff(), "-  items: [1, 2, 3, 4, 5, 6, 7, 8, 9, 11],\n+  items: [1, 2, 3, 4, 5, 6, 7, 8, 9, 10],\n")
+
+			throws := failures["throws"]
+			require.NotNil(t, throws)
+			assert.Equal(t, "Error", throws.Name)
+			assert.Equal(t, "boom", throws.Message)
+			assert.Equal(t, 28, throws.Line)
+			assert.Empty(t, throws.Diff())
+		})
+	}
+}
+
+func TestRunFileFilter(t *testing.T) {
+	dir := write(t, map[string]string{"math_test.pop": mathTest})
+	suite := poptest.RunFile(filepath.Join(dir, "math_test.pop"), poptest.Options{Run: regexp.MustCompile("^(adds|deep)$")})
+	require.Len(t, suite.Results, 2)
+	assert.Equal(t, "adds", suite.Results[0].Name)
+	assert.Equal(t, "deep", suite.Results[1].Name)
+}
+
+func TestRunFileErrors(t *testing.T) {
+	dir := write(t, map[string]string{
+		"parse_test.pop": "test \"a\" {\n",
+		"top_test.pop":   "throw \"setup\"\ntest \"a\" {\n}\n",
+		"slow_test.pop":  "test \"loops\" {\n  while true {\n  }\n}\n",
+	})
+
+	suite := poptest.RunFile(filepath.Join(dir, "parse_test.pop"), poptest.Options{})
+	assert.Error(t, suite.Err)
+	assert.Empty(t, suite.Results)
+
+	// The top-level code of the file fails each test
+	suite = poptest.RunFile(filepath.Join(dir, "top_test.pop"), poptest.Options{})
+	require.NoError(t, suite.Err)
+	require.Len(t, suite.Results, 1)
+	assert.Equal(t, "setup", suite.Results[0].Failure.Message)
+	assert.Equal(t, 1, suite.Results[0].Failure.Line)
+
+	suite = poptest.RunFile(filepath.Join(dir, "slow_test.pop"), poptest.Options{Timeout: 10 * time.Millisecond})
+	require.Len(t, suite.Results, 1)
+	assert.False(t, suite.Results[0].Passed())
+}
+
+func TestReports(t *testing.T) {
+	dir := write(t, map[string]string{"math_test.pop": mathTest, "broken_test.pop": "test {\n"})
+	suites := []poptest.Suite{
+		poptest.RunFile(filepath.Join(dir, "math_test.pop"), poptest.Options{Run: regexp.MustCompile("adds|fails")}),
+		poptest.RunFile(filepath.Join(dir, "broken_test.pop"), poptest.Options{}),
+	}
+	tests, failed, broken := poptest.Counts(suites)
+	assert.Equal(t, []int{2, 1, 1}, []int{tests, failed, broken})
+
+	var text bytes.Buffer
+	poptest.WriteText(&text, suites, false)
+	assert.Contains(t, text.String(), "--- FAIL: fails (")
+	assert.Contains(t, text.String(), "math_test.pop:20:11: AssertionError: two and two\n    expected: 5\n      actual: 4\n    output:\n      about to fail\n")
+	assert.NotContains(t, text.String(), "PASS: adds")
+	assert.Contains(t, text.String(), "FAIL: 1 of 2 tests failed, 1 files could not be loaded\n")
+
+	var tap bytes.Buffer
+	poptest.WriteTAP(&tap, suites)
+	assert.Contains(t, tap.String(), "TAP version 13\n1..3\n")
+	assert.Contains(t, tap.String(), "ok 1 - "+filepath.Join(dir, "math_test.pop")+": adds\n")
+	assert.Contains(t, tap.String(), "not ok 2 - "+filepath.Join(dir, "math_test.pop")+": fails\n  ---\n  message: \"AssertionError: two and two\"\n")
+	assert.Contains(t, tap.String(), "not ok 3 - "+filepath.Join(dir, "broken_test.pop")+"\n")
+
+	var junit bytes.Buffer
+	require.NoError(t, poptest.WriteJUnit(&junit, suites))
+	var report struct {
+		Tests    int `xml:"tests,attr"`
+		Failures int `xml:"failures,attr"`
+		Errors   int `xml:"errors,attr"`
+		Suites   []struct {
+			Cases []struct {
+				Name    string    `xml:"name,attr"`
+				Failure *struct{} `xml:"failure"`
+			} `xml:"testcase"`
+		} `xml:"testsuite"`
+	}
+	require.NoError(t, xml.Unmarshal(junit.Bytes(), &report))
+	assert.Equal(t, []int{3, 1, 1}, []int{report.Tests, report.Failures, report.Errors})
+	require.Len(t, report.Suites, 2)
+	require.Len(t, report.Suites[0].Cases, 2)
+	assert.Nil(t, report.Suites[0].Cases[0].Failure)
+	assert.NotNil(t, report.Suites[0].Cases[1].Failure)
+}
@@ -0,0 +1,327 @@
+package resolver_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	BE "pop/backend"
+	C "pop/compiler"
+	FE "pop/frontend"
+	"pop/frontend/types/ast"
+	"pop/resolver"
+	"pop/vm"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func resolve(t *testing.T, source string, opts resolver.Options) (ast.Program, error) {
+	t.Helper()
+	program, err := FE.Parse(source)
+	require.NoError(t, err)
+	return resolver.Resolve(program, opts)
+}
+
+// addresses lists the address of every identifier in node, in the order
+// of the source, "global" for those without one.
+func addresses(node ast.ASTNode) map[string][]string {
+	found := map[string][]string{}
+	var visit func(n ast.ASTNode) ast.ASTNode
+	visit = func(n ast.ASTNode) ast.ASTNode {
+		if ident, ok := n.(ast.IdentifierExprNode); ok {
+			addr := "global"
+			if ident.Addr != nil {
+				addr = fmt.Sprintf("%d:%d", ident.Addr.Depth, ident.Addr.Slot)
+			}
+			found[ident.Symbol] = append(found[ident.Symbol], addr)
+		}
+		return ast.MapChildren(n, visit)
+	}
+	visit(node)
+	return found
+}
+
+func TestAddresses(t *testing.T) {
+	source := "let g = 1\nfn f(a, b) {\n  let c = a\n  if b {\n    let d = c\n    print(d, g)\n  }\n  fn inner() {\n    pop c\n  }\n  pop inner\n}\n"
+	program, err := resolve(t, source, resolver.Options{})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]string{
+		"a":     {"0:0"},
+		"b":     {"1:1"},
+		"c":     {"1:2", "1:2"},
+		"d":     {"0:0"},
+		"g":     {"global"},
+		"print": {"global"},
+		"inner": {"0:3"},
+	}, addresses(program))
+
+	fn := program.Body[1].(ast.FunctionDeclarationNode)
+	assert.Nil(t, fn.Addr)
+	assert.Equal(t, &ast.Scope{Names: []string{"a", "b", "c", "inner"}, Constants: []bool{false, false, false, true}}, fn.Scope)
+	assert.Equal(t, []string{"d"}, fn.Body[1].(ast.IfStatementNode).Scope.Names)
+	assert.Equal(t, &ast.Address{Slot: 2}, fn.Body[0].(ast.VariableDeclarationNode).Addr)
+}
+
+func TestScopes(t *testing.T) {
+	t.Run("Shadowing", func(t *testing.T) {
+		program, err := resolve(t, "fn f(x) {\n  while x {\n    let x = 1\n    print(x)\n  }\n  pop x\n}\n", resolver.Options{})
+		require.NoError(t, err)
+		// The loop condition runs in the loop's scope but sees the parameter
+		// until the body declares its own x
+		assert.Equal(t, []string{"1:0", "0:0", "0:0"}, addresses(program)["x"])
+	})
+
+	t.Run("ElseBlocksHaveTheirOwnScope", func(t *testing.T) {
+		program, err := resolve(t, "fn f(c) {\n  if c {\n  } else if !c {\n  } else {\n    let e = c\n  }\n}\n", resolver.Options{})
+		require.NoError(t, err)
+		fn := program.Body[0].(ast.FunctionDeclarationNode)
+		assert.Equal(t, []string{"c"}, fn.Scope.Names)
+		elseIf := fn.Body[0].(ast.IfStatementNode).Alternate.(ast.IfStatementNode)
+		assert.Nil(t, fn.Body[0].(ast.IfStatementNode).AlternateScope)
+		assert.Equal(t, []string{"e"}, elseIf.AlternateScope.Names)
+		// Each condition and the else block are a scope inside the function's
+		assert.Equal(t, []string{"1:0", "1:0", "1:0"}, addresses(program)["c"])
+	})
+
+	t.Run("ForLoop", func(t *testing.T) {
+		program, err := resolve(t, "for (let i = 0; i < 3; i = i + step) {\n  let step = 1\n}\n", resolver.Options{})
+		require.NoError(t, err)
+		loop := program.Body[0].(ast.ForStatementNode)
+		assert.Equal(t, []string{"i", "step"}, loop.Scope.Names)
+		assert.Equal(t, []string{"0:0", "0:0", "0:0"}, addresses(program)["i"])
+	})
+
+	t.Run("Catch", func(t *testing.T) {
+		program, err := resolve(t, "try {\n  let t = 1\n} catch e {\n  let h = e\n}\n", resolver.Options{})
+		require.NoError(t, err)
+		try := program.Body[0].(ast.TryStatementNode)
+		assert.Equal(t, []string{"t"}, try.Scope.Names)
+		assert.Equal(t, []string{"e", "h"}, try.HandlerScope.Names)
+	})
+
+	t.Run("DuplicatesShareASlot", func(t *testing.T) {
+		program, err := resolve(t, "fn f(a, a) {\n  let b = 1\n  let b = 2\n}\n", resolver.Options{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b"}, program.Body[0].(ast.FunctionDeclarationNode).Scope.Names)
+	})
+
+	t.Run("LeavesInputAlone", func(t *testing.T) {
+		program, err := FE.Parse("fn f(x) {\n  pop x\n}\n")
+		require.NoError(t, err)
+		before, err := FE.Parse("fn f(x) {\n  pop x\n}\n")
+		require.NoError(t, err)
+
+		_, err = resolver.Resolve(program, resolver.Options{})
+		require.NoError(t, err)
+		assert.Equal(t, before, program)
+	})
+}
+
+func TestProblems(t *testing.T) {
+	builtins := resolver.Options{Globals: func(name string) bool { return name == "print" }}
+
+	for _, test := range []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"Undeclared", "print(missing)\nmissing", "Undeclared variable 'missing' on line 1"},
+		{"UndeclaredInFunction", "fn f() {\n  pop nope\n}\n", "Undeclared variable 'nope' on line 2"},
+		{"UsedBeforeDeclaration", "fn f() {\n  print(x)\n  let x = 1\n}\n", "Variable 'x' is used on line 2 before its declaration on line 3"},
+		{"OwnInitializer", "fn f() {\n  let x = x\n}\n", "Variable 'x' is used on line 2 before its declaration on line 2"},
+		{"GlobalBeforeDeclaration", "print(g)\nlet g = 1\n", "Variable 'g' is used on line 1 before its declaration on line 2"},
+		{"Several", "fn f() {\n  pop b\n}\na\n", "Undeclared variable 'b' on line 2\nUndeclared variable 'a' on line 4"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := resolve(t, test.source, builtins)
+			var resolveErr *resolver.Error
+			require.True(t, errors.As(err, &resolveErr), "%v", err)
+			assert.EqualError(t, err, test.want)
+		})
+	}
+
+	for _, test := range []struct {
+		name   string
+		source string
+	}{
+		// Functions run after the code around them declared what they use
+		{"GlobalDeclaredLater", "fn f() {\n  pop g\n}\nlet g = 1\nf()\n"},
+		{"LocalDeclaredLater", "fn f() {\n  fn g() {\n    pop later\n  }\n  let later = 1\n  pop g()\n}\n"},
+		{"Recursion", "fn f(n) {\n  pop f(n - 1)\n}\n"},
+		// Until a scope declares a variable, its code sees the one outside
+		{"OuterUntilDeclared", "let x = 1\nfn f() {\n  print(x)\n  let x = 2\n}\n"},
+		{"ConditionBeforeShadow", "fn f(x) {\n  if x {\n    let x = 2\n  }\n}\n"},
+		{"Builtin", "print(1)\n"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := resolve(t, test.source, builtins)
+			assert.NoError(t, err)
+		})
+	}
+
+	t.Run("NoGlobalsSkipsUndeclared", func(t *testing.T) {
+		_, err := resolve(t, "missing\n", resolver.Options{})
+		assert.NoError(t, err)
+	})
+}
+
+func TestSymbols(t *testing.T) {
+	source := "const limit = 3\nfn f(limit) {\n  limit = 1\n  pop limit\n}\nlimit = f(limit)\nprint(other)\n"
+	symbols := &resolver.Symbols{}
+	_, err := resolve(t, source, resolver.Options{Symbols: symbols})
+	require.NoError(t, err)
+
+	require.Len(t, symbols.Declarations, 3)
+	global, fn, param := symbols.Declarations[0], symbols.Declarations[1], symbols.Declarations[2]
+	type decl struct {
+		name     string
+		pos      ast.Position
+		kind     resolver.DeclarationKind
+		constant bool
+	}
+	describe := func(d *resolver.Declaration) decl { return decl{d.Name, d.Pos, d.Kind, d.Constant()} }
+	assert.Equal(t, decl{"limit", ast.Position{Line: 1, Column: 7}, resolver.Constant, true}, describe(global))
+	assert.Equal(t, decl{"f", ast.Position{Line: 2, Column: 4}, resolver.Function, true}, describe(fn))
+	assert.Equal(t, decl{"limit", ast.Position{Line: 2, Column: 6}, resolver.Parameter, false}, describe(param))
+	assert.IsType(t, ast.VariableDeclarationNode{}, global.Node)
+	assert.IsType(t, ast.FunctionDeclarationNode{}, param.Node)
+
+	// The globals and the parameters of f are in scopes of their own
+	require.Len(t, symbols.Scopes, 2)
+	globals, body := symbols.Scopes[0], symbols.Scopes[1]
+	assert.IsType(t, ast.Program{}, globals.Node)
+	assert.Equal(t, []*resolver.Declaration{global, fn}, globals.Declarations)
+	assert.Same(t, globals, body.Parent)
+	assert.Same(t, body, param.Scope)
+
+	type use struct {
+		line        int
+		assignment  bool
+		declaration *resolver.Declaration
+	}
+	var uses []use
+	for _, ref := range symbols.References {
+		if ref.Name == "limit" {
+			uses = append(uses, use{ref.Pos.Line, ref.Assignment, ref.Declaration})
+		}
+	}
+	// The parameter shadows the constant inside f
+	assert.Equal(t, []use{{3, true, param}, {4, false, param}, {6, false, global}, {6, true, global}}, uses)
+
+	// Natives and undeclared variables have no declaration
+	for _, ref := range symbols.References {
+		if ref.Name == "print" || ref.Name == "other" {
+			assert.Nil(t, ref.Declaration, ref.Name)
+		}
+	}
+
+	// The variable of a shorthand property is marked as such
+	symbols = &resolver.Symbols{}
+	_, err = resolve(t, "let a = 1\nlet o = {a, b: a}\n", resolver.Options{Symbols: symbols})
+	require.NoError(t, err)
+	require.Len(t, symbols.References, 2)
+	assert.True(t, symbols.References[0].Shorthand)
+	assert.False(t, symbols.References[1].Shorthand)
+}
+
+func TestImportSymbols(t *testing.T) {
+	symbols := &resolver.Symbols{}
+	program, err := resolve(t, "import { a, b as c } from \"m\"\nimport * as ns from \"n\"\nfn f() {\n  pop [a, c, ns]\n}\n", resolver.Options{Symbols: symbols})
+	require.NoError(t, err)
+
+	require.Len(t, symbols.Declarations, 4)
+	type decl struct {
+		name     string
+		pos      ast.Position
+		kind     resolver.DeclarationKind
+		constant bool
+	}
+	var decls []decl
+	for _, d := range symbols.Declarations[:3] {
+		assert.IsType(t, ast.ImportDeclarationNode{}, d.Node)
+		decls = append(decls, decl{d.Name, d.Pos, d.Kind, d.Constant()})
+	}
+	assert.Equal(t, []decl{
+		{"a", ast.Position{Line: 1, Column: 10}, resolver.Import, true},
+		{"c", ast.Position{Line: 1, Column: 18}, resolver.Import, true},
+		{"ns", ast.Position{Line: 2, Column: 13}, resolver.Import, true},
+	}, decls)
+
+	// Imports are globals
+	assert.Equal(t, map[string][]string{"a": {"global"}, "c": {"global"}, "ns": {"global"}}, addresses(program))
+	for _, ref := range symbols.References {
+		assert.NotNil(t, ref.Declaration, ref.Name)
+	}
+}
+
+func TestInterpreter(t *testing.T) {
+	for _, engine := range []BE.Engine{nil, vm.Engine{}} {
+		it := BE.NewInterpreter(BE.Options{Engine: engine})
+
+		// Nothing runs when a variable is undeclared
+		_, err := it.RunString("let ran = true\nmissing\n")
+		var resolveErr *resolver.Error
+		require.True(t, errors.As(err, &resolveErr), "%T: %v", engine, err)
+		_, declared := it.Globals.LookupVar("ran")
+		assert.False(t, declared, "%T", engine)
+
+		// Globals of earlier runs are declared
+		_, err = it.RunString("let total = 1\n")
+		require.NoError(t, err)
+		result, err := it.RunString("fn add(n) {\n  let sum = total + n\n  pop sum\n}\nadd(2)")
+		require.NoError(t, err, "%T", engine)
+		assert.Equal(t, BE.NumberVal{Value: 3}, result)
+	}
+}
+
+func TestCachedProgramsCheckGlobals(t *testing.T) {
+	cache := &C.Cache{Dir: t.TempDir()}
+	for _, source := range []string{
+		"print(missing)\nfn f() {\n  pop g + missing\n}\nlet g = 1\n",
+		"print(g)\nlet g = 1\n",
+	} {
+		want, err := BE.NewInterpreter(BE.Options{}).RunString(source)
+		require.Error(t, err)
+
+		it := BE.NewInterpreter(BE.Options{Engine: vm.Engine{Cache: cache}})
+		got, cachedErr := it.RunString(source)
+		assert.Equal(t, want, got)
+		assert.Equal(t, err, cachedErr)
+	}
+}
+
+// benchmarkSources are the loops of example.pop at the top level, where
+// only the loop counter is local, and inside a function, where every
+// variable is.
+func benchmarkSources(b *testing.B) map[string]string {
+	example, err := os.ReadFile("../../example.pop")
+	require.NoError(b, err)
+	return map[string]string{
+		"TopLevel": string(example),
+		"Function": "fn main() {\n" + string(example) + "\n}\nmain()\n",
+	}
+}
+
+// BenchmarkExampleLoops compares looking variables up by name with the
+// slots the resolver assigns.
+func BenchmarkExampleLoops(b *testing.B) {
+	for name, source := range benchmarkSources(b) {
+		program, err := FE.Parse(source)
+		require.NoError(b, err)
+		resolved, err := resolver.Resolve(program, resolver.Options{})
+		require.NoError(b, err)
+
+		for _, variant := range []struct {
+			name    string
+			program ast.Program
+		}{{"Names", program}, {"Slots", resolved}} {
+			b.Run(name+"/"+variant.name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					BE.Evaluate(variant.program, BE.MakeGlobalEnvironment())
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package typecheck_test
+
+import (
+	"pop/typecheck"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// problems checks source and lists what it finds as "line:column message".
+func problems(t *testing.T, source string) []string {
+	t.Helper()
+	found, err := typecheck.CheckSource(source)
+	require.NoError(t, err)
+	list := []string{}
+	for _, p := range found {
+		list = append(list, p.String())
+	}
+	return list
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   []string
+	}{
+		{"Variables", "let n: number = \"a\"\nlet s: string = 1 + 2\nlet b: boolean = n < 2\n",
+			[]string{"1:17: Variable 'n' must be number, got string", "2:17: Variable 's' must be string, got number"}},
+		{"Inferred", "let n = 1\nlet x: string = n\nn - \"a\"\n",
+			[]string{"2:17: Variable 'x' must be string, got number", "3:5: Operator - needs numbers, got string"}},
+		{"Objects", "type Point = { x: number, y: number }\nlet p: Point = { x: 1 }\nlet q: Point = { x: 1, y: 2, z: 3 }\np.x = \"a\"\n",
+			[]string{"2:16: Variable 'p' must be Point, got { x: number }", "4:7: Property 'x' must be number, got string"}},
+		{"Calls", "fn add(a: number, b: number): number {\n  pop a + b\n}\nadd(1, \"2\")\nadd(1)\nlet s: string = add(1, 2)\n",
+			[]string{"4:8: Argument 'b' of add must be number, got string", "5:4: add takes 2 arguments, got 1", "6:17: Variable 's' must be string, got number"}},
+		{"Arrays", "let xs: number[] = [1, 2]\nxs[0] = \"a\"\nlet ys: string[] = xs\nxs[\"a\"]\n",
+			[]string{"2:9: Element of number[] must be number, got string", "3:20: Variable 'ys' must be string[], got number[]", "4:4: Array index must be number, got string"}},
+		{"Unions", "let u: number | string = 1\nu = true\nu = \"a\"\n",
+			[]string{"2:5: Variable 'u' must be number | string, got boolean"}},
+		{"Aliases", "type T = Nope\nlet a: Missing = 1\ntype T = number\ntype U = U\ntype List = { next: List? }\n",
+			[]string{"1:10: Unknown type 'Nope'", "2:8: Unknown type 'Missing'", "3:6: Type 'T' is already declared", "4:6: Type 'U' refers to itself"}},
+		{"Values", "let a = 1\na()\nlet o = null\no.x\n-\"a\"\n",
+			[]string{"2:1: Cannot call number", "4:1: Cannot read property 'x' of null", "5:2: Cannot negate string"}},
+		{"MissingPop", "fn g(a: number): string {\n  if a > 1 {\n    pop \"a\"\n  }\n}\n",
+			[]string{"1:4: Function 'g' can end without popping string"}},
+		{"Terminating", "fn loop(n: number): number {\n  while true {\n    pop n\n  }\n}\nfn rec(n: number): number {\n  pop rec(n - 1)\n}\n",
+			[]string{}},
+		{"Unannotated", "let a = 1\na = \"b\"\nfn f(x) {\n  pop x.y\n}\nf(1, 2, 3)\n",
+			[]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, problems(t, tt.source))
+		})
+	}
+}
+
+func TestNarrowing(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   []string
+	}{
+		{"Unchecked", "fn f(a: number?): number {\n  pop a + 1\n}\n",
+			[]string{"2:7: Operator + needs numbers, got number?"}},
+		{"GuardClause", "fn f(a: number?): number {\n  if a == null {\n    pop 0\n  }\n  pop a + 1\n}\n",
+			[]string{}},
+		{"Truthiness", "fn f(a: number?): number {\n  if a {\n    pop a\n  }\n  pop 0\n}\n",
+			[]string{}},
+		{"Not", "fn f(a: string?): string {\n  if !a {\n    pop \"\"\n  }\n  pop a\n}\n",
+			[]string{}},
+		{"And", "fn f(a: number?, b: number?): number {\n  if a != null && b != null {\n    pop a + b\n  }\n  pop 0\n}\n",
+			[]string{}},
+		{"Default", "fn f(a: string?): string {\n  pop a || \"x\"\n}\n",
+			[]string{}},
+		{"Assigned", "let a: number? = null\na = 1\na + 1\n",
+			[]string{}},
+		{"Loop", "let a: number? = 1\nwhile a {\n  a = null\n}\na + 1\n",
+			[]string{"5:1: Operator + needs numbers, got number?"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, problems(t, tt.source))
+		})
+	}
+}
+
+func TestCheckSyntaxError(t *testing.T) {
+	_, err := typecheck.CheckSource("let a: = 1\n")
+	assert.Error(t, err)
+}
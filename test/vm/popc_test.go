@@ -0,0 +1,66 @@
+package vm_test
+
+import (
+	"context"
+	"os"
+	BE "pop/backend"
+	C "pop/compiler"
+	FE "pop/frontend"
+	"pop/optimizer"
+	"pop/vm"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const tracebackSource = "fn divide(a, b) {\n  if b == 0 {\n    throw \"cannot divide by zero\"\n  }\n  pop a / b\n}\n\nprint(divide(6, 3))\ndivide(1, 0)\n"
+
+// load compiles source to a .popc file in memory and reads it back.
+func load(t *testing.T, source string) *C.Program {
+	t.Helper()
+	parsed, err := FE.Parse(source)
+	require.NoError(t, err)
+	proto, err := C.Compile(parsed, C.Options{File: "<input>"})
+	require.NoError(t, err)
+	data, err := (&C.Program{Proto: proto, Source: source}).MarshalBinary()
+	require.NoError(t, err)
+
+	var program C.Program
+	require.NoError(t, program.UnmarshalBinary(data))
+	return &program
+}
+
+func TestRunProgram(t *testing.T) {
+	for _, source := range []string{
+		"fn fib(n) {\n  if n < 2 {\n    pop n\n  }\n  pop fib(n - 1) + fib(n - 2)\n}\nprint(fib(10))\n[1, { a: \"b\" }]",
+		"fn counter() {\n  let n = 0\n  fn inc() {\n    n = n + 1\n    n\n  }\n  inc\n}\nconst c = counter()\nc()\nc()",
+		tracebackSource,
+	} {
+		it, stdout := newInterpreter(BE.Options{}, nil)
+		result, err := vm.RunProgram(context.Background(), it, load(t, source))
+		assert.Equal(t, run(BE.Options{}, nil, source), observe(result, err, stdout), "a .popc file runs like its source, tracebacks included")
+	}
+}
+
+func TestEngineCache(t *testing.T) {
+	cache := &C.Cache{Dir: t.TempDir()}
+	engine := vm.Engine{Cache: cache}
+
+	first := run(BE.Options{}, engine, tracebackSource)
+	entries, err := os.ReadDir(cache.Dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	assert.Equal(t, first, run(BE.Options{}, engine, tracebackSource), "a cached program runs the same")
+	assert.Equal(t, run(BE.Options{}, nil, tracebackSource), first)
+
+	// Optimizing cannot hide variables the source gets wrong
+	dead := "if false {\n  undefinedThing()\n}\n1"
+	optimized := BE.Options{Optimizer: optimizer.Level(2)}
+	assert.Equal(t, run(BE.Options{}, nil, dead), run(optimized, engine, dead))
+	assert.Equal(t, run(BE.Options{}, nil, dead), run(optimized, engine, dead), "nor can the cache")
+
+	out := run(BE.Options{}, engine, "let = 1")
+	assert.Equal(t, run(BE.Options{}, nil, "let = 1").Error, out.Error, "syntax errors are reported as before")
+}
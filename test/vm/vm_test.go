@@ -0,0 +1,369 @@
+package vm_test
+
+import (
+	"bytes"
+	"errors"
+	BE "pop/backend"
+	"pop/vm"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// outcome is everything observable about a run.
+type outcome struct {
+	Result    string
+	Stdout    string
+	Error     string
+	Name      string
+	Traceback string
+}
+
+func newInterpreter(opts BE.Options, engine BE.Engine) (*BE.Interpreter, *bytes.Buffer) {
+	var stdout bytes.Buffer
+	opts.Stdout = &stdout
+	opts.Engine = engine
+	return BE.NewInterpreter(opts), &stdout
+}
+
+func run(opts BE.Options, engine BE.Engine, source string) outcome {
+	it, stdout := newInterpreter(opts, engine)
+	result, err := it.RunString(source)
+	return observe(result, err, stdout)
+}
+
+func observe(result BE.RuntimeVal, err error, stdout *bytes.Buffer) outcome {
+	out := outcome{Stdout: stdout.String()}
+	if err != nil {
+		out.Error = err.Error()
+		var runtimeErr *BE.RuntimeError
+		if errors.As(err, &runtimeErr) {
+			out.Name = runtimeErr.Name
+			out.Traceback = runtimeErr.Traceback()
+		}
+		return out
+	}
+	out.Result = BE.Inspect(result, BE.DefaultInspectOptions)
+	return out
+}
+
+// same runs source on both engines and expects the same outcome.
+func same(t *testing.T, opts BE.Options, source string) outcome {
+	t.Helper()
+	tree := run(opts, nil, source)
+	bytecode := run(opts, vm.Engine{}, source)
+	assert.Equal(t, tree, bytecode)
+	return bytecode
+}
+
+var programs = []struct {
+	name   string
+	source string
+}{
+	{"Arithmetic", "1 + 2 * 3 - 4 / 2"},
+	{"Modulo", "17 % 5"},
+	{"Comparison", "[1 < 2, 2 <= 2, 3 > 4, 4 >= 5]"},
+	{"Equality", "[\"a\" == \"a\", [1, 2] == [1, 2], [1] is [1], null != 0]"},
+	{"Negation", "[-5, !true, !0, !\"\"]"},
+	{"Logical", "[null || \"default\", 0 && 1, true && \"yes\", \"x\" || false]"},
+	{"Arrays", "let a = [1, [2, 3]]\na[1][0]"},
+	{"Objects", "let o = { x: 1, y: { z: 2 } }\n[o.y.z, o.q, o[1]]"},
+	{"Shorthand", "let x = 3\nlet o = { x }\no.x"},
+	{"Declarations", "let a = 1\nconst b = 2\na = a + b\na"},
+	{"Print", "print(\"a\", 1, [true])\nprint({ k: null })"},
+	{"Sort", "sort([3, 1, 2])"},
+	{"ShadowBuiltins", "let env = \"prod\"\nconst sort = 1\nfn Map() {\n  \"mine\"\n}\n[env, sort, Map()]"},
+	{"MapAndSet", "let m = Map([[1, \"one\"]])\nm.set(2, \"two\")\nlet s = Set([1, 1, 2])\n[m.get(2), m.size, s.has(1), s.size]"},
+	{"If", "let r = 0\nif 1 < 2 {\n  r = 1\n} else {\n  r = 2\n}\nr"},
+	{"ElseIf", "fn f(n) {\n  if n < 0 {\n    pop \"neg\"\n  } else if n == 0 {\n    pop \"zero\"\n  } else {\n    pop \"pos\"\n  }\n}\n[f(-1), f(0), f(1)]"},
+	{"IfValue", "if true {\n  1\n}"},
+	{"Shadowing", "let x = 1\nif true {\n  let x = 2\n  print(x)\n}\nx"},
+	{"ElseScopeEnds", "if false {\n} else {\n  let y = 5\n}\ny"},
+	{"ElseShadows", "let y = 1\nif false {\n} else {\n  let y = 5\n  print(y)\n}\ny"},
+	{"While", "let i = 0\nlet s = 0\nwhile i < 10 {\n  s = s + i\n  i = i + 1\n}\ns"},
+	{"For", "let s = 0\nfor (let i = 0; i < 5; i = i + 1) {\n  s = s + i\n}\ns"},
+	{"ForScopeEnds", "for (let i = 0; i < 1; i = i + 1) {\n}\ni"},
+	{"LetInLoopBody", "let i = 0\nwhile i < 2 {\n  let x = i\n  i = i + 1\n}"},
+	{"Functions", "fn add(a, b) {\n  a + b\n}\nadd(2, 3)"},
+	{"MissingAndExtraArgs", "fn f(a, b) {\n  [a, b]\n}\n[f(1), f(1, 2, 3)]"},
+	{"FunctionValue", "fn f() {\n}\nf"},
+	{"EmptyFunction", "fn f() {\n}\nf()"},
+	{"Recursion", "fn fib(n) {\n  if n < 2 {\n    pop n\n  }\n  fib(n - 1) + fib(n - 2)\n}\nfib(15)"},
+	{"Closures", "fn counter() {\n  let n = 0\n  fn inc() {\n    n = n + 1\n    n\n  }\n  inc\n}\nconst a = counter()\nconst b = counter()\na()\na()\n[a(), b()]"},
+	{"SharedCapture", "fn pair() {\n  let v = 0\n  fn get() {\n    v\n  }\n  fn set(x) {\n    v = x\n  }\n  [get, set]\n}\nconst p = pair()\nconst get = p[0]\nconst set = p[1]\nset(7)\nget()"},
+	{"NestedCapture", "fn outer() {\n  let x = 1\n  fn middle() {\n    fn inner() {\n      x = x + 1\n      x\n    }\n    inner\n  }\n  middle\n}\nconst m = outer()\nconst i = m()\ni()\ni()"},
+	{"CaptureInLoop", "let fns = []\nlet i = 0\nfn mk(v) {\n  fn get() {\n    v\n  }\n  get\n}\nlet a = mk(1)\nlet b = mk(2)\n[a(), b()]"},
+	{"CaptureBlockVariable", "let get = null\nif true {\n  let hidden = 42\n  fn g() {\n    hidden\n  }\n  get = g\n}\nget()"},
+	{"UseBeforeDeclaration", "fn f() {\n  g()\n  fn g() {\n  }\n}\nf()"},
+	{"CaptureBeforeDeclaration", "fn f() {\n  fn g() {\n    later\n  }\n  g()\n  let later = 1\n}\nf()"},
+	{"GlobalFromFunction", "fn f() {\n  total = total + 1\n}\nlet total = 0\nf()\nf()\ntotal"},
+	{"TryCatch", "let r = 0\ntry {\n  throw 42\n} catch err {\n  r = err\n}\nr"},
+	{"CatchRuntimeError", "let r = null\ntry {\n  null()\n} catch err {\n  r = [err.name, err.message]\n}\nr"},
+	{"CatchAcrossCalls", "fn boom() {\n  throw { name: \"Oops\", message: \"bad\" }\n}\nfn call() {\n  boom()\n  1\n}\nlet r = null\ntry {\n  call()\n} catch e {\n  r = e.name\n}\nr"},
+	{"NestedTry", "let log = []\ntry {\n  try {\n    throw 1\n  } catch a {\n    throw 2\n  }\n} catch b {\n  log = [b]\n}\nlog"},
+	{"PopFromTry", "fn f() {\n  try {\n    pop 1\n  } catch {\n  }\n  pop 2\n}\nf()"},
+	{"PopFromCatch", "fn f() {\n  try {\n    throw 1\n  } catch {\n    pop 3\n  }\n  pop 2\n}\nf()"},
+	{"TryScopeResets", "let n = 0\nwhile n < 2 {\n  try {\n    let t = n\n    throw t\n  } catch {\n  }\n  n = n + 1\n}\nn"},
+	{"CatchStackOverflow", "fn f() {\n  f()\n}\nlet r = null\ntry {\n  f()\n} catch e {\n  r = e.name\n}\nr"},
+	{"TopLevelPop", "pop 5\n6"},
+	{"TopLevelPopEndsStatement", "let r = 0\nwhile true {\n  r = r + 1\n  pop r\n}"},
+	{"TopLevelPopFromTry", "try {\n  let t = 1\n  pop t\n} catch {\n}\nprint(\"after\")"},
+
+	{"UndefinedVariable", "missing + 1"},
+	{"ReassignConstant", "const c = 1\nc = 2"},
+	{"ReassignConstantLocal", "fn f() {\n  const c = 1\n  c = 2\n}\nf()"},
+	{"ReassignCapturedConstant", "fn f() {\n  const c = 1\n  fn g() {\n    c = 2\n  }\n  g()\n}\nf()"},
+	{"ReassignFunction", "fn f() {\n}\nf = 1"},
+	{"Redeclare", "let a = 1\nlet a = 2"},
+	{"RedeclareLocal", "fn f() {\n  let a = 1\n  let a = 2\n}\nf()"},
+	{"RepeatedParam", "fn f(a, a) {\n}\nf(1, 2)"},
+	{"ConstWithoutValue", "const c = null"},
+	{"ArithmeticOnString", "fn f() {\n  \"a\" + 1\n}\nf()"},
+	{"ComparisonOnString", "\"a\" < 1"},
+	{"NegateString", "-\"a\""},
+	{"CallNonFunction", "let x = 1\nx()"},
+	{"IndexNotNumber", "[1][\"a\"]"},
+	{"ModuloByZero", "fn f(a) {\n  a % 0\n}\nf(5)"},
+	{"IndexOutOfBounds", "fn f(xs) {\n  xs[5]\n}\nf([1, 2])"},
+	{"ObjectKeyString", "let o = { a: 1 }\no[\"a\"]"},
+	{"ComputedOnNumber", "let n = 1\nn[0]"},
+	{"PropertyOnNumber", "let n = 1\nn.x"},
+	{"InvalidAssignee", "let o = { a: 1 }\no.a = 2"},
+	{"ThrowString", "fn f(a, b) {\n  if b == 0 {\n    throw \"cannot divide by zero\"\n  }\n  a / b\n}\nfn g(x) {\n  f(x, 0)\n}\ng(1)"},
+	{"ThrowObject", "throw { name: \"ValueError\", message: \"bad value\" }"},
+	{"NativeError", "fn load() {\n  pop fs.read(\"secret.txt\")\n}\nload()"},
+	{"NativeArgumentError", "Map(1)"},
+	{"StackOverflow", "fn f(n) {\n  f(n + 1)\n}\nf(0)"},
+	{"ErrorInCatch", "try {\n  throw 1\n} catch e {\n  null()\n}"},
+}
+
+func TestDifferential(t *testing.T) {
+	for _, p := range programs {
+		t.Run(p.name, func(t *testing.T) {
+			same(t, BE.Options{}, p.source)
+		})
+	}
+}
+
+func TestDifferentialStrictBooleans(t *testing.T) {
+	sources := []string{
+		"true && false || true",
+		"1 && true",
+		"true && 1",
+		"false || 1",
+		"!1",
+		"if 1 {\n}",
+		"while null {\n}",
+		"for (let i = 0; i; i = i + 1) {\n}",
+		"if 1 < 2 {\n  3\n}",
+	}
+	for _, source := range sources {
+		t.Run(source, func(t *testing.T) {
+			same(t, BE.Options{StrictBooleans: true}, source)
+		})
+	}
+}
+
+func TestDifferentialCheckTypes(t *testing.T) {
+	sources := []string{
+		"let n: number = \"1\"\n",
+		"let n: number? = 1\nn = null\nn",
+		"fn f(a: string): string {\n  pop a\n}\nf(\"x\")",
+		"fn f(a: number?) {\n}\nf()",
+		"type Point = { x: number }\nlet p: Point = { x: 1 }\np.x = \"1\"\np",
+	}
+	for _, source := range sources {
+		t.Run(source, func(t *testing.T) {
+			same(t, BE.Options{CheckTypes: true}, source)
+		})
+	}
+}
+
+func TestDifferentialModules(t *testing.T) {
+	modules := BE.MapResolver{
+		"util.pop":  "print(\"loading util\")\nlet hidden = 3\nexport let count = 1\nexport fn double(x) {\n  x * hidden\n}\n",
+		"again.pop": "import * as util from \"./util.pop\"\nexport let same = util.count\n",
+		"a.pop":     "import { b } from \"./b.pop\"\nexport let a = 1\n",
+		"b.pop":     "import { a } from \"./a.pop\"\nexport let b = 2\n",
+		"boom.pop":  "export fn f() {\n  null()\n}\nf()\n",
+	}
+	sources := []string{
+		"import { double, count as c } from \"util.pop\"\nimport { same } from \"again.pop\"\n[double(c), same]",
+		"import * as util from \"util.pop\"\nutil",
+		"let hidden = 1\nimport { double } from \"util.pop\"\nfn f() {\n  double(hidden)\n}\nf()",
+		"import { count } from \"util.pop\"\ncount = 2",
+		"import { nope } from \"util.pop\"\n",
+		"import { a } from \"a.pop\"\n",
+		"import { f } from \"boom.pop\"\n",
+		"import * as m from \"missing.pop\"\n",
+	}
+	for _, source := range sources {
+		t.Run(source, func(t *testing.T) {
+			same(t, BE.Options{Resolver: modules}, source)
+		})
+	}
+}
+
+func TestTracebacksMatch(t *testing.T) {
+	out := same(t, BE.Options{}, "fn divide(a, b) {\n  if b == 0 {\n    throw \"cannot divide by zero\"\n  }\n  pop a / b\n}\n\nfn run(xs) {\n  pop divide(xs[0], xs[1])\n}\n\nrun([1, 0])\n")
+
+	assert.Equal(t, `Traceback (most recent call last):
+  File "<input>", line 12, in <module>
+    run([1, 0])
+  File "<input>", line 9, in run(xs = [1, 0])
+    pop divide(xs[0], xs[1])
+  File "<input>", line 3, in divide(a = 1, b = 0)
+    throw "cannot divide by zero"
+Error: cannot divide by zero`, out.Traceback)
+
+	// Arguments of the wrong type are the caller's error, and the checks
+	// have no frame of their own
+	out = same(t, BE.Options{CheckTypes: true}, "fn half(n: number): number {\n  pop n / 2\n}\n\nfn run(x) {\n  pop half(x)\n}\n\nrun(\"1\")\n")
+	assert.Equal(t, `Traceback (most recent call last):
+  File "<input>", line 9, in <module>
+    run("1")
+  File "<input>", line 6, in run(x = "1")
+    pop half(x)
+TypeError: argument 'n' of half must be number, got string`, out.Traceback)
+
+	out = same(t, BE.Options{CheckTypes: true}, "fn name(n): string {\n  pop n\n}\n\nname(1)\n")
+	assert.NotContains(t, out.Traceback, "$check")
+	assert.Contains(t, out.Traceback, "line 2, in name(n = 1)\n")
+
+	out = same(t, BE.Options{}, "fn pairs(p) {\n  pop Map(p)\n}\n\npairs(1)\n")
+	assert.Contains(t, out.Traceback, "line 2, in pairs(p = 1)\n    pop Map(p)\n  in <native Map>(1)\n")
+}
+
+func TestLimits(t *testing.T) {
+	t.Run("CallDepth", func(t *testing.T) {
+		out := same(t, BE.Options{Limits: BE.Limits{MaxCallDepth: 50}}, "fn f(n) {\n  f(n + 1)\n}\nf(0)")
+		assert.Equal(t, "StackOverflowError", out.Name)
+
+		// The VM's frames are on the heap, so it allows deeper recursion
+		it, _ := newInterpreter(BE.Options{Limits: BE.Limits{MaxCallDepth: 1 << 40}}, vm.Engine{})
+		assert.Equal(t, vm.MaxCallDepth, it.MaxCallDepth())
+	})
+
+	t.Run("Steps", func(t *testing.T) {
+		// The engines count steps differently, so only the error matches
+		opts := BE.Options{Limits: BE.Limits{MaxSteps: 1000}}
+		tree := run(opts, nil, "while true {\n}")
+		bytecode := run(opts, vm.Engine{}, "while true {\n}")
+		assert.Equal(t, tree.Error, bytecode.Error)
+		assert.Equal(t, "StepLimitError", bytecode.Name)
+
+		bytecode = run(opts, vm.Engine{}, "try {\n  while true {\n  }\n} catch {\n}")
+		assert.Equal(t, "StepLimitError", bytecode.Name, "fatal errors cannot be caught")
+	})
+
+	t.Run("ArrayLength", func(t *testing.T) {
+		out := same(t, BE.Options{Limits: BE.Limits{MaxArrayLength: 2}}, "[1, 2, 3]")
+		assert.Equal(t, "RangeError", out.Name)
+	})
+
+	t.Run("StringLength", func(t *testing.T) {
+		out := same(t, BE.Options{Limits: BE.Limits{MaxStringLength: 3}}, "\"abcd\"")
+		assert.Equal(t, "RangeError", out.Name)
+	})
+}
+
+func TestGlobalsPersistAcrossRuns(t *testing.T) {
+	it, _ := newInterpreter(BE.Options{}, vm.Engine{})
+
+	_, err := it.RunString("fn counter() {\n  let n = 0\n  fn inc() {\n    n = n + 1\n    n\n  }\n  inc\n}\nconst c = counter()\nc()")
+	require.NoError(t, err)
+
+	result, err := it.RunString("c()")
+	require.NoError(t, err)
+	assert.Equal(t, BE.NumberVal{Value: 2}, result)
+}
+
+func TestHostCalls(t *testing.T) {
+	t.Run("Call", func(t *testing.T) {
+		it, _ := newInterpreter(BE.Options{}, vm.Engine{})
+		_, err := it.RunString("fn add(a, b) {\n  a + b\n}")
+		require.NoError(t, err)
+
+		result, err := it.Call("add", BE.NumberVal{Value: 2}, BE.NumberVal{Value: 3})
+		require.NoError(t, err)
+		assert.Equal(t, BE.NumberVal{Value: 5}, result)
+	})
+
+	t.Run("NativeCallback", func(t *testing.T) {
+		// A native calling back into a closure runs it on the VM that
+		// created it, while that VM is in the middle of a call
+		source := "fn twice(x) {\n  x * 2\n}\nfn run(n) {\n  let base = 10\n  fn add(x) {\n    x + base\n  }\n  [apply(twice, n), apply(add, n)]\n}\nrun(4)"
+		for _, engine := range []BE.Engine{nil, vm.Engine{}} {
+			it, _ := newInterpreter(BE.Options{}, engine)
+			installApply(it)
+
+			result, err := it.RunString(source)
+			require.NoError(t, err)
+			assert.Equal(t, "[8, 14]", BE.Inspect(result, BE.DefaultInspectOptions))
+		}
+	})
+
+	t.Run("CallbackErrorsAreCatchable", func(t *testing.T) {
+		source := "fn bad() {\n  throw \"from callback\"\n}\nlet r = null\ntry {\n  apply(bad, 1)\n} catch e {\n  r = e\n}\nr"
+		var outcomes []outcome
+		for _, engine := range []BE.Engine{nil, vm.Engine{}} {
+			it, stdout := newInterpreter(BE.Options{}, engine)
+			installApply(it)
+			result, err := it.RunString(source)
+			outcomes = append(outcomes, observe(result, err, stdout))
+		}
+		assert.Equal(t, outcomes[0], outcomes[1])
+		assert.Equal(t, `"from callback"`, outcomes[1].Result)
+	})
+
+	t.Run("CallbackTraceback", func(t *testing.T) {
+		source := "fn bad(x) {\n  x.y\n}\nfn run() {\n  apply(bad, 1)\n}\nrun()"
+		var tracebacks []string
+		for _, engine := range []BE.Engine{nil, vm.Engine{}} {
+			it, stdout := newInterpreter(BE.Options{}, engine)
+			installApply(it)
+			result, err := it.RunString(source)
+			tracebacks = append(tracebacks, observe(result, err, stdout).Traceback)
+		}
+		assert.Equal(t, tracebacks[0], tracebacks[1])
+		assert.True(t, strings.Contains(tracebacks[1], "in <native apply>(<fn bad(x)>, 1)"), tracebacks[1])
+	})
+}
+
+// installApply declares apply(fn, x), a native that calls fn(x).
+func installApply(it *BE.Interpreter) {
+	it.Globals.DeclareVar("apply", true, &BE.NativeFunctionVal{
+		Name: "apply",
+		Call: func(args []BE.RuntimeVal, env *BE.Environment) BE.RuntimeVal {
+			return it.Invoke(args[0], args[1:])
+		},
+	})
+}
+
+func BenchmarkFib(b *testing.B) {
+	source := "fn fib(n) {\n  if n < 2 {\n    pop n\n  }\n  fib(n - 1) + fib(n - 2)\n}\nfib(20)"
+	benchmarkEngines(b, source)
+}
+
+func BenchmarkLoop(b *testing.B) {
+	source := "let s = 0\nfor (let i = 0; i < 100000; i = i + 1) {\n  s = s + i\n}\ns"
+	benchmarkEngines(b, source)
+}
+
+func benchmarkEngines(b *testing.B, source string) {
+	for _, engine := range []struct {
+		name   string
+		engine BE.Engine
+	}{{"tree", nil}, {"vm", vm.Engine{}}} {
+		b.Run(engine.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				it, _ := newInterpreter(BE.Options{}, engine.engine)
+				if _, err := it.RunString(source); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
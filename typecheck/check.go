@@ -0,0 +1,900 @@
+// Package typecheck checks programs against their type annotations before
+// they run.
+//
+//	problems, err := typecheck.CheckSource(source)
+//
+// Annotations are optional. Where there are none the checker infers what it
+// can: the types of literals, of variables never assigned to after their
+// declaration, and of what functions pop. What it cannot infer is any, which
+// every value is of. Conditions such as `x != null` narrow the type of x in
+// the code they guard.
+package typecheck
+
+import (
+	"fmt"
+	FE "pop/frontend"
+	"pop/frontend/types/ast"
+	"pop/resolver"
+	"sort"
+)
+
+// Problem is a type error.
+type Problem struct {
+	Pos     ast.Position
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%d:%d: %s", p.Pos.Line, p.Pos.Column, p.Message)
+}
+
+// CheckSource parses and checks source. It fails with a
+// *frontend.SyntaxError if source does not parse.
+func CheckSource(source string) ([]Problem, error) {
+	program, err := FE.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	return Check(program), nil
+}
+
+// Check returns the type errors of program, ordered by position.
+func Check(program ast.Program) []Problem {
+	c := &checker{
+		refs:      map[ast.Position]*resolver.Declaration{},
+		decls:     map[ast.Position]*resolver.Declaration{},
+		assigned:  map[*resolver.Declaration]bool{},
+		aliases:   map[string]*alias{},
+		types:     map[*resolver.Declaration]Type{},
+		functions: map[ast.Position]*functionType{},
+		inferring: map[*resolver.Declaration]bool{},
+		reported:  map[Problem]bool{},
+	}
+	var symbols resolver.Symbols
+	resolver.Resolve(program, resolver.Options{Symbols: &symbols})
+	for _, decl := range symbols.Declarations {
+		c.decls[decl.Pos] = decl
+	}
+	for _, ref := range symbols.References {
+		c.refs[ref.Pos] = ref.Declaration
+		if ref.Assignment && ref.Declaration != nil {
+			c.assigned[ref.Declaration] = true
+		}
+	}
+	c.declareAliases(program)
+
+	c.block(program.Body, state{})
+
+	sort.SliceStable(c.problems, func(i, j int) bool {
+		a, b := c.problems[i].Pos, c.problems[j].Pos
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return c.problems
+}
+
+type checker struct {
+	// refs are the declarations of the variables used, by the position of
+	// the use, and decls the declarations by the position of their name
+	refs  map[ast.Position]*resolver.Declaration
+	decls map[ast.Position]*resolver.Declaration
+	// assigned are the variables assigned to after their declaration
+	assigned map[*resolver.Declaration]bool
+	aliases  map[string]*alias
+
+	// types are those of declarations, and functions those of function
+	// declarations by position, once they are known
+	types     map[*resolver.Declaration]Type
+	functions map[ast.Position]*functionType
+	// inferring are the variables whose types are being inferred, which
+	// are any to themselves
+	inferring map[*resolver.Declaration]bool
+
+	// fn is the function whose body is being checked, nil at top level
+	fn *function
+	// quiet is above zero while bodies are walked only to infer what they
+	// pop, when problems are not reported
+	quiet    int
+	problems []Problem
+	reported map[Problem]bool
+}
+
+// function is a function whose body is being checked.
+type function struct {
+	name string
+	// result is the annotated type of popped values, nil if there is none
+	result Type
+	// popped are the types of the values popped so far
+	popped []Type
+}
+
+// state is what the checker knows of variables at a point of the program,
+// beyond their declared types: a variable assigned a string is a string
+// until it is assigned something else, and one compared with null is not
+// null in the code the comparison guards.
+type state map[*resolver.Declaration]Type
+
+func (s state) clone() state {
+	out := make(state, len(s))
+	for decl, t := range s {
+		out[decl] = t
+	}
+	return out
+}
+
+func (c *checker) report(pos ast.Position, format string, args ...any) {
+	if c.quiet > 0 {
+		return
+	}
+	problem := Problem{Pos: pos, Message: fmt.Sprintf(format, args...)}
+	if !c.reported[problem] {
+		c.reported[problem] = true
+		c.problems = append(c.problems, problem)
+	}
+}
+
+// * ======== ANNOTATIONS ======== * \\
+
+// declareAliases makes the type aliases of program known, wherever they
+// are declared.
+func (c *checker) declareAliases(program ast.Program) {
+	var nodes []ast.TypeAliasNode
+	var find func(node ast.ASTNode) ast.ASTNode
+	find = func(node ast.ASTNode) ast.ASTNode {
+		if n, ok := node.(ast.TypeAliasNode); ok {
+			if first, exists := c.aliases[n.Name]; exists {
+				c.report(n.NamePos, "Type '%s' is already declared", first.name)
+			} else {
+				c.aliases[n.Name] = &alias{name: n.Name}
+				nodes = append(nodes, n)
+			}
+		}
+		return ast.MapChildren(node, find)
+	}
+	find(program)
+
+	for _, n := range nodes {
+		c.aliases[n.Name].t = c.typeOf(n.Type)
+	}
+	// An alias may only refer to itself inside an array, object or
+	// function type, or it would have no values
+	for _, n := range nodes {
+		if a := c.aliases[n.Name]; refersTo(a.t, a, map[*alias]bool{}) {
+			c.report(n.NamePos, "Type '%s' refers to itself", n.Name)
+			a.t = anyType
+		}
+	}
+}
+
+// refersTo reports whether t is a, or a union with a as a member.
+func refersTo(t Type, a *alias, seen map[*alias]bool) bool {
+	switch t := t.(type) {
+	case *alias:
+		if t == a {
+			return true
+		}
+		if seen[t] {
+			return false
+		}
+		seen[t] = true
+		return refersTo(t.t, a, seen)
+	case unionType:
+		for _, member := range t.types {
+			if refersTo(member, a, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// typeOf returns the type an annotation stands for.
+func (c *checker) typeOf(t *ast.TypeExpr) Type {
+	switch t.Kind {
+	case ast.NamedType:
+		switch name := basic(t.Name); name {
+		case anyType, numberType, stringType, booleanType, nullType:
+			return name
+		}
+		if a, ok := c.aliases[t.Name]; ok {
+			return a
+		}
+		c.report(t.Pos, "Unknown type '%s'", t.Name)
+		return anyType
+	case ast.ArrayType:
+		return arrayType{elem: c.typeOf(t.Elem)}
+	case ast.NullableType:
+		return union(c.typeOf(t.Elem), nullType)
+	case ast.UnionType:
+		types := make([]Type, len(t.Types))
+		for i, member := range t.Types {
+			types[i] = c.typeOf(member)
+		}
+		return union(types...)
+	case ast.ObjectType:
+		fields := make([]field, len(t.Fields))
+		for i, f := range t.Fields {
+			fields[i] = field{key: f.Key, optional: f.Optional, t: c.typeOf(f.Type)}
+		}
+		return objectType{fields: fields}
+	case ast.FunctionType:
+		fn := &functionType{paramTypes: []Type{}, result: anyType, annotated: true}
+		for _, param := range t.Types {
+			fn.paramTypes = append(fn.paramTypes, c.typeOf(param))
+		}
+		if t.Elem != nil {
+			fn.result = c.typeOf(t.Elem)
+		}
+		return fn
+	}
+	return anyType
+}
+
+// * ======== DECLARATIONS ======== * \\
+
+// declared returns the type of the variable decl: its annotation, or else
+// the type of its value if it is never assigned another, or else any.
+func (c *checker) declared(decl *resolver.Declaration) Type {
+	if decl == nil {
+		return anyType
+	}
+	if t, ok := c.types[decl]; ok {
+		return t
+	}
+	if c.inferring[decl] {
+		return anyType
+	}
+
+	var t Type = anyType
+	switch n := decl.Node.(type) {
+	case ast.VariableDeclarationNode:
+		switch {
+		case n.Type != nil:
+			t = c.typeOf(n.Type)
+		case c.assigned[decl]:
+		case n.Value == nil:
+			t = nullType
+		default:
+			c.inferring[decl] = true
+			c.quiet++
+			t = c.expr(n.Value, state{})
+			c.quiet--
+			delete(c.inferring, decl)
+		}
+	case ast.FunctionDeclarationNode:
+		if decl.Kind == resolver.Function {
+			t = c.functionType(n)
+			break
+		}
+		if annotation := paramType(n, decl.Pos); annotation != nil {
+			t = c.typeOf(annotation)
+		}
+	}
+	c.types[decl] = t
+	return t
+}
+
+// paramType returns the annotation of the parameter of fn at pos.
+func paramType(fn ast.FunctionDeclarationNode, pos ast.Position) *ast.TypeExpr {
+	for i, paramPos := range fn.ParamPos {
+		if paramPos == pos && i < len(fn.ParamTypes) {
+			return fn.ParamTypes[i]
+		}
+	}
+	return nil
+}
+
+// functionType returns the type of the function fn. What a function without
+// a return type pops is inferred from its body, and is any to the calls
+// the function makes of itself.
+func (c *checker) functionType(n ast.FunctionDeclarationNode) *functionType {
+	if fn, ok := c.functions[n.NamePos]; ok {
+		return fn
+	}
+
+	fn := &functionType{
+		name:       n.Name,
+		params:     n.Params,
+		paramTypes: make([]Type, len(n.Params)),
+		result:     anyType,
+		annotated:  n.ParamTypes != nil || n.ReturnType != nil,
+	}
+	for i := range n.Params {
+		fn.paramTypes[i] = anyType
+		if i < len(n.ParamTypes) && n.ParamTypes[i] != nil {
+			fn.paramTypes[i] = c.typeOf(n.ParamTypes[i])
+		}
+	}
+	c.functions[n.NamePos] = fn
+
+	if n.ReturnType != nil {
+		fn.result = c.typeOf(n.ReturnType)
+	} else {
+		c.quiet++
+		fn.result = c.body(n)
+		c.quiet--
+	}
+	return fn
+}
+
+// body checks the body of the function fn, and returns the type of what
+// it pops.
+func (c *checker) body(n ast.FunctionDeclarationNode) Type {
+	outer := c.fn
+	c.fn = &function{name: n.Name}
+	defer func() { c.fn = outer }()
+	if n.ReturnType != nil {
+		c.fn.result = c.typeOf(n.ReturnType)
+	}
+
+	value, terminates := c.block(n.Body, state{})
+	if !terminates {
+		// A function that ends pops the value of its last statement
+		if result := c.fn.result; result != nil && !assignable(value, result) {
+			if last := n.Body[max(len(n.Body)-1, 0):]; len(last) > 0 && expression(last[0]) {
+				c.report(start(last[0]), "Value popped by %s must be %s, got %s", n.Name, result, value)
+			} else {
+				c.report(n.NamePos, "Function '%s' can end without popping %s", n.Name, result)
+			}
+		}
+		c.fn.popped = append(c.fn.popped, value)
+	}
+	if len(c.fn.popped) == 0 {
+		// It never pops
+		return anyType
+	}
+	return union(c.fn.popped...)
+}
+
+// * ======== STATEMENTS ======== * \\
+
+// block checks stmts, and returns the value of the last and whether they
+// always end in a pop or throw.
+func (c *checker) block(stmts []ast.ASTNode, s state) (Type, bool) {
+	var value Type = nullType
+	for _, stmt := range stmts {
+		var terminates bool
+		if value, terminates = c.stmt(stmt, s); terminates {
+			return anyType, true
+		}
+	}
+	return value, false
+}
+
+func (c *checker) blockNode(node ast.ASTNode, s state) (Type, bool) {
+	if block, ok := node.(ast.BlockStatementNode); ok {
+		return c.block(block.Body, s)
+	}
+	return c.stmt(node, s)
+}
+
+// stmt checks a statement and updates s with what it does to variables. It
+// returns the value of the statement and whether it always ends in a pop
+// or throw.
+func (c *checker) stmt(node ast.ASTNode, s state) (Type, bool) {
+	switch n := node.(type) {
+	case ast.VariableDeclarationNode:
+		return c.declaration(n, s), false
+	case ast.FunctionDeclarationNode:
+		if c.quiet == 0 {
+			c.body(n)
+		}
+		return c.functionType(n), false
+	case ast.TypeAliasNode, ast.ImportDeclarationNode:
+		// Imported values are of any type
+		return nullType, false
+	case ast.ReturnStatementNode:
+		var value Type = nullType
+		at := n.Pos
+		if n.Value != nil {
+			value = c.expr(n.Value, s)
+			at = start(n.Value)
+		}
+		if c.fn != nil {
+			c.fn.popped = append(c.fn.popped, value)
+			if c.fn.result != nil && !assignable(value, c.fn.result) {
+				c.report(at, "Value popped by %s must be %s, got %s", c.fn.name, c.fn.result, value)
+			}
+		}
+		return anyType, true
+	case ast.ThrowStatementNode:
+		c.expr(n.Value, s)
+		return anyType, true
+	case ast.BlockStatementNode:
+		return c.block(n.Body, s)
+	case ast.IfStatementNode:
+		c.expr(n.Condition, s)
+		whenTrue, whenFalse := c.narrow(n.Condition, s)
+		consequent, consequentEnds := c.blockNode(n.Consequent, whenTrue)
+		var alternate Type = nullType
+		alternateEnds := false
+		if n.Alternate != nil {
+			alternate, alternateEnds = c.blockNode(n.Alternate, whenFalse)
+		}
+		return c.join(s, whenTrue, consequent, consequentEnds, whenFalse, alternate, alternateEnds)
+	case ast.WhileStatementNode:
+		c.forget(n, s)
+		c.expr(n.Condition, s)
+		whenTrue, whenFalse := c.narrow(n.Condition, s)
+		c.blockNode(n.Body, whenTrue)
+		replace(s, whenFalse)
+		// Without break, only an error or pop leaves `while true`
+		condition, constant := n.Condition.(ast.BooleanLiteralExprNode)
+		return anyType, constant && condition.Value
+	case ast.ForStatementNode:
+		if n.Init != nil {
+			c.stmt(n.Init, s)
+		}
+		c.forget(n, s)
+		whenTrue, whenFalse := s.clone(), s.clone()
+		if n.Condition != nil {
+			c.expr(n.Condition, s)
+			whenTrue, whenFalse = c.narrow(n.Condition, s)
+		}
+		c.blockNode(n.Body, whenTrue)
+		if n.Update != nil {
+			c.expr(n.Update, whenTrue)
+		}
+		replace(s, whenFalse)
+		return anyType, false
+	case ast.TryStatementNode:
+		body := s.clone()
+		_, bodyEnds := c.blockNode(n.Body, body)
+		// The handler runs after any part of the body
+		handler := s.clone()
+		c.forget(n.Body, handler)
+		_, handlerEnds := c.blockNode(n.Handler, handler)
+		c.join(s, body, anyType, bodyEnds, handler, anyType, handlerEnds)
+		return anyType, bodyEnds && handlerEnds
+	}
+	return c.expr(node, s), false
+}
+
+func (c *checker) declaration(n ast.VariableDeclarationNode, s state) Type {
+	decl := c.decls[n.NamePos]
+	var value Type = nullType
+	at := n.NamePos
+	if n.Value != nil {
+		value = c.expr(n.Value, s)
+		at = start(n.Value)
+	}
+	known := value
+	if n.Type != nil {
+		t := c.typeOf(n.Type)
+		known = narrowed(t, value)
+		if !assignable(value, t) {
+			// What follows is checked against the annotation
+			c.report(at, "Variable '%s' must be %s, got %s", n.Identifier, t, value)
+			known = t
+		}
+	}
+	if decl != nil {
+		s[decl] = known
+	}
+	return value
+}
+
+// join sets s to what is known after a branch that leaves a and one that
+// leaves b, of which those that end in a pop or throw leave nothing. It
+// returns the value of the branches and whether both end so.
+func (c *checker) join(s, a state, aValue Type, aEnds bool, b state, bValue Type, bEnds bool) (Type, bool) {
+	switch {
+	case aEnds && bEnds:
+		return anyType, true
+	case aEnds:
+		replace(s, b)
+		return bValue, false
+	case bEnds:
+		replace(s, a)
+		return aValue, false
+	}
+
+	for decl := range s {
+		delete(s, decl)
+	}
+	for _, branch := range []state{a, b} {
+		for decl := range branch {
+			if _, done := s[decl]; done {
+				continue
+			}
+			s[decl] = union(c.lookup(decl, a), c.lookup(decl, b))
+		}
+	}
+	return union(aValue, bValue), false
+}
+
+// replace makes s the same as with.
+func replace(s, with state) {
+	for decl := range s {
+		delete(s, decl)
+	}
+	for decl, t := range with {
+		s[decl] = t
+	}
+}
+
+// forget drops what s knows of the variables assigned to in node, for the
+// code of a loop that may run after them.
+func (c *checker) forget(node ast.ASTNode, s state) {
+	var visit func(node ast.ASTNode) ast.ASTNode
+	visit = func(node ast.ASTNode) ast.ASTNode {
+		if n, ok := node.(ast.AssignmentExprNode); ok {
+			if target, ok := n.Assignee.(ast.IdentifierExprNode); ok {
+				delete(s, c.refs[target.Pos])
+			}
+		}
+		return ast.MapChildren(node, visit)
+	}
+	visit(node)
+}
+
+// narrow returns what is known of variables where condition is true and
+// where it is false, on top of s.
+func (c *checker) narrow(condition ast.ASTNode, s state) (state, state) {
+	whenTrue, whenFalse := s.clone(), s.clone()
+	c.refine(condition, whenTrue, whenFalse)
+	return whenTrue, whenFalse
+}
+
+func (c *checker) refine(condition ast.ASTNode, whenTrue, whenFalse state) {
+	notNull := func(t Type) bool { return t == nullType }
+	switch n := condition.(type) {
+	case ast.IdentifierExprNode:
+		// Null is falsy
+		if decl := c.refs[n.Pos]; decl != nil {
+			whenTrue[decl] = without(c.lookup(decl, whenTrue), notNull)
+		}
+	case ast.UnaryExprNode:
+		if n.Operator == ast.Not {
+			c.refine(n.Operand, whenFalse, whenTrue)
+		}
+	case ast.LogicalExprNode:
+		if n.Operator == "&&" {
+			c.refine(n.Left, whenTrue, state{})
+			c.refine(n.Right, whenTrue, state{})
+		} else {
+			c.refine(n.Left, state{}, whenFalse)
+			c.refine(n.Right, state{}, whenFalse)
+		}
+	case ast.BinaryExprNode:
+		variable, other := n.Left, n.Right
+		if _, isNull := variable.(ast.NullLiteralExprNode); isNull {
+			variable, other = other, variable
+		}
+		identifier, ok := variable.(ast.IdentifierExprNode)
+		_, isNull := other.(ast.NullLiteralExprNode)
+		decl := c.refs[identifier.Pos]
+		if !ok || !isNull || decl == nil {
+			return
+		}
+		isNullWhen, notNullWhen := whenTrue, whenFalse
+		switch n.Operator {
+		case ast.NotEqual:
+			isNullWhen, notNullWhen = whenFalse, whenTrue
+		case ast.Equal, ast.Is:
+		default:
+			return
+		}
+		if t := c.lookup(decl, isNullWhen); nullable(t) || resolve(t) == anyType {
+			isNullWhen[decl] = nullType
+		}
+		notNullWhen[decl] = without(c.lookup(decl, notNullWhen), notNull)
+	}
+}
+
+// lookup returns the type of the variable decl in s.
+func (c *checker) lookup(decl *resolver.Declaration, s state) Type {
+	if t, ok := s[decl]; ok {
+		return t
+	}
+	return c.declared(decl)
+}
+
+// * ======== EXPRESSIONS ======== * \\
+
+// expr returns the type of the expression node, and updates s with the
+// assignments in it.
+func (c *checker) expr(node ast.ASTNode, s state) Type {
+	switch n := node.(type) {
+	case ast.NumericLiteralExprNode:
+		return numberType
+	case ast.StringLiteralExprNode:
+		return stringType
+	case ast.BooleanLiteralExprNode:
+		return booleanType
+	case ast.NullLiteralExprNode:
+		return nullType
+	case ast.IdentifierExprNode:
+		if decl := c.refs[n.Pos]; decl != nil {
+			return c.lookup(decl, s)
+		}
+		return anyType
+	case ast.ArrayLiteralExprNode:
+		if len(n.Elements) == 0 {
+			return arrayType{elem: anyType}
+		}
+		elems := make([]Type, len(n.Elements))
+		for i, elem := range n.Elements {
+			elems[i] = c.expr(elem, s)
+		}
+		return arrayType{elem: union(elems...)}
+	case ast.ObjectLiteralExprNode:
+		fields := make([]field, len(n.Properties))
+		for i, prop := range n.Properties {
+			fields[i] = field{key: prop.Key}
+			if prop.Value == nil {
+				fields[i].t = c.lookup(c.refs[prop.Pos], s)
+			} else {
+				fields[i].t = c.expr(prop.Value, s)
+			}
+		}
+		return objectType{fields: fields}
+	case ast.UnaryExprNode:
+		operand := c.expr(n.Operand, s)
+		if n.Operator == ast.Negation {
+			if !assignable(operand, numberType) {
+				c.report(start(n.Operand), "Cannot negate %s", operand)
+			}
+			return numberType
+		}
+		return booleanType
+	case ast.BinaryExprNode:
+		return c.binary(n, s)
+	case ast.LogicalExprNode:
+		left := c.expr(n.Left, s)
+		whenTrue, whenFalse := c.narrow(n.Left, s)
+		branch := whenTrue
+		if n.Operator == "||" {
+			// What is left is not null when it is returned
+			branch = whenFalse
+			left = without(left, func(t Type) bool { return t == nullType })
+		}
+		right := c.expr(n.Right, branch)
+		c.forget(n.Right, s)
+		return union(left, right)
+	case ast.AssignmentExprNode:
+		return c.assignment(n, s)
+	case ast.CallExprNode:
+		return c.call(n, s)
+	case ast.MemberExprNode:
+		object := c.expr(n.Object, s)
+		if n.Computed {
+			return c.index(object, n.Object, n.Property, s)
+		}
+		return c.property(object, n, n.Property.(ast.IdentifierExprNode).Symbol)
+	case ast.IndexExprNode:
+		return c.index(c.expr(n.Object, s), n.Object, n.Index, s)
+	}
+
+	ast.MapChildren(node, func(child ast.ASTNode) ast.ASTNode {
+		c.expr(child, s)
+		return child
+	})
+	return anyType
+}
+
+func (c *checker) binary(n ast.BinaryExprNode, s state) Type {
+	left, right := c.expr(n.Left, s), c.expr(n.Right, s)
+	switch n.Operator {
+	case ast.Add, ast.Subtract, ast.Multiply, ast.Divide, ast.Modulo:
+		c.numbers("Operator "+string(n.Operator), n.Left, left, n.Right, right)
+		return numberType
+	case ast.Equal, ast.NotEqual, ast.Is:
+		return booleanType
+	}
+	c.numbers("Comparison "+string(n.Operator), n.Left, left, n.Right, right)
+	return booleanType
+}
+
+// numbers reports the operands of an operator that are not numbers.
+func (c *checker) numbers(operator string, left ast.ASTNode, leftType Type, right ast.ASTNode, rightType Type) {
+	if !assignable(leftType, numberType) {
+		c.report(start(left), "%s needs numbers, got %s", operator, leftType)
+	}
+	if !assignable(rightType, numberType) {
+		c.report(start(right), "%s needs numbers, got %s", operator, rightType)
+	}
+}
+
+func (c *checker) assignment(n ast.AssignmentExprNode, s state) Type {
+	value := c.expr(n.Value, s)
+
+	switch target := n.Assignee.(type) {
+	case ast.IdentifierExprNode:
+		decl := c.refs[target.Pos]
+		if decl == nil {
+			return value
+		}
+		if t, what := c.annotation(decl); t != nil {
+			s[decl] = narrowed(t, value)
+			if !assignable(value, t) {
+				c.report(start(n.Value), "%s must be %s, got %s", what, t, value)
+				s[decl] = t
+			}
+			return value
+		}
+		s[decl] = value
+	case ast.MemberExprNode:
+		object := c.expr(target.Object, s)
+		if target.Computed {
+			index := c.expr(target.Property, s)
+			if arr, ok := resolve(object).(arrayType); ok {
+				if !assignable(index, numberType) {
+					c.report(start(target.Property), "Array index must be number, got %s", index)
+				}
+				if !assignable(value, arr.elem) {
+					c.report(start(n.Value), "Element of %s must be %s, got %s", object, arr.elem, value)
+				}
+			}
+			return value
+		}
+		key := target.Property.(ast.IdentifierExprNode).Symbol
+		for _, member := range members(object) {
+			switch member := member.(type) {
+			case objectType:
+				if f, ok := member.field(key); ok && !assignable(value, f.t) && !(f.optional && value == nullType) {
+					c.report(start(n.Value), "Property '%s' must be %s, got %s", key, f.t, value)
+				}
+			case basic:
+				if member != anyType {
+					c.report(start(target.Object), "Cannot set property '%s' of %s", key, object)
+				}
+			default:
+				c.report(start(target.Object), "Cannot set property '%s' of %s", key, object)
+			}
+		}
+	default:
+		c.expr(n.Assignee, s)
+	}
+	return value
+}
+
+// annotation returns the annotated type of the variable decl and what to
+// call it in messages, or nil if it has none.
+func (c *checker) annotation(decl *resolver.Declaration) (Type, string) {
+	switch n := decl.Node.(type) {
+	case ast.VariableDeclarationNode:
+		if n.Type != nil {
+			return c.declared(decl), fmt.Sprintf("Variable '%s'", n.Identifier)
+		}
+	case ast.FunctionDeclarationNode:
+		if decl.Kind == resolver.Parameter && paramType(n, decl.Pos) != nil {
+			return c.declared(decl), fmt.Sprintf("Parameter '%s'", decl.Name)
+		}
+	}
+	return nil, ""
+}
+
+func (c *checker) call(n ast.CallExprNode, s state) Type {
+	callee := c.expr(n.Caller, s)
+	args := make([]Type, len(n.Args))
+	for i, arg := range n.Args {
+		args[i] = c.expr(arg, s)
+	}
+
+	fn, ok := resolve(callee).(*functionType)
+	if !ok {
+		for _, member := range members(callee) {
+			if _, isFunction := member.(*functionType); !isFunction && member != anyType {
+				c.report(start(n.Caller), "Cannot call %s", callee)
+				break
+			}
+		}
+		return anyType
+	}
+	if !fn.annotated || fn.paramTypes == nil {
+		return fn.result
+	}
+
+	name := fn.name
+	if name == "" {
+		name = "function"
+	}
+	if len(n.Args) > len(fn.paramTypes) {
+		c.report(start(n.Args[len(fn.paramTypes)]), "%s takes %d arguments, got %d", name, len(fn.paramTypes), len(n.Args))
+	}
+	for i, param := range fn.paramTypes {
+		if i >= len(args) {
+			// Missing arguments are null
+			if !assignable(nullType, param) {
+				c.report(n.Pos, "%s takes %d arguments, got %d", name, len(fn.paramTypes), len(n.Args))
+				break
+			}
+			continue
+		}
+		if !assignable(args[i], param) {
+			what := fmt.Sprintf("Argument %d", i+1)
+			if i < len(fn.params) {
+				what = fmt.Sprintf("Argument '%s' of %s", fn.params[i], name)
+			}
+			c.report(start(n.Args[i]), "%s must be %s, got %s", what, param, args[i])
+		}
+	}
+	return fn.result
+}
+
+// property returns the type of the property key of a value of type object.
+func (c *checker) property(object Type, n ast.MemberExprNode, key string) Type {
+	var types []Type
+	for _, member := range members(object) {
+		switch member := member.(type) {
+		case objectType:
+			f, ok := member.field(key)
+			if !ok {
+				// Objects may have more properties than their type tells
+				return anyType
+			}
+			types = append(types, f.t)
+			if f.optional {
+				types = append(types, nullType)
+			}
+			continue
+		case basic:
+			if member == anyType {
+				return anyType
+			}
+		}
+		c.report(start(n.Object), "Cannot read property '%s' of %s", key, object)
+		return anyType
+	}
+	return union(types...)
+}
+
+// index returns the type of an element of a value of type object.
+func (c *checker) index(object Type, objectNode, indexNode ast.ASTNode, s state) Type {
+	index := c.expr(indexNode, s)
+	var types []Type
+	for _, member := range members(object) {
+		switch member := member.(type) {
+		case arrayType:
+			if !assignable(index, numberType) {
+				c.report(start(indexNode), "Array index must be number, got %s", index)
+			}
+			types = append(types, member.elem)
+			continue
+		case objectType:
+			return anyType
+		case basic:
+			if member == anyType {
+				return anyType
+			}
+		}
+		c.report(start(objectNode), "Cannot index %s", object)
+		return anyType
+	}
+	return union(types...)
+}
+
+// * ======== HELPERS ======== * \\
+
+// start returns the position of the first token of node. Nodes are located
+// at their operator, parenthesis or dot if they have one.
+func start(node ast.ASTNode) ast.Position {
+	switch n := node.(type) {
+	case ast.BinaryExprNode:
+		return start(n.Left)
+	case ast.LogicalExprNode:
+		return start(n.Left)
+	case ast.AssignmentExprNode:
+		return start(n.Assignee)
+	case ast.CallExprNode:
+		return start(n.Caller)
+	case ast.MemberExprNode:
+		return start(n.Object)
+	case ast.IndexExprNode:
+		return start(n.Object)
+	}
+	return ast.PositionOf(node)
+}
+
+// expression reports whether stmt is an expression, whose value a
+// function pops if stmt is its last statement.
+func expression(stmt ast.ASTNode) bool {
+	switch stmt.(type) {
+	case ast.VariableDeclarationNode, ast.FunctionDeclarationNode, ast.IfStatementNode,
+		ast.WhileStatementNode, ast.ForStatementNode, ast.ReturnStatementNode,
+		ast.BlockStatementNode, ast.TryStatementNode, ast.ThrowStatementNode, ast.TypeAliasNode,
+		ast.ImportDeclarationNode:
+		return false
+	}
+	return true
+}
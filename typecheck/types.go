@@ -0,0 +1,329 @@
+package typecheck
+
+import "strings"
+
+// Type is what the checker knows of the values an expression can have.
+type Type interface {
+	String() string
+}
+
+// basic is one of the built-in types that are written as a name.
+type basic string
+
+const (
+	anyType     basic = "any"
+	numberType  basic = "number"
+	stringType  basic = "string"
+	booleanType basic = "boolean"
+	nullType    basic = "null"
+)
+
+func (b basic) String() string {
+	return string(b)
+}
+
+type arrayType struct {
+	elem Type
+}
+
+func (a arrayType) String() string {
+	return inner(a.elem) + "[]"
+}
+
+// objectType is an object with at least the fields listed. Objects may
+// always have more properties than their type tells.
+type objectType struct {
+	fields []field
+}
+
+type field struct {
+	key string
+	// optional fields may be missing or null
+	optional bool
+	t        Type
+}
+
+func (o objectType) field(key string) (field, bool) {
+	for _, f := range o.fields {
+		if f.key == key {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+func (o objectType) String() string {
+	if len(o.fields) == 0 {
+		return "{}"
+	}
+	parts := make([]string, len(o.fields))
+	for i, f := range o.fields {
+		optional := ""
+		if f.optional {
+			optional = "?"
+		}
+		parts[i] = f.key + optional + ": " + f.t.String()
+	}
+	return "{ " + strings.Join(parts, ", ") + " }"
+}
+
+// functionType is a function. Calls of one without annotations are not
+// checked, and those of natives take any arguments.
+type functionType struct {
+	// name and params are those of a declared function, for messages, and
+	// are empty for function types written in annotations
+	name   string
+	params []string
+	// paramTypes are nil for natives
+	paramTypes []Type
+	result     Type
+	// annotated functions have their calls checked
+	annotated bool
+}
+
+func (f *functionType) String() string {
+	if f.paramTypes == nil {
+		return "fn(...): " + inner(f.result)
+	}
+	parts := make([]string, len(f.paramTypes))
+	for i, t := range f.paramTypes {
+		parts[i] = t.String()
+	}
+	return "fn(" + strings.Join(parts, ", ") + "): " + inner(f.result)
+}
+
+// unionType is a value of any of its members, of which there are at least
+// two and none is a union or any. Build them with union.
+type unionType struct {
+	types []Type
+}
+
+func (u unionType) String() string {
+	// A single type or null is written T?
+	if len(u.types) == 2 && u.types[1] == nullType {
+		return inner(u.types[0]) + "?"
+	}
+	parts := make([]string, len(u.types))
+	for i, t := range u.types {
+		parts[i] = inner(t)
+	}
+	return strings.Join(parts, " | ")
+}
+
+// alias is a type alias. Aliases may refer to themselves through arrays,
+// objects and functions, so the type is filled in after the alias is made.
+type alias struct {
+	name string
+	t    Type
+}
+
+func (a *alias) String() string {
+	return a.name
+}
+
+// inner writes t as the element of an array or nullable type.
+func inner(t Type) string {
+	switch t.(type) {
+	case unionType, *functionType:
+		return "(" + t.String() + ")"
+	}
+	return t.String()
+}
+
+// resolve returns the type an alias stands for.
+func resolve(t Type) Type {
+	for {
+		a, ok := t.(*alias)
+		if !ok || a.t == nil {
+			return t
+		}
+		t = a.t
+	}
+}
+
+// union returns the type of a value of any of types, with nested unions
+// flattened, members that are the same written once and null last.
+func union(types ...Type) Type {
+	var members []Type
+	seen := map[string]bool{}
+	hasNull := false
+	var add func(t Type)
+	add = func(t Type) {
+		switch t := t.(type) {
+		case nil:
+		case unionType:
+			for _, member := range t.types {
+				add(member)
+			}
+		default:
+			if t == nullType {
+				hasNull = true
+				return
+			}
+			if key := t.String(); !seen[key] {
+				seen[key] = true
+				members = append(members, t)
+			}
+		}
+	}
+	for _, t := range types {
+		if resolve(t) == anyType {
+			return anyType
+		}
+		add(t)
+	}
+	if hasNull {
+		members = append(members, nullType)
+	}
+
+	switch len(members) {
+	case 0:
+		return nullType
+	case 1:
+		return members[0]
+	}
+	return unionType{types: members}
+}
+
+// members returns the types a value of type t may be of.
+func members(t Type) []Type {
+	if u, ok := resolve(t).(unionType); ok {
+		list := make([]Type, len(u.types))
+		for i, member := range u.types {
+			list[i] = resolve(member)
+		}
+		return list
+	}
+	return []Type{resolve(t)}
+}
+
+// without returns t without the members for which drop is true. Where
+// that leaves nothing the code cannot run, and anything goes.
+func without(t Type, drop func(Type) bool) Type {
+	if resolve(t) == anyType {
+		return t
+	}
+	var kept []Type
+	for _, member := range members(t) {
+		if !drop(member) {
+			kept = append(kept, member)
+		}
+	}
+	if len(kept) == 0 {
+		return anyType
+	}
+	return union(kept...)
+}
+
+// narrowed returns what is known of a variable of type t once it is
+// assigned a value of type value: the members of t the value may be of.
+func narrowed(t, value Type) Type {
+	if resolve(value) == anyType {
+		return t
+	}
+	return without(t, func(member Type) bool {
+		for _, v := range members(value) {
+			if assignable(v, member) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// nullable reports whether a value of type t may be null, and not only
+// because t is any.
+func nullable(t Type) bool {
+	for _, member := range members(t) {
+		if member == nullType {
+			return true
+		}
+	}
+	return false
+}
+
+// assignable reports whether every value of type from is also of type to.
+func assignable(from, to Type) bool {
+	return (&relation{seen: map[[2]string]bool{}}).assignable(from, to)
+}
+
+// relation compares types that may refer to themselves, by taking the
+// pairs of types it is comparing already to be assignable. Aliases are
+// told apart by name.
+type relation struct {
+	seen map[[2]string]bool
+}
+
+func (r *relation) assignable(from, to Type) bool {
+	_, fromAlias := from.(*alias)
+	_, toAlias := to.(*alias)
+	if fromAlias || toAlias {
+		pair := [2]string{from.String(), to.String()}
+		if r.seen[pair] {
+			return true
+		}
+		r.seen[pair] = true
+	}
+	from, to = resolve(from), resolve(to)
+	if from == anyType || to == anyType {
+		return true
+	}
+
+	if u, ok := from.(unionType); ok {
+		for _, member := range u.types {
+			if !r.assignable(member, to) {
+				return false
+			}
+		}
+		return true
+	}
+	if u, ok := to.(unionType); ok {
+		for _, member := range u.types {
+			if r.assignable(from, member) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch to := to.(type) {
+	case basic:
+		return from == to
+	case arrayType:
+		a, ok := from.(arrayType)
+		return ok && r.assignable(a.elem, to.elem)
+	case objectType:
+		o, ok := from.(objectType)
+		if !ok {
+			return false
+		}
+		for _, want := range to.fields {
+			have, exists := o.field(want.key)
+			if !exists {
+				if !want.optional {
+					return false
+				}
+				continue
+			}
+			if !r.assignable(have.t, want.t) && !(want.optional && have.t == nullType) {
+				return false
+			}
+		}
+		return true
+	case *functionType:
+		f, ok := from.(*functionType)
+		if !ok {
+			return false
+		}
+		// Functions without annotations, and natives, take anything
+		if to.paramTypes != nil && f.paramTypes != nil {
+			for i, param := range f.paramTypes {
+				if i < len(to.paramTypes) && !r.assignable(to.paramTypes[i], param) {
+					return false
+				}
+			}
+		}
+		return r.assignable(f.result, to.result)
+	}
+	return false
+}
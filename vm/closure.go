@@ -0,0 +1,99 @@
+package vm
+
+import (
+	BE "pop/backend"
+	"pop/compiler"
+)
+
+// Closure is a compiled function with the variables it captured. Popcorn
+// code sees it as a *backend.FunctionVal whose Compiled field it is.
+type Closure struct {
+	vm       *VM
+	Proto    *compiler.Proto
+	upvalues []*Upvalue
+}
+
+// function wraps the closure into the value Popcorn code gets.
+func (cl *Closure) function() *BE.FunctionVal {
+	return &BE.FunctionVal{
+		Name:     cl.Proto.Name,
+		Params:   cl.Proto.Params,
+		File:     cl.Proto.File,
+		Pos:      cl.Proto.Pos,
+		Compiled: cl,
+	}
+}
+
+// Call runs the closure for a native or the host, through
+// backend.Interpreter.Invoke, on the VM that created it.
+func (cl *Closure) Call(args []BE.RuntimeVal) BE.RuntimeVal {
+	vm := cl.vm
+	vm.push(BE.Null)
+	base := len(vm.stack)
+	for i := range cl.Proto.Params {
+		if i < len(args) {
+			vm.push(args[i])
+		} else {
+			vm.push(BE.Null)
+		}
+	}
+	vm.pushFrame(cl, base, vm.it.FrameCount()-1, false)
+	return vm.execute(len(vm.frames) - 1)
+}
+
+// Upvalue is a variable captured by closures. It refers to the variable's
+// stack slot while the scope declaring it runs, and holds the value itself
+// once the scope has ended.
+type Upvalue struct {
+	vm     *VM
+	slot   int
+	open   bool
+	closed BE.RuntimeVal
+}
+
+func (up *Upvalue) get() BE.RuntimeVal {
+	if up.open {
+		return up.vm.stack[up.slot]
+	}
+	return up.closed
+}
+
+func (up *Upvalue) set(val BE.RuntimeVal) {
+	if up.open {
+		up.vm.stack[up.slot] = val
+	} else {
+		up.closed = val
+	}
+}
+
+// captureUpvalue returns the open upvalue for slot, creating it unless a
+// closure already captured the slot, so that closures share variables.
+func (vm *VM) captureUpvalue(slot int) *Upvalue {
+	i := len(vm.openUpvalues)
+	for i > 0 && vm.openUpvalues[i-1].slot >= slot {
+		if vm.openUpvalues[i-1].slot == slot {
+			return vm.openUpvalues[i-1]
+		}
+		i--
+	}
+
+	up := &Upvalue{vm: vm, slot: slot, open: true}
+	vm.openUpvalues = append(vm.openUpvalues, nil)
+	copy(vm.openUpvalues[i+1:], vm.openUpvalues[i:])
+	vm.openUpvalues[i] = up
+	return up
+}
+
+// closeUpvalues moves the variables of the slots from slot up into the
+// upvalues that captured them.
+func (vm *VM) closeUpvalues(slot int) {
+	for len(vm.openUpvalues) > 0 {
+		up := vm.openUpvalues[len(vm.openUpvalues)-1]
+		if up.slot < slot {
+			return
+		}
+		up.closed = vm.stack[up.slot]
+		up.open = false
+		vm.openUpvalues = vm.openUpvalues[:len(vm.openUpvalues)-1]
+	}
+}
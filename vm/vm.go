@@ -0,0 +1,676 @@
+// Package vm runs the bytecode of package compiler. It is an alternative to
+// the tree walker in package backend: programs run in the same
+// Interpreter, with its globals, natives, options, limits and tracebacks,
+// and fail with the same errors.
+package vm
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	BE "pop/backend"
+	"pop/compiler"
+	FE "pop/frontend"
+	"pop/frontend/types/ast"
+	"pop/resolver"
+	"sort"
+)
+
+// Engine runs programs on the VM. Set it as backend.Options.Engine:
+//
+//	opts := backend.DefaultOptions()
+//	opts.Engine = vm.Engine{}
+//	it := backend.NewInterpreter(opts)
+type Engine struct {
+	// Cache, if set, keeps the programs compiled from RunString and
+	// RunFile, so unchanged sources are not parsed and compiled again
+	Cache *compiler.Cache
+}
+
+// MaxCallDepth is the highest call depth the VM allows. Its frames live on
+// the heap rather than the Go stack, at roughly 500 bytes each with their
+// traceback frames, so this bounds the memory deep recursion takes.
+const MaxCallDepth = 1_000_000
+
+// MaxCallDepth clamps Limits.MaxCallDepth, see backend.CallDepthCeiling.
+func (Engine) MaxCallDepth() int {
+	return MaxCallDepth
+}
+
+// Run compiles program and runs it on a new VM for it.
+func (Engine) Run(it *BE.Interpreter, file string, program ast.Program) (BE.RuntimeVal, error) {
+	proto, err := compiler.Compile(program, compiler.Options{File: file})
+	if err != nil {
+		return nil, err
+	}
+	return New(it).Run(proto), nil
+}
+
+// RunSource compiles source, or takes it from the cache, and runs it on a
+// new VM for it.
+func (e Engine) RunSource(it *BE.Interpreter, file, source string) (BE.RuntimeVal, error) {
+	if e.Cache == nil {
+		program, err := FE.Parse(source)
+		if err != nil {
+			return nil, err
+		}
+		if program, err = it.Optimize(program); err != nil {
+			return nil, err
+		}
+		if program, err = it.Resolve(program); err != nil {
+			return nil, err
+		}
+		return e.Run(it, file, program)
+	}
+
+	// Compiled code only shows the globals left after optimizing, so the
+	// source is resolved as it was written first
+	if it.Optimizer() != nil {
+		parsed, err := FE.Parse(source)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := it.Resolve(parsed); err != nil {
+			return nil, err
+		}
+	}
+	program, err := e.Cache.Compile(file, source, it.Optimizer())
+	if err != nil {
+		return nil, err
+	}
+	if err := checkGlobals(it, program.Proto); err != nil {
+		return nil, err
+	}
+	return New(it).Run(program.Proto), nil
+}
+
+// RunProgram runs a compiled program, such as one read from a .popc file,
+// as a top-level run of the file it was compiled from.
+func RunProgram(ctx context.Context, it *BE.Interpreter, program *compiler.Program) (BE.RuntimeVal, error) {
+	file := program.Proto.File
+	it.SetSource(file, program.Source)
+	if err := checkGlobals(it, program.Proto); err != nil {
+		return nil, err
+	}
+	return it.Execute(ctx, file, func() (BE.RuntimeVal, error) {
+		return New(it).Run(program.Proto), nil
+	})
+}
+
+// checkGlobals reports the globals compiled code uses that the
+// interpreter has not declared before the code does, as the resolver would
+// have from the source.
+func checkGlobals(it *BE.Interpreter, proto *compiler.Proto) error {
+	var problems []resolver.Problem
+	reported := map[string]bool{}
+	for _, use := range compiler.GlobalUses(proto) {
+		if _, ok := it.Globals.LookupVar(use.Name); ok {
+			continue
+		}
+		if use.Declaration.IsValid() {
+			problems = append(problems, resolver.Problem{Kind: resolver.UsedBeforeDeclaration, Name: use.Name, Pos: use.Pos, Declaration: use.Declaration})
+		} else if !reported[use.Name] {
+			reported[use.Name] = true
+			problems = append(problems, resolver.Problem{Kind: resolver.Undeclared, Name: use.Name, Pos: use.Pos})
+		}
+	}
+	if len(problems) > 0 {
+		sort.SliceStable(problems, func(i, j int) bool {
+			a, b := problems[i].Pos, problems[j].Pos
+			return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+		})
+		return &resolver.Error{Problems: problems}
+	}
+	return nil
+}
+
+// VM runs compiled code for an Interpreter. Closures keep the VM that
+// created them, which runs them whenever they are called.
+type VM struct {
+	it *BE.Interpreter
+	// globals are the top-level environment of the module the VM runs,
+	// which its closures keep using once the module has run
+	globals *BE.Environment
+
+	// stack holds the callee, arguments and local slots of every frame,
+	// followed by its temporaries
+	stack    []BE.RuntimeVal
+	frames   []frame
+	handlers []handler
+	// openUpvalues are the upvalues still pointing at a stack slot,
+	// ordered by slot
+	openUpvalues []*Upvalue
+}
+
+// frame is a call being run.
+type frame struct {
+	closure *Closure
+	// pc is the offset just after the opcode of the current instruction,
+	// or of the call a caller is waiting on
+	pc int
+	// base is the stack index of the first local slot
+	base int
+	// trace is the index of the interpreter frame that tracebacks show
+	// for this call, -1 if there is none
+	trace int
+	// owned frames pushed their interpreter frame and counted the call
+	// depth themselves; the others were called through Invoke, which
+	// does both
+	owned bool
+}
+
+// handler is an installed `try`.
+type handler struct {
+	frame int
+	pc    int
+	sp    int
+}
+
+// undefined fills the slots of variables that are not declared yet, or
+// that belong to a scope which is not running.
+type undefined struct{}
+
+// New creates a VM for it.
+func New(it *BE.Interpreter) *VM {
+	return &VM{it: it, globals: it.Globals}
+}
+
+// Run runs top-level code. It must be called while the interpreter is
+// running, by an Engine; runtime errors panic with a *RuntimeError.
+func (vm *VM) Run(proto *compiler.Proto) BE.RuntimeVal {
+	cl := &Closure{vm: vm, Proto: proto}
+	vm.stack = append(vm.stack, BE.Null)
+	vm.pushFrame(cl, len(vm.stack), vm.it.FrameCount()-1, false)
+	return vm.execute(len(vm.frames) - 1)
+}
+
+// pushFrame starts running cl, whose arguments are on top of the stack
+// from base, by filling the remaining local slots.
+func (vm *VM) pushFrame(cl *Closure, base, trace int, owned bool) {
+	for len(vm.stack) < base+len(cl.Proto.Locals) {
+		vm.stack = append(vm.stack, undefined{})
+	}
+	vm.frames = append(vm.frames, frame{closure: cl, base: base, trace: trace, owned: owned})
+}
+
+// execute runs until the frame at index stop returns, and returns its
+// value. Errors that no handler of these frames catches unwind them and
+// panic on to the caller.
+func (vm *VM) execute(stop int) BE.RuntimeVal {
+	for {
+		result, err := vm.protectedRun(stop)
+		if err == nil {
+			return result
+		}
+		if !vm.handle(err, stop) {
+			panic(err)
+		}
+	}
+}
+
+// protectedRun runs until the frame at index stop returns, or until a
+// runtime error is raised, which it returns with its traceback.
+func (vm *VM) protectedRun(stop int) (result BE.RuntimeVal, err *BE.RuntimeError) {
+	defer func() {
+		if r := recover(); r != nil {
+			runtimeErr, ok := r.(*BE.RuntimeError)
+			if !ok {
+				panic(r)
+			}
+			vm.trace()
+			vm.it.TraceError(runtimeErr)
+			err = runtimeErr
+		}
+	}()
+	return vm.run(stop), nil
+}
+
+// trace records where the VM's frames are, and what they were called
+// with, in the frames tracebacks are made of.
+func (vm *VM) trace() {
+	for i := range vm.frames {
+		f := &vm.frames[i]
+		if f.trace < 0 {
+			continue
+		}
+		tf := vm.it.FrameAt(f.trace)
+		if pos := f.closure.Proto.PositionAt(f.pc - 1); pos.IsValid() {
+			tf.Line, tf.Column = pos.Line, pos.Column
+		}
+		vm.arguments(f)
+	}
+}
+
+// arguments records what f was called with in its interpreter frame, if
+// it has not yet. They are read back from the parameter slots, so a
+// parameter the function reassigned before shows its new value.
+func (vm *VM) arguments(f *frame) {
+	if !f.owned {
+		return
+	}
+	if tf := vm.it.FrameAt(f.trace); tf.Args == nil {
+		params := len(f.closure.Proto.Params)
+		tf.Args = append([]BE.RuntimeVal(nil), vm.stack[f.base:f.base+params]...)
+	}
+}
+
+// handle passes err to the innermost handler installed by the frames from
+// stop up. It reports false, having unwound those frames, if there is
+// none or err is fatal.
+func (vm *VM) handle(err *BE.RuntimeError, stop int) bool {
+	if !err.Fatal && len(vm.handlers) > 0 {
+		h := vm.handlers[len(vm.handlers)-1]
+		if h.frame >= stop {
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+			vm.unwind(h.frame + 1)
+			vm.closeUpvalues(h.sp)
+			vm.stack = vm.stack[:h.sp]
+			vm.stack = append(vm.stack, err.CaughtValue())
+			vm.frames[h.frame].pc = h.pc
+			return true
+		}
+	}
+
+	vm.unwind(stop)
+	return false
+}
+
+// unwind drops the frames from index to, and everything they left on the
+// stack.
+func (vm *VM) unwind(to int) {
+	if to >= len(vm.frames) {
+		return
+	}
+	for i := len(vm.frames) - 1; i >= to; i-- {
+		if vm.frames[i].owned {
+			vm.it.PopFrame()
+			vm.it.ExitCall()
+		}
+	}
+	base := vm.frames[to].base
+	vm.closeUpvalues(base)
+	// The callee sits just below the first local slot
+	vm.stack = vm.stack[:base-1]
+	vm.frames = vm.frames[:to]
+	for len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].frame >= to {
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	}
+}
+
+// run is the interpreter loop.
+func (vm *VM) run(stop int) BE.RuntimeVal {
+	it := vm.it
+
+	f, proto, base, pc := vm.current()
+	code, constants := proto.Code, proto.Constants
+
+	for {
+		it.Step()
+		op := compiler.Opcode(code[pc])
+		pc++
+		f.pc = pc
+
+		switch op {
+		case compiler.OpConstant:
+			k := operand(code, pc)
+			pc += 2
+			val := constants[k]
+			if str, ok := val.(BE.StringVal); ok {
+				it.AllocString(len(str.Value))
+			}
+			vm.push(val)
+		case compiler.OpNull:
+			vm.push(BE.Null)
+		case compiler.OpTrue:
+			vm.push(BE.BoolValue{Value: true})
+		case compiler.OpFalse:
+			vm.push(BE.BoolValue{Value: false})
+		case compiler.OpPop:
+			vm.pop()
+
+		case compiler.OpDefineGlobal, compiler.OpDefineConstGlobal:
+			k := operand(code, pc)
+			pc += 2
+			name := constants[k].(BE.StringVal).Value
+			vm.globals.DeclareVar(name, op == compiler.OpDefineConstGlobal, vm.top())
+		case compiler.OpGetGlobal:
+			k := operand(code, pc)
+			pc += 2
+			vm.push(vm.globals.GetVar(constants[k].(BE.StringVal).Value))
+		case compiler.OpSetGlobal:
+			k := operand(code, pc)
+			pc += 2
+			vm.globals.AssignVar(constants[k].(BE.StringVal).Value, vm.top())
+
+		case compiler.OpImport:
+			k := operand(code, pc)
+			pc += 2
+			f.pc = pc
+			vm.locate(f)
+			vm.push(it.Import(constants[k].(BE.StringVal).Value))
+		case compiler.OpImportName:
+			k, n := operand(code, pc), operand(code, pc+2)
+			pc += 4
+			exports := vm.top().(*BE.ObjectVal)
+			vm.push(it.ImportName(exports, constants[k].(BE.StringVal).Value, constants[n].(BE.StringVal).Value))
+		case compiler.OpDefineImport:
+			k := operand(code, pc)
+			pc += 2
+			vm.globals.DeclareImport(constants[k].(BE.StringVal).Value, vm.pop())
+
+		case compiler.OpDefineLocal, compiler.OpDefineConstLocal:
+			slot := operand(code, pc)
+			pc += 2
+			name := proto.Locals[slot].Name
+			if _, ok := vm.stack[base+slot].(undefined); !ok {
+				runtimeError("Cannot declare variable '%s' as its already present in the current scope.", name)
+			}
+			val := vm.top()
+			if op == compiler.OpDefineConstLocal && val == BE.Null {
+				runtimeError("Cannot declare a constant variable '%s' without a value.", name)
+			}
+			vm.stack[base+slot] = val
+		case compiler.OpGetLocal:
+			slot := operand(code, pc)
+			pc += 2
+			val := vm.stack[base+slot]
+			if _, ok := val.(undefined); ok {
+				runtimeError("Cannot resolve variable '%s' !", proto.Locals[slot].Name)
+			}
+			vm.push(val)
+		case compiler.OpSetLocal:
+			slot := operand(code, pc)
+			pc += 2
+			local := proto.Locals[slot]
+			if _, ok := vm.stack[base+slot].(undefined); ok {
+				runtimeError("Cannot resolve variable '%s' !", local.Name)
+			}
+			if local.Const {
+				runtimeError("Cannot reassign constant variable '%s'", local.Name)
+			}
+			vm.stack[base+slot] = vm.top()
+		case compiler.OpGetUpvalue:
+			index := operand(code, pc)
+			pc += 2
+			val := f.closure.upvalues[index].get()
+			if _, ok := val.(undefined); ok {
+				runtimeError("Cannot resolve variable '%s' !", proto.Upvalues[index].Name)
+			}
+			vm.push(val)
+		case compiler.OpSetUpvalue:
+			index := operand(code, pc)
+			pc += 2
+			up := f.closure.upvalues[index]
+			if _, ok := up.get().(undefined); ok {
+				runtimeError("Cannot resolve variable '%s' !", proto.Upvalues[index].Name)
+			}
+			if proto.Upvalues[index].Const {
+				runtimeError("Cannot reassign constant variable '%s'", proto.Upvalues[index].Name)
+			}
+			up.set(vm.top())
+		case compiler.OpCloseScope:
+			k := operand(code, pc)
+			pc += 2
+			first := base + k
+			count := operand(code, pc)
+			pc += 2
+			vm.closeUpvalues(first)
+			for i := first; i < first+count; i++ {
+				vm.stack[i] = undefined{}
+			}
+
+		case compiler.OpAdd, compiler.OpSubtract, compiler.OpMultiply, compiler.OpDivide,
+			compiler.OpLess, compiler.OpGreater, compiler.OpLessEqual, compiler.OpGreaterEqual:
+			right := vm.pop()
+			left := vm.top()
+			l, lok := left.(BE.NumberVal)
+			r, rok := right.(BE.NumberVal)
+			if !lok || !rok {
+				vm.stack[len(vm.stack)-1] = BE.BinaryOp(binaryOperators[op], left, right)
+				continue
+			}
+			var result BE.RuntimeVal
+			switch op {
+			case compiler.OpAdd:
+				result = BE.NumberVal{Value: l.Value + r.Value}
+			case compiler.OpSubtract:
+				result = BE.NumberVal{Value: l.Value - r.Value}
+			case compiler.OpMultiply:
+				result = BE.NumberVal{Value: l.Value * r.Value}
+			case compiler.OpDivide:
+				result = BE.NumberVal{Value: l.Value / r.Value}
+			case compiler.OpLess:
+				result = BE.BoolValue{Value: l.Value < r.Value}
+			case compiler.OpGreater:
+				result = BE.BoolValue{Value: l.Value > r.Value}
+			case compiler.OpLessEqual:
+				result = BE.BoolValue{Value: l.Value <= r.Value}
+			case compiler.OpGreaterEqual:
+				result = BE.BoolValue{Value: l.Value >= r.Value}
+			}
+			vm.stack[len(vm.stack)-1] = result
+		case compiler.OpModulo, compiler.OpEqual, compiler.OpNotEqual, compiler.OpIs:
+			right := vm.pop()
+			vm.stack[len(vm.stack)-1] = BE.BinaryOp(binaryOperators[op], vm.top(), right)
+		case compiler.OpNegate:
+			vm.stack[len(vm.stack)-1] = it.UnaryOp(ast.Negation, vm.top())
+		case compiler.OpNot:
+			vm.stack[len(vm.stack)-1] = it.UnaryOp(ast.Not, vm.top())
+
+		case compiler.OpJump:
+			k := operand(code, pc)
+			pc += 2
+			pc += k
+		case compiler.OpJumpIfFalse:
+			kind := compiler.ConditionKind(code[pc])
+			pc++
+			distance := operand(code, pc)
+			pc += 2
+			condition := vm.pop()
+			holds, ok := condition.(BE.BoolValue)
+			if !ok && !it.Condition(condition, kind.String()) || ok && !holds.Value {
+				pc += distance
+			}
+		case compiler.OpLoop:
+			distance := operand(code, pc)
+			pc += 2
+			pc -= distance
+		case compiler.OpAnd:
+			distance := operand(code, pc)
+			pc += 2
+			if !it.LogicalOperand(vm.top()) {
+				pc += distance
+			} else {
+				vm.pop()
+			}
+		case compiler.OpOr:
+			distance := operand(code, pc)
+			pc += 2
+			if it.LogicalOperand(vm.top()) {
+				pc += distance
+			} else {
+				vm.pop()
+			}
+		case compiler.OpCheckBool:
+			it.LogicalOperand(vm.top())
+
+		case compiler.OpArray:
+			n := operand(code, pc)
+			pc += 2
+			it.AllocArray(n)
+			elements := make([]BE.RuntimeVal, n)
+			copy(elements, vm.stack[len(vm.stack)-n:])
+			vm.stack = vm.stack[:len(vm.stack)-n]
+			vm.push(&BE.ArrayVal{Elements: elements})
+		case compiler.OpObject:
+			n := operand(code, pc)
+			pc += 2
+			it.AllocObject(n)
+			obj := &BE.ObjectVal{Properties: make(map[string]BE.RuntimeVal, n)}
+			pairs := vm.stack[len(vm.stack)-2*n:]
+			for i := 0; i < len(pairs); i += 2 {
+				obj.Properties[pairs[i].(BE.StringVal).Value] = pairs[i+1]
+			}
+			vm.stack = vm.stack[:len(vm.stack)-2*n]
+			vm.push(obj)
+		case compiler.OpGetProperty:
+			k := operand(code, pc)
+			pc += 2
+			name := constants[k].(BE.StringVal).Value
+			vm.stack[len(vm.stack)-1] = it.GetProperty(vm.top(), name)
+		case compiler.OpGetIndex:
+			index := vm.pop()
+			vm.stack[len(vm.stack)-1] = it.GetIndex(vm.top(), index)
+
+		case compiler.OpCall:
+			argc := int(code[pc])
+			pc++
+			f.pc = pc
+			callee := len(vm.stack) - argc - 1
+			vm.locate(f)
+
+			if fn, ok := vm.stack[callee].(*BE.FunctionVal); ok {
+				if cl, ok := fn.Compiled.(*Closure); ok && cl.vm == vm {
+					vm.enterCall(fn, callee, argc)
+					// Missing arguments are null and extra ones are dropped
+					params := len(cl.Proto.Params)
+					for ; argc < params; argc++ {
+						vm.push(BE.Null)
+					}
+					vm.stack = vm.stack[:callee+1+params]
+					vm.pushFrame(cl, callee+1, it.FrameCount()-1, true)
+					f, proto, base, pc = vm.current()
+					code, constants = proto.Code, proto.Constants
+					continue
+				}
+			}
+
+			// Natives, tree-walked functions and closures of other VMs. They
+			// take their tracebacks before the VM can record its arguments
+			vm.arguments(f)
+			args := make([]BE.RuntimeVal, argc)
+			copy(args, vm.stack[callee+1:])
+			result := it.Invoke(vm.stack[callee], args)
+			vm.stack = vm.stack[:callee]
+			vm.push(result)
+		case compiler.OpClosure:
+			k := operand(code, pc)
+			pc += 2
+			child := constants[k].(*compiler.Proto)
+			cl := &Closure{vm: vm, Proto: child, upvalues: make([]*Upvalue, len(child.Upvalues))}
+			for i, up := range child.Upvalues {
+				if up.IsLocal {
+					cl.upvalues[i] = vm.captureUpvalue(base + up.Index)
+				} else {
+					cl.upvalues[i] = f.closure.upvalues[up.Index]
+				}
+			}
+			vm.push(cl.function())
+		case compiler.OpReturn:
+			result := vm.pop()
+			vm.unwind(len(vm.frames) - 1)
+			if len(vm.frames) == stop {
+				return result
+			}
+			vm.push(result)
+			f, proto, base, pc = vm.current()
+			code, constants = proto.Code, proto.Constants
+
+		case compiler.OpTry:
+			distance := operand(code, pc)
+			pc += 2
+			vm.handlers = append(vm.handlers, handler{frame: len(vm.frames) - 1, pc: pc + distance, sp: len(vm.stack)})
+		case compiler.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case compiler.OpThrow:
+			BE.ThrowValue(vm.pop())
+		case compiler.OpRaise:
+			k := operand(code, pc)
+			pc += 2
+			panic(&BE.RuntimeError{Message: constants[k].(BE.StringVal).Value})
+
+		default:
+			runtimeError("Unknown opcode %v at offset %d", op, pc-1)
+		}
+	}
+}
+
+// current returns the frame on top and where it is.
+func (vm *VM) current() (f *frame, proto *compiler.Proto, base, pc int) {
+	f = &vm.frames[len(vm.frames)-1]
+	return f, f.closure.Proto, f.base, f.pc
+}
+
+func (vm *VM) push(val BE.RuntimeVal) {
+	vm.stack = append(vm.stack, val)
+}
+
+func (vm *VM) pop() BE.RuntimeVal {
+	val := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return val
+}
+
+func (vm *VM) top() BE.RuntimeVal {
+	return vm.stack[len(vm.stack)-1]
+}
+
+// operand reads the two byte operand at pc.
+func operand(code []byte, pc int) int {
+	return int(binary.BigEndian.Uint16(code[pc:]))
+}
+
+// enterCall pushes the interpreter frame of a call to fn, whose argc
+// arguments follow the callee slot, and counts the call depth. If that
+// overflows, the traceback ends with the call like the tree walker's does.
+func (vm *VM) enterCall(fn *BE.FunctionVal, callee, argc int) {
+	vm.it.PushFrame(vm.it.FunctionFrame(fn, nil))
+	defer func() {
+		if r := recover(); r != nil {
+			if runtimeErr, ok := r.(*BE.RuntimeError); ok {
+				top := vm.it.FrameAt(vm.it.FrameCount() - 1)
+				top.Args = append([]BE.RuntimeVal(nil), vm.stack[callee+1:callee+1+argc]...)
+				vm.trace()
+				vm.it.TraceError(runtimeErr)
+			}
+			vm.it.PopFrame()
+			panic(r)
+		}
+	}()
+	vm.it.EnterCall(fn.Name)
+}
+
+// locate records the position of the instruction f is running in its
+// interpreter frame, so tracebacks taken by the callee of a call see it.
+func (vm *VM) locate(f *frame) {
+	if f.trace < 0 {
+		return
+	}
+	if pos := f.closure.Proto.PositionAt(f.pc - 1); pos.IsValid() {
+		tf := vm.it.FrameAt(f.trace)
+		tf.Line, tf.Column = pos.Line, pos.Column
+	}
+}
+
+// binaryOperators maps opcodes back to the operators backend.BinaryOp
+// takes, for the cases the VM does not handle itself.
+var binaryOperators = map[compiler.Opcode]ast.BinaryOperatorKind{
+	compiler.OpAdd:          ast.Add,
+	compiler.OpSubtract:     ast.Subtract,
+	compiler.OpMultiply:     ast.Multiply,
+	compiler.OpDivide:       ast.Divide,
+	compiler.OpModulo:       ast.Modulo,
+	compiler.OpEqual:        ast.Equal,
+	compiler.OpNotEqual:     ast.NotEqual,
+	compiler.OpIs:           "is",
+	compiler.OpLess:         ast.LessThan,
+	compiler.OpGreater:      ast.GreaterThan,
+	compiler.OpLessEqual:    "<=",
+	compiler.OpGreaterEqual: ">=",
+}
+
+// runtimeError aborts the run with a RuntimeError, as the tree walker's
+// errors do.
+func runtimeError(format string, args ...any) {
+	panic(&BE.RuntimeError{Message: fmt.Sprintf(format, args...)})
+}